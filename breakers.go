@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/breaker"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/docx"
+	"github.com/fazrithe/siasn-jf-backend-git/store/esign"
+	"github.com/jackc/pgx/v4/stdlib"
+)
+
+// breakers are the circuit breakers created by createBreaker, reconfigured when the BREAKER_* configs are reloaded.
+var breakers []*breaker.CircuitBreaker
+
+// createBreaker creates the circuit breaker of the dependency name from the BREAKER_* configs. Names are the same
+// as the names of the dependencies in the health checks. isFailure can be nil, see breaker.CircuitBreaker.
+func createBreaker(globalConfig *Config, name string, isFailure func(err error) bool) *breaker.CircuitBreaker {
+	b := breaker.NewCircuitBreaker(name, globalConfig.BreakerFailureThreshold, time.Duration(globalConfig.BreakerOpenTimeout)*time.Second)
+	b.HalfOpenProbes = globalConfig.BreakerHalfOpenProbes
+	b.IsFailure = isFailure
+	b.Metrics = breakerMetrics
+	b.Logger = createLogger(globalConfig, "breaker")
+	breakerMetrics.State.WithLabelValues(name).Set(float64(breaker.StateClosed))
+	breakers = append(breakers, b)
+	return b
+}
+
+// openPostgres opens a PostgreSQL database whose connections go through the circuit breaker of the dependency name.
+func openPostgres(globalConfig *Config, name string, url string) (*sql.DB, error) {
+	driverContext, ok := stdlib.GetDefaultDriver().(driver.DriverContext)
+	if !ok {
+		return nil, fmt.Errorf("pgx driver does not support connectors")
+	}
+	connector, err := driverContext.OpenConnector(url)
+	if err != nil {
+		return nil, err
+	}
+	return sql.OpenDB(breaker.NewConnector(connector, createBreaker(globalConfig, name, isPostgresFailure))), nil
+}
+
+// isPostgresFailure tells whether a database error is a failure of the database. Errors reported by PostgreSQL about
+// a statement, e.g. a constraint violation, mean that the database is up. Only connection exceptions (class 08),
+// insufficient resources (53), operator interventions (57) and system errors (58) are failures.
+func isPostgresFailure(err error) bool {
+	if !breaker.IsFailure(err) {
+		return false
+	}
+
+	var pgErr interface{ SQLState() string }
+	if !errors.As(err, &pgErr) || len(pgErr.SQLState()) < 2 {
+		return true
+	}
+	switch pgErr.SQLState()[:2] {
+	case "08", "53", "57", "58":
+		return true
+	}
+	return false
+}
+
+// isRendererFailure tells whether a rendering error is a failure of the renderer, bad templates are not.
+func isRendererFailure(err error) bool {
+	return breaker.IsFailure(err) && !errors.Is(err, docx.ErrBadTemplate)
+}
+
+// isSignerFailure tells whether a signing error is a failure of the signing service. Documents rejected by the
+// service, e.g. because of a wrong passphrase, are not.
+func isSignerFailure(err error) bool {
+	return breaker.IsFailure(err) && !errors.Is(err, esign.ErrSignRejected)
+}
+
+// breakerRenderer renders docx templates through a circuit breaker.
+type breakerRenderer struct {
+	renderer docx.Renderer
+	breaker  *breaker.CircuitBreaker
+}
+
+func (r *breakerRenderer) Render(data interface{}, templatePath string, outputPath string) (err error) {
+	return r.breaker.Do(func() error {
+		return r.renderer.Render(data, templatePath, outputPath)
+	})
+}
+
+func (r *breakerRenderer) RenderCtx(ctx context.Context, data interface{}, templatePath string, outputPath string) (err error) {
+	return r.breaker.Do(func() error {
+		return r.renderer.RenderCtx(ctx, data, templatePath, outputPath)
+	})
+}
+
+func (r *breakerRenderer) RenderAsPdf(data interface{}, templatePath string, outputPath string) (err error) {
+	return r.breaker.Do(func() error {
+		return r.renderer.RenderAsPdf(data, templatePath, outputPath)
+	})
+}
+
+func (r *breakerRenderer) RenderAsPdfCtx(ctx context.Context, data interface{}, templatePath string, outputPath string) (err error) {
+	return r.breaker.Do(func() error {
+		return r.renderer.RenderAsPdfCtx(ctx, data, templatePath, outputPath)
+	})
+}
+
+// breakerSigner signs documents through a circuit breaker.
+type breakerSigner struct {
+	signer  esign.Signer
+	breaker *breaker.CircuitBreaker
+}
+
+func (s *breakerSigner) SignPdfCtx(ctx context.Context, identity *esign.Identity, document io.Reader) (signed []byte, err error) {
+	err = s.breaker.Do(func() (err error) {
+		signed, err = s.signer.SignPdfCtx(ctx, identity, document)
+		return err
+	})
+	return signed, err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+
+	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/httputil"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/logutil"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/openapi"
+	"github.com/gorilla/mux"
+)
+
+// openapiDocument is the OpenAPI document of /api/v1, embedded so that the contract checker does not depend on the
+// working directory.
+//
+//go:embed siasn-jf.json
+var openapiDocument []byte
+
+// loadOpenapiSpec loads the embedded OpenAPI document.
+func loadOpenapiSpec() (*openapi.Spec, error) {
+	return openapi.Load(openapiDocument)
+}
+
+// createContractChecker creates the middleware checking /api/v1 against the OpenAPI document in the given mode, see
+// openapi.ParseMode. Rejected requests and responses are answered with ErrCodeContractRequest and
+// ErrCodeContractResponse, listing the mismatches in the data of the error.
+func createContractChecker(mode string, logger logutil.Logger) (*openapi.Checker, error) {
+	contractMode, err := openapi.ParseMode(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := loadOpenapiSpec()
+	if err != nil {
+		return nil, err
+	}
+
+	return &openapi.Checker{
+		Spec:     spec,
+		Mode:     contractMode,
+		Template: routeTemplate,
+		RejectRequest: func(writer http.ResponseWriter, _ *http.Request, mismatches []*openapi.Mismatch) {
+			writeContractError(writer, ErrCodeContractRequest, mismatches)
+		},
+		RejectResponse: func(writer http.ResponseWriter, _ *http.Request, mismatches []*openapi.Mismatch) {
+			writeContractError(writer, ErrCodeContractResponse, mismatches)
+		},
+		Logger: logger,
+	}, nil
+}
+
+// routeTemplate returns the path template of the mux route matched by request, or its path if no route matched.
+func routeTemplate(request *http.Request) string {
+	if route := mux.CurrentRoute(request); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return request.URL.Path
+}
+
+func writeContractError(writer http.ResponseWriter, code int, mismatches []*openapi.Mismatch) {
+	_ = httputil.WriteObj(writer, &ec.Error{Message: Errs[code], Code: code, Data: mismatches}, ErrsToHttp[code])
+}
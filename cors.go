@@ -0,0 +1,43 @@
+package main
+
+import "sync"
+
+// originList holds the origins allowed by CORS, CORS_ALLOWED_ORIGINS, which can be replaced while requests are
+// served. An empty list, a list containing "*" or a nil *originList allows every origin.
+type originList struct {
+	mu      sync.RWMutex
+	origins []string
+}
+
+// newOriginList creates an originList allowing origins.
+func newOriginList(origins []string) *originList {
+	l := &originList{}
+	l.Set(origins)
+	return l
+}
+
+// Set replaces the allowed origins.
+func (l *originList) Set(origins []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.origins = append([]string(nil), origins...)
+}
+
+// Allowed tells whether origin is allowed, it is a handlers.OriginValidator.
+func (l *originList) Allowed(origin string) bool {
+	if l == nil {
+		return true
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if len(l.origins) == 0 {
+		return true
+	}
+	for _, allowed := range l.origins {
+		if allowed == origin || allowed == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -42,6 +42,47 @@ const (
 	// have incorrect syntax, must not contain spaces between two words (e.g. `{{ nama instansi }}` is not allowed, must be
 	// `{{ nama_instansi }}`).
 	ErrCodeDocumentGenerateBadTemplate
+	// ErrCodeWorkflowTransitionInvalid - 10425: the action cannot be done on the admission in its current status.
+	ErrCodeWorkflowTransitionInvalid
+	// ErrCodeWorkflowDocumentMissing - 10426: some documents required by the action are not supplied.
+	ErrCodeWorkflowDocumentMissing
+	// ErrCodeNotificationEmailMissing - 10427: the user has no email address in the identity provider to send
+	// notifications to.
+	ErrCodeNotificationEmailMissing
+	// ErrCodeJobIdentityExpired - 10428: the signing identity of a queued document generation job is no longer
+	// available, e.g. the job has waited too long or the server has restarted, the document must be signed again.
+	ErrCodeJobIdentityExpired
+	// ErrCodeExportFormatInvalid - 10429: the requested export format is not supported, must be xlsx or csv.
+	ErrCodeExportFormatInvalid
+	// ErrCodeStatisticGroupInvalid - 10430: statistics can only be grouped by month, quarter or year.
+	ErrCodeStatisticGroupInvalid
+	// ErrCodeStatisticDateRangeInvalid - 10431: the start date of a statistic is after its end date, or the time series
+	// contains too many periods.
+	ErrCodeStatisticDateRangeInvalid
+	// ErrCodeFilterDateRangeInvalid - 10432: the start date of a search (tgl_dari) is after its end date (tgl_sampai).
+	ErrCodeFilterDateRangeInvalid
+	// ErrCodeFilterSortInvalid - 10433: the sort order of a search (urutan) is not supported, must be tgl_usulan, status
+	// or no_usulan, optionally prefixed with - for descending order.
+	ErrCodeFilterSortInvalid
+	// ErrCodePaginationInvalid - 10434: the pagination of a search is not supported, must be offset or cursor.
+	ErrCodePaginationInvalid
+	// ErrCodeCursorInvalid - 10435: the cursor of a search is malformed, or was created with another sort order.
+	ErrCodeCursorInvalid
+	// ErrCodeSearchQueryInvalid - 10436: the query of a full-text search (q) does not contain any word of at least 2
+	// letters or digits.
+	ErrCodeSearchQueryInvalid
+	// ErrCodeSearchTypeInvalid - 10437: the type of a full-text search hit (jenis) is not supported, must be activity,
+	// requirement, dismissal or promotion.
+	ErrCodeSearchTypeInvalid
+	// ErrCodeRequestValidation - 10438: some fields of the request are invalid, the data of the error lists every
+	// invalid field with the rule it failed.
+	ErrCodeRequestValidation
+	// ErrCodeContractRequest - 10439: the request does not match the OpenAPI specification of its endpoint, the data of
+	// the error lists every mismatch. Only returned when CONTRACT_MODE is enforce.
+	ErrCodeContractRequest
+	// ErrCodeContractResponse - 10440: the response of the endpoint does not match its OpenAPI specification, the data
+	// of the error lists every mismatch. Only returned when CONTRACT_MODE is enforce.
+	ErrCodeContractResponse
 )
 
 const (
@@ -78,6 +119,11 @@ const (
 	ErrCodeStoragePutFail
 	// ErrCodeStorageGetMetadataFail - 10509: Getting metadata for a file in object storage failed.
 	ErrCodeStorageGetMetadataFail
+	// ErrCodeDocumentSign - 10516: unable to sign document electronically, or to store the signed document.
+	ErrCodeDocumentSign
+	// ErrCodeDependencyUnavailable - 10517: a dependency of the endpoint, e.g. the profile database, keeps failing and its
+	// circuit breaker is open, the request is failed fast. The data of the error names the dependency.
+	ErrCodeDependencyUnavailable
 )
 
 // Errs map ensures that there are no duplicate error codes in this service.
@@ -99,6 +145,22 @@ var Errs = map[int]string{
 	ErrCodeEndpointGone:                "the endpoint is no longer available",
 	ErrCodeRoleUnauthorized:            "user is unauthorized to do the action",
 	ErrCodeDocumentGenerateBadTemplate: "unable to generate document from docx template, some placeholders have incorrect syntax, e.g. must not contain spaces between two words (`{{ nama instansi }}` is not allowed, must be `{{ nama_instansi }}`)",
+	ErrCodeWorkflowTransitionInvalid:   "action is not allowed for the current admission status",
+	ErrCodeWorkflowDocumentMissing:     "documents required by the action are missing",
+	ErrCodeNotificationEmailMissing:    "user does not have an email address to send notifications to",
+	ErrCodeJobIdentityExpired:          "the signing passphrase has expired before the document was generated, sign the document again",
+	ErrCodeExportFormatInvalid:         "export format must be xlsx or csv",
+	ErrCodeStatisticGroupInvalid:       "statistics can only be grouped by month, quarter or year",
+	ErrCodeStatisticDateRangeInvalid:   "start date must not be after end date, and a time series must not contain more than 240 periods",
+	ErrCodeFilterDateRangeInvalid:      "tgl_dari must not be after tgl_sampai",
+	ErrCodeFilterSortInvalid:           "urutan must be tgl_usulan, status or no_usulan, optionally prefixed with - for descending order",
+	ErrCodePaginationInvalid:           "pagination must be offset or cursor",
+	ErrCodeCursorInvalid:               "cursor is invalid or does not match the sort order, restart from the first page",
+	ErrCodeSearchQueryInvalid:          "q must contain at least one word of 2 or more letters or digits",
+	ErrCodeSearchTypeInvalid:           "jenis must be activity, requirement, dismissal or promotion",
+	ErrCodeRequestValidation:           "some fields of the request are invalid, see data for each field",
+	ErrCodeContractRequest:             "request does not match the API specification, see data for each mismatch",
+	ErrCodeContractResponse:            "response does not match the API specification, see data for each mismatch",
 
 	ErrCodeResponseParseFail:      "cannot read response from backend services",
 	ErrCodePrepareFail:            "cannot prepare SQL statement",
@@ -112,6 +174,8 @@ var Errs = map[int]string{
 	ErrCodeDocumentGenerate:       "unable to generate document from docx template",
 	ErrCodeStoragePutFail:         "unable to put file into object storage",
 	ErrCodeStorageGetMetadataFail: "unable to retrieve file metadata from storage",
+	ErrCodeDocumentSign:           "unable to sign document electronically",
+	ErrCodeDependencyUnavailable:  "a dependency of this service is unavailable, try again later",
 }
 
 // ErrsToHttp is a map of error codes to HTTP status codes. Those that do not exist in this map
@@ -136,6 +200,23 @@ var ErrsToHttp = map[int]int{
 	ErrCodeEndpointGone:                451,
 	ErrCodeRoleUnauthorized:            403,
 	ErrCodeDocumentGenerateBadTemplate: 400,
+	ErrCodeWorkflowTransitionInvalid:   400,
+	ErrCodeWorkflowDocumentMissing:     400,
+	ErrCodeNotificationEmailMissing:    400,
+	ErrCodeJobIdentityExpired:          400,
+	ErrCodeExportFormatInvalid:         400,
+	ErrCodeStatisticGroupInvalid:       400,
+	ErrCodeStatisticDateRangeInvalid:   400,
+	ErrCodeFilterDateRangeInvalid:      400,
+	ErrCodeFilterSortInvalid:           400,
+	ErrCodePaginationInvalid:           400,
+	ErrCodeCursorInvalid:               400,
+	ErrCodeSearchQueryInvalid:          400,
+	ErrCodeSearchTypeInvalid:           400,
+	ErrCodeRequestValidation:           400,
+	ErrCodeContractRequest:             400,
+	ErrCodeContractResponse:            500,
+	ErrCodeDependencyUnavailable:       503,
 }
 
 var (
@@ -150,3 +231,19 @@ var (
 	ErrInvalidUser            = ec.NewErrorBasic(ErrCodeInvalidUser, Errs[ErrCodeInvalidUser])
 	ErrNoWorkAgencyId         = ec.NewErrorBasic(ErrCodeNoWorkAgencyId, Errs[ErrCodeNoWorkAgencyId])
 )
+
+var (
+	ErrNotificationEmailMissing  = ec.NewErrorBasic(ErrCodeNotificationEmailMissing, Errs[ErrCodeNotificationEmailMissing])
+	ErrJobIdentityExpired        = ec.NewErrorBasic(ErrCodeJobIdentityExpired, Errs[ErrCodeJobIdentityExpired])
+	ErrExportFormatInvalid       = ec.NewErrorBasic(ErrCodeExportFormatInvalid, Errs[ErrCodeExportFormatInvalid])
+	ErrStatisticGroupInvalid     = ec.NewErrorBasic(ErrCodeStatisticGroupInvalid, Errs[ErrCodeStatisticGroupInvalid])
+	ErrStatisticDateRangeInvalid = ec.NewErrorBasic(ErrCodeStatisticDateRangeInvalid, Errs[ErrCodeStatisticDateRangeInvalid])
+	ErrFilterDateRangeInvalid    = ec.NewErrorBasic(ErrCodeFilterDateRangeInvalid, Errs[ErrCodeFilterDateRangeInvalid])
+	ErrFilterSortInvalid         = ec.NewErrorBasic(ErrCodeFilterSortInvalid, Errs[ErrCodeFilterSortInvalid])
+	ErrPaginationInvalid         = ec.NewErrorBasic(ErrCodePaginationInvalid, Errs[ErrCodePaginationInvalid])
+	ErrCursorInvalid             = ec.NewErrorBasic(ErrCodeCursorInvalid, Errs[ErrCodeCursorInvalid])
+	ErrSearchQueryInvalid        = ec.NewErrorBasic(ErrCodeSearchQueryInvalid, Errs[ErrCodeSearchQueryInvalid])
+	ErrSearchTypeInvalid         = ec.NewErrorBasic(ErrCodeSearchTypeInvalid, Errs[ErrCodeSearchTypeInvalid])
+	ErrContractRequest           = ec.NewErrorBasic(ErrCodeContractRequest, Errs[ErrCodeContractRequest])
+	ErrContractResponse          = ec.NewErrorBasic(ErrCodeContractResponse, Errs[ErrCodeContractResponse])
+)
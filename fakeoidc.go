@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/fakeoidc"
+)
+
+// startFakeOidcProvider serves a fake OpenID Connect provider at OIDC_PROVIDER_URL, with the users of
+// OIDC_FAKE_USERS, so that the service can run without Keycloak during development. It listens before returning, as
+// auth.NewAuth reads the discovery document right away.
+func startFakeOidcProvider(globalConfig *Config) (provider *fakeoidc.Provider, err error) {
+	providerUrl, err := url.Parse(globalConfig.OidcProviderUrl)
+	if err != nil {
+		return nil, err
+	}
+	if providerUrl.Scheme != "http" || providerUrl.Port() == "" {
+		return nil, fmt.Errorf("fake OIDC provider is served over http with an explicit port, e.g. http://localhost:8089, got %s", globalConfig.OidcProviderUrl)
+	}
+	// Anyone reaching the fake provider can log in as any of its users, it must not be reachable from other hosts.
+	if !isLoopbackHost(providerUrl.Hostname()) {
+		return nil, fmt.Errorf("fake OIDC provider only listens on a loopback address, e.g. http://localhost:8089, got %s", globalConfig.OidcProviderUrl)
+	}
+
+	users, err := fakeoidc.ParseUsers(globalConfig.OidcFakeUsers)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err = fakeoidc.NewProvider(globalConfig.OidcProviderUrl, globalConfig.OidcClientId, globalConfig.OidcClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	provider.RedirectUri = globalConfig.OidcRedirectUrl
+	for _, user := range users {
+		provider.AddUser(user)
+	}
+
+	listener, err := net.Listen("tcp", providerUrl.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := createLogger(globalConfig, "fake-oidc")
+	logger.Infof("fake OIDC provider listening to %s", providerUrl.Host)
+	go func() {
+		err := http.Serve(listener, provider)
+		logger.Errorf("fake OIDC provider stopped: %s", err)
+	}()
+
+	return provider, nil
+}
+
+// isLoopbackHost checks whether host is localhost or a loopback IP address. An empty host, listening on every
+// interface, is not.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
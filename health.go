@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/health"
+	"github.com/fazrithe/siasn-jf-backend-git/store/object"
+	"github.com/go-redis/redis/v8"
+)
+
+// healthCheckInterval is the interval in which dependencies are checked in the background to update the health
+// gauges, probes check them again on each request.
+const healthCheckInterval = 30 * time.Second
+
+// createHealthChecker creates the checker of /healthz and /readyz. The Redis session backend is only checked if
+// redisClient is not nil, the object storage if it implements object.BucketChecker, siasn-docx only if it is the
+// docx renderer and soffice only if SOFFICE_CMD is not empty.
+func createHealthChecker(globalConfig *Config, db, profileDb, referenceDb *sql.DB, redisClient *redis.Client, storage object.Storage) *health.Checker {
+	checker := health.NewChecker(time.Duration(globalConfig.HealthCheckTimeout) * time.Second)
+	checker.Metrics = healthMetrics
+
+	checker.Add("postgres", db.PingContext)
+	checker.Add("profile_postgres", profileDb.PingContext)
+	checker.Add("reference_postgres", referenceDb.PingContext)
+	if redisClient != nil {
+		checker.Add("redis", func(ctx context.Context) error {
+			return redisClient.Ping(ctx).Err()
+		})
+	}
+	if bucketChecker, ok := storage.(object.BucketChecker); ok {
+		checker.Add("object_storage", bucketChecker.CheckBuckets)
+	}
+	if globalConfig.DocxRenderer == DocxRendererSiasn {
+		checker.Add("siasn_docx", health.CommandCheck(globalConfig.SiasnDocxCmd))
+	}
+	if globalConfig.SofficeCmd != "" {
+		checker.Add("soffice", health.CommandCheck(globalConfig.SofficeCmd))
+	}
+
+	return checker
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"reflect"
 	"sync"
+	"time"
 )
 
 // AccessToken is a structure containing fields that are available in decoded access token.
@@ -101,19 +102,25 @@ type AccessTokenCache interface {
 
 // MemoryAccessTokenCache implements AccessTokenCache by simply storing token data in a Golang map.
 // Access to the map is protected with RWMutex which locks the whole map.
-// MemoryAccessTokenCache also implements NonceCache.
+// MemoryAccessTokenCache also implements NonceCache and SessionCache, expired sessions are removed when they are
+// accessed.
 type MemoryAccessTokenCache struct {
 	mu        sync.RWMutex
 	data      map[string]*AccessToken
 	nonceData map[string]struct{}
 	stateData map[string]*StateData
+	sessions  map[string]*Session
+	// sessionTokens maps the hashes of ID tokens to the IDs of their sessions.
+	sessionTokens map[string]string
 }
 
 func NewMemoryAccessTokenCache() *MemoryAccessTokenCache {
 	return &MemoryAccessTokenCache{
-		data:      make(map[string]*AccessToken),
-		nonceData: make(map[string]struct{}),
-		stateData: make(map[string]*StateData),
+		data:          make(map[string]*AccessToken),
+		nonceData:     make(map[string]struct{}),
+		stateData:     make(map[string]*StateData),
+		sessions:      make(map[string]*Session),
+		sessionTokens: make(map[string]string),
 	}
 }
 
@@ -182,19 +189,103 @@ func (m *MemoryAccessTokenCache) DeleteAccessToken(idToken string) (err error) {
 	return nil
 }
 
+func (m *MemoryAccessTokenCache) SaveSession(session *Session) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	saved := *session
+	m.sessions[session.Id] = &saved
+	m.sessionTokens[hashIdToken(session.RawIdToken)] = session.Id
+	return nil
+}
+
+func (m *MemoryAccessTokenCache) GetSession(id string) (session *Session, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.getSession(id), nil
+}
+
+func (m *MemoryAccessTokenCache) GetSessionByIdToken(idToken string) (session *Session, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, ok := m.sessionTokens[hashIdToken(idToken)]
+	if !ok {
+		return nil, nil
+	}
+	session = m.getSession(id)
+	if session == nil {
+		delete(m.sessionTokens, hashIdToken(idToken))
+	}
+	return session, nil
+}
+
+func (m *MemoryAccessTokenCache) ListSessions(subject string) (sessions []*Session, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, stored := range m.sessions {
+		if stored.Subject != subject {
+			continue
+		}
+		if session := m.getSession(id); session != nil {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *MemoryAccessTokenCache) DeleteSession(id string) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteSession(id)
+	return nil
+}
+
+// getSession returns a copy of a session, so that it is not modified concurrently, and removes it if it has expired.
+// m.mu must be locked.
+func (m *MemoryAccessTokenCache) getSession(id string) *Session {
+	stored, ok := m.sessions[id]
+	if !ok {
+		return nil
+	}
+	if stored.expired(time.Now()) {
+		m.deleteSession(id)
+		return nil
+	}
+	session := *stored
+	return &session
+}
+
+// deleteSession removes a session and the links of its ID tokens. m.mu must be locked.
+func (m *MemoryAccessTokenCache) deleteSession(id string) {
+	delete(m.sessions, id)
+	for hash, sessionId := range m.sessionTokens {
+		if sessionId == id {
+			delete(m.sessionTokens, hash)
+		}
+	}
+}
+
+// RedisAccessTokenCache implements AccessTokenCache, NonceCache and SessionCache with Redis.
+// Redis must be set to use it as a SessionCache, it stores the set of sessions of each subject.
 type RedisAccessTokenCache struct {
-	Cache       *cache.Cache
-	Prefix      string
-	NoncePrefix string
-	StatePrefix string
+	Cache                 *cache.Cache
+	Redis                 redis.Cmdable
+	Prefix                string
+	NoncePrefix           string
+	StatePrefix           string
+	SessionPrefix         string
+	SessionTokenPrefix    string
+	SubjectSessionsPrefix string
 }
 
 func NewRedisAccessTokenCache(cache *cache.Cache) *RedisAccessTokenCache {
 	return &RedisAccessTokenCache{
-		Cache:       cache,
-		Prefix:      "access",
-		NoncePrefix: "nonce",
-		StatePrefix: "state",
+		Cache:                 cache,
+		Prefix:                "access",
+		NoncePrefix:           "nonce",
+		StatePrefix:           "state",
+		SessionPrefix:         "session",
+		SessionTokenPrefix:    "session-token",
+		SubjectSessionsPrefix: "subject-sessions",
 	}
 }
 
@@ -210,6 +301,18 @@ func (r *RedisAccessTokenCache) stateKey(stateKey string) string {
 	return fmt.Sprintf("%s:%s", r.StatePrefix, stateKey)
 }
 
+func (r *RedisAccessTokenCache) sessionKey(id string) string {
+	return fmt.Sprintf("%s:%s", r.SessionPrefix, id)
+}
+
+func (r *RedisAccessTokenCache) sessionTokenKey(idToken string) string {
+	return fmt.Sprintf("%s:%s", r.SessionTokenPrefix, hashIdToken(idToken))
+}
+
+func (r *RedisAccessTokenCache) subjectSessionsKey(subject string) string {
+	return fmt.Sprintf("%s:%s", r.SubjectSessionsPrefix, subject)
+}
+
 func (r *RedisAccessTokenCache) SaveState(data *StateData) (stateKey string, err error) {
 	stateKey = uuid.NewString()
 	err = r.Cache.Set(&cache.Item{
@@ -303,3 +406,119 @@ func (r *RedisAccessTokenCache) DeleteAccessToken(idToken string) (err error) {
 
 	return nil
 }
+
+func (r *RedisAccessTokenCache) SaveSession(session *Session) (err error) {
+	if r.Redis == nil {
+		return ErrNoRedisClient
+	}
+
+	ctx := context.Background()
+	ttl := time.Until(session.RefreshExpiry)
+	if ttl <= 0 {
+		return r.DeleteSession(session.Id)
+	}
+
+	err = r.Cache.Set(&cache.Item{
+		Ctx:   ctx,
+		Key:   r.sessionKey(session.Id),
+		Value: session,
+		TTL:   ttl,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = r.Cache.Set(&cache.Item{
+		Ctx:   ctx,
+		Key:   r.sessionTokenKey(session.RawIdToken),
+		Value: session.Id,
+		TTL:   ttl,
+	})
+	if err != nil {
+		return err
+	}
+
+	// The set lives as long as the longest session in it, the IDs of expired sessions are removed by ListSessions.
+	subjectKey := r.subjectSessionsKey(session.Subject)
+	err = r.Redis.SAdd(ctx, subjectKey, session.Id).Err()
+	if err != nil {
+		return err
+	}
+	setTtl, err := r.Redis.TTL(ctx, subjectKey).Result()
+	if err != nil {
+		return err
+	}
+	if setTtl < ttl {
+		err = r.Redis.Expire(ctx, subjectKey, ttl).Err()
+	}
+	return err
+}
+
+func (r *RedisAccessTokenCache) GetSession(id string) (session *Session, err error) {
+	session = &Session{}
+	err = r.Cache.Get(context.Background(), r.sessionKey(id), session)
+	if err == redis.Nil || err == cache.ErrCacheMiss {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (r *RedisAccessTokenCache) GetSessionByIdToken(idToken string) (session *Session, err error) {
+	var id string
+	err = r.Cache.Get(context.Background(), r.sessionTokenKey(idToken), &id)
+	if err == redis.Nil || err == cache.ErrCacheMiss {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.GetSession(id)
+}
+
+func (r *RedisAccessTokenCache) ListSessions(subject string) (sessions []*Session, err error) {
+	if r.Redis == nil {
+		return nil, ErrNoRedisClient
+	}
+
+	ctx := context.Background()
+	subjectKey := r.subjectSessionsKey(subject)
+	ids, err := r.Redis.SMembers(ctx, subjectKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		session, err := r.GetSession(id)
+		if err != nil {
+			return nil, err
+		}
+		if session == nil {
+			_ = r.Redis.SRem(ctx, subjectKey, id).Err()
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// DeleteSession deletes a session. The links of its ID tokens are left to expire, they do not lead to a session
+// anymore.
+func (r *RedisAccessTokenCache) DeleteSession(id string) (err error) {
+	session, err := r.GetSession(id)
+	if err != nil || session == nil {
+		return err
+	}
+
+	err = r.Cache.Delete(context.Background(), r.sessionKey(id))
+	if err != nil && err != redis.Nil && err != cache.ErrCacheMiss {
+		return err
+	}
+
+	if r.Redis != nil {
+		return r.Redis.SRem(context.Background(), r.subjectSessionsKey(session.Subject), id).Err()
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/httputil"
+)
+
+// Impersonation lets a user, e.g. a BKN administrator, act as another user to reproduce what they see. It is stored in
+// the session of the impersonator: while it lasts, UserDetailAuthHandler returns the user detail of the impersonated
+// user with the impersonator as its Impersonator, so that what is done can be attributed to both. It ends at
+// ExpiresAt, when it is stopped, or when the session ends.
+//
+// The provider does not issue tokens for the impersonated user, its access token is the one of the impersonator with
+// Roles as its only roles: the roles of the impersonated user among Auth.ImpersonationRoles, see Auth.UserRoles.
+type Impersonation struct {
+	// Nip is the NIP of the impersonated user.
+	Nip string `json:"nip"`
+	// Roles are the roles of the impersonated user among Auth.ImpersonationRoles, when the impersonation started.
+	Roles []string `json:"roles"`
+	// Reason is why the user is impersonated, e.g. the ID of a support ticket.
+	Reason    string    `json:"alasan"`
+	StartedAt time.Time `json:"started_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// expired tells whether the impersonation has expired at now.
+func (i *Impersonation) expired(now time.Time) bool {
+	return !now.Before(i.ExpiresAt)
+}
+
+// accessToken returns the access token of the impersonated user, derived from the access token of the impersonator.
+func (i *Impersonation) accessToken(impersonatorToken *AccessToken) *AccessToken {
+	token := &AccessToken{}
+	if impersonatorToken != nil {
+		*token = *impersonatorToken
+	}
+	token.PreferredUsername = i.Nip
+	token.RealmAccess = &struct {
+		Roles []string `json:"roles"`
+	}{Roles: i.Roles}
+	token.ResourceAccess = nil
+	// Roles may be cached per token, those of the impersonator or of an earlier impersonation must not be reused.
+	if token.Jti != "" {
+		token.Jti += ":impersonation:" + strconv.FormatInt(i.StartedAt.UnixNano(), 10)
+	}
+	return token
+}
+
+// activeImpersonation returns the impersonation of session, or nil if there is none. An expired impersonation is
+// removed from the session.
+func (a *Auth) activeImpersonation(session *Session) *Impersonation {
+	if session.Impersonation == nil {
+		return nil
+	}
+	if !session.Impersonation.expired(time.Now()) {
+		return session.Impersonation
+	}
+
+	a.Logger.Infof("impersonation of %s by %s has expired", session.Impersonation.Nip, session.Username)
+	session.Impersonation = nil
+	if err := a.SessionCache.SaveSession(session); err != nil {
+		a.Logger.Warnf("cannot remove expired impersonation from session %s: %s", session.Id, err)
+	}
+	return nil
+}
+
+// impersonate returns the user detail of the user impersonated by impersonator. If it cannot be retrieved, the error
+// response is written and the error is returned. Requests that may change data are logged with both users.
+func (a *Auth) impersonate(writer http.ResponseWriter, request *http.Request, impersonator *Asn, impersonation *Impersonation) (userDetail *Asn, err error) {
+	userDetail, err = a.GetUserDetail(context.Background(), impersonation.Nip, "")
+	if err != nil {
+		_ = httputil.WriteObj(writer, err, http.StatusInternalServerError)
+		return nil, err
+	}
+	if userDetail == nil || userDetail.WorkAgencyId == "" {
+		err = ec.NewErrorBasic(ErrCodeImpersonatedNotFound, ErrMessageImpersonatedNotFound)
+		_ = httputil.WriteObj(writer, err, http.StatusForbidden)
+		return nil, err
+	}
+	userDetail.Username = impersonation.Nip
+	userDetail.AccessToken = impersonation.accessToken(impersonator.AccessToken)
+	userDetail.Impersonator = impersonator
+	userDetail.Impersonation = impersonation
+
+	switch request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		a.Logger.Infof(
+			"%s %s by %s (%s) impersonating %s (%s)",
+			request.Method,
+			request.URL.Path,
+			impersonator.NewNip,
+			impersonator.AsnId,
+			userDetail.NewNip,
+			userDetail.AsnId,
+		)
+	}
+	return userDetail, nil
+}
+
+// impersonationRoles returns the roles of user among ImpersonationRoles, none if UserRoles is nil.
+func (a *Auth) impersonationRoles(ctx context.Context, user *Asn) (roles []string, err error) {
+	if a.UserRoles == nil {
+		return []string{}, nil
+	}
+	userRoles, err := a.UserRoles(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	roles = []string{}
+	for _, role := range a.ImpersonationRoles {
+		if contains(userRoles, role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+// HandleImpersonationStart starts impersonating a user in the session of the request, given a JSON body
+// {"nip": "...", "alasan": "...", "durasi_menit": 30}. durasi_menit defaults to, and cannot exceed,
+// ImpersonationMaxDuration. The impersonated user keeps their own roles among ImpersonationRoles, and cannot be
+// impersonated if they have none. Impersonations cannot be nested, and users authenticated with a bearer token cannot
+// impersonate.
+//
+// Anyone who can call it can act as any user, its route must only be allowed to administrators. Cannot be used if
+// SessionCache is nil, it must be behind UserDetailAuthHandler.
+func (a *Auth) HandleImpersonationStart(writer http.ResponseWriter, request *http.Request) {
+	user := AssertReqGetUserExtended(request)
+	impersonator := AssertReqGetUserDetail(request)
+	if user.SessionId == "" || impersonator.Impersonator != nil {
+		_ = httputil.WriteObj(writer, ec.NewErrorBasic(ErrCodeCannotImpersonate, ErrMessageCannotImpersonate), http.StatusForbidden)
+		return
+	}
+
+	body := &struct {
+		Nip             string `json:"nip"`
+		Reason          string `json:"alasan"`
+		DurationMinutes int    `json:"durasi_menit"`
+	}{}
+	// Roles cannot be asked for, e.g. by clients written when they could, the impersonated user keeps their own.
+	decoder := json.NewDecoder(request.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(body)
+	duration := time.Duration(body.DurationMinutes) * time.Minute
+	if duration == 0 {
+		duration = a.ImpersonationMaxDuration
+	}
+	body.Nip, body.Reason = strings.TrimSpace(body.Nip), strings.TrimSpace(body.Reason)
+	if err != nil || body.Nip == "" || body.Reason == "" || duration < 0 || duration > a.ImpersonationMaxDuration {
+		_ = httputil.WriteObj(writer, ec.NewErrorBasic(ErrCodeInvalidImpersonation, ErrMessageInvalidImpersonation), http.StatusBadRequest)
+		return
+	}
+
+	impersonated, err := a.GetUserDetail(request.Context(), body.Nip, "")
+	if err != nil {
+		_ = httputil.WriteObj(writer, err, http.StatusInternalServerError)
+		return
+	}
+	if impersonated == nil || impersonated.WorkAgencyId == "" {
+		_ = httputil.WriteObj(writer, ec.NewErrorBasic(ErrCodeImpersonatedNotFound, ErrMessageImpersonatedNotFound), http.StatusNotFound)
+		return
+	}
+	if impersonated.AsnId == impersonator.AsnId {
+		_ = httputil.WriteObj(writer, ec.NewErrorBasic(ErrCodeInvalidImpersonation, ErrMessageInvalidImpersonation), http.StatusBadRequest)
+		return
+	}
+	roles, err := a.impersonationRoles(request.Context(), impersonated)
+	if err != nil {
+		a.Logger.Warnf("cannot retrieve roles of %s: %s", impersonated.NewNip, err)
+		_ = httputil.WriteObj(writer, err, http.StatusInternalServerError)
+		return
+	}
+	if len(roles) == 0 {
+		_ = httputil.WriteObj(writer, ec.NewErrorBasic(ErrCodeInvalidImpersonation, ErrMessageInvalidImpersonation), http.StatusBadRequest)
+		return
+	}
+
+	session, err := a.SessionCache.GetSession(user.SessionId)
+	if err != nil {
+		a.Logger.Warnf("cannot retrieve user session: %s", err)
+		_ = httputil.WriteObj(writer, ec.NewError(ErrCodeSessionStorageFail, ErrMessageSessionStorageFail, err), http.StatusInternalServerError)
+		return
+	}
+	if session == nil {
+		a.WriteUnauthorized(writer, ErrCodeSessionExpired, ErrMessageSessionExpired, nil)
+		return
+	}
+
+	now := time.Now()
+	session.Impersonation = &Impersonation{
+		Nip:       impersonated.NewNip,
+		Roles:     roles,
+		Reason:    body.Reason,
+		StartedAt: now,
+		ExpiresAt: now.Add(duration),
+	}
+	err = a.SessionCache.SaveSession(session)
+	if err != nil {
+		a.Logger.Warnf("cannot save user session: %s", err)
+		_ = httputil.WriteObj(writer, ec.NewError(ErrCodeSessionStorageFail, ErrMessageSessionStorageFail, err), http.StatusInternalServerError)
+		return
+	}
+
+	a.Logger.Infof(
+		"impersonation of %s (%s) with roles %v started by %s (%s) until %s: %s",
+		impersonated.NewNip,
+		impersonated.AsnId,
+		roles,
+		impersonator.NewNip,
+		impersonator.AsnId,
+		session.Impersonation.ExpiresAt.Format(time.RFC3339),
+		body.Reason,
+	)
+	_ = httputil.WriteObj200(writer, session.Impersonation)
+}
+
+// HandleImpersonationStop stops the impersonation of the session of the request, the user is themselves again.
+// Cannot be used if SessionCache is nil, it must be behind UserDetailAuthHandler.
+func (a *Auth) HandleImpersonationStop(writer http.ResponseWriter, request *http.Request) {
+	user := AssertReqGetUserExtended(request)
+	userDetail := AssertReqGetUserDetail(request)
+	if userDetail.Impersonator == nil || user.SessionId == "" {
+		_ = httputil.WriteObj(writer, ec.NewErrorBasic(ErrCodeNotImpersonating, ErrMessageNotImpersonating), http.StatusBadRequest)
+		return
+	}
+
+	session, err := a.SessionCache.GetSession(user.SessionId)
+	if err != nil {
+		a.Logger.Warnf("cannot retrieve user session: %s", err)
+		_ = httputil.WriteObj(writer, ec.NewError(ErrCodeSessionStorageFail, ErrMessageSessionStorageFail, err), http.StatusInternalServerError)
+		return
+	}
+	if session == nil {
+		a.WriteUnauthorized(writer, ErrCodeSessionExpired, ErrMessageSessionExpired, nil)
+		return
+	}
+	// The impersonation may have been stopped by a concurrent request.
+	stopped := session.Impersonation
+	if stopped == nil {
+		_ = httputil.WriteObj(writer, ec.NewErrorBasic(ErrCodeNotImpersonating, ErrMessageNotImpersonating), http.StatusBadRequest)
+		return
+	}
+
+	session.Impersonation = nil
+	err = a.SessionCache.SaveSession(session)
+	if err != nil {
+		a.Logger.Warnf("cannot save user session: %s", err)
+		_ = httputil.WriteObj(writer, ec.NewError(ErrCodeSessionStorageFail, ErrMessageSessionStorageFail, err), http.StatusInternalServerError)
+		return
+	}
+
+	a.Logger.Infof("impersonation of %s by %s (%s) stopped", stopped.Nip, userDetail.Impersonator.NewNip, userDetail.Impersonator.AsnId)
+	_ = httputil.WriteObj200(writer, stopped)
+}
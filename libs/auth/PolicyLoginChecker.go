@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/logutil"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Rules of LoginPolicy, also the values of the rule label of LoginMetrics Allowed.
+const (
+	LoginRuleOpen   = "open"
+	LoginRuleRole   = "role"
+	LoginRuleAgency = "agency"
+	LoginRuleStaff  = "staff"
+)
+
+// Reasons of rejected logins, the values of the reason label of LoginMetrics Rejected.
+const (
+	LoginRejectedDenied = "denied"
+	LoginRejectedError  = "error"
+)
+
+// staffCacheSweepSize is the number of cached staff lookups above which expired lookups are removed.
+const staffCacheSweepSize = 10000
+
+// errNoStaffCheck is returned when LoginPolicy Staff is set but PolicyLoginChecker IsStaff is nil.
+var errNoStaffCheck = errors.New("login policy requires staff but no staff check is set")
+
+// deniedPage tells the user why they cannot log in, and lets them log in with another account.
+var deniedPage = template.Must(template.New("denied").Parse(`<!DOCTYPE html>
+<html lang="id">
+<head><meta charset="utf-8"><title>Akses Ditolak</title></head>
+<body>
+<h1>Akses Ditolak</h1>
+{{if .Failed}}<p>Akses akun Anda belum dapat diperiksa. Silakan coba beberapa saat lagi.</p>
+{{else}}<p>Akun {{.Username}}{{if .Name}} ({{.Name}}){{end}} tidak memiliki akses ke aplikasi ini. Akses hanya diberikan kepada:</p>
+<ul>
+{{if .Roles}}<li>pengguna dengan salah satu peran {{range $i, $role := .Roles}}{{if $i}}, {{end}}{{$role}}{{end}};</li>
+{{end}}{{if .Agencies}}<li>ASN dari instansi yang terdaftar;</li>
+{{end}}{{if .Staff}}<li>pegawai yang terdaftar di aplikasi ini.</li>
+{{end}}</ul>
+<p>Hubungi admin instansi Anda untuk mendapatkan akses.</p>
+{{end}}{{if .LogoutUrl}}<p><a href="{{.LogoutUrl}}">Masuk dengan akun lain</a></p>
+{{end}}</body>
+</html>
+`))
+
+// LoginPolicy decides who can log in, see PolicyLoginChecker. A user can log in if they satisfy at least one of its
+// rules. An empty policy lets everyone log in.
+type LoginPolicy struct {
+	// Roles are the roles allowing login, either realm roles, e.g. admin_instansi, or resource roles of a client
+	// written as client:role, e.g. manajemen-jf:operator.
+	Roles []string
+	// AgencyIds are the work agencies (instansi kerja) whose ASN can log in.
+	AgencyIds []string
+	// Staff lets the staff of the application log in, see PolicyLoginChecker IsStaff.
+	Staff bool
+}
+
+// empty tells whether the policy has no rule.
+func (p *LoginPolicy) empty() bool {
+	return len(p.Roles) == 0 && len(p.AgencyIds) == 0 && !p.Staff
+}
+
+// LoginMetrics count the logins checked by a PolicyLoginChecker.
+type LoginMetrics struct {
+	// Allowed counts the allowed logins, labeled by the rule that allowed them ("rule"), see LoginRuleOpen and others.
+	Allowed *prometheus.CounterVec
+	// Rejected counts the rejected logins and bearer token requests, labeled by "reason": LoginRejectedDenied if no
+	// rule is satisfied, or LoginRejectedError if the rules cannot be checked.
+	Rejected *prometheus.CounterVec
+}
+
+// PolicyLoginChecker is a LoginChecker that allows login according to a LoginPolicy. Users who cannot log in are
+// shown a page telling them who can, with 403, or 500 if the policy cannot be checked. It is also a
+// BearerLoginChecker, so that users cannot get around the policy by calling the API with their ID token.
+//
+// The policy can be changed with Configure at any time, a PolicyLoginChecker is safe for concurrent use.
+type PolicyLoginChecker struct {
+	// IsStaff tells whether a user is a staff of the application, e.g. whether they are in its staff table. It is
+	// required by LoginPolicy Staff.
+	IsStaff func(ctx context.Context, user *Asn) (staff bool, err error)
+	// LogoutUrl is linked from the denial page so that the user can log in with another account, e.g. the end session
+	// endpoint of the provider. There is no link if it is empty.
+	LogoutUrl string
+	Logger    logutil.Logger
+	// Metrics are updated on each checked login, nil disables them.
+	Metrics *LoginMetrics
+	// StaffCacheTtl is how long IsStaff is cached per token, at most until the token expires, as bearer tokens are
+	// checked on every request.
+	StaffCacheTtl time.Duration
+
+	mu     sync.RWMutex
+	policy *LoginPolicy
+
+	staffMu    sync.Mutex
+	staffCache map[string]*staffCacheEntry
+}
+
+type staffCacheEntry struct {
+	staff     bool
+	expiresAt time.Time
+}
+
+// NewPolicyLoginChecker creates a PolicyLoginChecker with a policy.
+func NewPolicyLoginChecker(policy *LoginPolicy) *PolicyLoginChecker {
+	return &PolicyLoginChecker{
+		Logger:        logutil.NewStdLogger(true, "login"),
+		StaffCacheTtl: time.Minute,
+		policy:        policy,
+		staffCache:    make(map[string]*staffCacheEntry),
+	}
+}
+
+// Configure replaces the policy, it applies to the logins checked from then on.
+func (c *PolicyLoginChecker) Configure(policy *LoginPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.policy = policy
+}
+
+func (c *PolicyLoginChecker) currentPolicy() *LoginPolicy {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.policy == nil {
+		return &LoginPolicy{}
+	}
+	return c.policy
+}
+
+func (c *PolicyLoginChecker) CheckLogin(writer http.ResponseWriter, _ *oidc.IDToken, user *Asn) (err error) {
+	policy := c.currentPolicy()
+	rule, e := c.decide(policy, user, "login")
+	if e != nil {
+		status := http.StatusForbidden
+		if e.Code != ErrCodeLoginDenied {
+			status = http.StatusInternalServerError
+		}
+		c.writeDeniedPage(writer, status, policy, user)
+		return e
+	}
+
+	if c.Metrics != nil && c.Metrics.Allowed != nil {
+		c.Metrics.Allowed.WithLabelValues(rule).Inc()
+	}
+	return nil
+}
+
+func (c *PolicyLoginChecker) CheckBearer(user *Asn) (err error) {
+	if _, e := c.decide(c.currentPolicy(), user, "bearer token request"); e != nil {
+		return e
+	}
+	return nil
+}
+
+// decide applies policy to user, logging and counting rejections. The error has ErrCodeLoginDenied if user is not
+// allowed, or ErrCodeLoginCheckFail if policy cannot be checked. what is what is checked, for the logs.
+func (c *PolicyLoginChecker) decide(policy *LoginPolicy, user *Asn, what string) (rule string, err *ec.Error) {
+	rule, checkErr := c.check(policy, user)
+	if checkErr != nil {
+		c.Logger.Warnf("cannot check login policy of %s for %s: %s", user.Username, what, checkErr)
+		c.countRejected(LoginRejectedError)
+		return "", ec.NewError(ErrCodeLoginCheckFail, ErrMessageLoginCheckFail, checkErr)
+	}
+	if rule == "" {
+		c.Logger.Infof("%s of %s (%s) of agency %s denied by login policy", what, user.Username, user.AsnId, user.WorkAgencyId)
+		c.countRejected(LoginRejectedDenied)
+		return "", ec.NewErrorBasic(ErrCodeLoginDenied, ErrMessageLoginDenied)
+	}
+	return rule, nil
+}
+
+// check returns the rule of policy allowing user to log in, or an empty string if there is none. The rules are checked
+// from the cheapest, the staff rule is only checked if the others are not satisfied.
+func (c *PolicyLoginChecker) check(policy *LoginPolicy, user *Asn) (rule string, err error) {
+	if policy.empty() {
+		return LoginRuleOpen, nil
+	}
+
+	if user.AccessToken != nil && len(policy.Roles) > 0 {
+		for _, role := range user.AccessToken.GetRoles() {
+			name := role.Role
+			if role.RoleType != "realm" {
+				name = role.RoleType + ":" + role.Role
+			}
+			if contains(policy.Roles, name) {
+				return LoginRuleRole, nil
+			}
+		}
+	}
+
+	if user.WorkAgencyId != "" && contains(policy.AgencyIds, user.WorkAgencyId) {
+		return LoginRuleAgency, nil
+	}
+
+	if policy.Staff {
+		staff, err := c.isStaff(user)
+		if err != nil {
+			return "", err
+		}
+		if staff {
+			return LoginRuleStaff, nil
+		}
+	}
+
+	return "", nil
+}
+
+// isStaff calls IsStaff, cached per token for StaffCacheTtl.
+func (c *PolicyLoginChecker) isStaff(user *Asn) (staff bool, err error) {
+	if c.IsStaff == nil {
+		return false, errNoStaffCheck
+	}
+
+	key := ""
+	if user.AccessToken != nil && user.AccessToken.Jti != "" {
+		key = user.AsnId + ":" + user.AccessToken.Jti
+	}
+	now := time.Now()
+	if key != "" {
+		c.staffMu.Lock()
+		entry, ok := c.staffCache[key]
+		c.staffMu.Unlock()
+		if ok && now.Before(entry.expiresAt) {
+			return entry.staff, nil
+		}
+	}
+
+	staff, err = c.IsStaff(context.Background(), user)
+	if err != nil || key == "" {
+		return staff, err
+	}
+
+	expiresAt := now.Add(c.StaffCacheTtl)
+	if user.AccessToken.Exp != 0 {
+		if tokenExpiresAt := time.Unix(user.AccessToken.Exp, 0); tokenExpiresAt.Before(expiresAt) {
+			expiresAt = tokenExpiresAt
+		}
+	}
+	c.staffMu.Lock()
+	defer c.staffMu.Unlock()
+	if c.staffCache == nil {
+		c.staffCache = make(map[string]*staffCacheEntry)
+	}
+	if len(c.staffCache) >= staffCacheSweepSize {
+		for k, entry := range c.staffCache {
+			if now.After(entry.expiresAt) {
+				delete(c.staffCache, k)
+			}
+		}
+	}
+	c.staffCache[key] = &staffCacheEntry{staff: staff, expiresAt: expiresAt}
+	return staff, nil
+}
+
+func (c *PolicyLoginChecker) countRejected(reason string) {
+	if c.Metrics != nil && c.Metrics.Rejected != nil {
+		c.Metrics.Rejected.WithLabelValues(reason).Inc()
+	}
+}
+
+func (c *PolicyLoginChecker) writeDeniedPage(writer http.ResponseWriter, status int, policy *LoginPolicy, user *Asn) {
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.Header().Set("Cache-Control", "no-store")
+	writer.WriteHeader(status)
+	_ = deniedPage.Execute(writer, map[string]interface{}{
+		"Failed":    status != http.StatusForbidden,
+		"Username":  user.Username,
+		"Name":      user.Name,
+		"Roles":     policy.Roles,
+		"Agencies":  len(policy.AgencyIds) > 0,
+		"Staff":     policy.Staff,
+		"LogoutUrl": c.LogoutUrl,
+	})
+}
+
+// contains checks whether values contains value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/httputil"
+)
+
+// ServiceAccount is an OAuth2 client of the provider, e.g. a batch job or another BKN service, that calls the API
+// with access tokens obtained with the client credentials grant. Its roles are those of its service account in the
+// provider, and it is only allowed to access the entries of AgencyIds, regardless of its roles.
+type ServiceAccount struct {
+	// ClientId is the client ID of the service account, the azp claim of its access tokens.
+	ClientId string
+	// AgencyIds are the work agencies (instansi kerja) the service account acts for. The first one is the agency of
+	// the entries it creates.
+	AgencyIds []string
+}
+
+// ParseServiceAccounts parses service accounts, each written as the client ID and its agency IDs separated by commas,
+// e.g. siasn-sync=A5EB03E23BFBF6A0E040640A040252AD,A5EB03E23C0AF6A0E040640A040252AD.
+func ParseServiceAccounts(values []string) (accounts map[string]*ServiceAccount, err error) {
+	accounts = make(map[string]*ServiceAccount)
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		clientId, agencies, ok := strings.Cut(value, "=")
+		clientId = strings.TrimSpace(clientId)
+		if !ok || clientId == "" {
+			return nil, fmt.Errorf("invalid service account %s, must be client-id=agency-id,...", value)
+		}
+		if _, ok = accounts[clientId]; ok {
+			return nil, fmt.Errorf("duplicate service account %s", clientId)
+		}
+
+		account := &ServiceAccount{ClientId: clientId, AgencyIds: []string{}}
+		for _, agencyId := range strings.Split(agencies, ",") {
+			if agencyId = strings.TrimSpace(agencyId); agencyId != "" {
+				account.AgencyIds = append(account.AgencyIds, agencyId)
+			}
+		}
+		if len(account.AgencyIds) == 0 {
+			return nil, fmt.Errorf("service account %s must have at least one agency", clientId)
+		}
+		accounts[clientId] = account
+	}
+
+	return accounts, nil
+}
+
+// asn creates the synthetic ASN of the service account, authenticated as user. It is not in the ASN profile DB, its
+// AsnId is the subject of its service account in the provider.
+func (s *ServiceAccount) asn(user *User) *Asn {
+	asnId := user.Subject
+	if asnId == "" {
+		asnId = "service-account-" + s.ClientId
+	}
+
+	return &Asn{
+		AsnId:          asnId,
+		Name:           s.ClientId,
+		Username:       user.PreferredUsername,
+		WorkAgencyId:   s.AgencyIds[0],
+		ScopeAgencyIds: s.AgencyIds,
+		AccessToken:    user.AccessToken,
+	}
+}
+
+// bearerToken returns the token of the Authorization header of request, or an empty string if there is no bearer
+// token.
+func bearerToken(request *http.Request) string {
+	scheme, token, ok := strings.Cut(request.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authenticateBearer authenticates a request with a bearer token, either an ID token issued to this client, or an
+// access token of one of ServiceAccounts. The roles of ID tokens are those of their claims, as there is no access
+// token. If the token is not accepted, 401 is written and the error is returned.
+func (a *Auth) authenticateBearer(writer http.ResponseWriter, rawToken string) (user *User, err error) {
+	idToken, user, err := a.VerifyRawIdToken(rawToken)
+	if err == nil {
+		user.AccessToken = &AccessToken{}
+		err = idToken.Claims(user.AccessToken)
+		if err != nil {
+			return nil, writeBearerUnauthorized(writer, ErrCodeInvalidBearerToken, ErrMessageInvalidBearerToken, err)
+		}
+		user.Bearer = true
+		return user, nil
+	}
+
+	// Access tokens are issued to the service accounts, not to this client, so their audience is not checked.
+	token, err := a.accessTokenVerifier.Verify(context.Background(), rawToken)
+	if err != nil {
+		a.Logger.Warnf("cannot verify bearer token: %s", err)
+		return nil, writeBearerUnauthorized(writer, ErrCodeInvalidBearerToken, ErrMessageInvalidBearerToken, err)
+	}
+
+	accessToken := &AccessToken{}
+	err = token.Claims(accessToken)
+	if err != nil || accessToken.Typ != "Bearer" {
+		return nil, writeBearerUnauthorized(writer, ErrCodeInvalidBearerToken, ErrMessageInvalidBearerToken, err)
+	}
+
+	account, ok := a.ServiceAccounts[accessToken.Azp]
+	if !ok {
+		a.Logger.Warnf("access token of unknown client %s", accessToken.Azp)
+		return nil, writeBearerUnauthorized(writer, ErrCodeUnknownServiceAccount, ErrMessageUnknownServiceAccount, nil)
+	}
+
+	return &User{
+		PreferredUsername: accessToken.PreferredUsername,
+		Expired:           accessToken.Exp,
+		Subject:           token.Subject,
+		AccessToken:       accessToken,
+		ServiceAccount:    account,
+		Bearer:            true,
+	}, nil
+}
+
+// checkBearerLogin applies LoginChecker to a user calling the API with their ID token, if it is a BearerLoginChecker.
+// If the user is not allowed, 403 is written, or 500 if it cannot be checked, and the error is returned.
+func (a *Auth) checkBearerLogin(writer http.ResponseWriter, userDetail *Asn) (err error) {
+	checker, ok := a.LoginChecker.(BearerLoginChecker)
+	if !ok {
+		return nil
+	}
+
+	err = checker.CheckBearer(userDetail)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if e := (*ec.Error)(nil); errors.As(err, &e) && e.Code == ErrCodeLoginDenied {
+			status = http.StatusForbidden
+		}
+		_ = httputil.WriteObj(writer, err, status)
+	}
+	return err
+}
+
+// writeBearerUnauthorized writes 401 to a request authenticated with a bearer token and returns the error written.
+// Unlike WriteUnauthorized, the session cookie is left alone.
+func writeBearerUnauthorized(writer http.ResponseWriter, code int, errMessage string, err error) error {
+	err = ec.NewError(code, errMessage, err)
+	writer.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	_ = httputil.WriteObj(writer, err, http.StatusUnauthorized)
+	return err
+}
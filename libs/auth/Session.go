@@ -0,0 +1,475 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/httputil"
+	"github.com/google/uuid"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// refreshLeeway is how long before its expiry an access token is refreshed, so that it does not expire while the
+	// request is handled.
+	refreshLeeway = 30 * time.Second
+	// backChannelLogoutEvent is the event of the logout tokens sent by the provider on back-channel logout.
+	backChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+)
+
+// errSessionExpired is returned by refreshSession when the session cannot be refreshed anymore.
+var errSessionExpired = errors.New("session has expired")
+
+// ErrNoRedisClient is returned by RedisAccessTokenCache when it is used as a SessionCache without its Redis client.
+var ErrNoRedisClient = errors.New("redis client is required to store sessions")
+
+// Session is a login session of a user, created by OidcHandler and stored server-side in a SessionCache.
+// Its access token is refreshed with its refresh token when it expires.
+type Session struct {
+	// Id is the session ID (sid claim) issued by the provider in the ID token, so that back-channel logout can find
+	// the session. It is a random UUID if the provider does not issue one.
+	Id string
+	// Subject is the subject (sub claim) of the user.
+	Subject string
+	// Username is the NIP of the user.
+	Username string
+	// RawIdToken is the latest ID token of the session, which is also the value of the session cookie.
+	RawIdToken   string
+	AccessToken  *AccessToken
+	RefreshToken string
+	// Expiry is the expiry of the access token, it is refreshed past this time.
+	Expiry time.Time
+	// RefreshExpiry is the expiry of the refresh token, the session expires past this time.
+	RefreshExpiry time.Time
+	CreatedAt     time.Time
+	RefreshedAt   time.Time
+	UserAgent     string
+	IpAddress     string
+	// Impersonation is the user the user of the session is impersonating, if any.
+	Impersonation *Impersonation
+}
+
+// needsRefresh tells whether the access token of the session must be refreshed at now.
+func (s *Session) needsRefresh(now time.Time) bool {
+	return !s.Expiry.IsZero() && !now.Add(refreshLeeway).Before(s.Expiry)
+}
+
+// expired tells whether the session has expired at now.
+func (s *Session) expired(now time.Time) bool {
+	return !s.RefreshExpiry.IsZero() && !now.Before(s.RefreshExpiry)
+}
+
+// SessionInfo describes a session to its user, without its tokens.
+type SessionInfo struct {
+	Id          string    `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	RefreshedAt time.Time `json:"refreshed_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	UserAgent   string    `json:"user_agent"`
+	IpAddress   string    `json:"ip_address"`
+	// Current is true for the session of the request.
+	Current bool `json:"current"`
+}
+
+// SessionCache stores the sessions created by Auth, so that their access tokens can be refreshed and they can be
+// listed and revoked. MemoryAccessTokenCache and RedisAccessTokenCache implement it.
+type SessionCache interface {
+	// SaveSession creates or replaces a session and links its RawIdToken to it. The ID tokens linked before, which may
+	// still be used by concurrent requests, stay linked. The session expires at RefreshExpiry.
+	SaveSession(session *Session) (err error)
+
+	// GetSession retrieves a session, it returns nil if the session does not exist or has expired.
+	GetSession(id string) (session *Session, err error)
+
+	// GetSessionByIdToken retrieves the session an ID token is linked to, it returns nil if there is none.
+	GetSessionByIdToken(idToken string) (session *Session, err error)
+
+	// ListSessions lists the sessions of a subject that have not expired.
+	ListSessions(subject string) (sessions []*Session, err error)
+
+	// DeleteSession deletes a session, the ID tokens linked to it cannot be used anymore.
+	// It does not return an error if the session does not exist.
+	DeleteSession(id string) (err error)
+}
+
+// hashIdToken returns the key under which an ID token is linked to its session, so that ID tokens are not stored as
+// keys.
+func hashIdToken(idToken string) string {
+	sum := sha256.Sum256([]byte(idToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// sessionId returns the ID of a new session, see Session.Id.
+func sessionId(idToken *oidc.IDToken, accessToken *AccessToken) string {
+	claims := struct {
+		Sid          string `json:"sid"`
+		SessionState string `json:"session_state"`
+	}{}
+	_ = idToken.Claims(&claims)
+
+	switch {
+	case claims.Sid != "":
+		return claims.Sid
+	case claims.SessionState != "":
+		return claims.SessionState
+	case accessToken.SessionState != "":
+		return accessToken.SessionState
+	}
+	return uuid.NewString()
+}
+
+// updateSession sets the tokens of session from a token response of the provider. The ID token of the response, if
+// any, must already be verified.
+func (a *Auth) updateSession(session *Session, token *oauth2.Token) (err error) {
+	accessToken, err := parseAccessToken(token.AccessToken)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	session.AccessToken = accessToken
+	session.Expiry = token.Expiry
+	if accessToken.Exp != 0 {
+		session.Expiry = time.Unix(accessToken.Exp, 0)
+	}
+	// Providers do not have to issue a new refresh token on refresh.
+	if token.RefreshToken != "" {
+		session.RefreshToken = token.RefreshToken
+	}
+	if rawIdToken, ok := token.Extra("id_token").(string); ok && rawIdToken != "" {
+		session.RawIdToken = rawIdToken
+	}
+
+	// Keycloak tells when the refresh token expires, refresh tokens of other providers last SessionMaxAge.
+	session.RefreshExpiry = now.Add(a.SessionMaxAge)
+	if refreshExpiresIn, ok := token.Extra("refresh_expires_in").(float64); ok && refreshExpiresIn > 0 {
+		session.RefreshExpiry = now.Add(time.Duration(refreshExpiresIn) * time.Second)
+	}
+	return nil
+}
+
+// refreshSession refreshes the access token of session with its refresh token. Concurrent requests of the same session
+// share a single refresh, because providers may only accept a refresh token once. errSessionExpired is returned if
+// the provider does not accept the refresh token anymore, the session is then deleted.
+func (a *Auth) refreshSession(session *Session) (refreshed *Session, err error) {
+	result, err, _ := a.refreshGroup.Do(session.Id, func() (interface{}, error) {
+		// Another request may have refreshed the session in the meantime.
+		current, err := a.SessionCache.GetSession(session.Id)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil {
+			return nil, errSessionExpired
+		}
+		if !current.needsRefresh(time.Now()) {
+			return current, nil
+		}
+		if current.RefreshToken == "" {
+			return nil, errSessionExpired
+		}
+
+		// The refresh is not bound to the request that triggered it, as other requests wait for it.
+		token, err := a.config.TokenSource(context.Background(), &oauth2.Token{RefreshToken: current.RefreshToken}).Token()
+		if err != nil {
+			var retrieveErr *oauth2.RetrieveError
+			if errors.As(err, &retrieveErr) && retrieveErr.Response != nil && retrieveErr.Response.StatusCode < 500 {
+				// The refresh token has expired, or the session has ended at the provider.
+				_ = a.SessionCache.DeleteSession(current.Id)
+				return nil, errSessionExpired
+			}
+			return nil, err
+		}
+
+		if rawIdToken, ok := token.Extra("id_token").(string); ok && rawIdToken != "" {
+			_, err = a.verifier.Verify(context.Background(), rawIdToken)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err = a.updateSession(current, token)
+		if err != nil {
+			return nil, err
+		}
+		current.RefreshedAt = time.Now()
+		err = a.SessionCache.SaveSession(current)
+		if err != nil {
+			return nil, err
+		}
+		return current, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*Session), nil
+}
+
+// authenticateSession authenticates a request with its session, refreshing the access token of the session when it
+// has expired or is about to. The session cookie is updated with the latest ID token of the session. If the request
+// cannot be authenticated, the error response is written and the error is returned.
+func (a *Auth) authenticateSession(writer http.ResponseWriter, request *http.Request) (user *User, err error) {
+	rawIdToken := a.CookieSetter.GetSessionCookie(request)
+	if rawIdToken == "" {
+		a.WriteUnauthorized(writer, ErrCodeNoIdToken, ErrMessageNoIdToken, nil)
+		return nil, ec.NewErrorBasic(ErrCodeNoIdToken, ErrMessageNoIdToken)
+	}
+
+	// The ID token may have expired, whether the user is still logged in is decided by the session.
+	idToken, err := a.sessionVerifier.Verify(context.Background(), rawIdToken)
+	if err != nil {
+		a.Logger.Warnf("cannot verify ID token: %s", err)
+		a.WriteUnauthorized(writer, ErrCodeNoIdToken, ErrMessageNoIdToken, err)
+		return nil, ec.NewError(ErrCodeNoIdToken, ErrMessageNoIdToken, err)
+	}
+
+	session, err := a.SessionCache.GetSessionByIdToken(rawIdToken)
+	if err != nil {
+		a.Logger.Warnf("cannot retrieve user session: %s", err)
+		err = ec.NewError(ErrCodeCannotVerifyIdToken, ErrMessageCannotVerifyIdToken, err)
+		_ = httputil.WriteObj(writer, err, http.StatusInternalServerError)
+		return nil, err
+	}
+	if session == nil || session.Subject != idToken.Subject {
+		a.WriteUnauthorized(writer, ErrCodeNoUserInSessionStorage, ErrMessageNoUserInSessionStorage, nil)
+		return nil, ec.NewErrorBasic(ErrCodeNoUserInSessionStorage, ErrMessageNoUserInSessionStorage)
+	}
+
+	if session.needsRefresh(time.Now()) {
+		session, err = a.refreshSession(session)
+		if err == errSessionExpired {
+			a.WriteUnauthorized(writer, ErrCodeSessionExpired, ErrMessageSessionExpired, nil)
+			return nil, ec.NewErrorBasic(ErrCodeSessionExpired, ErrMessageSessionExpired)
+		}
+		if err != nil {
+			a.Logger.Warnf("cannot refresh access token: %s", strings.ReplaceAll(err.Error(), "\n", " "))
+			err = ec.NewErrorBasic(ErrCodeRefreshFailed, ErrMessageRefreshFailed)
+			_ = httputil.WriteObj(writer, err, http.StatusBadGateway)
+			return nil, err
+		}
+	}
+
+	if session.RawIdToken != rawIdToken {
+		a.CookieSetter.SetSessionCookie(writer, session.RawIdToken, time.Until(session.RefreshExpiry))
+		idToken, err = a.sessionVerifier.Verify(context.Background(), session.RawIdToken)
+		if err != nil {
+			a.Logger.Warnf("cannot verify refreshed ID token: %s", err)
+			a.WriteUnauthorized(writer, ErrCodeNoIdToken, ErrMessageNoIdToken, err)
+			return nil, ec.NewError(ErrCodeNoIdToken, ErrMessageNoIdToken, err)
+		}
+	}
+
+	user = &User{}
+	err = idToken.Claims(user)
+	if err != nil {
+		a.WriteUnauthorized(writer, ErrCodeNoIdToken, ErrMessageNoIdToken, err)
+		return nil, ec.NewError(ErrCodeNoIdToken, ErrMessageNoIdToken, err)
+	}
+	user.AccessToken = session.AccessToken
+	user.SessionId = session.Id
+	user.Impersonation = a.activeImpersonation(session)
+	return user, nil
+}
+
+// clientIpAddress returns the IP address of the client of request with ClientIpAddress, or the address of the
+// connection if it is nil.
+func (a *Auth) clientIpAddress(request *http.Request) string {
+	if a.ClientIpAddress != nil {
+		return a.ClientIpAddress(request)
+	}
+	if host, _, err := net.SplitHostPort(request.RemoteAddr); err == nil {
+		return host
+	}
+	return request.RemoteAddr
+}
+
+// revokeRefreshToken asks the provider to revoke a refresh token, which ends the session at the provider. It is
+// skipped if the provider does not advertise a revocation endpoint.
+func (a *Auth) revokeRefreshToken(ctx context.Context, refreshToken string) error {
+	if a.revocationEndpoint == "" || refreshToken == "" {
+		return nil
+	}
+
+	form := url.Values{}
+	form.Set("token", refreshToken)
+	form.Set("token_type_hint", "refresh_token")
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, a.revocationEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth(url.QueryEscape(a.config.ClientID), url.QueryEscape(a.config.ClientSecret))
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return errors.New("revocation endpoint responded with " + response.Status)
+	}
+	return nil
+}
+
+// HandleSessionList lists the active sessions of the user. Cannot be used if SessionCache is nil, it must be behind
+// UserExtendedAuthHandler.
+func (a *Auth) HandleSessionList(writer http.ResponseWriter, request *http.Request) {
+	user := AssertReqGetUserExtended(request)
+
+	sessions, err := a.SessionCache.ListSessions(user.Subject)
+	if err != nil {
+		a.Logger.Warnf("cannot list user sessions: %s", err)
+		_ = httputil.WriteObj(writer, ec.NewError(ErrCodeSessionStorageFail, ErrMessageSessionStorageFail, err), http.StatusInternalServerError)
+		return
+	}
+
+	infos := make([]*SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		infos = append(infos, &SessionInfo{
+			Id:          session.Id,
+			CreatedAt:   session.CreatedAt,
+			RefreshedAt: session.RefreshedAt,
+			ExpiresAt:   session.RefreshExpiry,
+			UserAgent:   session.UserAgent,
+			IpAddress:   session.IpAddress,
+			Current:     session.Id == user.SessionId,
+		})
+	}
+
+	_ = httputil.WriteObj200(writer, infos)
+}
+
+// HandleSessionRevoke revokes a session of the user, given its ID in a JSON body {"id": "..."}. The session is also
+// ended at the provider if it supports token revocation. Revoking the current session logs the user out. Cannot be
+// used if SessionCache is nil, it must be behind UserExtendedAuthHandler.
+func (a *Auth) HandleSessionRevoke(writer http.ResponseWriter, request *http.Request) {
+	user := AssertReqGetUserExtended(request)
+
+	body := &struct {
+		Id string `json:"id"`
+	}{}
+	err := json.NewDecoder(request.Body).Decode(body)
+	if err != nil || body.Id == "" {
+		_ = httputil.WriteObj(writer, ec.NewErrorBasic(ErrCodeNoSessionId, ErrMessageNoSessionId), http.StatusBadRequest)
+		return
+	}
+
+	session, err := a.SessionCache.GetSession(body.Id)
+	if err != nil {
+		a.Logger.Warnf("cannot retrieve user session: %s", err)
+		_ = httputil.WriteObj(writer, ec.NewError(ErrCodeSessionStorageFail, ErrMessageSessionStorageFail, err), http.StatusInternalServerError)
+		return
+	}
+	// Sessions of other users are reported as not found, so that their IDs cannot be probed.
+	if session == nil || session.Subject != user.Subject {
+		_ = httputil.WriteObj(writer, ec.NewErrorBasic(ErrCodeSessionNotFound, ErrMessageSessionNotFound), http.StatusNotFound)
+		return
+	}
+
+	err = a.SessionCache.DeleteSession(session.Id)
+	if err != nil {
+		a.Logger.Warnf("cannot delete user session: %s", err)
+		_ = httputil.WriteObj(writer, ec.NewError(ErrCodeSessionStorageFail, ErrMessageSessionStorageFail, err), http.StatusInternalServerError)
+		return
+	}
+
+	err = a.revokeRefreshToken(request.Context(), session.RefreshToken)
+	if err != nil {
+		a.Logger.Warnf("cannot revoke refresh token of session %s at the provider: %s", session.Id, err)
+	}
+
+	if session.Id == user.SessionId {
+		a.CookieSetter.DeleteSessionCookie(writer)
+	}
+
+	_ = httputil.WriteObj200(writer, map[string]string{
+		"id": session.Id,
+	})
+}
+
+// BackChannelLogoutHandler handles the OpenID Connect back-channel logout requests of the provider, which are sent when
+// a session ends at the provider, e.g. when the user logs out of another application or an administrator ends the
+// session. The session of the logout token is deleted, or every session of its subject if it does not have a session
+// ID. The URL of this handler must be registered as the back-channel logout URL of the client in the provider.
+//
+// Cannot be used if SessionCache is nil.
+func (a *Auth) BackChannelLogoutHandler(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Cache-Control", "no-store")
+	if request.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	logoutToken, err := a.sessionVerifier.Verify(context.Background(), request.FormValue("logout_token"))
+	if err != nil {
+		a.Logger.Warnf("cannot verify logout token: %s", err)
+		writeLogoutError(writer, "invalid logout token")
+		return
+	}
+
+	claims := struct {
+		Sid    string                 `json:"sid"`
+		Nonce  *string                `json:"nonce"`
+		Events map[string]interface{} `json:"events"`
+	}{}
+	err = logoutToken.Claims(&claims)
+	if err != nil {
+		a.Logger.Warnf("cannot parse logout token: %s", err)
+		writeLogoutError(writer, "invalid logout token")
+		return
+	}
+	if _, ok := claims.Events[backChannelLogoutEvent]; !ok || claims.Nonce != nil {
+		writeLogoutError(writer, "not a logout token")
+		return
+	}
+	if !logoutToken.Expiry.IsZero() && logoutToken.Expiry.Before(time.Now()) {
+		writeLogoutError(writer, "logout token has expired")
+		return
+	}
+	if claims.Sid == "" && logoutToken.Subject == "" {
+		writeLogoutError(writer, "logout token has neither sid nor sub")
+		return
+	}
+
+	var sessions []*Session
+	if claims.Sid != "" {
+		var session *Session
+		session, err = a.SessionCache.GetSession(claims.Sid)
+		if session != nil && (logoutToken.Subject == "" || session.Subject == logoutToken.Subject) {
+			sessions = append(sessions, session)
+		}
+	} else {
+		sessions, err = a.SessionCache.ListSessions(logoutToken.Subject)
+	}
+	for _, session := range sessions {
+		if err != nil {
+			break
+		}
+		err = a.SessionCache.DeleteSession(session.Id)
+	}
+	if err != nil {
+		a.Logger.Warnf("cannot delete sessions on back-channel logout: %s", err)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	a.Logger.Infof("back-channel logout of %d session(s) of %s", len(sessions), logoutToken.Subject)
+	writer.WriteHeader(http.StatusOK)
+}
+
+// writeLogoutError writes the error response of a back-channel logout request.
+func writeLogoutError(writer http.ResponseWriter, description string) {
+	_ = httputil.WriteObj(writer, map[string]string{
+		"error":             "invalid_request",
+		"error_description": description,
+	}, http.StatusBadRequest)
+}
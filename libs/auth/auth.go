@@ -16,6 +16,7 @@ import (
 	"github.com/fazrithe/siasn-jf-backend-git/libs/metricutil"
 	"github.com/google/uuid"
 	"golang.org/x/oauth2"
+	"golang.org/x/sync/singleflight"
 	"gopkg.in/square/go-jose.v2/jwt"
 	"net/http"
 	"net/url"
@@ -45,6 +46,26 @@ var (
 	ErrMessageLoginRequired          = "prompt is set to none but login is required, redirect the user to the login page to login"
 	ErrCodeGenericOAuth2             = 99408
 	ErrMessageGenericOAuth2          = "generic error"
+	ErrCodeSessionExpired            = 99409
+	ErrMessageSessionExpired         = "session has expired, login again"
+	ErrCodeSessionNotFound           = 99410
+	ErrMessageSessionNotFound        = "session cannot be found"
+	ErrCodeNoSessionId               = 99411
+	ErrMessageNoSessionId            = "no session ID"
+	ErrCodeInvalidBearerToken        = 99412
+	ErrMessageInvalidBearerToken     = "bearer token is invalid or has expired"
+	ErrCodeUnknownServiceAccount     = 99413
+	ErrMessageUnknownServiceAccount  = "client of the bearer token is not a known service account"
+	ErrCodeInvalidImpersonation      = 99414
+	ErrMessageInvalidImpersonation   = "invalid impersonation, nip and alasan are required, the user must have a role that can be impersonated and durasi_menit cannot exceed the maximum"
+	ErrCodeImpersonatedNotFound      = 99415
+	ErrMessageImpersonatedNotFound   = "impersonated user cannot be found or has no work agency"
+	ErrCodeCannotImpersonate         = 99416
+	ErrMessageCannotImpersonate      = "impersonation requires a login session and cannot be nested"
+	ErrCodeNotImpersonating          = 99417
+	ErrMessageNotImpersonating       = "no user is being impersonated"
+	ErrCodeLoginDenied               = 99418
+	ErrMessageLoginDenied            = "login is denied by the login policy"
 	ErrCodeOAuth2ExchangeFailed      = 99501
 	ErrMessageOAuth2ExchangeFailed   = "code exchange failed"
 	ErrCodeCannotVerifyIdToken       = 99502
@@ -55,6 +76,12 @@ var (
 	ErrMessageNonceGenerateFail      = "unable to generate nonce"
 	ErrCodeStateGenerateFail         = 99505
 	ErrMessageStateGenerateFail      = "unable to generate state"
+	ErrCodeRefreshFailed             = 99506
+	ErrMessageRefreshFailed          = "cannot refresh access token"
+	ErrCodeSessionStorageFail        = 99507
+	ErrMessageSessionStorageFail     = "cannot access session storage"
+	ErrCodeLoginCheckFail            = 99508
+	ErrMessageLoginCheckFail         = "cannot check login policy"
 )
 
 type LoginChecker interface {
@@ -64,7 +91,20 @@ type LoginChecker interface {
 	CheckLogin(writer http.ResponseWriter, idToken *oidc.IDToken, user *Asn) (err error)
 }
 
-// NoopLoginChecker allows all kinds of login.
+// BearerLoginChecker is a LoginChecker that also applies to users calling the API with their ID token as a bearer
+// token, who never log in. See UserDetailAuthHandler.
+type BearerLoginChecker interface {
+	// CheckBearer checks whether the user can call the API with their ID token, on each request. The error response is
+	// not written, err is an ec.Error with ErrCodeLoginDenied if the user is not allowed.
+	CheckBearer(user *Asn) (err error)
+}
+
+// UserDetailGetter retrieves the detail of a user given the NIP, see Auth GetUserDetail.
+type UserDetailGetter interface {
+	GetUserDetail(ctx context.Context, nip string, workAgencyId string) (user *Asn, err error)
+}
+
+// NoopLoginChecker allows all kinds of login. See PolicyLoginChecker to restrict who can log in.
 type NoopLoginChecker struct{}
 
 func (n *NoopLoginChecker) CheckLogin(writer http.ResponseWriter, idToken *oidc.IDToken, user *Asn) (err error) {
@@ -88,6 +128,34 @@ type Auth struct {
 	StateCache         StateCache
 	LoginChecker       LoginChecker
 	CookieSetter       CookieSetter
+	// SessionCache stores sessions with their refresh tokens, see Session. When it is set, access tokens are refreshed
+	// transparently, sessions can be listed and revoked, and AccessTokenCache is not used.
+	SessionCache SessionCache
+	// SessionMaxAge is the lifetime of sessions whose refresh token expiry is not told by the provider.
+	SessionMaxAge time.Duration
+	// ClientIpAddress returns the IP address of the client of a request, recorded in sessions. The address of the
+	// connection is used if it is nil.
+	ClientIpAddress func(request *http.Request) string
+	// UserDetailGetter retrieves user detail instead of ProfileDb and ReferenceDb if it is set, e.g. with a fake
+	// provider whose users are not in the ASN profile DB.
+	UserDetailGetter UserDetailGetter
+	// ServiceAccounts are the clients whose access tokens are accepted as bearer tokens, keyed by client ID. See
+	// ParseServiceAccounts.
+	ServiceAccounts map[string]*ServiceAccount
+	// ImpersonationMaxDuration is the longest an impersonation can last, see Impersonation.
+	ImpersonationMaxDuration time.Duration
+	// ImpersonationRoles are the roles of the users that can be impersonated. Nil allows none.
+	ImpersonationRoles []string
+	// UserRoles retrieves the roles a user has in the application, e.g. from its staff table. An impersonated user is
+	// given those among ImpersonationRoles. No user can be impersonated if it is nil.
+	UserRoles func(ctx context.Context, user *Asn) (roles []string, err error)
+
+	// sessionVerifier verifies ID tokens of sessions, which may have expired, and logout tokens.
+	sessionVerifier *oidc.IDTokenVerifier
+	// accessTokenVerifier verifies access tokens issued to service accounts.
+	accessTokenVerifier *oidc.IDTokenVerifier
+	revocationEndpoint  string
+	refreshGroup        singleflight.Group
 }
 
 type User struct {
@@ -99,6 +167,15 @@ type User struct {
 	Subject           string `json:"sub"`
 	// AccessToken is retrieved usually from cache, and can be nil.
 	AccessToken *AccessToken `json:"-"`
+	// SessionId is the ID of the session of the user, empty if Auth.SessionCache is nil or the user is authenticated
+	// with a bearer token.
+	SessionId string `json:"-"`
+	// ServiceAccount is set if the user is a service account authenticated with its access token.
+	ServiceAccount *ServiceAccount `json:"-"`
+	// Bearer is set if the user is authenticated with a bearer token instead of logging in.
+	Bearer bool `json:"-"`
+	// Impersonation is set if the user is impersonating another user in their session, see Impersonation.
+	Impersonation *Impersonation `json:"-"`
 }
 
 // Asn (ASN or PNS) represents a single ASN profile.
@@ -129,6 +206,12 @@ type Asn struct {
 	// AccessToken is retrieved usually from cache, and cannot be nil as to retrieve user detail, access token is
 	// required. See also UserDetailAuthHandler.
 	AccessToken *AccessToken `json:"-"`
+	// ScopeAgencyIds are the agencies a service account is limited to, see ServiceAccount. It is nil for ASN.
+	ScopeAgencyIds []string `json:"-"`
+	// Impersonator is the real user while this user is impersonated, nil otherwise. See Impersonation.
+	Impersonator *Asn `json:"impersonator,omitempty"`
+	// Impersonation is the impersonation of this user by Impersonator, nil otherwise.
+	Impersonation *Impersonation `json:"impersonation,omitempty"`
 }
 
 func NewAuth(
@@ -154,17 +237,28 @@ func NewAuth(
 		Scopes:       []string{"openid"},
 	}
 
+	// The revocation endpoint is optional, sessions are only revoked locally without it.
+	providerClaims := struct {
+		RevocationEndpoint string `json:"revocation_endpoint"`
+	}{}
+	_ = provider.Claims(&providerClaims)
+
 	return &Auth{
-		Logger:             logutil.NewStdLogger(true, "auth"),
-		provider:           provider,
-		config:             config,
-		verifier:           provider.Verifier(&oidc.Config{ClientID: clientId}),
-		SuccessRedirectUrl: successRedirectUrl,
-		EndSessionEndpoint: endSessionEndpoint,
-		ProfileDb:          profileDb,
-		ReferenceDb:        referenceDb,
-		LoginChecker:       &NoopLoginChecker{},
-		CookieSetter:       &DefaultCookieSetter{},
+		Logger:                   logutil.NewStdLogger(true, "auth"),
+		provider:                 provider,
+		config:                   config,
+		verifier:                 provider.Verifier(&oidc.Config{ClientID: clientId}),
+		sessionVerifier:          provider.Verifier(&oidc.Config{ClientID: clientId, SkipExpiryCheck: true}),
+		accessTokenVerifier:      provider.Verifier(&oidc.Config{SkipClientIDCheck: true}),
+		revocationEndpoint:       providerClaims.RevocationEndpoint,
+		SuccessRedirectUrl:       successRedirectUrl,
+		EndSessionEndpoint:       endSessionEndpoint,
+		ProfileDb:                profileDb,
+		ReferenceDb:              referenceDb,
+		LoginChecker:             &NoopLoginChecker{},
+		CookieSetter:             &DefaultCookieSetter{},
+		SessionMaxAge:            24 * time.Hour,
+		ImpersonationMaxDuration: time.Hour,
 	}, nil
 }
 
@@ -172,6 +266,10 @@ func NewAuth(
 // This function does not make distinction about new or old NIP. When the user cannot be found, it will return no error
 // but will return nil user instead.
 func (a *Auth) GetUserDetail(ctx context.Context, nip string, workAgencyId string) (user *Asn, err error) {
+	if a.UserDetailGetter != nil {
+		return a.UserDetailGetter.GetUserDetail(ctx, nip, workAgencyId)
+	}
+
 	profileMdb := metricutil.NewDB(a.ProfileDb, a.SqlMetrics)
 	referenceMdb := metricutil.NewDB(a.ReferenceDb, a.SqlMetrics)
 
@@ -438,19 +536,12 @@ func (a *Auth) OidcHandler(writer http.ResponseWriter, request *http.Request) {
 		}
 	}
 
-	claims := &AccessToken{}
-	t, err := jwt.ParseSigned(token.AccessToken)
+	claims, err := parseAccessToken(token.AccessToken)
 	if err != nil {
 		a.Logger.Warnf("access token cannot be parsed: %s", err)
 		_ = httputil.WriteObj(writer, ec.NewError(ErrCodeOAuth2ExchangeFailed, ErrMessageOAuth2ExchangeFailed, err), http.StatusInternalServerError)
 		return
 	}
-	err = t.UnsafeClaimsWithoutVerification(&claims)
-	if err != nil {
-		a.Logger.Warnf("access token cannot be verified: %s", err)
-		_ = httputil.WriteObj(writer, ec.NewError(ErrCodeOAuth2ExchangeFailed, ErrMessageOAuth2ExchangeFailed, err), http.StatusInternalServerError)
-		return
-	}
 
 	userId := strings.TrimPrefix(claims.PreferredUsername, "dummy:")
 	asn, err := a.GetUserDetail(context.Background(), userId, "")
@@ -473,7 +564,30 @@ func (a *Auth) OidcHandler(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	if a.AccessTokenCache != nil {
+	cookieExpiry := token.Expiry
+	if a.SessionCache != nil {
+		now := time.Now()
+		session := &Session{
+			Id:         sessionId(idToken, claims),
+			Subject:    idToken.Subject,
+			Username:   userId,
+			RawIdToken: rawIdToken,
+			CreatedAt:  now,
+			UserAgent:  request.UserAgent(),
+			IpAddress:  a.clientIpAddress(request),
+		}
+		err = a.updateSession(session, token)
+		if err == nil {
+			err = a.SessionCache.SaveSession(session)
+		}
+		if err != nil {
+			a.Logger.Warnf("cannot save session: %s", err)
+			_ = httputil.WriteObj(writer, ec.NewErrorBasic(ErrCodeOAuth2ExchangeFailed, ErrMessageOAuth2ExchangeFailed), http.StatusInternalServerError)
+			return
+		}
+		// The cookie outlives the access token, which is refreshed as long as the session lasts.
+		cookieExpiry = session.RefreshExpiry
+	} else if a.AccessTokenCache != nil {
 		err = a.AccessTokenCache.SaveAccessToken(rawIdToken, claims)
 		if err != nil {
 			a.Logger.Warnf("cannot cache access token: %s", err)
@@ -482,7 +596,7 @@ func (a *Auth) OidcHandler(writer http.ResponseWriter, request *http.Request) {
 		}
 	}
 
-	a.CookieSetter.SetSessionCookie(writer, rawIdToken, token.Expiry.Sub(time.Now()))
+	a.CookieSetter.SetSessionCookie(writer, rawIdToken, cookieExpiry.Sub(time.Now()))
 
 	redirectUrl := a.SuccessRedirectUrl
 	if stateData != nil && stateData.ReturnUrl != "" {
@@ -504,6 +618,16 @@ func (a *Auth) LogoutHandler(writer http.ResponseWriter, request *http.Request)
 
 	a.CookieSetter.DeleteSessionCookie(writer)
 
+	if a.SessionCache != nil {
+		session, err := a.SessionCache.GetSessionByIdToken(token)
+		if err == nil && session != nil {
+			err = a.SessionCache.DeleteSession(session.Id)
+		}
+		if err != nil {
+			a.Logger.Warnf("cannot delete session on logout: %s", err)
+		}
+	}
+
 	logoutUrl, _ := url.Parse(a.EndSessionEndpoint)
 	q := url.Values{}
 	q.Set("id_token_hint", token)
@@ -575,9 +699,34 @@ func (a *Auth) UserAuthHandler(next http.Handler) http.Handler {
 // User will be given 401 if access token cannot be retrieved in the cache, you can treat this as session expired and
 // redirect the user to login again.
 //
-// Cannot be used if AccessTokenCache is nil.
+// If SessionCache is set, the access token of the session is refreshed when it expires, and the ID token may have
+// expired as long as the session has not, see Session.
+//
+// Machine clients can authenticate with an Authorization: Bearer header instead of the cookie, carrying either an ID
+// token issued to this client or an access token of one of ServiceAccounts. The header takes precedence over the
+// cookie.
+//
+// Cannot be used if both AccessTokenCache and SessionCache are nil.
 func (a *Auth) UserExtendedAuthHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if rawToken := bearerToken(request); rawToken != "" {
+			user, err := a.authenticateBearer(writer, rawToken)
+			if err != nil {
+				return
+			}
+			next.ServeHTTP(writer, reqSetUser(request, user))
+			return
+		}
+
+		if a.SessionCache != nil {
+			user, err := a.authenticateSession(writer, request)
+			if err != nil {
+				return
+			}
+			next.ServeHTTP(writer, reqSetUser(request, user))
+			return
+		}
+
 		rawIdTokenCookie, err := request.Cookie("token")
 		if err != nil || rawIdTokenCookie == nil || rawIdTokenCookie.Value == "" {
 			a.WriteUnauthorized(writer, ErrCodeNoIdToken, ErrMessageNoIdToken, err)
@@ -610,6 +759,14 @@ func (a *Auth) UserExtendedAuthHandler(next http.Handler) http.Handler {
 // HttpUserExtendedAuth authenticates and retrieves user extended data.
 // See also UserExtendedAuthHandler.
 func (a *Auth) HttpUserExtendedAuth(writer http.ResponseWriter, request *http.Request) (user *User, err error) {
+	if rawToken := bearerToken(request); rawToken != "" {
+		return a.authenticateBearer(writer, rawToken)
+	}
+
+	if a.SessionCache != nil {
+		return a.authenticateSession(writer, request)
+	}
+
 	rawIdTokenCookie, err := request.Cookie("token")
 	if err != nil || rawIdTokenCookie == nil || rawIdTokenCookie.Value == "" {
 		a.WriteUnauthorized(writer, ErrCodeNoIdToken, ErrMessageNoIdToken, err)
@@ -639,6 +796,21 @@ func (a *Auth) HttpUserExtendedAuth(writer http.ResponseWriter, request *http.Re
 	return user, nil
 }
 
+// parseAccessToken decodes the claims of an access token. The access token is not verified, it comes straight from
+// the provider.
+func parseAccessToken(rawAccessToken string) (accessToken *AccessToken, err error) {
+	accessToken = &AccessToken{}
+	t, err := jwt.ParseSigned(rawAccessToken)
+	if err != nil {
+		return nil, err
+	}
+	err = t.UnsafeClaimsWithoutVerification(accessToken)
+	if err != nil {
+		return nil, err
+	}
+	return accessToken, nil
+}
+
 // reqSetUserDetail adds user data to request.
 // Given a request, attach user data to it via the request context.
 func reqSetUser(request *http.Request, user *User) (newRequest *http.Request) {
@@ -707,9 +879,19 @@ func AssertReqGetUserExtended(request *http.Request) (user *User) {
 // Because it requires access to the database, it is advisable not to use it in every request.
 //
 // 403 and ErrNoWorkAgencyId will be returned also if the user does not have WorkAgencyId.
+//
+// Service accounts are not looked up, they are given a synthetic user detail, see ServiceAccount. Users authenticated
+// with their ID token are checked against LoginChecker if it is a BearerLoginChecker, as they never log in.
+//
+// While the user impersonates another user, the user detail is the one of the impersonated user, with the user as
+// its Impersonator, see Impersonation.
 func (a *Auth) UserDetailAuthHandler(next http.Handler) http.Handler {
 	return a.UserExtendedAuthHandler(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		user := AssertReqGetUserExtended(request)
+		if user.ServiceAccount != nil {
+			next.ServeHTTP(writer, reqSetUserDetail(request, user.ServiceAccount.asn(user)))
+			return
+		}
 
 		userDetail, err := a.GetUserDetail(context.Background(), user.PreferredUsername, "")
 		if err != nil {
@@ -730,6 +912,20 @@ func (a *Auth) UserDetailAuthHandler(next http.Handler) http.Handler {
 			return
 		}
 
+		if user.Bearer {
+			err = a.checkBearerLogin(writer, userDetail)
+			if err != nil {
+				return
+			}
+		}
+
+		if user.Impersonation != nil {
+			userDetail, err = a.impersonate(writer, request, userDetail, user.Impersonation)
+			if err != nil {
+				return
+			}
+		}
+
 		next.ServeHTTP(writer, reqSetUserDetail(request, userDetail))
 	}))
 }
@@ -741,6 +937,9 @@ func (a *Auth) HttpUserDetailAuth(writer http.ResponseWriter, request *http.Requ
 	if err != nil {
 		return nil, err
 	}
+	if user.ServiceAccount != nil {
+		return user.ServiceAccount.asn(user), nil
+	}
 
 	userDetail, err = a.GetUserDetail(context.Background(), user.PreferredUsername, "")
 	if err != nil {
@@ -763,6 +962,17 @@ func (a *Auth) HttpUserDetailAuth(writer http.ResponseWriter, request *http.Requ
 		return nil, err
 	}
 
+	if user.Bearer {
+		err = a.checkBearerLogin(writer, userDetail)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if user.Impersonation != nil {
+		return a.impersonate(writer, request, userDetail, user.Impersonation)
+	}
+
 	return userDetail, nil
 }
 
@@ -0,0 +1,87 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+)
+
+func newSession(id string, subject string, idToken string, expiry time.Time) *auth.Session {
+	return &auth.Session{
+		Id:            id,
+		Subject:       subject,
+		RawIdToken:    idToken,
+		RefreshToken:  "refresh-" + id,
+		Expiry:        time.Now().Add(5 * time.Minute),
+		RefreshExpiry: expiry,
+		CreatedAt:     time.Now(),
+	}
+}
+
+func TestMemoryAccessTokenCache_Session(t *testing.T) {
+	c := auth.NewMemoryAccessTokenCache()
+	session := newSession("sid-1", "user-1", "id-token-1", time.Now().Add(time.Hour))
+	if err := c.SaveSession(session); err != nil {
+		t.Fatalf("session must be saved: %v", err)
+	}
+
+	// Stored sessions are copies, modifying the saved session must not modify the cache.
+	session.RefreshToken = "modified"
+	found, err := c.GetSession("sid-1")
+	if err != nil || found == nil || found.RefreshToken != "refresh-sid-1" {
+		t.Fatalf("session must be found unmodified, got %#v, %v", found, err)
+	}
+
+	// A refreshed session keeps its old ID token linked, concurrent requests may still use it.
+	refreshed := newSession("sid-1", "user-1", "id-token-2", time.Now().Add(time.Hour))
+	if err = c.SaveSession(refreshed); err != nil {
+		t.Fatalf("session must be saved: %v", err)
+	}
+	for _, idToken := range []string{"id-token-1", "id-token-2"} {
+		found, err = c.GetSessionByIdToken(idToken)
+		if err != nil || found == nil || found.RawIdToken != "id-token-2" {
+			t.Errorf("%s must lead to the refreshed session, got %#v, %v", idToken, found, err)
+		}
+	}
+	if found, _ = c.GetSessionByIdToken("unknown"); found != nil {
+		t.Error("unknown ID token must not lead to a session")
+	}
+
+	if err = c.DeleteSession("sid-1"); err != nil {
+		t.Fatalf("session must be deleted: %v", err)
+	}
+	if found, _ = c.GetSessionByIdToken("id-token-1"); found != nil {
+		t.Error("ID tokens of a deleted session must not lead to it")
+	}
+	if err = c.DeleteSession("sid-1"); err != nil {
+		t.Errorf("deleting a deleted session must not fail: %v", err)
+	}
+}
+
+func TestMemoryAccessTokenCache_ListSessions(t *testing.T) {
+	c := auth.NewMemoryAccessTokenCache()
+	_ = c.SaveSession(newSession("sid-1", "user-1", "id-token-1", time.Now().Add(time.Hour)))
+	_ = c.SaveSession(newSession("sid-2", "user-1", "id-token-2", time.Now().Add(time.Hour)))
+	_ = c.SaveSession(newSession("sid-3", "user-2", "id-token-3", time.Now().Add(time.Hour)))
+	_ = c.SaveSession(newSession("sid-4", "user-1", "id-token-4", time.Now().Add(-time.Second)))
+
+	sessions, err := c.ListSessions("user-1")
+	if err != nil {
+		t.Fatalf("sessions must be listed: %v", err)
+	}
+	ids := map[string]bool{}
+	for _, session := range sessions {
+		ids[session.Id] = true
+	}
+	if len(ids) != 2 || !ids["sid-1"] || !ids["sid-2"] {
+		t.Errorf("only the active sessions of the subject must be listed, got %v", ids)
+	}
+
+	if found, _ := c.GetSession("sid-4"); found != nil {
+		t.Error("expired session must not be found")
+	}
+	if found, _ := c.GetSessionByIdToken("id-token-4"); found != nil {
+		t.Error("ID token of an expired session must not lead to it")
+	}
+}
@@ -0,0 +1,35 @@
+package auth_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+)
+
+func TestParseServiceAccounts(t *testing.T) {
+	accounts, err := auth.ParseServiceAccounts([]string{"siasn-sync=A1, A2", " ", "batch=A3,"})
+	if err != nil {
+		t.Fatalf("service accounts must be parsed: %v", err)
+	}
+	if len(accounts) != 2 {
+		t.Fatalf("2 service accounts must be parsed, got %d", len(accounts))
+	}
+	if account := accounts["siasn-sync"]; account == nil || !reflect.DeepEqual(account.AgencyIds, []string{"A1", "A2"}) {
+		t.Errorf("siasn-sync must have agencies A1 and A2, got %#v", account)
+	}
+	if account := accounts["batch"]; account == nil || !reflect.DeepEqual(account.AgencyIds, []string{"A3"}) {
+		t.Errorf("batch must have agency A3, got %#v", account)
+	}
+
+	for _, values := range [][]string{
+		{"siasn-sync"},
+		{"=A1"},
+		{"siasn-sync="},
+		{"siasn-sync=A1", "siasn-sync=A2"},
+	} {
+		if _, err = auth.ParseServiceAccounts(values); err == nil {
+			t.Errorf("%v must be rejected", values)
+		}
+	}
+}
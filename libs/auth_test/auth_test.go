@@ -0,0 +1,454 @@
+package auth_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/fakeoidc"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/logutil"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const (
+	clientId     = "manajemen-jf"
+	clientSecret = "secret"
+	nip          = "199001012020011001"
+	agencyId     = "A5EB03E23BFBF6A0E040640A040252AD"
+)
+
+// noRedirectClient returns the redirects of the fake provider instead of following them.
+var noRedirectClient = &http.Client{
+	CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// newAuth creates an Auth against a fake provider, with a user nip of agencyId.
+func newAuth(t *testing.T) (a *auth.Auth, provider *fakeoidc.Provider) {
+	t.Helper()
+	provider, server, err := fakeoidc.NewServer(clientId, clientSecret)
+	if err != nil {
+		t.Fatalf("fake provider must start: %v", err)
+	}
+	t.Cleanup(server.Close)
+	provider.AddUser(&fakeoidc.User{Username: nip, AgencyId: agencyId, Roles: []string{"admin_instansi"}})
+
+	a, err = auth.NewAuth(server.URL, nil, nil, clientId, clientSecret, server.URL+fakeoidc.PathEndSession, "http://localhost/api/oauth", "http://localhost/")
+	if err != nil {
+		t.Fatalf("auth must be created: %v", err)
+	}
+	a.Logger = logutil.NewStdLogger(false, "auth")
+	cache := auth.NewMemoryAccessTokenCache()
+	a.NonceCache = cache
+	a.StateCache = cache
+	a.AccessTokenCache = cache
+	a.SessionCache = cache
+	a.UserDetailGetter = provider
+	a.UserRoles = provider.GetUserRoles
+	return a, provider
+}
+
+// login logs in as username through the fake provider and returns the session cookie.
+func login(t *testing.T, a *auth.Auth, username string) *http.Cookie {
+	t.Helper()
+	rec := callback(t, a, username)
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("login must succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	return sessionCookie(t, rec)
+}
+
+// callback logs in as username at the fake provider and returns the response of the redirection back to a.
+func callback(t *testing.T, a *auth.Auth, username string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	a.LoginHandler(rec, httptest.NewRequest("GET", "/api/login", nil))
+	authUrl := rec.Header().Get("Location")
+
+	response, err := noRedirectClient.Get(authUrl + "&login_hint=" + url.QueryEscape(username))
+	if err != nil {
+		t.Fatalf("fake provider must be reachable: %v", err)
+	}
+	_ = response.Body.Close()
+	callbackUrl := response.Header.Get("Location")
+	if !strings.Contains(callbackUrl, "code=") {
+		t.Fatalf("fake provider must redirect with a code, got %s", callbackUrl)
+	}
+
+	rec = httptest.NewRecorder()
+	a.OidcHandler(rec, httptest.NewRequest("GET", callbackUrl, nil))
+	return rec
+}
+
+func sessionCookie(t *testing.T, rec *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "token" {
+			return cookie
+		}
+	}
+	t.Fatal("session cookie must be set")
+	return nil
+}
+
+// serve sends request through UserDetailAuthHandler, and returns the user detail seen by the handler.
+func serve(a *auth.Auth, request *http.Request) (rec *httptest.ResponseRecorder, asn *auth.Asn) {
+	rec = httptest.NewRecorder()
+	a.UserDetailAuthHandler(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		asn = auth.AssertReqGetUserDetail(request)
+	})).ServeHTTP(rec, request)
+	return rec, asn
+}
+
+func withCookie(cookie *http.Cookie) *http.Request {
+	request := httptest.NewRequest("GET", "/api/v1/search", nil)
+	request.AddCookie(cookie)
+	return request
+}
+
+func withBearer(token string) *http.Request {
+	request := httptest.NewRequest("GET", "/api/v1/search", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	return request
+}
+
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) int {
+	t.Helper()
+	e := &ec.Error{}
+	if err := json.Unmarshal(rec.Body.Bytes(), e); err != nil {
+		t.Fatalf("response must be an error: %s", rec.Body.String())
+	}
+	return e.Code
+}
+
+func TestLogin(t *testing.T) {
+	a, _ := newAuth(t)
+	cookie := login(t, a, nip)
+
+	rec, asn := serve(a, withCookie(cookie))
+	if rec.Code != http.StatusOK || asn == nil {
+		t.Fatalf("request must be authenticated, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if asn.NewNip != nip || asn.WorkAgencyId != agencyId {
+		t.Errorf("user detail must come from the fake provider, got %#v", asn)
+	}
+	roles := asn.AccessToken.GetRoles()
+	if len(roles) != 1 || roles[0].Role != "admin_instansi" {
+		t.Errorf("access token must have the roles of the user, got %v", roles)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	a, provider := newAuth(t)
+	// Access tokens expiring within the refresh leeway are refreshed on every request.
+	provider.TokenTtl = 10 * time.Second
+	cookie := login(t, a, nip)
+
+	rec, asn := serve(a, withCookie(cookie))
+	if rec.Code != http.StatusOK || asn == nil {
+		t.Fatalf("request must be authenticated, got %d: %s", rec.Code, rec.Body.String())
+	}
+	refreshed := sessionCookie(t, rec)
+	if refreshed.Value == cookie.Value {
+		t.Fatal("session cookie must be updated with the refreshed ID token")
+	}
+
+	// The old cookie still leads to the session, requests may have been sent with it concurrently.
+	if rec, _ = serve(a, withCookie(cookie)); rec.Code != http.StatusOK {
+		t.Errorf("old cookie must still be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	provider.EndSessions(nip)
+	rec, _ = serve(a, withCookie(refreshed))
+	if rec.Code != http.StatusUnauthorized || errorCode(t, rec) != auth.ErrCodeSessionExpired {
+		t.Errorf("session ended at the provider must expire, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSessionListRevoke(t *testing.T) {
+	a, _ := newAuth(t)
+	cookie := login(t, a, nip)
+	other := login(t, a, nip)
+
+	list := func() (sessions []*auth.SessionInfo) {
+		rec := httptest.NewRecorder()
+		a.UserExtendedAuthHandler(http.HandlerFunc(a.HandleSessionList)).ServeHTTP(rec, withCookie(cookie))
+		if err := json.Unmarshal(rec.Body.Bytes(), &sessions); err != nil {
+			t.Fatalf("sessions must be listed: %s", rec.Body.String())
+		}
+		return sessions
+	}
+	revoke := func(id string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("POST", "/api/v1/session/revoke", strings.NewReader(`{"id": "`+id+`"}`))
+		request.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		a.UserExtendedAuthHandler(http.HandlerFunc(a.HandleSessionRevoke)).ServeHTTP(rec, request)
+		return rec
+	}
+
+	sessions := list()
+	if len(sessions) != 2 {
+		t.Fatalf("both sessions must be listed, got %d", len(sessions))
+	}
+	otherId := ""
+	for _, session := range sessions {
+		if !session.Current {
+			otherId = session.Id
+		}
+	}
+
+	if rec := revoke(otherId); rec.Code != http.StatusOK {
+		t.Fatalf("other session must be revoked, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec, _ := serve(a, withCookie(other)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked session must not be accepted, got %d", rec.Code)
+	}
+	if sessions = list(); len(sessions) != 1 || !sessions[0].Current {
+		t.Errorf("only the current session must be left, got %d", len(sessions))
+	}
+	if rec := revoke("unknown"); rec.Code != http.StatusNotFound || errorCode(t, rec) != auth.ErrCodeSessionNotFound {
+		t.Errorf("unknown session must not be found, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestBackChannelLogout(t *testing.T) {
+	a, provider := newAuth(t)
+	cookie := login(t, a, nip)
+
+	logout := func(logoutToken string) int {
+		request := httptest.NewRequest("POST", "/api/backchannel-logout", strings.NewReader(url.Values{"logout_token": {logoutToken}}.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		a.BackChannelLogoutHandler(rec, request)
+		return rec.Code
+	}
+
+	if code := logout("invalid"); code != http.StatusBadRequest {
+		t.Errorf("invalid logout token must be rejected, got %d", code)
+	}
+	// ID tokens are not logout tokens.
+	idToken, _ := provider.IdToken(nip)
+	if code := logout(idToken); code != http.StatusBadRequest {
+		t.Errorf("ID token must be rejected, got %d", code)
+	}
+
+	logoutToken, err := provider.LogoutToken(nip, "")
+	if err != nil {
+		t.Fatalf("logout token must be minted: %v", err)
+	}
+	if code := logout(logoutToken); code != http.StatusOK {
+		t.Fatalf("logout token must be accepted, got %d", code)
+	}
+	if rec, _ := serve(a, withCookie(cookie)); rec.Code != http.StatusUnauthorized {
+		t.Errorf("session must be deleted by back-channel logout, got %d", rec.Code)
+	}
+}
+
+func TestBearer(t *testing.T) {
+	a, provider := newAuth(t)
+	provider.AddClient(&fakeoidc.Client{Id: "siasn-sync", Secret: "sync-secret", Roles: []string{"admin_instansi"}})
+	provider.AddClient(&fakeoidc.Client{Id: "unknown", Secret: "unknown-secret"})
+	a.ServiceAccounts, _ = auth.ParseServiceAccounts([]string{"siasn-sync=A1,A2"})
+
+	idToken, _ := provider.IdToken(nip)
+	rec, asn := serve(a, withBearer(idToken))
+	if rec.Code != http.StatusOK || asn == nil || asn.NewNip != nip || asn.ScopeAgencyIds != nil {
+		t.Fatalf("ID token must authenticate its user, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	clientToken, _ := provider.ClientToken("siasn-sync")
+	rec, asn = serve(a, withBearer(clientToken))
+	if rec.Code != http.StatusOK || asn == nil {
+		t.Fatalf("access token of a service account must be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if asn.WorkAgencyId != "A1" || len(asn.ScopeAgencyIds) != 2 || asn.AsnId == "" {
+		t.Errorf("service account must be a synthetic ASN of its agencies, got %#v", asn)
+	}
+	if roles := asn.AccessToken.GetRoles(); len(roles) != 1 || roles[0].Role != "admin_instansi" {
+		t.Errorf("service account must have the roles of its access token, got %v", roles)
+	}
+
+	unknownToken, _ := provider.ClientToken("unknown")
+	if rec, _ = serve(a, withBearer(unknownToken)); rec.Code != http.StatusUnauthorized || errorCode(t, rec) != auth.ErrCodeUnknownServiceAccount {
+		t.Errorf("access token of another client must be rejected, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec, _ = serve(a, withBearer("invalid")); rec.Code != http.StatusUnauthorized || errorCode(t, rec) != auth.ErrCodeInvalidBearerToken {
+		t.Errorf("invalid bearer token must be rejected, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("WWW-Authenticate") == "" {
+		t.Error("rejected bearer token must be challenged")
+	}
+}
+
+func TestImpersonation(t *testing.T) {
+	a, provider := newAuth(t)
+	a.ImpersonationRoles = []string{"admin_instansi", "verifikator"}
+	admin := &fakeoidc.User{Username: "198501012010011001", AgencyId: agencyId, Roles: []string{"admin_bkn"}}
+	provider.AddUser(admin)
+	noRole := &fakeoidc.User{Username: "197501012000011001", AgencyId: agencyId}
+	provider.AddUser(noRole)
+	provider.AddUser(&fakeoidc.User{Username: "198601012010011001", AgencyId: agencyId, Roles: []string{"admin_bkn"}})
+	cookie := login(t, a, admin.Username)
+
+	start := func(request *http.Request, body string) *httptest.ResponseRecorder {
+		request.Method = "POST"
+		request.Body = io.NopCloser(strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		a.UserDetailAuthHandler(http.HandlerFunc(a.HandleImpersonationStart)).ServeHTTP(rec, request)
+		return rec
+	}
+	stop := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		a.UserDetailAuthHandler(http.HandlerFunc(a.HandleImpersonationStop)).ServeHTTP(rec, withCookie(cookie))
+		return rec
+	}
+
+	for _, body := range []string{
+		// Roles cannot be asked for, the user only has admin_instansi.
+		`{"nip": "` + nip + `", "roles": ["verifikator"], "alasan": "TICKET-1"}`,
+		`{"nip": "` + nip + `"}`,
+		`{"nip": "` + nip + `", "alasan": "TICKET-1", "durasi_menit": 61}`,
+		`{"nip": "` + admin.Username + `", "alasan": "TICKET-1"}`,
+		// Neither users without a role that can be impersonated, nor other BKN admins, can be impersonated.
+		`{"nip": "` + noRole.Username + `", "alasan": "TICKET-1"}`,
+		`{"nip": "198601012010011001", "alasan": "TICKET-1"}`,
+	} {
+		if rec := start(withCookie(cookie), body); rec.Code != http.StatusBadRequest || errorCode(t, rec) != auth.ErrCodeInvalidImpersonation {
+			t.Errorf("invalid impersonation %s must be rejected, got %d: %s", body, rec.Code, rec.Body.String())
+		}
+	}
+	if rec := start(withCookie(cookie), `{"nip": "unknown", "alasan": "TICKET-1"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown user must not be impersonated, got %d: %s", rec.Code, rec.Body.String())
+	}
+	idToken, _ := provider.IdToken(admin.Username)
+	if rec := start(withBearer(idToken), `{"nip": "`+nip+`", "alasan": "TICKET-1"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("bearer token without session must not impersonate, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec := start(withCookie(cookie), `{"nip": "`+nip+`", "alasan": "TICKET-1", "durasi_menit": 30}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("impersonation must start, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec, asn := serve(a, withCookie(cookie))
+	if rec.Code != http.StatusOK || asn == nil || asn.NewNip != nip || asn.Impersonator == nil || asn.Impersonator.NewNip != admin.Username {
+		t.Fatalf("user detail must be the impersonated user, got %d: %#v", rec.Code, asn)
+	}
+	if roles := asn.AccessToken.GetRoles(); len(roles) != 1 || roles[0].Role != "admin_instansi" {
+		t.Errorf("impersonated user must only have their own roles that can be impersonated, got %v", roles)
+	}
+	if asn.Impersonation == nil || asn.Impersonation.Reason != "TICKET-1" || time.Until(asn.Impersonation.ExpiresAt) > 30*time.Minute {
+		t.Errorf("impersonation must be described in the user detail, got %#v", asn.Impersonation)
+	}
+	if rec = start(withCookie(cookie), `{"nip": "`+admin.Username+`", "alasan": "TICKET-1"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("impersonation must not be nested, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec = stop(); rec.Code != http.StatusOK {
+		t.Fatalf("impersonation must stop, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if _, asn = serve(a, withCookie(cookie)); asn == nil || asn.NewNip != admin.Username || asn.Impersonator != nil {
+		t.Errorf("user detail must be the impersonator again, got %#v", asn)
+	}
+	if rec = stop(); rec.Code != http.StatusBadRequest || errorCode(t, rec) != auth.ErrCodeNotImpersonating {
+		t.Errorf("stopping without impersonation must be rejected, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Impersonations end by themselves.
+	start(withCookie(cookie), `{"nip": "`+nip+`", "alasan": "TICKET-1"}`)
+	sessions, _ := a.SessionCache.ListSessions(admin.Subject)
+	if len(sessions) != 1 || sessions[0].Impersonation == nil {
+		t.Fatalf("impersonation must be stored in the session, got %d sessions", len(sessions))
+	}
+	sessions[0].Impersonation.ExpiresAt = time.Now()
+	_ = a.SessionCache.SaveSession(sessions[0])
+	if _, asn = serve(a, withCookie(cookie)); asn == nil || asn.NewNip != admin.Username || asn.Impersonator != nil {
+		t.Errorf("expired impersonation must end, got %#v", asn)
+	}
+}
+
+func TestLoginPolicy(t *testing.T) {
+	a, provider := newAuth(t)
+	staffNip := "198001012005011001"
+	provider.AddUser(&fakeoidc.User{Username: staffNip, AgencyId: "B1"})
+	provider.AddUser(&fakeoidc.User{Username: "197001012000011001", AgencyId: "B2"})
+
+	checker := auth.NewPolicyLoginChecker(nil)
+	checker.Logger = logutil.NewStdLogger(false, "login")
+	checker.LogoutUrl = "http://localhost/logout"
+	checker.Metrics = &auth.LoginMetrics{
+		Allowed:  prometheus.NewCounterVec(prometheus.CounterOpts{Name: "allowed_total"}, []string{"rule"}),
+		Rejected: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "rejected_total"}, []string{"reason"}),
+	}
+	staffErr := error(nil)
+	checker.IsStaff = func(_ context.Context, user *auth.Asn) (bool, error) {
+		return user.NewNip == staffNip, staffErr
+	}
+	a.LoginChecker = checker
+
+	// An empty policy lets everyone log in.
+	login(t, a, "197001012000011001")
+
+	checker.Configure(&auth.LoginPolicy{Roles: []string{"admin_instansi"}, AgencyIds: []string{"B1"}})
+	login(t, a, nip)
+	login(t, a, staffNip)
+	rec := callback(t, a, "197001012000011001")
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "Akses Ditolak") || !strings.Contains(rec.Body.String(), checker.LogoutUrl) {
+		t.Errorf("user outside of the policy must be shown the denial page, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(rec.Result().Cookies()) != 0 {
+		t.Error("denied user must not get a session")
+	}
+
+	checker.Configure(&auth.LoginPolicy{Roles: []string{"manajemen-jf:operator"}, Staff: true})
+	if rec = callback(t, a, nip); rec.Code != http.StatusForbidden {
+		t.Errorf("realm role must not satisfy a client role, got %d", rec.Code)
+	}
+	login(t, a, staffNip)
+	staffErr = errors.New("database is down")
+	if rec = callback(t, a, staffNip); rec.Code != http.StatusInternalServerError {
+		t.Errorf("login must fail if the policy cannot be checked, got %d", rec.Code)
+	}
+
+	// ID tokens sent as bearer tokens are checked too, with staff looked up once per token.
+	staffChecks := 0
+	checker.IsStaff = func(_ context.Context, user *auth.Asn) (bool, error) {
+		staffChecks++
+		return user.NewNip == staffNip, nil
+	}
+	idToken, _ := provider.IdToken(nip)
+	if rec, _ = serve(a, withBearer(idToken)); rec.Code != http.StatusForbidden || errorCode(t, rec) != auth.ErrCodeLoginDenied {
+		t.Errorf("ID token of a user outside of the policy must be denied, got %d: %s", rec.Code, rec.Body.String())
+	}
+	staffToken, _ := provider.IdToken(staffNip)
+	for i := 0; i < 2; i++ {
+		if rec, _ = serve(a, withBearer(staffToken)); rec.Code != http.StatusOK {
+			t.Errorf("ID token of a staff must be accepted, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+	if staffChecks != 2 {
+		t.Errorf("staff must be looked up once per token, got %d lookups", staffChecks)
+	}
+
+	for rule, count := range map[string]float64{auth.LoginRuleOpen: 1, auth.LoginRuleRole: 1, auth.LoginRuleAgency: 1, auth.LoginRuleStaff: 1} {
+		if got := testutil.ToFloat64(checker.Metrics.Allowed.WithLabelValues(rule)); got != count {
+			t.Errorf("allowed logins by rule %s must be counted, got %v", rule, got)
+		}
+	}
+	for reason, count := range map[string]float64{auth.LoginRejectedDenied: 3, auth.LoginRejectedError: 1} {
+		if got := testutil.ToFloat64(checker.Metrics.Rejected.WithLabelValues(reason)); got != count {
+			t.Errorf("rejected logins by reason %s must be counted, got %v", reason, got)
+		}
+	}
+}
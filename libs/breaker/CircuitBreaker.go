@@ -0,0 +1,289 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/logutil"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// State is the state of a CircuitBreaker. Its value is also the value of the Metrics.State gauge.
+type State int
+
+const (
+	// StateClosed lets every call through.
+	StateClosed State = iota
+	// StateHalfOpen lets HalfOpenProbes trial calls through to find out whether the dependency has recovered.
+	StateHalfOpen
+	// StateOpen fails every call fast with an *OpenError until OpenTimeout has passed.
+	StateOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// ErrOpen matches every *OpenError with errors.Is.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// OpenError is returned instead of calling a dependency whose breaker does not let calls through.
+type OpenError struct {
+	// Name is the name of the breaker, which is the name of its dependency.
+	Name string
+	// RetryAfter is the remaining duration until the breaker lets trial calls through again. It is zero if the breaker
+	// is half-open and its trial calls are still running.
+	RetryAfter time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit breaker of %s is open", e.Name)
+}
+
+func (e *OpenError) Is(target error) bool {
+	return target == ErrOpen
+}
+
+// Temporary always returns false, so that clients retrying temporary errors, like the AWS SDK, fail fast as well.
+func (e *OpenError) Temporary() bool {
+	return false
+}
+
+// AsOpenError finds the first *OpenError in the chain of err. Unlike errors.As, it also follows the OrigErr method of
+// the AWS SDK errors, which do not implement Unwrap.
+func AsOpenError(err error) (openErr *OpenError, ok bool) {
+	for err != nil {
+		if openErr, ok = err.(*OpenError); ok {
+			return openErr, true
+		}
+		if aws, isAws := err.(interface{ OrigErr() error }); isAws {
+			err = aws.OrigErr()
+		} else {
+			err = errors.Unwrap(err)
+		}
+	}
+	return nil, false
+}
+
+// IsFailure is the default CircuitBreaker.IsFailure: every error counts as a failure of the dependency, except
+// cancellations which are caused by the caller.
+func IsFailure(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled)
+}
+
+// Metrics are updated by a CircuitBreaker on each state change and rejected call, labeled by the name of the breaker.
+// Every field can be nil.
+type Metrics struct {
+	// State is the current State of the breaker: 0 closed, 1 half-open, 2 open.
+	State *prometheus.GaugeVec
+	// Transitions counts the state changes of the breaker, labeled by the name and the new state ("to").
+	Transitions *prometheus.CounterVec
+	// Rejected counts the calls failed fast with an *OpenError.
+	Rejected *prometheus.CounterVec
+}
+
+// CircuitBreaker guards a single dependency, e.g. a database. It is closed as long as calls succeed, and opens after
+// FailureThreshold consecutive failures, failing every call fast for OpenTimeout. It then becomes half-open and lets
+// HalfOpenProbes trial calls through: the breaker closes if all of them succeed, and opens again as soon as one fails.
+//
+// Settings must only be changed with Configure after the first call, a CircuitBreaker is then safe for concurrent use.
+type CircuitBreaker struct {
+	// Name is the name of the dependency, used in errors, logs and metric labels, e.g. profile_postgres.
+	Name string
+	// FailureThreshold is the number of consecutive failures that opens the breaker.
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before letting trial calls through.
+	OpenTimeout time.Duration
+	// HalfOpenProbes is the number of trial calls that must succeed to close a half-open breaker.
+	HalfOpenProbes int
+	// IsFailure tells whether an error returned by the dependency is a failure of the dependency. Errors that are not,
+	// like a constraint violation reported by a database, count as successes. Defaults to IsFailure if nil.
+	IsFailure func(err error) bool
+	Metrics   *Metrics
+	Logger    logutil.Logger
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	// probes is the number of trial calls let through since the breaker became half-open.
+	probes    int
+	successes int
+	// generation is incremented on each state change, so that calls let through in a previous state are not counted.
+	generation uint64
+}
+
+// NewCircuitBreaker creates a closed CircuitBreaker for the dependency name with a single trial call when half-open.
+func NewCircuitBreaker(name string, failureThreshold int, openTimeout time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		Name:             name,
+		FailureThreshold: failureThreshold,
+		OpenTimeout:      openTimeout,
+		HalfOpenProbes:   1,
+	}
+}
+
+// Configure changes FailureThreshold, OpenTimeout and HalfOpenProbes, it is safe to call while calls go through the
+// breaker. The new settings apply to the current state, e.g. an open breaker becomes half-open once the new
+// OpenTimeout has passed since it opened.
+func (b *CircuitBreaker) Configure(failureThreshold int, openTimeout time.Duration, halfOpenProbes int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.FailureThreshold = failureThreshold
+	b.OpenTimeout = openTimeout
+	b.HalfOpenProbes = halfOpenProbes
+}
+
+// State returns the current state of the breaker.
+func (b *CircuitBreaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire()
+	return b.state
+}
+
+// Allow asks the breaker to let a call through. If the call is allowed, done must be called with the result of the
+// call, otherwise err is an *OpenError and the dependency must not be called.
+func (b *CircuitBreaker) Allow() (done func(err error), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire()
+
+	switch b.state {
+	case StateOpen:
+		return nil, b.reject(b.OpenTimeout - time.Since(b.openedAt))
+	case StateHalfOpen:
+		if b.probes >= b.halfOpenProbes() {
+			return nil, b.reject(0)
+		}
+		b.probes++
+	}
+
+	generation := b.generation
+	return func(err error) {
+		b.record(generation, err)
+	}, nil
+}
+
+// Do calls fn if the breaker lets the call through, and records its result. It returns an *OpenError without calling
+// fn otherwise.
+func (b *CircuitBreaker) Do(fn func() error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	done(err)
+	return err
+}
+
+// record records the result of a call let through in generation.
+func (b *CircuitBreaker) record(generation uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+
+	isFailure := IsFailure
+	if b.IsFailure != nil {
+		isFailure = b.IsFailure
+	}
+	failed := err != nil && isFailure(err)
+
+	switch b.state {
+	case StateClosed:
+		if !failed {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.FailureThreshold {
+			b.warnf("circuit breaker of %s is open after %d consecutive failures, last: %v", b.Name, b.failures, err)
+			b.setState(StateOpen)
+		}
+	case StateHalfOpen:
+		if failed {
+			b.warnf("circuit breaker of %s is open again, trial call failed: %v", b.Name, err)
+			b.setState(StateOpen)
+			return
+		}
+		b.successes++
+		if b.successes >= b.halfOpenProbes() {
+			b.infof("circuit breaker of %s is closed, %s has recovered", b.Name, b.Name)
+			b.setState(StateClosed)
+		}
+	}
+}
+
+// expire makes an open breaker half-open once OpenTimeout has passed. b.mu must be held.
+func (b *CircuitBreaker) expire() {
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.OpenTimeout {
+		b.infof("circuit breaker of %s is half-open, letting trial calls through", b.Name)
+		b.setState(StateHalfOpen)
+	}
+}
+
+// setState changes the state of the breaker and resets its counters. b.mu must be held.
+func (b *CircuitBreaker) setState(state State) {
+	b.state = state
+	b.generation++
+	b.failures = 0
+	b.probes = 0
+	b.successes = 0
+	if state == StateOpen {
+		b.openedAt = time.Now()
+	}
+
+	if b.Metrics != nil && b.Metrics.State != nil {
+		b.Metrics.State.WithLabelValues(b.Name).Set(float64(state))
+	}
+	if b.Metrics != nil && b.Metrics.Transitions != nil {
+		b.Metrics.Transitions.WithLabelValues(b.Name, state.String()).Inc()
+	}
+}
+
+// reject returns the error of a call that is not let through. b.mu must be held.
+func (b *CircuitBreaker) reject(retryAfter time.Duration) error {
+	if b.Metrics != nil && b.Metrics.Rejected != nil {
+		b.Metrics.Rejected.WithLabelValues(b.Name).Inc()
+	}
+	if retryAfter < 0 {
+		retryAfter = 0
+	}
+	return &OpenError{Name: b.Name, RetryAfter: retryAfter}
+}
+
+func (b *CircuitBreaker) halfOpenProbes() int {
+	if b.HalfOpenProbes < 1 {
+		return 1
+	}
+	return b.HalfOpenProbes
+}
+
+func (b *CircuitBreaker) warnf(format string, v ...interface{}) {
+	if b.Logger != nil {
+		b.Logger.Warnf(format, v...)
+		return
+	}
+	logutil.Warnf(format, v...)
+}
+
+func (b *CircuitBreaker) infof(format string, v ...interface{}) {
+	if b.Logger != nil {
+		b.Logger.Infof(format, v...)
+		return
+	}
+	logutil.Infof(format, v...)
+}
@@ -0,0 +1,218 @@
+package breaker
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+)
+
+var errNamedArgs = errors.New("sql: driver does not support the use of Named Parameters")
+
+// Connector is a driver.Connector whose connections call the database through Breaker: connecting, preparing
+// statements, beginning transactions, executing, querying and pinging fail fast with an *OpenError while Breaker is
+// open. Use it with sql.OpenDB.
+//
+// Transactions and rows are not guarded, so that a transaction that has begun can always be committed or rolled back.
+type Connector struct {
+	driver.Connector
+	Breaker *CircuitBreaker
+}
+
+// NewConnector wraps connector, e.g. obtained from the OpenConnector method of a driver.DriverContext.
+func NewConnector(connector driver.Connector, breaker *CircuitBreaker) *Connector {
+	return &Connector{Connector: connector, Breaker: breaker}
+}
+
+func (c *Connector) Connect(ctx context.Context) (conn driver.Conn, err error) {
+	err = c.Breaker.Do(func() (err error) {
+		conn, err = c.Connector.Connect(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &breakerConn{conn: conn, breaker: c.Breaker}, nil
+}
+
+// breakerConn implements every optional interface of driver.Conn, falling back to what database/sql does when the
+// wrapped connection does not implement one.
+type breakerConn struct {
+	conn    driver.Conn
+	breaker *CircuitBreaker
+}
+
+func (c *breakerConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *breakerConn) PrepareContext(ctx context.Context, query string) (stmt driver.Stmt, err error) {
+	err = c.breaker.Do(func() (err error) {
+		if preparer, ok := c.conn.(driver.ConnPrepareContext); ok {
+			stmt, err = preparer.PrepareContext(ctx, query)
+		} else {
+			stmt, err = c.conn.Prepare(query)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &breakerStmt{stmt: stmt, conn: c}, nil
+}
+
+func (c *breakerConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *breakerConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *breakerConn) BeginTx(ctx context.Context, opts driver.TxOptions) (tx driver.Tx, err error) {
+	err = c.breaker.Do(func() (err error) {
+		if beginner, ok := c.conn.(driver.ConnBeginTx); ok {
+			tx, err = beginner.BeginTx(ctx, opts)
+		} else {
+			tx, err = c.conn.Begin()
+		}
+		return err
+	})
+	return tx, err
+}
+
+func (c *breakerConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (result driver.Result, err error) {
+	execer, ok := c.conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	err = c.breaker.Do(func() (err error) {
+		result, err = execer.ExecContext(ctx, query, args)
+		return err
+	})
+	return result, err
+}
+
+func (c *breakerConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (rows driver.Rows, err error) {
+	queryer, ok := c.conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	err = c.breaker.Do(func() (err error) {
+		rows, err = queryer.QueryContext(ctx, query, args)
+		return err
+	})
+	return rows, err
+}
+
+func (c *breakerConn) Ping(ctx context.Context) error {
+	pinger, ok := c.conn.(driver.Pinger)
+	if !ok {
+		return nil
+	}
+	return c.breaker.Do(func() error {
+		return pinger.Ping(ctx)
+	})
+}
+
+func (c *breakerConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *breakerConn) IsValid() bool {
+	if validator, ok := c.conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *breakerConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+type breakerStmt struct {
+	stmt driver.Stmt
+	conn *breakerConn
+}
+
+func (s *breakerStmt) Close() error {
+	return s.stmt.Close()
+}
+
+func (s *breakerStmt) NumInput() int {
+	return s.stmt.NumInput()
+}
+
+func (s *breakerStmt) Exec(args []driver.Value) (result driver.Result, err error) {
+	err = s.conn.breaker.Do(func() (err error) {
+		result, err = s.stmt.Exec(args)
+		return err
+	})
+	return result, err
+}
+
+func (s *breakerStmt) Query(args []driver.Value) (rows driver.Rows, err error) {
+	err = s.conn.breaker.Do(func() (err error) {
+		rows, err = s.stmt.Query(args)
+		return err
+	})
+	return rows, err
+}
+
+func (s *breakerStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (result driver.Result, err error) {
+	execer, ok := s.stmt.(driver.StmtExecContext)
+	if !ok {
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Exec(values)
+	}
+	err = s.conn.breaker.Do(func() (err error) {
+		result, err = execer.ExecContext(ctx, args)
+		return err
+	})
+	return result, err
+}
+
+func (s *breakerStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (rows driver.Rows, err error) {
+	queryer, ok := s.stmt.(driver.StmtQueryContext)
+	if !ok {
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Query(values)
+	}
+	err = s.conn.breaker.Do(func() (err error) {
+		rows, err = queryer.QueryContext(ctx, args)
+		return err
+	})
+	return rows, err
+}
+
+// CheckNamedValue checks with the statement, then with the connection, because database/sql does not ask the
+// connection once the statement implements driver.NamedValueChecker.
+func (s *breakerStmt) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := s.stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return s.conn.CheckNamedValue(value)
+}
+
+// namedValuesToValues converts arguments for drivers that do not support named arguments, as database/sql does.
+func namedValuesToValues(named []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(named))
+	for i, value := range named {
+		if len(value.Name) > 0 {
+			return nil, errNamedArgs
+		}
+		values[i] = value.Value
+	}
+	return values, nil
+}
@@ -0,0 +1,38 @@
+package breaker
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Transport is an http.RoundTripper that sends requests through Breaker. Requests fail fast with an *OpenError while
+// Breaker is open. Besides transport errors, responses with a 5xx status code count as failures.
+type Transport struct {
+	// Base sends the requests, http.DefaultTransport if nil.
+	Base    http.RoundTripper
+	Breaker *CircuitBreaker
+}
+
+func (t *Transport) RoundTrip(request *http.Request) (*http.Response, error) {
+	done, err := t.Breaker.Allow()
+	if err != nil {
+		// A RoundTripper must always close the body.
+		if request.Body != nil {
+			_ = request.Body.Close()
+		}
+		return nil, err
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	response, err := base.RoundTrip(request)
+	if err == nil && response.StatusCode >= 500 {
+		done(fmt.Errorf("%s responded with %s", request.URL.Host, response.Status))
+	} else {
+		done(err)
+	}
+	return response, err
+}
@@ -0,0 +1,308 @@
+package breaker_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/breaker"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/logutil"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var errDown = errors.New("connection refused")
+
+func newCircuitBreaker(name string) *breaker.CircuitBreaker {
+	b := breaker.NewCircuitBreaker(name, 3, 50*time.Millisecond)
+	b.Logger = logutil.NewStdLogger(false, "breaker")
+	b.Metrics = &breaker.Metrics{
+		State:       prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "state"}, []string{"dependency"}),
+		Transitions: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "transitions"}, []string{"dependency", "to"}),
+		Rejected:    prometheus.NewCounterVec(prometheus.CounterOpts{Name: "rejected"}, []string{"dependency"}),
+	}
+	return b
+}
+
+func fail() error {
+	return errDown
+}
+
+func succeed() error {
+	return nil
+}
+
+func expectState(t *testing.T, b *breaker.CircuitBreaker, expected breaker.State) {
+	t.Helper()
+	if state := b.State(); state != expected {
+		t.Fatalf("breaker must be %s, got %s", expected, state)
+	}
+}
+
+func TestCircuitBreaker_Open(t *testing.T) {
+	b := newCircuitBreaker("postgres")
+
+	_ = b.Do(fail)
+	_ = b.Do(fail)
+	_ = b.Do(succeed)
+	_ = b.Do(fail)
+	_ = b.Do(fail)
+	expectState(t, b, breaker.StateClosed)
+
+	_ = b.Do(fail)
+	expectState(t, b, breaker.StateOpen)
+
+	called := false
+	err := b.Do(func() error {
+		called = true
+		return nil
+	})
+	if called {
+		t.Error("open breaker must not call the dependency")
+	}
+	openErr, ok := breaker.AsOpenError(err)
+	if !ok || !errors.Is(err, breaker.ErrOpen) || openErr.Name != "postgres" || openErr.RetryAfter <= 0 {
+		t.Errorf("open breaker must fail fast with an OpenError, got %#v", err)
+	}
+
+	if value := testutil.ToFloat64(b.Metrics.State.WithLabelValues("postgres")); value != float64(breaker.StateOpen) {
+		t.Errorf("state gauge must be open, got %v", value)
+	}
+	if value := testutil.ToFloat64(b.Metrics.Rejected.WithLabelValues("postgres")); value != 1 {
+		t.Errorf("rejected counter must be 1, got %v", value)
+	}
+}
+
+func TestCircuitBreaker_HalfOpen(t *testing.T) {
+	b := newCircuitBreaker("redis")
+	b.HalfOpenProbes = 2
+	for i := 0; i < 3; i++ {
+		_ = b.Do(fail)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	expectState(t, b, breaker.StateHalfOpen)
+
+	// Only HalfOpenProbes trial calls are let through at once.
+	first, err := b.Allow()
+	if err != nil {
+		t.Fatalf("first trial call must be allowed: %v", err)
+	}
+	second, err := b.Allow()
+	if err != nil {
+		t.Fatalf("second trial call must be allowed: %v", err)
+	}
+	if _, err = b.Allow(); !errors.Is(err, breaker.ErrOpen) {
+		t.Fatalf("third trial call must be rejected, got %v", err)
+	}
+
+	first(nil)
+	expectState(t, b, breaker.StateHalfOpen)
+	second(nil)
+	expectState(t, b, breaker.StateClosed)
+
+	for to, expected := range map[string]float64{"open": 1, "half-open": 1, "closed": 1} {
+		if value := testutil.ToFloat64(b.Metrics.Transitions.WithLabelValues("redis", to)); value != expected {
+			t.Errorf("transitions to %s must be %v, got %v", to, expected, value)
+		}
+	}
+}
+
+func TestCircuitBreaker_HalfOpenFailure(t *testing.T) {
+	b := newCircuitBreaker("object_storage")
+	for i := 0; i < 3; i++ {
+		_ = b.Do(fail)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	_ = b.Do(fail)
+	expectState(t, b, breaker.StateOpen)
+
+	// A call that was let through before the breaker opened is not a trial call.
+	b = newCircuitBreaker("object_storage")
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatalf("call must be allowed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		_ = b.Do(fail)
+	}
+	time.Sleep(60 * time.Millisecond)
+	done(nil)
+	expectState(t, b, breaker.StateHalfOpen)
+}
+
+func TestCircuitBreaker_IsFailure(t *testing.T) {
+	errRejected := errors.New("signing service rejected the document")
+	b := newCircuitBreaker("esign")
+	b.IsFailure = func(err error) bool {
+		return breaker.IsFailure(err) && !errors.Is(err, errRejected)
+	}
+
+	for i := 0; i < 5; i++ {
+		_ = b.Do(func() error { return errRejected })
+		_ = b.Do(func() error { return context.Canceled })
+	}
+	expectState(t, b, breaker.StateClosed)
+}
+
+// awsError mimics the errors of the AWS SDK, which do not implement Unwrap.
+type awsError struct {
+	err error
+}
+
+func (e *awsError) Error() string {
+	return "RequestError: send request failed"
+}
+
+func (e *awsError) OrigErr() error {
+	return e.err
+}
+
+func TestAsOpenError(t *testing.T) {
+	openErr := &breaker.OpenError{Name: "object_storage"}
+	wrapped := &awsError{err: &url.Error{Op: "Put", URL: "http://ecs/bucket/a", Err: openErr}}
+	if found, ok := breaker.AsOpenError(fmt.Errorf("cannot put file: %w", wrapped)); !ok || found != openErr {
+		t.Error("OpenError must be found through OrigErr and Unwrap")
+	}
+	if _, ok := breaker.AsOpenError(&awsError{err: errDown}); ok {
+		t.Error("other errors must not be found")
+	}
+}
+
+func TestTransport(t *testing.T) {
+	status := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	b := newCircuitBreaker("object_storage")
+	client := &http.Client{Transport: &breaker.Transport{Breaker: b}}
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("request must reach the server: %v", err)
+		}
+		_ = resp.Body.Close()
+	}
+	expectState(t, b, breaker.StateOpen)
+
+	status = http.StatusNotFound
+	if _, err := client.Get(server.URL); !errors.Is(err, breaker.ErrOpen) {
+		t.Fatalf("request must fail fast, got %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	resp, err := client.Get(server.URL)
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("trial request must reach the server: %v", err)
+	}
+	_ = resp.Body.Close()
+	expectState(t, b, breaker.StateClosed)
+}
+
+// fakeConnector connects to a database that is down while err is not nil.
+type fakeConnector struct {
+	err     error
+	queries int
+}
+
+func (c *fakeConnector) Connect(_ context.Context) (driver.Conn, error) {
+	return &fakeConn{connector: c}, nil
+}
+
+func (c *fakeConnector) Driver() driver.Driver {
+	return nil
+}
+
+type fakeConn struct {
+	connector *fakeConnector
+}
+
+func (c *fakeConn) Prepare(_ string) (driver.Stmt, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.connector.queries++
+	if c.connector.err != nil {
+		return nil, c.connector.err
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeRows struct {
+	done bool
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"one"}
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+func TestConnector(t *testing.T) {
+	connector := &fakeConnector{}
+	b := newCircuitBreaker("reference_postgres")
+	db := sql.OpenDB(breaker.NewConnector(connector, b))
+	defer db.Close()
+
+	var one int
+	if err := db.QueryRow("select 1").Scan(&one); err != nil || one != 1 {
+		t.Fatalf("query must succeed: %v", err)
+	}
+
+	connector.err = errDown
+	for i := 0; i < 3; i++ {
+		if err := db.QueryRow("select 1").Scan(&one); !errors.Is(err, errDown) {
+			t.Fatalf("query must fail with the error of the database, got %v", err)
+		}
+	}
+	expectState(t, b, breaker.StateOpen)
+
+	err := db.QueryRow("select 1").Scan(&one)
+	if _, ok := breaker.AsOpenError(err); !ok {
+		t.Fatalf("query must fail fast, got %v", err)
+	}
+	if connector.queries != 4 {
+		t.Errorf("database must not be queried while the breaker is open, got %d queries", connector.queries)
+	}
+
+	connector.err = nil
+	time.Sleep(60 * time.Millisecond)
+	if err = db.PingContext(context.Background()); err != nil {
+		t.Fatalf("ping must succeed: %v", err)
+	}
+	if err = db.QueryRow("select 1").Scan(&one); err != nil {
+		t.Fatalf("trial query must succeed: %v", err)
+	}
+	expectState(t, b, breaker.StateClosed)
+}
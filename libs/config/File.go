@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// loadFile decodes a TOML or YAML configuration file, depending on its extension, into a map of upper-cased keys.
+// Values must be scalars or lists of scalars.
+func loadFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read configuration file: %w", err)
+	}
+
+	decoded := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		err = toml.Unmarshal(data, &decoded)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &decoded)
+	default:
+		return nil, fmt.Errorf("cannot read configuration file %s: extension must be .toml, .yaml or .yml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse configuration file %s: %v", path, err)
+	}
+
+	values := make(map[string]interface{}, len(decoded))
+	for key, value := range decoded {
+		name := strings.ToUpper(key)
+		if _, ok := values[name]; ok {
+			return nil, fmt.Errorf("%s is set more than once in %s", name, path)
+		}
+		if isNested(value) {
+			return nil, fmt.Errorf("%s in %s must be a value or a list of values, tables are not supported", name, path)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// isNested tells whether a decoded value is a table or a list containing tables.
+func isNested(value interface{}) bool {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return true
+	case []map[string]interface{}:
+		return true
+	case []interface{}:
+		for _, item := range value {
+			if isNested(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readValueFile reads the value of a _FILE configuration, without its trailing new lines.
+func readValueFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
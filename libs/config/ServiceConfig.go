@@ -13,7 +13,7 @@ import (
 // methods available in this class.
 //
 // To automatically parse configuration into a struct without having to use individual getters,
-// see ParseTo.
+// see ParseTo. The getters only read environment variables.
 type ServiceConfig struct {
 	// The Prefix is added to all the config name that is supplied in getter functions
 	// such as the GetString or through the use struct tags.
@@ -21,6 +21,9 @@ type ServiceConfig struct {
 	// The token to use to separate string in environment variables into array.
 	// Used by getters such as GetStringArray.
 	ArraySeparator string
+	// File is the path of a TOML (.toml) or YAML (.yaml or .yml) file read by ParseTo, whose keys are the config
+	// names without Prefix. Environment variables override it. Leave it empty to only read environment variables.
+	File string
 }
 
 func (sc ServiceConfig) getConfigName(name string) string {
@@ -121,81 +124,237 @@ func (sc ServiceConfig) GetFloat32WithDefault(name string, defaultValue float32)
 // When the environment variable does not exists, the field is skipped. This way you can supply a prefilled struct that
 // already have default values initialized. If the environment variable for the field does not exist (not configured
 // by administrator of the service), then default value is used.
+//
+// Each value is looked up, in order of precedence, in:
+//   - the environment variable, e.g. WEB_PORT,
+//   - the file named by the environment variable suffixed with _FILE, e.g. WEB_PORT_FILE, which is meant for secrets,
+//   - the key in File, e.g. PORT (keys are case-insensitive),
+//   - the file named by the key suffixed with _FILE in File, e.g. PORT_FILE.
+//
+// Setting both a value and its _FILE counterpart in the same place is an error. The content of the files of _FILE
+// is used without its trailing new lines.
+//
+// The tag can be followed by options separated by commas:
+//   - required: ParseTo fails if the field is still empty after parsing, e.g. `config:"DB_PASSWORD,required"`,
+//   - reload: the field is updated by Reload, e.g. `config:"CORS_ALLOWED_ORIGINS,reload"`.
 func (sc ServiceConfig) ParseTo(obj interface{}) error {
 	assertPointer(obj)
 
 	v := reflect.ValueOf(obj)
 	realV := reflect.Indirect(v)
-	t := realV.Type()
 
-	for i := 0; i < realV.NumField(); i++ {
-		tag, ok := t.Field(i).Tag.Lookup("config")
-		if !ok {
-			continue
+	var fileValues map[string]interface{}
+	if sc.File != "" {
+		var err error
+		fileValues, err = loadFile(sc.File)
+		if err != nil {
+			return err
 		}
+	}
 
-		switch realV.Field(i).Interface().(type) {
-		case int:
-			val, err := sc.GetInt(tag)
-			if err != nil {
-				if err == ErrConfigNotFound {
-					continue
-				}
+	var missing []string
+	for _, f := range fieldsOf(realV.Type()) {
+		err := sc.parseField(realV.Field(f.index), f.name, fileValues)
+		if err != nil {
+			return err
+		}
+		if f.required && isEmpty(realV.Field(f.index)) {
+			missing = append(missing, f.name)
+		}
+	}
 
-				return sc.reformatParseError(tag, err)
-			}
+	return sc.missingError(missing)
+}
 
-			realV.Field(i).Set(reflect.ValueOf(val))
-		case string:
-			val, err := sc.GetString(tag)
-			if err != nil {
-				if err == ErrConfigNotFound {
-					continue
-				}
+// Require returns an error listing the configurations of obj among names that are empty, e.g. to require
+// configurations only used by the selected backend. obj is a pointer to a struct parsed with ParseTo.
+func (sc ServiceConfig) Require(obj interface{}, names ...string) error {
+	assertPointer(obj)
+	realV := reflect.Indirect(reflect.ValueOf(obj))
 
-				return sc.reformatParseError(tag, err)
-			}
+	fields := make(map[string]*field)
+	for _, f := range fieldsOf(realV.Type()) {
+		fields[f.name] = f
+	}
+
+	var missing []string
+	for _, name := range names {
+		f, ok := fields[name]
+		if !ok {
+			return fmt.Errorf("%s_%s is not a configuration", sc.Prefix, name)
+		}
+		if isEmpty(realV.Field(f.index)) {
+			missing = append(missing, name)
+		}
+	}
 
-			realV.Field(i).Set(reflect.ValueOf(val))
-		case float32:
-			val, err := sc.GetFloat32(tag)
-			if err != nil {
-				if err == ErrConfigNotFound {
-					continue
-				}
+	return sc.missingError(missing)
+}
 
-				return sc.reformatParseError(tag, err)
-			}
+// parseField sets v with the value of the configuration name, if it is configured.
+func (sc ServiceConfig) parseField(v reflect.Value, name string, fileValues map[string]interface{}) error {
+	raw, ok, err := sc.lookupEnv(name)
+	if err != nil {
+		return err
+	}
+	if ok {
+		err = sc.setString(v, raw)
+		if err != nil {
+			return sc.reformatParseError(name, err)
+		}
+		return nil
+	}
 
-			realV.Field(i).Set(reflect.ValueOf(val))
-		case bool:
-			val, err := sc.GetBool(tag)
-			if err != nil {
-				if err == ErrConfigNotFound {
-					continue
-				}
+	value, ok, err := sc.lookupFile(name, fileValues)
+	if err != nil {
+		return err
+	}
+	if ok {
+		err = sc.setValue(v, value)
+		if err != nil {
+			return fmt.Errorf("cannot parse %s in %s: %v", name, sc.File, err)
+		}
+	}
+	return nil
+}
 
-				return sc.reformatParseError(tag, err)
-			}
+// lookupEnv looks up the environment variable of the configuration name, or the file named by its _FILE counterpart.
+func (sc ServiceConfig) lookupEnv(name string) (value string, ok bool, err error) {
+	envName := sc.getConfigName(name)
+	value, ok = os.LookupEnv(envName)
+	path, okFile := os.LookupEnv(envName + "_FILE")
+	if !okFile {
+		return value, ok, nil
+	}
+	if ok {
+		return "", false, fmt.Errorf("both %s and %s_FILE are set, only one of them can be", envName, envName)
+	}
 
-			realV.Field(i).Set(reflect.ValueOf(val))
-		case []string:
-			val, err := sc.GetStringArray(tag)
-			if err != nil {
-				if err == ErrConfigNotFound {
-					continue
-				}
+	value, err = readValueFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("cannot read %s_FILE: %v", envName, err)
+	}
+	return value, true, nil
+}
 
-				return sc.reformatParseError(tag, err)
-			}
+// lookupFile looks up the key of the configuration name in the values of File, or the file named by its _FILE
+// counterpart.
+func (sc ServiceConfig) lookupFile(name string, fileValues map[string]interface{}) (value interface{}, ok bool, err error) {
+	value, ok = fileValues[name]
+	path, okFile := fileValues[name+"_FILE"]
+	if !okFile {
+		return value, ok, nil
+	}
+	if ok {
+		return nil, false, fmt.Errorf("both %s and %s_FILE are set in %s, only one of them can be", name, name, sc.File)
+	}
+
+	pathString, isString := path.(string)
+	if !isString {
+		return nil, false, fmt.Errorf("%s_FILE in %s must be a path", name, sc.File)
+	}
+	value, err = readValueFile(pathString)
+	if err != nil {
+		return nil, false, fmt.Errorf("cannot read %s_FILE in %s: %v", name, sc.File, err)
+	}
+	return value, true, nil
+}
 
-			realV.Field(i).Set(reflect.ValueOf(val))
+// setString sets v with a value formatted as in environment variables.
+func (sc ServiceConfig) setString(v reflect.Value, raw string) error {
+	switch v.Interface().(type) {
+	case int:
+		val, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
 		}
+		v.Set(reflect.ValueOf(val))
+	case string:
+		v.Set(reflect.ValueOf(raw))
+	case float32:
+		val, err := strconv.ParseFloat(raw, 32)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(float32(val)))
+	case bool:
+		val, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(val))
+	case []string:
+		v.Set(reflect.ValueOf(strings.Split(raw, sc.ArraySeparator)))
+	}
+	return nil
+}
+
+// setValue sets v with a value decoded from File. Strings are parsed as in environment variables.
+func (sc ServiceConfig) setValue(v reflect.Value, value interface{}) error {
+	if raw, ok := value.(string); ok {
+		return sc.setString(v, raw)
 	}
 
+	switch v.Interface().(type) {
+	case int:
+		number, ok := toFloat(value)
+		if !ok || number != float64(int(number)) {
+			return fmt.Errorf("%v is not an integer", value)
+		}
+		v.Set(reflect.ValueOf(int(number)))
+	case string:
+		if _, ok := toFloat(value); !ok {
+			if _, ok = value.(bool); !ok {
+				return fmt.Errorf("%v is not a string", value)
+			}
+		}
+		v.Set(reflect.ValueOf(fmt.Sprint(value)))
+	case float32:
+		number, ok := toFloat(value)
+		if !ok {
+			return fmt.Errorf("%v is not a number", value)
+		}
+		v.Set(reflect.ValueOf(float32(number)))
+	case bool:
+		val, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("%v is not a boolean", value)
+		}
+		v.Set(reflect.ValueOf(val))
+	case []string:
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%v is not a list", value)
+		}
+		val := make([]string, 0, len(items))
+		for _, item := range items {
+			if _, isList := item.([]interface{}); isList {
+				return fmt.Errorf("%v is not a list of values", value)
+			}
+			val = append(val, fmt.Sprint(item))
+		}
+		v.Set(reflect.ValueOf(val))
+	}
 	return nil
 }
 
+// missingError returns an error listing the missing configurations, or nil if there are none.
+func (sc ServiceConfig) missingError(missing []string) error {
+	if len(missing) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(missing))
+	for _, name := range missing {
+		names = append(names, sc.getConfigName(name))
+	}
+	where := "set them as environment variables, or in the files named by their _FILE environment variables"
+	if sc.File != "" {
+		where += ", or in " + sc.File
+	}
+	return fmt.Errorf("%w: %s, %s", ErrConfigRequired, strings.Join(names, ", "), where)
+}
+
 func (sc ServiceConfig) reformatParseError(name string, err error) error {
 	return fmt.Errorf("cannot parse %s_%s: %v", sc.Prefix, name, err)
 }
@@ -206,3 +365,96 @@ func assertPointer(value interface{}) {
 		panic("given value is not a pointer, or nil")
 	}
 }
+
+// Reload parses the configuration again into fresh, a pointer to a struct of the same type as current filled with
+// default values. The fields of current tagged with the reload option whose values have changed are then set from
+// fresh and their names returned in reloaded. The names of the other fields that have changed are returned in
+// restartRequired, they only take effect after a restart. current is left untouched if parsing fails.
+//
+// Environment variables cannot change for a running process, so only File and the files of _FILE configurations
+// can change the configuration. Reload is not safe for concurrent use with readers of the reloaded fields, setting
+// them where they are used is up to the caller.
+func (sc ServiceConfig) Reload(current interface{}, fresh interface{}) (reloaded []string, restartRequired []string, err error) {
+	assertPointer(current)
+	assertPointer(fresh)
+	currentV := reflect.Indirect(reflect.ValueOf(current))
+	freshV := reflect.Indirect(reflect.ValueOf(fresh))
+	if currentV.Type() != freshV.Type() {
+		panic("current and fresh configurations are not of the same type")
+	}
+
+	err = sc.ParseTo(fresh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, f := range fieldsOf(currentV.Type()) {
+		if reflect.DeepEqual(currentV.Field(f.index).Interface(), freshV.Field(f.index).Interface()) {
+			continue
+		}
+		if !f.reload {
+			restartRequired = append(restartRequired, f.name)
+			continue
+		}
+		currentV.Field(f.index).Set(freshV.Field(f.index))
+		reloaded = append(reloaded, f.name)
+	}
+	return reloaded, restartRequired, nil
+}
+
+// field is a struct field tagged with `config`.
+type field struct {
+	index    int
+	name     string
+	required bool
+	reload   bool
+}
+
+// fieldsOf returns the fields of the struct type t tagged with `config`, with their options.
+func fieldsOf(t reflect.Type) []*field {
+	var fields []*field
+	for i := 0; i < t.NumField(); i++ {
+		tag, ok := t.Field(i).Tag.Lookup("config")
+		if !ok {
+			continue
+		}
+
+		options := strings.Split(tag, ",")
+		f := &field{index: i, name: options[0]}
+		for _, option := range options[1:] {
+			switch option {
+			case "required":
+				f.required = true
+			case "reload":
+				f.reload = true
+			default:
+				panic(fmt.Sprintf("unknown option %s in config tag of %s", option, t.Field(i).Name))
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// isEmpty tells whether v holds the zero value of its type, or an empty list.
+func isEmpty(v reflect.Value) bool {
+	if v.Kind() == reflect.Slice {
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// toFloat converts the numbers decoded from TOML and YAML files.
+func toFloat(value interface{}) (float64, bool) {
+	switch value := value.(type) {
+	case int:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case uint64:
+		return float64(value), true
+	case float64:
+		return value, true
+	}
+	return 0, false
+}
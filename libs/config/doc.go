@@ -1,9 +1,11 @@
-// Package config provides functions for interacting with configurations
-// and a server that listen for requests to change configurations on runtime
+// Package config provides functions for interacting with configurations read from environment variables and
+// TOML or YAML files, and for reloading them on runtime.
 package config
 
 import "errors"
 
 var (
 	ErrConfigNotFound = errors.New("no configuration match with key")
+	// ErrConfigRequired is wrapped by the errors listing required configurations that are not set.
+	ErrConfigRequired = errors.New("missing required configuration")
 )
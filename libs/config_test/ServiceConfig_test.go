@@ -1,11 +1,14 @@
 package config_test
 
 import (
+	"errors"
 	"fmt"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/config"
 	"log"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -67,6 +70,158 @@ func TestServiceConfig_ParseTo(t *testing.T) {
 	}
 }
 
+type fileConfig struct {
+	Port      int      `config:"PORT"`
+	Host      string   `config:"HOST,required"`
+	Secret    string   `config:"SECRET,required"`
+	Ratio     float32  `config:"RATIO"`
+	Debug     bool     `config:"DEBUG"`
+	Origins   []string `config:"ORIGINS,reload"`
+	LogLevel  string   `config:"LOG_LEVEL,reload"`
+	Untouched string   `config:"UNTOUCHED"`
+}
+
+// writeFile writes content in a file named name in a temporary directory, and returns its path.
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestServiceConfig_ParseTo_File(t *testing.T) {
+	secretPath := writeFile(t, "secret", "s3cr3t\n")
+	files := map[string]string{
+		"service.yaml": "port: 8080\nHOST: example.com\nsecret_file: " + secretPath + "\nratio: 0.5\ndebug: true\norigins: [https://a.example.com, https://b.example.com]\n",
+		"service.toml": "port = 8080\nHOST = \"example.com\"\nsecret_file = \"" + secretPath + "\"\nratio = 0.5\ndebug = true\norigins = [\"https://a.example.com\", \"https://b.example.com\"]\n",
+	}
+
+	expect := &fileConfig{
+		Port:    8080,
+		Host:    "example.com",
+		Secret:  "s3cr3t",
+		Ratio:   0.5,
+		Debug:   true,
+		Origins: []string{"https://a.example.com", "https://b.example.com"},
+	}
+	for name, content := range files {
+		sc := config.ServiceConfig{Prefix: "FILE", ArraySeparator: " ", File: writeFile(t, name, content)}
+		n := &fileConfig{}
+		err := sc.ParseTo(n)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(expect, n) {
+			t.Errorf("%s: decoded config is not the same with expectation, received: %v, expected: %v", name, n, expect)
+		}
+	}
+}
+
+func TestServiceConfig_ParseTo_EnvOverridesFile(t *testing.T) {
+	sc := config.ServiceConfig{
+		Prefix:         "OVERRIDE",
+		ArraySeparator: " ",
+		File:           writeFile(t, "service.yml", "port: 8080\nhost: example.com\nsecret: from-file\norigins: https://a.example.com https://b.example.com\n"),
+	}
+	t.Setenv("OVERRIDE_PORT", "9090")
+	t.Setenv("OVERRIDE_SECRET_FILE", writeFile(t, "secret", "from-env-file\r\n"))
+
+	n := &fileConfig{}
+	err := sc.ParseTo(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Port != 9090 || n.Host != "example.com" || n.Secret != "from-env-file" {
+		t.Errorf("environment variables must override the file, received: %v", n)
+	}
+	if !reflect.DeepEqual(n.Origins, []string{"https://a.example.com", "https://b.example.com"}) {
+		t.Errorf("string lists in files must be split like environment variables, received: %v", n.Origins)
+	}
+}
+
+func TestServiceConfig_ParseTo_Errors(t *testing.T) {
+	sc := config.ServiceConfig{Prefix: "BOTH", ArraySeparator: " "}
+	t.Setenv("BOTH_HOST", "example.com")
+	t.Setenv("BOTH_SECRET", "s3cr3t")
+	t.Setenv("BOTH_SECRET_FILE", "/run/secrets/secret")
+	err := sc.ParseTo(&fileConfig{})
+	if err == nil || !strings.Contains(err.Error(), "BOTH_SECRET and BOTH_SECRET_FILE") {
+		t.Errorf("setting a config and its _FILE must fail, received: %v", err)
+	}
+
+	tests := map[string]string{
+		"nested.yaml":  "host:\n  name: example.com\n",
+		"invalid.toml": "port = \"eighty\"\n",
+		"float.yaml":   "port: 80.5\n",
+		"service.json": "{}",
+	}
+	for name, content := range tests {
+		sc = config.ServiceConfig{Prefix: "INVALID", ArraySeparator: " ", File: writeFile(t, name, content)}
+		err = sc.ParseTo(&fileConfig{})
+		if err == nil || errors.Is(err, config.ErrConfigRequired) {
+			t.Errorf("%s: parsing must fail, received: %v", name, err)
+		}
+	}
+}
+
+func TestServiceConfig_ParseTo_Required(t *testing.T) {
+	sc := config.ServiceConfig{Prefix: "REQUIRED", ArraySeparator: " ", File: writeFile(t, "service.yaml", "port: 80\n")}
+	err := sc.ParseTo(&fileConfig{})
+	if !errors.Is(err, config.ErrConfigRequired) {
+		t.Fatalf("missing required configs must fail with ErrConfigRequired, received: %v", err)
+	}
+	if !strings.Contains(err.Error(), "REQUIRED_HOST, REQUIRED_SECRET") || !strings.Contains(err.Error(), sc.File) {
+		t.Errorf("error must list every missing config and the file, received: %v", err)
+	}
+
+	n := &fileConfig{Host: "example.com", Secret: "s3cr3t"}
+	err = sc.ParseTo(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sc.Require(n, "PORT", "UNTOUCHED", "ORIGINS")
+	if !errors.Is(err, config.ErrConfigRequired) || !strings.Contains(err.Error(), "REQUIRED_UNTOUCHED, REQUIRED_ORIGINS,") {
+		t.Errorf("Require must list the empty configs, received: %v", err)
+	}
+}
+
+func TestServiceConfig_Reload(t *testing.T) {
+	sc := config.ServiceConfig{Prefix: "RELOAD", ArraySeparator: " ", File: writeFile(t, "service.toml", "host = \"example.com\"\nsecret = \"s3cr3t\"\nlog_level = \"info\"\n")}
+	current := &fileConfig{}
+	err := sc.ParseTo(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(sc.File, []byte("host = \"other.example.com\"\nsecret = \"s3cr3t\"\nlog_level = \"warn\"\norigins = [\"https://a.example.com\"]\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded, restartRequired, err := sc.Reload(current, &fileConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reloaded, []string{"ORIGINS", "LOG_LEVEL"}) || !reflect.DeepEqual(restartRequired, []string{"HOST"}) {
+		t.Errorf("unexpected reloaded %v and restart required %v configs", reloaded, restartRequired)
+	}
+	expect := &fileConfig{Host: "example.com", Secret: "s3cr3t", LogLevel: "warn", Origins: []string{"https://a.example.com"}}
+	if !reflect.DeepEqual(expect, current) {
+		t.Errorf("only reloadable configs must be updated, received: %v, expected: %v", current, expect)
+	}
+
+	err = os.WriteFile(sc.File, []byte("log_level = \"error\"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = sc.Reload(current, &fileConfig{})
+	if !errors.Is(err, config.ErrConfigRequired) || current.LogLevel != "warn" {
+		t.Errorf("an invalid configuration must not be reloaded, received: %v", err)
+	}
+}
+
 func ExampleServiceConfig_ParseTo() {
 	type MyConfig struct {
 		Port         int      `config:"PORT"`
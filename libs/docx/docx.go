@@ -2,11 +2,19 @@ package docx
 
 import (
 	"context"
+	"errors"
+)
+
+var (
+	ErrSaveTemplateToDocx = errors.New("cannot save template to docx")
+	ErrLoadTemplate       = errors.New("cannot load template")
+	// ErrBadTemplate is returned if a template has incorrect syntax, e.g. a placeholder with spaces between two words.
+	ErrBadTemplate = errors.New("bad syntax in template")
 )
 
 // Renderer provides the capability to render docx documents cluttered with jinja2 templates into a docx document
-// or pdf, given a set of data. The default implementation uses siasn-docx script to render docx template into docx
-// document and uses soffice command from LibreOffice to render docx document into pdf.
+// or pdf, given a set of data. SiasnRenderer uses siasn-docx script to render docx template into docx document,
+// NativeRenderer renders it in process. Both use soffice command from LibreOffice to render docx document into pdf.
 type Renderer interface {
 	// Render renders a template located with templatePath into another docx document saved in outputPath.
 	// It should overwrite existing file in outputPath. Will not throw any error if data does not contain any
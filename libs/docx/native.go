@@ -0,0 +1,380 @@
+package docx
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ErrPdfConversionDisabled is returned by NativeRenderer.RenderAsPdf if no soffice command is set.
+var ErrPdfConversionDisabled = errors.New("pdf conversion is disabled, soffice command is not set")
+
+const (
+	contentTypesPath = "[Content_Types].xml"
+	relsType         = "application/vnd.openxmlformats-package.relationships+xml"
+	imageRelType     = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/image"
+	// emuPerMm is the number of English Metric Units, the unit of drawing sizes, in a millimeter.
+	emuPerMm = 36000
+	// emuPerPx is the number of English Metric Units in a pixel at 96 DPI.
+	emuPerPx = 9525
+)
+
+// templatePartRegexp matches the parts of a document that can contain placeholders.
+var templatePartRegexp = regexp.MustCompile(`^word/(document|header[0-9]*|footer[0-9]*)\.xml$`)
+
+// NativeRenderer renders docx templates in process, without siasn-docx script. It supports the subset of jinja2
+// templates used by our templates:
+//   - {{ name }} and {{ name.field }} placeholders,
+//   - {% for x in items %} ... {% endfor %} loops, with loop.index, loop.index0, loop.first and loop.last,
+//   - {% if [not] name %} ... {% else %} ... {% endif %} conditions,
+//   - {%tr ... %} and {%p ... %} statements, which replace their table row or paragraph, to repeat table rows,
+//   - InlineImage values.
+//
+// Just like SiasnRenderer, data is encoded into JSON first, so the given render data can implement the
+// json.Marshaler interface.
+//
+// Rendering a docx document into pdf still uses soffice command.
+type NativeRenderer struct {
+	// The soffice command path.
+	// Can be full path or just command name, if it exists in PATH.
+	// If empty, RenderAsPdf returns ErrPdfConversionDisabled.
+	SofficeCmd string
+	// Additional run arguments to be passed to soffice command at the end of the default arguments.
+	SofficeArgs []string
+}
+
+// NewNativeRenderer creates a default NativeRenderer with soffice command assumed to be installed and can be called
+// in PATH.
+//
+// To create NativeRenderer with custom command path, or without pdf conversion, create it manually.
+func NewNativeRenderer() *NativeRenderer {
+	return &NativeRenderer{
+		SofficeCmd: "soffice",
+	}
+}
+
+func (n *NativeRenderer) Render(data interface{}, templatePath string, outputPath string) (err error) {
+	return n.RenderCtx(context.Background(), data, templatePath, outputPath)
+}
+
+func (n *NativeRenderer) RenderCtx(ctx context.Context, data interface{}, templatePath string, outputPath string) (err error) {
+	if templatePath == "" {
+		panic("templatePath cannot be nil")
+	}
+
+	if outputPath == "" {
+		panic("outputPath cannot be nil")
+	}
+
+	values, err := decodeRenderData(data)
+	if err != nil {
+		return err
+	}
+
+	reader, err := zip.OpenReader(path.Clean(templatePath))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrLoadTemplate, err)
+	}
+	defer reader.Close()
+
+	doc := &nativeDocument{
+		parts: make(map[string][]byte),
+		files: make(map[string]*zip.File),
+	}
+	for _, file := range reader.File {
+		doc.files[file.Name] = file
+		doc.order = append(doc.order, file.Name)
+	}
+
+	for _, name := range doc.order {
+		if !templatePartRegexp.MatchString(name) {
+			continue
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		err = doc.renderPart(name, values)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = doc.save(path.Clean(outputPath))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrSaveTemplateToDocx, err)
+	}
+
+	return nil
+}
+
+func (n *NativeRenderer) RenderAsPdf(data interface{}, templatePath string, outputPath string) (err error) {
+	return n.RenderAsPdfCtx(context.Background(), data, templatePath, outputPath)
+}
+
+func (n *NativeRenderer) RenderAsPdfCtx(ctx context.Context, data interface{}, templatePath string, outputPath string) (err error) {
+	if n.SofficeCmd == "" {
+		return ErrPdfConversionDisabled
+	}
+	return renderAsPdfCtx(ctx, n, n.SofficeCmd, n.SofficeArgs, data, templatePath, outputPath)
+}
+
+// decodeRenderData encodes data into JSON and decodes it back into generic values, the same way siasn-docx sees it.
+func decodeRenderData(data interface{}) (values map[string]interface{}, err error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	values = make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	err = decoder.Decode(&values)
+	if err != nil {
+		return nil, fmt.Errorf("render data must be encoded into a JSON object: %w", err)
+	}
+	return values, nil
+}
+
+// nativeDocument is a docx template being rendered. Parts that are changed are kept in memory, the rest are copied
+// from the template as is.
+type nativeDocument struct {
+	files map[string]*zip.File
+	// order is the order of the files in the template, kept in the output.
+	order []string
+	// parts are the changed and added parts.
+	parts map[string][]byte
+	// images counts the added images, to name them uniquely.
+	images int
+}
+
+// readPart reads a part, the changed version if it has been changed. It returns nil if the part does not exist.
+func (d *nativeDocument) readPart(name string) (content []byte, err error) {
+	if content, ok := d.parts[name]; ok {
+		return content, nil
+	}
+
+	file, ok := d.files[name]
+	if !ok {
+		return nil, nil
+	}
+
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+// writePart changes or adds a part.
+func (d *nativeDocument) writePart(name string, content []byte) {
+	if _, ok := d.parts[name]; !ok {
+		if _, ok = d.files[name]; !ok {
+			d.order = append(d.order, name)
+		}
+	}
+	d.parts[name] = content
+}
+
+func (d *nativeDocument) renderPart(name string, values map[string]interface{}) (err error) {
+	content, err := d.readPart(name)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrLoadTemplate, err)
+	}
+
+	part := normalizeRuns(string(content))
+	part, err = expandElementTags(part)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := parseTemplate(part)
+	if err != nil {
+		return err
+	}
+
+	ctx := &executeContext{
+		buffer: &bytes.Buffer{},
+		image: func(image *InlineImage) (xml string, err error) {
+			return d.addImage(name, image)
+		},
+	}
+	scope := &templateScope{values: values}
+	for _, node := range nodes {
+		err = node.execute(ctx, scope)
+		if err != nil {
+			return err
+		}
+	}
+
+	d.writePart(name, ctx.buffer.Bytes())
+	return nil
+}
+
+// addImage adds the image of an InlineImage to the document and relates it to the part, then returns the drawing
+// that shows it. The drawing closes and reopens the text element of the placeholder.
+func (d *nativeDocument) addImage(partName string, inlineImage *InlineImage) (xml string, err error) {
+	content, err := ioutil.ReadFile(inlineImage.ImageDescriptor)
+	if err != nil {
+		return "", fmt.Errorf("cannot read inline image: %w", err)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return "", fmt.Errorf("cannot decode inline image %s: %w", inlineImage.ImageDescriptor, err)
+	}
+	if format == "jpeg" {
+		format = "jpg"
+	}
+
+	d.images++
+	mediaName := fmt.Sprintf("media/siasn-image%d.%s", d.images, format)
+	d.writePart("word/"+mediaName, content)
+
+	err = d.addContentType(format, "image/"+strings.Replace(format, "jpg", "jpeg", 1))
+	if err != nil {
+		return "", err
+	}
+
+	relId, err := d.addRelationship(partName, mediaName)
+	if err != nil {
+		return "", err
+	}
+
+	width, height := int64(config.Width)*emuPerPx, int64(config.Height)*emuPerPx
+	switch {
+	case inlineImage.Width > 0 && inlineImage.Height > 0:
+		width, height = int64(inlineImage.Width*emuPerMm), int64(inlineImage.Height*emuPerMm)
+	case inlineImage.Width > 0:
+		// Keep the aspect ratio if only one side is specified.
+		height = height * int64(inlineImage.Width*emuPerMm) / width
+		width = int64(inlineImage.Width * emuPerMm)
+	case inlineImage.Height > 0:
+		width = width * int64(inlineImage.Height*emuPerMm) / height
+		height = int64(inlineImage.Height * emuPerMm)
+	}
+
+	return fmt.Sprintf(`</w:t><w:drawing><wp:inline xmlns:wp="http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing" distT="0" distB="0" distL="0" distR="0">`+
+		`<wp:extent cx="%[1]d" cy="%[2]d"/><wp:docPr id="%[3]d" name="Picture %[3]d"/>`+
+		`<a:graphic xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main"><a:graphicData uri="http://schemas.openxmlformats.org/drawingml/2006/picture">`+
+		`<pic:pic xmlns:pic="http://schemas.openxmlformats.org/drawingml/2006/picture">`+
+		`<pic:nvPicPr><pic:cNvPr id="%[3]d" name="%[4]s"/><pic:cNvPicPr/></pic:nvPicPr>`+
+		`<pic:blipFill><a:blip xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" r:embed="%[5]s"/><a:stretch><a:fillRect/></a:stretch></pic:blipFill>`+
+		`<pic:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="%[1]d" cy="%[2]d"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></pic:spPr>`+
+		`</pic:pic></a:graphicData></a:graphic></wp:inline></w:drawing><w:t xml:space="preserve">`,
+		width, height, 1000+d.images, path.Base(mediaName), relId), nil
+}
+
+// addContentType adds a default content type of an extension, if it does not exist yet.
+func (d *nativeDocument) addContentType(extension string, contentType string) (err error) {
+	content, err := d.readPart(contentTypesPath)
+	if err != nil || content == nil {
+		return fmt.Errorf("%w: cannot read %s", ErrLoadTemplate, contentTypesPath)
+	}
+
+	types := string(content)
+	if strings.Contains(strings.ToLower(types), fmt.Sprintf(`extension="%s"`, extension)) {
+		return nil
+	}
+
+	end := strings.LastIndex(types, "</Types>")
+	if end < 0 {
+		return fmt.Errorf("%w: bad %s", ErrLoadTemplate, contentTypesPath)
+	}
+	types = types[:end] + fmt.Sprintf(`<Default Extension="%s" ContentType="%s"/>`, extension, contentType) + types[end:]
+	d.writePart(contentTypesPath, []byte(types))
+	return nil
+}
+
+// addRelationship relates an image to a part, creating the relationships part if it does not exist yet. It returns
+// the ID of the relationship.
+func (d *nativeDocument) addRelationship(partName string, target string) (id string, err error) {
+	relsName := path.Join(path.Dir(partName), "_rels", path.Base(partName)+".rels")
+	content, err := d.readPart(relsName)
+	if err != nil {
+		return "", fmt.Errorf("%w: cannot read %s", ErrLoadTemplate, relsName)
+	}
+
+	rels := string(content)
+	if content == nil {
+		rels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"></Relationships>`
+		err = d.addContentType("rels", relsType)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	end := strings.LastIndex(rels, "</Relationships>")
+	if end < 0 {
+		return "", fmt.Errorf("%w: bad %s", ErrLoadTemplate, relsName)
+	}
+
+	id = fmt.Sprintf("rIdSiasnImage%d", d.images)
+	rels = rels[:end] + fmt.Sprintf(`<Relationship Id="%s" Type="%s" Target="%s"/>`, id, imageRelType, target) + rels[end:]
+	d.writePart(relsName, []byte(rels))
+	return id, nil
+}
+
+// save writes the document into a docx file.
+func (d *nativeDocument) save(outputPath string) (err error) {
+	output, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	defer output.Close()
+
+	writer := zip.NewWriter(output)
+	for _, name := range d.order {
+		err = d.saveFile(writer, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+	return output.Close()
+}
+
+func (d *nativeDocument) saveFile(writer *zip.Writer, name string) (err error) {
+	content, changed := d.parts[name]
+	if !changed {
+		file := d.files[name]
+		reader, err := file.Open()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		w, err := writer.CreateHeader(&zip.FileHeader{Name: name, Method: file.Method, Modified: file.Modified})
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, reader)
+		return err
+	}
+
+	w, err := writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
@@ -10,8 +10,9 @@ import "encoding/json"
 //
 // ImageDescriptor field must not be empty for this to be a valid InlineImage.
 type InlineImage struct {
-	// Path to the image that will be loaded by the siasn-docx script.
+	// Path to the image that will be loaded by the siasn-docx script or NativeRenderer.
 	ImageDescriptor string
+	// The size in millimeters.
 	// Must be a positive value, negative or 0 will be ignored.
 	// If unspecified (0 or negative), the width of the image will be the same as the original image.
 	Width float32
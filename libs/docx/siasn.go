@@ -6,18 +6,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"os"
 	"os/exec"
 	"path"
-	"path/filepath"
-	"strings"
 )
 
+// The errors of SiasnRenderer are the same as the generic errors, so that they can be checked regardless of the
+// renderer.
 var (
-	ErrSiasnRendererSaveTemplateToDocx = errors.New("cannot save template to docx")
-	ErrSiasnRendererLoadTemplate       = errors.New("cannot load template")
-	ErrSiasnRendererBadTemplate        = errors.New("bad syntax in template")
+	ErrSiasnRendererSaveTemplateToDocx = ErrSaveTemplateToDocx
+	ErrSiasnRendererLoadTemplate       = ErrLoadTemplate
+	ErrSiasnRendererBadTemplate        = ErrBadTemplate
 )
 
 const (
@@ -123,65 +121,5 @@ func (s *SiasnRenderer) RenderAsPdf(data interface{}, templatePath string, outpu
 }
 
 func (s *SiasnRenderer) RenderAsPdfCtx(ctx context.Context, data interface{}, templatePath string, outputPath string) (err error) {
-	tmpDir := os.TempDir()
-	tmpOutputBasename := fmt.Sprintf("compiled-%s", path.Base(templatePath))
-	tmpOutputPath := path.Join(tmpDir, tmpOutputBasename)
-	// Try to delete tmp output regardless if it exists or not
-	defer os.Remove(tmpOutputPath)
-
-	err = s.RenderCtx(ctx, data, templatePath, tmpOutputPath)
-	if err != nil {
-		return err
-	}
-
-	tmpOutputBasenameNoExt := strings.TrimSuffix(tmpOutputBasename, filepath.Ext(tmpOutputBasename))
-	pdfTmpOutputPath := path.Join(tmpDir, fmt.Sprintf("%s.pdf", tmpOutputBasenameNoExt))
-
-	args := []string{"--convert-to", "pdf", "--headless", "--outdir", tmpDir, tmpOutputPath}
-	args = append(args, s.SofficeArgs...)
-	cmd := exec.CommandContext(ctx, s.SofficeCmd, args...)
-	err = cmd.Run()
-	if err != nil {
-		return err
-	}
-
-	cleanOutputPath := path.Clean(outputPath)
-	err = os.Rename(pdfTmpOutputPath, cleanOutputPath)
-	if err != nil {
-		linkError := &os.LinkError{}
-		if errors.As(err, &linkError) { // Retry with manual copying
-			err = s.manualMoveFile(cleanOutputPath, pdfTmpOutputPath)
-			if err != nil {
-				return err
-			}
-		}
-		return err
-	}
-
-	return nil
-}
-
-// manualMoveFile does a manual file move/rename by copying the file and deleting the source.
-// It is used when os.Rename cannot be used, for example, moving between partitions.
-func (s *SiasnRenderer) manualMoveFile(dst string, src string) (err error) {
-	srcFile, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer os.Remove(src)
-	defer srcFile.Close()
-
-	dstFile, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer dstFile.Close()
-
-	buffer := make([]byte, 4*1024)
-	_, err = io.CopyBuffer(dstFile, srcFile, buffer)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return renderAsPdfCtx(ctx, s, s.SofficeCmd, s.SofficeArgs, data, templatePath, outputPath)
 }
@@ -0,0 +1,79 @@
+package docx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// renderAsPdfCtx renders a template with renderer into a temporary docx document, then converts it into pdf with
+// the soffice command and moves it to outputPath.
+func renderAsPdfCtx(ctx context.Context, renderer Renderer, sofficeCmd string, sofficeArgs []string, data interface{}, templatePath string, outputPath string) (err error) {
+	tmpDir := os.TempDir()
+	tmpOutputBasename := fmt.Sprintf("compiled-%s", path.Base(templatePath))
+	tmpOutputPath := path.Join(tmpDir, tmpOutputBasename)
+	// Try to delete tmp output regardless if it exists or not
+	defer os.Remove(tmpOutputPath)
+
+	err = renderer.RenderCtx(ctx, data, templatePath, tmpOutputPath)
+	if err != nil {
+		return err
+	}
+
+	tmpOutputBasenameNoExt := strings.TrimSuffix(tmpOutputBasename, filepath.Ext(tmpOutputBasename))
+	pdfTmpOutputPath := path.Join(tmpDir, fmt.Sprintf("%s.pdf", tmpOutputBasenameNoExt))
+
+	args := []string{"--convert-to", "pdf", "--headless", "--outdir", tmpDir, tmpOutputPath}
+	args = append(args, sofficeArgs...)
+	cmd := exec.CommandContext(ctx, sofficeCmd, args...)
+	err = cmd.Run()
+	if err != nil {
+		return err
+	}
+
+	cleanOutputPath := path.Clean(outputPath)
+	err = os.Rename(pdfTmpOutputPath, cleanOutputPath)
+	if err != nil {
+		linkError := &os.LinkError{}
+		if errors.As(err, &linkError) { // Retry with manual copying
+			err = manualMoveFile(cleanOutputPath, pdfTmpOutputPath)
+			if err != nil {
+				return err
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// manualMoveFile does a manual file move/rename by copying the file and deleting the source.
+// It is used when os.Rename cannot be used, for example, moving between partitions.
+func manualMoveFile(dst string, src string) (err error) {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(src)
+	defer srcFile.Close()
+
+	dstFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	buffer := make([]byte, 4*1024)
+	_, err = io.CopyBuffer(dstFile, srcFile, buffer)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,424 @@
+package docx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// paragraphRegexp matches a paragraph, but not an empty self-closing one.
+	paragraphRegexp = regexp.MustCompile(`(?s)<w:p(?:>|\s[^>]*[^/]>).*?</w:p>`)
+	// textRegexp matches a text element of a run, its opening tag, content and closing tag.
+	textRegexp = regexp.MustCompile(`(<w:t(?:>|\s[^>]*>))([^<]*)(</w:t>)`)
+	// tagRegexp matches a placeholder or a statement.
+	tagRegexp = regexp.MustCompile(`(?s)\{\{(.*?)\}\}|\{%(.*?)%\}`)
+	// elementTagRegexp matches a statement that replaces its table row or paragraph, e.g. {%tr for x in y %}.
+	elementTagRegexp = regexp.MustCompile(`(?s)\{%(tr|p)\s(.*?)%\}`)
+	pathRegexp       = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z0-9_]+)*$`)
+	identRegexp      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// normalizeRuns moves every tag split across several text elements of a paragraph into the text element where it
+// starts. Word splits text into runs freely, e.g. when spell checking, so a placeholder typed at once is often split.
+// Text elements containing a tag preserve their spaces.
+func normalizeRuns(part string) string {
+	return paragraphRegexp.ReplaceAllStringFunc(part, func(paragraph string) string {
+		if !strings.Contains(paragraph, "{") {
+			return paragraph
+		}
+
+		texts := textRegexp.FindAllStringSubmatchIndex(paragraph, -1)
+		if len(texts) == 0 {
+			return paragraph
+		}
+
+		full := &strings.Builder{}
+		owners := make([]int, 0, len(paragraph))
+		for i, text := range texts {
+			full.WriteString(paragraph[text[4]:text[5]])
+			for j := text[4]; j < text[5]; j++ {
+				owners = append(owners, i)
+			}
+		}
+
+		for _, tag := range tagRegexp.FindAllStringIndex(full.String(), -1) {
+			for j := tag[0]; j < tag[1]; j++ {
+				owners[j] = owners[tag[0]]
+			}
+		}
+
+		contents := make([]*strings.Builder, len(texts))
+		for i := range contents {
+			contents[i] = &strings.Builder{}
+		}
+		fullText := full.String()
+		for j := 0; j < len(fullText); j++ {
+			// Text elements and tags hold whole characters, so the bytes of a character always have the same owner.
+			contents[owners[j]].WriteByte(fullText[j])
+		}
+
+		result := &strings.Builder{}
+		last := 0
+		for i, text := range texts {
+			content := contents[i].String()
+			result.WriteString(paragraph[last:text[0]])
+			if tagRegexp.MatchString(content) {
+				result.WriteString(`<w:t xml:space="preserve">`)
+			} else {
+				result.WriteString(paragraph[text[2]:text[3]])
+			}
+			result.WriteString(content)
+			result.WriteString(paragraph[text[6]:text[7]])
+			last = text[1]
+		}
+		result.WriteString(paragraph[last:])
+		return result.String()
+	})
+}
+
+// expandElementTags replaces the table row or the paragraph of every {%tr ... %} and {%p ... %} statement with the
+// statement itself, so that the statement repeats or hides whole rows or paragraphs.
+func expandElementTags(part string) (string, error) {
+	for {
+		loc := elementTagRegexp.FindStringSubmatchIndex(part)
+		if loc == nil {
+			return part, nil
+		}
+
+		element := part[loc[2]:loc[3]]
+		start := lastIndexElementStart(part[:loc[0]], element)
+		end := strings.Index(part[loc[1]:], "</w:"+element+">")
+		if start < 0 || end < 0 {
+			return "", fmt.Errorf("%w: %s is not in a w:%s element", ErrBadTemplate, html.UnescapeString(part[loc[0]:loc[1]]), element)
+		}
+		end += loc[1] + len("</w:"+element+">")
+
+		part = part[:start] + "{%" + part[loc[4]:loc[5]] + "%}" + part[end:]
+	}
+}
+
+// lastIndexElementStart returns the index of the last opening tag of element in s, e.g. <w:tr> or <w:tr w:rsidR="0">,
+// but not <w:trPr>.
+func lastIndexElementStart(s string, element string) int {
+	for end := len(s); end > 0; {
+		i := strings.LastIndex(s[:end], "<w:"+element)
+		if i < 0 {
+			return -1
+		}
+		next := i + len("<w:"+element)
+		if next < len(s) && (s[next] == '>' || s[next] == ' ') {
+			return i
+		}
+		end = i
+	}
+	return -1
+}
+
+// templateNode is a parsed part of a template.
+type templateNode interface {
+	execute(ctx *executeContext, scope *templateScope) error
+}
+
+// textNode is XML written as is.
+type textNode string
+
+// valueNode is a {{ path }} placeholder.
+type valueNode []string
+
+// forNode is a {% for name in path %} loop.
+type forNode struct {
+	name string
+	path []string
+	body []templateNode
+}
+
+// ifNode is a {% if [not] path %} condition.
+type ifNode struct {
+	path     []string
+	negate   bool
+	body     []templateNode
+	elseBody []templateNode
+}
+
+// parseTemplate parses a normalized part into nodes.
+func parseTemplate(part string) (nodes []templateNode, err error) {
+	type block struct {
+		statement string
+		node      templateNode
+		parent    *[]templateNode
+	}
+
+	root := make([]templateNode, 0)
+	current := &root
+	stack := make([]*block, 0)
+
+	last := 0
+	for _, loc := range tagRegexp.FindAllStringSubmatchIndex(part, -1) {
+		if loc[0] > last {
+			*current = append(*current, textNode(part[last:loc[0]]))
+		}
+		last = loc[1]
+
+		if loc[2] >= 0 {
+			expression := strings.TrimSpace(html.UnescapeString(part[loc[2]:loc[3]]))
+			path, err := parsePath(expression)
+			if err != nil {
+				return nil, err
+			}
+			*current = append(*current, valueNode(path))
+			continue
+		}
+
+		statement := strings.TrimSpace(html.UnescapeString(part[loc[4]:loc[5]]))
+		fields := strings.Fields(statement)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("%w: empty statement", ErrBadTemplate)
+		}
+
+		switch fields[0] {
+		case "for":
+			if len(fields) != 4 || fields[2] != "in" || !identRegexp.MatchString(fields[1]) {
+				return nil, fmt.Errorf("%w: %s, must be for <name> in <path>", ErrBadTemplate, statement)
+			}
+			path, err := parsePath(fields[3])
+			if err != nil {
+				return nil, err
+			}
+			node := &forNode{name: fields[1], path: path}
+			*current = append(*current, node)
+			stack = append(stack, &block{statement: "for", node: node, parent: current})
+			current = &node.body
+		case "if":
+			negate := len(fields) == 3 && fields[1] == "not"
+			if len(fields) != 2 && !negate {
+				return nil, fmt.Errorf("%w: %s, must be if [not] <path>", ErrBadTemplate, statement)
+			}
+			path, err := parsePath(fields[len(fields)-1])
+			if err != nil {
+				return nil, err
+			}
+			node := &ifNode{path: path, negate: negate}
+			*current = append(*current, node)
+			stack = append(stack, &block{statement: "if", node: node, parent: current})
+			current = &node.body
+		case "else":
+			if len(stack) == 0 || stack[len(stack)-1].statement != "if" {
+				return nil, fmt.Errorf("%w: else without if", ErrBadTemplate)
+			}
+			top := stack[len(stack)-1]
+			top.statement = "else"
+			current = &top.node.(*ifNode).elseBody
+		case "endfor", "endif":
+			opening := strings.TrimPrefix(fields[0], "end")
+			if len(stack) == 0 || (stack[len(stack)-1].statement != opening && !(opening == "if" && stack[len(stack)-1].statement == "else")) {
+				return nil, fmt.Errorf("%w: %s without %s", ErrBadTemplate, fields[0], opening)
+			}
+			current = stack[len(stack)-1].parent
+			stack = stack[:len(stack)-1]
+		default:
+			return nil, fmt.Errorf("%w: unknown statement %s", ErrBadTemplate, statement)
+		}
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("%w: %s is not closed", ErrBadTemplate, stack[len(stack)-1].statement)
+	}
+	if last < len(part) {
+		*current = append(*current, textNode(part[last:]))
+	}
+
+	return root, nil
+}
+
+// parsePath parses a dotted path, e.g. kebutuhan.unor.
+func parsePath(expression string) (path []string, err error) {
+	if !pathRegexp.MatchString(expression) {
+		return nil, fmt.Errorf("%w: %s, placeholders must be a name or a dotted path without spaces", ErrBadTemplate, expression)
+	}
+	return strings.Split(expression, "."), nil
+}
+
+// templateScope holds the loop variables of a template being executed.
+type templateScope struct {
+	parent *templateScope
+	values map[string]interface{}
+}
+
+// lookup resolves path in the scope, nil if it cannot be found.
+func (s *templateScope) lookup(path []string) interface{} {
+	var value interface{}
+	found := false
+	for scope := s; scope != nil; scope = scope.parent {
+		if value, found = scope.values[path[0]]; found {
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	for _, key := range path[1:] {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil
+			}
+			value = v[i]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// executeContext collects what a part needs besides its XML, e.g. inline images.
+type executeContext struct {
+	buffer *bytes.Buffer
+	// image is called for every inline image, it returns the XML that replaces the placeholder.
+	image func(image *InlineImage) (xml string, err error)
+}
+
+func (n textNode) execute(ctx *executeContext, _ *templateScope) error {
+	ctx.buffer.WriteString(string(n))
+	return nil
+}
+
+func (n valueNode) execute(ctx *executeContext, scope *templateScope) error {
+	value := scope.lookup(n)
+	if image := parseInlineImage(value); image != nil {
+		xml, err := ctx.image(image)
+		if err != nil {
+			return err
+		}
+		ctx.buffer.WriteString(xml)
+		return nil
+	}
+
+	text := html.EscapeString(formatValue(value))
+	// Line breaks need their own element, the placeholder is always inside a text element.
+	text = strings.ReplaceAll(text, "\n", `</w:t><w:br/><w:t xml:space="preserve">`)
+	ctx.buffer.WriteString(text)
+	return nil
+}
+
+func (n *forNode) execute(ctx *executeContext, scope *templateScope) error {
+	var items []interface{}
+	switch v := scope.lookup(n.path).(type) {
+	case nil:
+	case []interface{}:
+		items = v
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			items = append(items, key)
+		}
+	default:
+		return fmt.Errorf("cannot iterate over %s", strings.Join(n.path, "."))
+	}
+
+	for i, item := range items {
+		loopScope := &templateScope{parent: scope, values: map[string]interface{}{
+			n.name: item,
+			"loop": map[string]interface{}{
+				"index":  json.Number(strconv.Itoa(i + 1)),
+				"index0": json.Number(strconv.Itoa(i)),
+				"first":  i == 0,
+				"last":   i == len(items)-1,
+			},
+		}}
+		for _, node := range n.body {
+			err := node.execute(ctx, loopScope)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (n *ifNode) execute(ctx *executeContext, scope *templateScope) error {
+	body := n.elseBody
+	if isTruthy(scope.lookup(n.path)) != n.negate {
+		body = n.body
+	}
+	for _, node := range body {
+		err := node.execute(ctx, scope)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatValue formats a value decoded from JSON the way siasn-docx does. Missing values are empty.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
+
+// isTruthy checks whether a value decoded from JSON passes an if statement.
+func isTruthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case string:
+		return v != ""
+	case json.Number:
+		f, err := v.Float64()
+		return err == nil && f != 0
+	case bool:
+		return v
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	default:
+		return true
+	}
+}
+
+// parseInlineImage returns the InlineImage encoded by InlineImage.MarshalJSON, nil if value is not one.
+func parseInlineImage(value interface{}) *InlineImage {
+	s, ok := value.(string)
+	if !ok || !strings.HasPrefix(s, "{") || !strings.Contains(s, `"InlineImage"`) {
+		return nil
+	}
+
+	raw := &struct {
+		Type            string  `json:"type"`
+		ImageDescriptor string  `json:"image_descriptor"`
+		Width           float32 `json:"width"`
+		Height          float32 `json:"height"`
+	}{}
+	err := json.Unmarshal([]byte(s), raw)
+	if err != nil || raw.Type != "InlineImage" || raw.ImageDescriptor == "" {
+		return nil
+	}
+	return &InlineImage{ImageDescriptor: raw.ImageDescriptor, Width: raw.Width, Height: raw.Height}
+}
@@ -0,0 +1,146 @@
+package docx_test
+
+import (
+	"archive/zip"
+	"errors"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/docx"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testDocument = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:r><w:t>Nama: {{ na</w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t>ma }}</w:t></w:r></w:p>
+<w:tbl>
+<w:tr><w:tc><w:p><w:r><w:t>{%tr for item in items %}</w:t></w:r></w:p></w:tc></w:tr>
+<w:tr><w:trPr/><w:tc><w:p><w:r><w:t>{{ loop.index }}. {{ item.jabatan }}</w:t></w:r></w:p></w:tc></w:tr>
+<w:tr><w:tc><w:p><w:r><w:t>{%tr endfor %}</w:t></w:r></w:p></w:tc></w:tr>
+</w:tbl>
+<w:p><w:r><w:t>{%p if not disetujui %}</w:t></w:r></w:p>
+<w:p><w:r><w:t>Ditolak</w:t></w:r></w:p>
+<w:p><w:r><w:t>{%p endif %}</w:t></w:r></w:p>
+<w:p><w:r><w:t>{{ foto }}</w:t></w:r></w:p>
+</w:body></w:document>`
+
+func createTestTemplate(t *testing.T, dir string, document string) string {
+	templatePath := filepath.Join(dir, "template.docx")
+	file, err := os.Create(templatePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	writer := zip.NewWriter(file)
+	parts := map[string]string{
+		"[Content_Types].xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="xml" ContentType="application/xml"/></Types>`,
+		"word/document.xml":   document,
+	}
+	for name, content := range parts {
+		w, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(content))
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return templatePath
+}
+
+func readTestOutput(t *testing.T, outputPath string) map[string]string {
+	reader, err := zip.OpenReader(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	parts := make(map[string]string)
+	for _, file := range reader.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := ioutil.ReadAll(r)
+		_ = r.Close()
+		parts[file.Name] = string(content)
+	}
+	return parts
+}
+
+func TestNativeRenderer_Render(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := createTestTemplate(t, dir, testDocument)
+
+	imagePath := filepath.Join(dir, "foto.png")
+	imageFile, err := os.Create(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = png.Encode(imageFile, image.NewGray(image.Rect(0, 0, 4, 2)))
+	_ = imageFile.Close()
+
+	data := map[string]interface{}{
+		"nama": "Budi & Ani",
+		"items": []map[string]interface{}{
+			{"jabatan": "Analis"},
+			{"jabatan": "Pranata"},
+		},
+		"disetujui": false,
+		"foto":      docx.InlineImage{ImageDescriptor: imagePath, Width: 10},
+	}
+
+	outputPath := filepath.Join(dir, "output.docx")
+	err = docx.NewNativeRenderer().Render(data, templatePath, outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := readTestOutput(t, outputPath)
+	document := parts["word/document.xml"]
+	for _, expected := range []string{
+		`<w:t xml:space="preserve">Nama: Budi &amp; Ani</w:t>`,
+		"1. Analis",
+		"2. Pranata",
+		"Ditolak",
+		`<wp:extent cx="360000" cy="180000"/>`,
+	} {
+		if !strings.Contains(document, expected) {
+			t.Fatalf("rendered document does not contain %s: %s", expected, document)
+		}
+	}
+	if strings.Contains(document, "{") || strings.Count(document, "<w:tr>") != 2 {
+		t.Fatalf("template statements are not replaced: %s", document)
+	}
+
+	if _, ok := parts["word/media/siasn-image1.png"]; !ok {
+		t.Fatal("inline image is not added to the document")
+	}
+	if !strings.Contains(parts["word/_rels/document.xml.rels"], `Target="media/siasn-image1.png"`) {
+		t.Fatal("inline image is not related to the document")
+	}
+	if !strings.Contains(parts["[Content_Types].xml"], `Extension="png"`) {
+		t.Fatal("content type of the inline image is not added")
+	}
+}
+
+func TestNativeRenderer_RenderBadTemplate(t *testing.T) {
+	dir := t.TempDir()
+	for _, document := range []string{
+		`<w:document><w:body><w:p><w:r><w:t>{{ nama lengkap }}</w:t></w:r></w:p></w:body></w:document>`,
+		`<w:document><w:body><w:p><w:r><w:t>{% for item in items %}</w:t></w:r></w:p></w:body></w:document>`,
+		`<w:document><w:body><w:p><w:r><w:t>{%tr for item in items %}</w:t></w:r></w:p></w:body></w:document>`,
+	} {
+		templatePath := createTestTemplate(t, dir, document)
+		err := docx.NewNativeRenderer().Render(map[string]interface{}{}, templatePath, filepath.Join(dir, "output.docx"))
+		if !errors.Is(err, docx.ErrBadTemplate) {
+			t.Fatalf("error is not ErrBadTemplate for %s: %v", document, err)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+)
+
+// utf8Bom makes spreadsheet applications read the CSV file as UTF-8.
+const utf8Bom = "\ufeff"
+
+// CsvWriter writes a table as a comma-separated CSV file, started with a UTF-8 byte order mark.
+// Rows are buffered, so nothing is written into the underlying writer until the buffer is full or it is closed.
+type CsvWriter struct {
+	buffer  *bufio.Writer
+	csv     *csv.Writer
+	started bool
+}
+
+// NewCsvWriter creates a CsvWriter.
+func NewCsvWriter(w io.Writer) *CsvWriter {
+	buffer := bufio.NewWriter(w)
+	return &CsvWriter{
+		buffer: buffer,
+		csv:    csv.NewWriter(buffer),
+	}
+}
+
+func (c *CsvWriter) WriteRow(cells []string) (err error) {
+	if !c.started {
+		c.started = true
+		_, err = c.buffer.WriteString(utf8Bom)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.csv.Write(cells)
+}
+
+func (c *CsvWriter) Close() (err error) {
+	c.csv.Flush()
+	if err = c.csv.Error(); err != nil {
+		return err
+	}
+	return c.buffer.Flush()
+}
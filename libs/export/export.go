@@ -0,0 +1,45 @@
+// Package export writes tables into spreadsheet files row by row, so that big tables can be streamed without keeping
+// them in memory.
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Supported formats.
+const (
+	FormatXlsx = "xlsx"
+	FormatCsv  = "csv"
+)
+
+// ContentTypes maps the supported formats to their MIME types.
+var ContentTypes = map[string]string{
+	FormatXlsx: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	FormatCsv:  "text/csv; charset=utf-8",
+}
+
+// ErrFormatUnsupported is returned by NewWriter if the format is not one of the supported formats.
+var ErrFormatUnsupported = errors.New("unsupported export format")
+
+// Writer writes a table row by row. Cells are written as text.
+type Writer interface {
+	// WriteRow writes a row. The first row is usually the header.
+	WriteRow(cells []string) (err error)
+	// Close writes the remaining rows and finishes the file. It does not close the underlying writer.
+	Close() (err error)
+}
+
+// NewWriter creates a Writer of the given format, either FormatXlsx or FormatCsv. sheetName is only used by
+// spreadsheet formats that have sheets.
+func NewWriter(w io.Writer, format string, sheetName string) (writer Writer, err error) {
+	switch format {
+	case FormatXlsx:
+		return NewXlsxWriter(w, sheetName), nil
+	case FormatCsv:
+		return NewCsvWriter(w), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrFormatUnsupported, format)
+	}
+}
@@ -0,0 +1,153 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxSheetNameLength is the maximum length of a sheet name accepted by spreadsheet applications.
+const maxSheetNameLength = 31
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/><Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/></Types>`
+	xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/></Relationships>`
+	// xlsxStyles has a bold font as its second cell style, used for the header.
+	xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts><fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills><borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders><cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs><cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs></styleSheet>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+// XlsxWriter writes a table as the only sheet of an XLSX workbook. The first row is written in bold as the header.
+// Every cell is an inline string, so the workbook can be streamed without a shared string table.
+type XlsxWriter struct {
+	zip       *zip.Writer
+	sheet     io.Writer
+	sheetName string
+	rows      int
+}
+
+// NewXlsxWriter creates an XlsxWriter. Nothing is written into w until the first row is written.
+// Characters not allowed in a sheet name are replaced and the name is truncated to 31 characters.
+func NewXlsxWriter(w io.Writer, sheetName string) *XlsxWriter {
+	sheetName = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '-'
+		}
+		return r
+	}, sheetName)
+	if sheetName == "" {
+		sheetName = "Sheet1"
+	}
+	if runes := []rune(sheetName); len(runes) > maxSheetNameLength {
+		sheetName = string(runes[:maxSheetNameLength])
+	}
+
+	return &XlsxWriter{
+		zip:       zip.NewWriter(w),
+		sheetName: sheetName,
+	}
+}
+
+// start writes every part of the workbook but the rows of the sheet.
+func (x *XlsxWriter) start() (err error) {
+	escapedName := &strings.Builder{}
+	_ = xml.EscapeText(escapedName, []byte(x.sheetName))
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", strings.Replace(xlsxWorkbook, "%s", escapedName.String(), 1)},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		w, err := x.zip.Create(part.name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, part.content)
+		if err != nil {
+			return err
+		}
+	}
+
+	x.sheet, err = x.zip.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(x.sheet, xlsxSheetStart)
+	return err
+}
+
+func (x *XlsxWriter) WriteRow(cells []string) (err error) {
+	if x.sheet == nil {
+		err = x.start()
+		if err != nil {
+			return err
+		}
+	}
+
+	x.rows++
+	style := ""
+	if x.rows == 1 {
+		style = ` s="1"`
+	}
+
+	row := &strings.Builder{}
+	row.WriteString(`<row r="`)
+	row.WriteString(strconv.Itoa(x.rows))
+	row.WriteString(`">`)
+	for i, cell := range cells {
+		row.WriteString(`<c r="`)
+		row.WriteString(xlsxColumnName(i))
+		row.WriteString(strconv.Itoa(x.rows))
+		row.WriteString(`" t="inlineStr"`)
+		row.WriteString(style)
+		row.WriteString(`><is><t xml:space="preserve">`)
+		// Invalid XML characters are replaced by EscapeText.
+		_ = xml.EscapeText(row, []byte(cell))
+		row.WriteString(`</t></is></c>`)
+	}
+	row.WriteString(`</row>`)
+
+	_, err = io.WriteString(x.sheet, row.String())
+	return err
+}
+
+func (x *XlsxWriter) Close() (err error) {
+	if x.sheet == nil {
+		err = x.start()
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(x.sheet, xlsxSheetEnd)
+	if err != nil {
+		return err
+	}
+	return x.zip.Close()
+}
+
+// xlsxColumnName returns the name of a zero-based column index, e.g. A for 0 and AA for 26.
+func xlsxColumnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
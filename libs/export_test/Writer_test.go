@@ -0,0 +1,92 @@
+package export_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/export"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestCsvWriter(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writer, err := export.NewWriter(buffer, export.FormatCsv, "Usulan")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = writer.WriteRow([]string{"Nama", "Status"})
+	_ = writer.WriteRow([]string{"Budi, S.Kom", "Diterima"})
+	if buffer.Len() != 0 {
+		t.Fatal("rows are written before the writer is closed")
+	}
+
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "\ufeffNama,Status\n\"Budi, S.Kom\",Diterima\n"
+	if buffer.String() != expected {
+		t.Fatalf("unexpected csv: %q", buffer.String())
+	}
+}
+
+func TestXlsxWriter(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	writer, err := export.NewWriter(buffer, export.FormatXlsx, "Usulan: Kegiatan")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cells := make([]string, 28)
+	cells[0] = "Budi & Ani"
+	cells[27] = "<akhir>"
+	_ = writer.WriteRow([]string{"Nama"})
+	_ = writer.WriteRow(cells)
+	err = writer.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := make(map[string]string)
+	for _, file := range reader.File {
+		r, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := ioutil.ReadAll(r)
+		_ = r.Close()
+		parts[file.Name] = string(content)
+	}
+
+	if !strings.Contains(parts["xl/workbook.xml"], `name="Usulan- Kegiatan"`) {
+		t.Fatalf("sheet name is not sanitized: %s", parts["xl/workbook.xml"])
+	}
+
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	for _, expected := range []string{
+		`<c r="A1" t="inlineStr" s="1"><is><t xml:space="preserve">Nama</t></is></c>`,
+		`<c r="A2" t="inlineStr"><is><t xml:space="preserve">Budi &amp; Ani</t></is></c>`,
+		`<c r="AB2" t="inlineStr"><is><t xml:space="preserve">&lt;akhir&gt;</t></is></c>`,
+		`</sheetData></worksheet>`,
+	} {
+		if !strings.Contains(sheet, expected) {
+			t.Fatalf("sheet does not contain %s: %s", expected, sheet)
+		}
+	}
+}
+
+func TestNewWriterUnsupported(t *testing.T) {
+	_, err := export.NewWriter(&bytes.Buffer{}, "pdf", "Usulan")
+	if !errors.Is(err, export.ErrFormatUnsupported) {
+		t.Fatalf("error is not ErrFormatUnsupported: %v", err)
+	}
+}
@@ -0,0 +1,386 @@
+// Package fakeoidc provides a fake OpenID Connect provider, mimicking the BKN Keycloak realm, for development and tests.
+// It issues signed tokens for the users and clients it is given, without any password.
+//
+// It must never be used in production: anyone who can reach it can log in as any of its users.
+package fakeoidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/google/uuid"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const (
+	// Paths of the endpoints, relative to the issuer, the same as Keycloak.
+	PathDiscovery     = "/.well-known/openid-configuration"
+	PathAuthorization = "/protocol/openid-connect/auth"
+	PathToken         = "/protocol/openid-connect/token"
+	PathKeys          = "/protocol/openid-connect/certs"
+	PathRevocation    = "/protocol/openid-connect/revoke"
+	PathEndSession    = "/protocol/openid-connect/logout"
+
+	// codeTtl is how long authorization codes can be exchanged.
+	codeTtl = time.Minute
+	// backChannelLogoutEvent is the event of back-channel logout tokens.
+	backChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+)
+
+// User is a user who can log in to the Provider.
+type User struct {
+	// Username is the NIP of the user, the preferred_username claim.
+	Username string
+	// Subject is the sub claim, derived from Username if empty.
+	Subject string
+	// Name is the full name of the user, Username if empty.
+	Name  string
+	Email string
+	// Roles are the realm roles of the user, e.g. admin_instansi.
+	Roles []string
+	// AsnId is the ID of the user in the ASN profile, derived from Username if empty.
+	AsnId string
+	// AgencyId is the work agency of the user.
+	AgencyId string
+}
+
+// Client is a client of the Provider other than the relying party, which obtains access tokens with the client
+// credentials grant, e.g. a service account.
+type Client struct {
+	Id     string
+	Secret string
+	// Roles are the realm roles of the service account of the client.
+	Roles []string
+}
+
+// grant is an authorization code or a refresh token of a session.
+type grant struct {
+	user        *User
+	sessionId   string
+	nonce       string
+	redirectUri string
+	expiresAt   time.Time
+}
+
+// Provider is a fake OpenID Connect provider, serving discovery, keys, authorization, token, revocation and end
+// session endpoints under Issuer. The authorization endpoint logs in the user named by the login_hint parameter, or
+// lets the user pick one of the users.
+//
+// Provider also implements auth.UserDetailGetter, so that its users do not have to be in the ASN profile DB.
+type Provider struct {
+	// Issuer is the URL of the provider, the OIDC_PROVIDER_URL of the service.
+	Issuer string
+	// ClientId and ClientSecret are the credentials of the relying party.
+	ClientId     string
+	ClientSecret string
+	// RedirectUri is the redirect URI registered for the client, the OIDC_REDIRECT_URL of the service. If set,
+	// authorization requests must redirect to it. Logouts only redirect to URIs of its origin, never if it is empty.
+	RedirectUri string
+	// TokenTtl is the lifetime of access and ID tokens.
+	TokenTtl time.Duration
+	// RefreshTtl is the lifetime of refresh tokens, that is of sessions.
+	RefreshTtl time.Duration
+
+	key   *rsa.PrivateKey
+	keyId string
+
+	mu            sync.Mutex
+	users         map[string]*User
+	clients       map[string]*Client
+	codes         map[string]*grant
+	refreshTokens map[string]*grant
+}
+
+// NewProvider creates a Provider with a new signing key.
+func NewProvider(issuer, clientId, clientSecret string) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Provider{
+		Issuer:        strings.TrimSuffix(issuer, "/"),
+		ClientId:      clientId,
+		ClientSecret:  clientSecret,
+		TokenTtl:      5 * time.Minute,
+		RefreshTtl:    30 * time.Minute,
+		key:           key,
+		keyId:         uuid.NewString(),
+		users:         make(map[string]*User),
+		clients:       make(map[string]*Client),
+		codes:         make(map[string]*grant),
+		refreshTokens: make(map[string]*grant),
+	}, nil
+}
+
+// NewServer starts a Provider on a local port, to be used in tests. The server must be closed after use.
+func NewServer(clientId, clientSecret string) (provider *Provider, server *httptest.Server, err error) {
+	provider, err = NewProvider("", clientId, clientSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	server = httptest.NewServer(provider)
+	provider.Issuer = server.URL
+	return provider, server, nil
+}
+
+// ParseUsers parses users, each written as the username, its agency ID and optionally its roles separated by commas,
+// e.g. 199001012020011001=A5EB03E23BFBF6A0E040640A040252AD:admin_instansi,pembina_jf.
+func ParseUsers(values []string) (users []*User, err error) {
+	users = make([]*User, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		username, rest, ok := strings.Cut(value, "=")
+		agencyId, userRoles, _ := strings.Cut(rest, ":")
+		username, agencyId = strings.TrimSpace(username), strings.TrimSpace(agencyId)
+		if !ok || username == "" || agencyId == "" {
+			return nil, fmt.Errorf("invalid user %s, must be username=agency-id:role,...", value)
+		}
+
+		user := &User{Username: username, AgencyId: agencyId, Roles: []string{}}
+		for _, role := range strings.Split(userRoles, ",") {
+			if role = strings.TrimSpace(role); role != "" {
+				user.Roles = append(user.Roles, role)
+			}
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// AddUser adds or replaces a user.
+func (p *Provider) AddUser(user *User) {
+	if user.Subject == "" {
+		user.Subject = uuid.NewSHA1(uuid.NameSpaceOID, []byte("subject:"+user.Username)).String()
+	}
+	if user.AsnId == "" {
+		user.AsnId = strings.ToUpper(uuid.NewSHA1(uuid.NameSpaceOID, []byte("asn:"+user.Username)).String())
+	}
+	if user.Name == "" {
+		user.Name = user.Username
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.users[user.Username] = user
+}
+
+// AddClient adds or replaces a client.
+func (p *Provider) AddClient(client *Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clients[client.Id] = client
+}
+
+// GetUserDetail returns the ASN of a user, or nil if the user does not exist or is not in workAgencyId.
+func (p *Provider) GetUserDetail(_ context.Context, nip string, workAgencyId string) (asn *auth.Asn, err error) {
+	p.mu.Lock()
+	user, ok := p.users[nip]
+	p.mu.Unlock()
+	if !ok || (workAgencyId != "" && user.AgencyId != workAgencyId) {
+		return nil, nil
+	}
+
+	return &auth.Asn{
+		AsnId:          user.AsnId,
+		NewNip:         user.Username,
+		Name:           user.Name,
+		Email:          user.Email,
+		Username:       user.Username,
+		ParentAgencyId: user.AgencyId,
+		WorkAgencyId:   user.AgencyId,
+	}, nil
+}
+
+// GetUserRoles returns the realm roles of a user, it can be used as auth.Auth UserRoles.
+func (p *Provider) GetUserRoles(_ context.Context, asn *auth.Asn) (roles []string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	user, ok := p.users[asn.NewNip]
+	if !ok {
+		return nil, nil
+	}
+	return append([]string(nil), user.Roles...), nil
+}
+
+// IdToken mints an ID token of a user for the relying party, e.g. to call the service with a bearer token.
+func (p *Provider) IdToken(username string) (string, error) {
+	user, err := p.user(username)
+	if err != nil {
+		return "", err
+	}
+	return p.sign(p.userClaims(user, "ID", p.ClientId, uuid.NewString(), ""))
+}
+
+// ClientToken mints an access token of a client, as the client credentials grant does.
+func (p *Provider) ClientToken(clientId string) (string, error) {
+	p.mu.Lock()
+	client, ok := p.clients[clientId]
+	p.mu.Unlock()
+	if !ok {
+		return "", fmt.Errorf("unknown client %s", clientId)
+	}
+	return p.sign(p.clientClaims(client))
+}
+
+// LogoutToken mints a back-channel logout token for the relying party, ending the session sessionId of a user, or
+// every session of the user if sessionId is empty.
+func (p *Provider) LogoutToken(username, sessionId string) (string, error) {
+	user, err := p.user(username)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":    p.Issuer,
+		"aud":    p.ClientId,
+		"sub":    user.Subject,
+		"iat":    now.Unix(),
+		"exp":    now.Add(p.TokenTtl).Unix(),
+		"jti":    uuid.NewString(),
+		"events": map[string]interface{}{backChannelLogoutEvent: map[string]interface{}{}},
+	}
+	if sessionId != "" {
+		claims["sid"] = sessionId
+	}
+	return p.sign(claims)
+}
+
+// EndSessions ends every session of a user, their refresh tokens are rejected from then on.
+func (p *Provider) EndSessions(username string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for token, g := range p.refreshTokens {
+		if g.user.Username == username {
+			delete(p.refreshTokens, token)
+		}
+	}
+}
+
+func (p *Provider) user(username string) (*User, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	user, ok := p.users[username]
+	if !ok {
+		return nil, fmt.Errorf("unknown user %s", username)
+	}
+	return user, nil
+}
+
+// userClaims returns the claims of the ID (typ ID) or access (typ Bearer) token of a user, with the same layout as
+// Keycloak. Both carry the realm roles, so that ID tokens used as bearer tokens have roles.
+func (p *Provider) userClaims(user *User, typ string, audience string, sessionId string, nonce string) map[string]interface{} {
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":                p.Issuer,
+		"sub":                user.Subject,
+		"aud":                audience,
+		"azp":                p.ClientId,
+		"typ":                typ,
+		"iat":                now.Unix(),
+		"auth_time":          now.Unix(),
+		"exp":                now.Add(p.TokenTtl).Unix(),
+		"jti":                uuid.NewString(),
+		"sid":                sessionId,
+		"session_state":      sessionId,
+		"preferred_username": user.Username,
+		"name":               user.Name,
+		"given_name":         user.Name,
+		"email":              user.Email,
+		"email_verified":     user.Email != "",
+		"scope":              "openid",
+		"realm_access":       map[string]interface{}{"roles": roles(user.Roles)},
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	return claims
+}
+
+// clientClaims returns the claims of the access token of a client, with the same layout as Keycloak.
+func (p *Provider) clientClaims(client *Client) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":                p.Issuer,
+		"sub":                uuid.NewSHA1(uuid.NameSpaceOID, []byte("client:"+client.Id)).String(),
+		"aud":                "account",
+		"azp":                client.Id,
+		"typ":                "Bearer",
+		"iat":                now.Unix(),
+		"exp":                now.Add(p.TokenTtl).Unix(),
+		"jti":                uuid.NewString(),
+		"preferred_username": "service-account-" + client.Id,
+		"scope":              "profile email",
+		"realm_access":       map[string]interface{}{"roles": roles(client.Roles)},
+	}
+}
+
+// roles returns roles as a JSON array, never null.
+func roles(roles []string) []string {
+	if roles == nil {
+		return []string{}
+	}
+	return roles
+}
+
+func (p *Provider) sign(claims map[string]interface{}) (string, error) {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: p.key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", p.keyId),
+	)
+	if err != nil {
+		return "", err
+	}
+	return jwt.Signed(signer).Claims(claims).CompactSerialize()
+}
+
+// verify verifies a token signed by the provider, whatever its expiry, and decodes its claims.
+func (p *Provider) verify(rawToken string, claims interface{}) error {
+	token, err := jwt.ParseSigned(rawToken)
+	if err != nil {
+		return err
+	}
+	return token.Claims(&p.key.PublicKey, claims)
+}
+
+// ServeHTTP serves the endpoints of the provider, under the path of Issuer.
+func (p *Provider) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	issuerPath := ""
+	if issuerUrl, err := url.Parse(p.Issuer); err == nil {
+		issuerPath = strings.TrimSuffix(issuerUrl.Path, "/")
+	}
+
+	switch strings.TrimPrefix(request.URL.Path, issuerPath) {
+	case PathDiscovery:
+		p.handleDiscovery(writer, request)
+	case PathKeys:
+		p.handleKeys(writer, request)
+	case PathAuthorization:
+		p.handleAuthorization(writer, request)
+	case PathToken:
+		p.handleToken(writer, request)
+	case PathRevocation:
+		p.handleRevocation(writer, request)
+	case PathEndSession:
+		p.handleEndSession(writer, request)
+	default:
+		http.NotFound(writer, request)
+	}
+}
@@ -0,0 +1,298 @@
+package fakeoidc
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/httputil"
+	"github.com/google/uuid"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// loginPage lists the users to log in as, each linking back to the authorization endpoint with login_hint.
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Fake OpenID Connect Provider</title></head>
+<body>
+<h1>Log in as</h1>
+<ul>
+{{range .}}<li><a href="{{.Url}}">{{.User.Name}}</a> ({{.User.Username}}, agency {{.User.AgencyId}}, roles {{.User.Roles}})</li>
+{{else}}<li>No users, set OIDC_FAKE_USERS.</li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+func (p *Provider) handleDiscovery(writer http.ResponseWriter, _ *http.Request) {
+	_ = httputil.WriteObj200(writer, map[string]interface{}{
+		"issuer":                                p.Issuer,
+		"authorization_endpoint":                p.Issuer + PathAuthorization,
+		"token_endpoint":                        p.Issuer + PathToken,
+		"jwks_uri":                              p.Issuer + PathKeys,
+		"revocation_endpoint":                   p.Issuer + PathRevocation,
+		"end_session_endpoint":                  p.Issuer + PathEndSession,
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token", "client_credentials"},
+		"backchannel_logout_supported":          true,
+		"backchannel_logout_session_supported":  true,
+	})
+}
+
+func (p *Provider) handleKeys(writer http.ResponseWriter, _ *http.Request) {
+	_ = httputil.WriteObj200(writer, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       &p.key.PublicKey,
+		KeyID:     p.keyId,
+		Algorithm: string(jose.RS256),
+		Use:       "sig",
+	}}})
+}
+
+func (p *Provider) handleAuthorization(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	if query.Get("client_id") != p.ClientId || query.Get("response_type") != "code" {
+		http.Error(writer, "unknown client or unsupported response type", http.StatusBadRequest)
+		return
+	}
+	redirectUrl, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || !redirectUrl.IsAbs() || (p.RedirectUri != "" && query.Get("redirect_uri") != p.RedirectUri) {
+		http.Error(writer, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	redirectQuery := redirectUrl.Query()
+	if state := query.Get("state"); state != "" {
+		redirectQuery.Set("state", state)
+	}
+
+	username := query.Get("login_hint")
+	if username == "" {
+		// There is no session at the provider, the user always has to pick one.
+		if query.Get("prompt") == "none" {
+			redirectQuery.Set("error", "login_required")
+			redirectUrl.RawQuery = redirectQuery.Encode()
+			http.Redirect(writer, request, redirectUrl.String(), http.StatusFound)
+			return
+		}
+		p.writeLoginPage(writer, request)
+		return
+	}
+
+	user, err := p.user(username)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	code := uuid.NewString()
+	sessionId := uuid.NewString()
+	p.mu.Lock()
+	p.codes[code] = &grant{
+		user:        user,
+		sessionId:   sessionId,
+		nonce:       query.Get("nonce"),
+		redirectUri: query.Get("redirect_uri"),
+		expiresAt:   time.Now().Add(codeTtl),
+	}
+	p.mu.Unlock()
+
+	redirectQuery.Set("code", code)
+	redirectQuery.Set("session_state", sessionId)
+	redirectUrl.RawQuery = redirectQuery.Encode()
+	http.Redirect(writer, request, redirectUrl.String(), http.StatusFound)
+}
+
+func (p *Provider) writeLoginPage(writer http.ResponseWriter, request *http.Request) {
+	type entry struct {
+		User *User
+		Url  string
+	}
+
+	p.mu.Lock()
+	entries := make([]*entry, 0, len(p.users))
+	for _, user := range p.users {
+		query := request.URL.Query()
+		query.Set("login_hint", user.Username)
+		entries = append(entries, &entry{User: user, Url: request.URL.Path + "?" + query.Encode()})
+	}
+	p.mu.Unlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].User.Username < entries[j].User.Username
+	})
+
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = loginPage.Execute(writer, entries)
+}
+
+func (p *Provider) handleToken(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	clientId, clientSecret := clientCredentials(request)
+	grantType := request.PostFormValue("grant_type")
+	if grantType == "client_credentials" {
+		p.mu.Lock()
+		client, ok := p.clients[clientId]
+		p.mu.Unlock()
+		if !ok || client.Secret != clientSecret {
+			writeTokenError(writer, "invalid_client", http.StatusUnauthorized)
+			return
+		}
+
+		accessToken, err := p.sign(p.clientClaims(client))
+		if err != nil {
+			writeTokenError(writer, "server_error", http.StatusInternalServerError)
+			return
+		}
+		_ = httputil.WriteObj200(writer, map[string]interface{}{
+			"access_token": accessToken,
+			"token_type":   "Bearer",
+			"expires_in":   int(p.TokenTtl.Seconds()),
+			"scope":        "profile email",
+		})
+		return
+	}
+
+	if clientId != p.ClientId || clientSecret != p.ClientSecret {
+		writeTokenError(writer, "invalid_client", http.StatusUnauthorized)
+		return
+	}
+
+	var g *grant
+	var ok bool
+	p.mu.Lock()
+	switch grantType {
+	case "authorization_code":
+		code := request.PostFormValue("code")
+		g, ok = p.codes[code]
+		delete(p.codes, code)
+		ok = ok && g.redirectUri == request.PostFormValue("redirect_uri")
+	case "refresh_token":
+		// Refresh tokens are rotated, as Keycloak does with refresh token revocation turned on.
+		refreshToken := request.PostFormValue("refresh_token")
+		g, ok = p.refreshTokens[refreshToken]
+		delete(p.refreshTokens, refreshToken)
+	default:
+		p.mu.Unlock()
+		writeTokenError(writer, "unsupported_grant_type", http.StatusBadRequest)
+		return
+	}
+	p.mu.Unlock()
+	if !ok || time.Now().After(g.expiresAt) {
+		writeTokenError(writer, "invalid_grant", http.StatusBadRequest)
+		return
+	}
+
+	accessToken, err := p.sign(p.userClaims(g.user, "Bearer", "account", g.sessionId, ""))
+	if err != nil {
+		writeTokenError(writer, "server_error", http.StatusInternalServerError)
+		return
+	}
+	idToken, err := p.sign(p.userClaims(g.user, "ID", p.ClientId, g.sessionId, g.nonce))
+	if err != nil {
+		writeTokenError(writer, "server_error", http.StatusInternalServerError)
+		return
+	}
+
+	refreshToken := uuid.NewString()
+	p.mu.Lock()
+	p.refreshTokens[refreshToken] = &grant{user: g.user, sessionId: g.sessionId, expiresAt: time.Now().Add(p.RefreshTtl)}
+	p.mu.Unlock()
+
+	_ = httputil.WriteObj200(writer, map[string]interface{}{
+		"access_token":       accessToken,
+		"id_token":           idToken,
+		"refresh_token":      refreshToken,
+		"token_type":         "Bearer",
+		"expires_in":         int(p.TokenTtl.Seconds()),
+		"refresh_expires_in": int(p.RefreshTtl.Seconds()),
+		"session_state":      g.sessionId,
+		"scope":              "openid",
+	})
+}
+
+func (p *Provider) handleRevocation(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	clientId, clientSecret := clientCredentials(request)
+	if clientId != p.ClientId || clientSecret != p.ClientSecret {
+		writeTokenError(writer, "invalid_client", http.StatusUnauthorized)
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	g, ok := p.refreshTokens[request.PostFormValue("token")]
+	if ok {
+		p.endSession(g.sessionId)
+	}
+	writer.WriteHeader(http.StatusOK)
+}
+
+func (p *Provider) handleEndSession(writer http.ResponseWriter, request *http.Request) {
+	claims := struct {
+		Sid string `json:"sid"`
+	}{}
+	if idTokenHint := request.FormValue("id_token_hint"); idTokenHint != "" && p.verify(idTokenHint, &claims) == nil {
+		p.mu.Lock()
+		p.endSession(claims.Sid)
+		p.mu.Unlock()
+	}
+
+	if redirectUri := request.FormValue("post_logout_redirect_uri"); redirectUri != "" && p.sameOriginAsRedirectUri(redirectUri) {
+		http.Redirect(writer, request, redirectUri, http.StatusFound)
+		return
+	}
+	writer.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = writer.Write([]byte("Logged out.\n"))
+}
+
+// sameOriginAsRedirectUri checks whether uri has the origin of RedirectUri, so that logouts cannot redirect anywhere.
+func (p *Provider) sameOriginAsRedirectUri(uri string) bool {
+	registered, err := url.Parse(p.RedirectUri)
+	if err != nil || p.RedirectUri == "" {
+		return false
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	return u.IsAbs() && u.Scheme == registered.Scheme && u.Host == registered.Host
+}
+
+// endSession deletes the refresh tokens of a session. p.mu must be locked.
+func (p *Provider) endSession(sessionId string) {
+	for token, g := range p.refreshTokens {
+		if g.sessionId == sessionId {
+			delete(p.refreshTokens, token)
+		}
+	}
+}
+
+// clientCredentials returns the credentials of the client of a token request, from HTTP basic authentication or from
+// the form.
+func clientCredentials(request *http.Request) (clientId, clientSecret string) {
+	if clientId, clientSecret, ok := request.BasicAuth(); ok {
+		// Credentials are form-encoded before basic authentication, see RFC 6749 section 2.3.1.
+		id, idErr := url.QueryUnescape(clientId)
+		secret, secretErr := url.QueryUnescape(clientSecret)
+		if idErr == nil && secretErr == nil {
+			return id, secret
+		}
+		return clientId, clientSecret
+	}
+	return request.PostFormValue("client_id"), request.PostFormValue("client_secret")
+}
+
+func writeTokenError(writer http.ResponseWriter, code string, status int) {
+	_ = httputil.WriteObj(writer, map[string]string{"error": code}, status)
+}
@@ -0,0 +1,111 @@
+package fakeoidc_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/fakeoidc"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+func TestParseUsers(t *testing.T) {
+	users, err := fakeoidc.ParseUsers([]string{"199001012020011001=A1:admin_instansi, pembina_jf", "199001012020011002=A2"})
+	if err != nil {
+		t.Fatalf("users must be parsed: %v", err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("2 users must be parsed, got %d", len(users))
+	}
+	if users[0].Username != "199001012020011001" || users[0].AgencyId != "A1" || !reflect.DeepEqual(users[0].Roles, []string{"admin_instansi", "pembina_jf"}) {
+		t.Errorf("first user must be parsed with its roles, got %#v", users[0])
+	}
+	if users[1].AgencyId != "A2" || len(users[1].Roles) != 0 {
+		t.Errorf("second user must be parsed without roles, got %#v", users[1])
+	}
+
+	for _, value := range []string{"199001012020011001", "=A1", "199001012020011001=:admin_bkn"} {
+		if _, err = fakeoidc.ParseUsers([]string{value}); err == nil {
+			t.Errorf("%s must be rejected", value)
+		}
+	}
+}
+
+func TestProvider(t *testing.T) {
+	provider, server, err := fakeoidc.NewServer("manajemen-jf", "secret")
+	if err != nil {
+		t.Fatalf("fake provider must start: %v", err)
+	}
+	defer server.Close()
+	provider.AddUser(&fakeoidc.User{Username: "199001012020011001", Name: "Budi", AgencyId: "A1"})
+	provider.AddClient(&fakeoidc.Client{Id: "siasn-sync", Secret: "sync-secret"})
+
+	// Without login_hint, the user picks one of the users.
+	response, err := http.Get(server.URL + fakeoidc.PathAuthorization + "?" + url.Values{
+		"client_id":     {"manajemen-jf"},
+		"response_type": {"code"},
+		"redirect_uri":  {"http://localhost/api/oauth"},
+	}.Encode())
+	if err != nil {
+		t.Fatalf("authorization endpoint must be reachable: %v", err)
+	}
+	page, _ := io.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if !strings.Contains(string(page), "Budi") || !strings.Contains(string(page), "login_hint=199001012020011001") {
+		t.Errorf("login page must list the users, got %s", page)
+	}
+
+	config := &clientcredentials.Config{ClientID: "siasn-sync", ClientSecret: "sync-secret", TokenURL: server.URL + fakeoidc.PathToken}
+	if _, err = config.Token(context.Background()); err != nil {
+		t.Errorf("client credentials grant must succeed: %v", err)
+	}
+	config.ClientSecret = "wrong"
+	if _, err = config.Token(context.Background()); err == nil {
+		t.Error("client credentials grant must fail with a wrong secret")
+	}
+
+	asn, _ := provider.GetUserDetail(context.Background(), "199001012020011001", "")
+	if asn == nil || asn.WorkAgencyId != "A1" || asn.AsnId == "" {
+		t.Errorf("user detail must be the ASN of the user, got %#v", asn)
+	}
+	if asn, _ = provider.GetUserDetail(context.Background(), "199001012020011001", "A2"); asn != nil {
+		t.Error("user must not be found in another agency")
+	}
+}
+
+func TestEndSessionRedirect(t *testing.T) {
+	provider, server, err := fakeoidc.NewServer("manajemen-jf", "secret")
+	if err != nil {
+		t.Fatalf("fake provider must start: %v", err)
+	}
+	defer server.Close()
+	client := &http.Client{CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	endSession := func(redirectUri string) *http.Response {
+		response, err := client.Get(server.URL + fakeoidc.PathEndSession + "?" + url.Values{"post_logout_redirect_uri": {redirectUri}}.Encode())
+		if err != nil {
+			t.Fatalf("end session endpoint must be reachable: %v", err)
+		}
+		_ = response.Body.Close()
+		return response
+	}
+
+	if response := endSession("http://localhost/"); response.StatusCode != http.StatusOK {
+		t.Errorf("logout must not redirect without a registered redirect URI, got %d", response.StatusCode)
+	}
+
+	provider.RedirectUri = "http://localhost/api/oauth"
+	if response := endSession("http://localhost/"); response.StatusCode != http.StatusFound || response.Header.Get("Location") != "http://localhost/" {
+		t.Errorf("logout must redirect to the origin of the redirect URI, got %d", response.StatusCode)
+	}
+	for _, redirectUri := range []string{"http://evil.example/", "https://localhost/", "http://localhost:8080/", "//evil.example/"} {
+		if response := endSession(redirectUri); response.StatusCode != http.StatusOK {
+			t.Errorf("logout must not redirect to %s, got %d", redirectUri, response.StatusCode)
+		}
+	}
+}
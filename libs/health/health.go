@@ -0,0 +1,179 @@
+// Package health checks the dependencies of the service, such as databases and binaries, and serves the results for
+// liveness and readiness probes and as Prometheus gauges.
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/httputil"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// CheckFunc checks a dependency, it returns an error if the dependency is not usable.
+type CheckFunc func(ctx context.Context) error
+
+// DependencyStatus is the result of the check of a dependency.
+type DependencyStatus struct {
+	// Status is either StatusUp or StatusDown.
+	Status string `json:"status"`
+	// Error is the error returned by the check of a dependency that is down.
+	Error string `json:"error,omitempty"`
+	// DurationMs is the duration of the check in milliseconds.
+	DurationMs int64 `json:"duration_ms"`
+}
+
+// Report is the result of the checks of every dependency.
+type Report struct {
+	// Status is StatusUp if every dependency is up, StatusDown otherwise.
+	Status       string                       `json:"status"`
+	Dependencies map[string]*DependencyStatus `json:"dependencies"`
+}
+
+// Metrics are the gauges updated by each check, labeled by the name of the dependency. Both can be nil.
+type Metrics struct {
+	// Up is 1 if the dependency passed its last check, 0 otherwise.
+	Up *prometheus.GaugeVec
+	// CheckDurationSeconds is the duration of the last check of the dependency.
+	CheckDurationSeconds *prometheus.GaugeVec
+}
+
+type namedCheck struct {
+	name  string
+	check CheckFunc
+}
+
+// Checker checks the dependencies registered with Add. Dependencies must be added before checking, a Checker is then
+// safe for concurrent use.
+type Checker struct {
+	// Timeout is the maximum duration of each check. Once checks may run, change it with SetTimeout.
+	Timeout time.Duration
+	Metrics *Metrics
+	checks  []*namedCheck
+	mu      sync.RWMutex
+}
+
+// NewChecker creates a Checker without dependencies, whose checks time out after timeout.
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{Timeout: timeout}
+}
+
+// Add registers a dependency named name. Names are used as JSON keys and metric labels, e.g. profile_postgres.
+func (c *Checker) Add(name string, check CheckFunc) {
+	c.checks = append(c.checks, &namedCheck{name: name, check: check})
+}
+
+// SetTimeout changes Timeout, it is safe to call while checks run.
+func (c *Checker) SetTimeout(timeout time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Timeout = timeout
+}
+
+// Check checks every dependency concurrently and updates Metrics.
+func (c *Checker) Check(ctx context.Context) (report *Report) {
+	report = &Report{Status: StatusUp, Dependencies: make(map[string]*DependencyStatus, len(c.checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func(check *namedCheck) {
+			defer wg.Done()
+			status := c.run(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Dependencies[check.name] = status
+			if status.Status != StatusUp {
+				report.Status = StatusDown
+			}
+		}(check)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// run runs a single check with Timeout and records its result in Metrics.
+func (c *Checker) run(ctx context.Context, check *namedCheck) (status *DependencyStatus) {
+	c.mu.RLock()
+	timeout := c.Timeout
+	c.mu.RUnlock()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := check.check(ctx)
+	duration := time.Since(start)
+
+	status = &DependencyStatus{Status: StatusUp, DurationMs: duration.Milliseconds()}
+	up := 1.0
+	if err != nil {
+		status.Status = StatusDown
+		status.Error = err.Error()
+		up = 0
+	}
+
+	if c.Metrics != nil && c.Metrics.Up != nil {
+		c.Metrics.Up.WithLabelValues(check.name).Set(up)
+	}
+	if c.Metrics != nil && c.Metrics.CheckDurationSeconds != nil {
+		c.Metrics.CheckDurationSeconds.WithLabelValues(check.name).Set(duration.Seconds())
+	}
+	return status
+}
+
+// Run checks the dependencies every interval until ctx is done, so that Metrics stay up to date between probes.
+func (c *Checker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		c.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// HandleLiveness writes the report of the dependencies, always with status 200: the service is alive as long as it
+// can respond, restarting it does not fix its dependencies.
+func (c *Checker) HandleLiveness(writer http.ResponseWriter, request *http.Request) {
+	_ = httputil.WriteObj200(writer, c.Check(request.Context()))
+}
+
+// HandleReadiness writes the report of the dependencies, with status 503 if one of them is down, so that no traffic
+// is routed to the service until they are up again.
+func (c *Checker) HandleReadiness(writer http.ResponseWriter, request *http.Request) {
+	report := c.Check(request.Context())
+	code := http.StatusOK
+	if report.Status != StatusUp {
+		code = http.StatusServiceUnavailable
+	}
+	_ = httputil.WriteObj(writer, report, code)
+}
+
+// CommandCheck checks that the binary of command can be found, either as a path or in PATH.
+func CommandCheck(command string) CheckFunc {
+	return func(_ context.Context) error {
+		if _, err := exec.LookPath(command); err != nil {
+			return fmt.Errorf("cannot find %s: %w", command, err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,106 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/health"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func newMetrics() *health.Metrics {
+	return &health.Metrics{
+		Up:                   prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "up"}, []string{"dependency"}),
+		CheckDurationSeconds: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "duration"}, []string{"dependency"}),
+	}
+}
+
+func up(_ context.Context) error {
+	return nil
+}
+
+func down(_ context.Context) error {
+	return errors.New("connection refused")
+}
+
+// slow waits for its context, which must time out.
+func slow(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func serve(handler http.HandlerFunc) (code int, report *health.Report) {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", "/readyz", nil))
+	report = &health.Report{}
+	_ = json.NewDecoder(rec.Body).Decode(report)
+	return rec.Code, report
+}
+
+func TestCheck(t *testing.T) {
+	checker := health.NewChecker(50 * time.Millisecond)
+	checker.Metrics = newMetrics()
+	checker.Add("postgres", up)
+	checker.Add("redis", down)
+	checker.Add("object_storage", slow)
+
+	report := checker.Check(context.Background())
+	if report.Status != health.StatusDown {
+		t.Errorf("report must be down, got %s", report.Status)
+	}
+	if report.Dependencies["postgres"].Status != health.StatusUp || report.Dependencies["postgres"].Error != "" {
+		t.Errorf("unexpected postgres status %+v", report.Dependencies["postgres"])
+	}
+	if report.Dependencies["redis"].Error != "connection refused" {
+		t.Errorf("unexpected redis status %+v", report.Dependencies["redis"])
+	}
+	if report.Dependencies["object_storage"].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("slow check must time out, got %+v", report.Dependencies["object_storage"])
+	}
+
+	for dependency, expected := range map[string]float64{"postgres": 1, "redis": 0, "object_storage": 0} {
+		if value := testutil.ToFloat64(checker.Metrics.Up.WithLabelValues(dependency)); value != expected {
+			t.Errorf("gauge of %s must be %v, got %v", dependency, expected, value)
+		}
+	}
+	if value := testutil.ToFloat64(checker.Metrics.CheckDurationSeconds.WithLabelValues("object_storage")); value < 0.05 {
+		t.Errorf("duration of the slow check must be at least the timeout, got %v", value)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	checker := health.NewChecker(time.Second)
+	checker.Add("postgres", up)
+
+	code, report := serve(checker.HandleReadiness)
+	if code != http.StatusOK || report.Status != health.StatusUp {
+		t.Errorf("readiness must be ok when every dependency is up: %d %+v", code, report)
+	}
+
+	checker.Add("redis", down)
+	code, report = serve(checker.HandleReadiness)
+	if code != http.StatusServiceUnavailable || report.Dependencies["redis"].Status != health.StatusDown {
+		t.Errorf("readiness must fail when a dependency is down: %d %+v", code, report)
+	}
+
+	// Liveness reports the dependencies, but does not fail because of them.
+	code, report = serve(checker.HandleLiveness)
+	if code != http.StatusOK || report.Status != health.StatusDown {
+		t.Errorf("liveness must be ok with the report of the dependencies: %d %+v", code, report)
+	}
+}
+
+func TestCommandCheck(t *testing.T) {
+	if err := health.CommandCheck("go")(context.Background()); err != nil {
+		t.Errorf("go must be found: %v", err)
+	}
+	if err := health.CommandCheck("siasn-docx-does-not-exist")(context.Background()); err == nil {
+		t.Error("unknown command must not be found")
+	}
+}
@@ -0,0 +1,138 @@
+package logutil
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is the minimum severity of the messages logged by a LevelLogger.
+type Level int32
+
+const (
+	LevelTrace Level = iota
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (level Level) String() string {
+	switch level {
+	case LevelTrace:
+		return "trace"
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("Level(%d)", int32(level))
+}
+
+// ParseLevel parses a level name: trace, debug, info, warn or error, case-insensitive.
+func ParseLevel(name string) (Level, error) {
+	for level := LevelTrace; level <= LevelError; level++ {
+		if strings.EqualFold(name, level.String()) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %s, must be trace, debug, info, warn or error", name)
+}
+
+// LevelVar is a Level that can be changed while it is used by loggers, e.g. on configuration reload.
+// The zero value is LevelTrace.
+type LevelVar struct {
+	level int32
+}
+
+func (levelVar *LevelVar) Level() Level {
+	return Level(atomic.LoadInt32(&levelVar.level))
+}
+
+func (levelVar *LevelVar) Set(level Level) {
+	atomic.StoreInt32(&levelVar.level, int32(level))
+}
+
+// LevelLogger allows you to drop the messages of a Logger below a level. Access messages are always logged.
+type LevelLogger struct {
+	logger Logger
+	level  *LevelVar
+}
+
+// Create a new LevelLogger logging to logger the messages at or above level. The same level can be shared by
+// many loggers.
+func NewLevelLogger(logger Logger, level *LevelVar) *LevelLogger {
+	return &LevelLogger{logger: logger, level: level}
+}
+
+func (levelLogger *LevelLogger) enabled(level Level) bool {
+	return level >= levelLogger.level.Level()
+}
+
+func (levelLogger *LevelLogger) Trace(message string) {
+	if levelLogger.enabled(LevelTrace) {
+		levelLogger.logger.Trace(message)
+	}
+}
+
+func (levelLogger *LevelLogger) Tracef(format string, v ...interface{}) {
+	if levelLogger.enabled(LevelTrace) {
+		levelLogger.logger.Tracef(format, v...)
+	}
+}
+
+func (levelLogger *LevelLogger) Debug(message string) {
+	if levelLogger.enabled(LevelDebug) {
+		levelLogger.logger.Debug(message)
+	}
+}
+
+func (levelLogger *LevelLogger) Debugf(format string, v ...interface{}) {
+	if levelLogger.enabled(LevelDebug) {
+		levelLogger.logger.Debugf(format, v...)
+	}
+}
+
+func (levelLogger *LevelLogger) Info(message string) {
+	if levelLogger.enabled(LevelInfo) {
+		levelLogger.logger.Info(message)
+	}
+}
+
+func (levelLogger *LevelLogger) Infof(format string, v ...interface{}) {
+	if levelLogger.enabled(LevelInfo) {
+		levelLogger.logger.Infof(format, v...)
+	}
+}
+
+func (levelLogger *LevelLogger) Warn(message string) {
+	if levelLogger.enabled(LevelWarn) {
+		levelLogger.logger.Warn(message)
+	}
+}
+
+func (levelLogger *LevelLogger) Warnf(format string, v ...interface{}) {
+	if levelLogger.enabled(LevelWarn) {
+		levelLogger.logger.Warnf(format, v...)
+	}
+}
+
+func (levelLogger *LevelLogger) Error(message string) {
+	if levelLogger.enabled(LevelError) {
+		levelLogger.logger.Error(message)
+	}
+}
+
+func (levelLogger *LevelLogger) Errorf(format string, v ...interface{}) {
+	if levelLogger.enabled(LevelError) {
+		levelLogger.logger.Errorf(format, v...)
+	}
+}
+
+func (levelLogger *LevelLogger) Access(message string) {
+	levelLogger.logger.Access(message)
+}
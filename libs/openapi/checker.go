@@ -0,0 +1,188 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/logutil"
+)
+
+// Mode is what a Checker does with mismatches.
+type Mode string
+
+const (
+	// ModeOff does not check requests and responses.
+	ModeOff Mode = "off"
+	// ModeLog logs the mismatches, requests and responses are left untouched.
+	ModeLog Mode = "log"
+	// ModeEnforce logs the mismatches and rejects requests that do not match the document. JSON responses are held
+	// until they are validated, and replaced when they do not match the document. Other responses, such as files,
+	// are streamed and their mismatches are only logged.
+	ModeEnforce Mode = "enforce"
+)
+
+// ParseMode parses a mode, either off, log or enforce.
+func ParseMode(s string) (mode Mode, err error) {
+	switch mode = Mode(s); mode {
+	case ModeOff, ModeLog, ModeEnforce:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown contract mode %s, can only be \"off\", \"log\" or \"enforce\"", s)
+	}
+}
+
+// Checker is an HTTP middleware checking the requests and the responses of the operations of Spec.
+type Checker struct {
+	Spec *Spec
+	Mode Mode
+	// Template returns the path template of the route of a request, e.g. /api/v1/generic/template/{path:.+}. The path
+	// of the request is used if Template is nil, which only works with routes without variables.
+	Template func(request *http.Request) string
+	// RejectRequest writes the response of a request that does not match the document in ModeEnforce.
+	RejectRequest func(writer http.ResponseWriter, request *http.Request, mismatches []*Mismatch)
+	// RejectResponse writes the response replacing a response that does not match the document in ModeEnforce.
+	RejectResponse func(writer http.ResponseWriter, request *http.Request, mismatches []*Mismatch)
+	Logger         logutil.Logger
+}
+
+// Handler wraps next with the checks of the checker.
+func (c *Checker) Handler(next http.Handler) http.Handler {
+	if c.Mode == ModeOff || c.Mode == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		template := request.URL.Path
+		if c.Template != nil {
+			template = c.Template(request)
+		}
+
+		operation, ok := c.Spec.Operation(request.Method, strings.TrimPrefix(template, c.Spec.BasePath))
+		if !ok {
+			c.reportRequest(writer, request, []*Mismatch{{
+				Location: "request",
+				Message:  fmt.Sprintf("operation %s %s is not documented", request.Method, template),
+			}}, next)
+			return
+		}
+
+		var body []byte
+		contentType := request.Header.Get("Content-Type")
+		if isJson(mediaTypeOf(contentType)) && request.Body != nil {
+			var err error
+			body, err = io.ReadAll(request.Body)
+			request.Body = io.NopCloser(bytes.NewReader(body))
+			if err != nil {
+				c.warnf("contract: cannot read request body of %s %s: %v", request.Method, request.URL.Path, err)
+				next.ServeHTTP(writer, request)
+				return
+			}
+		}
+
+		mismatches := operation.ValidateRequest(request.URL.Query(), contentType, body)
+		if len(mismatches) > 0 {
+			c.reportRequest(writer, request, mismatches, next)
+			return
+		}
+
+		responseWriter := &responseChecker{ResponseWriter: writer, hold: c.Mode == ModeEnforce}
+		next.ServeHTTP(responseWriter, request)
+
+		mismatches = operation.ValidateResponse(responseWriter.status(), responseWriter.Header().Get("Content-Type"), responseWriter.body.Bytes())
+		if len(mismatches) > 0 {
+			c.warnf("contract: response of %s %s does not match the specification: %s", request.Method, request.URL.Path, mismatchesString(mismatches))
+			if responseWriter.held() {
+				c.RejectResponse(writer, request, mismatches)
+				return
+			}
+		}
+		responseWriter.flush()
+	})
+}
+
+// reportRequest logs the mismatches of a request, then rejects it in ModeEnforce, or serves it with next otherwise.
+func (c *Checker) reportRequest(writer http.ResponseWriter, request *http.Request, mismatches []*Mismatch, next http.Handler) {
+	c.warnf("contract: request %s %s does not match the specification: %s", request.Method, request.URL.Path, mismatchesString(mismatches))
+	if c.Mode == ModeEnforce {
+		c.RejectRequest(writer, request, mismatches)
+		return
+	}
+	next.ServeHTTP(writer, request)
+}
+
+// warnf logs with Logger, or with the default logger if Logger is nil.
+func (c *Checker) warnf(format string, v ...interface{}) {
+	if c.Logger != nil {
+		c.Logger.Warnf(format, v...)
+		return
+	}
+	logutil.Warnf(format, v...)
+}
+
+func mismatchesString(mismatches []*Mismatch) string {
+	messages := make([]string, len(mismatches))
+	for i, mismatch := range mismatches {
+		messages[i] = mismatch.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// responseChecker records the status and the JSON body of a response. If hold is true, JSON responses are not
+// written until flush is called. Other responses are always written through.
+type responseChecker struct {
+	http.ResponseWriter
+	hold        bool
+	code        int
+	wroteHeader bool
+	capture     bool
+	body        bytes.Buffer
+}
+
+func (w *responseChecker) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.code = code
+	w.capture = isJson(mediaTypeOf(w.Header().Get("Content-Type")))
+	if !w.held() {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *responseChecker) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.capture {
+		w.body.Write(data)
+		if w.hold {
+			return len(data), nil
+		}
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// status returns the status of the response, 200 if the handler has not written anything.
+func (w *responseChecker) status() int {
+	if !w.wroteHeader {
+		return http.StatusOK
+	}
+	return w.code
+}
+
+// held returns true if the response has been held and not written yet.
+func (w *responseChecker) held() bool {
+	return w.hold && w.capture
+}
+
+// flush writes a held response.
+func (w *responseChecker) flush() {
+	if w.held() {
+		w.ResponseWriter.WriteHeader(w.code)
+		_, _ = w.ResponseWriter.Write(w.body.Bytes())
+	}
+}
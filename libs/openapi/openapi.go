@@ -0,0 +1,228 @@
+// Package openapi loads an OpenAPI 3.1 document and checks requests and responses against it, so that the document
+// and the service do not drift apart.
+//
+// Only the parts of the specification used by this service are supported: operations are looked up by their path
+// template, query parameters and JSON bodies are validated against a subset of JSON Schema (type, properties,
+// required, items, enum, oneOf, anyOf, allOf and local $ref). Other keywords, such as format or
+// additionalProperties, are ignored.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// methods are the operations of a path item, other keys of a path item are not operations.
+var methods = map[string]struct{}{
+	"get": {}, "put": {}, "post": {}, "delete": {}, "options": {}, "head": {}, "patch": {}, "trace": {},
+}
+
+// muxVariable matches the variables of mux path templates that have a pattern, e.g. {path:.+}.
+var muxVariable = regexp.MustCompile(`\{([^{}:]+):[^{}]*\}`)
+
+// Spec is a loaded OpenAPI document.
+type Spec struct {
+	// BasePath is the path of the first server URL, e.g. /api/v1. Request paths start with it, the paths of the
+	// document do not.
+	BasePath   string
+	paths      map[string]map[string]*Operation
+	schemas    map[string]*Schema
+	parameters map[string]*Parameter
+	responses  map[string]*Response
+}
+
+// Operation is a single method of a path.
+type Operation struct {
+	Method      string               `json:"-"`
+	Path        string               `json:"-"`
+	OperationId string               `json:"operationId"`
+	Parameters  []*Parameter         `json:"parameters"`
+	RequestBody *RequestBody         `json:"requestBody"`
+	Responses   map[string]*Response `json:"responses"`
+	spec        *Spec
+}
+
+// Parameter is a parameter of an operation. Parameters referring to the components of the document are resolved
+// when loading.
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response is a response of an operation. Responses referring to the components of the document are resolved when
+// loading.
+type Response struct {
+	Ref     string                `json:"$ref"`
+	Content map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// document is the part of an OpenAPI document read by Load.
+type document struct {
+	OpenApi string `json:"openapi"`
+	Servers []struct {
+		Url string `json:"url"`
+	} `json:"servers"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas    map[string]*Schema    `json:"schemas"`
+		Parameters map[string]*Parameter `json:"parameters"`
+		Responses  map[string]*Response  `json:"responses"`
+	} `json:"components"`
+}
+
+// Load parses an OpenAPI document in JSON. The parameters shared by the operations of a path and the parameters
+// referring to components are merged into each operation, and the responses referring to components are resolved. It
+// returns an error if a reference cannot be resolved.
+func Load(data []byte) (spec *Spec, err error) {
+	doc := &document{}
+	if err = json.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("cannot parse OpenAPI document: %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenApi, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q", doc.OpenApi)
+	}
+
+	spec = &Spec{
+		paths:      make(map[string]map[string]*Operation),
+		schemas:    doc.Components.Schemas,
+		parameters: doc.Components.Parameters,
+		responses:  doc.Components.Responses,
+	}
+	if len(doc.Servers) > 0 {
+		serverUrl, err := url.Parse(doc.Servers[0].Url)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server URL %s: %w", doc.Servers[0].Url, err)
+		}
+		spec.BasePath = strings.TrimSuffix(serverUrl.Path, "/")
+	}
+
+	for path, item := range doc.Paths {
+		var shared []*Parameter
+		if raw, ok := item["parameters"]; ok {
+			if err = json.Unmarshal(raw, &shared); err != nil {
+				return nil, fmt.Errorf("invalid parameters of %s: %w", path, err)
+			}
+		}
+
+		operations := make(map[string]*Operation)
+		for method, raw := range item {
+			if _, ok := methods[method]; !ok {
+				continue
+			}
+
+			operation := &Operation{Method: strings.ToUpper(method), Path: path, spec: spec}
+			if err = json.Unmarshal(raw, operation); err != nil {
+				return nil, fmt.Errorf("invalid operation %s %s: %w", operation.Method, path, err)
+			}
+			operation.Parameters, err = spec.resolveParameters(append(shared, operation.Parameters...))
+			if err != nil {
+				return nil, fmt.Errorf("invalid operation %s %s: %w", operation.Method, path, err)
+			}
+			if err = spec.resolveResponses(operation.Responses); err != nil {
+				return nil, fmt.Errorf("invalid operation %s %s: %w", operation.Method, path, err)
+			}
+			operations[operation.Method] = operation
+		}
+		spec.paths[path] = operations
+	}
+
+	return spec, nil
+}
+
+// resolveParameters resolves the references of parameters. A parameter of an operation overrides a shared parameter
+// of the same name and location.
+func (s *Spec) resolveParameters(parameters []*Parameter) (resolved []*Parameter, err error) {
+	indexes := make(map[string]int)
+	for _, parameter := range parameters {
+		if parameter.Ref != "" {
+			name := strings.TrimPrefix(parameter.Ref, "#/components/parameters/")
+			component, ok := s.parameters[name]
+			if !ok || name == parameter.Ref {
+				return nil, fmt.Errorf("cannot resolve parameter %s", parameter.Ref)
+			}
+			parameter = component
+		}
+
+		key := parameter.In + " " + parameter.Name
+		if i, ok := indexes[key]; ok {
+			resolved[i] = parameter
+			continue
+		}
+		indexes[key] = len(resolved)
+		resolved = append(resolved, parameter)
+	}
+	return resolved, nil
+}
+
+// resolveResponses replaces the responses referring to components with the components, in place.
+func (s *Spec) resolveResponses(responses map[string]*Response) error {
+	for status, response := range responses {
+		if response == nil || response.Ref == "" {
+			continue
+		}
+		name := strings.TrimPrefix(response.Ref, "#/components/responses/")
+		component, ok := s.responses[name]
+		if !ok || name == response.Ref {
+			return fmt.Errorf("cannot resolve response %s", response.Ref)
+		}
+		responses[status] = component
+	}
+	return nil
+}
+
+// Operation returns the operation of method on a path template, e.g. GET /activity/admission/get. The template can
+// be a mux path template, the patterns of its variables are ignored.
+func (s *Spec) Operation(method string, template string) (operation *Operation, ok bool) {
+	operation, ok = s.paths[NormalizeTemplate(template)][strings.ToUpper(method)]
+	return operation, ok
+}
+
+// NormalizeTemplate removes the patterns of the variables of a mux path template, e.g. /template/{path:.+} becomes
+// /template/{path}.
+func NormalizeTemplate(template string) string {
+	return muxVariable.ReplaceAllString(template, "{$1}")
+}
+
+// Route is an endpoint served by the service.
+type Route struct {
+	Method   string
+	Template string
+}
+
+func (r Route) String() string {
+	return r.Method + " " + r.Template
+}
+
+// Undocumented returns the routes that do not have an operation in the document, sorted. The templates of routes
+// must start with BasePath, routes outside of it are not part of the document and are never returned.
+func (s *Spec) Undocumented(routes []Route) (undocumented []Route) {
+	for _, route := range routes {
+		if !strings.HasPrefix(route.Template, s.BasePath+"/") {
+			continue
+		}
+		if _, ok := s.Operation(route.Method, strings.TrimPrefix(route.Template, s.BasePath)); !ok {
+			undocumented = append(undocumented, route)
+		}
+	}
+
+	sort.Slice(undocumented, func(i, j int) bool {
+		return undocumented[i].String() < undocumented[j].String()
+	})
+	return undocumented
+}
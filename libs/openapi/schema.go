@@ -0,0 +1,237 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Schema is the subset of JSON Schema supported by this package.
+type Schema struct {
+	Ref        string             `json:"$ref"`
+	Type       SchemaType         `json:"type"`
+	Properties map[string]*Schema `json:"properties"`
+	Required   []string           `json:"required"`
+	Items      *Schema            `json:"items"`
+	Enum       []interface{}      `json:"enum"`
+	OneOf      []*Schema          `json:"oneOf"`
+	AnyOf      []*Schema          `json:"anyOf"`
+	AllOf      []*Schema          `json:"allOf"`
+	// Nullable is the OpenAPI 3.0 way to allow null, OpenAPI 3.1 adds "null" to the types instead.
+	Nullable bool `json:"nullable"`
+}
+
+// SchemaType is the type keyword of a schema, either a single type or a list of types in OpenAPI 3.1, e.g.
+// ["string", "null"]. An empty SchemaType allows every type.
+type SchemaType []string
+
+func (t *SchemaType) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return json.Unmarshal(data, (*[]string)(t))
+	}
+
+	var single string
+	if err := json.Unmarshal(data, &single); err != nil {
+		return err
+	}
+	*t = SchemaType{single}
+	return nil
+}
+
+// has returns true if t allows values of typeName. Integers are numbers too.
+func (t SchemaType) has(typeName string) bool {
+	for _, allowed := range t {
+		if allowed == typeName || (allowed == "number" && typeName == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// Mismatch is a difference between a request or a response and the document.
+type Mismatch struct {
+	// Location is where the mismatch is, e.g. query.halaman, body.surat_pak.nama_file or response.data[0].status.
+	Location string `json:"location"`
+	Message  string `json:"message"`
+}
+
+func (m *Mismatch) Error() string {
+	return m.Location + " " + m.Message
+}
+
+// resolve returns the schema referred to by schema, or schema itself if it is not a reference.
+func (s *Spec) resolve(schema *Schema) (resolved *Schema, err error) {
+	for schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/components/schemas/")
+		component, ok := s.schemas[name]
+		if !ok || name == schema.Ref {
+			return nil, fmt.Errorf("cannot resolve schema %s", schema.Ref)
+		}
+		schema = component
+	}
+	return schema, nil
+}
+
+// validateValue validates a decoded JSON value against schema. Numbers must be decoded as json.Number.
+func (s *Spec) validateValue(schema *Schema, value interface{}, location string, mismatches *[]*Mismatch) {
+	schema, err := s.resolve(schema)
+	if err != nil {
+		*mismatches = append(*mismatches, &Mismatch{Location: location, Message: err.Error()})
+		return
+	}
+
+	valueType := typeOf(value)
+	if len(schema.Type) > 0 && !schema.Type.has(valueType) && !(valueType == "null" && schema.Nullable) {
+		*mismatches = append(*mismatches, &Mismatch{
+			Location: location,
+			Message:  fmt.Sprintf("must be %s, not %s", strings.Join(schema.Type, " or "), valueType),
+		})
+		return
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		*mismatches = append(*mismatches, &Mismatch{Location: location, Message: "must be one of " + enumString(schema.Enum)})
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for _, name := range schema.Required {
+			if _, ok := value[name]; !ok {
+				*mismatches = append(*mismatches, &Mismatch{Location: joinLocation(location, name), Message: "is required"})
+			}
+		}
+		for name, property := range schema.Properties {
+			if propertyValue, ok := value[name]; ok {
+				s.validateValue(property, propertyValue, joinLocation(location, name), mismatches)
+			}
+		}
+	case []interface{}:
+		if schema.Items != nil {
+			for i, item := range value {
+				s.validateValue(schema.Items, item, fmt.Sprintf("%s[%d]", location, i), mismatches)
+			}
+		}
+	}
+
+	for _, subschema := range schema.AllOf {
+		s.validateValue(subschema, value, location, mismatches)
+	}
+	if len(schema.AnyOf) > 0 && s.countMatches(schema.AnyOf, value) == 0 {
+		*mismatches = append(*mismatches, &Mismatch{Location: location, Message: "must match at least one schema of anyOf"})
+	}
+	if len(schema.OneOf) > 0 && s.countMatches(schema.OneOf, value) != 1 {
+		*mismatches = append(*mismatches, &Mismatch{Location: location, Message: "must match exactly one schema of oneOf"})
+	}
+}
+
+// countMatches returns the number of schemas matched by value.
+func (s *Spec) countMatches(schemas []*Schema, value interface{}) (count int) {
+	for _, schema := range schemas {
+		var mismatches []*Mismatch
+		s.validateValue(schema, value, "", &mismatches)
+		if len(mismatches) == 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// validateJson decodes data and validates it against schema.
+func (s *Spec) validateJson(schema *Schema, data []byte, location string) (mismatches []*Mismatch) {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return []*Mismatch{{Location: location, Message: "is not valid JSON: " + err.Error()}}
+	}
+
+	s.validateValue(schema, value, location, &mismatches)
+	return mismatches
+}
+
+// typeOf returns the JSON Schema type of a decoded JSON value. Integral numbers are integers.
+func typeOf(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := value.Int64(); err == nil {
+			return "integer"
+		}
+		if f, err := value.Float64(); err == nil && f == float64(int64(f)) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// inEnum returns true if value is one of enum. Values are compared with their fmt.Sprint form, so that numbers of
+// the document match json.Number.
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, enumValue := range enum {
+		if fmt.Sprint(enumValue) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func enumString(enum []interface{}) string {
+	values := make([]string, len(enum))
+	for i, value := range enum {
+		values[i] = fmt.Sprint(value)
+	}
+	return strings.Join(values, ", ")
+}
+
+// coerceQuery converts the values of a query parameter to the JSON value described by schema, so that they can be
+// validated like JSON. Values that cannot be converted are kept as strings and fail the type check.
+func (s *Spec) coerceQuery(schema *Schema, values []string) (value interface{}) {
+	resolved, err := s.resolve(schema)
+	if err != nil {
+		return values[0]
+	}
+
+	if resolved.Type.has("array") && !resolved.Type.has("string") {
+		items := make([]interface{}, len(values))
+		for i, item := range values {
+			items[i] = item
+			if resolved.Items != nil {
+				items[i] = s.coerceQuery(resolved.Items, []string{item})
+			}
+		}
+		return items
+	}
+
+	raw := values[0]
+	switch {
+	case resolved.Type.has("integer") || resolved.Type.has("number"):
+		if _, err := strconv.ParseFloat(raw, 64); err == nil {
+			return json.Number(raw)
+		}
+	case resolved.Type.has("boolean"):
+		if b, err := strconv.ParseBool(raw); err == nil {
+			return b
+		}
+	}
+	return raw
+}
+
+func joinLocation(location, name string) string {
+	if location == "" {
+		return name
+	}
+	return location + "." + name
+}
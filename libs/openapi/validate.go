@@ -0,0 +1,102 @@
+package openapi
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ValidateRequest validates the query parameters and the body of a request against the operation. The body is only
+// validated if it is JSON, other bodies such as multipart uploads are only checked for their content type. Path
+// parameters are matched by the router and are not validated.
+func (o *Operation) ValidateRequest(query url.Values, contentType string, body []byte) (mismatches []*Mismatch) {
+	for _, parameter := range o.Parameters {
+		if parameter.In != "query" {
+			continue
+		}
+
+		location := "query." + parameter.Name
+		values := query[parameter.Name]
+		if len(values) == 0 {
+			if parameter.Required {
+				mismatches = append(mismatches, &Mismatch{Location: location, Message: "is required"})
+			}
+			continue
+		}
+		if parameter.Schema != nil {
+			o.spec.validateValue(parameter.Schema, o.spec.coerceQuery(parameter.Schema, values), location, &mismatches)
+		}
+	}
+
+	if o.RequestBody == nil {
+		return mismatches
+	}
+	if len(body) == 0 {
+		if o.RequestBody.Required {
+			mismatches = append(mismatches, &Mismatch{Location: "body", Message: "is required"})
+		}
+		return mismatches
+	}
+
+	mediaType := mediaTypeOf(contentType)
+	content, ok := o.RequestBody.Content[mediaType]
+	if !ok {
+		return append(mismatches, &Mismatch{Location: "body", Message: fmt.Sprintf("content type %s is not documented", contentType)})
+	}
+	if isJson(mediaType) && content.Schema != nil {
+		mismatches = append(mismatches, o.spec.validateJson(content.Schema, body, "body")...)
+	}
+	return mismatches
+}
+
+// ValidateResponse validates the status, the content type and the body of a response against the operation. The
+// body is only validated if it is JSON. A response without a documented content, such as a redirect, can have any
+// body.
+func (o *Operation) ValidateResponse(status int, contentType string, body []byte) (mismatches []*Mismatch) {
+	response := o.response(status)
+	if response == nil {
+		return []*Mismatch{{Location: "response", Message: fmt.Sprintf("status %d is not documented", status)}}
+	}
+	if len(response.Content) == 0 || len(body) == 0 {
+		return nil
+	}
+
+	mediaType := mediaTypeOf(contentType)
+	content, ok := response.Content[mediaType]
+	if !ok {
+		return []*Mismatch{{Location: "response", Message: fmt.Sprintf("content type %s is not documented for status %d", contentType, status)}}
+	}
+	if isJson(mediaType) && content.Schema != nil {
+		return o.spec.validateJson(content.Schema, body, "response")
+	}
+	return nil
+}
+
+// response returns the response documented for status, by its exact status, its range (e.g. 4XX) or the default
+// response.
+func (o *Operation) response(status int) *Response {
+	code := strconv.Itoa(status)
+	for _, key := range []string{code, code[:1] + "XX", "default"} {
+		if response, ok := o.Responses[key]; ok {
+			return response
+		}
+	}
+	return nil
+}
+
+// mediaTypeOf returns the media type of a Content-Type header without its parameters, e.g. application/json for
+// application/json; charset=utf-8.
+func mediaTypeOf(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.TrimSpace(strings.Split(contentType, ";")[0])
+	}
+	return mediaType
+}
+
+// isJson returns true if mediaType is JSON, e.g. application/json or application/problem+json.
+func isJson(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
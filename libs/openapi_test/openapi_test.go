@@ -0,0 +1,301 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/openapi"
+)
+
+const document = `{
+  "openapi": "3.1.0",
+  "servers": [{"url": "http://localhost:8080/api/v1"}],
+  "paths": {
+    "/admission/get": {
+      "parameters": [{"$ref": "#/components/parameters/id"}],
+      "get": {
+        "parameters": [
+          {"in": "query", "name": "status", "schema": {"type": "integer", "enum": [1, 2, 3]}},
+          {"in": "query", "name": "jenis", "schema": {"type": "array", "items": {"type": "integer"}}}
+        ],
+        "responses": {
+          "200": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Admission"}}}},
+          "302": {"description": "Found"},
+          "4XX": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}},
+          "503": {"$ref": "#/components/responses/Unavailable"}
+        }
+      }
+    },
+    "/admission/submit": {
+      "post": {
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Admission"}}}
+        },
+        "responses": {"200": {"content": {"application/json": {"schema": {"type": "object"}}}}}
+      }
+    },
+    "/template/download/{path}": {
+      "get": {"responses": {"302": {"description": "Found"}}}
+    }
+  },
+  "components": {
+    "parameters": {
+      "id": {"in": "query", "name": "id", "required": true, "schema": {"type": "string"}}
+    },
+    "responses": {
+      "Unavailable": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}}
+    },
+    "schemas": {
+      "Admission": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "string"},
+          "nama": {"type": "string"},
+          "durasi": {"type": ["integer", "null"]},
+          "peserta": {"type": "array", "items": {"$ref": "#/components/schemas/Attendee"}},
+          "data": {"oneOf": [{"type": "object"}, {"type": "array"}]}
+        },
+        "required": ["id", "nama"]
+      },
+      "Attendee": {
+        "type": "object",
+        "properties": {"nip": {"type": "string"}},
+        "required": ["nip"]
+      },
+      "Error": {
+        "type": "object",
+        "properties": {"code": {"type": "integer"}, "message": {"type": "string"}},
+        "required": ["code", "message"]
+      }
+    }
+  }
+}`
+
+func mustLoad(t *testing.T) *openapi.Spec {
+	spec, err := openapi.Load([]byte(document))
+	if err != nil {
+		t.Fatalf("cannot load document: %v", err)
+	}
+	return spec
+}
+
+func mustOperation(t *testing.T, spec *openapi.Spec, method, template string) *openapi.Operation {
+	operation, ok := spec.Operation(method, template)
+	if !ok {
+		t.Fatalf("operation %s %s not found", method, template)
+	}
+	return operation
+}
+
+// locations returns the sorted locations of mismatches.
+func locations(mismatches []*openapi.Mismatch) []string {
+	result := make([]string, 0, len(mismatches))
+	for _, mismatch := range mismatches {
+		result = append(result, mismatch.Location)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func expectLocations(t *testing.T, mismatches []*openapi.Mismatch, expected ...string) {
+	t.Helper()
+	if expected == nil {
+		expected = []string{}
+	}
+	if actual := locations(mismatches); !reflect.DeepEqual(actual, expected) {
+		b, _ := json.Marshal(mismatches)
+		t.Errorf("expected mismatches at %v, got %s", expected, b)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	spec := mustLoad(t)
+	if spec.BasePath != "/api/v1" {
+		t.Errorf("unexpected base path %s", spec.BasePath)
+	}
+
+	operation := mustOperation(t, spec, "get", "/admission/get")
+	if len(operation.Parameters) != 3 || operation.Parameters[0].Name != "id" || !operation.Parameters[0].Required {
+		t.Errorf("shared parameter is not resolved: %+v", operation.Parameters)
+	}
+	mustOperation(t, spec, "GET", "/template/download/{path:.+}")
+	if _, ok := spec.Operation("POST", "/admission/get"); ok {
+		t.Error("POST /admission/get must not be documented")
+	}
+
+	_, err := openapi.Load([]byte(`{"openapi": "3.1.0", "paths": {"/a": {"get": {"parameters": [{"$ref": "#/components/parameters/x"}]}}}}`))
+	if err == nil {
+		t.Error("unresolved parameter must fail")
+	}
+	_, err = openapi.Load([]byte(`{"openapi": "3.1.0", "paths": {"/a": {"get": {"responses": {"503": {"$ref": "#/components/responses/x"}}}}}}`))
+	if err == nil {
+		t.Error("unresolved response must fail")
+	}
+}
+
+func TestUndocumented(t *testing.T) {
+	undocumented := mustLoad(t).Undocumented([]openapi.Route{
+		{Method: "GET", Template: "/api/v1/admission/get"},
+		{Method: "POST", Template: "/api/v1/admission/get"},
+		{Method: "GET", Template: "/api/v1/template/download/{path:.+}"},
+		{Method: "GET", Template: "/api/v1/admission/detail"},
+		{Method: "GET", Template: "/api/version"},
+	})
+
+	expected := []openapi.Route{
+		{Method: "GET", Template: "/api/v1/admission/detail"},
+		{Method: "POST", Template: "/api/v1/admission/get"},
+	}
+	if !reflect.DeepEqual(undocumented, expected) {
+		t.Errorf("unexpected undocumented routes %v", undocumented)
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	spec := mustLoad(t)
+	get := mustOperation(t, spec, "GET", "/admission/get")
+
+	query, _ := url.ParseQuery("id=a&status=2&jenis=1&jenis=2")
+	expectLocations(t, get.ValidateRequest(query, "", nil))
+
+	query, _ = url.ParseQuery("status=4&jenis=1&jenis=x")
+	expectLocations(t, get.ValidateRequest(query, "", nil), "query.id", "query.jenis[1]", "query.status")
+
+	submit := mustOperation(t, spec, "POST", "/admission/submit")
+	valid := `{"id": "a", "nama": "b", "durasi": null, "peserta": [{"nip": "1"}], "data": {}}`
+	expectLocations(t, submit.ValidateRequest(nil, "application/json; charset=utf-8", []byte(valid)))
+
+	invalid := `{"id": 1, "durasi": 1.5, "peserta": [{"nip": "1"}, {}], "data": "x"}`
+	expectLocations(t, submit.ValidateRequest(nil, "application/json", []byte(invalid)),
+		"body.data", "body.durasi", "body.id", "body.nama", "body.peserta[1].nip")
+
+	expectLocations(t, submit.ValidateRequest(nil, "", nil), "body")
+	expectLocations(t, submit.ValidateRequest(nil, "text/plain", []byte("a")), "body")
+	expectLocations(t, submit.ValidateRequest(nil, "application/json", []byte("{")), "body")
+}
+
+func TestValidateResponse(t *testing.T) {
+	spec := mustLoad(t)
+	get := mustOperation(t, spec, "GET", "/admission/get")
+
+	expectLocations(t, get.ValidateResponse(200, "application/json", []byte(`{"id": "a", "nama": "b"}`)))
+	expectLocations(t, get.ValidateResponse(200, "application/json", []byte(`{"id": "a"}`)), "response.nama")
+	expectLocations(t, get.ValidateResponse(302, "text/html", []byte(`<a href="/">Found</a>`)))
+	expectLocations(t, get.ValidateResponse(404, "application/json", []byte(`{"code": 10404, "message": "not found"}`)))
+	expectLocations(t, get.ValidateResponse(404, "application/json", []byte(`{"code": "x", "message": "not found"}`)), "response.code")
+	expectLocations(t, get.ValidateResponse(200, "text/plain", []byte(`a`)), "response")
+	expectLocations(t, get.ValidateResponse(500, "application/json", []byte(`{}`)), "response")
+	expectLocations(t, get.ValidateResponse(503, "application/json", []byte(`{"code": 10517, "message": "unavailable"}`)))
+	expectLocations(t, get.ValidateResponse(503, "application/json", []byte(`{}`)), "response.code", "response.message")
+}
+
+func TestParseMode(t *testing.T) {
+	for _, s := range []string{"off", "log", "enforce"} {
+		if mode, err := openapi.ParseMode(s); err != nil || string(mode) != s {
+			t.Errorf("cannot parse mode %s: %v", s, err)
+		}
+	}
+	if _, err := openapi.ParseMode("strict"); err == nil {
+		t.Error("unknown mode must fail")
+	}
+}
+
+func newChecker(t *testing.T, mode openapi.Mode) *openapi.Checker {
+	return &openapi.Checker{
+		Spec: mustLoad(t),
+		Mode: mode,
+		RejectRequest: func(writer http.ResponseWriter, _ *http.Request, mismatches []*openapi.Mismatch) {
+			writer.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(writer).Encode(mismatches)
+		},
+		RejectResponse: func(writer http.ResponseWriter, _ *http.Request, mismatches []*openapi.Mismatch) {
+			writer.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(writer).Encode(mismatches)
+		},
+	}
+}
+
+// jsonHandler responds with body as JSON.
+func jsonHandler(body string) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		_, _ = writer.Write([]byte(body))
+	})
+}
+
+func serve(handler http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCheckerEnforce(t *testing.T) {
+	checker := newChecker(t, openapi.ModeEnforce)
+
+	rec := serve(checker.Handler(jsonHandler(`{"id": "a", "nama": "b"}`)), "GET", "/api/v1/admission/get?id=a", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"id": "a", "nama": "b"}` {
+		t.Errorf("valid response is not written: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serve(checker.Handler(jsonHandler(`{}`)), "GET", "/api/v1/admission/get", "")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "query.id") {
+		t.Errorf("invalid request is not rejected: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serve(checker.Handler(jsonHandler(`{"id": "a"}`)), "GET", "/api/v1/admission/get?id=a", "")
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "response.nama") {
+		t.Errorf("invalid response is not replaced: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serve(checker.Handler(jsonHandler(`{}`)), "GET", "/api/v1/admission/detail", "")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("undocumented operation is not rejected: %d", rec.Code)
+	}
+
+	// The body is still readable by the handler after being validated.
+	echo := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			t.Errorf("cannot decode request body: %v", err)
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(writer).Encode(body)
+	})
+	rec = serve(checker.Handler(echo), "POST", "/api/v1/admission/submit", `{"id": "a", "nama": "b"}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("valid request is not served: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Files are streamed, they cannot be replaced.
+	redirect := http.RedirectHandler("/file", http.StatusFound)
+	checker.Template = func(*http.Request) string { return "/api/v1/template/download/{path:.+}" }
+	rec = serve(checker.Handler(redirect), "GET", "/api/v1/template/download/a/b.docx", "")
+	if rec.Code != http.StatusFound {
+		t.Errorf("redirect is not written: %d", rec.Code)
+	}
+}
+
+func TestCheckerLog(t *testing.T) {
+	checker := newChecker(t, openapi.ModeLog)
+
+	rec := serve(checker.Handler(jsonHandler(`{"id": "a"}`)), "GET", "/api/v1/admission/get", "")
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"id": "a"}` {
+		t.Errorf("mismatches must only be logged: %d %s", rec.Code, rec.Body.String())
+	}
+
+	handler := jsonHandler(`{}`)
+	if h := newChecker(t, openapi.ModeOff).Handler(handler); reflect.ValueOf(h).Pointer() != reflect.ValueOf(handler).Pointer() {
+		t.Error("off mode must not wrap the handler")
+	}
+}
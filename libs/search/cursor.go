@@ -0,0 +1,46 @@
+package search
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// ErrCursorInvalid is returned by DecodeCursor if a cursor is malformed.
+var ErrCursorInvalid = errors.New("cursor is invalid")
+
+// Cursor is the position of a row in a list sorted by a key and an ID, used by keyset (cursor) pagination. The next
+// page starts right after the row of the cursor. Unlike page numbers, cursors do not skip or repeat rows when rows are
+// added or removed between requests, and do not get slower as the pages go further.
+type Cursor struct {
+	// Sort is the sort order the cursor was created with. A cursor cannot be used with another sort order.
+	Sort string `json:"s"`
+
+	// Key is the sort key of the row, as text. Nil if the sort key of the row is null.
+	Key *string `json:"k"`
+
+	// Id is the ID of the row, which breaks the ties between rows with the same sort key.
+	Id string `json:"i"`
+}
+
+// EncodeCursor encodes a cursor into an opaque URL-safe string.
+func EncodeCursor(cursor *Cursor) string {
+	b, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor decodes a cursor encoded by EncodeCursor. It returns ErrCursorInvalid if s is not a cursor.
+func DecodeCursor(s string) (cursor *Cursor, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrCursorInvalid
+	}
+
+	cursor = &Cursor{}
+	err = json.Unmarshal(b, cursor)
+	if err != nil || cursor.Id == "" {
+		return nil, ErrCursorInvalid
+	}
+
+	return cursor, nil
+}
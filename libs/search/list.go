@@ -33,6 +33,10 @@ type PaginatedListMetadata struct {
 	// HasNext indicates that there is still the next page.
 	// If next page is unknown, set this to true.
 	HasNext bool `json:"has_next"`
+
+	// NextCursor is the cursor of the next page, only set when the list is paginated with cursors and there is a next
+	// page. See Cursor.
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 // CreatePaginatedListMetadata calculates number of pages from pageNumber and countPerPage, and not start and end. Users
@@ -77,3 +81,18 @@ func CreatePaginatedListMetadataNoTotalNext(pageNumber, resultLength int, hasNex
 	}
 	return meta
 }
+
+// CreateCursorListMetadata creates the metadata of a list paginated with cursors. Cursor pagination does not count
+// the total entries nor number the pages, Total, TotalPages and PageNumber are set to -1. There is a next page if
+// nextCursor is not empty.
+func CreateCursorListMetadata(resultLength int, nextCursor string) *PaginatedListMetadata {
+	meta := &PaginatedListMetadata{
+		Subtotal:   resultLength,
+		Total:      -1,
+		TotalPages: -1,
+		PageNumber: -1,
+		HasNext:    nextCursor != "",
+		NextCursor: nextCursor,
+	}
+	return meta
+}
@@ -0,0 +1,33 @@
+package search_test
+
+import (
+	"testing"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/search"
+)
+
+func TestCursor(t *testing.T) {
+	key := "2024-01-02 00:00:00+07"
+	for _, cursor := range []*search.Cursor{
+		{Sort: "-tgl_usulan", Key: &key, Id: "a"},
+		{Sort: "no_usulan", Id: "b"},
+	} {
+		decoded, err := search.DecodeCursor(search.EncodeCursor(cursor))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded.Sort != cursor.Sort || decoded.Id != cursor.Id || (decoded.Key == nil) != (cursor.Key == nil) {
+			t.Fatalf("cursor %+v is decoded as %+v", cursor, decoded)
+		}
+		if cursor.Key != nil && *decoded.Key != *cursor.Key {
+			t.Fatalf("key %s is decoded as %s", *cursor.Key, *decoded.Key)
+		}
+	}
+
+	for _, s := range []string{"", "not a cursor", search.EncodeCursor(&search.Cursor{Sort: "status"})} {
+		_, err := search.DecodeCursor(s)
+		if err != search.ErrCursorInvalid {
+			t.Fatalf("cursor %q is decoded, error %v", s, err)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+// Package validation validates structs against the rules declared in their `validate` field tags, e.g.
+// `validate:"required,uuid"`. Every invalid field is reported, not only the first one.
+//
+// The supported rules are:
+//   - required: the field must not be the zero value, slices and maps must not be empty.
+//   - uuid: the field must be a UUID string.
+//   - iso_date: the field must be a date string in ISO 8601 format (YYYY-MM-DD).
+//   - nip: the field must be an 18-digit NIP (Nomor Induk Pegawai), starting with a date of birth, then a year and a
+//     month of appointment and a gender digit.
+//   - enum=name: the field must be one of the values of the enum registered as name, see Validator.RegisterEnum.
+//   - min=n, max=n: numbers must be at least or at most n, strings, slices and maps must have at least or at most n
+//     characters or elements.
+//
+// Rules other than required are not evaluated on zero values, so optional fields can be left empty. Nested structs,
+// pointers to structs and slices of them are validated too. Fields are named by their json tag, or by their schema
+// tag, so that errors can be matched with the request.
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// TagName is the name of the field tag holding the rules.
+const TagName = "validate"
+
+// FieldError is a field that failed a rule.
+type FieldError struct {
+	// Field is the path of the field, e.g. surat_pak.no_dokumen or jumlah_kebutuhan[0].jumlah.
+	Field string `json:"field"`
+	// Rule is the rule that failed, as written in the tag, e.g. enum=promotion_type.
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (f *FieldError) Error() string {
+	return f.Field + " " + f.Message
+}
+
+// Validator validates structs against their tags. Enums must be registered before validating, a Validator is then
+// safe for concurrent use.
+type Validator struct {
+	enums map[string]map[string]struct{}
+}
+
+// New creates a Validator without enums.
+func New() *Validator {
+	return &Validator{enums: make(map[string]map[string]struct{})}
+}
+
+// RegisterEnum registers the enum name used by the enum=name rule. values must be a map whose keys are the valid
+// values, such as map[int]struct{}, it panics otherwise. Values are compared with their fmt.Sprint form.
+func (v *Validator) RegisterEnum(name string, values interface{}) {
+	mapValue := reflect.ValueOf(values)
+	if mapValue.Kind() != reflect.Map {
+		panic(fmt.Sprintf("validation: values of enum %s must be a map, not %T", name, values))
+	}
+
+	enum := make(map[string]struct{}, mapValue.Len())
+	for _, key := range mapValue.MapKeys() {
+		enum[fmt.Sprint(key.Interface())] = struct{}{}
+	}
+	v.enums[name] = enum
+}
+
+// Validate validates obj, usually a pointer to a struct, and returns every field that failed a rule. It returns nil
+// if obj is valid. It panics if a tag uses an unknown rule or an unregistered enum.
+func (v *Validator) Validate(obj interface{}) (errs []*FieldError) {
+	v.validateValue(reflect.ValueOf(obj), "", &errs)
+	return errs
+}
+
+// validateValue validates the fields of value if it is a struct, or of the structs it points to or contains.
+func (v *Validator) validateValue(value reflect.Value, path string, errs *[]*FieldError) {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !value.IsNil() {
+			v.validateValue(value.Elem(), path, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			v.validateValue(value.Index(i), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case reflect.Struct:
+		v.validateStruct(value, path, errs)
+	}
+}
+
+// validateStruct validates the fields of a struct. Embedded structs share the path of the struct.
+func (v *Validator) validateStruct(value reflect.Value, path string, errs *[]*FieldError) {
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		fieldPath := path
+		if !field.Anonymous {
+			fieldPath = joinPath(path, fieldName(field))
+		}
+
+		fieldValue := value.Field(i)
+		if tag, ok := field.Tag.Lookup(TagName); ok && tag != "" && tag != "-" {
+			v.validateField(fieldValue, fieldPath, tag, errs)
+		}
+		v.validateValue(fieldValue, fieldPath, errs)
+	}
+}
+
+// validateField evaluates the rules of tag on a single field.
+func (v *Validator) validateField(value reflect.Value, path string, tag string, errs *[]*FieldError) {
+	rules := strings.Split(tag, ",")
+	if isEmpty(value) {
+		for _, rule := range rules {
+			if rule == "required" {
+				*errs = append(*errs, &FieldError{Field: path, Rule: rule, Message: "is required"})
+			}
+		}
+		return
+	}
+
+	for _, rule := range rules {
+		name, param := rule, ""
+		if i := strings.IndexByte(rule, '='); i >= 0 {
+			name, param = rule[:i], rule[i+1:]
+		}
+
+		message := ""
+		switch name {
+		case "required":
+		case "uuid":
+			if _, err := uuid.Parse(stringOf(value)); err != nil {
+				message = "must be a UUID"
+			}
+		case "iso_date":
+			if _, err := time.Parse("2006-01-02", stringOf(value)); err != nil {
+				message = "must be a date in YYYY-MM-DD format"
+			}
+		case "nip":
+			if !IsNip(stringOf(value)) {
+				message = "must be an 18-digit NIP"
+			}
+		case "enum":
+			enum, ok := v.enums[param]
+			if !ok {
+				panic(fmt.Sprintf("validation: enum %s of %s is not registered", param, path))
+			}
+			if _, ok = enum[fmt.Sprint(value.Interface())]; !ok {
+				message = "must be one of " + strings.Join(sortedEnumValues(enum), ", ")
+			}
+		case "min", "max":
+			limit, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				panic(fmt.Sprintf("validation: %s of %s is not a number", rule, path))
+			}
+			size, unit := sizeOf(value)
+			if name == "min" && size < limit {
+				message = "must be at least " + param + unit
+			}
+			if name == "max" && size > limit {
+				message = "must be at most " + param + unit
+			}
+		default:
+			panic(fmt.Sprintf("validation: unknown rule %s of %s", rule, path))
+		}
+
+		if message != "" {
+			*errs = append(*errs, &FieldError{Field: path, Rule: rule, Message: message})
+		}
+	}
+}
+
+// IsNip returns true if s is an 18-digit NIP: a date of birth (YYYYMMDD), a year and a month of appointment (YYYYMM),
+// a gender digit (1 or 2) and a 3-digit sequence number.
+func IsNip(s string) bool {
+	if len(s) != 18 {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	if _, err := time.Parse("20060102", s[:8]); err != nil {
+		return false
+	}
+	if _, err := time.Parse("200601", s[8:14]); err != nil {
+		return false
+	}
+	return s[14] == '1' || s[14] == '2'
+}
+
+// fieldName returns the name of a field in its json tag, or in its schema tag, or its Go name.
+func fieldName(field reflect.StructField) string {
+	for _, tagName := range []string{"json", "schema"} {
+		name := strings.Split(field.Tag.Get(tagName), ",")[0]
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// isEmpty returns true if value is the zero value, or an empty slice or map.
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	default:
+		return value.IsZero()
+	}
+}
+
+// stringOf returns the string of a string field, or an empty string if the field is not a string, which then fails
+// the string rules.
+func stringOf(value reflect.Value) string {
+	if value.Kind() != reflect.String {
+		return ""
+	}
+	return value.String()
+}
+
+// sizeOf returns the number compared by the min and max rules, and its unit in the messages.
+func sizeOf(value reflect.Value) (size float64, unit string) {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), ""
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(value.Len()), " elements"
+	default:
+		return 0, ""
+	}
+}
+
+// sortedEnumValues returns the values of an enum sorted, numbers in numeric order.
+func sortedEnumValues(enum map[string]struct{}) []string {
+	values := make([]string, 0, len(enum))
+	for value := range enum {
+		values = append(values, value)
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		a, errA := strconv.ParseFloat(values[i], 64)
+		b, errB := strconv.ParseFloat(values[j], 64)
+		if errA == nil && errB == nil {
+			return a < b
+		}
+		return values[i] < values[j]
+	})
+	return values
+}
@@ -0,0 +1,121 @@
+package validation_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/validation"
+)
+
+type document struct {
+	Filename string `json:"nama_file" validate:"required"`
+}
+
+type options struct {
+	Sort string `schema:"urutan" validate:"max=10"`
+}
+
+type request struct {
+	options
+	Id        string      `json:"id" validate:"uuid"`
+	Name      string      `json:"nama" validate:"required,min=3"`
+	Date      string      `json:"tgl" validate:"required,iso_date"`
+	Type      int         `json:"jenis" validate:"required,enum=type"`
+	Nip       string      `json:"nip" validate:"nip"`
+	Count     int         `json:"jumlah" validate:"min=1,max=100"`
+	Attendees []string    `json:"peserta" validate:"required"`
+	Letter    *document   `json:"surat" validate:"required"`
+	Documents []*document `json:"dokumen"`
+	Ignored   string      `json:"-"`
+}
+
+func newValidator() *validation.Validator {
+	v := validation.New()
+	v.RegisterEnum("type", map[int]struct{}{1: {}, 2: {}, 10: {}})
+	return v
+}
+
+func TestValidate(t *testing.T) {
+	v := newValidator()
+
+	valid := &request{
+		Id:        "0b4e1d0c-9b0e-4f43-a8f5-3f1f3c1a2b3c",
+		Name:      "Budi",
+		Date:      "2024-02-29",
+		Type:      10,
+		Nip:       "198503302010011002",
+		Attendees: []string{"a"},
+		Letter:    &document{Filename: "a.pdf"},
+		Documents: []*document{{Filename: "b.pdf"}},
+	}
+	if errs := v.Validate(valid); errs != nil {
+		t.Fatalf("valid request has errors: %v", errs)
+	}
+
+	invalid := &request{
+		options:   options{Sort: "tgl_usulan,status"},
+		Id:        "not-a-uuid",
+		Name:      "Bu",
+		Date:      "29-02-2024",
+		Type:      3,
+		Nip:       "198513302010011002",
+		Count:     101,
+		Documents: []*document{{Filename: "b.pdf"}, {}},
+	}
+	errs := v.Validate(invalid)
+
+	expected := map[string]string{
+		"urutan":               "max=10",
+		"id":                   "uuid",
+		"nama":                 "min=3",
+		"tgl":                  "iso_date",
+		"jenis":                "enum=type",
+		"nip":                  "nip",
+		"jumlah":               "max=100",
+		"peserta":              "required",
+		"surat":                "required",
+		"dokumen[1].nama_file": "required",
+	}
+	if len(errs) != len(expected) {
+		b, _ := json.Marshal(errs)
+		t.Fatalf("expected %d errors, got %s", len(expected), b)
+	}
+	for _, err := range errs {
+		if expected[err.Field] != err.Rule {
+			t.Errorf("unexpected error %s (%s)", err.Error(), err.Rule)
+		}
+		if err.Field == "jenis" && err.Message != "must be one of 1, 2, 10" {
+			t.Errorf("unexpected enum message: %s", err.Message)
+		}
+	}
+}
+
+func TestValidateUnknownRule(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("unknown rule does not panic")
+		}
+	}()
+
+	type unknown struct {
+		Name string `validate:"email"`
+	}
+	newValidator().Validate(&unknown{Name: "a"})
+}
+
+func TestIsNip(t *testing.T) {
+	for nip, valid := range map[string]bool{
+		"198503302010011002":  true,
+		"198503302010012002":  true,
+		"19850330201001100":   false,
+		"198503302010013002":  false,
+		"198502302010011002":  false,
+		"198503302010131002":  false,
+		"19850330201001100a":  false,
+		"1985033020100110021": false,
+	} {
+		if validation.IsNip(nip) != valid {
+			t.Errorf("IsNip(%s) must be %t", nip, valid)
+		}
+	}
+}
@@ -2,9 +2,13 @@ package main
 
 import (
 	"context"
-	"database/sql"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -17,14 +21,19 @@ import (
 	"github.com/fazrithe/siasn-jf-backend-git/libs/breaker"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/config"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/docx"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/email"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/fakeoidc"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/httputil"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/logutil"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/metricutil"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/openapi"
 	"github.com/fazrithe/siasn-jf-backend-git/store"
+	"github.com/fazrithe/siasn-jf-backend-git/store/esign"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+	"github.com/fazrithe/siasn-jf-backend-git/store/notify"
 	"github.com/fazrithe/siasn-jf-backend-git/store/object"
 	"github.com/go-redis/cache/v8"
 	"github.com/go-redis/redis/v8"
-	_ "github.com/jackc/pgx/v4/stdlib"
 )
 
 // version variable is left empty as it is populated in compile time by the linker.
@@ -47,6 +56,42 @@ const (
 	OidcSessionBackendRedis = "redis"
 )
 
+const (
+	// ObjectStorageBackendEmcEcs stores files in EMC ECS. EMC_ECS_* configs must be configured.
+	ObjectStorageBackendEmcEcs = "emcecs"
+	// ObjectStorageBackendLocal stores files in LOCAL_STORAGE_DIR and serves signed URLs under LOCAL_STORAGE_URL.
+	// It is meant for local development only.
+	ObjectStorageBackendLocal = "local"
+)
+
+const (
+	// SignerBackendBsre signs documents with the BSrE esign API. BSRE_* configs must be configured.
+	SignerBackendBsre = "bsre"
+	// SignerBackendFake does not really sign documents. It is meant for local development only.
+	SignerBackendFake = "fake"
+)
+
+const (
+	// DocxRendererSiasn renders docx templates with the siasn-docx command.
+	DocxRendererSiasn = "siasn"
+	// DocxRendererNative renders docx templates in process.
+	DocxRendererNative = "native"
+)
+
+const (
+	// EmailBackendSmtp sends notification emails through an SMTP server. SMTP_* configs must be configured.
+	EmailBackendSmtp = "smtp"
+	// EmailBackendNone does not send notification emails.
+	EmailBackendNone = "none"
+)
+
+// smtpSslModes maps SMTP_SSL_MODE config values to email.SslModeUnencrypted and others.
+var smtpSslModes = map[string]int{
+	"none":     email.SslModeUnencrypted,
+	"ssl":      email.SslModeSsl,
+	"starttls": email.SslModeStartTls,
+}
+
 func main() {
 	logutil.SetDefaultLogger(logutil.NewStdLogger(logutil.IsSupportColor(), "main"))
 	globalConfig := NewConfigDefault()
@@ -54,25 +99,23 @@ func main() {
 	sc := &config.ServiceConfig{
 		Prefix:         "SIASN_JF",
 		ArraySeparator: " ",
+		// The configuration file cannot be set in itself.
+		File: os.Getenv("SIASN_JF_CONFIG_FILE"),
 	}
-	err := sc.ParseTo(globalConfig)
+	mustLoadConfig(globalConfig, sc)
+
+	corsOrigins := newOriginList(nil)
+	err := applyReloadable(globalConfig, corsOrigins, nil)
 	if err != nil {
 		logutil.Errorf("cannot parse configuration: %v", err)
 		os.Exit(1)
 	}
-
-	mustLoadConfig(globalConfig, sc)
 	logutil.SetDefaultLogger(createLogger(globalConfig, "main"))
 	logutil.Debugf("using configuration: %s", globalConfig.AsString())
 	logutil.Infof("version: %s", version)
 
-	rcb := &breaker.RateCircuitBreaker{
-		Limit:    3,
-		Cooldown: 10 * time.Second,
-		Logger:   createLogger(globalConfig, "breaker"),
-	}
-
-	db, err := sql.Open("pgx", globalConfig.PostgresUrl)
+	// Each dependency has its own circuit breaker, so that a failing dependency only fails the requests that need it.
+	db, err := openPostgres(globalConfig, "postgres", globalConfig.PostgresUrl)
 	if err != nil {
 		logutil.Errorf("cannot initiate connection to database: %v", err)
 		os.Exit(1)
@@ -92,7 +135,17 @@ func main() {
 	}
 	logutil.Tracef("primary database can be pinged successfully")
 
-	profileDb, err := sql.Open("pgx", globalConfig.ProfilePostgresUrl)
+	// `siasn-jf-backend migrate ...` only needs the primary database, it exits without starting the service.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = runMigrate(db, createLogger(globalConfig, "migrate"), os.Args[2:])
+		if err != nil {
+			logutil.Errorf("cannot migrate database: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	profileDb, err := openPostgres(globalConfig, "profile_postgres", globalConfig.ProfilePostgresUrl)
 	if err != nil {
 		logutil.Errorf("cannot initiate connection to profile database: %v", err)
 		os.Exit(1)
@@ -109,7 +162,7 @@ func main() {
 	}
 	logutil.Tracef("profile database can be pinged successfully")
 
-	referenceDb, err := sql.Open("pgx", globalConfig.ReferencePostgresUrl)
+	referenceDb, err := openPostgres(globalConfig, "reference_postgres", globalConfig.ReferencePostgresUrl)
 	if err != nil {
 		logutil.Errorf("cannot initiate connection to profile database: %v", err)
 		os.Exit(1)
@@ -126,55 +179,163 @@ func main() {
 	}
 	logutil.Tracef("reference database can be pinged successfully")
 
-	s3Config := &aws.Config{
-		Credentials:      credentials.NewStaticCredentials(globalConfig.EmcEcsAccessKey, globalConfig.EmcEcsSecretKey, ""),
-		Endpoint:         aws.String(globalConfig.EmcEcsEndpoint),
-		Region:           aws.String(globalConfig.EmcEcsRegion),
-		S3ForcePathStyle: aws.Bool(true),
+	var storage object.Storage
+	var storageHandler http.Handler
+	var storageHandlerPath string
+	switch globalConfig.ObjectStorageBackend {
+	case ObjectStorageBackendEmcEcs:
+		s3Config := &aws.Config{
+			Credentials:      credentials.NewStaticCredentials(globalConfig.EmcEcsAccessKey, globalConfig.EmcEcsSecretKey, ""),
+			Endpoint:         aws.String(globalConfig.EmcEcsEndpoint),
+			Region:           aws.String(globalConfig.EmcEcsRegion),
+			S3ForcePathStyle: aws.Bool(true),
+			HTTPClient: &http.Client{
+				Transport: &breaker.Transport{Breaker: createBreaker(globalConfig, "object_storage", nil)},
+			},
+		}
+
+		sess, err := session.NewSession(s3Config)
+		if err != nil {
+			logutil.Errorf("cannot connect to object storage: %v", err)
+			os.Exit(1)
+			return
+		}
+		svc := s3.New(sess)
+
+		storage = &object.EmcEcsStorage{
+			Client:                                 ecs.New(svc),
+			Logger:                                 createLogger(globalConfig, "emcecs"),
+			TempBucket:                             globalConfig.TempBucket,
+			TempActivityDir:                        globalConfig.TempActivityDir,
+			ActivityBucket:                         globalConfig.ActivityBucket,
+			ActivityDir:                            globalConfig.ActivityDir,
+			TempRequirementDir:                     globalConfig.TempRequirementDir,
+			RequirementBucket:                      globalConfig.RequirementBucket,
+			RequirementDir:                         globalConfig.RequirementDir,
+			RequirementTemplateDir:                 globalConfig.RequirementTemplateDir,
+			RequirementTemplateCoverLetterFilename: globalConfig.RequirementTemplateCoverLetterFilename,
+			TempDismissalDir:                       globalConfig.TempDismissalDir,
+			DismissalBucket:                        globalConfig.DismissalBucket,
+			DismissalDir:                           globalConfig.DismissalDir,
+			DismissalTemplateDir:                   globalConfig.DismissalTemplateDir,
+			DismissalTemplateAcceptanceLetterFilename: globalConfig.DismissalTemplateAcceptanceLetterFilename,
+			PromotionBucket:                               globalConfig.PromotionBucket,
+			TempPromotionDir:                              globalConfig.TempPromotionDir,
+			PromotionDir:                                  globalConfig.PromotionDir,
+			PromotionTemplateDir:                          globalConfig.PromotionTemplateDir,
+			PromotionTemplatePakLetterFilename:            globalConfig.PromotionTemplatePakLetterFilename,
+			PromotionTemplateRecommendationLetterFilename: globalConfig.PromotionTemplateRecommendationLetterFilename,
+			PromotionCpnsBucket:                           globalConfig.PromotionCpnsBucket,
+			TempPromotionCpnsDir:                          globalConfig.TempPromotionCpnsDir,
+			PromotionCpnsDir:                              globalConfig.PromotionCpnsDir,
+			AssessmentTeamBucket:                          globalConfig.AssessmentTeamBucket,
+			TempAssessmentTeamDir:                         globalConfig.TempAssessmentTeamDir,
+			AssessmentTeamDir:                             globalConfig.AssessmentTeamDir,
+			SignUrlExpire:                                 1 * time.Hour,
+		}
+	case ObjectStorageBackendLocal:
+		localStorage, err := createLocalFsStorage(globalConfig)
+		if err != nil {
+			logutil.Errorf("cannot initialize local object storage: %v", err)
+			os.Exit(1)
+			return
+		}
+		localStorage.Logger = createLogger(globalConfig, "localfs")
+		logutil.Warnf("using local object storage in %s, do not use it in production", localStorage.RootDir)
+
+		storage = localStorage
+		storageHandler = localStorage
+		storageHandlerPath = localStorage.BaseUrl.Path
+	default:
+		logutil.Errorf("cannot initialize object storage, unknown OBJECT_STORAGE_BACKEND: %s, can only be \"emcecs\" or \"local\"", globalConfig.ObjectStorageBackend)
+		os.Exit(1)
+		return
 	}
 
-	sess, err := session.NewSession(s3Config)
-	if err != nil {
-		logutil.Errorf("cannot connect to object storage: %v", err)
+	var signer esign.Signer
+	switch globalConfig.SignerBackend {
+	case SignerBackendBsre:
+		bsreSigner := esign.NewBsreSigner(globalConfig.BsreUrl, globalConfig.BsreUsername, globalConfig.BsrePassword)
+		bsreSigner.Client.Timeout = store.TimeoutSign
+		bsreSigner.Visible = globalConfig.BsreVisible
+		bsreSigner.Tag = globalConfig.BsreTag
+		bsreSigner.Width = globalConfig.BsreWidth
+		bsreSigner.Height = globalConfig.BsreHeight
+		bsreSigner.ImagePath = globalConfig.BsreImagePath
+		signer = bsreSigner
+	case SignerBackendFake:
+		logutil.Warn("using fake electronic signature, signed documents are not legally valid")
+		signer = &esign.FakeSigner{}
+	default:
+		logutil.Errorf("cannot initialize signer, unknown SIGNER_BACKEND: %s, can only be \"bsre\" or \"fake\"", globalConfig.SignerBackend)
+		os.Exit(1)
+		return
+	}
+	signer = &breakerSigner{signer: signer, breaker: createBreaker(globalConfig, "esign", isSignerFailure)}
+
+	var renderer docx.Renderer
+	switch globalConfig.DocxRenderer {
+	case DocxRendererSiasn:
+		renderer = &docx.SiasnRenderer{
+			DocxCmd:    globalConfig.SiasnDocxCmd,
+			SofficeCmd: globalConfig.SofficeCmd,
+		}
+	case DocxRendererNative:
+		renderer = &docx.NativeRenderer{
+			SofficeCmd: globalConfig.SofficeCmd,
+		}
+	default:
+		logutil.Errorf("cannot initialize docx renderer, unknown DOCX_RENDERER: %s, can only be \"siasn\" or \"native\"", globalConfig.DocxRenderer)
 		os.Exit(1)
 		return
 	}
-	svc := s3.New(sess)
-
-	storeClient := store.NewClient(db, profileDb, referenceDb, &object.EmcEcsStorage{
-		Client:                                 ecs.New(svc),
-		Logger:                                 createLogger(globalConfig, "emcecs"),
-		TempBucket:                             globalConfig.TempBucket,
-		TempActivityDir:                        globalConfig.TempActivityDir,
-		ActivityBucket:                         globalConfig.ActivityBucket,
-		ActivityDir:                            globalConfig.ActivityDir,
-		TempRequirementDir:                     globalConfig.TempRequirementDir,
-		RequirementBucket:                      globalConfig.RequirementBucket,
-		RequirementDir:                         globalConfig.RequirementDir,
-		RequirementTemplateDir:                 globalConfig.RequirementTemplateDir,
-		RequirementTemplateCoverLetterFilename: globalConfig.RequirementTemplateCoverLetterFilename,
-		TempDismissalDir:                       globalConfig.TempDismissalDir,
-		DismissalBucket:                        globalConfig.DismissalBucket,
-		DismissalDir:                           globalConfig.DismissalDir,
-		DismissalTemplateDir:                   globalConfig.DismissalTemplateDir,
-		DismissalTemplateAcceptanceLetterFilename: globalConfig.DismissalTemplateAcceptanceLetterFilename,
-		PromotionBucket:                    globalConfig.PromotionBucket,
-		TempPromotionDir:                   globalConfig.TempPromotionDir,
-		PromotionDir:                       globalConfig.PromotionDir,
-		PromotionTemplateDir:               globalConfig.PromotionTemplateDir,
-		PromotionTemplatePakLetterFilename: globalConfig.PromotionTemplatePakLetterFilename,
-		PromotionCpnsBucket:                globalConfig.PromotionCpnsBucket,
-		TempPromotionCpnsDir:               globalConfig.TempPromotionCpnsDir,
-		PromotionCpnsDir:                   globalConfig.PromotionCpnsDir,
-		AssessmentTeamBucket:               globalConfig.AssessmentTeamBucket,
-		TempAssessmentTeamDir:              globalConfig.TempAssessmentTeamDir,
-		AssessmentTeamDir:                  globalConfig.AssessmentTeamDir,
-		SignUrlExpire:                      1 * time.Hour,
-	}, &docx.SiasnRenderer{
-		DocxCmd:    globalConfig.SiasnDocxCmd,
-		SofficeCmd: globalConfig.SofficeCmd,
-	}, sqlMetrics, rcb)
+	renderer = &breakerRenderer{renderer: renderer, breaker: createBreaker(globalConfig, "docx_renderer", isRendererFailure)}
+
+	storeClient := store.NewClient(db, profileDb, referenceDb, storage, renderer, signer, sqlMetrics)
 	storeClient.Logger = createLogger(globalConfig, "store")
+	storeClient.Jobs.Workers = globalConfig.JobWorkers
+	storeClient.Jobs.MaxAttempts = globalConfig.JobMaxAttempts
+
+	storeClient.TrustedProxies, err = store.ParseTrustedProxies(globalConfig.TrustedProxies)
+	if err != nil {
+		logutil.Errorf("cannot parse TRUSTED_PROXIES: %v", err)
+		os.Exit(1)
+		return
+	}
+
+	switch globalConfig.EmailBackend {
+	case EmailBackendSmtp:
+		sslMode, ok := smtpSslModes[globalConfig.SmtpSslMode]
+		if !ok {
+			logutil.Errorf("cannot initialize email, unknown SMTP_SSL_MODE: %s, can only be \"none\", \"ssl\" or \"starttls\"", globalConfig.SmtpSslMode)
+			os.Exit(1)
+			return
+		}
+		emailDaemon := email.NewDaemon(globalConfig.SmtpAddress, globalConfig.SmtpUsername, globalConfig.SmtpPassword, sslMode)
+		emailDaemon.Logger = createLogger(globalConfig, "email")
+		go emailDaemon.Start()
+		emailNotifier := notify.NewEmailNotifier(emailDaemon, globalConfig.EmailFrom)
+		emailNotifier.AppUrl = globalConfig.EmailAppUrl
+		storeClient.Notifier = emailNotifier
+	case EmailBackendNone:
+	default:
+		logutil.Errorf("cannot initialize email, unknown EMAIL_BACKEND: %s, can only be \"smtp\" or \"none\"", globalConfig.EmailBackend)
+		os.Exit(1)
+		return
+	}
+
+	endSessionEndpoint := globalConfig.OidcEndSessionEndpoint
+	var fakeProvider *fakeoidc.Provider
+	if globalConfig.OidcFakeProvider {
+		logutil.Warnf("OIDC_FAKE_PROVIDER is on, anyone can log in as the users of OIDC_FAKE_USERS, never use it in production")
+		fakeProvider, err = startFakeOidcProvider(globalConfig)
+		if err != nil {
+			logutil.Errorf("cannot start fake OIDC provider: %v", err)
+			os.Exit(1)
+			return
+		}
+		endSessionEndpoint = fakeProvider.Issuer + fakeoidc.PathEndSession
+	}
 
 	authHandler, err := auth.NewAuth(
 		globalConfig.OidcProviderUrl,
@@ -182,7 +343,7 @@ func main() {
 		referenceDb,
 		globalConfig.OidcClientId,
 		globalConfig.OidcClientSecret,
-		globalConfig.OidcEndSessionEndpoint,
+		endSessionEndpoint,
 		globalConfig.OidcRedirectUrl,
 		globalConfig.OidcSuccessRedirectUrl,
 	)
@@ -191,68 +352,113 @@ func main() {
 		os.Exit(1)
 		return
 	}
+	// Impersonated users keep the roles they have as staff.
+	authHandler.UserRoles = storeClient.GetStaffRolesCtx
+	if fakeProvider != nil {
+		// The users of the fake provider are not in the ASN profile DB, and their roles are those of the provider.
+		authHandler.UserDetailGetter = fakeProvider
+		authHandler.UserRoles = fakeProvider.GetUserRoles
+	}
+	// Sessions record the same client IP addresses as the status histories.
+	authHandler.ClientIpAddress = storeClient.ClientIpAddress
+	authHandler.ServiceAccounts, err = auth.ParseServiceAccounts(globalConfig.ServiceAccounts)
+	if err != nil {
+		logutil.Errorf("cannot parse SERVICE_ACCOUNTS: %v", err)
+		os.Exit(1)
+		return
+	}
+	// BKN administrators impersonate to reproduce what other users see, they are never given their own role.
+	authHandler.ImpersonationMaxDuration = time.Duration(globalConfig.ImpersonationMaxDuration) * time.Minute
+	authHandler.ImpersonationRoles = []string{models.RolePembina, models.RoleAgencyAdmin, models.RoleVerifier, models.RoleSupervisor}
+	loginChecker.IsStaff = storeClient.IsStaffCtx
+	// Denied users can log out from the provider to log in with another account.
+	loginChecker.LogoutUrl = endSessionEndpoint
+	loginChecker.Logger = createLogger(globalConfig, "login")
+	loginChecker.Metrics = loginMetrics
+	authHandler.LoginChecker = loginChecker
+	var redisClient *redis.Client
 	switch globalConfig.OidcSessionBackend {
 	case OidcSessionBackendMemory:
-		authHandler.AccessTokenCache = auth.NewMemoryAccessTokenCache()
+		memoryTokenCache := auth.NewMemoryAccessTokenCache()
+		authHandler.AccessTokenCache = memoryTokenCache
+		authHandler.SessionCache = memoryTokenCache
 	case OidcSessionBackendRedis:
+		redisClient = redis.NewClient(&redis.Options{
+			Addr:     globalConfig.RedisAddress,
+			Username: globalConfig.RedisUsername,
+			Password: globalConfig.RedisPassword,
+			DB:       globalConfig.RedisDbIndex,
+		})
 		sessionCache := cache.New(&cache.Options{
-			Redis: redis.NewClient(&redis.Options{
-				Addr:     globalConfig.RedisAddress,
-				Username: globalConfig.RedisUsername,
-				Password: globalConfig.RedisPassword,
-				DB:       globalConfig.RedisDbIndex,
-			}),
+			Redis: redisClient,
 		})
 		redisTokenCache := auth.NewRedisAccessTokenCache(sessionCache)
 		redisTokenCache.Prefix = "jf"
+		redisTokenCache.Redis = redisClient
 		authHandler.AccessTokenCache = redisTokenCache
+		authHandler.SessionCache = redisTokenCache
 	default:
 		logutil.Errorf("cannot initialize session cache, unknown OIDC_SESSION_BACKEND: %s, can only be \"memory\" or \"redis\"", globalConfig.OidcSessionBackend)
 		os.Exit(1)
 		return
 	}
 
+	// Run the document generation jobs until the server is shut down.
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go storeClient.RunJobWorkers(jobCtx)
+
+	// Check the dependencies in the background, so that the health gauges are up to date between probes.
+	healthChecker := createHealthChecker(globalConfig, db, profileDb, referenceDb, redisClient, storage)
+	go healthChecker.Run(jobCtx, healthCheckInterval)
+
+	// Every reloadable setting is in use from here on, reload them on SIGHUP.
+	go watchReload(globalConfig, sc, corsOrigins, healthChecker)
+
 	// Spawn the Prometheus metric server
 	prometheusServer := metricutil.NewPrometheusServer(globalConfig.PrometheusListenAddress)
 	prometheusServer.Logger = createLogger(globalConfig, "prometheus")
 	go prometheusServer.Start()
 
+	contractChecker, err := createContractChecker(globalConfig.ContractMode, createLogger(globalConfig, "contract"))
+	if err != nil {
+		logutil.Errorf("cannot initialize contract checker: %v", err)
+		os.Exit(1)
+		return
+	}
+	if contractChecker.Mode != openapi.ModeOff {
+		logutil.Infof("checking requests and responses against the OpenAPI document, mode: %s", contractChecker.Mode)
+	}
+
 	serverManager := httputil.NewServerManager()
 	serverManager.Logger = createLogger(globalConfig, "serverManager")
 
 	router := createRouter(
 		globalConfig.CorsAllowedHeaders,
 		globalConfig.CorsAllowedMethods,
-		globalConfig.CorsAllowedOrigins,
+		corsOrigins,
 		authHandler,
 		storeClient,
+		contractChecker,
+		healthChecker,
 		apiMetrics,
 		&logutil.AccessLoggerWriter{Logger: createLogger(globalConfig, "apiRouter")},
 	)
+	if storageHandler != nil {
+		router.PathPrefix(storageHandlerPath + "/").Handler(http.StripPrefix(storageHandlerPath, storageHandler))
+	}
 	serverManager.BatchSpawnHttp(globalConfig.ListenAddress, router)
 	if globalConfig.EnableTls {
 		serverManager.BatchSpawnHttps(globalConfig.TlsListenAddress, router, globalConfig.TlsCertFile, globalConfig.TlsKeyFile)
 	}
 
 	// Catch SIGTERM signal and shut down the system gracefully.
-	// If the CB is tripped, also throw exit code 1 and add a 30 second timer to shut down the system forcefully.
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
-		select {
-		case <-c:
-			logutil.Warn("shutting down")
-			serverManager.Shutdown()
-		case <-rcb.Tripped:
-			logutil.Warn("shutting down")
-			go func() {
-				logutil.Warn("forcing the system to shut down in 30 seconds")
-				time.Sleep(30 * time.Second)
-				os.Exit(1)
-			}()
-			serverManager.Shutdown()
-			os.Exit(1)
-		}
+		<-c
+		logutil.Warn("shutting down")
+		serverManager.Shutdown()
 	}()
 
 	time.Sleep(2 * time.Second)
@@ -266,6 +472,9 @@ func main() {
 // mustLoadConfig loads the configuration, and terminates the process if configuration cannot be loaded.
 func mustLoadConfig(cfg *Config, sc *config.ServiceConfig) {
 	err := sc.ParseTo(cfg)
+	if err == nil {
+		err = requireBackendConfig(cfg, sc)
+	}
 	if err != nil {
 		logutil.Errorf("cannot parse configuration: %s", err)
 		os.Exit(1)
@@ -279,7 +488,7 @@ func mustLoadConfig(cfg *Config, sc *config.ServiceConfig) {
 // Depending on the given config, if the config demands log to be written also to a file, then this function
 // will create a logger that outputs log to a file. If it demands logs only to be written to stdout, it will
 // create an logutil.StdLogger. Either way the returned logger is a type of loguitl.MultiLogger which contains either
-// an StdLogger, FileLogger, or both which will output logs to both outputs.
+// an StdLogger, FileLogger, or both which will output logs to both outputs. Messages below LOG_LEVEL are dropped.
 func createLogger(loggingConfig *Config, prefix string) logutil.Logger {
 	var loggers []logutil.Logger
 
@@ -291,5 +500,56 @@ func createLogger(loggingConfig *Config, prefix string) logutil.Logger {
 		loggers = append(loggers, logutil.NewFileLogger(loggingConfig.LoggingFilePath, prefix))
 	}
 
-	return logutil.NewMultiLogger(loggers...)
+	return logutil.NewLevelLogger(logutil.NewMultiLogger(loggers...), logLevel)
+}
+
+// createLocalFsStorage creates an object.LocalFsStorage based on the given configuration.
+// If LOCAL_STORAGE_SECRET is empty, a random key is generated, so signed URLs do not survive restarts.
+func createLocalFsStorage(globalConfig *Config) (*object.LocalFsStorage, error) {
+	baseUrl, err := url.Parse(globalConfig.LocalStorageUrl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LOCAL_STORAGE_URL: %w", err)
+	}
+	baseUrl.Path = strings.TrimSuffix(baseUrl.Path, "/")
+	if baseUrl.Path == "" || strings.HasPrefix(baseUrl.Path, "/api/v1") {
+		return nil, fmt.Errorf("LOCAL_STORAGE_URL must have a path outside of /api/v1, e.g. /api/object")
+	}
+
+	secretKey := []byte(globalConfig.LocalStorageSecret)
+	if len(secretKey) == 0 {
+		secretKey = make([]byte, 32)
+		_, err = rand.Read(secretKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s := object.NewLocalFsStorage(globalConfig.LocalStorageDir, baseUrl, secretKey)
+	s.TempBucket = globalConfig.TempBucket
+	s.TempActivityDir = globalConfig.TempActivityDir
+	s.ActivityBucket = globalConfig.ActivityBucket
+	s.ActivityDir = globalConfig.ActivityDir
+	s.TempRequirementDir = globalConfig.TempRequirementDir
+	s.RequirementBucket = globalConfig.RequirementBucket
+	s.RequirementDir = globalConfig.RequirementDir
+	s.RequirementTemplateDir = globalConfig.RequirementTemplateDir
+	s.RequirementTemplateCoverLetterFilename = globalConfig.RequirementTemplateCoverLetterFilename
+	s.TempDismissalDir = globalConfig.TempDismissalDir
+	s.DismissalBucket = globalConfig.DismissalBucket
+	s.DismissalDir = globalConfig.DismissalDir
+	s.DismissalTemplateDir = globalConfig.DismissalTemplateDir
+	s.DismissalTemplateAcceptanceLetterFilename = globalConfig.DismissalTemplateAcceptanceLetterFilename
+	s.TempPromotionDir = globalConfig.TempPromotionDir
+	s.PromotionBucket = globalConfig.PromotionBucket
+	s.PromotionDir = globalConfig.PromotionDir
+	s.PromotionTemplateDir = globalConfig.PromotionTemplateDir
+	s.PromotionTemplatePakLetterFilename = globalConfig.PromotionTemplatePakLetterFilename
+	s.PromotionTemplateRecommendationLetterFilename = globalConfig.PromotionTemplateRecommendationLetterFilename
+	s.PromotionCpnsBucket = globalConfig.PromotionCpnsBucket
+	s.TempPromotionCpnsDir = globalConfig.TempPromotionCpnsDir
+	s.PromotionCpnsDir = globalConfig.PromotionCpnsDir
+	s.AssessmentTeamBucket = globalConfig.AssessmentTeamBucket
+	s.TempAssessmentTeamDir = globalConfig.TempAssessmentTeamDir
+	s.AssessmentTeamDir = globalConfig.AssessmentTeamDir
+	return s, nil
 }
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/breaker"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/health"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/metricutil"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -72,3 +75,58 @@ var sqlMetrics = &metricutil.DefaultGenericSqlMetrics{
 		Buckets:   MetricRespTimeHistogramBucket},
 	),
 }
+
+var healthMetrics = &health.Metrics{
+	Up: promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricNamespace,
+		Subsystem: "health",
+		Name:      "dependency_up",
+		Help:      "Whether a dependency passed its last health check (1) or not (0).",
+	}, []string{"dependency"}),
+
+	CheckDurationSeconds: promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricNamespace,
+		Subsystem: "health",
+		Name:      "dependency_check_duration_seconds",
+		Help:      "The duration of the last health check of a dependency.",
+	}, []string{"dependency"}),
+}
+
+var breakerMetrics = &breaker.Metrics{
+	State: promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: MetricNamespace,
+		Subsystem: "breaker",
+		Name:      "state",
+		Help:      "The state of the circuit breaker of a dependency: closed (0), half-open (1) or open (2).",
+	}, []string{"dependency"}),
+
+	Transitions: promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricNamespace,
+		Subsystem: "breaker",
+		Name:      "transitions_total",
+		Help:      "Count the number of state changes of the circuit breaker of a dependency, labeled by the new state.",
+	}, []string{"dependency", "to"}),
+
+	Rejected: promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricNamespace,
+		Subsystem: "breaker",
+		Name:      "rejected_total",
+		Help:      "Count the number of calls to a dependency failed fast because its circuit breaker is open.",
+	}, []string{"dependency"}),
+}
+
+var loginMetrics = &auth.LoginMetrics{
+	Allowed: promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricNamespace,
+		Subsystem: "login",
+		Name:      "allowed_total",
+		Help:      "Count the number of logins allowed by the login policy, labeled by the rule that allowed them.",
+	}, []string{"rule"}),
+
+	Rejected: promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricNamespace,
+		Subsystem: "login",
+		Name:      "rejected_total",
+		Help:      "Count the number of logins rejected by the login policy, labeled by reason: denied or error.",
+	}, []string{"reason"}),
+}
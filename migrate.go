@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/logutil"
+	"github.com/fazrithe/siasn-jf-backend-git/migration"
+)
+
+// migrateUsage is printed when the migrate subcommand is called with invalid arguments.
+const migrateUsage = `usage: siasn-jf-backend migrate up|down [steps]|status
+
+  up      apply all pending migrations to the primary database
+  down    revert the last applied migration, or the last [steps] migrations
+  status  list all migrations and whether they have been applied`
+
+// TimeoutMigrate is the maximum duration of the migrate subcommand.
+const TimeoutMigrate = 10 * time.Minute
+
+// runMigrate runs the migrate subcommand against the primary database. args are the arguments after `migrate`.
+func runMigrate(db *sql.DB, logger logutil.Logger, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing migrate command\n%s", migrateUsage)
+	}
+
+	migrator, err := migration.NewMigrator(db)
+	if err != nil {
+		return fmt.Errorf("cannot load migrations: %w", err)
+	}
+	migrator.Logger = logger
+
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutMigrate)
+	defer cancel()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.UpCtx(ctx)
+		if err != nil {
+			return err
+		}
+		logger.Infof("%d migration(s) applied", len(applied))
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("invalid number of steps %s\n%s", args[1], migrateUsage)
+			}
+		}
+
+		reverted, err := migrator.DownCtx(ctx, steps)
+		if err != nil {
+			return err
+		}
+		logger.Infof("%d migration(s) reverted", len(reverted))
+	case "status":
+		statuses, err := migrator.StatusCtx(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = "applied at " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %s\n%s", args[0], migrateUsage)
+	}
+
+	return nil
+}
@@ -0,0 +1,314 @@
+// Package migration contains the versioned schema migrations of the primary database, embedded in the binary, and
+// a Migrator to apply and revert them.
+//
+// Migrations are stored in the sql directory as pairs of files named `<version>_<name>.up.sql` and
+// `<version>_<name>.down.sql`, e.g. `0001_initial_schema.up.sql`. Versions must be unique and are applied in ascending
+// order. Applied migrations are recorded in the schema_migrations table along with the SHA-256 checksum of their up
+// script, so that an applied migration that has been modified afterwards is detected instead of silently ignored.
+// Applied migration files must never be changed, add a new migration instead.
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/logutil"
+)
+
+//go:embed sql/*.sql
+var embedded embed.FS
+
+// DefaultTable is the name of the table recording applied migrations.
+const DefaultTable = "schema_migrations"
+
+// advisoryLockId is the key of the PostgreSQL advisory lock taken while migrating, so that two instances cannot
+// migrate the same database at the same time.
+const advisoryLockId = 7305920412
+
+var filenameRegexp = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+var (
+	// ErrChecksumMismatch is returned if the up script of an applied migration has been modified.
+	ErrChecksumMismatch = errors.New("checksum of applied migration does not match")
+	// ErrUnknownVersion is returned if the database contains an applied migration that is not known to this binary,
+	// usually because the database has been migrated by a newer version of the service.
+	ErrUnknownVersion = errors.New("database contains an unknown migration version")
+)
+
+// Migration is a single schema migration.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// Status is the status of a single migration in a database.
+type Status struct {
+	*Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// LoadMigrations reads migrations from sql/*.sql files in fsys. Every migration must have both an up and a down
+// script. The result is sorted by version.
+func LoadMigrations(fsys fs.FS) (migrations []*Migration, err error) {
+	filenames, err := fs.Glob(fsys, "sql/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, filename := range filenames {
+		match := filenameRegexp.FindStringSubmatch(path.Base(filename))
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration filename %s", filename)
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, m.Name, match[2])
+		}
+
+		content, err := fs.ReadFile(fsys, filename)
+		if err != nil {
+			return nil, err
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+			sum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down scripts", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrator applies and reverts migrations on a database.
+type Migrator struct {
+	Db         *sql.DB
+	Migrations []*Migration
+	// Table is the name of the table recording applied migrations, DefaultTable by default.
+	Table  string
+	Logger logutil.Logger
+}
+
+// NewMigrator creates a Migrator with the migrations embedded in the binary.
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := LoadMigrations(embedded)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		Db:         db,
+		Migrations: migrations,
+		Table:      DefaultTable,
+		Logger:     logutil.NewStdLogger(false, "migration"),
+	}, nil
+}
+
+// UpCtx applies all pending migrations in ascending order, each in its own transaction.
+// It returns the migrations that have been applied, which can be empty if the database is up-to-date.
+func (m *Migrator) UpCtx(ctx context.Context) (applied []*Migration, err error) {
+	err = m.withLockCtx(ctx, func(conn *sql.Conn) error {
+		statuses, err := m.statusCtx(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			if status.Applied {
+				continue
+			}
+
+			m.Logger.Infof("applying migration %d_%s", status.Version, status.Name)
+			err = m.execCtx(ctx, conn, status.Migration.Up, fmt.Sprintf("insert into %s(version, name, checksum, applied_at) values($1, $2, $3, current_timestamp)", m.Table), status.Version, status.Name, status.Checksum)
+			if err != nil {
+				return fmt.Errorf("cannot apply migration %d_%s: %w", status.Version, status.Name, err)
+			}
+			applied = append(applied, status.Migration)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// DownCtx reverts the last steps applied migrations in descending order, each in its own transaction.
+// It returns the migrations that have been reverted.
+func (m *Migrator) DownCtx(ctx context.Context, steps int) (reverted []*Migration, err error) {
+	err = m.withLockCtx(ctx, func(conn *sql.Conn) error {
+		statuses, err := m.statusCtx(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(statuses) - 1; i >= 0 && len(reverted) < steps; i-- {
+			status := statuses[i]
+			if !status.Applied {
+				continue
+			}
+
+			m.Logger.Infof("reverting migration %d_%s", status.Version, status.Name)
+			err = m.execCtx(ctx, conn, status.Migration.Down, fmt.Sprintf("delete from %s where version = $1", m.Table), status.Version)
+			if err != nil {
+				return fmt.Errorf("cannot revert migration %d_%s: %w", status.Version, status.Name, err)
+			}
+			reverted = append(reverted, status.Migration)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// StatusCtx returns the status of every known migration, sorted by version. It also verifies the checksums of
+// applied migrations.
+func (m *Migrator) StatusCtx(ctx context.Context) (statuses []*Status, err error) {
+	conn, err := m.Db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	err = m.ensureTableCtx(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.statusCtx(ctx, conn)
+}
+
+// withLockCtx runs f with a dedicated connection holding the migration advisory lock. It also makes sure that the
+// migration table exists.
+func (m *Migrator) withLockCtx(ctx context.Context, f func(conn *sql.Conn) error) (err error) {
+	conn, err := m.Db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "select pg_advisory_lock($1)", advisoryLockId)
+	if err != nil {
+		return fmt.Errorf("cannot acquire migration lock: %w", err)
+	}
+	defer func() {
+		_, _ = conn.ExecContext(context.Background(), "select pg_advisory_unlock($1)", advisoryLockId)
+	}()
+
+	err = m.ensureTableCtx(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	return f(conn)
+}
+
+// ensureTableCtx creates the migration table if it does not exist yet.
+func (m *Migrator) ensureTableCtx(ctx context.Context, conn *sql.Conn) (err error) {
+	_, err = conn.ExecContext(ctx, fmt.Sprintf("create table if not exists %s (version bigint primary key, name text not null, checksum text not null, applied_at timestamptz not null)", m.Table))
+	if err != nil {
+		return fmt.Errorf("cannot create %s table: %w", m.Table, err)
+	}
+	return nil
+}
+
+// statusCtx reads the migration table and matches it with the known migrations.
+func (m *Migrator) statusCtx(ctx context.Context, conn *sql.Conn) (statuses []*Status, err error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("select version, checksum, applied_at from %s order by version", m.Table))
+	if err != nil {
+		return nil, fmt.Errorf("cannot query %s: %w", m.Table, err)
+	}
+	defer rows.Close()
+
+	statusMap := make(map[int]*Status)
+	for _, migration := range m.Migrations {
+		status := &Status{Migration: migration}
+		statuses = append(statuses, status)
+		statusMap[migration.Version] = status
+	}
+
+	for rows.Next() {
+		version := 0
+		checksum := ""
+		appliedAt := time.Time{}
+		err = rows.Scan(&version, &checksum, &appliedAt)
+		if err != nil {
+			return nil, fmt.Errorf("cannot query %s: %w", m.Table, err)
+		}
+
+		status, ok := statusMap[version]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+		}
+		if status.Checksum != checksum {
+			return nil, fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, status.Version, status.Name)
+		}
+
+		status.Applied = true
+		status.AppliedAt = appliedAt
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot query %s: %w", m.Table, err)
+	}
+
+	return statuses, nil
+}
+
+// execCtx runs a migration script and the statement recording it in a single transaction.
+func (m *Migrator) execCtx(ctx context.Context, conn *sql.Conn, script string, record string, args ...interface{}) (err error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, record, args...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
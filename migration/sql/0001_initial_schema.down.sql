@@ -0,0 +1,29 @@
+drop table if exists surat_rekomendasi_tim_penilaian;
+drop table if exists dokumen_pendukung_tim_penilaian;
+drop table if exists anggota_tim_penilaian;
+drop table if exists tim_penilaian;
+
+drop table if exists pengangkatan_cpns;
+drop table if exists pengangkatan;
+
+drop table if exists pemberhentian_doc_pendukung_penolakan;
+drop table if exists pemberhentian_doc_pendukung;
+drop table if exists pemberhentian;
+
+drop table if exists surat_rekomendasi_kebutuhan;
+drop table if exists kebutuhan_statushist;
+drop table if exists doc_perhitungan;
+drop table if exists jumlah_kebutuhan;
+drop table if exists kebutuhan;
+
+drop table if exists dokumen_pendukung;
+drop table if exists surat_rekomendasi_kegiatan;
+drop table if exists kegiatan_status_hist;
+drop table if exists sertifikat;
+drop table if exists perserta_kegiatan;
+drop table if exists kegiatan;
+
+drop table if exists dokumen_template;
+drop table if exists jenis_penandatangan;
+drop table if exists jenis_modul;
+drop table if exists pegawai;
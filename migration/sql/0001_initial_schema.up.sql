@@ -0,0 +1,323 @@
+-- Initial schema of the primary (siasn_jf) database.
+-- Columns referencing other databases (ASN, agency, organization unit and position IDs) are stored as text since the
+-- referenced tables live in the profile and reference databases.
+
+create table pegawai
+(
+    user_id  text primary key,
+    nip_baru text,
+    nip_lama text,
+    role_peg text,
+    instansi text
+);
+
+create index pegawai_instansi_role_peg_idx on pegawai (instansi, role_peg);
+
+create table jenis_modul
+(
+    modul_id uuid primary key,
+    nama     text not null
+);
+
+create table jenis_penandatangan
+(
+    penandatangan_id text primary key,
+    key              text not null unique,
+    nama             text not null
+);
+
+create table dokumen_template
+(
+    id            uuid primary key,
+    name          text,
+    modul         text  not null,
+    filename      text  not null,
+    penandatangan jsonb not null default '[]'
+);
+
+-- Activity (kegiatan).
+
+create table kegiatan
+(
+    kegiatan_id            uuid primary key,
+    nama                   text        not null,
+    status                 integer     not null,
+    jenis                  integer     not null,
+    deskripsi              text        not null default '',
+    tgl_usulan             timestamptz not null default current_timestamp,
+    tgl_mulai              date        not null,
+    tgl_selesai            date        not null,
+    jabatan_jenjang        text        not null,
+    instansi_id            text        not null,
+    data_tambahan          text        not null default '',
+    tahun_diklat           integer     not null default 0,
+    durasi                 integer     not null default 0,
+    instansi_penyelenggara text,
+    no_usulan              text        not null,
+    penandatangan          jsonb,
+    template_id            uuid references dokumen_template (id) on delete set null
+);
+
+create index kegiatan_instansi_id_idx on kegiatan (instansi_id);
+create index kegiatan_tgl_usulan_idx on kegiatan (tgl_usulan);
+
+create table perserta_kegiatan
+(
+    kegiatan_kegiatan_id     uuid not null references kegiatan (kegiatan_id) on delete cascade,
+    pegawai_user_id          text not null references pegawai (user_id),
+    isaccepted               boolean,
+    acceptedts               timestamptz,
+    acceptedby               text,
+    accepted_rejected_reason text,
+    ispass                   boolean,
+    passts                   timestamptz,
+    passby                   text,
+    pass_rejected_reason     text,
+    primary key (kegiatan_kegiatan_id, pegawai_user_id)
+);
+
+create table sertifikat
+(
+    persertakegiatan_kegiatan_id uuid        not null,
+    persertakegiatan_user_id     text        not null,
+    nosurat                      text        not null,
+    tgl_surat                    date        not null,
+    jenis                        integer     not null,
+    ttd_user_id                  text        not null,
+    createdat                    timestamptz not null default current_timestamp,
+    nilai                        real,
+    primary key (persertakegiatan_kegiatan_id, persertakegiatan_user_id),
+    foreign key (persertakegiatan_kegiatan_id, persertakegiatan_user_id)
+        references perserta_kegiatan (kegiatan_kegiatan_id, pegawai_user_id) on delete cascade
+);
+
+create table kegiatan_status_hist
+(
+    kegiatan_kegiatan_id uuid        not null references kegiatan (kegiatan_id) on delete cascade,
+    status               integer     not null,
+    modified_at_ts       timestamptz not null,
+    user_id              text        not null
+);
+
+create index kegiatan_status_hist_kegiatan_idx on kegiatan_status_hist (kegiatan_kegiatan_id);
+
+create table surat_rekomendasi_kegiatan
+(
+    kegiatan_id uuid primary key references kegiatan (kegiatan_id) on delete cascade,
+    nosurat     text not null,
+    tgl_surat   date not null,
+    ttd_user_id text not null,
+    nama_doc    text not null
+);
+
+create table dokumen_pendukung
+(
+    kegiatan_kegiatan_id uuid        not null references kegiatan (kegiatan_id) on delete cascade,
+    filename             text        not null,
+    nama_doc             text        not null,
+    createdat            timestamptz not null default current_timestamp,
+    primary key (kegiatan_kegiatan_id, filename)
+);
+
+-- Requirement (kebutuhan).
+
+create table kebutuhan
+(
+    kebutuhan_id       uuid primary key,
+    tgl_usulan         timestamptz not null default current_timestamp,
+    status             integer     not null,
+    jabatan_fungsional text        not null,
+    filename_sp        text        not null,
+    nama_doc_sp        text        not null,
+    catatan_sp         text,
+    instansi_id        text        not null,
+    tahun_anggaran     text        not null,
+    no_usulan          text        not null,
+    alasan_perbaikan   text
+);
+
+create index kebutuhan_instansi_id_idx on kebutuhan (instansi_id);
+create index kebutuhan_tgl_usulan_idx on kebutuhan (tgl_usulan);
+
+create table jumlah_kebutuhan
+(
+    kebutuhan_id              uuid    not null references kebutuhan (kebutuhan_id) on delete cascade,
+    unor_id                   text    not null,
+    jlh_kebutuhan             integer not null,
+    rekomendasi_jlh_kebutuhan integer,
+    bezetting_jlh_kebutuhan   integer not null default 0,
+    primary key (kebutuhan_id, unor_id)
+);
+
+create table doc_perhitungan
+(
+    kebutuhan_kebutuhan_id uuid        not null references kebutuhan (kebutuhan_id) on delete cascade,
+    filename               text        not null,
+    nama_doc_perhitungan   text        not null,
+    catatan                text,
+    createdat              timestamptz not null default current_timestamp,
+    primary key (kebutuhan_kebutuhan_id, filename)
+);
+
+create table kebutuhan_statushist
+(
+    kebutuhan_kebutuhan_id uuid        not null references kebutuhan (kebutuhan_id) on delete cascade,
+    status                 integer     not null,
+    modified_at_ts         timestamptz not null,
+    user_id                text        not null
+);
+
+create index kebutuhan_statushist_kebutuhan_idx on kebutuhan_statushist (kebutuhan_kebutuhan_id);
+
+create table surat_rekomendasi_kebutuhan
+(
+    kebutuhan_id uuid primary key references kebutuhan (kebutuhan_id) on delete cascade,
+    filename     text        not null,
+    tgl_surat    date        not null,
+    nama_doc     text        not null,
+    nosurat      text        not null,
+    catatan      text,
+    ttd_user_id  text,
+    is_signed    boolean     not null default false,
+    signedat     timestamptz,
+    createdat    timestamptz not null default current_timestamp
+);
+
+create index surat_rekomendasi_kebutuhan_filename_idx on surat_rekomendasi_kebutuhan (filename);
+
+-- Dismissal (pemberhentian).
+
+create table pemberhentian
+(
+    uuid_pemberhentian              uuid primary key,
+    asn_id                          text        not null,
+    instansi_id                     text        not null,
+    status                          integer     not null,
+    status_ts                       timestamptz not null default current_timestamp,
+    status_by                       text        not null,
+    alasan_pemberhentian            text,
+    alasan_tidak_diberhentikan      text,
+    tgl_pemberhentian               date        not null,
+    nomor_sk                        text,
+    tgl_sk                          date,
+    detail_alasan                   text,
+    no_usulan                       text        not null,
+    nama_doc_surat_pemberhentian    text,
+    nosurat_surat_pemberhentian     text,
+    ttd_user_id_surat_pemberhentian text,
+    tgl_surat_pemberhentian         date
+);
+
+create index pemberhentian_instansi_id_idx on pemberhentian (instansi_id);
+
+create table pemberhentian_doc_pendukung
+(
+    uuid_pemberhentian uuid not null references pemberhentian (uuid_pemberhentian) on delete cascade,
+    filename           text not null,
+    nama_doc           text not null,
+    primary key (uuid_pemberhentian, filename)
+);
+
+create table pemberhentian_doc_pendukung_penolakan
+(
+    uuid_pemberhentian uuid not null references pemberhentian (uuid_pemberhentian) on delete cascade,
+    filename           text not null,
+    primary key (uuid_pemberhentian, filename)
+);
+
+-- Promotion (pengangkatan).
+
+create table pengangkatan
+(
+    uuid_pengangkatan                  uuid primary key,
+    asn_id                             text        not null,
+    no_usulan                          text        not null,
+    tgl_usulan                         date        not null,
+    jenis_pengangkatan                 integer     not null,
+    jabatan_fungsional_tujuan_id       text        not null,
+    status                             integer     not null,
+    status_ts                          timestamptz not null default current_timestamp,
+    status_by                          text        not null,
+    alasan_tidak_diangkat              text,
+    test_status                        integer,
+    test_nilai                         double precision,
+    nama_doc_pak                       text,
+    no_doc_pak                         text,
+    tgl_doc_pak                        date,
+    nama_doc_surat_rekomendasi         text,
+    no_doc_surat_rekomendasi           text,
+    tgl_doc_surat_rekomendasi          date,
+    nama_doc_sertifikat_uji_kompetensi text,
+    no_doc_sertifikat_uji_kompetensi   text,
+    tgl_doc_sertifikat_uji_kompetensi  date
+);
+
+create index pengangkatan_asn_id_idx on pengangkatan (asn_id);
+
+create table pengangkatan_cpns
+(
+    pengangkatan_cpns_id         uuid primary key,
+    asn_id                       text        not null,
+    jabatan_fungsional_tujuan_id text        not null,
+    angka_kredit_pertama         integer     not null,
+    unor_id                      text        not null,
+    tgl_usulan                   date        not null,
+    no_usulan                    text        not null,
+    nama_doc_pak                 text        not null,
+    no_doc_pak                   text        not null,
+    tgl_doc_pak                  date        not null,
+    nama_doc_surat_pengangkatan  text        not null,
+    no_doc_surat_pengangkatan    text        not null,
+    tgl_doc_surat_pengangkatan   date        not null,
+    status                       integer     not null,
+    status_ts                    timestamptz not null default current_timestamp,
+    status_by                    text        not null
+);
+
+create index pengangkatan_cpns_asn_id_idx on pengangkatan_cpns (asn_id);
+
+-- Assessment team (tim penilaian).
+
+create table tim_penilaian
+(
+    tim_penilaian_id      uuid primary key,
+    asn_id                text        not null,
+    instansi_id           text        not null,
+    jabatan_fungsional_id text        not null,
+    tgl_usulan            date        not null,
+    no_usulan             text        not null,
+    status                integer     not null,
+    status_ts             timestamptz not null default current_timestamp,
+    status_by             text        not null
+);
+
+create index tim_penilaian_instansi_id_idx on tim_penilaian (instansi_id);
+
+create table anggota_tim_penilaian
+(
+    tim_penilaian_id uuid    not null references tim_penilaian (tim_penilaian_id) on delete cascade,
+    asn_id           text    not null,
+    peran            integer not null,
+    status           integer not null default 0,
+    alasan_ditolak   text,
+    primary key (tim_penilaian_id, asn_id)
+);
+
+create table dokumen_pendukung_tim_penilaian
+(
+    tim_penilaian_id uuid        not null references tim_penilaian (tim_penilaian_id) on delete cascade,
+    filename         text        not null,
+    nama_doc         text        not null,
+    createdat        timestamptz not null default current_timestamp,
+    primary key (tim_penilaian_id, filename)
+);
+
+create table surat_rekomendasi_tim_penilaian
+(
+    tim_penilaian_id uuid primary key references tim_penilaian (tim_penilaian_id) on delete cascade,
+    filename         text        not null,
+    nama_doc         text        not null,
+    no_surat         text        not null,
+    tgl_surat        date        not null,
+    createdat        timestamptz not null default current_timestamp
+);
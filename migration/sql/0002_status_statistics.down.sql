@@ -0,0 +1,5 @@
+drop view if exists pengangkatan_cpns_status_statistik;
+drop view if exists pengangkatan_status_statistik;
+drop view if exists pemberhentian_status_statistik;
+drop view if exists kebutuhan_status_statistik;
+drop view if exists kegiatan_status_statistik;
@@ -0,0 +1,26 @@
+-- Views read by the /statistic/status/get endpoints. Each returns the number of entries for each status.
+
+create view kegiatan_status_statistik as
+select status, count(*) as jumlah
+from kegiatan
+group by status;
+
+create view kebutuhan_status_statistik as
+select status, count(*) as jumlah
+from kebutuhan
+group by status;
+
+create view pemberhentian_status_statistik as
+select status, count(*) as jumlah
+from pemberhentian
+group by status;
+
+create view pengangkatan_status_statistik as
+select status, count(*) as jumlah
+from pengangkatan
+group by status;
+
+create view pengangkatan_cpns_status_statistik as
+select status, count(*) as jumlah
+from pengangkatan_cpns
+group by status;
@@ -0,0 +1,2 @@
+drop table if exists status_hist;
+drop function if exists status_hist_immutable();
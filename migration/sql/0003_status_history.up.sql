@@ -0,0 +1,67 @@
+-- Unified status history (audit trail) of every admission module. Entries are appended by the store on every status
+-- change and cannot be modified or deleted afterwards.
+-- modul is one of activity, requirement, dismissal, promotion, promotion-cpns and assessment-team. entitas_id is the
+-- ID of the admission in the module table. status_lama is null for the first entry of an admission and for entries
+-- migrated from older tables.
+
+create table status_hist
+(
+    status_hist_id bigserial primary key,
+    modul          text        not null,
+    entitas_id     text        not null,
+    status_lama    integer,
+    status         integer     not null,
+    alasan         text,
+    user_id        text        not null,
+    ip_address     text,
+    user_agent     text,
+    modified_at_ts timestamptz not null default current_timestamp
+);
+
+create index status_hist_modul_entitas_id_idx on status_hist (modul, entitas_id, modified_at_ts);
+
+create function status_hist_immutable() returns trigger as
+$$
+begin
+    raise exception 'status_hist entries cannot be modified or deleted';
+end;
+$$ language plpgsql;
+
+create trigger status_hist_immutable
+    before update or delete
+    on status_hist
+    for each row
+execute procedure status_hist_immutable();
+
+create trigger status_hist_immutable_truncate
+    before truncate
+    on status_hist
+    for each statement
+execute procedure status_hist_immutable();
+
+-- Activities and requirements already kept a history. kegiatan_status_hist and kebutuhan_statushist are kept for
+-- reference but are no longer written.
+insert into status_hist(modul, entitas_id, status, user_id, modified_at_ts)
+select 'activity', kegiatan_kegiatan_id::text, status, user_id, modified_at_ts
+from kegiatan_status_hist;
+
+insert into status_hist(modul, entitas_id, status, user_id, modified_at_ts)
+select 'requirement', kebutuhan_kebutuhan_id::text, status, user_id, modified_at_ts
+from kebutuhan_statushist;
+
+-- Other modules only kept the last status change.
+insert into status_hist(modul, entitas_id, status, user_id, modified_at_ts)
+select 'dismissal', uuid_pemberhentian::text, status, status_by, status_ts
+from pemberhentian;
+
+insert into status_hist(modul, entitas_id, status, user_id, modified_at_ts)
+select 'promotion', uuid_pengangkatan::text, status, status_by, status_ts
+from pengangkatan;
+
+insert into status_hist(modul, entitas_id, status, user_id, modified_at_ts)
+select 'promotion-cpns', pengangkatan_cpns_id::text, status, status_by, status_ts
+from pengangkatan_cpns;
+
+insert into status_hist(modul, entitas_id, status, user_id, modified_at_ts)
+select 'assessment-team', tim_penilaian_id::text, status, status_by, status_ts
+from tim_penilaian;
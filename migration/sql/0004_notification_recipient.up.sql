@@ -0,0 +1,11 @@
+-- Email addresses and notification preferences of ASNs. Emails are taken from the identity provider (auth.Asn.Email)
+-- whenever the ASN changes an admission status or their notification preference. ASNs without an entry, e.g. those who
+-- have never logged in, are notified at the email in the profile database.
+
+create table notifikasi_penerima
+(
+    asn_id             text primary key,
+    email              text        not null,
+    berhenti_langganan boolean     not null default false,
+    updated_at_ts      timestamptz not null default current_timestamp
+);
@@ -0,0 +1,29 @@
+-- Document generation jobs, queued by the HTTP handlers and run in the background by the job workers of every
+-- instance, see store.JobRunner. status is one of pending, running, done and failed. Failed attempts are retried at
+-- jadwal_ts until maks_percobaan is reached. Running jobs whose lease (sewa_berakhir_ts) has passed are run again, e.g.
+-- after the instance running them stopped.
+-- pemilik is the instance that queued a job holding secrets that are only kept in memory, e.g. signing passphrases.
+-- Such jobs can only be run by that instance. hasil is the base filename of the generated document.
+
+create table pekerjaan
+(
+    pekerjaan_id     uuid primary key,
+    jenis            text        not null,
+    modul            text        not null,
+    entitas_id       text        not null,
+    payload          jsonb       not null default '{}',
+    status           text        not null default 'pending',
+    percobaan        integer     not null default 0,
+    maks_percobaan   integer     not null,
+    jadwal_ts        timestamptz not null default current_timestamp,
+    sewa_berakhir_ts timestamptz,
+    pemilik          text,
+    hasil            text,
+    pesan_error      text,
+    user_id          text        not null,
+    created_at_ts    timestamptz not null default current_timestamp,
+    modified_at_ts   timestamptz not null default current_timestamp
+);
+
+create index pekerjaan_status_jadwal_ts_idx on pekerjaan (status, jadwal_ts);
+create index pekerjaan_user_id_idx on pekerjaan (user_id, created_at_ts);
@@ -0,0 +1,6 @@
+alter table pengangkatan drop column if exists pencarian;
+alter table pemberhentian drop column if exists pencarian;
+alter table kebutuhan drop column if exists pencarian;
+alter table kegiatan drop column if exists pencarian;
+
+drop text search configuration if exists siasn_jf;
@@ -0,0 +1,50 @@
+-- Full-text search over the admissions, see store.SearchCtx. siasn_jf is the text search configuration of the
+-- admissions, a copy of the Indonesian configuration: words are stemmed with the Indonesian snowball stemmer, so that
+-- e.g. "pengangkatan" also matches "angkat". It is a copy so that it can be tuned (dictionaries, stop words) without
+-- touching the built-in configuration.
+-- Each admission table has a generated tsvector column, pencarian, indexed with GIN. Admission and document numbers
+-- weigh the most, their separators are replaced with spaces so that each part of a number (e.g. KEG in 001/KEG/2024)
+-- can be searched on its own.
+-- Attendee and ASN names are searched in the profile database, which is not migrated here.
+
+create text search configuration siasn_jf (copy = indonesian);
+
+alter table kegiatan
+    add column pencarian tsvector generated always as (
+            setweight(to_tsvector('siasn_jf', translate(no_usulan, '/.-_', '    ')), 'A') ||
+            setweight(to_tsvector('siasn_jf', nama), 'A') ||
+            setweight(to_tsvector('siasn_jf', deskripsi), 'B') ||
+            setweight(to_tsvector('siasn_jf', coalesce(instansi_penyelenggara, '')), 'C')
+        ) stored;
+
+create index kegiatan_pencarian_idx on kegiatan using gin (pencarian);
+
+alter table kebutuhan
+    add column pencarian tsvector generated always as (
+            setweight(to_tsvector('siasn_jf', translate(no_usulan, '/.-_', '    ')), 'A') ||
+            setweight(to_tsvector('siasn_jf', coalesce(catatan_sp, '')), 'B') ||
+            setweight(to_tsvector('siasn_jf', coalesce(alasan_perbaikan, '')), 'C')
+        ) stored;
+
+create index kebutuhan_pencarian_idx on kebutuhan using gin (pencarian);
+
+alter table pemberhentian
+    add column pencarian tsvector generated always as (
+            setweight(to_tsvector('siasn_jf', translate(no_usulan, '/.-_', '    ')), 'A') ||
+            setweight(to_tsvector('siasn_jf', translate(coalesce(nomor_sk, ''), '/.-_', '    ')), 'A') ||
+            setweight(to_tsvector('siasn_jf', coalesce(alasan_pemberhentian, '')), 'B') ||
+            setweight(to_tsvector('siasn_jf', coalesce(detail_alasan, '')), 'B') ||
+            setweight(to_tsvector('siasn_jf', coalesce(alasan_tidak_diberhentikan, '')), 'C')
+        ) stored;
+
+create index pemberhentian_pencarian_idx on pemberhentian using gin (pencarian);
+
+alter table pengangkatan
+    add column pencarian tsvector generated always as (
+            setweight(to_tsvector('siasn_jf', translate(no_usulan, '/.-_', '    ')), 'A') ||
+            setweight(to_tsvector('siasn_jf', translate(coalesce(no_doc_pak, ''), '/.-_', '    ')), 'A') ||
+            setweight(to_tsvector('siasn_jf', translate(coalesce(no_doc_surat_rekomendasi, ''), '/.-_', '    ')), 'A') ||
+            setweight(to_tsvector('siasn_jf', coalesce(alasan_tidak_diangkat, '')), 'C')
+        ) stored;
+
+create index pengangkatan_pencarian_idx on pengangkatan using gin (pencarian);
@@ -0,0 +1,2 @@
+alter table status_hist
+    drop column if exists impersonator_id;
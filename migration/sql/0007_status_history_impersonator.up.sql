@@ -0,0 +1,5 @@
+-- ASN ID of the BKN administrator who changed the status while impersonating user_id (see auth.Impersonation), null if
+-- the status was changed by user_id themselves.
+
+alter table status_hist
+    add column impersonator_id text;
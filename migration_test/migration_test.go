@@ -0,0 +1,115 @@
+package migration_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fazrithe/siasn-jf-backend-git/migration"
+	. "github.com/onsi/gomega"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	RegisterTestingT(t)
+
+	migrations, err := migration.LoadMigrations(fstest.MapFS{
+		"sql/0002_second.up.sql":   {Data: []byte("create table b();")},
+		"sql/0002_second.down.sql": {Data: []byte("drop table b;")},
+		"sql/0001_first.up.sql":    {Data: []byte("create table a();")},
+		"sql/0001_first.down.sql":  {Data: []byte("drop table a;")},
+	})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(migrations).To(HaveLen(2))
+	Expect(migrations[0].Version).To(Equal(1))
+	Expect(migrations[0].Name).To(Equal("first"))
+	Expect(migrations[0].Down).To(Equal("drop table a;"))
+	Expect(migrations[0].Checksum).To(HaveLen(64))
+	Expect(migrations[1].Version).To(Equal(2))
+
+	_, err = migration.LoadMigrations(fstest.MapFS{
+		"sql/0001_first.up.sql": {Data: []byte("create table a();")},
+	})
+	Expect(err).To(HaveOccurred())
+
+	_, err = migration.LoadMigrations(fstest.MapFS{
+		"sql/first.up.sql": {Data: []byte("create table a();")},
+	})
+	Expect(err).To(HaveOccurred())
+
+	// Embedded migrations must always be loadable.
+	db, _, err := sqlmock.New()
+	Expect(err).ToNot(HaveOccurred())
+	migrator, err := migration.NewMigrator(db)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(migrator.Migrations).ToNot(BeEmpty())
+}
+
+func createMigrator() (*migration.Migrator, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	Expect(err).ToNot(HaveOccurred())
+
+	migrations, err := migration.LoadMigrations(fstest.MapFS{
+		"sql/0001_first.up.sql":    {Data: []byte("create table a();")},
+		"sql/0001_first.down.sql":  {Data: []byte("drop table a;")},
+		"sql/0002_second.up.sql":   {Data: []byte("create table b();")},
+		"sql/0002_second.down.sql": {Data: []byte("drop table b;")},
+	})
+	Expect(err).ToNot(HaveOccurred())
+
+	migrator, err := migration.NewMigrator(db)
+	Expect(err).ToNot(HaveOccurred())
+	migrator.Migrations = migrations
+	return migrator, mock
+}
+
+func TestMigratorUpDown(t *testing.T) {
+	RegisterTestingT(t)
+
+	migrator, mock := createMigrator()
+	first := migrator.Migrations[0]
+	second := migrator.Migrations[1]
+
+	mock.ExpectExec("select pg_advisory_lock").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("select version, checksum, applied_at from schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum", "applied_at"}).AddRow(1, first.Checksum, time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec("create table b").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into schema_migrations").WithArgs(2, "second", second.Checksum).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("select pg_advisory_unlock").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := migrator.UpCtx(context.Background())
+	Expect(err).ToNot(HaveOccurred())
+	Expect(applied).To(Equal([]*migration.Migration{second}))
+	Expect(mock.ExpectationsWereMet()).To(Succeed())
+
+	mock.ExpectExec("select pg_advisory_lock").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("create table if not exists schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("select version, checksum, applied_at from schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum", "applied_at"}).AddRow(1, first.Checksum, time.Now()).AddRow(2, second.Checksum, time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec("drop table b").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("delete from schema_migrations").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("select pg_advisory_unlock").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	reverted, err := migrator.DownCtx(context.Background(), 1)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(reverted).To(Equal([]*migration.Migration{second}))
+	Expect(mock.ExpectationsWereMet()).To(Succeed())
+}
+
+func TestMigratorChecksumMismatch(t *testing.T) {
+	RegisterTestingT(t)
+
+	migrator, mock := createMigrator()
+
+	mock.ExpectExec("create table if not exists schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("select version, checksum, applied_at from schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"version", "checksum", "applied_at"}).AddRow(1, "modified", time.Now()))
+
+	_, err := migrator.StatusCtx(context.Background())
+	Expect(errors.Is(err, migration.ErrChecksumMismatch)).To(BeTrue())
+	Expect(mock.ExpectationsWereMet()).To(Succeed())
+}
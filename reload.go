@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/config"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/health"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/logutil"
+)
+
+// logLevel is the level of every logger created by createLogger, so that LOG_LEVEL can be reloaded.
+var logLevel = &logutil.LevelVar{}
+
+// loginChecker decides who can log in, reconfigured when the LOGIN_* configs are reloaded.
+var loginChecker = auth.NewPolicyLoginChecker(nil)
+
+// requireBackendConfig checks the configs required by the selected backends.
+func requireBackendConfig(globalConfig *Config, sc *config.ServiceConfig) error {
+	var names []string
+	if globalConfig.ObjectStorageBackend == ObjectStorageBackendEmcEcs {
+		names = append(names, "EMC_ECS_ENDPOINT", "EMC_ECS_ACCESS_KEY", "EMC_ECS_SECRET_KEY")
+	}
+	if globalConfig.SignerBackend == SignerBackendBsre {
+		names = append(names, "BSRE_URL", "BSRE_USERNAME", "BSRE_PASSWORD")
+	}
+	if globalConfig.EmailBackend == EmailBackendSmtp {
+		names = append(names, "SMTP_ADDRESS", "EMAIL_FROM")
+	}
+	if globalConfig.OidcSessionBackend == OidcSessionBackendRedis {
+		names = append(names, "REDIS_ADDRESS")
+	}
+	return sc.Require(globalConfig, names...)
+}
+
+// applyReloadable applies the configs tagged with the reload option, at startup and on each reload. Nothing is
+// applied if one of them is invalid. healthChecker is nil at startup, createHealthChecker uses the config itself.
+func applyReloadable(globalConfig *Config, corsOrigins *originList, healthChecker *health.Checker) error {
+	level, err := logutil.ParseLevel(globalConfig.LogLevel)
+	if err != nil {
+		return fmt.Errorf("cannot parse LOG_LEVEL: %w", err)
+	}
+
+	logLevel.Set(level)
+	corsOrigins.Set(globalConfig.CorsAllowedOrigins)
+	if healthChecker != nil {
+		healthChecker.SetTimeout(time.Duration(globalConfig.HealthCheckTimeout) * time.Second)
+	}
+	for _, b := range breakers {
+		b.Configure(globalConfig.BreakerFailureThreshold, time.Duration(globalConfig.BreakerOpenTimeout)*time.Second, globalConfig.BreakerHalfOpenProbes)
+	}
+	loginChecker.Configure(&auth.LoginPolicy{
+		Roles:     globalConfig.LoginAllowedRoles,
+		AgencyIds: globalConfig.LoginAllowedAgencies,
+		Staff:     globalConfig.LoginAllowStaff,
+	})
+	return nil
+}
+
+// watchReload reloads the configuration on each SIGHUP. Configs that cannot be reloaded are only logged, they take
+// effect after a restart. An invalid configuration is logged and ignored, the current one is kept.
+func watchReload(globalConfig *Config, sc *config.ServiceConfig, corsOrigins *originList, healthChecker *health.Checker) {
+	logger := createLogger(globalConfig, "reload")
+	current := *globalConfig
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	for range c {
+		candidate := current
+		reloaded, restartRequired, err := sc.Reload(&candidate, NewConfigDefault())
+		if err == nil {
+			err = applyReloadable(&candidate, corsOrigins, healthChecker)
+		}
+		if err != nil {
+			logger.Errorf("cannot reload configuration, keeping the current one: %v", err)
+			continue
+		}
+
+		current = candidate
+		if len(restartRequired) > 0 {
+			logger.Warnf("configuration changed but requires a restart to take effect: %v", restartRequired)
+		}
+		logger.Infof("configuration reloaded, changed: %v", reloaded)
+	}
+}
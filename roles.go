@@ -0,0 +1,198 @@
+package main
+
+import (
+	"github.com/fazrithe/siasn-jf-backend-git/store"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+)
+
+var (
+	// rolesAuthenticated allows any authenticated user.
+	rolesAuthenticated = []string{}
+	// rolesAll allows users that have any of the known roles.
+	rolesAll = []string{models.RolePembina, models.RoleAgencyAdmin, models.RoleVerifier, models.RoleBknAdmin}
+	// rolesAgency allows agency admins, who submit admissions on behalf of their agency.
+	rolesAgency = []string{models.RoleAgencyAdmin, models.RoleBknAdmin}
+	// rolesPembina allows JF supervising agencies.
+	rolesPembina = []string{models.RolePembina, models.RoleBknAdmin}
+	// rolesVerifier allows verifiers, who accept, reject and sign admissions.
+	rolesVerifier = []string{models.RoleVerifier, models.RoleBknAdmin}
+	// rolesSupervisor allows pejabat pembina kepegawaian, who sign letters on behalf of their agency.
+	rolesSupervisor = []string{models.RoleSupervisor}
+	// rolesBkn allows only BKN administrators.
+	rolesBkn = []string{models.RoleBknAdmin}
+)
+
+// apiV1RouteRoles lists the roles required by each /api/v1 route. Routes not listed here are rejected by
+// store.Client RoleAuthHandler.
+var apiV1RouteRoles = store.RouteRoles{
+	"/api/v1/activity/statistic/status/get":                     rolesAll,
+	"/api/v1/activity/statistic/status/series":                  rolesAll,
+	"/api/v1/activity/admission/submit":                         rolesAgency,
+	"/api/v1/activity/admission/upload":                         rolesAgency,
+	"/api/v1/activity/admission/preview":                        rolesAll,
+	"/api/v1/activity/admission/download":                       rolesAll,
+	"/api/v1/activity/admission/search-asn":                     rolesAgency,
+	"/api/v1/activity/admission/verify":                         {models.RolePembina, models.RoleVerifier, models.RoleBknAdmin},
+	"/api/v1/activity/admission/search":                         rolesAgency,
+	"/api/v1/activity/admission/search/paginated":               rolesAgency,
+	"/api/v1/activity/admission/search/export":                  rolesAgency,
+	"/api/v1/activity/admission/search-pembina":                 rolesPembina,
+	"/api/v1/activity/admission/detail":                         rolesAll,
+	"/api/v1/activity/admission/get":                            rolesAll,
+	"/api/v1/activity/admission/history":                        rolesAll,
+	"/api/v1/activity/admission/actions":                        rolesAll,
+	"/api/v1/activity/admission/upload/recommendation-letter":   rolesAgency,
+	"/api/v1/activity/admission/preview/recommendation-letter":  rolesAll,
+	"/api/v1/activity/admission/submit/recommendation-letter":   rolesAgency,
+	"/api/v1/activity/admission/download/recommendation-letter": rolesAll,
+	"/api/v1/activity/csr/submit":                               rolesAgency,
+	"/api/v1/activity/certgen/upload":                           rolesPembina,
+	"/api/v1/activity/certgen/preview":                          rolesAll,
+	"/api/v1/activity/certgen/download":                         rolesAll,
+	"/api/v1/activity/certgen/submit":                           rolesPembina,
+
+	"/api/v1/requirement/statistic/status/get":                           rolesAll,
+	"/api/v1/requirement/statistic/status/series":                        rolesAll,
+	"/api/v1/requirement/admission/submit":                               rolesAgency,
+	"/api/v1/requirement/admission/edit":                                 rolesAgency,
+	"/api/v1/requirement/admission/upload/cover-letter":                  rolesAgency,
+	"/api/v1/requirement/admission/upload/estimation":                    rolesAgency,
+	"/api/v1/requirement/admission/preview/cover-letter":                 rolesAll,
+	"/api/v1/requirement/admission/preview/estimation":                   rolesAll,
+	"/api/v1/requirement/admission/download/cover-letter":                rolesAll,
+	"/api/v1/requirement/admission/template/cover-letter":                rolesAll,
+	"/api/v1/requirement/admission/download/estimation":                  rolesAll,
+	"/api/v1/requirement/admission/search":                               rolesAll,
+	"/api/v1/requirement/admission/search/paginated":                     rolesAll,
+	"/api/v1/requirement/admission/search/export":                        rolesAll,
+	"/api/v1/requirement/admission/detail":                               rolesAll,
+	"/api/v1/requirement/admission/get":                                  rolesAll,
+	"/api/v1/requirement/admission/history":                              rolesAll,
+	"/api/v1/requirement/admission/actions":                              rolesAll,
+	"/api/v1/requirement/verify/upload":                                  rolesAuthenticated,
+	"/api/v1/requirement/verify/download":                                rolesAuthenticated,
+	"/api/v1/requirement/verify/preview":                                 rolesAuthenticated,
+	"/api/v1/requirement/verify/upload/recommendation-letter":            rolesVerifier,
+	"/api/v1/requirement/verify/download/recommendation-letter":          rolesAll,
+	"/api/v1/requirement/verify/preview/recommendation-letter":           rolesAll,
+	"/api/v1/requirement/verify/download/recommendation-letter/unsigned": rolesAll,
+	"/api/v1/requirement/verify/download/recommendation-letter/signed":   rolesAll,
+	"/api/v1/requirement/verify/bulk-submit/recommendation-letter":       rolesVerifier,
+	"/api/v1/requirement/verify/sign/recommendation-letter":              rolesSupervisor,
+	"/api/v1/requirement/verify/submit":                                  rolesVerifier,
+	"/api/v1/requirement/verify/deny":                                    rolesVerifier,
+	"/api/v1/requirement/verifier/get":                                   rolesVerifier,
+
+	"/api/v1/dismissal/statistic/status/get":       rolesAll,
+	"/api/v1/dismissal/statistic/status/series":    rolesAll,
+	"/api/v1/dismissal/admission/search-asn":       rolesAgency,
+	"/api/v1/dismissal/admission/submit":           rolesAgency,
+	"/api/v1/dismissal/admission/upload":           rolesAgency,
+	"/api/v1/dismissal/admission/preview":          rolesAll,
+	"/api/v1/dismissal/admission/download":         rolesAll,
+	"/api/v1/dismissal/admission/get":              rolesAll,
+	"/api/v1/dismissal/admission/search":           rolesAll,
+	"/api/v1/dismissal/admission/search/paginated": rolesAll,
+	"/api/v1/dismissal/admission/search/export":    rolesAll,
+	"/api/v1/dismissal/admission/history":          rolesAll,
+	"/api/v1/dismissal/admission/actions":          rolesAll,
+	"/api/v1/dismissal/accept/submit":              rolesVerifier,
+	"/api/v1/dismissal/accept/download":            rolesAll,
+	"/api/v1/dismissal/accept/sign":                rolesSupervisor,
+	"/api/v1/dismissal/deny/submit":                rolesVerifier,
+	"/api/v1/dismissal/deny/upload":                rolesVerifier,
+	"/api/v1/dismissal/deny/preview":               rolesAll,
+	"/api/v1/dismissal/deny/download":              rolesAll,
+
+	"/api/v1/promotion/statistic/status/get":                     rolesAll,
+	"/api/v1/promotion/statistic/status/series":                  rolesAll,
+	"/api/v1/promotion/admission/search-asn":                     rolesAgency,
+	"/api/v1/promotion/admission/submit":                         rolesAgency,
+	"/api/v1/promotion/admission/upload/pak":                     rolesAgency,
+	"/api/v1/promotion/admission/preview/pak":                    rolesAll,
+	"/api/v1/promotion/admission/download/pak":                   rolesAll,
+	"/api/v1/promotion/admission/template/pak":                   rolesAll,
+	"/api/v1/promotion/admission/upload/recommendation-letter":   rolesAgency,
+	"/api/v1/promotion/admission/preview/recommendation-letter":  rolesAll,
+	"/api/v1/promotion/admission/download/recommendation-letter": rolesAll,
+	"/api/v1/promotion/admission/template/recommendation-letter": rolesAll,
+	"/api/v1/promotion/admission/upload/promotion-letter":        rolesVerifier,
+	"/api/v1/promotion/admission/preview/promotion-letter":       rolesAll,
+	"/api/v1/promotion/admission/download/promotion-letter":      rolesAll,
+	"/api/v1/promotion/admission/sign/promotion-letter":          rolesVerifier,
+	"/api/v1/promotion/admission/upload/test-certificate":        rolesAgency,
+	"/api/v1/promotion/admission/preview/test-certificate":       rolesAll,
+	"/api/v1/promotion/admission/download/test-certificate":      rolesAll,
+	"/api/v1/promotion/admission/accept":                         rolesVerifier,
+	"/api/v1/promotion/admission/reject":                         rolesVerifier,
+	"/api/v1/promotion/admission/search/paginated":               rolesAll,
+	"/api/v1/promotion/admission/search/export":                  rolesAll,
+	"/api/v1/promotion/admission/history":                        rolesAll,
+	"/api/v1/promotion/admission/actions":                        rolesAll,
+
+	"/api/v1/promotion-cpns/statistic/status/get":                rolesAll,
+	"/api/v1/promotion-cpns/statistic/status/series":             rolesAll,
+	"/api/v1/promotion-cpns/admission/get":                       rolesAll,
+	"/api/v1/promotion-cpns/admission/search/paginated":          rolesAll,
+	"/api/v1/promotion-cpns/admission/search/export":             rolesAll,
+	"/api/v1/promotion-cpns/admission/history":                   rolesAll,
+	"/api/v1/promotion-cpns/admission/actions":                   rolesAll,
+	"/api/v1/promotion-cpns/admission/upload/pak":                rolesAgency,
+	"/api/v1/promotion-cpns/admission/preview/pak":               rolesAll,
+	"/api/v1/promotion-cpns/admission/download/pak":              rolesAll,
+	"/api/v1/promotion-cpns/admission/upload/promotion-letter":   rolesAgency,
+	"/api/v1/promotion-cpns/admission/preview/promotion-letter":  rolesAll,
+	"/api/v1/promotion-cpns/admission/download/promotion-letter": rolesAll,
+	"/api/v1/promotion-cpns/admission/submit":                    rolesAgency,
+
+	"/api/v1/assessment-team/admission/upload":      rolesAgency,
+	"/api/v1/assessment-team/admission/preview":     rolesAll,
+	"/api/v1/assessment-team/admission/download":    rolesAll,
+	"/api/v1/assessment-team/admission/submit":      rolesAgency,
+	"/api/v1/assessment-team/admission/get":         rolesAll,
+	"/api/v1/assessment-team/admission/search":      rolesAll,
+	"/api/v1/assessment-team/admission/history":     rolesAll,
+	"/api/v1/assessment-team/admission/actions":     rolesAll,
+	"/api/v1/assessment-team/verification/upload":   rolesVerifier,
+	"/api/v1/assessment-team/verification/preview":  rolesAll,
+	"/api/v1/assessment-team/verification/download": rolesAll,
+	"/api/v1/assessment-team/verification/submit":   rolesVerifier,
+
+	"/api/v1/generic/profile/get":                 rolesAuthenticated,
+	"/api/v1/generic/role/get":                    rolesAuthenticated,
+	"/api/v1/generic/position/get":                rolesAll,
+	"/api/v1/generic/unit/list":                   rolesAll,
+	"/api/v1/generic/bezetting":                   rolesAll,
+	"/api/v1/generic/template/upload/{path:.+}":   rolesBkn,
+	"/api/v1/generic/template/download/{path:.+}": rolesAll,
+
+	"/api/v1/document/submit":   rolesAgency,
+	"/api/v1/document/get":      rolesAll,
+	"/api/v1/document/download": rolesAll,
+	"/api/v1/document/delete":   rolesAgency,
+
+	"/api/v1/module-type/submit": rolesBkn,
+	"/api/v1/module-type/get":    rolesAll,
+
+	"/api/v1/type-signer/get": rolesAll,
+
+	"/api/v1/sign/submit": rolesAuthenticated,
+
+	// Any ASN involved in an admission can be notified, including those without roles.
+	"/api/v1/notification/preference": rolesAuthenticated,
+
+	// Users can only see and revoke their own sessions.
+	"/api/v1/session/list":   rolesAuthenticated,
+	"/api/v1/session/revoke": rolesAuthenticated,
+
+	// Only BKN administrators can impersonate. The impersonated user does not have to be one to stop impersonating.
+	"/api/v1/impersonation/start": rolesBkn,
+	"/api/v1/impersonation/stop":  rolesAuthenticated,
+
+	// Users can only see the document generation jobs they have queued.
+	"/api/v1/job/get":  rolesAuthenticated,
+	"/api/v1/job/list": rolesAuthenticated,
+
+	// Hits are limited to the agency scope of the user.
+	"/api/v1/search": rolesAll,
+}
@@ -8,8 +8,10 @@ import (
 	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/health"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/httputil"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/metricutil"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/openapi"
 	"github.com/fazrithe/siasn-jf-backend-git/store"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -18,9 +20,11 @@ import (
 func createRouter(
 	corsAllowedHeaders []string,
 	corsAllowedMethods []string,
-	corsAllowedOrigins []string,
+	corsAllowedOrigins *originList,
 	authHandler *auth.Auth,
 	storeClient *store.Client,
+	contractChecker *openapi.Checker,
+	healthChecker *health.Checker,
 	metrics metricutil.GenericApiMetricsPerUrl,
 	logWriter io.Writer,
 ) (router *mux.Router) {
@@ -34,18 +38,23 @@ func createRouter(
 			handlers.AllowCredentials(),
 			handlers.AllowedHeaders(corsAllowedHeaders),
 			handlers.AllowedMethods(corsAllowedMethods),
-			handlers.AllowedOrigins(corsAllowedOrigins),
+			handlers.AllowedOriginValidator(corsAllowedOrigins.Allowed),
 		),
 		handlers.RecoveryHandler(handlers.PrintRecoveryStack(true)),
 	)
 	router.NotFoundHandler = handlers.CombinedLoggingHandler(logWriter, http.NotFoundHandler())
 	router.HandleFunc("/api/version", handleVersion).Methods("GET")
-	// router.HandleFunc("/api/v2/sign/submit", storeClient.HandleSignSubmit).Methods("post")
-	// router.HandleFunc("/api/v2/sign/req", storeClient.HandleSignReq).Methods("post")
-	// router.HandleFunc("/api/v2/sign/tte", storeClient.HandleSignTte).Methods("post")
+	if healthChecker != nil {
+		router.HandleFunc("/healthz", healthChecker.HandleLiveness).Methods("GET")
+		router.HandleFunc("/readyz", healthChecker.HandleReadiness).Methods("GET")
+	}
 	router.HandleFunc("/api/login", authHandler.LoginHandler)
 	router.HandleFunc("/api/oauth", authHandler.OidcHandler)
 	router.HandleFunc("/api/logout", authHandler.LogoutHandler)
+	if authHandler.SessionCache != nil {
+		// Called by the provider, not by users, so it is not behind authentication.
+		router.HandleFunc("/api/backchannel-logout", authHandler.BackChannelLogoutHandler).Methods("POST")
+	}
 
 	apiV1 := router.PathPrefix("/api/v1").Subrouter()
 	apiV1.Use(
@@ -55,11 +64,17 @@ func createRouter(
 		},
 		authHandler.UserExtendedAuthHandler,
 		authHandler.UserDetailAuthHandler,
+		storeClient.RoleAuthHandler(apiV1RouteRoles),
 	)
+	if contractChecker != nil {
+		// Checked after authorization, so that unauthorized requests are not reported as mismatches.
+		apiV1.Use(contractChecker.Handler)
+	}
 
 	activityV1 := apiV1.PathPrefix("/activity").Subrouter()
 
 	activityV1.HandleFunc("/statistic/status/get", storeClient.HandleGetActivityStatusStatistic).Methods("GET")
+	activityV1.HandleFunc("/statistic/status/series", storeClient.HandleGetActivityStatusStatisticSeries).Methods("GET")
 
 	activityV1.HandleFunc("/admission/submit", storeClient.HandleActivityAdmissionSubmit).Methods("POST")
 	activityV1.HandleFunc("/admission/upload", storeClient.HandleActivityAdmissionSupportDocUpload).Methods("POST")
@@ -69,9 +84,12 @@ func createRouter(
 	activityV1.HandleFunc("/admission/verify", storeClient.HandleActivityVerificationSet).Methods("POST")
 	activityV1.HandleFunc("/admission/search", storeClient.HandleActivityAdmissionSearch).Methods("GET")
 	activityV1.HandleFunc("/admission/search/paginated", storeClient.HandleActivityAdmissionSearchPaginated).Methods("GET")
+	activityV1.HandleFunc("/admission/search/export", storeClient.HandleActivityAdmissionExport).Methods("GET")
 	activityV1.HandleFunc("/admission/search-pembina", storeClient.HandleActivityAdmissionSearchPembina).Methods("GET")
 	activityV1.HandleFunc("/admission/detail", storeClient.HandleActivityAdmissionDetail).Methods("GET")
 	activityV1.HandleFunc("/admission/get", storeClient.HandleActivityAdmissionDetail).Methods("GET")
+	activityV1.HandleFunc("/admission/history", storeClient.HandleActivityHistoryGet).Methods("GET")
+	activityV1.HandleFunc("/admission/actions", storeClient.HandleActivityActionsGet).Methods("GET")
 
 	activityV1.HandleFunc("/admission/upload/recommendation-letter", storeClient.HandleActivityRecommendationLetterUpload).Methods("POST")
 	activityV1.HandleFunc("/admission/preview/recommendation-letter", storeClient.HandleActivityRecommendationLetterPreview).Methods("GET")
@@ -88,6 +106,7 @@ func createRouter(
 	requirementV1 := apiV1.PathPrefix("/requirement").Subrouter()
 
 	requirementV1.HandleFunc("/statistic/status/get", storeClient.HandleGetRequirementStatusStatistic).Methods("GET")
+	requirementV1.HandleFunc("/statistic/status/series", storeClient.HandleGetRequirementStatusStatisticSeries).Methods("GET")
 
 	requirementAdmissionV1 := requirementV1.PathPrefix("/admission").Subrouter()
 	requirementAdmissionV1.HandleFunc("/submit", storeClient.HandleRequirementAdmissionSubmit).Methods("POST")
@@ -101,8 +120,11 @@ func createRouter(
 	requirementAdmissionV1.HandleFunc("/download/estimation", storeClient.HandleRequirementAdmissionEstimationDocDownload).Methods("GET")
 	requirementAdmissionV1.HandleFunc("/search", storeClient.HandleRequirementAdmissionSearch).Methods("GET")
 	requirementAdmissionV1.HandleFunc("/search/paginated", storeClient.HandleRequirementAdmissionSearchPaginated).Methods("GET")
+	requirementAdmissionV1.HandleFunc("/search/export", storeClient.HandleRequirementAdmissionExport).Methods("GET")
 	requirementAdmissionV1.HandleFunc("/detail", storeClient.HandleRequirementAdmissionDetailGet).Methods("GET")
 	requirementAdmissionV1.HandleFunc("/get", storeClient.HandleRequirementAdmissionDetailGet).Methods("GET")
+	requirementAdmissionV1.HandleFunc("/history", storeClient.HandleRequirementHistoryGet).Methods("GET")
+	requirementAdmissionV1.HandleFunc("/actions", storeClient.HandleRequirementActionsGet).Methods("GET")
 
 	requirementVerifyV1 := requirementV1.PathPrefix("/verify").Subrouter()
 	requirementVerifyV1.Handle("/upload", endpointRemovedHandler("/api/v1/requirement/verify/upload/recommendation-letter")).Methods("PUT")
@@ -124,6 +146,7 @@ func createRouter(
 	dismissalV1 := apiV1.PathPrefix("/dismissal").Subrouter()
 
 	dismissalV1.HandleFunc("/statistic/status/get", storeClient.HandleGetDismissalStatusStatistic).Methods("GET")
+	dismissalV1.HandleFunc("/statistic/status/series", storeClient.HandleGetDismissalStatusStatisticSeries).Methods("GET")
 
 	dismissalAdmissionV1 := dismissalV1.PathPrefix("/admission").Subrouter()
 	// HandleActivityAdmissionAsnGet is reused here.
@@ -135,10 +158,14 @@ func createRouter(
 	dismissalAdmissionV1.HandleFunc("/get", storeClient.HandleDismissalAdmissionGet).Methods("GET")
 	dismissalAdmissionV1.HandleFunc("/search", storeClient.HandleDismissalAdmissionsSearch).Methods("GET")
 	dismissalAdmissionV1.HandleFunc("/search/paginated", storeClient.HandleDismissalAdmissionsSearchPaginated).Methods("GET")
+	dismissalAdmissionV1.HandleFunc("/search/export", storeClient.HandleDismissalAdmissionsExport).Methods("GET")
+	dismissalAdmissionV1.HandleFunc("/history", storeClient.HandleDismissalHistoryGet).Methods("GET")
+	dismissalAdmissionV1.HandleFunc("/actions", storeClient.HandleDismissalActionsGet).Methods("GET")
 
 	dismissalAcceptV1 := dismissalV1.PathPrefix("/accept").Subrouter()
 	dismissalAcceptV1.HandleFunc("/submit", storeClient.HandleDismissalAcceptSet).Methods("POST")
 	dismissalAcceptV1.HandleFunc("/download", storeClient.HandleDismissalAcceptanceLetterDownload).Methods("GET")
+	dismissalAcceptV1.HandleFunc("/sign", storeClient.HandleDismissalAcceptanceLetterSign).Methods("POST")
 
 	dismissalDenyV1 := dismissalV1.PathPrefix("/deny").Subrouter()
 	dismissalDenyV1.HandleFunc("/submit", storeClient.HandleDismissalDenySet).Methods("POST")
@@ -149,6 +176,7 @@ func createRouter(
 	promotionV1 := apiV1.PathPrefix("/promotion").Subrouter()
 
 	promotionV1.HandleFunc("/statistic/status/get", storeClient.HandleGetPromotionStatusStatistic).Methods("GET")
+	promotionV1.HandleFunc("/statistic/status/series", storeClient.HandleGetPromotionStatusStatisticSeries).Methods("GET")
 
 	promotionAdmissionV1 := promotionV1.PathPrefix("/admission").Subrouter()
 	promotionAdmissionV1.HandleFunc("/search-asn", storeClient.HandleActivityAdmissionAsnGet).Methods("GET")
@@ -164,20 +192,28 @@ func createRouter(
 	promotionAdmissionV1.HandleFunc("/upload/promotion-letter", storeClient.HandlePromotionAdmissionPromotionLetterUpload).Methods("POST")
 	promotionAdmissionV1.HandleFunc("/preview/promotion-letter", storeClient.HandlePromotionAdmissionPromotionLetterPreview).Methods("GET")
 	promotionAdmissionV1.HandleFunc("/download/promotion-letter", storeClient.HandlePromotionAdmissionPromotionLetterDownload).Methods("GET")
+	promotionAdmissionV1.HandleFunc("/sign/promotion-letter", storeClient.HandlePromotionAdmissionPromotionLetterSign).Methods("POST")
 	promotionAdmissionV1.HandleFunc("/upload/test-certificate", storeClient.HandlePromotionAdmissionTestCertificateUpload).Methods("POST")
 	promotionAdmissionV1.HandleFunc("/preview/test-certificate", storeClient.HandlePromotionAdmissionTestCertificatePreview).Methods("GET")
 	promotionAdmissionV1.HandleFunc("/download/test-certificate", storeClient.HandlePromotionAdmissionTestCertificateDownload).Methods("GET")
 	promotionAdmissionV1.HandleFunc("/accept", storeClient.HandlePromotionAdmissionAccept).Methods("POST")
 	promotionAdmissionV1.HandleFunc("/reject", storeClient.HandlePromotionAdmissionReject).Methods("POST")
 	promotionAdmissionV1.HandleFunc("/search/paginated", storeClient.HandlePromotionAdmissionSearchPaginated).Methods("GET")
+	promotionAdmissionV1.HandleFunc("/search/export", storeClient.HandlePromotionAdmissionExport).Methods("GET")
+	promotionAdmissionV1.HandleFunc("/history", storeClient.HandlePromotionHistoryGet).Methods("GET")
+	promotionAdmissionV1.HandleFunc("/actions", storeClient.HandlePromotionActionsGet).Methods("GET")
 
 	promotionCpnsV1 := apiV1.PathPrefix("/promotion-cpns").Subrouter()
 
 	promotionCpnsV1.HandleFunc("/statistic/status/get", storeClient.HandleGetPromotionCpnsStatusStatistic).Methods("GET")
+	promotionCpnsV1.HandleFunc("/statistic/status/series", storeClient.HandleGetPromotionCpnsStatusStatisticSeries).Methods("GET")
 
 	promotionCpnsAdmissionV1 := promotionCpnsV1.PathPrefix("/admission").Subrouter()
 	promotionCpnsAdmissionV1.HandleFunc("/get", storeClient.HandlePromotionCpnsAdmissionGet).Methods("GET")
 	promotionCpnsAdmissionV1.HandleFunc("/search/paginated", storeClient.HandlePromotionCpnsAdmissionSearchPaginated).Methods("GET")
+	promotionCpnsAdmissionV1.HandleFunc("/search/export", storeClient.HandlePromotionCpnsAdmissionExport).Methods("GET")
+	promotionCpnsAdmissionV1.HandleFunc("/history", storeClient.HandlePromotionCpnsHistoryGet).Methods("GET")
+	promotionCpnsAdmissionV1.HandleFunc("/actions", storeClient.HandlePromotionCpnsActionsGet).Methods("GET")
 	promotionCpnsAdmissionV1.HandleFunc("/upload/pak", storeClient.HandlePromotionCpnsAdmissionPakLetterUpload).Methods("POST")
 	promotionCpnsAdmissionV1.HandleFunc("/preview/pak", storeClient.HandlePromotionCpnsAdmissionPakLetterPreview).Methods("GET")
 	promotionCpnsAdmissionV1.HandleFunc("/download/pak", storeClient.HandlePromotionCpnsAdmissionPakLetterDownload).Methods("GET")
@@ -194,6 +230,8 @@ func createRouter(
 	assessmentTeamAdmissionV1.HandleFunc("/submit", storeClient.HandleAssessmentTeamAdmissionSubmit).Methods("POST")
 	assessmentTeamAdmissionV1.HandleFunc("/get", storeClient.HandleAssessmentTeamGet).Methods("GET")
 	assessmentTeamAdmissionV1.HandleFunc("/search", storeClient.HandleAssessmentTeamSearch).Methods("GET")
+	assessmentTeamAdmissionV1.HandleFunc("/history", storeClient.HandleAssessmentTeamHistoryGet).Methods("GET")
+	assessmentTeamAdmissionV1.HandleFunc("/actions", storeClient.HandleAssessmentTeamActionsGet).Methods("GET")
 
 	assessmentTeamVerificationV1 := assessmentTeamV1.PathPrefix("/verification").Subrouter()
 	assessmentTeamVerificationV1.HandleFunc("/upload", storeClient.HandleAssessmentTeamVerificationRecommendationLetterUpload).Methods("POST")
@@ -224,7 +262,27 @@ func createRouter(
 	signerV1.HandleFunc("/get", storeClient.HandleTypeSignerGet).Methods("GET")
 
 	signtte := apiV1.PathPrefix("/sign").Subrouter()
-	signtte.HandleFunc("/submit", storeClient.HandleSignSubmit).Methods("post")
+	signtte.Handle("/submit", endpointRemovedHandler("/api/v1/requirement/verify/sign/recommendation-letter")).Methods("POST")
+
+	notificationV1 := apiV1.PathPrefix("/notification").Subrouter()
+	notificationV1.HandleFunc("/preference", storeClient.HandleNotificationPreferenceGet).Methods("GET")
+	notificationV1.HandleFunc("/preference", storeClient.HandleNotificationPreferenceUpdate).Methods("PUT")
+
+	if authHandler.SessionCache != nil {
+		sessionV1 := apiV1.PathPrefix("/session").Subrouter()
+		sessionV1.HandleFunc("/list", authHandler.HandleSessionList).Methods("GET")
+		sessionV1.HandleFunc("/revoke", authHandler.HandleSessionRevoke).Methods("POST")
+
+		impersonationV1 := apiV1.PathPrefix("/impersonation").Subrouter()
+		impersonationV1.HandleFunc("/start", authHandler.HandleImpersonationStart).Methods("POST")
+		impersonationV1.HandleFunc("/stop", authHandler.HandleImpersonationStop).Methods("POST")
+	}
+
+	jobV1 := apiV1.PathPrefix("/job").Subrouter()
+	jobV1.HandleFunc("/get", storeClient.HandleJobGet).Methods("GET")
+	jobV1.HandleFunc("/list", storeClient.HandleJobList).Methods("GET")
+
+	apiV1.HandleFunc("/search", storeClient.HandleSearch).Methods("GET")
 	return
 }
 
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/openapi"
+	"github.com/fazrithe/siasn-jf-backend-git/store"
+	"github.com/gorilla/mux"
+)
+
+// assertRoutesDocumented walks every route of router and fails the test for each route under the base path of spec
+// that does not have an operation in spec.
+func assertRoutesDocumented(t *testing.T, router *mux.Router, spec *openapi.Spec) {
+	t.Helper()
+
+	var routes []openapi.Route
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		// Subrouters and routes without methods, such as /api/login, are not operations.
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			routes = append(routes, openapi.Route{Method: method, Template: template})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("cannot walk routes: %v", err)
+	}
+	if len(routes) == 0 {
+		t.Fatal("router does not have any route")
+	}
+
+	for _, route := range spec.Undocumented(routes) {
+		t.Errorf("route %s is not documented in siasn-jf.json", route)
+	}
+}
+
+func TestRoutesDocumented(t *testing.T) {
+	spec, err := loadOpenapiSpec()
+	if err != nil {
+		t.Fatalf("cannot load siasn-jf.json: %v", err)
+	}
+	if spec.BasePath != "/api/v1" {
+		t.Fatalf("the server URL of siasn-jf.json must end with /api/v1, not %s", spec.BasePath)
+	}
+
+	router := createRouter(nil, nil, nil, &auth.Auth{}, &store.Client{}, nil, nil, nil, io.Discard)
+	assertRoutesDocumented(t, router, spec)
+}
+
+func TestCreateContractChecker(t *testing.T) {
+	checker, err := createContractChecker("enforce", nil)
+	if err != nil {
+		t.Fatalf("cannot create contract checker: %v", err)
+	}
+	if checker.Mode != openapi.ModeEnforce {
+		t.Errorf("unexpected mode %s", checker.Mode)
+	}
+
+	if _, err = createContractChecker("strict", nil); err == nil {
+		t.Error("unknown mode must fail")
+	}
+}
+
+func TestCorsOriginsReload(t *testing.T) {
+	corsOrigins := newOriginList([]string{"https://a.example.com"})
+	router := createRouter(nil, []string{"GET"}, corsOrigins, &auth.Auth{}, &store.Client{}, nil, nil, nil, io.Discard)
+
+	allowedOrigin := func(origin string) string {
+		request := httptest.NewRequest("GET", "/api/version", nil)
+		request.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, request)
+		return rec.Header().Get("Access-Control-Allow-Origin")
+	}
+
+	if allowed := allowedOrigin("https://b.example.com"); allowed != "" {
+		t.Errorf("origin must not be allowed, got %q", allowed)
+	}
+	corsOrigins.Set([]string{"https://a.example.com", "https://b.example.com"})
+	if allowed := allowedOrigin("https://b.example.com"); allowed != "https://b.example.com" {
+		t.Errorf("reloaded origin must be allowed, got %q", allowed)
+	}
+	corsOrigins.Set(nil)
+	if allowed := allowedOrigin("https://c.example.com"); allowed != "https://c.example.com" {
+		t.Errorf("every origin must be allowed when empty, got %q", allowed)
+	}
+}
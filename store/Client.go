@@ -5,7 +5,10 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 
 	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/breaker"
@@ -14,6 +17,8 @@ import (
 	"github.com/fazrithe/siasn-jf-backend-git/libs/httputil"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/logutil"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/metricutil"
+	"github.com/fazrithe/siasn-jf-backend-git/store/esign"
+	"github.com/fazrithe/siasn-jf-backend-git/store/notify"
 	"github.com/fazrithe/siasn-jf-backend-git/store/object"
 	"github.com/gorilla/schema"
 )
@@ -30,9 +35,20 @@ type Client struct {
 	PromotionCpnsStorage  object.PromotionCpnsStorage
 	AssessmentTeamStorage object.AssessmentTeamStorage
 	DocxRenderer          docx.Renderer
+	Signer                esign.Signer
 	SqlMetrics            metricutil.GenericSqlMetrics
-	Breaker               *breaker.RateCircuitBreaker
 	Logger                logutil.Logger
+	// Notifier notifies the ASNs involved in an admission of its status changes. Nil disables notifications.
+	Notifier notify.Notifier
+	// RoleCache caches user roles in RoleAuthHandler. Nil disables caching.
+	RoleCache *RoleCache
+	// PembinaPositionCache caches the functional positions supervised by pembina agencies. Nil disables caching.
+	PembinaPositionCache *PembinaPositionCache
+	// Jobs runs the document generation jobs. Nil disables the endpoints that generate documents.
+	Jobs *JobRunner
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For header is trusted when recording the IP address of
+	// status changes. Nil trusts no proxy.
+	TrustedProxies []*net.IPNet
 }
 
 func NewClient(
@@ -41,8 +57,8 @@ func NewClient(
 	referenceDb *sql.DB,
 	storage object.Storage,
 	docxRenderer docx.Renderer,
+	signer esign.Signer,
 	sqlMetrics metricutil.GenericSqlMetrics,
-	breaker *breaker.RateCircuitBreaker,
 ) *Client {
 	return &Client{
 		Db:                    db,
@@ -55,9 +71,12 @@ func NewClient(
 		PromotionCpnsStorage:  storage,
 		AssessmentTeamStorage: storage,
 		DocxRenderer:          docxRenderer,
+		Signer:                signer,
 		SqlMetrics:            sqlMetrics,
 		Logger:                logutil.NewStdLogger(false, "store"),
-		Breaker:               breaker,
+		RoleCache:             NewRoleCache(RoleCacheTtl),
+		PembinaPositionCache:  NewPembinaPositionCache(PembinaPositionCacheTtl),
+		Jobs:                  NewJobRunner(),
 	}
 }
 
@@ -88,7 +107,6 @@ func (c *Client) createMtxDb(ctx context.Context, db *sql.DB) (mtx *metricutil.T
 }
 
 // completeMtx completes an mtx (an sql.Tx wrapper) with Commit if err is nil and Rollback if err is not nil.
-// This function does not add error to the breaker.
 func (c *Client) completeMtx(mtx *metricutil.Tx, err error) {
 	if err == nil {
 		_ = mtx.Commit()
@@ -118,15 +136,24 @@ func (c *Client) httpErrorVerifyListMeta(writer http.ResponseWriter, pageNumber,
 	return nil
 }
 
-// httpError writes error to response. Also write to log and add breaker if its a client error.
+// httpError writes error to response. Also write to log if its a server error.
 // Generic errors that are not a derivative of ec.Error will be wrapped as ec.Error.
 // Errors that are derivatives of ec.Error (by errors.As test) are returned as is.
 // Error code to HTTP status mapping is retrieved from ErrsToHttp.
+//
+// Errors caused by an open circuit breaker of a dependency, whatever their code, are written as
+// ErrCodeDependencyUnavailable with a Retry-After header, see writeDependencyUnavailable.
 func (c *Client) httpError(writer http.ResponseWriter, err error) {
 	if err == nil {
 		panic("error cannot be nil")
 	}
 
+	if openErr, ok := breaker.AsOpenError(err); ok {
+		c.Logger.Warn(err.Error())
+		writeDependencyUnavailable(writer, openErr)
+		return
+	}
+
 	var status int
 	var returned error
 	var w *ec.Error
@@ -146,7 +173,6 @@ func (c *Client) httpError(writer http.ResponseWriter, err error) {
 		if status, ok = ErrsToHttp[w.Code]; !ok {
 			status = http.StatusInternalServerError
 		}
-		c.Breaker.AddError(returned)
 		c.Logger.Warn(returned.Error())
 		// Cause is never returned by the API if this is a server error, but it will be logged.
 		_ = httputil.WriteObj(writer, ec.NewErrorBasic(w.Code, w.Message), status)
@@ -160,9 +186,25 @@ func (c *Client) httpError(writer http.ResponseWriter, err error) {
 	return
 }
 
+// writeDependencyUnavailable writes ErrCodeDependencyUnavailable naming the dependency whose breaker is open, asking
+// the client to retry once the breaker lets trial calls through.
+func writeDependencyUnavailable(writer http.ResponseWriter, openErr *breaker.OpenError) {
+	retryAfter := int(math.Ceil(openErr.RetryAfter.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	writer.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	_ = httputil.WriteObj(writer, &ec.Error{
+		Message: Errs[ErrCodeDependencyUnavailable],
+		Code:    ErrCodeDependencyUnavailable,
+		Data:    map[string]string{"dependency": openErr.Name},
+	}, ErrsToHttp[ErrCodeDependencyUnavailable])
+}
+
 // decodeRequestJson decodes HTTP request body as JSON to `obj`.
 // It also utilizes metricutil.CounterBuffer to count number of bytes decoded. This function already
 // takes care sending error message to requester so you don't need to do it again outside this helper function.
+// The decoded object is validated against its validate tags, see validateRequest.
 func (c *Client) decodeRequestJson(writer http.ResponseWriter, request *http.Request, obj interface{}) (err error) {
 	if request.Body == nil {
 		c.httpError(writer, ErrRequestBodyNil)
@@ -175,12 +217,19 @@ func (c *Client) decodeRequestJson(writer http.ResponseWriter, request *http.Req
 		return
 	}
 
+	err = validateRequest(obj, ErrCodeRequestValidation)
+	if err != nil {
+		c.httpError(writer, err)
+		return err
+	}
+
 	return nil
 }
 
 // decodeRequestSchema decodes HTTP request query string to `obj` using gorilla/schema.
 // This function already
 // takes care sending error message to requester so you don't need to do it again outside this helper function.
+// The decoded object is validated against its validate tags, see validateRequest.
 func (c *Client) decodeRequestSchema(writer http.ResponseWriter, request *http.Request, obj interface{}) (err error) {
 	decoder := schema.NewDecoder()
 	decoder.IgnoreUnknownKeys(true)
@@ -190,6 +239,12 @@ func (c *Client) decodeRequestSchema(writer http.ResponseWriter, request *http.R
 		return err
 	}
 
+	err = validateRequest(obj, ErrCodeRequestValidation)
+	if err != nil {
+		c.httpError(writer, err)
+		return err
+	}
+
 	return nil
 }
 
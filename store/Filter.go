@@ -4,6 +4,44 @@ import (
 	"github.com/fazrithe/siasn-jf-backend-git/store/models"
 )
 
+// AdmissionSearchOptions represents the filters and the sort order shared by the paginated searches and the exports
+// of every admission module. Every option is optional, an empty option does not limit the search. The options are
+// combined with the filters of each module.
+type AdmissionSearchOptions struct {
+	// AdmissionDateFrom limits the search to the admissions dated on or after this date. It is the same date searched
+	// by the AdmissionDate of each module.
+	AdmissionDateFrom models.Iso8601Date `schema:"tgl_dari"`
+
+	// AdmissionDateTo limits the search to the admissions dated on or before this date.
+	AdmissionDateTo models.Iso8601Date `schema:"tgl_sampai"`
+
+	// AdmissionStatuses limits the search to the admissions in one of these statuses.
+	AdmissionStatuses []int `schema:"status"`
+
+	// AdmissionNumber limits the search to the admissions whose number (no_usulan) contains this value, case-insensitive.
+	AdmissionNumber string `schema:"no_usulan"`
+
+	// PositionId limits the search to the admissions of this functional position or position grade. It is ignored by
+	// the modules whose admissions do not have one, dismissals.
+	PositionId string `schema:"jabatan_fungsional_id"`
+
+	// Asn limits the search to the admissions of the ASNs whose NIP is this value, or whose name contains this value.
+	// It is ignored by the modules whose admissions are not about an ASN, activities, requirements and assessment teams.
+	Asn string `schema:"asn"`
+
+	// Sort is one of AdmissionSortDate, AdmissionSortStatus or AdmissionSortNumber, prefixed by - for descending order.
+	// Defaults to the newest admissions first.
+	Sort string `schema:"urutan"`
+
+	// Pagination is PaginationOffset (default) to page with page numbers, or PaginationCursor to page with cursors.
+	// Exports are not paginated and ignore it.
+	Pagination string `schema:"pagination"`
+
+	// Cursor is the next_cursor of the previous page when paginating with cursors, empty for the first page. Setting it
+	// implies PaginationCursor.
+	Cursor string `schema:"cursor"`
+}
+
 // ActivityAdmissionSearchFilter represents the filters that can be applied when searching for admissions.
 type ActivityAdmissionSearchFilter struct {
 	// WorkAgencyId the ID of work agency (instansi kerja) an admission is tied to.
@@ -19,6 +57,12 @@ type ActivityAdmissionSearchFilter struct {
 	// AdmissionType is one of the types in models.ActivityTypes
 	AdmissionType int
 
+	// PositionIds limits the search to the admissions of these functional positions (jabatan_jenjang).
+	// Nil does not limit the search.
+	PositionIds []string
+
+	AdmissionSearchOptions
+
 	PageNumber int `json:"halaman"`
 
 	CountPerPage int `json:"jumlah_per_halaman"`
@@ -36,6 +80,8 @@ type RequirementAdmissionSearchFilter struct {
 	// AdmissionStatus is one of the statuses in models.RequirementAdmissionStatuses
 	AdmissionStatus int
 
+	AdmissionSearchOptions
+
 	PageNumber int `json:"halaman"`
 
 	CountPerPage int `json:"jumlah_per_halaman"`
@@ -53,6 +99,8 @@ type PromotionAdmissionSearchFilter struct {
 	// AdmissionType is one of the types in models.PromotionTypes
 	AdmissionType int
 
+	AdmissionSearchOptions
+
 	PageNumber int `json:"halaman"`
 
 	CountPerPage int `json:"jumlah_per_halaman"`
@@ -64,14 +112,35 @@ type PromotionCpnsAdmissionSearchFilter struct {
 	// The search will be performed between this value and one day after this value.
 	AdmissionDate string `json:"tgl_usulan" schema:"tgl_usulan"`
 
-	// AdmissionStatus is one of the statuses in models.PromotionAdmissionStatuses
-	AdmissionStatus int `json:"status" schema:"status"`
+	// AdmissionStatus is one of the statuses in models.PromotionCpnsAdmissionStatuses. It is not decoded from the
+	// query parameters, status is decoded into AdmissionSearchOptions.AdmissionStatuses.
+	AdmissionStatus int `json:"status" schema:"-"`
+
+	AdmissionSearchOptions
 
 	PageNumber int `json:"halaman" schema:"halaman"`
 
 	CountPerPage int `json:"jumlah_per_halaman" schema:"jumlah_per_halaman"`
 }
 
+// DismissalAdmissionSearchFilter represents the filters that can be applied when searching for dismissals.
+type DismissalAdmissionSearchFilter struct {
+	// AgencyId the ID of work agency (instansi kerja) an admission is tied to.
+	AgencyId string
+
+	// AdmissionDate is the exact dismissal date (tgl_pemberhentian) to search the admissions.
+	AdmissionDate models.Iso8601Date
+
+	// AdmissionStatus is one of the statuses in models.DismissalAdmissionStatuses
+	AdmissionStatus int
+
+	AdmissionSearchOptions
+
+	PageNumber int `json:"halaman"`
+
+	CountPerPage int `json:"jumlah_per_halaman"`
+}
+
 // AssessmentTeamAdmissionSearchFilter represents the filters that can be applied when searching for assessment team admissions.
 type AssessmentTeamAdmissionSearchFilter struct {
 	// AgencyId the ID of work agency (instansi kerja) an admission is tied to.
@@ -87,6 +156,8 @@ type AssessmentTeamAdmissionSearchFilter struct {
 	// AdmissionStatus is one of the statuses in models.ActivityAdmissionStatuses
 	AdmissionStatus int
 
+	AdmissionSearchOptions
+
 	PageNumber int `json:"halaman"`
 
 	CountPerPage int `json:"jumlah_per_halaman"`
@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -18,6 +19,7 @@ import (
 	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/docx"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/export"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/metricutil"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/search"
 	"github.com/fazrithe/siasn-jf-backend-git/store/models"
@@ -107,26 +109,11 @@ func (c *Client) InsertActivityAdmissionCtx(ctx context.Context, request *models
 		log.Fatal(err)
 	}
 
-	queryHist := "INSERT INTO kegiatan_status_hist (kegiatan_kegiatan_id, status, modified_at_ts, user_id) VALUES ($1, $2, $3, $4)"
-
-	// Execute the SQL INSERT statement with the data
-	_, err = mtx.Exec(queryHist, activityIdBytes, models.ActivityAdmissionStatusCreated, time.Now(), request.SubmitterAsnId)
+	_, err = c.insertStatusHistoryCtx(ctx, mtx, StatusHistoryModuleActivity, activityIdBytes.String(), 0, models.ActivityAdmissionStatusCreated, request.SubmitterAsnId, "")
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
 
-	// _, err = mtx.ExecContext(
-	// 	ctx,
-	// 	"insert into kegiatan_status_hist(kegiatan_kegiatan_id, status, modified_at_ts, user_id) VALUES($1, $2, $3, $4)",
-	// 	activityIdBytes,
-	// 	models.ActivityAdmissionStatusCreated,
-	// 	time.Now(),
-	// 	request.SubmitterAsnId,
-	// )
-	// if err != nil {
-	// 	return "", ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("cannot insert entry to kegiatan_status_hist: %w", err))
-	// }
-
 	pegawaiStmt, err := mtx.PrepareContext(ctx, "insert into pegawai(user_id, nip_baru, nip_lama) VALUES($1, $2, $3) on conflict(user_id) do nothing")
 	if err != nil {
 		return "", ec.NewError(ErrCodePrepareFail, Errs[ErrCodePrepareFail], fmt.Errorf("cannot prepare statement for pegawai table: %w", err))
@@ -225,41 +212,28 @@ func (c *Client) GetAsnOldCtx(ctx context.Context, oldNip, workAgencyId string)
 	return c.GetUserDetailByNipWorkAgencyId(ctx, oldNip, workAgencyId)
 }
 
-// updateActivityStatusCtxDh updates an activity status.
+// updateActivityStatusCtxDh updates an activity status from oldStatus, only if the activity is in the agency scope.
 // This will also insert a new status update history entry. This method already returns an error in form of error code.
-func (c *Client) updateActivityStatusCtxDh(ctx context.Context, dh metricutil.DbHandler, activityId uuid.UUID, submitterAsnId string, agencyId string, status int) (modifiedAt time.Time, err error) {
+func (c *Client) updateActivityStatusCtxDh(ctx context.Context, dh metricutil.DbHandler, scope *AgencyScope, activityId uuid.UUID, submitterAsnId string, oldStatus, status int) (modifiedAt time.Time, err error) {
 	_, err = dh.ExecContext(
 		ctx,
-		"update kegiatan set status = $1 where kegiatan_id = $2 and instansi_id = $3",
+		"update kegiatan set status = $1 where kegiatan_id = $2 and ($3::text[] is null or instansi_id = any($3) or jabatan_jenjang = any($4))",
 		status,
 		activityId.String(),
-		agencyId,
+		scope.sqlArg(),
+		scope.sqlPositionArg(),
 	)
 	if err != nil {
 		return time.Time{}, ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], err)
 	}
 
-	modifiedAt = time.Now()
-	_, err = dh.ExecContext(
-		ctx,
-		"insert into kegiatan_status_hist(kegiatan_kegiatan_id, status, modified_at_ts, user_id) values($1, $2, $3, $4)",
-		activityId.String(),
-		status,
-		modifiedAt,
-		submitterAsnId,
-	)
-	if err != nil {
-		return time.Time{}, ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], err)
-	}
-
-	return modifiedAt, nil
+	return c.insertStatusHistoryCtx(ctx, dh, StatusHistoryModuleActivity, activityId.String(), oldStatus, status, submitterAsnId, "")
 }
 
 // Deprecated: CSR status is removed.
 // SetActivityStatusCsrCtx sets an activity admission status to certificate request.
-// If the status of the activity is not models.ActivityAdmissionStatusAccepted, this will return error code errnum.ErrCodeActivityCsrStatusSetNotAccepted.
-// If the status is already models.ActivityAdmissionStatusCertRequest, this will return error code errnum.ErrCodeActivityCsrStatusSetOngoing.
-func (c *Client) SetActivityStatusCsrCtx(ctx context.Context, request *models.ActivityCsrRequest) (modifiedAt time.Time, err error) {
+// If the activity workflow does not allow it, this will return error code errnum.ErrCodeWorkflowTransitionInvalid.
+func (c *Client) SetActivityStatusCsrCtx(ctx context.Context, scope *AgencyScope, request *models.ActivityCsrRequest) (modifiedAt time.Time, err error) {
 	mtx, err := c.createMtx(ctx)
 	if err != nil {
 		return time.Time{}, err
@@ -275,7 +249,7 @@ func (c *Client) SetActivityStatusCsrCtx(ctx context.Context, request *models.Ac
 	}
 
 	currentStatus := 0
-	err = mtx.QueryRowContext(ctx, "select status from kegiatan where kegiatan_id = $1 and instansi_id = $2 for update", request.ActivityId, request.AgencyId).Scan(&currentStatus)
+	err = mtx.QueryRowContext(ctx, "select status from kegiatan where kegiatan_id = $1 and ($2::text[] is null or instansi_id = any($2) or jabatan_jenjang = any($3)) for update", request.ActivityId, scope.sqlArg(), scope.sqlPositionArg()).Scan(&currentStatus)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return time.Time{}, ErrEntryNotFound
@@ -284,16 +258,9 @@ func (c *Client) SetActivityStatusCsrCtx(ctx context.Context, request *models.Ac
 		return time.Time{}, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
 
-	if currentStatus == models.ActivityAdmissionStatusCertRequest {
-		return time.Time{}, ec.NewErrorBasic(ErrCodeActivityCsrStatusSetOngoing, Errs[ErrCodeActivityCsrStatusSetOngoing])
-	}
-
-	if currentStatus != models.ActivityAdmissionStatusAccepted {
-		return time.Time{}, ec.NewErrorBasic(ErrCodeActivityCsrStatusSetNotAccepted, Errs[ErrCodeActivityCsrStatusSetNotAccepted])
-	}
-
-	if len(request.AttendeesPassing) <= 0 {
-		return time.Time{}, ec.NewErrorBasic(ErrCodeActivityVerificationStatusNoAttendees, Errs[ErrCodeActivityVerificationStatusNoAttendees])
+	err = checkTransition(activityWorkflow, currentStatus, WorkflowActionRequestCert, nil, request)
+	if err != nil {
+		return time.Time{}, err
 	}
 
 	ignored := 0
@@ -311,7 +278,7 @@ func (c *Client) SetActivityStatusCsrCtx(ctx context.Context, request *models.Ac
 		}
 	}
 
-	modifiedAt, err = c.updateActivityStatusCtxDh(ctx, mtx, activityIdBytes, request.SubmitterAsnId, request.AgencyId, models.ActivityAdmissionStatusCertRequest)
+	modifiedAt, err = c.updateActivityStatusCtxDh(ctx, mtx, scope, activityIdBytes, request.SubmitterAsnId, currentStatus, models.ActivityAdmissionStatusCertRequest)
 	if err != nil {
 		return time.Time{}, err
 	}
@@ -320,9 +287,8 @@ func (c *Client) SetActivityStatusCsrCtx(ctx context.Context, request *models.Ac
 }
 
 // SetActivityStatusAcceptedCtx sets an activity admission status as models.ActivityAdmissionStatusAccepted.
-// If the status of the activity is not models.ActivityAdmissionStatusCreated, this will return error code errnum.ErrCodeActivityVerificationStatusProcessedFurther.
-// If the status is already models.ActivityAdmissionStatusAccepted, this will return error code errnum.ErrCodeActivityVerificationStatusAlreadyAccepted.
-func (c *Client) SetActivityStatusAcceptedCtx(ctx context.Context, request *models.ActivityVerificationRequest) (modifiedAt time.Time, err error) {
+// If the activity workflow does not allow it, this will return error code errnum.ErrCodeWorkflowTransitionInvalid.
+func (c *Client) SetActivityStatusAcceptedCtx(ctx context.Context, scope *AgencyScope, request *models.ActivityVerificationRequest) (modifiedAt time.Time, err error) {
 	activityId, err := uuid.Parse(request.ActivityId)
 	if err != nil {
 		return time.Time{}, ec.NewError(ErrCodeUuidInvalid, Errs[ErrCodeUuidInvalid], err)
@@ -338,7 +304,7 @@ func (c *Client) SetActivityStatusAcceptedCtx(ctx context.Context, request *mode
 	}()
 
 	currentStatus := 0
-	err = mtx.QueryRowContext(ctx, "select status from kegiatan where kegiatan_id = $1 and instansi_id = $2 for update", request.ActivityId, request.AgencyId).Scan(&currentStatus)
+	err = mtx.QueryRowContext(ctx, "select status from kegiatan where kegiatan_id = $1 and ($2::text[] is null or instansi_id = any($2) or jabatan_jenjang = any($3)) for update", request.ActivityId, scope.sqlArg(), scope.sqlPositionArg()).Scan(&currentStatus)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return time.Time{}, ErrEntryNotFound
@@ -347,16 +313,9 @@ func (c *Client) SetActivityStatusAcceptedCtx(ctx context.Context, request *mode
 		return time.Time{}, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
 
-	if currentStatus == models.ActivityAdmissionStatusAccepted {
-		return time.Time{}, ec.NewErrorBasic(ErrCodeActivityVerificationStatusAlreadyAccepted, Errs[ErrCodeActivityVerificationStatusAlreadyAccepted])
-	}
-
-	if currentStatus != models.ActivityAdmissionStatusCreated {
-		return time.Time{}, ec.NewErrorBasic(ErrCodeActivityVerificationStatusProcessedFurther, Errs[ErrCodeActivityVerificationStatusProcessedFurther])
-	}
-
-	if len(request.AttendeesAcceptance) <= 0 {
-		return time.Time{}, ec.NewErrorBasic(ErrCodeActivityVerificationStatusNoAttendees, Errs[ErrCodeActivityVerificationStatusNoAttendees])
+	err = checkTransition(activityWorkflow, currentStatus, WorkflowActionVerify, nil, request)
+	if err != nil {
+		return time.Time{}, err
 	}
 
 	isAccepted := false
@@ -374,7 +333,7 @@ func (c *Client) SetActivityStatusAcceptedCtx(ctx context.Context, request *mode
 		}
 	}
 
-	modifiedAt, err = c.updateActivityStatusCtxDh(ctx, mtx, activityId, request.SubmitterAsnId, request.AgencyId, models.ActivityAdmissionStatusAccepted)
+	modifiedAt, err = c.updateActivityStatusCtxDh(ctx, mtx, scope, activityId, request.SubmitterAsnId, currentStatus, models.ActivityAdmissionStatusAccepted)
 	if err != nil {
 		return time.Time{}, err
 	}
@@ -394,13 +353,13 @@ func (c *Client) CreateCertFilename(activityId, attendeeAsnId string, certType i
 }
 
 // VerifyActivityCertCtx verifies that an upload request is valid and returns a full object filename to be uploaded
-// to object storage. Upload request is not valid if activity status is not models.ActivityAdmissionStatusAccepted.
-func (c *Client) VerifyActivityCertCtx(ctx context.Context, request *models.ActivityCertGenUploadRequest) (filename string, err error) {
+// to object storage. Upload request is not valid if the activity workflow does not allow publishing certificates.
+func (c *Client) VerifyActivityCertCtx(ctx context.Context, scope *AgencyScope, request *models.ActivityCertGenUploadRequest) (filename string, err error) {
 	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
 
 	currentStatus := 0
 	currentType := 0
-	err = mdb.QueryRowContext(ctx, "select status, jenis from kegiatan where kegiatan_id = $1 and instansi_id = $2 for share", request.ActivityId, request.AgencyId).Scan(&currentStatus, &currentType)
+	err = mdb.QueryRowContext(ctx, "select status, jenis from kegiatan where kegiatan_id = $1 and ($2::text[] is null or instansi_id = any($2) or jabatan_jenjang = any($3)) for share", request.ActivityId, scope.sqlArg(), scope.sqlPositionArg()).Scan(&currentStatus, &currentType)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return "", ErrEntryNotFound
@@ -409,8 +368,9 @@ func (c *Client) VerifyActivityCertCtx(ctx context.Context, request *models.Acti
 		return "", ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
 
-	if currentStatus != models.ActivityAdmissionStatusAccepted {
-		return "", ec.NewErrorBasic(ErrCodeActivityCertSubmitNotRequested, Errs[ErrCodeActivityCertSubmitNotRequested])
+	_, err = activityWorkflow.Can(currentStatus, WorkflowActionPublishCert)
+	if err != nil {
+		return "", workflowError(err)
 	}
 
 	if request.Type == models.ActivityCertTypePak && currentType != models.ActivityTypeMutationExam {
@@ -425,11 +385,11 @@ func (c *Client) VerifyActivityCertCtx(ctx context.Context, request *models.Acti
 // in temporary storage. You can handle the error code ErrCodeStorageCopyFail in case the temporary files do not exist,
 // for example due to temporary storage being purged at the exact time certificates are submitted.
 //
-// May return ErrCodeEntryNotFound if activity cannot be found. May also return ErrCodeActivityCertSubmitNotRequested
-// if activity status is not models.ActivityAdmissionStatusAccepted.
+// May return ErrCodeEntryNotFound if activity cannot be found. May also return ErrCodeWorkflowTransitionInvalid
+// if the activity workflow does not allow publishing certificates.
 //
 // PAK document type is only supported for activity with type uji kompetensi perpindahan jabatan (models.ActivityTypeMutationExam).
-func (c *Client) InsertActivityCertCtx(ctx context.Context, cert *models.ActivityCertGenRequest) (modifiedAt time.Time, err error) {
+func (c *Client) InsertActivityCertCtx(ctx context.Context, scope *AgencyScope, cert *models.ActivityCertGenRequest) (modifiedAt time.Time, err error) {
 	mtx, err := c.createMtxDb(ctx, c.Db)
 	if err != nil {
 		return time.Time{}, err
@@ -450,7 +410,7 @@ func (c *Client) InsertActivityCertCtx(ctx context.Context, cert *models.Activit
 
 	currentStatus := 0
 	currentType := 0
-	err = mtx.QueryRowContext(ctx, "select status, jenis from kegiatan where kegiatan_id = $1 and instansi_id = $2 for update", cert.ActivityId, cert.AgencyId).Scan(&currentStatus, &currentType)
+	err = mtx.QueryRowContext(ctx, "select status, jenis from kegiatan where kegiatan_id = $1 and ($2::text[] is null or instansi_id = any($2) or jabatan_jenjang = any($3)) for update", cert.ActivityId, scope.sqlArg(), scope.sqlPositionArg()).Scan(&currentStatus, &currentType)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return time.Time{}, ErrEntryNotFound
@@ -459,8 +419,9 @@ func (c *Client) InsertActivityCertCtx(ctx context.Context, cert *models.Activit
 		return time.Time{}, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
 
-	if currentStatus != models.ActivityAdmissionStatusAccepted {
-		return time.Time{}, ec.NewErrorBasic(ErrCodeActivityCertSubmitNotRequested, Errs[ErrCodeActivityCertSubmitNotRequested])
+	err = checkTransition(activityWorkflow, currentStatus, WorkflowActionPublishCert, nil, cert)
+	if err != nil {
+		return time.Time{}, err
 	}
 
 	stmt, err := mtx.PrepareContext(ctx, "insert into sertifikat(persertakegiatan_kegiatan_id, persertakegiatan_user_id, nosurat, tgl_surat, jenis, ttd_user_id, createdat, nilai) values($1, $2, $3, $4, $5, $6, current_timestamp, $7)")
@@ -503,7 +464,7 @@ func (c *Client) InsertActivityCertCtx(ctx context.Context, cert *models.Activit
 
 	}
 
-	modifiedAt, err = c.updateActivityStatusCtxDh(ctx, mtx, activityIdUuid, cert.SubmitterAsnId, cert.AgencyId, models.ActivityAdmissionStatusCertPublished)
+	modifiedAt, err = c.updateActivityStatusCtxDh(ctx, mtx, scope, activityIdUuid, cert.SubmitterAsnId, currentStatus, models.ActivityAdmissionStatusCertPublished)
 	if err != nil {
 		return time.Time{}, err
 	}
@@ -617,6 +578,13 @@ func (c *Client) SearchActivityAdmissionsCtx(ctx context.Context, searchFilter *
 		queryBuilder.WriteString(strconv.Itoa(len(queryArgs)))
 	}
 
+	if searchFilter.PositionIds != nil {
+		queryBuilder.WriteString(" and jabatan_jenjang = any($")
+		queryArgs = append(queryArgs, pq.Array(searchFilter.PositionIds))
+		queryBuilder.WriteString(strconv.Itoa(len(queryArgs)))
+		queryBuilder.WriteString(")")
+	}
+
 	query := queryBuilder.String()
 	admissionRows, err := mdb.QueryContext(ctx, query, queryArgs...)
 	if err != nil {
@@ -652,22 +620,56 @@ func (c *Client) SearchActivityAdmissionsCtx(ctx context.Context, searchFilter *
 	return
 }
 
+var activityAdmissionSearchTable = &admissionSearchTable{
+	name:           "kegiatan",
+	idColumn:       "kegiatan_id",
+	dateColumn:     "tgl_usulan",
+	positionColumn: "jabatan_jenjang",
+}
+
+// activityAdmissionSearchQueryCtx builds the query of SearchActivityAdmissionsPaginatedCtx and
+// ExportActivityAdmissionsCtx from filter, see applyAdmissionSearchOptionsCtx for the errors returned.
+func (c *Client) activityAdmissionSearchQueryCtx(ctx context.Context, filter *ActivityAdmissionSearchFilter) (q *admissionSearchQuery, err error) {
+	q = newAdmissionSearchQuery(activityAdmissionSearchTable)
+	q.where("instansi_id = %s", filter.WorkAgencyId)
+	if filter.AdmissionStatus > 0 {
+		q.where("status = %s", filter.AdmissionStatus)
+	}
+	if filter.AdmissionType > 0 {
+		q.where("jenis = %s", filter.AdmissionType)
+	}
+	if filter.AdmissionDate != "" {
+		q.where("tgl_usulan::date = %s", string(filter.AdmissionDate))
+	}
+	if filter.PositionIds != nil {
+		q.where("jabatan_jenjang = any(%s)", pq.Array(filter.PositionIds))
+	}
+
+	err = c.applyAdmissionSearchOptionsCtx(ctx, q, &filter.AdmissionSearchOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
 // SearchActivityAdmissionsPaginatedCtx searches for the list of activity admissions of a particular
 // work agency ID (instansi kerja).
 // It will return empty slice if no admissions are found.
 func (c *Client) SearchActivityAdmissionsPaginatedCtx(ctx context.Context, filter *ActivityAdmissionSearchFilter) (result *search.PaginatedList, err error) {
 	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
 
-	admissionRows, err := mdb.QueryContext(
-		ctx,
-		"select kegiatan_id, nama, status, jenis, deskripsi, tgl_usulan, tgl_mulai, tgl_selesai, jabatan_jenjang, instansi_id, data_tambahan, tahun_diklat, durasi, coalesce(instansi_penyelenggara, ''), no_usulan from kegiatan where instansi_id = $1 and ($2 <= 0 or status = $2) and ($3 <= 0 or jenis = $3) and ($4::date is null or tgl_usulan::date = $4) order by tgl_usulan desc limit $5 offset $6",
-		filter.WorkAgencyId,
-		filter.AdmissionStatus,
-		filter.AdmissionType,
-		sql.NullString{Valid: string(filter.AdmissionDate) != "", String: string(filter.AdmissionDate)},
-		filter.CountPerPage+1,
-		(filter.PageNumber-1)*filter.CountPerPage,
-	)
+	q, err := c.activityAdmissionSearchQueryCtx(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := q.paginatedQuery("kegiatan_id, nama, status, jenis, deskripsi, tgl_usulan, tgl_mulai, tgl_selesai, jabatan_jenjang, instansi_id, data_tambahan, tahun_diklat, durasi, coalesce(instansi_penyelenggara, ''), no_usulan", &filter.AdmissionSearchOptions, filter.PageNumber, filter.CountPerPage)
+	if err != nil {
+		return nil, err
+	}
+
+	admissionRows, err := mdb.QueryContext(ctx, query, q.args...)
 	if err != nil {
 		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
@@ -676,7 +678,7 @@ func (c *Client) SearchActivityAdmissionsPaginatedCtx(ctx context.Context, filte
 	admissions := make([]*models.ActivityAdmission, 0)
 	for admissionRows.Next() {
 		admission := &models.ActivityAdmission{}
-		err = admissionRows.Scan(
+		err = q.scan(admissionRows,
 			&admission.ActivityId,
 			&admission.Name,
 			&admission.Status,
@@ -710,16 +712,123 @@ func (c *Client) SearchActivityAdmissionsPaginatedCtx(ctx context.Context, filte
 
 	return &search.PaginatedList{
 		Data:     admissions,
-		Metadata: search.CreatePaginatedListMetadataNoTotalNext(filter.PageNumber, len(admissions), hasNext),
+		Metadata: q.metadata(filter.PageNumber, len(admissions), hasNext),
 	}, nil
 }
 
+// ExportActivityAdmissionsCtx writes every activity admission matching filter into table, with a header row. Unlike
+// SearchActivityAdmissionsPaginatedCtx, the admissions are not paged, filter.PageNumber and filter.CountPerPage are
+// ignored. The agency and functional position names are resolved in batches, so the admissions are never kept in
+// memory at once. Nothing is written into table if the search fails.
+func (c *Client) ExportActivityAdmissionsCtx(ctx context.Context, filter *ActivityAdmissionSearchFilter, table export.Writer) (err error) {
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+	referenceMdb := metricutil.NewDB(c.ReferenceDb, c.SqlMetrics)
+
+	q, err := c.activityAdmissionSearchQueryCtx(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	admissionRows, err := mdb.QueryContext(
+		ctx,
+		q.query("nama, status, jenis, tgl_usulan, tgl_mulai, tgl_selesai, jabatan_jenjang, instansi_id, tahun_diklat, durasi, coalesce(instansi_penyelenggara, ''), no_usulan"),
+		q.args...,
+	)
+	if err != nil {
+		return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+	defer admissionRows.Close()
+
+	err = table.WriteRow([]string{"No. Usulan", "Nama Kegiatan", "Jenis Kegiatan", "Status", "Waktu Usulan", "Tanggal Mulai", "Tanggal Selesai", "Jabatan Fungsional", "Instansi", "Tahun Diklat", "Durasi (Jam)", "Instansi Penyelenggara"})
+	if err != nil {
+		return err
+	}
+
+	admissions := make([]*models.ActivityAdmission, 0, exportBatchSize)
+	writeAdmissions := func() (err error) {
+		if len(admissions) == 0 {
+			return nil
+		}
+
+		positionIds := make([]string, 0, len(admissions))
+		agencyIds := make([]string, 0, len(admissions))
+		for _, admission := range admissions {
+			positionIds = append(positionIds, admission.PositionGrade)
+			agencyIds = append(agencyIds, admission.AgencyId)
+		}
+
+		positions, err := c.getFunctionalPositionNames(ctx, referenceMdb, positionIds)
+		if err != nil {
+			return err
+		}
+		agencies, err := c.getAgencyNames(ctx, referenceMdb, agencyIds)
+		if err != nil {
+			return err
+		}
+
+		for _, admission := range admissions {
+			err = table.WriteRow([]string{
+				admission.AdmissionNumber,
+				admission.Name,
+				exportName(models.ActivityTypes, admission.Type),
+				exportName(models.ActivityAdmissionStatusNames, admission.Status),
+				exportEpochTime(admission.AdmissionTimestamp),
+				string(admission.StartDate),
+				string(admission.EndDate),
+				positions[admission.PositionGrade],
+				agencies[admission.AgencyId],
+				strconv.Itoa(admission.TrainingYear),
+				strconv.Itoa(admission.Duration),
+				admission.OrganizerAgency,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		admissions = admissions[:0]
+		return nil
+	}
+
+	for admissionRows.Next() {
+		admission := &models.ActivityAdmission{}
+		err = admissionRows.Scan(
+			&admission.Name,
+			&admission.Status,
+			&admission.Type,
+			&admission.AdmissionTimestamp,
+			&admission.StartDate,
+			&admission.EndDate,
+			&admission.PositionGrade,
+			&admission.AgencyId,
+			&admission.TrainingYear,
+			&admission.Duration,
+			&admission.OrganizerAgency,
+			&admission.AdmissionNumber,
+		)
+		if err != nil {
+			return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+		}
+
+		admissions = append(admissions, admission)
+		if len(admissions) == exportBatchSize {
+			err = writeAdmissions()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err = admissionRows.Err(); err != nil {
+		return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+
+	return writeAdmissions()
+}
+
 // GetActivityAdmissionDetailCtx composes the details af an activity admission which includes the information of the
 // activity itself, the list of attendees, and the supporting documents.
-// If supplied, agencyId will be compared to the activity admission's agencyId.
-// If the agencyId is an empty string, it's assumed that the user is a 'pembina' and can see any activity admission
-// detail.
-func (c *Client) GetActivityAdmissionDetailCtx(ctx context.Context, activityAdmissionId string, agencyId string) (admission *models.ActivityAdmission, err error) {
+// The activity admission must be in the scope, otherwise errnum.ErrEntryNotFound is returned.
+func (c *Client) GetActivityAdmissionDetailCtx(ctx context.Context, activityAdmissionId string, scope *AgencyScope) (admission *models.ActivityAdmission, err error) {
 	mtx, err := c.createMtxDb(ctx, c.Db)
 	if err != nil {
 		return nil, ec.NewError(ErrCodeTxStart, Errs[ErrCodeTxStart], err)
@@ -759,9 +868,9 @@ func (c *Client) GetActivityAdmissionDetailCtx(ctx context.Context, activityAdmi
 		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
 
-	if agencyId != "" && agencyId != admission.AgencyId {
-		// The user is not a 'pembina' and the agencyId doesn't match
-		return nil, ec.NewErrorBasic(ErrCodeActivityAdmissionDetailForbidden, Errs[ErrCodeActivityAdmissionDetailForbidden])
+	err = scope.Check(admission.AgencyId, admission.PositionGrade)
+	if err != nil {
+		return nil, err
 	}
 
 	// We'll query about the attendees acceptance
@@ -860,8 +969,8 @@ func (c *Client) GetActivityAdmissionDetailCtx(ctx context.Context, activityAdmi
 }
 
 // VerifyActivityRecommendationLetterCtx verifies that an upload request is valid.
-// Upload request is not valid if requirement status is >= models.ActivityAdmissionStatusAccepted.
-func (c *Client) VerifyActivityRecommendationLetterCtx(ctx context.Context, activityId, agencyId string) (err error) {
+// Upload request is not valid if the activity can no longer be verified.
+func (c *Client) VerifyActivityRecommendationLetterCtx(ctx context.Context, scope *AgencyScope, activityId string) (err error) {
 	parsedActivityId, err := uuid.Parse(activityId)
 	if err != nil {
 		return ec.NewError(ErrCodeUuidInvalid, Errs[ErrCodeUuidInvalid], err)
@@ -876,7 +985,7 @@ func (c *Client) VerifyActivityRecommendationLetterCtx(ctx context.Context, acti
 		c.completeMtx(mtx, err)
 	}()
 
-	err = mtx.QueryRowContext(ctx, "select kegiatan_id from kegiatan where kegiatan_id = $1 and instansi_id = $2", parsedActivityId, agencyId).Scan(&parsedActivityId)
+	err = mtx.QueryRowContext(ctx, "select kegiatan_id from kegiatan where kegiatan_id = $1 and ($2::text[] is null or instansi_id = any($2) or jabatan_jenjang = any($3))", parsedActivityId, scope.sqlArg(), scope.sqlPositionArg()).Scan(&parsedActivityId)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return ErrEntryNotFound
@@ -886,7 +995,7 @@ func (c *Client) VerifyActivityRecommendationLetterCtx(ctx context.Context, acti
 	}
 
 	currentStatus := 0
-	err = mtx.QueryRowContext(ctx, "select status from kegiatan where kegiatan_id = $1 and instansi_id = $2 for update", parsedActivityId, agencyId).Scan(&currentStatus)
+	err = mtx.QueryRowContext(ctx, "select status from kegiatan where kegiatan_id = $1 and ($2::text[] is null or instansi_id = any($2) or jabatan_jenjang = any($3)) for update", parsedActivityId, scope.sqlArg(), scope.sqlPositionArg()).Scan(&currentStatus)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return ErrEntryNotFound
@@ -895,8 +1004,9 @@ func (c *Client) VerifyActivityRecommendationLetterCtx(ctx context.Context, acti
 		return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
 
-	if currentStatus >= models.ActivityAdmissionStatusAccepted {
-		return ec.NewErrorBasic(ErrCodeActivityVerificationStatusAlreadyAccepted, Errs[ErrCodeActivityVerificationStatusAlreadyAccepted])
+	_, err = activityWorkflow.Can(currentStatus, WorkflowActionVerify)
+	if err != nil {
+		return workflowError(err)
 	}
 
 	return
@@ -905,13 +1015,22 @@ func (c *Client) VerifyActivityRecommendationLetterCtx(ctx context.Context, acti
 // Deprecated: no longer needed.
 // SubmitActivityRecommendationLetterCtx inserts a new admission request for activity recommendation letter.
 // It also moves filename defined admission.RecommendationLetter from temporary storage to permanent storage in object
-// storage.
-func (c *Client) SubmitActivityRecommendationLetterCtx(ctx context.Context, admission *models.ActivityRecommendationLetterAdmission) (err error) {
+// storage. The activity must be in the agency scope.
+func (c *Client) SubmitActivityRecommendationLetterCtx(ctx context.Context, scope *AgencyScope, admission *models.ActivityRecommendationLetterAdmission) (err error) {
 	activityIdBytes, err := uuid.Parse(admission.ActivityId)
 	if err != nil {
 		return ErrUuidInvalid
 	}
 
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+	err = mdb.QueryRowContext(ctx, "select kegiatan_id from kegiatan where kegiatan_id = $1 and ($2::text[] is null or instansi_id = any($2) or jabatan_jenjang = any($3))", activityIdBytes, scope.sqlArg(), scope.sqlPositionArg()).Scan(&activityIdBytes)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrEntryNotFound
+		}
+		return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+
 	filepath := path.Join(ActivityRecommendationLetterSubdir, fmt.Sprintf("%s.pdf", admission.ActivityId))
 	_, err = c.ActivityStorage.SaveActivityFiles(ctx, []string{filepath})
 	if err != nil {
@@ -921,7 +1040,6 @@ func (c *Client) SubmitActivityRecommendationLetterCtx(ctx context.Context, admi
 		return ec.NewError(ErrCodeStorageCopyFail, Errs[ErrCodeStorageCopyFail], fmt.Errorf("cannot save recommendation letter: %w", err))
 	}
 
-	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
 	_, err = mdb.ExecContext(
 		ctx,
 		"insert into surat_rekomendasi_kegiatan(kegiatan_id, nosurat, tgl_surat, ttd_user_id, nama_doc) values ($1,$2,$3,$4,$5)",
@@ -938,20 +1056,31 @@ func (c *Client) SubmitActivityRecommendationLetterCtx(ctx context.Context, admi
 	return nil
 }
 
-// GenerateActivityCertificateCtx generates a certificate and store it in the storage.
+// GenerateActivityCertificateCtx returns the base filename of a certificate if it has been generated, or queues a job
+// that generates it and store it in the storage, requested by asnId, see runActivityCertificateJobCtx.
 // Filename is generated from activityId and attendeeAsnId concatenated together. The base filename is returned,
 // it can be accessed in the certificate subdir in permanent bucket.
 //
 // To help reduce performance load, it is only generated once, unless forceRegenerate is set to true.
-func (c *Client) GenerateActivityCertificateCtx(ctx context.Context, activityId, attendeeAsnId string, forceRegenerate bool) (filename string, err error) {
+// The activity must be in the agency scope.
+func (c *Client) GenerateActivityCertificateCtx(ctx context.Context, scope *AgencyScope, activityId, attendeeAsnId string, forceRegenerate bool, asnId string) (filename string, job *models.Job, err error) {
 	filename = fmt.Sprintf("%s-%s.pdf", activityId, attendeeAsnId)
 	fullPath := path.Join(ActivityCertSubdir, filename)
 
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+	err = mdb.QueryRowContext(ctx, "select kegiatan_id from kegiatan where kegiatan_id = $1 and ($2::text[] is null or instansi_id = any($2) or jabatan_jenjang = any($3))", activityId, scope.sqlArg(), scope.sqlPositionArg()).Scan(&activityId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil, ErrEntryNotFound
+		}
+		return "", nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+
 	if !forceRegenerate {
 		fileFound := true
 		meta, err := c.ActivityStorage.GetActivityFileMetadata(ctx, fullPath)
 		if err != nil && !errors.Is(err, object.ErrFileNotFound) {
-			return "", ec.NewError(ErrCodeStorageGetMetadataFail, Errs[ErrCodeStorageGetMetadataFail], err)
+			return "", nil, ec.NewError(ErrCodeStorageGetMetadataFail, Errs[ErrCodeStorageGetMetadataFail], err)
 		}
 
 		if errors.Is(err, object.ErrFileNotFound) {
@@ -963,10 +1092,46 @@ func (c *Client) GenerateActivityCertificateCtx(ctx context.Context, activityId,
 		}
 
 		if fileFound {
-			return filename, nil
+			return filename, nil, nil
 		}
 	}
 
+	certificateCount := 0
+	err = mdb.QueryRowContext(ctx, "select count(*) from sertifikat where persertakegiatan_kegiatan_id = $1 and persertakegiatan_user_id = $2", activityId, attendeeAsnId).Scan(&certificateCount)
+	if err != nil {
+		return "", nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+	if certificateCount == 0 {
+		return "", nil, ErrEntryNotFound
+	}
+
+	job, err = c.enqueueJobCtx(ctx, JobKindActivityCertificate, StatusHistoryModuleActivity, activityId, &activityCertificateJobPayload{AttendeeAsnId: attendeeAsnId}, asnId, nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return "", job, nil
+}
+
+// activityCertificateJobPayload is the payload of an activity certificate job.
+type activityCertificateJobPayload struct {
+	AttendeeAsnId string `json:"peserta_user_id"`
+}
+
+// runActivityCertificateJobCtx generates the certificate of an activity attendee queued by
+// GenerateActivityCertificateCtx and store it in the storage, replacing the existing one.
+func (c *Client) runActivityCertificateJobCtx(ctx context.Context, job *queuedJob) (filename string, err error) {
+	payload := &activityCertificateJobPayload{}
+	err = json.Unmarshal(job.Payload, payload)
+	if err != nil {
+		return "", ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("cannot unmarshal job payload: %w", err))
+	}
+
+	activityId := job.EntityId
+	attendeeAsnId := payload.AttendeeAsnId
+	filename = fmt.Sprintf("%s-%s.pdf", activityId, attendeeAsnId)
+	fullPath := path.Join(ActivityCertSubdir, filename)
+
 	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
 	referenceMtx, err := c.createMtxDb(ctx, c.ReferenceDb)
 	if err != nil {
@@ -1048,7 +1213,7 @@ func (c *Client) GenerateActivityCertificateCtx(ctx context.Context, activityId,
 
 	err = c.generateActivityCertificateCtx(ctx, fullPath, data)
 	if err != nil {
-		if errors.Is(err, docx.ErrSiasnRendererBadTemplate) {
+		if errors.Is(err, docx.ErrBadTemplate) {
 			return "", ec.NewError(ErrCodeDocumentGenerateBadTemplate, Errs[ErrCodeDocumentGenerateBadTemplate], err)
 		}
 		return "", ec.NewError(ErrCodeDocumentGenerate, Errs[ErrCodeDocumentGenerate], err)
@@ -1057,38 +1222,28 @@ func (c *Client) GenerateActivityCertificateCtx(ctx context.Context, activityId,
 	return filename, nil
 }
 
-// GetActivityStatusStatisticCtx returns the number of activity items for each status.
-func (c *Client) GetActivityStatusStatisticCtx(ctx context.Context) (statistics []*models.StatisticStatus, err error) {
-	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
-	rows, err := mdb.QueryContext(ctx, "select status, jumlah from kegiatan_status_statistik")
+// activityStatisticSource is the source of the activity status statistics.
+var activityStatisticSource = &statisticSource{
+	table:          "kegiatan",
+	statuses:       models.ActivityAdmissionStatuses,
+	dateColumn:     "tgl_usulan",
+	agencyColumn:   "instansi_id",
+	positionColumn: "jabatan_jenjang",
+}
+
+// GetActivityStatusStatisticCtx returns the number of activity items for each status, limited to scope and filter.
+// filter.GroupBy is ignored.
+func (c *Client) GetActivityStatusStatisticCtx(ctx context.Context, scope *AgencyScope, filter *StatisticFilter) (statistics []*models.StatisticStatus, err error) {
+	periods, err := c.getStatusStatisticCtx(ctx, activityStatisticSource, scope, filter, false)
 	if err != nil {
-		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+		return nil, err
 	}
-	defer rows.Close()
 
-	statistics = make([]*models.StatisticStatus, 0)
-	statisticMap := make(map[int]*models.StatisticStatus)
-	for status := range models.ActivityAdmissionStatuses {
-		statusStatistic := &models.StatisticStatus{
-			Status: status,
-		}
-		statistics = append(statistics, statusStatistic)
-		statisticMap[status] = statusStatistic
-	}
-	for rows.Next() {
-		var temp models.StatisticStatus
-		err = rows.Scan(&temp.Status, &temp.Count)
-		if err != nil {
-			return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
-		}
-		statusStatistic, ok := statisticMap[temp.Status]
-		if ok {
-			statusStatistic.Count = temp.Count
-		}
-	}
-	if err = rows.Err(); err != nil {
-		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
-	}
+	return periods[0].Statuses, nil
+}
 
-	return statistics, nil
+// GetActivityStatusStatisticSeriesCtx returns the number of activity items for each status in each period of
+// filter.GroupBy, limited to scope and filter.
+func (c *Client) GetActivityStatusStatisticSeriesCtx(ctx context.Context, scope *AgencyScope, filter *StatisticFilter) (periods []*models.StatisticPeriod, err error) {
+	return c.getStatusStatisticCtx(ctx, activityStatisticSource, scope, filter, true)
 }
@@ -38,6 +38,9 @@ const (
 	TimeoutActivityRecommendationLetterDownload = TimeoutDefault
 	TimeoutActivityRecommendationLetterSubmit   = TimeoutDefault
 	TimeoutGetActivityStatusStatistic           = TimeoutDefault
+	TimeoutGetActivityStatusStatisticSeries     = TimeoutDefault
+	TimeoutActivityHistoryGet                   = TimeoutDefault
+	TimeoutActivityActionsGet                   = TimeoutDefault
 )
 
 type SchemaActivityId struct {
@@ -58,6 +61,7 @@ func (c *Client) HandleActivityAdmissionSubmit(writer http.ResponseWriter, reque
 
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutActivityAdmissionSubmit)
 	defer cancel()
+	ctx = c.withRequestMetadata(ctx, request)
 
 	ar.SubmitterAsnId = user.AsnId
 	ar.AgencyId = user.WorkAgencyId
@@ -69,6 +73,8 @@ func (c *Client) HandleActivityAdmissionSubmit(writer http.ResponseWriter, reque
 		return
 	}
 
+	c.notifyStatusChange(request, StatusHistoryModuleActivity, activityId, models.ActivityAdmissionStatusCreated, "")
+
 	_ = httputil.WriteObj200(writer, map[string]string{
 		"kegiatan_id": activityId,
 	})
@@ -187,7 +193,7 @@ func (c *Client) HandleActivityAdmissionSupportDocDownload(writer http.ResponseW
 // Agency ID is needed, retrieved from authentication token.
 func (c *Client) HandleActivityAdmissionAsnGet(writer http.ResponseWriter, request *http.Request) {
 	type schemaNip struct {
-		Nip string `schema:"nip"`
+		Nip string `schema:"nip" validate:"required,nip"`
 	}
 
 	user := auth.AssertReqGetUserDetail(request)
@@ -227,11 +233,18 @@ func (c *Client) HandleActivityStatusCsrSubmit(writer http.ResponseWriter, reque
 
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutActivityStatusCsrSet)
 	defer cancel()
+	ctx = c.withRequestMetadata(ctx, request)
 
 	s.SubmitterAsnId = user.AsnId
 	s.AgencyId = user.WorkAgencyId
 
-	modifiedAt, err := c.SetActivityStatusCsrCtx(ctx, s)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	modifiedAt, err := c.SetActivityStatusCsrCtx(ctx, scope, s)
 	if err != nil {
 		c.httpError(writer, err)
 		return
@@ -255,16 +268,25 @@ func (c *Client) HandleActivityVerificationSet(writer http.ResponseWriter, reque
 
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutActivityAdmissionVerification)
 	defer cancel()
+	ctx = c.withRequestMetadata(ctx, request)
 
 	av.SubmitterAsnId = user.AsnId
 	av.AgencyId = user.WorkAgencyId
 
-	modifiedAt, err := c.SetActivityStatusAcceptedCtx(ctx, av)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	modifiedAt, err := c.SetActivityStatusAcceptedCtx(ctx, scope, av)
 	if err != nil {
 		c.httpError(writer, err)
 		return
 	}
 
+	c.notifyStatusChange(request, StatusHistoryModuleActivity, av.ActivityId, models.ActivityAdmissionStatusAccepted, "")
+
 	_ = httputil.WriteObj200(writer, map[string]interface{}{
 		"kegiatan_id": av.ActivityId,
 		"modified_at": modifiedAt.Unix(),
@@ -287,7 +309,13 @@ func (c *Client) HandleActivityCertGenDocUpload(writer http.ResponseWriter, requ
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutActivityCertGenDocUpload)
 	defer cancel()
 
-	filename, err := c.VerifyActivityCertCtx(ctx, ur)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	filename, err := c.VerifyActivityCertCtx(ctx, scope, ur)
 	if err != nil {
 		c.httpError(writer, err)
 		return
@@ -341,7 +369,9 @@ func (c *Client) HandleActivityCertGenDocPreview(writer http.ResponseWriter, req
 
 // HandleActivityCertGenDocDownload handles a request to download a certificate from permanent location.
 // Requires `kegiatan_id`, `peserta_user_id`, and `jenis` query parameters. They are used to determine the filename.
-// This handler redirects the request. It returns 302 to a signed URL to download the document.
+// This handler redirects the request. It returns 302 to a signed URL to download the document if it has been
+// generated, otherwise it queues a job that generates the document and returns 202 with the job, which can be polled
+// until the document can be downloaded.
 func (c *Client) HandleActivityCertGenDocDownload(writer http.ResponseWriter, request *http.Request) {
 	s := &models.ActivityCertGenDownloadRequest{}
 	err := c.decodeRequestSchema(writer, request, s)
@@ -358,12 +388,24 @@ func (c *Client) HandleActivityCertGenDocDownload(writer http.ResponseWriter, re
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutActivityCertGenDocDownload)
 	defer cancel()
 
-	basename, err := c.GenerateActivityCertificateCtx(ctx, s.ActivityId, s.AttendeeAsnId, s.ForceRegenerate)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
 	if err != nil {
 		c.httpError(writer, err)
 		return
 	}
 
+	user := auth.AssertReqGetUserDetail(request)
+	basename, job, err := c.GenerateActivityCertificateCtx(ctx, scope, s.ActivityId, s.AttendeeAsnId, s.ForceRegenerate, user.AsnId)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	if job != nil {
+		_ = httputil.WriteObj(writer, job, http.StatusAccepted)
+		return
+	}
+
 	url, err := c.ActivityStorage.GenerateActivityDocGetSign(ctx, path.Join(ActivityCertSubdir, basename))
 	if err != nil {
 		c.httpError(writer, ec.NewError(ErrCodeStorageSignFail, Errs[ErrCodeStorageSignFail], err))
@@ -406,6 +448,7 @@ func (c *Client) HandleActivityCertGenSubmit(writer http.ResponseWriter, request
 
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutActivityAdmissionSubmit)
 	defer cancel()
+	ctx = c.withRequestMetadata(ctx, request)
 
 	// mtx, err := c.createMtxDb(ctx, c.Db)
 	// if err != nil {
@@ -420,12 +463,20 @@ func (c *Client) HandleActivityCertGenSubmit(writer http.ResponseWriter, request
 	// 	log.Fatal(err)
 	// }
 
-	modifiedAt, err := c.InsertActivityCertCtx(ctx, acg)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
 	if err != nil {
 		c.httpError(writer, err)
 		return
 	}
 
+	modifiedAt, err := c.InsertActivityCertCtx(ctx, scope, acg)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	c.notifyStatusChange(request, StatusHistoryModuleActivity, acg.ActivityId, models.ActivityAdmissionStatusCertPublished, "")
+
 	_ = httputil.WriteObj200(writer, map[string]interface{}{
 		"kegiatan_id": acg.ActivityId,
 		// "penandatangan": result,
@@ -500,11 +551,10 @@ func (c *Client) HandleActivityAdmissionSearchPaginated(writer http.ResponseWrit
 
 	type schemaAdmissionSearch struct {
 		// AdmissionDate is a date with a format of YYYY-MM-DD (e.g. 2006-12-31)
-		AdmissionDate   string `schema:"tgl_usulan"`
-		AdmissionStatus int    `schema:"status"`
-		AdmissionType   int    `schema:"jenis_kegiatan"`
-		PageNumber      int    `schema:"halaman"`
-		CountPerPage    int    `schema:"jumlah_per_halaman"`
+		AdmissionDate string `schema:"tgl_usulan"`
+		AdmissionType int    `schema:"jenis_kegiatan"`
+		PageNumber    int    `schema:"halaman"`
+		CountPerPage  int    `schema:"jumlah_per_halaman"`
 	}
 
 	query := &schemaAdmissionSearch{}
@@ -528,8 +578,8 @@ func (c *Client) HandleActivityAdmissionSearchPaginated(writer http.ResponseWrit
 		return
 	}
 
-	if _, ok := models.ActivityAdmissionStatuses[query.AdmissionStatus]; query.AdmissionStatus != 0 && !ok {
-		c.httpError(writer, ec.NewErrorBasic(ErrCodeFilterStatusInvalid, Errs[ErrCodeFilterStatusInvalid]))
+	options, err := c.decodeAdmissionSearchOptions(writer, request, models.ActivityAdmissionStatuses, ErrCodeFilterStatusInvalid, ErrCodeFilterInvalidDate)
+	if err != nil {
 		return
 	}
 
@@ -548,12 +598,12 @@ func (c *Client) HandleActivityAdmissionSearchPaginated(writer http.ResponseWrit
 	}
 
 	searchFilter := &ActivityAdmissionSearchFilter{
-		WorkAgencyId:    user.WorkAgencyId,
-		AdmissionDate:   admissionDate,
-		AdmissionStatus: query.AdmissionStatus,
-		AdmissionType:   query.AdmissionType,
-		CountPerPage:    countPerPage,
-		PageNumber:      pageNumber,
+		WorkAgencyId:           user.WorkAgencyId,
+		AdmissionDate:          admissionDate,
+		AdmissionType:          query.AdmissionType,
+		AdmissionSearchOptions: *options,
+		CountPerPage:           countPerPage,
+		PageNumber:             pageNumber,
 	}
 
 	admissions, err := c.SearchActivityAdmissionsPaginatedCtx(ctx, searchFilter)
@@ -565,10 +615,66 @@ func (c *Client) HandleActivityAdmissionSearchPaginated(writer http.ResponseWrit
 	_ = httputil.WriteObj200(writer, (*models.IdPaginatedList)(admissions))
 }
 
+// HandleActivityAdmissionExport handles a request to export every admission of a work agency matching the search
+// filters as an xlsx or csv file. Agency ID will be retrieved from authentication token.
+func (c *Client) HandleActivityAdmissionExport(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutExport)
+	defer cancel()
+
+	user := auth.AssertReqGetUserDetail(request)
+
+	type schemaAdmissionExport struct {
+		// AdmissionDate is a date with a format of YYYY-MM-DD (e.g. 2006-12-31)
+		AdmissionDate string `schema:"tgl_usulan"`
+		AdmissionType int    `schema:"jenis_kegiatan"`
+		// Format is either xlsx (default) or csv.
+		Format string `schema:"format"`
+	}
+
+	query := &schemaAdmissionExport{}
+	err := c.decodeRequestSchema(writer, request, query)
+	if err != nil {
+		return
+	}
+
+	options, err := c.decodeAdmissionSearchOptions(writer, request, models.ActivityAdmissionStatuses, ErrCodeFilterStatusInvalid, ErrCodeFilterInvalidDate)
+	if err != nil {
+		return
+	}
+
+	if _, ok := models.ActivityTypes[query.AdmissionType]; query.AdmissionType != 0 && !ok {
+		c.httpError(writer, ec.NewErrorBasic(ErrCodeFilterInvalidType, Errs[ErrCodeFilterInvalidType]))
+		return
+	}
+
+	var admissionDate models.Iso8601Date
+	if query.AdmissionDate != "" {
+		admissionDate, err = models.ParseIso8601Date(query.AdmissionDate)
+		if err != nil {
+			c.httpError(writer, ec.NewError(ErrCodeFilterInvalidDate, Errs[ErrCodeFilterInvalidDate], err))
+			return
+		}
+	}
+
+	table, err := c.newHttpExport(writer, query.Format, "usulan-kegiatan")
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	err = c.ExportActivityAdmissionsCtx(ctx, &ActivityAdmissionSearchFilter{
+		WorkAgencyId:           user.WorkAgencyId,
+		AdmissionDate:          admissionDate,
+		AdmissionType:          query.AdmissionType,
+		AdmissionSearchOptions: *options,
+	}, table)
+	c.finishHttpExport(writer, table, err)
+}
+
 // HandleActivityAdmissionSearchPembina handles a request to get admission list of a work agency.
-// This handler will only process request from 'pembina'.
+// This handler will only process request from 'pembina', the route must require models.RolePembina. Unless the agency
+// is the pembina's own, only the admissions of the functional positions supervised by the pembina are returned.
 func (c *Client) HandleActivityAdmissionSearchPembina(writer http.ResponseWriter, request *http.Request) {
-	// TODO: pembina can see multiple agencies?
 	type schemaAdmissionSearch struct {
 		AgencyId string `schema:"instansi_id"`
 		// AdmissionDate is a date with a format of YYYY-MM-DD (e.g. 2006-12-31)
@@ -577,8 +683,6 @@ func (c *Client) HandleActivityAdmissionSearchPembina(writer http.ResponseWriter
 		AdmissionType   int    `schema:"jenis_kegiatan"`
 	}
 
-	// TODO: Check if the user is a 'pembina'
-
 	query := &schemaAdmissionSearch{}
 	err := c.decodeRequestSchema(writer, request, query)
 	if err != nil {
@@ -593,6 +697,12 @@ func (c *Client) HandleActivityAdmissionSearchPembina(writer http.ResponseWriter
 		return
 	}
 
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
 	if _, ok := models.ActivityAdmissionStatuses[query.AdmissionStatus]; query.AdmissionStatus != 0 && !ok {
 		c.httpError(writer, ec.NewErrorBasic(ErrCodeFilterStatusInvalid, Errs[ErrCodeFilterStatusInvalid]))
 		return
@@ -618,6 +728,9 @@ func (c *Client) HandleActivityAdmissionSearchPembina(writer http.ResponseWriter
 		AdmissionStatus: query.AdmissionStatus,
 		AdmissionType:   query.AdmissionType,
 	}
+	if !scope.Contains(query.AgencyId) {
+		searchFilter.PositionIds = scope.PositionIds
+	}
 
 	admissions, err := c.SearchActivityAdmissionsCtx(ctx, searchFilter)
 	if err != nil {
@@ -629,7 +742,7 @@ func (c *Client) HandleActivityAdmissionSearchPembina(writer http.ResponseWriter
 }
 
 // HandleActivityAdmissionDetail handles a request to get an activity admission's detail.
-// Agency ID will be retrieved from authentication token. If it's a 'pembina' the they can also specify
+// The activity admission must be in the agency scope of the user, pembina can see the agencies they supervise.
 func (c *Client) HandleActivityAdmissionDetail(writer http.ResponseWriter, request *http.Request) {
 	type schemaAdmissionDetail struct {
 		ActivityId string `schema:"kegiatan_id"`
@@ -644,9 +757,13 @@ func (c *Client) HandleActivityAdmissionDetail(writer http.ResponseWriter, reque
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutActivityAdmissionDetail)
 	defer cancel()
 
-	// TODO: retrieve agency ID from auth token. If the user is pembina, pass empty string to the agencyId
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
 
-	activityAdmissionDetail, err := c.GetActivityAdmissionDetailCtx(ctx, query.ActivityId, "") // TODO: Change this
+	activityAdmissionDetail, err := c.GetActivityAdmissionDetailCtx(ctx, query.ActivityId, scope)
 	if err != nil {
 		c.httpError(writer, err)
 		return
@@ -671,12 +788,16 @@ func (c *Client) HandleActivityRecommendationLetterUpload(writer http.ResponseWr
 		return
 	}
 
-	user := auth.AssertReqGetUserDetail(request)
-
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutActivityRecommendationLetterUpload)
 	defer cancel()
 
-	err = c.VerifyActivityRecommendationLetterCtx(ctx, s.ActivityId, user.WorkAgencyId)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	err = c.VerifyActivityRecommendationLetterCtx(ctx, scope, s.ActivityId)
 	if err != nil {
 		c.httpError(writer, err)
 		return
@@ -779,7 +900,13 @@ func (c *Client) HandleActivityRecommendationLetterSubmit(writer http.ResponseWr
 	admission.SubmitterAsnId = user.AsnId
 	admission.AgencyId = user.WorkAgencyId
 
-	err = c.SubmitActivityRecommendationLetterCtx(ctx, admission)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	err = c.SubmitActivityRecommendationLetterCtx(ctx, scope, admission)
 	if err != nil {
 		c.httpError(writer, err)
 		return
@@ -790,12 +917,24 @@ func (c *Client) HandleActivityRecommendationLetterSubmit(writer http.ResponseWr
 	})
 }
 
-// HandleGetActivityStatusStatistic returns the number of activity items for each status.
-func (c *Client) HandleGetActivityStatusStatistic(writer http.ResponseWriter, _ *http.Request) {
+// HandleGetActivityStatusStatistic returns the number of activity items for each status, within the agency scope of the
+// user. The statistic can be filtered by agency, functional position and admission date range.
+func (c *Client) HandleGetActivityStatusStatistic(writer http.ResponseWriter, request *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutGetActivityStatusStatistic)
 	defer cancel()
 
-	statistic, err := c.GetActivityStatusStatisticCtx(ctx)
+	filter, err := c.decodeStatisticFilter(writer, request)
+	if err != nil {
+		return
+	}
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	statistic, err := c.GetActivityStatusStatisticCtx(ctx, scope, filter)
 	if err != nil {
 		c.httpError(writer, err)
 		return
@@ -803,3 +942,88 @@ func (c *Client) HandleGetActivityStatusStatistic(writer http.ResponseWriter, _
 
 	_ = httputil.WriteObj200(writer, statistic)
 }
+
+// HandleGetActivityStatusStatisticSeries returns the number of activity items for each status in each month, quarter or
+// year, within the agency scope of the user. It accepts the same filters as HandleGetActivityStatusStatistic.
+func (c *Client) HandleGetActivityStatusStatisticSeries(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutGetActivityStatusStatisticSeries)
+	defer cancel()
+
+	filter, err := c.decodeStatisticFilter(writer, request)
+	if err != nil {
+		return
+	}
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	periods, err := c.GetActivityStatusStatisticSeriesCtx(ctx, scope, filter)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, periods)
+}
+
+// HandleActivityHistoryGet handles the request to get the status history of an activity admission, oldest first.
+func (c *Client) HandleActivityHistoryGet(writer http.ResponseWriter, request *http.Request) {
+	type schemaActivityId struct {
+		ActivityId string `schema:"kegiatan_id"`
+	}
+	sh := &schemaActivityId{}
+	err := c.decodeRequestSchema(writer, request, sh)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutActivityHistoryGet)
+	defer cancel()
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	history, err := c.GetStatusHistoryCtx(ctx, StatusHistoryModuleActivity, sh.ActivityId, scope)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, history)
+}
+
+// HandleActivityActionsGet handles the request to get the current status of an activity admission and the
+// actions the user can do next, so that the frontend can show only the allowed actions.
+func (c *Client) HandleActivityActionsGet(writer http.ResponseWriter, request *http.Request) {
+	type schemaActivityId struct {
+		ActivityId string `schema:"kegiatan_id"`
+	}
+	sh := &schemaActivityId{}
+	err := c.decodeRequestSchema(writer, request, sh)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutActivityActionsGet)
+	defer cancel()
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	actions, err := c.GetAdmissionActionsCtx(ctx, StatusHistoryModuleActivity, sh.ActivityId, scope, ReqGetUserRoles(request))
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, actions)
+}
@@ -86,6 +86,11 @@ func (c *Client) InsertAssessmentTeamAdmissionCtx(ctx context.Context, request *
 		return "", ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], err)
 	}
 
+	_, err = c.insertStatusHistoryCtx(ctx, mtx, StatusHistoryModuleAssessmentTeam, admissionId, 0, models.AssessmentTeamStatusCreated, request.SubmitterAsnId, "")
+	if err != nil {
+		return "", err
+	}
+
 	assessorStmt, err := mtx.PrepareContext(ctx, "insert into anggota_tim_penilaian(tim_penilaian_id, asn_id, peran) VALUES($1, $2, $3)")
 	if err != nil {
 		return "", ec.NewError(ErrCodePrepareFail, Errs[ErrCodePrepareFail], fmt.Errorf("cannot prepare statement for anggota_tim_penilaian table: %w", err))
@@ -131,7 +136,8 @@ func (c *Client) InsertAssessmentTeamAdmissionCtx(ctx context.Context, request *
 }
 
 // GetAssessmentTeamCtx retrieves detail about assessment team detail.
-func (c *Client) GetAssessmentTeamCtx(ctx context.Context, assessmentTeamId string) (assessmentTeam *models.AssessmentTeam, err error) {
+// Assessment teams outside of the agency scope are treated as not found.
+func (c *Client) GetAssessmentTeamCtx(ctx context.Context, assessmentTeamId string, scope *AgencyScope) (assessmentTeam *models.AssessmentTeam, err error) {
 	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
 	profileMdb := metricutil.NewDB(c.ProfileDb, c.SqlMetrics)
 	referenceMdb := metricutil.NewDB(c.ReferenceDb, c.SqlMetrics)
@@ -148,8 +154,8 @@ select
 	tgl_usulan,
 	no_usulan,
 	status
-from tim_penilaian where tim_penilaian_id = $1
-`, assessmentTeamId).Scan(
+from tim_penilaian where tim_penilaian_id = $1 and ($2::text[] is null or instansi_id = any($2) or jabatan_fungsional_id = any($3))
+`, assessmentTeamId, scope.sqlArg(), scope.sqlPositionArg()).Scan(
 		&assessmentTeam.AgencyId,
 		&assessmentTeam.FunctionalPositionId,
 		&assessmentTeam.AdmissionDate,
@@ -236,8 +242,8 @@ from tim_penilaian where tim_penilaian_id = $1
 		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
 
-	// Get recommendation letters
-	if assessmentTeam.Status == models.AssessmentTeamStatusVerified {
+	// Get recommendation letters, supplied when the assessment team is verified
+	if hasWorkflowDocument(assessmentTeamWorkflow, assessmentTeam.Status, "temp_surat_rekomendasi") {
 		assessmentTeam.RecommendationLetter = &models.Document{}
 		err = mdb.QueryRowContext(ctx, "select filename, nama_doc, no_surat, tgl_surat, createdat from surat_rekomendasi_tim_penilaian where tim_penilaian_id = $1", assessmentTeamId).Scan(
 			&assessmentTeam.RecommendationLetter.Filename,
@@ -254,22 +260,45 @@ from tim_penilaian where tim_penilaian_id = $1
 	return assessmentTeam, nil
 }
 
+// assessmentTeamAdmissionSearchTable does not have an ASN column, the asn_id of an assessment team is its submitter.
+var assessmentTeamAdmissionSearchTable = &admissionSearchTable{
+	name:           "tim_penilaian",
+	idColumn:       "tim_penilaian_id",
+	dateColumn:     "tgl_usulan",
+	positionColumn: "jabatan_fungsional_id",
+}
+
 // SearchAssessmentTeamsCtx searches for the list of assessment team admissions with a particular filter.
 // It will return empty slice if no admissions are found.
 func (c *Client) SearchAssessmentTeamsCtx(ctx context.Context, filter *AssessmentTeamAdmissionSearchFilter) (result *search.PaginatedList, err error) {
 	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
 	referenceMdb := metricutil.NewDB(c.ReferenceDb, c.SqlMetrics)
 
-	admissionRows, err := mdb.QueryContext(
-		ctx,
-		"select tim_penilaian_id, no_usulan, instansi_id, tgl_usulan, status from tim_penilaian where ($1 = '' or instansi_id = $1) and ($2 <= 0 or status = $2) and ($3 = '' or asn_id = $3) and ($4 = '' or tgl_usulan = $4::date) order by tgl_usulan desc limit $5 offset $6",
-		filter.AgencyId,
-		filter.AdmissionStatus,
-		filter.SubmitterAsnId,
-		filter.AdmissionDate,
-		filter.CountPerPage+1,
-		(filter.PageNumber-1)*filter.CountPerPage,
-	)
+	q := newAdmissionSearchQuery(assessmentTeamAdmissionSearchTable)
+	if filter.AgencyId != "" {
+		q.where("instansi_id = %s", filter.AgencyId)
+	}
+	if filter.AdmissionStatus > 0 {
+		q.where("status = %s", filter.AdmissionStatus)
+	}
+	if filter.SubmitterAsnId != "" {
+		q.where("asn_id = %s", filter.SubmitterAsnId)
+	}
+	if filter.AdmissionDate != "" {
+		q.where("tgl_usulan = %s::date", string(filter.AdmissionDate))
+	}
+
+	err = c.applyAdmissionSearchOptionsCtx(ctx, q, &filter.AdmissionSearchOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := q.paginatedQuery("tim_penilaian_id, no_usulan, instansi_id, tgl_usulan, status", &filter.AdmissionSearchOptions, filter.PageNumber, filter.CountPerPage)
+	if err != nil {
+		return nil, err
+	}
+
+	admissionRows, err := mdb.QueryContext(ctx, query, q.args...)
 	if err != nil {
 		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
@@ -279,7 +308,7 @@ func (c *Client) SearchAssessmentTeamsCtx(ctx context.Context, filter *Assessmen
 	admissions := make([]*models.AssessmentTeamItem, 0)
 	for admissionRows.Next() {
 		admission := &models.AssessmentTeamItem{}
-		err = admissionRows.Scan(
+		err = q.scan(admissionRows,
 			&admission.AssessmentTeamId,
 			&admission.AdmissionNumber,
 			&admission.AgencyId,
@@ -313,13 +342,15 @@ func (c *Client) SearchAssessmentTeamsCtx(ctx context.Context, filter *Assessmen
 
 	return &search.PaginatedList{
 		Data:     admissions,
-		Metadata: search.CreatePaginatedListMetadataNoTotalNext(filter.PageNumber, len(admissions), hasNext),
+		Metadata: q.metadata(filter.PageNumber, len(admissions), hasNext),
 	}, nil
 }
 
 // SetAssessmentTeamVerificationCtx set assessment team status to verified. It also moves filenames defined
 // request.TempRecommendationLetter from temporary storage to permanent storage in object storage.
-func (c *Client) SetAssessmentTeamVerificationCtx(ctx context.Context, request *models.AssessmentTeamVerification) (updatedAt time.Time, err error) {
+// Assessment teams outside of the agency scope are treated as not found. If the assessment team workflow does not
+// allow it, this will return error code errnum.ErrCodeWorkflowTransitionInvalid.
+func (c *Client) SetAssessmentTeamVerificationCtx(ctx context.Context, scope *AgencyScope, request *models.AssessmentTeamVerification) (updatedAt time.Time, err error) {
 	mtx, err := c.createMtxDb(ctx, c.Db)
 	if err != nil {
 		return time.Time{}, err
@@ -330,7 +361,7 @@ func (c *Client) SetAssessmentTeamVerificationCtx(ctx context.Context, request *
 	}()
 
 	currentStatus := 0
-	err = mtx.QueryRowContext(ctx, "select status from tim_penilaian where tim_penilaian_id = $1 for update", request.AssessmentTeamId).Scan(&currentStatus)
+	err = mtx.QueryRowContext(ctx, "select status from tim_penilaian where tim_penilaian_id = $1 and ($2::text[] is null or instansi_id = any($2) or jabatan_fungsional_id = any($3)) for update", request.AssessmentTeamId, scope.sqlArg(), scope.sqlPositionArg()).Scan(&currentStatus)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return time.Time{}, ErrEntryNotFound
@@ -339,8 +370,14 @@ func (c *Client) SetAssessmentTeamVerificationCtx(ctx context.Context, request *
 		return time.Time{}, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
 
-	if currentStatus != models.AssessmentTeamStatusCreated {
-		return time.Time{}, ec.NewError(ErrCodeAssessmentTeamStatusNotCreated, Errs[ErrCodeAssessmentTeamStatusNotCreated], err)
+	documents := make([]string, 0)
+	if request.TempRecommendationLetter != nil {
+		documents = append(documents, "temp_surat_rekomendasi")
+	}
+
+	err = checkTransition(assessmentTeamWorkflow, currentStatus, WorkflowActionVerify, documents, request)
+	if err != nil {
+		return time.Time{}, err
 	}
 
 	err = mtx.QueryRowContext(
@@ -354,6 +391,11 @@ func (c *Client) SetAssessmentTeamVerificationCtx(ctx context.Context, request *
 		return time.Time{}, ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], err)
 	}
 
+	_, err = c.insertStatusHistoryCtx(ctx, mtx, StatusHistoryModuleAssessmentTeam, request.AssessmentTeamId, currentStatus, models.AssessmentTeamStatusVerified, request.SubmitterAsnId, "")
+	if err != nil {
+		return time.Time{}, err
+	}
+
 	assessorStmt, err := mtx.PrepareContext(ctx, "update anggota_tim_penilaian set status = $1, alasan_ditolak = $2 where tim_penilaian_id = $3 and asn_id = $4")
 	if err != nil {
 		return time.Time{}, ec.NewError(ErrCodePrepareFail, Errs[ErrCodePrepareFail], fmt.Errorf("cannot prepare statement for anggota_tim_penilaian table: %w", err))
@@ -25,6 +25,8 @@ const (
 	TimeoutAssessmentTeamVerificationSubmit                    = TimeoutDefault
 	TimeoutAssessmentTeamGet                                   = TimeoutDefault
 	TimeoutAssessmentTeamSearch                                = TimeoutDefault
+	TimeoutAssessmentTeamHistoryGet                            = TimeoutDefault
+	TimeoutAssessmentTeamActionsGet                            = TimeoutDefault
 )
 
 // HandleAssessmentTeamAdmissionSubmit handles a new assessment team admission request. Assessment team admission is
@@ -33,6 +35,7 @@ const (
 func (c *Client) HandleAssessmentTeamAdmissionSubmit(writer http.ResponseWriter, request *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutAssessmentTeamAdmissionSubmit)
 	defer cancel()
+	ctx = c.withRequestMetadata(ctx, request)
 
 	user := auth.AssertReqGetUserDetail(request)
 
@@ -51,6 +54,8 @@ func (c *Client) HandleAssessmentTeamAdmissionSubmit(writer http.ResponseWriter,
 		return
 	}
 
+	c.notifyStatusChange(request, StatusHistoryModuleAssessmentTeam, admissionId, models.AssessmentTeamStatusCreated, "")
+
 	_ = httputil.WriteObj200(writer, map[string]string{
 		"tim_penilaian_id": admissionId,
 	})
@@ -173,7 +178,13 @@ func (c *Client) HandleAssessmentTeamGet(writer http.ResponseWriter, request *ht
 		return
 	}
 
-	admission, err := c.GetAssessmentTeamCtx(ctx, s.AssessmentTeamId)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	admission, err := c.GetAssessmentTeamCtx(ctx, s.AssessmentTeamId, scope)
 	if err != nil {
 		c.httpError(writer, err)
 		return
@@ -189,10 +200,9 @@ func (c *Client) HandleAssessmentTeamSearch(writer http.ResponseWriter, request
 
 	type schemaAdmissionSearch struct {
 		// AdmissionDate is a date with a format of YYYY-MM-DD (e.g. 2006-12-31)
-		AdmissionDate   string `schema:"tgl_usulan"`
-		AdmissionStatus int    `schema:"status"`
-		PageNumber      int    `schema:"halaman"`
-		CountPerPage    int    `schema:"jumlah_per_halaman"`
+		AdmissionDate string `schema:"tgl_usulan"`
+		PageNumber    int    `schema:"halaman"`
+		CountPerPage  int    `schema:"jumlah_per_halaman"`
 	}
 
 	query := &schemaAdmissionSearch{}
@@ -216,8 +226,8 @@ func (c *Client) HandleAssessmentTeamSearch(writer http.ResponseWriter, request
 		return
 	}
 
-	if _, ok := models.AssessmentTeamStatuses[query.AdmissionStatus]; query.AdmissionStatus != 0 && !ok {
-		c.httpError(writer, ErrAssessmentTeamAdmissionFilterInvalidStatus)
+	options, err := c.decodeAdmissionSearchOptions(writer, request, models.AssessmentTeamStatuses, ErrCodeAssessmentTeamAdmissionFilterInvalidStatus, ErrCodeAssessmentTeamAdmissionFilterInvalidDate)
+	if err != nil {
 		return
 	}
 
@@ -231,10 +241,10 @@ func (c *Client) HandleAssessmentTeamSearch(writer http.ResponseWriter, request
 	}
 
 	searchFilter := &AssessmentTeamAdmissionSearchFilter{
-		AdmissionDate:   admissionDate,
-		AdmissionStatus: query.AdmissionStatus,
-		PageNumber:      pageNumber,
-		CountPerPage:    countPerPage,
+		AdmissionDate:          admissionDate,
+		AdmissionSearchOptions: *options,
+		PageNumber:             pageNumber,
+		CountPerPage:           countPerPage,
 	}
 
 	admissions, err := c.SearchAssessmentTeamsCtx(ctx, searchFilter)
@@ -344,6 +354,7 @@ func (c *Client) HandleAssessmentTeamVerificationRecommendationLetterDownload(wr
 func (c *Client) HandleAssessmentTeamVerificationSubmit(writer http.ResponseWriter, request *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutAssessmentTeamVerificationSubmit)
 	defer cancel()
+	ctx = c.withRequestMetadata(ctx, request)
 
 	user := auth.AssertReqGetUserDetail(request)
 
@@ -355,14 +366,81 @@ func (c *Client) HandleAssessmentTeamVerificationSubmit(writer http.ResponseWrit
 
 	verification.SubmitterAsnId = user.AsnId
 
-	updatedAt, err := c.SetAssessmentTeamVerificationCtx(ctx, verification)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
 	if err != nil {
 		c.httpError(writer, err)
 		return
 	}
 
+	updatedAt, err := c.SetAssessmentTeamVerificationCtx(ctx, scope, verification)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	c.notifyStatusChange(request, StatusHistoryModuleAssessmentTeam, verification.AssessmentTeamId, models.AssessmentTeamStatusVerified, "")
+
 	_ = httputil.WriteObj200(writer, map[string]interface{}{
 		"tim_penilaian_id": verification.AssessmentTeamId,
 		"updated_at":       updatedAt.Unix(),
 	})
 }
+
+// HandleAssessmentTeamHistoryGet handles the request to get the status history of an assessment team admission, oldest first.
+func (c *Client) HandleAssessmentTeamHistoryGet(writer http.ResponseWriter, request *http.Request) {
+	type schemaAssessmentTeamId struct {
+		AssessmentTeamId string `schema:"tim_penilaian_id"`
+	}
+	sh := &schemaAssessmentTeamId{}
+	err := c.decodeRequestSchema(writer, request, sh)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutAssessmentTeamHistoryGet)
+	defer cancel()
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	history, err := c.GetStatusHistoryCtx(ctx, StatusHistoryModuleAssessmentTeam, sh.AssessmentTeamId, scope)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, history)
+}
+
+// HandleAssessmentTeamActionsGet handles the request to get the current status of an assessment team admission and the
+// actions the user can do next, so that the frontend can show only the allowed actions.
+func (c *Client) HandleAssessmentTeamActionsGet(writer http.ResponseWriter, request *http.Request) {
+	type schemaAssessmentTeamId struct {
+		AssessmentTeamId string `schema:"tim_penilaian_id"`
+	}
+	sh := &schemaAssessmentTeamId{}
+	err := c.decodeRequestSchema(writer, request, sh)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutAssessmentTeamActionsGet)
+	defer cancel()
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	actions, err := c.GetAdmissionActionsCtx(ctx, StatusHistoryModuleAssessmentTeam, sh.AssessmentTeamId, scope, ReqGetUserRoles(request))
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, actions)
+}
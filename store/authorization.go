@@ -0,0 +1,285 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/metricutil"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+	"github.com/gorilla/mux"
+)
+
+const (
+	userRolesContextKey = "user-roles"
+
+	TimeoutRoleAuth = TimeoutDefault
+
+	// RoleCacheTtl is how long the roles of an access token are cached by RoleAuthHandler.
+	RoleCacheTtl = time.Minute
+	// roleCacheSweepSize is the number of cached entries above which expired entries are removed.
+	roleCacheSweepSize = 10000
+)
+
+// RouteRoles maps a route path template, as registered in mux.Router (e.g. `/api/v1/activity/admission/verify`), to
+// the roles that are allowed to access it. The user must have at least one of the roles.
+// A route mapped to an empty slice can be accessed by any authenticated user. A route that is not in the map
+// cannot be accessed at all, so every new route must be registered here.
+type RouteRoles map[string][]string
+
+// RoleCache caches the roles of users per access token, so that RoleAuthHandler does not query pegawai on every
+// request. Entries expire after Ttl or when the access token expires, whichever comes first, so role changes are
+// picked up after at most Ttl. It is safe for concurrent use.
+type RoleCache struct {
+	Ttl     time.Duration
+	mutex   sync.Mutex
+	entries map[string]*roleCacheEntry
+}
+
+type roleCacheEntry struct {
+	roles     map[string]struct{}
+	expiresAt time.Time
+}
+
+// NewRoleCache creates a RoleCache whose entries expire after ttl.
+func NewRoleCache(ttl time.Duration) *RoleCache {
+	return &RoleCache{
+		Ttl:     ttl,
+		entries: make(map[string]*roleCacheEntry),
+	}
+}
+
+// roleCacheKey returns the cache key of the access token of user, or an empty string if the token cannot be
+// identified, in which case the roles must not be cached.
+func roleCacheKey(user *auth.Asn) string {
+	if user.AccessToken == nil || user.AccessToken.Jti == "" {
+		return ""
+	}
+	return user.AsnId + ":" + user.AccessToken.Jti
+}
+
+// Get returns the cached roles of the access token of user, or nil if there are none.
+func (r *RoleCache) Get(user *auth.Asn) map[string]struct{} {
+	key := roleCacheKey(user)
+	if key == "" {
+		return nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	entry, ok := r.entries[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(r.entries, key)
+		return nil
+	}
+	return entry.roles
+}
+
+// Set caches the roles of the access token of user.
+func (r *RoleCache) Set(user *auth.Asn, roles map[string]struct{}) {
+	key := roleCacheKey(user)
+	if key == "" {
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(r.Ttl)
+	if user.AccessToken.Exp != 0 {
+		if tokenExpiresAt := time.Unix(user.AccessToken.Exp, 0); tokenExpiresAt.Before(expiresAt) {
+			expiresAt = tokenExpiresAt
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(r.entries) >= roleCacheSweepSize {
+		for k, entry := range r.entries {
+			if now.After(entry.expiresAt) {
+				delete(r.entries, k)
+			}
+		}
+	}
+	r.entries[key] = &roleCacheEntry{roles: roles, expiresAt: expiresAt}
+}
+
+// GetUserRolesCtx retrieves the roles of a user. Roles are taken from the access token (realm and client roles
+// whose name is a valid role, see models.Roles) and from the pegawai table (see models.StaffRoles).
+func (c *Client) GetUserRolesCtx(ctx context.Context, user *auth.Asn) (roles map[string]struct{}, err error) {
+	roles = make(map[string]struct{})
+	if user.AccessToken != nil {
+		for _, role := range user.AccessToken.GetRoles() {
+			if _, ok := models.Roles[role.Role]; ok {
+				roles[role.Role] = struct{}{}
+			}
+		}
+	}
+
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+	rows, err := mdb.QueryContext(ctx, "select role_peg from pegawai where user_id = $1", user.AsnId)
+	if err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		staffRole := ""
+		err = rows.Scan(&staffRole)
+		if err != nil {
+			return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+		}
+
+		for _, role := range models.StaffRoles[staffRole] {
+			roles[role] = struct{}{}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+
+	return roles, nil
+}
+
+// GetStaffRolesCtx retrieves the roles a user has from the pegawai table, see models.StaffRoles. It can be used as
+// auth.Auth UserRoles.
+func (c *Client) GetStaffRolesCtx(ctx context.Context, user *auth.Asn) (roles []string, err error) {
+	// Without access token, only the roles of pegawai are retrieved.
+	staffRoles, err := c.GetUserRolesCtx(ctx, &auth.Asn{AsnId: user.AsnId})
+	if err != nil {
+		return nil, err
+	}
+
+	roles = make([]string, 0, len(staffRoles))
+	for role := range staffRoles {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles, nil
+}
+
+// IsStaffCtx checks whether a user is in the pegawai table, whatever their staff role. It can be used as
+// auth.PolicyLoginChecker IsStaff.
+func (c *Client) IsStaffCtx(ctx context.Context, user *auth.Asn) (staff bool, err error) {
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+	err = mdb.QueryRowContext(ctx, "select exists(select 1 from pegawai where user_id = $1)", user.AsnId).Scan(&staff)
+	if err != nil {
+		return false, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+	return staff, nil
+}
+
+// RoleAuthHandler creates a middleware that only lets the request through if the user has one of the roles required
+// by the matched route in routeRoles. It must be used after auth.Auth UserDetailAuthHandler, in a mux.Router, so that
+// the matched route is available.
+// The roles of the user are attached to the request and can be retrieved with ReqGetUserRoles. Roles are cached in
+// c.RoleCache if it is not nil.
+func (c *Client) RoleAuthHandler(routeRoles RouteRoles) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			user := auth.AssertReqGetUserDetail(request)
+
+			route := mux.CurrentRoute(request)
+			if route == nil {
+				c.httpError(writer, ec.NewError(ErrCodeRoleUnauthorized, Errs[ErrCodeRoleUnauthorized], fmt.Errorf("no route matched for %s", request.URL.Path)))
+				return
+			}
+
+			template, err := route.GetPathTemplate()
+			if err != nil {
+				c.httpError(writer, ec.NewError(ErrCodeRoleUnauthorized, Errs[ErrCodeRoleUnauthorized], err))
+				return
+			}
+
+			required, ok := routeRoles[template]
+			if !ok {
+				c.Logger.Warnf("route %s has no roles registered, access denied", template)
+				c.httpError(writer, ec.NewError(ErrCodeRoleUnauthorized, Errs[ErrCodeRoleUnauthorized], fmt.Errorf("route %s has no roles registered", template)))
+				return
+			}
+
+			var roles map[string]struct{}
+			if c.RoleCache != nil {
+				roles = c.RoleCache.Get(user)
+			}
+			if roles == nil {
+				ctx, cancel := context.WithTimeout(context.Background(), TimeoutRoleAuth)
+				defer cancel()
+
+				roles, err = c.GetUserRolesCtx(ctx, user)
+				if err != nil {
+					c.httpError(writer, err)
+					return
+				}
+				if c.RoleCache != nil {
+					c.RoleCache.Set(user, roles)
+				}
+			}
+
+			if !HasAnyRole(roles, required...) {
+				c.httpError(writer, ec.NewError(ErrCodeRoleUnauthorized, Errs[ErrCodeRoleUnauthorized], fmt.Errorf("route %s requires one of %v", template, required)))
+				return
+			}
+
+			next.ServeHTTP(writer, reqSetUserRoles(request, roles))
+		})
+	}
+}
+
+// HasAnyRole checks whether roles contains at least one of the given required roles.
+// It always returns true if no required roles are given.
+func HasAnyRole(roles map[string]struct{}, required ...string) bool {
+	if len(required) == 0 {
+		return true
+	}
+
+	for _, role := range required {
+		if _, ok := roles[role]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reqSetUserRoles attaches user roles to the request via the request context.
+func reqSetUserRoles(request *http.Request, roles map[string]struct{}) (newRequest *http.Request) {
+	ctx := request.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = context.WithValue(ctx, userRolesContextKey, roles)
+	return request.WithContext(ctx)
+}
+
+// ReqGetUserRoles retrieves user roles previously attached by RoleAuthHandler from a request.
+// It returns an empty map if no roles were attached.
+func ReqGetUserRoles(request *http.Request) (roles map[string]struct{}) {
+	ctx := request.Context()
+	if ctx == nil {
+		return map[string]struct{}{}
+	}
+
+	if r, ok := ctx.Value(userRolesContextKey).(map[string]struct{}); ok {
+		return r
+	}
+
+	return map[string]struct{}{}
+}
+
+// InjectUserRoles injects user roles to the request.
+// Can be used for unit testing.
+func InjectUserRoles(request *http.Request, roles ...string) (newRequest *http.Request) {
+	r := make(map[string]struct{})
+	for _, role := range roles {
+		r[role] = struct{}{}
+	}
+	return reqSetUserRoles(request, r)
+}
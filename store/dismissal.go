@@ -1,19 +1,21 @@
 package store
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-	"mime"
 	"path"
 	"time"
 
 	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/docx"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/export"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/metricutil"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/search"
+	"github.com/fazrithe/siasn-jf-backend-git/store/esign"
 	"github.com/fazrithe/siasn-jf-backend-git/store/models"
 	"github.com/fazrithe/siasn-jf-backend-git/store/object"
 	"github.com/google/uuid"
@@ -104,6 +106,11 @@ func (c *Client) InsertDismissalAdmissionCtx(ctx context.Context, request *model
 		return "", ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("cannot insert entry to pemberhentian: %w", err))
 	}
 
+	_, err = c.insertStatusHistoryCtx(ctx, mtx, StatusHistoryModuleDismissal, dismissalId, 0, models.DismissalAdmissionStatusCreated, request.SubmitterAsnId, "")
+	if err != nil {
+		return "", err
+	}
+
 	docStmt, err := mtx.PrepareContext(ctx, "insert into pemberhentian_doc_pendukung(uuid_pemberhentian, filename, nama_doc) values($1, $2, $3)")
 	if err != nil {
 		return "", ec.NewError(ErrCodePrepareFail, Errs[ErrCodePrepareFail], fmt.Errorf("cannot prepare statement for pemberhentian_doc_pendukung table: %w", err))
@@ -137,7 +144,8 @@ func (c *Client) InsertDismissalAdmissionCtx(ctx context.Context, request *model
 }
 
 // GetDismissalDetailCtx retrieves dismissal detail, including its support documents.
-func (c *Client) GetDismissalDetailCtx(ctx context.Context, dismissalId string, agencyId string) (dismissal *models.DismissalAdmission, err error) {
+// Dismissals outside of the agency scope are treated as not found.
+func (c *Client) GetDismissalDetailCtx(ctx context.Context, dismissalId string, scope *AgencyScope) (dismissal *models.DismissalAdmission, err error) {
 	mtx, err := c.createMtxDb(ctx, c.Db)
 	if err != nil {
 		return nil, err
@@ -147,16 +155,16 @@ func (c *Client) GetDismissalDetailCtx(ctx context.Context, dismissalId string,
 		c.completeMtx(mtx, err)
 	}()
 
-	dismissal = &models.DismissalAdmission{DismissalId: dismissalId, AgencyId: agencyId}
+	dismissal = &models.DismissalAdmission{DismissalId: dismissalId}
 	acceptanceLetterDocName := sql.NullString{}
 	acceptanceLetterDocNumber := sql.NullString{}
 	acceptanceLetterDocDate := sql.NullString{}
 	decreeDate := sql.NullString{}
 	err = mtx.QueryRowContext(
 		ctx,
-		"select asn_id, status, status_ts, status_by, coalesce(alasan_pemberhentian, ''), coalesce(alasan_tidak_diberhentikan, ''), nama_doc_surat_pemberhentian, nosurat_surat_pemberhentian, coalesce(ttd_user_id_surat_pemberhentian, ''), tgl_surat_pemberhentian, tgl_pemberhentian, coalesce(nomor_sk, ''), to_char(tgl_sk, 'YYYY-MM-DD'), coalesce(detail_alasan, ''), no_usulan from pemberhentian where uuid_pemberhentian = $1 and instansi_id = $2 for share",
+		"select asn_id, status, status_ts, status_by, coalesce(alasan_pemberhentian, ''), coalesce(alasan_tidak_diberhentikan, ''), nama_doc_surat_pemberhentian, nosurat_surat_pemberhentian, coalesce(ttd_user_id_surat_pemberhentian, ''), tgl_surat_pemberhentian, tgl_pemberhentian, coalesce(nomor_sk, ''), to_char(tgl_sk, 'YYYY-MM-DD'), coalesce(detail_alasan, ''), no_usulan, instansi_id from pemberhentian where uuid_pemberhentian = $1 and ($2::text[] is null or instansi_id = any($2)) for share",
 		dismissalId,
-		agencyId,
+		scope.sqlArg(),
 	).Scan(
 		&dismissal.AsnId,
 		&dismissal.Status,
@@ -173,6 +181,7 @@ func (c *Client) GetDismissalDetailCtx(ctx context.Context, dismissalId string,
 		&decreeDate,
 		&dismissal.ReasonDetail,
 		&dismissal.AdmissionNumber,
+		&dismissal.AgencyId,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -273,18 +282,48 @@ func (c *Client) SearchDismissalAdmissionsCtx(ctx context.Context, admissionDate
 	return dismissals, nil
 }
 
-// SearchDismissalAdmissionsPaginatedCtx searches for dismissal admissions based on admission date and status in an agency.
-func (c *Client) SearchDismissalAdmissionsPaginatedCtx(ctx context.Context, admissionDate models.Iso8601Date, status int, agencyId string, pageNumber, countPerPage int) (result *search.PaginatedList, err error) {
+var dismissalAdmissionSearchTable = &admissionSearchTable{
+	name:       "pemberhentian",
+	idColumn:   "uuid_pemberhentian",
+	dateColumn: "tgl_pemberhentian",
+	asnColumn:  "asn_id",
+}
+
+// dismissalAdmissionSearchQueryCtx builds the query of SearchDismissalAdmissionsPaginatedCtx and
+// ExportDismissalAdmissionsCtx from filter, see applyAdmissionSearchOptionsCtx for the errors returned.
+func (c *Client) dismissalAdmissionSearchQueryCtx(ctx context.Context, filter *DismissalAdmissionSearchFilter) (q *admissionSearchQuery, err error) {
+	q = newAdmissionSearchQuery(dismissalAdmissionSearchTable)
+	if filter.AdmissionDate != "" {
+		q.where("tgl_pemberhentian = %s::date", string(filter.AdmissionDate))
+	}
+	if filter.AdmissionStatus != 0 {
+		q.where("status = %s", filter.AdmissionStatus)
+	}
+	q.where("instansi_id = %s", filter.AgencyId)
+
+	err = c.applyAdmissionSearchOptionsCtx(ctx, q, &filter.AdmissionSearchOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// SearchDismissalAdmissionsPaginatedCtx searches for dismissal admissions of an agency matching filter.
+func (c *Client) SearchDismissalAdmissionsPaginatedCtx(ctx context.Context, filter *DismissalAdmissionSearchFilter) (result *search.PaginatedList, err error) {
 	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
-	rows, err := mdb.QueryContext(
-		ctx,
-		"select uuid_pemberhentian, asn_id, status, status_ts, status_by, coalesce(alasan_pemberhentian, ''), coalesce(alasan_tidak_diberhentikan, ''), tgl_pemberhentian, coalesce(nomor_sk, ''), to_char(tgl_sk, 'YYYY-MM-DD'), coalesce(detail_alasan, ''), no_usulan from pemberhentian where ($1::date is null or tgl_pemberhentian = $1::date) and ($2 = 0 or status = $2) and instansi_id = $3 order by tgl_pemberhentian desc limit $4 offset $5",
-		sql.NullString{Valid: string(admissionDate) != "", String: string(admissionDate)},
-		status,
-		agencyId,
-		countPerPage+1,
-		(pageNumber-1)*countPerPage,
-	)
+
+	q, err := c.dismissalAdmissionSearchQueryCtx(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := q.paginatedQuery("uuid_pemberhentian, asn_id, status, status_ts, status_by, coalesce(alasan_pemberhentian, ''), coalesce(alasan_tidak_diberhentikan, ''), tgl_pemberhentian, coalesce(nomor_sk, ''), to_char(tgl_sk, 'YYYY-MM-DD'), coalesce(detail_alasan, ''), no_usulan", &filter.AdmissionSearchOptions, filter.PageNumber, filter.CountPerPage)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := mdb.QueryContext(ctx, query, q.args...)
 	if err != nil {
 		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot query pemberhentian: %w", err))
 	}
@@ -292,9 +331,9 @@ func (c *Client) SearchDismissalAdmissionsPaginatedCtx(ctx context.Context, admi
 
 	dismissals := make([]*models.DismissalAdmission, 0)
 	for rows.Next() {
-		dismissal := &models.DismissalAdmission{AgencyId: agencyId}
+		dismissal := &models.DismissalAdmission{AgencyId: filter.AgencyId}
 		decreeDate := sql.NullString{}
-		err = rows.Scan(
+		err = q.scan(rows,
 			&dismissal.DismissalId,
 			&dismissal.AsnId,
 			&dismissal.Status,
@@ -319,9 +358,9 @@ func (c *Client) SearchDismissalAdmissionsPaginatedCtx(ctx context.Context, admi
 	}
 
 	hasNext := false
-	if len(dismissals) > countPerPage {
+	if len(dismissals) > filter.CountPerPage {
 		hasNext = true
-		dismissals = dismissals[:countPerPage]
+		dismissals = dismissals[:filter.CountPerPage]
 	}
 
 	// We'll query about the attendees acceptance
@@ -366,10 +405,121 @@ func (c *Client) SearchDismissalAdmissionsPaginatedCtx(ctx context.Context, admi
 
 	return &search.PaginatedList{
 		Data:     dismissals,
-		Metadata: search.CreatePaginatedListMetadataNoTotalNext(pageNumber, len(dismissals), hasNext),
+		Metadata: q.metadata(filter.PageNumber, len(dismissals), hasNext),
 	}, nil
 }
 
+// ExportDismissalAdmissionsCtx writes every dismissal admission of an agency matching filter into table, with a header
+// row. Unlike SearchDismissalAdmissionsPaginatedCtx, the admissions are not paged, filter.PageNumber and
+// filter.CountPerPage are ignored. The ASN names are resolved in batches, so the admissions are never kept in memory at
+// once. Nothing is written into table if the search fails.
+func (c *Client) ExportDismissalAdmissionsCtx(ctx context.Context, filter *DismissalAdmissionSearchFilter, table export.Writer) (err error) {
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+	profileMdb := metricutil.NewDB(c.ProfileDb, c.SqlMetrics)
+	referenceMdb := metricutil.NewDB(c.ReferenceDb, c.SqlMetrics)
+
+	q, err := c.dismissalAdmissionSearchQueryCtx(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	rows, err := mdb.QueryContext(
+		ctx,
+		q.query("asn_id, status, coalesce(alasan_pemberhentian, ''), tgl_pemberhentian, coalesce(nomor_sk, ''), to_char(tgl_sk, 'YYYY-MM-DD'), coalesce(detail_alasan, ''), no_usulan"),
+		q.args...,
+	)
+	if err != nil {
+		return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot query pemberhentian: %w", err))
+	}
+	defer rows.Close()
+
+	agencies, err := c.getAgencyNames(ctx, referenceMdb, []string{filter.AgencyId})
+	if err != nil {
+		return err
+	}
+
+	err = table.WriteRow([]string{"No. Usulan", "NIP", "Nama", "Status", "Tanggal Pemberhentian", "Alasan Pemberhentian", "Detail Alasan", "Nomor SK", "Tanggal SK", "Instansi"})
+	if err != nil {
+		return err
+	}
+
+	dismissals := make([]*models.DismissalAdmission, 0, exportBatchSize)
+	writeDismissals := func() (err error) {
+		if len(dismissals) == 0 {
+			return nil
+		}
+
+		asnIds := make([]string, 0, len(dismissals))
+		for _, dismissal := range dismissals {
+			asnIds = append(asnIds, dismissal.AsnId)
+		}
+
+		asns, err := c.getAsnNipNames(ctx, profileMdb, asnIds)
+		if err != nil {
+			return err
+		}
+
+		for _, dismissal := range dismissals {
+			asn := asns[dismissal.AsnId]
+			if asn == nil {
+				// Ignore ASN that cannot be found
+				asn = &asnNipName{}
+			}
+
+			err = table.WriteRow([]string{
+				dismissal.AdmissionNumber,
+				asn.Nip,
+				asn.AsnName,
+				exportName(models.DismissalAdmissionStatusNames, dismissal.Status),
+				string(dismissal.DismissalDate),
+				dismissal.DismissalReason,
+				dismissal.ReasonDetail,
+				dismissal.DecreeNumber,
+				string(dismissal.DecreeDate),
+				agencies[filter.AgencyId],
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		dismissals = dismissals[:0]
+		return nil
+	}
+
+	for rows.Next() {
+		dismissal := &models.DismissalAdmission{}
+		decreeDate := sql.NullString{}
+		err = rows.Scan(
+			&dismissal.AsnId,
+			&dismissal.Status,
+			&dismissal.DismissalReason,
+			&dismissal.DismissalDate,
+			&dismissal.DecreeNumber,
+			&decreeDate,
+			&dismissal.ReasonDetail,
+			&dismissal.AdmissionNumber,
+		)
+		if err != nil {
+			return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot query pemberhentian: %w", err))
+		}
+		dismissal.DecreeDate = models.Iso8601Date(decreeDate.String)
+
+		dismissals = append(dismissals, dismissal)
+		if len(dismissals) == exportBatchSize {
+			err = writeDismissals()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot query pemberhentian: %w", err))
+	}
+
+	return writeDismissals()
+}
+
 // IsDismissalExistCtx checks if dismissal entry exists.
 func (c *Client) IsDismissalExistCtx(ctx context.Context, dismissalId string) (isExist bool, err error) {
 	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
@@ -386,18 +536,32 @@ func (c *Client) IsDismissalExistCtx(ctx context.Context, dismissalId string) (i
 	return true, nil
 }
 
+// getDismissalStatusForUpdateCtx retrieves the status of a dismissal and locks it for update.
+// Dismissals outside of the agency scope are treated as not found.
+func (c *Client) getDismissalStatusForUpdateCtx(ctx context.Context, dh metricutil.DbHandler, scope *AgencyScope, dismissalId string) (status int, err error) {
+	err = dh.QueryRowContext(ctx, "select status from pemberhentian where uuid_pemberhentian = $1 and ($2::text[] is null or instansi_id = any($2)) for update", dismissalId, scope.sqlArg()).Scan(&status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrEntryNotFound
+		}
+
+		return 0, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot query pemberhentian: %w", err))
+	}
+
+	return status, nil
+}
+
 // SetDismissalStatusAcceptedCtx sets the dismissal status to accepted.
-// It requires dismissal acceptance letter to be uploaded first.
-func (c *Client) SetDismissalStatusAcceptedCtx(ctx context.Context, request *models.DismissalAcceptanceRequest) (modifiedAt time.Time, err error) {
+// It requires dismissal acceptance letter to be uploaded first. The letter is generated once the chosen signer signs
+// it, see SignDismissalAcceptanceLetterCtx. Dismissals outside of the agency scope are treated as
+// not found. If the dismissal workflow does not allow it, this will return error code
+// errnum.ErrCodeWorkflowTransitionInvalid, or errnum.ErrCodeWorkflowDocumentMissing if the letter is not supplied.
+func (c *Client) SetDismissalStatusAcceptedCtx(ctx context.Context, scope *AgencyScope, request *models.DismissalAcceptanceRequest) (modifiedAt time.Time, err error) {
 	_, err = uuid.Parse(request.DismissalId)
 	if err != nil {
 		return time.Time{}, ec.NewError(ErrCodeUuidInvalid, Errs[ErrCodeUuidInvalid], err)
 	}
 
-	if request.DismissalLetter == nil || request.DismissalLetter.DocumentNumber == "" || request.DismissalLetter.DocumentDate == "" {
-		return time.Time{}, ErrDismissalAcceptanceNoLetter
-	}
-
 	mtx, err := c.createMtxDb(ctx, c.Db)
 	if err != nil {
 		return time.Time{}, err
@@ -407,6 +571,21 @@ func (c *Client) SetDismissalStatusAcceptedCtx(ctx context.Context, request *mod
 		c.completeMtx(mtx, err)
 	}()
 
+	currentStatus, err := c.getDismissalStatusForUpdateCtx(ctx, mtx, scope, request.DismissalId)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	documents := make([]string, 0)
+	if request.DismissalLetter != nil && request.DismissalLetter.DocumentNumber != "" && request.DismissalLetter.DocumentDate != "" {
+		documents = append(documents, "surat_pemberhentian")
+	}
+
+	err = checkTransition(dismissalWorkflow, currentStatus, WorkflowActionAccept, documents, request)
+	if err != nil {
+		return time.Time{}, err
+	}
+
 	d := 0
 	err = mtx.QueryRowContext(ctx, "select 1 from pegawai where user_id = $1 and role_peg = $2 and instansi = $3", request.DismissalLetterSignerAsnId, models.StaffRoleSupervisor, request.AgencyId).Scan(&d)
 	if err != nil {
@@ -419,7 +598,7 @@ func (c *Client) SetDismissalStatusAcceptedCtx(ctx context.Context, request *mod
 
 	err = mtx.QueryRowContext(
 		ctx,
-		"update pemberhentian set status = $1, status_ts = current_timestamp, status_by = $2, nama_doc_surat_pemberhentian = $3, nosurat_surat_pemberhentian = $4, ttd_user_id_surat_pemberhentian = $5, tgl_surat_pemberhentian = $6 where uuid_pemberhentian = $7 and status = $8 returning status_ts",
+		"update pemberhentian set status = $1, status_ts = current_timestamp, status_by = $2, nama_doc_surat_pemberhentian = $3, nosurat_surat_pemberhentian = $4, ttd_user_id_surat_pemberhentian = $5, tgl_surat_pemberhentian = $6 where uuid_pemberhentian = $7 returning status_ts",
 		models.DismissalAdmissionStatusAccepted,
 		request.SubmitterAsnId,
 		request.DismissalLetter.DocumentName,
@@ -427,19 +606,12 @@ func (c *Client) SetDismissalStatusAcceptedCtx(ctx context.Context, request *mod
 		request.DismissalLetterSignerAsnId,
 		string(request.DismissalLetter.DocumentDate),
 		request.DismissalId,
-		models.DismissalAdmissionStatusCreated,
 	).Scan(&modifiedAt)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return time.Time{}, ErrEntryNotFound
-		}
-
 		return time.Time{}, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot query pemberhentian: %w", err))
 	}
 
-	profileMdb := metricutil.NewDB(c.ProfileDb, c.SqlMetrics)
-	referenceMdb := metricutil.NewDB(c.ReferenceDb, c.SqlMetrics)
-	_, err = c.retrieveAndGenerateDismissalAcceptanceLetterCtx(ctx, mtx, profileMdb, referenceMdb, request.DismissalId, true)
+	_, err = c.insertStatusHistoryCtx(ctx, mtx, StatusHistoryModuleDismissal, request.DismissalId, currentStatus, models.DismissalAdmissionStatusAccepted, request.SubmitterAsnId, "")
 	if err != nil {
 		return time.Time{}, err
 	}
@@ -449,8 +621,9 @@ func (c *Client) SetDismissalStatusAcceptedCtx(ctx context.Context, request *mod
 
 // SetDismissalStatusDeniedCtx sets the dismissal status to denied.
 // Denial support documents can be uploaded optionally beforehand and supplied in the request. Only document filenames
-// are stored.
-func (c *Client) SetDismissalStatusDeniedCtx(ctx context.Context, request *models.DismissalDenyRequest) (modifiedAt time.Time, err error) {
+// are stored. Dismissals outside of the agency scope are treated as not found. If the dismissal workflow does not allow
+// it, this will return error code errnum.ErrCodeWorkflowTransitionInvalid.
+func (c *Client) SetDismissalStatusDeniedCtx(ctx context.Context, scope *AgencyScope, request *models.DismissalDenyRequest) (modifiedAt time.Time, err error) {
 	dismissalId, err := uuid.Parse(request.DismissalId)
 	if err != nil {
 		return time.Time{}, ec.NewError(ErrCodeUuidInvalid, Errs[ErrCodeUuidInvalid], err)
@@ -469,23 +642,33 @@ func (c *Client) SetDismissalStatusDeniedCtx(ctx context.Context, request *model
 		c.completeMtx(mtx, err)
 	}()
 
+	currentStatus, err := c.getDismissalStatusForUpdateCtx(ctx, mtx, scope, request.DismissalId)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	err = checkTransition(dismissalWorkflow, currentStatus, WorkflowActionReject, nil, request)
+	if err != nil {
+		return time.Time{}, err
+	}
+
 	err = mtx.QueryRowContext(
 		ctx,
-		"update pemberhentian set status = $1, status_ts = current_timestamp, status_by = $2, alasan_tidak_diberhentikan = $3 where uuid_pemberhentian = $4 and status = $5 returning status_ts",
+		"update pemberhentian set status = $1, status_ts = current_timestamp, status_by = $2, alasan_tidak_diberhentikan = $3 where uuid_pemberhentian = $4 returning status_ts",
 		models.DismissalAdmissionStatusRejected,
 		request.SubmitterAsnId,
 		request.DismissalDenyReason,
 		request.DismissalId,
-		models.DismissalAdmissionStatusCreated,
 	).Scan(&modifiedAt)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return time.Time{}, ErrEntryNotFound
-		}
-
 		return time.Time{}, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot query pemberhentian: %w", err))
 	}
 
+	_, err = c.insertStatusHistoryCtx(ctx, mtx, StatusHistoryModuleDismissal, request.DismissalId, currentStatus, models.DismissalAdmissionStatusRejected, request.SubmitterAsnId, request.DismissalDenyReason)
+	if err != nil {
+		return time.Time{}, err
+	}
+
 	if request.TempDismissalDenySupportDocuments != nil && len(request.TempDismissalDenySupportDocuments) > 0 {
 		docStmt, err := mtx.PrepareContext(ctx, "insert into pemberhentian_doc_pendukung_penolakan(uuid_pemberhentian, filename) values($1, $2)")
 		if err != nil {
@@ -518,82 +701,109 @@ func (c *Client) SetDismissalStatusDeniedCtx(ctx context.Context, request *model
 	return modifiedAt, nil
 }
 
-// GetDismissalStatusStatisticCtx returns the number of dismissal items for each status.
-func (c *Client) GetDismissalStatusStatisticCtx(ctx context.Context) (statistics []*models.StatisticStatus, err error) {
-	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
-	rows, err := mdb.QueryContext(ctx, "select status, jumlah from pemberhentian_status_statistik")
+// dismissalStatisticSource is the source of the dismissal status statistics. Dismissals do not record a functional
+// position, and are dated by their dismissal date.
+var dismissalStatisticSource = &statisticSource{
+	table:        "pemberhentian",
+	statuses:     models.DismissalAdmissionStatuses,
+	dateColumn:   "tgl_pemberhentian",
+	agencyColumn: "instansi_id",
+}
+
+// GetDismissalStatusStatisticCtx returns the number of dismissal items for each status, limited to scope and filter.
+// filter.GroupBy is ignored.
+func (c *Client) GetDismissalStatusStatisticCtx(ctx context.Context, scope *AgencyScope, filter *StatisticFilter) (statistics []*models.StatisticStatus, err error) {
+	periods, err := c.getStatusStatisticCtx(ctx, dismissalStatisticSource, scope, filter, false)
 	if err != nil {
-		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+		return nil, err
 	}
-	defer rows.Close()
 
-	statistics = make([]*models.StatisticStatus, 0)
-	statisticMap := make(map[int]*models.StatisticStatus)
-	for status := range models.DismissalAdmissionStatuses {
-		statusStatistic := &models.StatisticStatus{
-			Status: status,
-		}
-		statistics = append(statistics, statusStatistic)
-		statisticMap[status] = statusStatistic
+	return periods[0].Statuses, nil
+}
+
+// GetDismissalStatusStatisticSeriesCtx returns the number of dismissal items for each status in each period of
+// filter.GroupBy, limited to scope and filter.
+func (c *Client) GetDismissalStatusStatisticSeriesCtx(ctx context.Context, scope *AgencyScope, filter *StatisticFilter) (periods []*models.StatisticPeriod, err error) {
+	return c.getStatusStatisticCtx(ctx, dismissalStatisticSource, scope, filter, true)
+}
+
+// SignDismissalAcceptanceLetterCtx queues a job that generates the acceptance letter of an accepted dismissal, signs it
+// electronically as identity with the client Signer and store it in the storage, see
+// runDismissalAcceptanceLetterJobCtx. Only the signer chosen when the dismissal was accepted, signerAsnId, can sign
+// its letter, other users get errnum.ErrCodeRoleUnauthorized. If the dismissal workflow does not allow it, this will
+// return error code errnum.ErrCodeWorkflowTransitionInvalid.
+//
+// Dismissals outside of the agency scope are treated as not found.
+func (c *Client) SignDismissalAcceptanceLetterCtx(ctx context.Context, scope *AgencyScope, dismissalId string, signerAsnId string, identity *esign.Identity) (job *models.Job, err error) {
+	_, err = uuid.Parse(dismissalId)
+	if err != nil {
+		return nil, ec.NewError(ErrCodeUuidInvalid, Errs[ErrCodeUuidInvalid], err)
 	}
-	for rows.Next() {
-		var temp models.StatisticStatus
-		err = rows.Scan(&temp.Status, &temp.Count)
-		if err != nil {
-			return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
-		}
-		statusStatistic, ok := statisticMap[temp.Status]
-		if ok {
-			statusStatistic.Count = temp.Count
+
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+
+	status := 0
+	letterSignerAsnId := ""
+	err = mdb.QueryRowContext(
+		ctx,
+		"select status, coalesce(ttd_user_id_surat_pemberhentian, '') from pemberhentian where uuid_pemberhentian = $1 and ($2::text[] is null or instansi_id = any($2))",
+		dismissalId,
+		scope.sqlArg(),
+	).Scan(
+		&status,
+		&letterSignerAsnId,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrEntryNotFound
 		}
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot query pemberhentian: %w", err))
 	}
-	if err = rows.Err(); err != nil {
-		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+
+	err = checkTransition(dismissalWorkflow, status, WorkflowActionSignLetter, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if letterSignerAsnId != signerAsnId {
+		return nil, ec.NewError(ErrCodeRoleUnauthorized, Errs[ErrCodeRoleUnauthorized], fmt.Errorf("user %s cannot sign the dismissal acceptance letter", signerAsnId))
 	}
 
-	return statistics, nil
+	return c.enqueueJobCtx(ctx, JobKindDismissalAcceptanceLetter, StatusHistoryModuleDismissal, dismissalId, nil, signerAsnId, identity)
 }
 
-// retrieveAndGenerateDismissalAcceptanceLetterCtx generates a dismissal letter and store it in the storage.
+// runDismissalAcceptanceLetterJobCtx generates the acceptance letter queued by SignDismissalAcceptanceLetterCtx, signs
+// it as the identity of the job and store it in the storage. The letter is stored only if signing succeeds. The status
+// of the dismissal and its signer are checked again since they may have changed while the job was queued.
 // Filename is generated from dismissalId.pdf. The base filename is returned,
 // it can be accessed in the dismissal acceptance subdir in permanent bucket.
-//
-// To help reduce performance load, it is only generated once, unless forceRegenerate is set to true.
-func (c *Client) retrieveAndGenerateDismissalAcceptanceLetterCtx(ctx context.Context, dh metricutil.DbHandler, profileDh metricutil.DbHandler, referenceDh metricutil.DbHandler, dismissalId string, forceRegenerate bool) (filename string, err error) {
+func (c *Client) runDismissalAcceptanceLetterJobCtx(ctx context.Context, job *queuedJob) (filename string, err error) {
+	if job.Identity == nil {
+		return "", ErrJobIdentityExpired
+	}
+
+	dismissalId := job.EntityId
+	signerAsnId := job.AsnId
 	filename = fmt.Sprintf("%s.pdf", dismissalId)
 	fullPath := path.Join(DismissalAcceptanceLetterSubdir, filename)
 
-	if !forceRegenerate {
-		fileFound := true
-		meta, err := c.DismissalStorage.GetDismissalFileMetadata(ctx, fullPath)
-		if err != nil && !errors.Is(err, object.ErrFileNotFound) {
-			return "", ec.NewError(ErrCodeStorageGetMetadataFail, Errs[ErrCodeStorageGetMetadataFail], err)
-		}
-
-		if errors.Is(err, object.ErrFileNotFound) {
-			fileFound = false
-		} else {
-			if ct, _, err := mime.ParseMediaType(meta.ContentType); meta.ContentLength <= 0 || err != nil || ct != "application/pdf" {
-				fileFound = false
-			}
-		}
-
-		if fileFound {
-			return filename, nil
-		}
-	}
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+	profileMdb := metricutil.NewDB(c.ProfileDb, c.SqlMetrics)
+	referenceMdb := metricutil.NewDB(c.ReferenceDb, c.SqlMetrics)
 
 	data := &DismissalAcceptanceTemplate{}
 	asnId := ""
 	status := 0
+	letterSignerAsnId := ""
 	decreeDate := sql.NullString{}
-	err = dh.QueryRowContext(
+	err = mdb.QueryRowContext(
 		ctx,
-		"select asn_id, status, coalesce(alasan_pemberhentian, ''), nosurat_surat_pemberhentian, to_char(tgl_surat_pemberhentian, 'YYYY-MM-DD'), to_char(tgl_pemberhentian, 'YYYY-MM-DD'), coalesce(nomor_sk, ''), to_char(tgl_sk, 'YYYY-MM-DD') from pemberhentian where uuid_pemberhentian = $1",
+		"select asn_id, status, coalesce(ttd_user_id_surat_pemberhentian, ''), coalesce(alasan_pemberhentian, ''), nosurat_surat_pemberhentian, to_char(tgl_surat_pemberhentian, 'YYYY-MM-DD'), to_char(tgl_pemberhentian, 'YYYY-MM-DD'), coalesce(nomor_sk, ''), to_char(tgl_sk, 'YYYY-MM-DD') from pemberhentian where uuid_pemberhentian = $1",
 		dismissalId,
 	).Scan(
 		&asnId,
 		&status,
+		&letterSignerAsnId,
 		&data.DismissalReason,
 		&data.DocumentNumber,
 		&data.DocumentDate,
@@ -609,7 +819,16 @@ func (c *Client) retrieveAndGenerateDismissalAcceptanceLetterCtx(ctx context.Con
 		return "", ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot query pemberhentian: %w", err))
 	}
 
-	detail, err := c.getUserDetailByAsnId(ctx, profileDh, referenceDh, asnId, "")
+	err = checkTransition(dismissalWorkflow, status, WorkflowActionSignLetter, nil, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if letterSignerAsnId != signerAsnId {
+		return "", ec.NewError(ErrCodeRoleUnauthorized, Errs[ErrCodeRoleUnauthorized], fmt.Errorf("user %s cannot sign the dismissal acceptance letter", signerAsnId))
+	}
+
+	detail, err := c.getUserDetailByAsnId(ctx, profileMdb, referenceMdb, asnId, "")
 	if err != nil {
 		return "", err
 	}
@@ -622,13 +841,19 @@ func (c *Client) retrieveAndGenerateDismissalAcceptanceLetterCtx(ctx context.Con
 	data.OrganizationUnit = detail.OrganizationUnit
 	data.AsnGrade = detail.Rank
 
-	err = c.generateDismissalAcceptanceLetterCtx(ctx, fullPath, data)
+	document := &bytes.Buffer{}
+	err = c.generateDismissalAcceptanceLetterCtx(ctx, fullPath, data, bufferPutFunc(document))
 	if err != nil {
-		if errors.Is(err, docx.ErrSiasnRendererBadTemplate) {
+		if errors.Is(err, docx.ErrBadTemplate) {
 			return "", ec.NewError(ErrCodeDocumentGenerateBadTemplate, Errs[ErrCodeDocumentGenerateBadTemplate], err)
 		}
 		return "", ec.NewError(ErrCodeDocumentGenerate, Errs[ErrCodeDocumentGenerate], err)
 	}
 
+	err = c.signAndPutPdfCtx(ctx, job.Identity, document, fullPath, c.DismissalStorage.PutDismissalFile)
+	if err != nil {
+		return "", err
+	}
+
 	return filename, nil
 }
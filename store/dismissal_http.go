@@ -10,6 +10,7 @@ import (
 	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/httputil"
+	"github.com/fazrithe/siasn-jf-backend-git/store/esign"
 	"github.com/fazrithe/siasn-jf-backend-git/store/models"
 	"github.com/fazrithe/siasn-jf-backend-git/store/object"
 )
@@ -25,12 +26,16 @@ const (
 	TimeoutDismissalAcceptanceLetterUpload           = TimeoutDefault
 	TimeoutDismissalAcceptanceLetterPreview          = TimeoutDefault
 	TimeoutDismissalAcceptanceLetterDownload         = TimeoutDefault
+	TimeoutDismissalAcceptanceLetterSign             = TimeoutDefault
 	TimeoutDismissalAcceptanceLetterTemplateDownload = TimeoutDefault
 	TimeoutDismissalDenySet                          = TimeoutDefault
 	TimeoutDismissalDenySupportDocUpload             = TimeoutDefault
 	TimeoutDismissalDenySupportDocPreview            = TimeoutDefault
 	TimeoutDismissalDenySupportDocDownload           = TimeoutDefault
 	TimeoutGetDismissalStatusStatistic               = TimeoutDefault
+	TimeoutGetDismissalStatusStatisticSeries         = TimeoutDefault
+	TimeoutDismissalHistoryGet                       = TimeoutDefault
+	TimeoutDismissalActionsGet                       = TimeoutDefault
 )
 
 // HandleDismissalAdmissionSubmit handles a new admission request.
@@ -47,6 +52,7 @@ func (c *Client) HandleDismissalAdmissionSubmit(writer http.ResponseWriter, requ
 
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutDismissalAdmissionSubmit)
 	defer cancel()
+	ctx = c.withRequestMetadata(ctx, request)
 
 	da.SubmitterAsnId = user.AsnId
 	da.AgencyId = user.WorkAgencyId
@@ -57,6 +63,8 @@ func (c *Client) HandleDismissalAdmissionSubmit(writer http.ResponseWriter, requ
 		return
 	}
 
+	c.notifyStatusChange(request, StatusHistoryModuleDismissal, dismissalId, models.DismissalAdmissionStatusCreated, "")
+
 	_ = httputil.WriteObj200(writer, map[string]string{
 		"pemberhentian_id": dismissalId,
 	})
@@ -64,8 +72,6 @@ func (c *Client) HandleDismissalAdmissionSubmit(writer http.ResponseWriter, requ
 
 // HandleDismissalAdmissionGet handles getting a dismissal admission detail.
 func (c *Client) HandleDismissalAdmissionGet(writer http.ResponseWriter, request *http.Request) {
-	user := auth.AssertReqGetUserDetail(request)
-
 	type schemaDismissalId struct {
 		DismissalId string `schema:"pemberhentian_id"`
 	}
@@ -78,7 +84,13 @@ func (c *Client) HandleDismissalAdmissionGet(writer http.ResponseWriter, request
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutDismissalAdmissionGet)
 	defer cancel()
 
-	dismissal, err := c.GetDismissalDetailCtx(ctx, di.DismissalId, user.WorkAgencyId)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	dismissal, err := c.GetDismissalDetailCtx(ctx, di.DismissalId, scope)
 	if err != nil {
 		c.httpError(writer, err)
 		return
@@ -141,7 +153,6 @@ func (c *Client) HandleDismissalAdmissionsSearchPaginated(writer http.ResponseWr
 	type schemaAdmissionSearch struct {
 		// AdmissionDate is a date with a format of YYYY-MM-DD (e.g. 2006-12-31)
 		AdmissionDate string `schema:"tgl_usulan"`
-		Status        int    `schema:"status"`
 		PageNumber    int    `schema:"halaman"`
 		CountPerPage  int    `schema:"jumlah_per_halaman"`
 	}
@@ -166,8 +177,8 @@ func (c *Client) HandleDismissalAdmissionsSearchPaginated(writer http.ResponseWr
 		return
 	}
 
-	if _, ok := models.DismissalAdmissionStatuses[query.Status]; query.Status != 0 && !ok {
-		c.httpError(writer, ErrDismissalSearchStatusInvalid)
+	options, err := c.decodeAdmissionSearchOptions(writer, request, models.DismissalAdmissionStatuses, ErrCodeDismissalSearchStatusInvalid, ErrCodeDismissalSearchInvalidDate)
+	if err != nil {
 		return
 	}
 
@@ -180,7 +191,13 @@ func (c *Client) HandleDismissalAdmissionsSearchPaginated(writer http.ResponseWr
 		}
 	}
 
-	dismissals, err := c.SearchDismissalAdmissionsPaginatedCtx(ctx, admissionDate, query.Status, user.WorkAgencyId, pageNumber, countPerPage)
+	dismissals, err := c.SearchDismissalAdmissionsPaginatedCtx(ctx, &DismissalAdmissionSearchFilter{
+		AgencyId:               user.WorkAgencyId,
+		AdmissionDate:          admissionDate,
+		AdmissionSearchOptions: *options,
+		PageNumber:             pageNumber,
+		CountPerPage:           countPerPage,
+	})
 	if err != nil {
 		c.httpError(writer, err)
 		return
@@ -189,6 +206,54 @@ func (c *Client) HandleDismissalAdmissionsSearchPaginated(writer http.ResponseWr
 	_ = httputil.WriteObj200(writer, dismissals)
 }
 
+// HandleDismissalAdmissionsExport handles a request to export every dismissal admission of a work agency matching
+// the search filters as an xlsx or csv file.
+func (c *Client) HandleDismissalAdmissionsExport(writer http.ResponseWriter, request *http.Request) {
+	user := auth.AssertReqGetUserDetail(request)
+
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutExport)
+	defer cancel()
+
+	type schemaAdmissionExport struct {
+		// AdmissionDate is a date with a format of YYYY-MM-DD (e.g. 2006-12-31)
+		AdmissionDate string `schema:"tgl_usulan"`
+		// Format is either xlsx (default) or csv.
+		Format string `schema:"format"`
+	}
+	query := &schemaAdmissionExport{}
+	err := c.decodeRequestSchema(writer, request, query)
+	if err != nil {
+		return
+	}
+
+	options, err := c.decodeAdmissionSearchOptions(writer, request, models.DismissalAdmissionStatuses, ErrCodeDismissalSearchStatusInvalid, ErrCodeDismissalSearchInvalidDate)
+	if err != nil {
+		return
+	}
+
+	var admissionDate models.Iso8601Date
+	if query.AdmissionDate != "" {
+		admissionDate, err = models.ParseIso8601Date(query.AdmissionDate)
+		if err != nil {
+			c.httpError(writer, ErrDismissalSearchInvalidDate)
+			return
+		}
+	}
+
+	table, err := c.newHttpExport(writer, query.Format, "usulan-pemberhentian")
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	err = c.ExportDismissalAdmissionsCtx(ctx, &DismissalAdmissionSearchFilter{
+		AgencyId:               user.WorkAgencyId,
+		AdmissionDate:          admissionDate,
+		AdmissionSearchOptions: *options,
+	}, table)
+	c.finishHttpExport(writer, table, err)
+}
+
 // HandleDismissalAdmissionSupportDocUpload handles a request to upload an admission support document.
 // We do not redirect the request to object storage signed URL. We instead return a JSON containing a document name
 // which will have to be saved by the frontend and a signed URL which the frontend has to request with PUT method
@@ -295,22 +360,67 @@ func (c *Client) HandleDismissalAcceptSet(writer http.ResponseWriter, request *h
 
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutDismissalAcceptSet)
 	defer cancel()
+	ctx = c.withRequestMetadata(ctx, request)
 
 	da.SubmitterAsnId = user.AsnId
 	da.AgencyId = user.WorkAgencyId
 
-	modifiedAt, err := c.SetDismissalStatusAcceptedCtx(ctx, da)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
 	if err != nil {
 		c.httpError(writer, err)
 		return
 	}
 
+	modifiedAt, err := c.SetDismissalStatusAcceptedCtx(ctx, scope, da)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	c.notifyStatusChange(request, StatusHistoryModuleDismissal, da.DismissalId, models.DismissalAdmissionStatusAccepted, "")
+
 	_ = httputil.WriteObj200(writer, map[string]interface{}{
 		"pemberhentian_id": da.DismissalId,
 		"modified_at":      modifiedAt.Unix(),
 	})
 }
 
+// HandleDismissalAcceptanceLetterSign handles a request to generate the acceptance letter of an accepted dismissal and
+// sign it electronically. Only the signer chosen when the dismissal was accepted can sign it, with their own
+// certificate passphrase. The letter is generated in the background, this returns 202 with the job, which can be
+// polled until the letter can be downloaded.
+func (c *Client) HandleDismissalAcceptanceLetterSign(writer http.ResponseWriter, request *http.Request) {
+	user := auth.AssertReqGetUserDetail(request)
+
+	type schemaDismissalSign struct {
+		DismissalId string `json:"pemberhentian_id"`
+		Passphrase  string `json:"passphrase"`
+	}
+
+	s := &schemaDismissalSign{}
+	err := c.decodeRequestJson(writer, request, s)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutDismissalAcceptanceLetterSign)
+	defer cancel()
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	job, err := c.SignDismissalAcceptanceLetterCtx(ctx, scope, s.DismissalId, user.AsnId, &esign.Identity{Nik: user.Nik, Passphrase: s.Passphrase})
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj(writer, job, http.StatusAccepted)
+}
+
 // Deprecated: no longer uploaded.
 // HandleDismissalAcceptanceLetterUpload handles a request to upload an dismissal acceptance letter.
 // We do not redirect the request to object storage signed URL. We instead return a JSON containing a document name
@@ -453,16 +563,25 @@ func (c *Client) HandleDismissalDenySet(writer http.ResponseWriter, request *htt
 
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutDismissalDenySet)
 	defer cancel()
+	ctx = c.withRequestMetadata(ctx, request)
 
 	dd.SubmitterAsnId = user.AsnId
 	dd.AgencyId = user.WorkAgencyId
 
-	modifiedAt, err := c.SetDismissalStatusDeniedCtx(ctx, dd)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	modifiedAt, err := c.SetDismissalStatusDeniedCtx(ctx, scope, dd)
 	if err != nil {
 		c.httpError(writer, err)
 		return
 	}
 
+	c.notifyStatusChange(request, StatusHistoryModuleDismissal, dd.DismissalId, models.DismissalAdmissionStatusRejected, dd.DismissalDenyReason)
+
 	_ = httputil.WriteObj200(writer, map[string]interface{}{
 		"pemberhentian_id": dd.DismissalId,
 		"modified_at":      modifiedAt.Unix(),
@@ -563,12 +682,24 @@ func (c *Client) HandleDismissalDenySupportDocDownload(writer http.ResponseWrite
 	http.Redirect(writer, request, url.String(), http.StatusFound)
 }
 
-// HandleGetDismissalStatusStatistic returns the number of dismissal items for each status.
-func (c *Client) HandleGetDismissalStatusStatistic(writer http.ResponseWriter, _ *http.Request) {
+// HandleGetDismissalStatusStatistic returns the number of dismissal items for each status, within the agency scope of
+// the user. The statistic can be filtered by agency and dismissal date range.
+func (c *Client) HandleGetDismissalStatusStatistic(writer http.ResponseWriter, request *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutGetDismissalStatusStatistic)
 	defer cancel()
 
-	statistic, err := c.GetDismissalStatusStatisticCtx(ctx)
+	filter, err := c.decodeStatisticFilter(writer, request)
+	if err != nil {
+		return
+	}
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	statistic, err := c.GetDismissalStatusStatisticCtx(ctx, scope, filter)
 	if err != nil {
 		c.httpError(writer, err)
 		return
@@ -576,3 +707,88 @@ func (c *Client) HandleGetDismissalStatusStatistic(writer http.ResponseWriter, _
 
 	_ = httputil.WriteObj200(writer, statistic)
 }
+
+// HandleGetDismissalStatusStatisticSeries returns the number of dismissal items for each status in each month, quarter
+// or year, within the agency scope of the user. It accepts the same filters as HandleGetDismissalStatusStatistic.
+func (c *Client) HandleGetDismissalStatusStatisticSeries(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutGetDismissalStatusStatisticSeries)
+	defer cancel()
+
+	filter, err := c.decodeStatisticFilter(writer, request)
+	if err != nil {
+		return
+	}
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	periods, err := c.GetDismissalStatusStatisticSeriesCtx(ctx, scope, filter)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, periods)
+}
+
+// HandleDismissalHistoryGet handles the request to get the status history of a dismissal admission, oldest first.
+func (c *Client) HandleDismissalHistoryGet(writer http.ResponseWriter, request *http.Request) {
+	type schemaDismissalId struct {
+		DismissalId string `schema:"pemberhentian_id"`
+	}
+	sh := &schemaDismissalId{}
+	err := c.decodeRequestSchema(writer, request, sh)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutDismissalHistoryGet)
+	defer cancel()
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	history, err := c.GetStatusHistoryCtx(ctx, StatusHistoryModuleDismissal, sh.DismissalId, scope)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, history)
+}
+
+// HandleDismissalActionsGet handles the request to get the current status of a dismissal admission and the
+// actions the user can do next, so that the frontend can show only the allowed actions.
+func (c *Client) HandleDismissalActionsGet(writer http.ResponseWriter, request *http.Request) {
+	type schemaDismissalId struct {
+		DismissalId string `schema:"pemberhentian_id"`
+	}
+	sh := &schemaDismissalId{}
+	err := c.decodeRequestSchema(writer, request, sh)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutDismissalActionsGet)
+	defer cancel()
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	actions, err := c.GetAdmissionActionsCtx(ctx, StatusHistoryModuleDismissal, sh.DismissalId, scope, ReqGetUserRoles(request))
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, actions)
+}
@@ -12,7 +12,7 @@
 //
 // Use the store package functionalities by creating a Client, by invoking NewClient:
 //
-//	client := store.NewClient(db, sqlMetrics, rcb)
+//	client := store.NewClient(db, profileDb, referenceDb, storage, renderer, signer, sqlMetrics)
 package store
 
 import (
@@ -0,0 +1,159 @@
+package esign
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// BsreSigner implements the Signer interface with the BSrE (Balai Sertifikasi Elektronik) esign API, which signs
+// the document with the certificate of the person identified by the NIK of the signing identity.
+type BsreSigner struct {
+	Client *http.Client
+	// Url is the full URL of the PDF signing endpoint, e.g. https://esign.bkn.go.id/api/sign/pdf.
+	Url string
+	// Username and Password are the Basic credentials of this service in the esign API.
+	Username string
+	Password string
+	// Visible adds a visible signature to the document, placed on Tag.
+	// If it is false, Tag, Width, Height and ImagePath are ignored.
+	Visible bool
+	// Tag is the text in the document on which the visible signature is placed (tag_koordinat), e.g. $.
+	Tag string
+	// Width and Height are the size of the visible signature.
+	Width  int
+	Height int
+	// ImagePath is the path to a PNG signature image. If it is empty, BSrE renders a default QR code.
+	ImagePath string
+}
+
+// NewBsreSigner creates a BsreSigner signing visibly on the `$` tag.
+func NewBsreSigner(url, username, password string) *BsreSigner {
+	return &BsreSigner{
+		Client:   &http.Client{},
+		Url:      url,
+		Username: username,
+		Password: password,
+		Visible:  true,
+		Tag:      "$",
+		Width:    100,
+		Height:   20,
+	}
+}
+
+// bsreError is the body returned by BSrE when signing fails.
+type bsreError struct {
+	Error      string `json:"error"`
+	StatusCode int    `json:"status_code"`
+}
+
+func (s *BsreSigner) SignPdfCtx(ctx context.Context, identity *Identity, document io.Reader) (signed []byte, err error) {
+	payload := &bytes.Buffer{}
+	writer := multipart.NewWriter(payload)
+	fields := map[string]string{
+		"nik":        identity.Nik,
+		"passphrase": identity.Passphrase,
+		"tampilan":   "invisible",
+	}
+	if s.Visible {
+		fields["tampilan"] = "visible"
+		fields["tag_koordinat"] = s.Tag
+		fields["width"] = strconv.Itoa(s.Width)
+		fields["height"] = strconv.Itoa(s.Height)
+		fields["image"] = strconv.FormatBool(s.ImagePath != "")
+	}
+	for key, value := range fields {
+		err = writer.WriteField(key, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	part, err := createFilePart(writer, "file", "document.pdf", "application/pdf")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(part, document)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Visible && s.ImagePath != "" {
+		err = s.writeImage(writer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.Url, payload)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(s.Username, s.Password)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if res.StatusCode == http.StatusOK && contentType == "application/pdf" {
+		return body, nil
+	}
+
+	bsreErr := &bsreError{}
+	if json.Unmarshal(body, bsreErr) == nil && bsreErr.Error != "" {
+		return nil, fmt.Errorf("%w: %s (%d)", ErrSignRejected, bsreErr.Error, res.StatusCode)
+	}
+	return nil, fmt.Errorf("unexpected response from signing service, status %d, content type %s", res.StatusCode, contentType)
+}
+
+// writeImage adds the signature image to the form.
+func (s *BsreSigner) writeImage(writer *multipart.Writer) (err error) {
+	f, err := os.Open(s.ImagePath)
+	if err != nil {
+		return fmt.Errorf("cannot open signature image: %w", err)
+	}
+	defer f.Close()
+
+	part, err := createFilePart(writer, "imageTTD", filepath.Base(s.ImagePath), "image/png")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, f)
+	return err
+}
+
+// createFilePart creates a form file part with a content type, unlike multipart.Writer CreateFormFile which always
+// uses application/octet-stream.
+func createFilePart(writer *multipart.Writer, fieldName, filename, contentType string) (io.Writer, error) {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, fieldName, filename))
+	header.Set("Content-Type", contentType)
+	return writer.CreatePart(header)
+}
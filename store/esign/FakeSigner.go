@@ -0,0 +1,59 @@
+package esign
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// FakeSignatureMarker is appended by FakeSigner to every signed document. PDF readers ignore it because it is a
+// comment, but it allows tests to tell signed documents apart.
+const FakeSignatureMarker = "\n%FakeSigner signature\n"
+
+// FakeSigner implements the Signer interface without contacting any signing service, it is meant for tests and
+// local development. Signed documents are the original documents with FakeSignatureMarker appended.
+type FakeSigner struct {
+	// Err is returned by SignPdfCtx if it is not nil.
+	Err error
+	// Passphrase, if not empty, is the only passphrase accepted, other passphrases are rejected with ErrSignRejected.
+	Passphrase string
+
+	mutex    sync.Mutex
+	count    int
+	identity *Identity
+}
+
+func (f *FakeSigner) SignPdfCtx(_ context.Context, identity *Identity, document io.Reader) (signed []byte, err error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	if f.Passphrase != "" && identity.Passphrase != f.Passphrase {
+		return nil, ErrSignRejected
+	}
+
+	signed, err = io.ReadAll(document)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mutex.Lock()
+	f.count++
+	f.identity = identity
+	f.mutex.Unlock()
+	return append(signed, FakeSignatureMarker...), nil
+}
+
+// Count returns the number of documents signed successfully.
+func (f *FakeSigner) Count() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.count
+}
+
+// LastIdentity returns the identity of the last document signed successfully, nil if none has been signed.
+func (f *FakeSigner) LastIdentity() *Identity {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.identity
+}
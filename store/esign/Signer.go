@@ -0,0 +1,28 @@
+// Package esign holds the electronic signature (TTE, tanda tangan elektronik) clients used to sign generated letters.
+// All functions in this package does not support error code implemented by the standard ec and errnum package.
+package esign
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrSignRejected is returned if the signing service refuses to sign the document, e.g. because of a wrong NIK or
+// passphrase, as opposed to the service being unreachable.
+var ErrSignRejected = errors.New("signing service rejected the document")
+
+// Identity identifies the person signing a document in the signing service.
+type Identity struct {
+	// Nik is the NIK (national identity number) of the signer.
+	Nik string
+	// Passphrase is the passphrase of the signer certificate. It is supplied by the signer for every document and must
+	// not be stored.
+	Passphrase string
+}
+
+// Signer signs PDF documents electronically.
+type Signer interface {
+	// SignPdfCtx signs a PDF document read from document as identity and returns the signed PDF document.
+	SignPdfCtx(ctx context.Context, identity *Identity, document io.Reader) (signed []byte, err error)
+}
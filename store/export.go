@@ -0,0 +1,111 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/export"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+)
+
+// TimeoutExport is longer than the default timeout as an export streams every matching admission.
+const TimeoutExport = 5 * time.Minute
+
+// exportBatchSize is the number of admissions whose names are resolved at once while exporting.
+const exportBatchSize = 500
+
+// exportTimeFormat is the format of timestamps in exported tables. Dates are already formatted as YYYY-MM-DD.
+const exportTimeFormat = "2006-01-02 15:04"
+
+// exportResponseWriter sets the headers of an exported file once the first bytes are written, so that an error
+// happening before any row is written can still be returned as a normal error response.
+type exportResponseWriter struct {
+	writer      http.ResponseWriter
+	filename    string
+	contentType string
+	started     bool
+}
+
+func (e *exportResponseWriter) Write(p []byte) (n int, err error) {
+	if !e.started {
+		e.started = true
+		e.writer.Header().Set("Content-Type", e.contentType)
+		e.writer.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", e.filename))
+		e.writer.WriteHeader(http.StatusOK)
+	}
+	return e.writer.Write(p)
+}
+
+// httpExport is an export.Writer streaming a table as the response of an export request.
+type httpExport struct {
+	export.Writer
+	response *exportResponseWriter
+}
+
+// newHttpExport creates an httpExport of the given format, defaults to xlsx. name is the base filename of the
+// exported file, without extension, and the sheet name. If the format is not supported, it returns
+// errnum.ErrExportFormatInvalid.
+func (c *Client) newHttpExport(writer http.ResponseWriter, format string, name string) (table *httpExport, err error) {
+	if format == "" {
+		format = export.FormatXlsx
+	}
+
+	contentType, ok := export.ContentTypes[format]
+	if !ok {
+		return nil, ErrExportFormatInvalid
+	}
+
+	response := &exportResponseWriter{
+		writer:      writer,
+		filename:    fmt.Sprintf("%s-%s.%s", name, time.Now().Format("20060102-150405"), format),
+		contentType: contentType,
+	}
+	exportWriter, err := export.NewWriter(response, format, name)
+	if err != nil {
+		return nil, ec.NewError(ErrCodeExportFormatInvalid, Errs[ErrCodeExportFormatInvalid], err)
+	}
+
+	return &httpExport{Writer: exportWriter, response: response}, nil
+}
+
+// finishHttpExport finishes the exported file, or writes err as the response if nothing has been sent yet.
+// Once the file is partially sent, errors can only be logged, the client receives a truncated file.
+func (c *Client) finishHttpExport(writer http.ResponseWriter, table *httpExport, err error) {
+	if err == nil {
+		err = table.Close()
+		if err == nil {
+			return
+		}
+	}
+
+	if !table.response.started {
+		c.httpError(writer, err)
+		return
+	}
+
+	var w *ec.Error
+	if !errors.As(err, &w) {
+		w = ec.Wrap(err)
+	}
+	c.Logger.Warnf("export %s is aborted: %v", table.response.filename, w)
+}
+
+// exportName returns the name of a status or a type, or its number if it has no name.
+func exportName(names map[int]string, value int) string {
+	if name, ok := names[value]; ok {
+		return name
+	}
+	return fmt.Sprint(value)
+}
+
+// exportEpochTime formats a timestamp for an exported table, empty if it is not set.
+func exportEpochTime(t models.EpochTime) string {
+	if time.Time(t).IsZero() || time.Time(t).Unix() <= 0 {
+		return ""
+	}
+	return time.Time(t).Format(exportTimeFormat)
+}
@@ -238,10 +238,10 @@ type PromotionLetterTemplate struct {
 	SignedDate            string `json:"tanggal_ttd"`
 }
 
-// generatePromotionLetterCtx generates promotion letter and store it in object storage with filename as key.
+// generatePromotionLetterCtx generates promotion letter and stores it with putFunc with filename as key.
 // The generated file is a pdf, so filename should have a .pdf extension, although this is not mandatory. Content-Type
 // is automatically set to "application/pdf".
-func (c *Client) generatePromotionLetterCtx(ctx context.Context, filename string, data *PromotionLetterTemplate) (err error) {
+func (c *Client) generatePromotionLetterCtx(ctx context.Context, filename string, data *PromotionLetterTemplate, putFunc func(ctx context.Context, filename string, contentType string, file io.ReadSeeker) (err error)) (err error) {
 	localTemplatePath := path.Join(os.TempDir(), uuid.NewString())
 	err = c.loadPromotionTemplate(ctx, TemplateFilenamePromotionLetter, localTemplatePath)
 	if err != nil {
@@ -249,7 +249,7 @@ func (c *Client) generatePromotionLetterCtx(ctx context.Context, filename string
 	}
 	defer os.Remove(localTemplatePath) // Delete template after rendering, load template again later, on and on, because template can be changed on runtime anytime.
 
-	return c.renderDocxTemplateCtx(ctx, localTemplatePath, filename, data, c.PromotionStorage.PutPromotionFile)
+	return c.renderDocxTemplateCtx(ctx, localTemplatePath, filename, data, putFunc)
 }
 
 type DismissalAcceptanceTemplate struct {
@@ -266,10 +266,10 @@ type DismissalAcceptanceTemplate struct {
 	OrganizationUnit string `json:"unor"`
 }
 
-// generateDismissalAcceptanceLetterCtx generates dismissal acceptance letter and store it in object storage with filename as key.
+// generateDismissalAcceptanceLetterCtx generates dismissal acceptance letter and stores it with putFunc with filename as key.
 // The generated file is a pdf, so filename should have a .pdf extension, although this is not mandatory. Content-Type
 // is automatically set to "application/pdf".
-func (c *Client) generateDismissalAcceptanceLetterCtx(ctx context.Context, filename string, data *DismissalAcceptanceTemplate) (err error) {
+func (c *Client) generateDismissalAcceptanceLetterCtx(ctx context.Context, filename string, data *DismissalAcceptanceTemplate, putFunc func(ctx context.Context, filename string, contentType string, file io.ReadSeeker) (err error)) (err error) {
 	localTemplatePath := path.Join(os.TempDir(), uuid.NewString())
 	err = c.loadDismissalTemplate(ctx, TemplateFilenameDismissalAcceptanceLetter, localTemplatePath)
 	if err != nil {
@@ -277,5 +277,5 @@ func (c *Client) generateDismissalAcceptanceLetterCtx(ctx context.Context, filen
 	}
 	defer os.Remove(localTemplatePath) // Delete template after rendering, load template again later, on and on, because template can be changed on runtime anytime.
 
-	return c.renderDocxTemplateCtx(ctx, localTemplatePath, filename, data, c.DismissalStorage.PutDismissalFile)
+	return c.renderDocxTemplateCtx(ctx, localTemplatePath, filename, data, putFunc)
 }
@@ -0,0 +1,598 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/metricutil"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/search"
+	"github.com/fazrithe/siasn-jf-backend-git/store/esign"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+	"github.com/fazrithe/siasn-jf-backend-git/store/notify"
+	"github.com/google/uuid"
+)
+
+// Kinds of document generation jobs.
+const (
+	JobKindActivityCertificate       = "activity-certificate"
+	JobKindPromotionLetter           = "promotion-letter"
+	JobKindDismissalAcceptanceLetter = "dismissal-acceptance-letter"
+)
+
+// TimeoutJob is the timeout of running a single document generation job, including rendering and signing the
+// document.
+const TimeoutJob = 5 * time.Minute
+
+// jobHandlers run a claimed job of each kind and return the base filename of the generated document.
+var jobHandlers = map[string]func(c *Client, ctx context.Context, job *queuedJob) (filename string, err error){
+	JobKindActivityCertificate:       (*Client).runActivityCertificateJobCtx,
+	JobKindPromotionLetter:           (*Client).runPromotionLetterJobCtx,
+	JobKindDismissalAcceptanceLetter: (*Client).runDismissalAcceptanceLetterJobCtx,
+}
+
+// queuedJob is a job claimed by a worker, with everything its handler needs.
+type queuedJob struct {
+	JobId       string
+	Kind        string
+	Module      string
+	EntityId    string
+	Payload     []byte
+	Attempts    int
+	MaxAttempts int
+	// AsnId is the user who queued the job.
+	AsnId string
+	// Identity is the signing identity of the user, nil if the job does not sign its document or the identity is
+	// no longer available.
+	Identity *esign.Identity
+}
+
+// jobIdentity is a signing identity kept in memory until its job is done.
+type jobIdentity struct {
+	identity  *esign.Identity
+	expiresAt time.Time
+}
+
+// JobRunner holds the settings and the in-memory state of the document generation job workers.
+//
+// Jobs are stored in the pekerjaan table so that any instance can run them, except jobs that sign their document:
+// signing passphrases are never stored, they are kept in the memory of the instance that queued the job, and only
+// that instance can run such jobs. They fail if the passphrase is not used within IdentityTtl.
+type JobRunner struct {
+	// InstanceId identifies this instance as the owner of the jobs holding a signing identity.
+	InstanceId string
+	// Workers is the number of jobs run concurrently by RunJobWorkers.
+	Workers int
+	// MaxAttempts is the number of times a job is run before it is failed.
+	MaxAttempts int
+	// PollInterval is how often idle workers look for new jobs queued by other instances.
+	PollInterval time.Duration
+	// Backoff is the delay before the first retry, doubled on every retry up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Lease is how long a running job is reserved for its worker. A job still running after its lease, e.g. because
+	// its instance has stopped, is run again. It must be longer than TimeoutJob.
+	Lease time.Duration
+	// IdentityTtl is how long a signing identity is kept for its job.
+	IdentityTtl time.Duration
+
+	mutex      sync.Mutex
+	identities map[string]*jobIdentity
+	wake       chan struct{}
+}
+
+// NewJobRunner creates a JobRunner with a random InstanceId and the default settings.
+func NewJobRunner() *JobRunner {
+	return &JobRunner{
+		InstanceId:   uuid.NewString(),
+		Workers:      2,
+		MaxAttempts:  3,
+		PollInterval: 5 * time.Second,
+		Backoff:      10 * time.Second,
+		MaxBackoff:   5 * time.Minute,
+		Lease:        TimeoutJob + time.Minute,
+		IdentityTtl:  15 * time.Minute,
+		identities:   make(map[string]*jobIdentity),
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// backoff returns the delay before running a job again after it has failed attempts times.
+func (r *JobRunner) backoff(attempts int) time.Duration {
+	delay := r.Backoff
+	for i := 1; i < attempts && delay < r.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > r.MaxBackoff {
+		delay = r.MaxBackoff
+	}
+	return delay
+}
+
+func (r *JobRunner) putIdentity(jobId string, identity *esign.Identity) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.identities == nil {
+		r.identities = make(map[string]*jobIdentity)
+	}
+	r.identities[jobId] = &jobIdentity{identity: identity, expiresAt: time.Now().Add(r.IdentityTtl)}
+}
+
+// getIdentity returns the identity of a job, nil if it is not kept or has expired.
+func (r *JobRunner) getIdentity(jobId string) *esign.Identity {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	ji, ok := r.identities[jobId]
+	if !ok || time.Now().After(ji.expiresAt) {
+		return nil
+	}
+	return ji.identity
+}
+
+func (r *JobRunner) deleteIdentity(jobId string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.identities, jobId)
+}
+
+// deleteExpiredIdentities forgets the identities whose jobs have not been run in time.
+func (r *JobRunner) deleteExpiredIdentities() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	now := time.Now()
+	for jobId, ji := range r.identities {
+		if now.After(ji.expiresAt) {
+			delete(r.identities, jobId)
+		}
+	}
+}
+
+// wakeUp tells an idle worker that a job has been queued, without waiting for the poll interval.
+func (r *JobRunner) wakeUp() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// enqueueJobCtx queues a document generation job of kind for an admission, requested by asnId. payload is marshalled
+// to JSON and passed to the job handler. identity is kept in memory if the job signs its document, see JobRunner.
+//
+// A job without identity that is identical to a pending or running job of the same user is not queued again, the
+// existing job is returned instead.
+// This method already returns an error in form of error code.
+func (c *Client) enqueueJobCtx(ctx context.Context, kind, module, entityId string, payload interface{}, asnId string, identity *esign.Identity) (job *models.Job, err error) {
+	if c.Jobs == nil {
+		return nil, ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], errors.New("no job runner is configured"))
+	}
+
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	payloadJson, err := json.Marshal(payload)
+	if err != nil {
+		return nil, ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("cannot marshal job payload: %w", err))
+	}
+
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+	if identity == nil {
+		job, err = scanJob(mdb.QueryRowContext(
+			ctx,
+			"select pekerjaan_id, jenis, modul, entitas_id, status, percobaan, coalesce(hasil, ''), coalesce(pesan_error, ''), created_at_ts, modified_at_ts from pekerjaan where jenis = $1 and entitas_id = $2 and payload = $3::jsonb and user_id = $4 and status in ('pending', 'running') limit 1",
+			kind,
+			entityId,
+			string(payloadJson),
+			asnId,
+		))
+		if err == nil {
+			return job, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot query pekerjaan: %w", err))
+		}
+	}
+
+	job = &models.Job{
+		JobId:    uuid.NewString(),
+		Kind:     kind,
+		Module:   module,
+		EntityId: entityId,
+		Status:   models.JobStatusPending,
+	}
+
+	owner := sql.NullString{}
+	if identity != nil {
+		owner = sql.NullString{Valid: true, String: c.Jobs.InstanceId}
+		// The identity must be kept before the job is visible to the workers.
+		c.Jobs.putIdentity(job.JobId, identity)
+	}
+
+	createdAt := time.Time{}
+	err = mdb.QueryRowContext(
+		ctx,
+		"insert into pekerjaan(pekerjaan_id, jenis, modul, entitas_id, payload, maks_percobaan, pemilik, user_id) values($1, $2, $3, $4, $5::jsonb, $6, $7, $8) returning created_at_ts",
+		job.JobId,
+		kind,
+		module,
+		entityId,
+		string(payloadJson),
+		c.Jobs.MaxAttempts,
+		owner,
+		asnId,
+	).Scan(&createdAt)
+	if err != nil {
+		c.Jobs.deleteIdentity(job.JobId)
+		return nil, ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("cannot insert entry to pekerjaan: %w", err))
+	}
+	job.CreatedAt = models.EpochTime(createdAt)
+	job.ModifiedAt = models.EpochTime(createdAt)
+
+	c.Jobs.wakeUp()
+	return job, nil
+}
+
+// scanJob scans a job selected with the columns used by enqueueJobCtx. It returns the error of row as is.
+func scanJob(row *sql.Row) (job *models.Job, err error) {
+	job = &models.Job{}
+	createdAt := time.Time{}
+	modifiedAt := time.Time{}
+	err = row.Scan(
+		&job.JobId,
+		&job.Kind,
+		&job.Module,
+		&job.EntityId,
+		&job.Status,
+		&job.Attempts,
+		&job.Filename,
+		&job.Error,
+		&createdAt,
+		&modifiedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	job.CreatedAt = models.EpochTime(createdAt)
+	job.ModifiedAt = models.EpochTime(modifiedAt)
+	return job, nil
+}
+
+// GetJobCtx returns a job queued by asnId. Jobs of other users are treated as not found.
+// This method already returns an error in form of error code.
+func (c *Client) GetJobCtx(ctx context.Context, jobId, asnId string) (job *models.Job, err error) {
+	_, err = uuid.Parse(jobId)
+	if err != nil {
+		return nil, ec.NewError(ErrCodeUuidInvalid, Errs[ErrCodeUuidInvalid], err)
+	}
+
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+	job, err = scanJob(mdb.QueryRowContext(
+		ctx,
+		"select pekerjaan_id, jenis, modul, entitas_id, status, percobaan, coalesce(hasil, ''), coalesce(pesan_error, ''), created_at_ts, modified_at_ts from pekerjaan where pekerjaan_id = $1 and user_id = $2",
+		jobId,
+		asnId,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrEntryNotFound
+		}
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot query pekerjaan: %w", err))
+	}
+
+	return job, nil
+}
+
+// SearchJobsCtx lists the jobs queued by asnId, newest first. status filters the jobs by status, empty lists all jobs.
+// This method already returns an error in form of error code.
+func (c *Client) SearchJobsCtx(ctx context.Context, asnId, status string, pageNumber, countPerPage int) (result *search.PaginatedList[*models.Job], err error) {
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+	rows, err := mdb.QueryContext(
+		ctx,
+		"select pekerjaan_id, jenis, modul, entitas_id, status, percobaan, coalesce(hasil, ''), coalesce(pesan_error, ''), created_at_ts, modified_at_ts from pekerjaan where user_id = $1 and ($2 = '' or status = $2) order by created_at_ts desc, pekerjaan_id limit $3 offset $4",
+		asnId,
+		status,
+		countPerPage+1,
+		(pageNumber-1)*countPerPage,
+	)
+	if err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot query pekerjaan: %w", err))
+	}
+	defer rows.Close()
+
+	jobs := make([]*models.Job, 0)
+	for rows.Next() {
+		job := &models.Job{}
+		createdAt := time.Time{}
+		modifiedAt := time.Time{}
+		err = rows.Scan(
+			&job.JobId,
+			&job.Kind,
+			&job.Module,
+			&job.EntityId,
+			&job.Status,
+			&job.Attempts,
+			&job.Filename,
+			&job.Error,
+			&createdAt,
+			&modifiedAt,
+		)
+		if err != nil {
+			return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot scan pekerjaan: %w", err))
+		}
+		job.CreatedAt = models.EpochTime(createdAt)
+		job.ModifiedAt = models.EpochTime(modifiedAt)
+		jobs = append(jobs, job)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot query pekerjaan: %w", err))
+	}
+
+	hasNext := false
+	if len(jobs) > countPerPage {
+		hasNext = true
+		jobs = jobs[:countPerPage]
+	}
+
+	return &search.PaginatedList[*models.Job]{
+		Data:     jobs,
+		Metadata: search.CreatePaginatedListMetadataNoTotalNext(pageNumber, len(jobs), hasNext),
+	}, nil
+}
+
+// RunNextJobCtx claims the next due job and runs it. ran is false if there is no job to run.
+//
+// A job whose attempt fails is run again after a backoff, unless the failure is permanent, e.g. the user is not
+// allowed to generate the document or the signing service rejects the passphrase, or the job has run out of
+// attempts, in which case it is failed. The requester of the job is notified when it is done or failed.
+// This method already returns an error in form of error code. The error of the job itself is not returned, it is
+// saved in the job.
+func (c *Client) RunNextJobCtx(ctx context.Context) (ran bool, err error) {
+	if c.Jobs == nil {
+		return false, ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], errors.New("no job runner is configured"))
+	}
+
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+	job := &queuedJob{}
+	err = mdb.QueryRowContext(
+		ctx,
+		"update pekerjaan set status = 'running', percobaan = percobaan + 1, sewa_berakhir_ts = current_timestamp + $2::float8 * interval '1 second', modified_at_ts = current_timestamp where pekerjaan_id = (select pekerjaan_id from pekerjaan where ((status = 'pending' and jadwal_ts <= current_timestamp) or (status = 'running' and sewa_berakhir_ts <= current_timestamp and percobaan < maks_percobaan)) and (pemilik is null or pemilik = $1) order by jadwal_ts limit 1 for update skip locked) returning pekerjaan_id, jenis, modul, entitas_id, payload, percobaan, maks_percobaan, user_id",
+		c.Jobs.InstanceId,
+		c.Jobs.Lease.Seconds(),
+	).Scan(
+		&job.JobId,
+		&job.Kind,
+		&job.Module,
+		&job.EntityId,
+		&job.Payload,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.AsnId,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot claim pekerjaan: %w", err))
+	}
+	job.Identity = c.Jobs.getIdentity(job.JobId)
+
+	filename, jobErr := c.runJob(job)
+	if jobErr == nil {
+		_, err = mdb.ExecContext(
+			ctx,
+			"update pekerjaan set status = 'done', hasil = $2, pesan_error = null, sewa_berakhir_ts = null, modified_at_ts = current_timestamp where pekerjaan_id = $1",
+			job.JobId,
+			filename,
+		)
+		if err != nil {
+			return true, ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("cannot update pekerjaan: %w", err))
+		}
+		c.Jobs.deleteIdentity(job.JobId)
+		c.notifyJob(job.Module, job.EntityId, job.AsnId, notify.EventDocumentReady, "")
+		return true, nil
+	}
+
+	c.Logger.Warnf("job %s %s of %s %s failed on attempt %d: %v", job.Kind, job.JobId, job.Module, job.EntityId, job.Attempts, jobErr)
+	message := jobErrorMessage(jobErr)
+	if !isPermanentJobError(jobErr) && job.Attempts < job.MaxAttempts {
+		_, err = mdb.ExecContext(
+			ctx,
+			"update pekerjaan set status = 'pending', jadwal_ts = current_timestamp + $2::float8 * interval '1 second', pesan_error = $3, sewa_berakhir_ts = null, modified_at_ts = current_timestamp where pekerjaan_id = $1",
+			job.JobId,
+			c.Jobs.backoff(job.Attempts).Seconds(),
+			message,
+		)
+		if err != nil {
+			return true, ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("cannot update pekerjaan: %w", err))
+		}
+		return true, nil
+	}
+
+	_, err = mdb.ExecContext(
+		ctx,
+		"update pekerjaan set status = 'failed', pesan_error = $2, sewa_berakhir_ts = null, modified_at_ts = current_timestamp where pekerjaan_id = $1",
+		job.JobId,
+		message,
+	)
+	if err != nil {
+		return true, ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("cannot update pekerjaan: %w", err))
+	}
+	c.Jobs.deleteIdentity(job.JobId)
+	c.notifyJob(job.Module, job.EntityId, job.AsnId, notify.EventDocumentFailed, message)
+	return true, nil
+}
+
+// runJob runs a claimed job with its handler. The job gets its own timeout, so that stopping the workers does not
+// interrupt a job halfway.
+func (c *Client) runJob(job *queuedJob) (filename string, err error) {
+	handler, ok := jobHandlers[job.Kind]
+	if !ok {
+		return "", ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("unknown job kind %s", job.Kind))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutJob)
+	defer cancel()
+
+	return handler(c, ctx, job)
+}
+
+// isPermanentJobError checks whether a failed job will fail again if it is retried, e.g. the admission is no longer
+// in the right status or the signing service rejects the passphrase.
+func isPermanentJobError(err error) bool {
+	if errors.Is(err, esign.ErrSignRejected) {
+		return true
+	}
+
+	var w *ec.Error
+	if !errors.As(err, &w) {
+		return false
+	}
+	status, ok := ErrsToHttp[w.Code]
+	return ok && status < 500
+}
+
+// jobErrorMessage returns the error shown to the requester of a failed job. Causes are not shown since they may
+// contain internal details, except for a rejected signature so that the requester knows to check their passphrase.
+func jobErrorMessage(err error) string {
+	var w *ec.Error
+	if !errors.As(err, &w) {
+		return Errs[ErrCodeDocumentGenerate]
+	}
+	if errors.Is(err, esign.ErrSignRejected) {
+		return fmt.Sprintf("%s: %s", w.Message, esign.ErrSignRejected.Error())
+	}
+	return w.Message
+}
+
+// expireJobsCtx fails the jobs that can no longer run: jobs holding a signing identity that have not been run within
+// IdentityTtl, and running jobs whose lease has passed on their last attempt. Their requesters are notified.
+// This method already returns an error in form of error code.
+func (c *Client) expireJobsCtx(ctx context.Context) (err error) {
+	c.Jobs.deleteExpiredIdentities()
+
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+	rows, err := mdb.QueryContext(
+		ctx,
+		"update pekerjaan set status = 'failed', pesan_error = case when status = 'pending' then $2 else $3 end, sewa_berakhir_ts = null, modified_at_ts = current_timestamp where (status = 'pending' and pemilik is not null and created_at_ts <= current_timestamp - $1::float8 * interval '1 second') or (status = 'running' and sewa_berakhir_ts <= current_timestamp and percobaan >= maks_percobaan) returning pekerjaan_id, modul, entitas_id, user_id, pesan_error",
+		c.Jobs.IdentityTtl.Seconds(),
+		ErrJobIdentityExpired.Message,
+		Errs[ErrCodeDocumentGenerate],
+	)
+	if err != nil {
+		return ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("cannot expire pekerjaan: %w", err))
+	}
+	defer rows.Close()
+
+	type expiredJob struct {
+		jobId, module, entityId, asnId, message string
+	}
+	expired := make([]*expiredJob, 0)
+	for rows.Next() {
+		job := &expiredJob{}
+		err = rows.Scan(&job.jobId, &job.module, &job.entityId, &job.asnId, &job.message)
+		if err != nil {
+			return ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("cannot scan pekerjaan: %w", err))
+		}
+		expired = append(expired, job)
+	}
+	if err = rows.Err(); err != nil {
+		return ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("cannot expire pekerjaan: %w", err))
+	}
+
+	for _, job := range expired {
+		c.Jobs.deleteIdentity(job.jobId)
+		c.notifyJob(job.module, job.entityId, job.asnId, notify.EventDocumentFailed, job.message)
+	}
+
+	return nil
+}
+
+// notifyJob notifies the requester of a job that it is done or failed. It does nothing if c.Notifier is nil.
+// Errors are only logged.
+func (c *Client) notifyJob(module, entityId, asnId, kind, reason string) {
+	if c.Notifier == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutNotify)
+	defer cancel()
+
+	recipients, err := c.getRecipientsCtx(ctx, []string{asnId})
+	if err != nil {
+		c.Logger.Warnf("cannot get notification recipients of %s %s: %v", module, entityId, err)
+		return
+	}
+	if len(recipients) == 0 {
+		return
+	}
+
+	err = c.Notifier.Notify(&notify.Event{
+		Kind:       kind,
+		Module:     module,
+		EntityId:   entityId,
+		Reason:     reason,
+		ModifiedAt: time.Now(),
+	}, recipients)
+	if err != nil {
+		c.Logger.Warnf("cannot notify %s %s %s: %v", module, entityId, kind, err)
+	}
+}
+
+// RunJobWorkers runs c.Jobs.Workers workers that run the queued jobs until ctx is done. Idle workers look for jobs
+// every PollInterval, or as soon as this instance queues a job. Expired jobs are failed every PollInterval too.
+// It blocks until ctx is done and every worker has finished its job.
+func (c *Client) RunJobWorkers(ctx context.Context) {
+	if c.Jobs == nil {
+		return
+	}
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < c.Jobs.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.runJobWorker(ctx)
+		}()
+	}
+
+	ticker := time.NewTicker(c.Jobs.PollInterval)
+	defer ticker.Stop()
+	for done := false; !done; {
+		select {
+		case <-ctx.Done():
+			done = true
+		case <-ticker.C:
+			err := c.expireJobsCtx(ctx)
+			if err != nil {
+				c.Logger.Warnf("cannot expire jobs: %v", err)
+			}
+		}
+	}
+
+	wg.Wait()
+}
+
+// runJobWorker runs jobs until there is none left, then waits for a new one.
+func (c *Client) runJobWorker(ctx context.Context) {
+	for {
+		ran, err := c.RunNextJobCtx(ctx)
+		if err != nil {
+			c.Logger.Warnf("cannot run job: %v", err)
+		}
+		if ran {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.Jobs.wake:
+		case <-time.After(c.Jobs.PollInterval):
+		}
+	}
+}
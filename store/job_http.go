@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/httputil"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+)
+
+const (
+	TimeoutJobGet  = TimeoutDefault
+	TimeoutJobList = TimeoutDefault
+)
+
+// HandleJobGet handles a request to poll the status of a document generation job queued by the user.
+// Once the job is done, the document can be downloaded from the download endpoint of its module.
+func (c *Client) HandleJobGet(writer http.ResponseWriter, request *http.Request) {
+	user := auth.AssertReqGetUserDetail(request)
+
+	s := &models.JobGetRequest{}
+	err := c.decodeRequestSchema(writer, request, s)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutJobGet)
+	defer cancel()
+
+	job, err := c.GetJobCtx(ctx, s.JobId, user.AsnId)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, job)
+}
+
+// HandleJobList handles a request to list the document generation jobs queued by the user, newest first.
+func (c *Client) HandleJobList(writer http.ResponseWriter, request *http.Request) {
+	user := auth.AssertReqGetUserDetail(request)
+
+	s := &models.JobSearchRequest{}
+	err := c.decodeRequestSchema(writer, request, s)
+	if err != nil {
+		return
+	}
+
+	countPerPage := 10
+	if s.CountPerPage != 0 {
+		countPerPage = s.CountPerPage
+	}
+
+	pageNumber := 1
+	if s.PageNumber != 0 {
+		pageNumber = s.PageNumber
+	}
+
+	err = c.httpErrorVerifyListMeta(writer, pageNumber, countPerPage)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutJobList)
+	defer cancel()
+
+	jobs, err := c.SearchJobsCtx(ctx, user.AsnId, s.Status, pageNumber, countPerPage)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, jobs)
+}
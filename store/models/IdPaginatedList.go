@@ -39,6 +39,9 @@ type rawIdPaginatedListMetadata struct {
 
 	// False to indicate that there is no next page.
 	HasNext bool `json:"halaman_berikutnya"`
+
+	// The cursor of the next page, only set when the list is paginated with cursors.
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 func (i IdPaginatedListMetadata) MarshalJSON() ([]byte, error) {
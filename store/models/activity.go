@@ -21,6 +21,15 @@ var ActivityAdmissionStatuses = map[int]struct{}{
 	ActivityAdmissionStatusRejected:      {},
 }
 
+// ActivityAdmissionStatusNames are the human-readable names of activity admission statuses, e.g. for reports.
+var ActivityAdmissionStatusNames = map[int]string{
+	ActivityAdmissionStatusCreated:       "Diusulkan",
+	ActivityAdmissionStatusAccepted:      "Diterima",
+	ActivityAdmissionStatusCertRequest:   "Pengajuan Sertifikat",
+	ActivityAdmissionStatusCertPublished: "Sertifikat Terbit",
+	ActivityAdmissionStatusRejected:      "Ditolak",
+}
+
 const (
 	// Deprecated: no longer used.
 	ActivityTypeWorkshop = iota + 1
@@ -81,22 +90,22 @@ func init() {
 // ActivityAdmission represents a single activity admission request.
 type ActivityAdmission struct {
 	ActivityId  string `json:"kegiatan_id"`
-	Name        string `json:"nama"`
+	Name        string `json:"nama" validate:"required"`
 	Status      int    `json:"status"`
-	Type        int    `json:"jenis"`
+	Type        int    `json:"jenis" validate:"required,enum=activity_type"`
 	Description string `json:"deskripsi"`
 	// AdmissionTimestamp the time of the admission, usually, current time.
 	AdmissionTimestamp EpochTime   `json:"waktu_pengajuan"`
-	StartDate          Iso8601Date `json:"tgl_mulai"`
-	EndDate            Iso8601Date `json:"tgl_selesai"`
-	PositionGrade      string      `json:"jabatan_jenjang"`
+	StartDate          Iso8601Date `json:"tgl_mulai" validate:"required,iso_date"`
+	EndDate            Iso8601Date `json:"tgl_selesai" validate:"required,iso_date"`
+	PositionGrade      string      `json:"jabatan_jenjang" validate:"required"`
 	// AgencyId (instansi ID) should be retrieved from ID token.
 	AgencyId     string `json:"-"`
 	Extra        string `json:"data_tambahan"`
-	TrainingYear int    `json:"tahun_diklat"`
+	TrainingYear int    `json:"tahun_diklat" validate:"required,min=1970"`
 	// Duration, in hour.
-	Duration        int    `json:"durasi"`
-	AdmissionNumber string `json:"no_usulan"`
+	Duration        int    `json:"durasi" validate:"min=0"`
+	AdmissionNumber string `json:"no_usulan" validate:"required"`
 	OrganizerAgency string `json:"instansi_penyelenggara"`
 
 	// TempSupportDocuments contains a list of UUIDs previously generated by us.
@@ -106,7 +115,7 @@ type ActivityAdmission struct {
 	TempSupportDocuments []*Document `json:"temp_dokumen_pendukung,omitempty"`
 
 	// Attendees contains a list of ASN ID that will attend the event/activity.
-	Attendees []string `json:"peserta_user_id,omitempty"`
+	Attendees []string `json:"peserta_user_id,omitempty" validate:"required"`
 
 	// SubmitterAsnId is the ASN ID of the submitter (the user), can be retrieved from ID token.
 	SubmitterAsnId string `json:"-"`
@@ -143,7 +152,7 @@ var ActivityCertTypes = map[int]struct{}{
 
 // ActivityCertGenRequest holds all the data required for pembina JF to issue a certificate.
 type ActivityCertGenRequest struct {
-	ActivityId     string `json:"kegiatan_id"`
+	ActivityId     string `json:"kegiatan_id" validate:"required,uuid"`
 	SubmitterAsnId string `json:"-"`
 	// AgencyId should be retrieved from ID token to prevent users from changing other activities.
 	AgencyId         string                 `json:"-"`
@@ -168,13 +177,13 @@ type ActivityAttendeeCsr struct {
 type ActivitySigning struct {
 	JabtanInstansiPengusul           string `json:"jabatan_instansi_pengusul"`
 	NamaPejabatInstansiPengusul      string `json:"nama_pejabat_instansi_pengusul"`
-	NipPejabatInstansiPnegusul       string `json:"nip_pejabat_instansi_pengusul"`
+	NipPejabatInstansiPnegusul       string `json:"nip_pejabat_instansi_pengusul" validate:"nip"`
 	JabatanInstansiPenyelenggara     string `json:"jabatan_instansi_penyelenggara"`
 	NamaPejabatInstansiPenyelenggara string `json:"nama_pejabat_instansi_penyelenggara"`
-	NipPejabatInstansiPenyelanggara  string `json:"nip_pejabat_instansi_penyelenggara"`
+	NipPejabatInstansiPenyelanggara  string `json:"nip_pejabat_instansi_penyelenggara" validate:"nip"`
 	JabatanPemateri                  string `json:"jabatan_pemateri"`
 	NamaPemateri                     string `json:"nama_pemateri"`
-	NipPemateri                      string `json:"nip_pemateri"`
+	NipPemateri                      string `json:"nip_pemateri" validate:"nip"`
 }
 
 // ActivityCertificate represents a single document, can be a certificate or PAK.
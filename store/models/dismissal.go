@@ -12,6 +12,13 @@ var DismissalAdmissionStatuses = map[int]struct{}{
 	DismissalAdmissionStatusRejected: {},
 }
 
+// DismissalAdmissionStatusNames are the human-readable names of dismissal admission statuses, e.g. for reports.
+var DismissalAdmissionStatusNames = map[int]string{
+	DismissalAdmissionStatusCreated:  "Diusulkan",
+	DismissalAdmissionStatusAccepted: "Diterima",
+	DismissalAdmissionStatusRejected: "Ditolak",
+}
+
 type DismissalAdmission struct {
 	DismissalId string    `json:"pemberhentian_id"`
 	AsnId       string    `json:"asn_id"`
@@ -0,0 +1,41 @@
+package models
+
+// Statuses of a document generation job.
+const (
+	JobStatusPending = "pending"
+	JobStatusRunning = "running"
+	JobStatusDone    = "done"
+	JobStatusFailed  = "failed"
+)
+
+// Job is a document generation job. Its status can be polled until it is done or failed.
+type Job struct {
+	JobId string `json:"pekerjaan_id"`
+	// Kind is the kind of document generated, e.g. promotion-letter.
+	Kind string `json:"jenis"`
+	// Module and EntityId are the admission the document belongs to, see the status history modules.
+	Module   string `json:"modul"`
+	EntityId string `json:"entitas_id"`
+	// Status is one of JobStatusPending and others.
+	Status   string `json:"status"`
+	Attempts int    `json:"percobaan"`
+	// Filename is the base filename of the generated document once the job is done.
+	Filename string `json:"filename,omitempty"`
+	// Error is the reason of the last failed attempt.
+	Error      string    `json:"pesan_error,omitempty"`
+	CreatedAt  EpochTime `json:"created_at"`
+	ModifiedAt EpochTime `json:"modified_at"`
+}
+
+// JobGetRequest is the query of the job status polling endpoint.
+type JobGetRequest struct {
+	JobId string `schema:"pekerjaan_id"`
+}
+
+// JobSearchRequest is the query of the job list endpoint.
+type JobSearchRequest struct {
+	// Status is one of JobStatusPending and others, empty lists jobs of any status.
+	Status       string `schema:"status"`
+	PageNumber   int    `schema:"halaman"`
+	CountPerPage int    `schema:"jumlah_per_halaman"`
+}
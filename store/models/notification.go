@@ -0,0 +1,9 @@
+package models
+
+// NotificationPreference is the notification setting of an ASN.
+type NotificationPreference struct {
+	// Email is the address notifications are sent to, taken from the identity provider.
+	Email string `json:"email"`
+	// OptOut stops all notification emails to the ASN.
+	OptOut bool `json:"berhenti_langganan"`
+}
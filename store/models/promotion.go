@@ -12,6 +12,13 @@ var PromotionAdmissionStatuses = map[int]struct{}{
 	PromotionAdmissionStatusRejected: {},
 }
 
+// PromotionAdmissionStatusNames are the human-readable names of promotion admission statuses, e.g. for reports.
+var PromotionAdmissionStatusNames = map[int]string{
+	PromotionAdmissionStatusCreated:  "Diusulkan",
+	PromotionAdmissionStatusAccepted: "Diterima",
+	PromotionAdmissionStatusRejected: "Ditolak",
+}
+
 const (
 	PromotionTypeTransfer = iota + 1
 	PromotionTypePromotion
@@ -24,6 +31,13 @@ var PromotionTypes = map[int]struct{}{
 	PromotionTypeInPassing: {},
 }
 
+// PromotionTypeNames are the human-readable names of promotion types, e.g. for reports.
+var PromotionTypeNames = map[int]string{
+	PromotionTypeTransfer:  "Perpindahan Jabatan",
+	PromotionTypePromotion: "Kenaikan Jenjang",
+	PromotionTypeInPassing: "Penyesuaian (Inpassing)",
+}
+
 const (
 	PromotionCompetencyTestStatusPass = iota + 1
 	PromotionCompetencyTestStatusFail
@@ -36,7 +50,7 @@ var PromotionCompetencyTestStatuses = map[int]struct{}{
 
 type PromotionAdmission struct {
 	AdmissionNumber string      `json:"nomor_usulan"`
-	AdmissionDate   Iso8601Date `json:"tanggal_usulan"`
+	AdmissionDate   Iso8601Date `json:"tanggal_usulan" validate:"iso_date"`
 
 	PromotionId string `json:"pengangkatan_id"`
 	AsnId       string `json:"asn_id"`
@@ -44,7 +58,8 @@ type PromotionAdmission struct {
 	TestStatus int     `json:"test_status"`
 	TestScore  float64 `json:"test_nilai,omitempty"`
 
-	PromotionType       int    `json:"jenis_pengangkatan"`
+	// PromotionType is required when submitting a promotion, but not when accepting it.
+	PromotionType       int    `json:"jenis_pengangkatan" validate:"enum=promotion_type"`
 	PromotionPositionId string `json:"jabatan_fungsional_tujuan_id"`
 
 	PakLetter            *Document `json:"surat_pak,omitempty"`
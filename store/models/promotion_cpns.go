@@ -12,24 +12,32 @@ var PromotionCpnsAdmissionStatuses = map[int]struct{}{
 	PromotionCpnsAdmissionStatusRejected: {},
 }
 
+// PromotionCpnsAdmissionStatusNames are the human-readable names of CPNS promotion admission statuses, e.g. for
+// reports.
+var PromotionCpnsAdmissionStatusNames = map[int]string{
+	PromotionCpnsAdmissionStatusCreated:  "Diusulkan",
+	PromotionCpnsAdmissionStatusAccepted: "Diterima",
+	PromotionCpnsAdmissionStatusRejected: "Ditolak",
+}
+
 type PromotionCpnsAdmission struct {
-	AdmissionNumber string      `json:"nomor_usulan"`
-	AdmissionDate   Iso8601Date `json:"tanggal_usulan"`
+	AdmissionNumber string      `json:"nomor_usulan" validate:"required"`
+	AdmissionDate   Iso8601Date `json:"tanggal_usulan" validate:"required,iso_date"`
 
 	PromotionCpnsId string `json:"pengangkatan_cpns_id"`
-	AsnId           string `json:"asn_id"`
+	AsnId           string `json:"asn_id" validate:"required"`
 	AsnName         string `json:"nama"`
 	AsnNip          string `json:"nip"`
 
 	Status              int    `json:"status"`
-	PromotionPositionId string `json:"jabatan_fungsional_tujuan_id"`
+	PromotionPositionId string `json:"jabatan_fungsional_tujuan_id" validate:"required"`
 	PromotionPosition   string `json:"jabatan_fungsional_tujuan"`
 	FirstCreditNumber   int    `json:"angka_kredit_pertama"`
-	OrganizationUnitId  string `json:"unor_id"`
+	OrganizationUnitId  string `json:"unor_id" validate:"required"`
 	OrganizationUnit    string `json:"unor"`
 
-	PakLetter       *Document `json:"surat_pak,omitempty"`
-	PromotionLetter *Document `json:"surat_pengangkatan,omitempty"`
+	PakLetter       *Document `json:"surat_pak,omitempty" validate:"required"`
+	PromotionLetter *Document `json:"surat_pengangkatan,omitempty" validate:"required"`
 
 	// SubmitterAsnId is the ASN ID of the submitter (the user), can be retrieved from ID token.
 	SubmitterAsnId string `json:"-"`
@@ -18,21 +18,31 @@ var RequirementAdmissionStatuses = map[int]struct{}{
 	RequirementAdmissionStatusAcceptedWithRecommendation: {},
 }
 
+// RequirementAdmissionStatusNames are the human-readable names of requirement admission statuses, e.g. for reports.
+var RequirementAdmissionStatusNames = map[int]string{
+	RequirementAdmissionStatusCreated:                    "Diusulkan",
+	RequirementAdmissionStatusSigned:                     "Ditandatangani",
+	RequirementAdmissionStatusRevision:                   "Perbaikan",
+	RequirementAdmissionStatusAccepted:                   "Diterima",
+	RequirementAdmissionStatusDenied:                     "Ditolak",
+	RequirementAdmissionStatusAcceptedWithRecommendation: "Diterima dengan Rekomendasi",
+}
+
 // RequirementAdmission represents all the data needed to submit a new requirement calculation admission.
 type RequirementAdmission struct {
-	RequirementId string `json:"kebutuhan_id"`
+	RequirementId string `json:"kebutuhan_id" validate:"uuid"`
 	// AdmissionTimestamp the time of the admission, usually, current time.
 	AdmissionTimestamp EpochTime `json:"-"`
-	PositionGrade      string    `json:"jabatan_jenjang"`
+	PositionGrade      string    `json:"jabatan_jenjang" validate:"required"`
 	// AgencyId (instansi ID) should be retrieved from ID token.
 	AgencyId          string              `json:"-"`
-	RequirementCounts []*RequirementCount `json:"jumlah_kebutuhan"`
+	RequirementCounts []*RequirementCount `json:"jumlah_kebutuhan" validate:"required"`
 
 	// A freetext indicating a fiscal year.
-	FiscalYear string `json:"tahun_anggaran"`
+	FiscalYear string `json:"tahun_anggaran" validate:"required"`
 
 	// A generic freetext again.
-	AdmissionNumber string `json:"no_usulan"`
+	AdmissionNumber string `json:"no_usulan" validate:"required"`
 
 	// TempCoverLetter holds the full filename for surat pengantar.
 	// The filename was generated by the backend, and is used to locate the cover letter in the temporary location.
@@ -67,9 +77,9 @@ type RequirementAdmissionResult struct {
 
 // RequirementCount indicates a requirement count, for each unit organisasi.
 type RequirementCount struct {
-	OrganizationUnitId  string `json:"unit_organisasi_id"`
+	OrganizationUnitId  string `json:"unit_organisasi_id" validate:"required"`
 	OrganizationUnit    string `json:"unit_organisasi"`
-	Count               int    `json:"jumlah"`
+	Count               int    `json:"jumlah" validate:"required,min=1"`
 	CountBezetting      int    `json:"jumlah_bezetting,omitempty"`
 	CountRecommendation int    `json:"rekomendasi_jumlah,omitempty"`
 }
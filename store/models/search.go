@@ -0,0 +1,31 @@
+package models
+
+// SearchRequest is the query of the full-text search endpoint.
+type SearchRequest struct {
+	// Query is the text searched, each of its words must match, as a whole word or as the start of a word.
+	Query string `schema:"q"`
+	// Types limits the hits to some types, e.g. activity. Empty searches every type.
+	Types []string `schema:"jenis"`
+	// Count is the maximum number of hits returned.
+	Count int `schema:"jumlah"`
+}
+
+// SearchHit is an admission found by a full-text search.
+type SearchHit struct {
+	// Type is the module of the admission, e.g. activity, see the status history modules.
+	Type string `json:"jenis"`
+	// Id is the ID of the admission in its module, e.g. kegiatan_id for an activity.
+	Id              string      `json:"id"`
+	AdmissionNumber string      `json:"no_usulan"`
+	Status          int         `json:"status"`
+	AdmissionDate   Iso8601Date `json:"tgl_usulan,omitempty"`
+	// Title is the name of the admission, only activities have one.
+	Title string `json:"judul,omitempty"`
+	// AgencyId is the agency of the admission, empty for promotions, which use the agency of their ASN.
+	AgencyId string `json:"instansi_id,omitempty"`
+	// AsnId is the ASN of the admission, empty for activities and requirements.
+	AsnId string `json:"asn_id,omitempty"`
+	// Rank is the relevance of the hit, hits are sorted with the most relevant first. Admissions only found through
+	// the name of their ASN or one of their attendees have a rank of 0.
+	Rank float64 `json:"skor"`
+}
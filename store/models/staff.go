@@ -1,9 +1,47 @@
 package models
 
 const (
-	StaffRoleSupervisor = "pejabat_pembina"
+	StaffRoleSupervisor  = "pejabat_pembina"
+	StaffRolePembina     = "pembina_jf"
+	StaffRoleAgencyAdmin = "admin_instansi"
+	StaffRoleVerifier    = "verifikator"
+	StaffRoleBknAdmin    = "admin_bkn"
 )
 
+// Roles used by the authorization layer. A user can have more than one role. Roles are derived from the access token
+// roles (realm or client roles with the exact same name) and from the pegawai.role_peg column, see StaffRoles.
+const (
+	// RolePembina is the role of a JF supervising agency (instansi pembina) staff.
+	RolePembina = "pembina_jf"
+	// RoleAgencyAdmin is the role of an agency staff managing admissions of the agency.
+	RoleAgencyAdmin = "admin_instansi"
+	// RoleVerifier is the role of a staff verifying (accepting, rejecting, signing) admissions.
+	RoleVerifier = "verifikator"
+	// RoleBknAdmin is the role of BKN administrators.
+	RoleBknAdmin = "admin_bkn"
+	// RoleSupervisor is the role of pejabat pembina kepegawaian, who signs letters on behalf of their agency.
+	RoleSupervisor = "pejabat_pembina"
+)
+
+// Roles contains all valid roles.
+var Roles = map[string]struct{}{
+	RolePembina:     {},
+	RoleAgencyAdmin: {},
+	RoleVerifier:    {},
+	RoleBknAdmin:    {},
+	RoleSupervisor:  {},
+}
+
+// StaffRoles maps pegawai.role_peg values to roles. Pejabat pembina kepegawaian acts on behalf of their agency and
+// also signs its letters.
+var StaffRoles = map[string][]string{
+	StaffRoleSupervisor:  {RoleAgencyAdmin, RoleSupervisor},
+	StaffRolePembina:     {RolePembina},
+	StaffRoleAgencyAdmin: {RoleAgencyAdmin},
+	StaffRoleVerifier:    {RoleVerifier},
+	StaffRoleBknAdmin:    {RoleBknAdmin},
+}
+
 type OrganizationUnit struct {
 	OrganizationUnitId   string `json:"unit_organisasi_id"`
 	OrganizationUnitName string `json:"unit_organisasi"`
@@ -4,3 +4,13 @@ type StatisticStatus struct {
 	Status int `json:"status"`
 	Count  int `json:"jumlah"`
 }
+
+// StatisticPeriod is the number of entries for each status in a period of a status statistic time series.
+type StatisticPeriod struct {
+	// Period is the name of the period, e.g. 2024-01 for a month, 2024-Q1 for a quarter or 2024 for a year.
+	Period string `json:"periode"`
+	// StartDate is the first day of the period.
+	StartDate Iso8601Date `json:"tgl_awal"`
+	// Statuses contains every status, including those without entries in the period.
+	Statuses []*StatisticStatus `json:"status"`
+}
@@ -0,0 +1,24 @@
+package models
+
+// StatusHistory is a single status change of an admission, see the status constants of each module.
+type StatusHistory struct {
+	// OldStatus is 0 for the first entry of an admission, or if the previous status is unknown.
+	OldStatus int    `json:"status_lama"`
+	Status    int    `json:"status"`
+	Reason    string `json:"alasan,omitempty"`
+
+	// ModifiedBy is the ASN ID of the user who changed the status.
+	ModifiedBy     string    `json:"modified_by"`
+	ModifiedByNip  string    `json:"modified_by_nip"`
+	ModifiedByName string    `json:"modified_by_nama"`
+	ModifiedAt     EpochTime `json:"modified_at"`
+
+	IpAddress string `json:"ip_address,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+
+	// ImpersonatedBy is the ASN ID of the administrator who changed the status while impersonating ModifiedBy, empty
+	// if the status was changed by ModifiedBy themselves.
+	ImpersonatedBy     string `json:"impersonated_by,omitempty"`
+	ImpersonatedByNip  string `json:"impersonated_by_nip,omitempty"`
+	ImpersonatedByName string `json:"impersonated_by_nama,omitempty"`
+}
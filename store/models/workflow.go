@@ -0,0 +1,15 @@
+package models
+
+// AdmissionActions is the current status of an admission and the actions the user can do next.
+type AdmissionActions struct {
+	Status  int               `json:"status"`
+	Actions []*WorkflowAction `json:"aksi"`
+}
+
+// WorkflowAction is an action that moves an admission to another status.
+type WorkflowAction struct {
+	Action     string `json:"aksi"`
+	NextStatus int    `json:"status_berikutnya"`
+	// RequiredDocuments are the documents that must be supplied in the action request, named by their JSON field names.
+	RequiredDocuments []string `json:"dokumen_wajib"`
+}
@@ -0,0 +1,325 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/metricutil"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+	"github.com/fazrithe/siasn-jf-backend-git/store/notify"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// notificationEvents maps the statuses of each module to the event sent when an admission reaches the status.
+// Statuses that are not listed are not notified.
+var notificationEvents = map[string]map[int]string{
+	StatusHistoryModuleActivity: {
+		models.ActivityAdmissionStatusCreated:       notify.EventSubmitted,
+		models.ActivityAdmissionStatusAccepted:      notify.EventAccepted,
+		models.ActivityAdmissionStatusRejected:      notify.EventRejected,
+		models.ActivityAdmissionStatusCertPublished: notify.EventCertPublished,
+	},
+	StatusHistoryModuleRequirement: {
+		models.RequirementAdmissionStatusCreated:                    notify.EventSubmitted,
+		models.RequirementAdmissionStatusAccepted:                   notify.EventAccepted,
+		models.RequirementAdmissionStatusAcceptedWithRecommendation: notify.EventAccepted,
+		models.RequirementAdmissionStatusRevision:                   notify.EventRevision,
+		models.RequirementAdmissionStatusDenied:                     notify.EventRejected,
+	},
+	StatusHistoryModuleDismissal: {
+		models.DismissalAdmissionStatusCreated:  notify.EventSubmitted,
+		models.DismissalAdmissionStatusAccepted: notify.EventAccepted,
+		models.DismissalAdmissionStatusRejected: notify.EventRejected,
+	},
+	StatusHistoryModulePromotion: {
+		models.PromotionAdmissionStatusCreated:  notify.EventSubmitted,
+		models.PromotionAdmissionStatusAccepted: notify.EventAccepted,
+		models.PromotionAdmissionStatusRejected: notify.EventRejected,
+	},
+	StatusHistoryModulePromotionCpns: {
+		models.PromotionCpnsAdmissionStatusCreated:  notify.EventSubmitted,
+		models.PromotionCpnsAdmissionStatusAccepted: notify.EventAccepted,
+		models.PromotionCpnsAdmissionStatusRejected: notify.EventRejected,
+	},
+	StatusHistoryModuleAssessmentTeam: {
+		models.AssessmentTeamStatusCreated:  notify.EventSubmitted,
+		models.AssessmentTeamStatusVerified: notify.EventAccepted,
+	},
+}
+
+// notificationAsnQueries select the ASNs affected by an admission of each module, other than its submitter:
+// activity attendees, the promoted or dismissed ASN and the assessors.
+var notificationAsnQueries = map[string]string{
+	StatusHistoryModuleActivity:       "select pegawai_user_id from perserta_kegiatan where kegiatan_kegiatan_id::text = $1",
+	StatusHistoryModuleDismissal:      "select asn_id from pemberhentian where uuid_pemberhentian::text = $1",
+	StatusHistoryModulePromotion:      "select asn_id from pengangkatan where uuid_pengangkatan::text = $1",
+	StatusHistoryModulePromotionCpns:  "select asn_id from pengangkatan_cpns where pengangkatan_cpns_id::text = $1",
+	StatusHistoryModuleAssessmentTeam: "select asn_id from anggota_tim_penilaian where tim_penilaian_id::text = $1",
+}
+
+// notifyStatusChange notifies the submitter and the affected ASNs of an admission that has just been changed to
+// status by the user of request. It does nothing if c.Notifier is nil or the status is not notified.
+//
+// The email of the user is saved first so that the user can be notified later on. Notifications are sent in the
+// background, errors are only logged since the status change has been committed.
+func (c *Client) notifyStatusChange(request *http.Request, module, entityId string, status int, reason string) {
+	if c.Notifier == nil {
+		return
+	}
+
+	kind, ok := notificationEvents[module][status]
+	if !ok {
+		return
+	}
+
+	// status_hist records UUIDs in their canonical form, the request may not.
+	if id, err := uuid.Parse(entityId); err == nil {
+		entityId = id.String()
+	}
+
+	event := &notify.Event{
+		Kind:       kind,
+		Module:     module,
+		EntityId:   entityId,
+		Status:     status,
+		Reason:     reason,
+		ModifiedAt: time.Now(),
+	}
+	user := auth.ReqGetUserDetail(request)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), TimeoutNotify)
+		defer cancel()
+
+		if user != nil && user.Email != "" {
+			err := c.saveNotificationEmailCtx(ctx, user.AsnId, user.Email)
+			if err != nil {
+				c.Logger.Warnf("cannot save notification email of %s: %v", user.AsnId, err)
+			}
+		}
+
+		recipients, err := c.getNotificationRecipientsCtx(ctx, module, entityId)
+		if err != nil {
+			c.Logger.Warnf("cannot get notification recipients of %s %s: %v", module, entityId, err)
+			return
+		}
+		if len(recipients) == 0 {
+			return
+		}
+
+		err = c.Notifier.Notify(event, recipients)
+		if err != nil {
+			c.Logger.Warnf("cannot notify %s %s %s: %v", module, entityId, kind, err)
+		}
+	}()
+}
+
+// saveNotificationEmailCtx saves the email of an ASN, keeping the notification preference.
+// This method already returns an error in form of error code.
+func (c *Client) saveNotificationEmailCtx(ctx context.Context, asnId, email string) (err error) {
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+	_, err = mdb.ExecContext(
+		ctx,
+		"insert into notifikasi_penerima(asn_id, email, updated_at_ts) values($1, $2, current_timestamp) on conflict(asn_id) do update set email = excluded.email, updated_at_ts = excluded.updated_at_ts where notifikasi_penerima.email <> excluded.email",
+		asnId,
+		email,
+	)
+	if err != nil {
+		return ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("cannot save notification email: %w", err))
+	}
+
+	return nil
+}
+
+// getNotificationRecipientsCtx returns the submitter and the affected ASNs of an admission that have an email and
+// have not opted out of notifications, see getRecipientsCtx. The submitter is the user who created the admission
+// according to status_hist.
+// This method already returns an error in form of error code.
+func (c *Client) getNotificationRecipientsCtx(ctx context.Context, module, entityId string) (recipients []*notify.Recipient, err error) {
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+
+	asnIds := make([]string, 0)
+	submitterAsnId := ""
+	err = mdb.QueryRowContext(
+		ctx,
+		"select user_id from status_hist where modul = $1 and entitas_id = $2 order by modified_at_ts, status_hist_id limit 1",
+		module,
+		entityId,
+	).Scan(&submitterAsnId)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot query admission submitter: %w", err))
+	}
+	if submitterAsnId != "" {
+		asnIds = append(asnIds, submitterAsnId)
+	}
+
+	if query, ok := notificationAsnQueries[module]; ok {
+		rows, err := mdb.QueryContext(ctx, query, entityId)
+		if err != nil {
+			return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot query admission ASNs: %w", err))
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			asnId := ""
+			err = rows.Scan(&asnId)
+			if err != nil {
+				return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot scan admission ASNs: %w", err))
+			}
+			asnIds = append(asnIds, asnId)
+		}
+		if err = rows.Err(); err != nil {
+			return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot query admission ASNs: %w", err))
+		}
+	}
+
+	return c.getRecipientsCtx(ctx, asnIds)
+}
+
+// getRecipientsCtx returns the ASNs of asnIds that have an email and have not opted out of notifications, without
+// duplicates.
+//
+// The email saved in notifikasi_penerima is used if the ASN has one, otherwise the email in the profile database is
+// used, so that ASNs who have never logged in are notified too.
+// This method already returns an error in form of error code.
+func (c *Client) getRecipientsCtx(ctx context.Context, asnIds []string) (recipients []*notify.Recipient, err error) {
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+	profileMdb := metricutil.NewDB(c.ProfileDb, c.SqlMetrics)
+
+	recipients = make([]*notify.Recipient, 0)
+	if len(asnIds) == 0 {
+		return recipients, nil
+	}
+
+	rows, err := mdb.QueryContext(
+		ctx,
+		"select asn_id, email, berhenti_langganan from notifikasi_penerima where asn_id = any($1)",
+		pq.Array(asnIds),
+	)
+	if err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot query notifikasi_penerima: %w", err))
+	}
+	defer rows.Close()
+
+	savedEmails := make(map[string]string)
+	optedOut := make(map[string]struct{})
+	for rows.Next() {
+		asnId := ""
+		email := ""
+		optOut := false
+		err = rows.Scan(&asnId, &email, &optOut)
+		if err != nil {
+			return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot scan notifikasi_penerima: %w", err))
+		}
+		if optOut {
+			optedOut[asnId] = struct{}{}
+			continue
+		}
+		savedEmails[asnId] = email
+	}
+	if err = rows.Err(); err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot query notifikasi_penerima: %w", err))
+	}
+
+	recipientAsnIds := make([]string, 0)
+	seen := make(map[string]struct{})
+	for _, asnId := range asnIds {
+		if _, ok := seen[asnId]; ok {
+			continue
+		}
+		seen[asnId] = struct{}{}
+		if _, ok := optedOut[asnId]; !ok {
+			recipientAsnIds = append(recipientAsnIds, asnId)
+		}
+	}
+
+	if len(recipientAsnIds) == 0 {
+		return recipients, nil
+	}
+
+	profileRows, err := profileMdb.QueryContext(ctx, "select id, nama, coalesce(email, '') from orang where id = any($1)", pq.Array(recipientAsnIds))
+	if err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot retrieve ASN data: %w", err))
+	}
+	defer profileRows.Close()
+
+	profiles := make(map[string]*notify.Recipient)
+	for profileRows.Next() {
+		profile := &notify.Recipient{}
+		err = profileRows.Scan(&profile.AsnId, &profile.Name, &profile.Email)
+		if err != nil {
+			return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot retrieve ASN data: %w", err))
+		}
+		profiles[profile.AsnId] = profile
+	}
+	if err = profileRows.Err(); err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot retrieve ASN data: %w", err))
+	}
+
+	for _, asnId := range recipientAsnIds {
+		recipient := &notify.Recipient{AsnId: asnId, Email: savedEmails[asnId]}
+		if profile, ok := profiles[asnId]; ok {
+			recipient.Name = profile.Name
+			if recipient.Email == "" {
+				recipient.Email = profile.Email
+			}
+		}
+		if recipient.Email == "" {
+			continue
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, nil
+}
+
+// GetNotificationPreferenceCtx returns the notification preference of an ASN. ASNs that have not saved their
+// preference get email as their address and are not opted out.
+// This method already returns an error in form of error code.
+func (c *Client) GetNotificationPreferenceCtx(ctx context.Context, asnId, email string) (preference *models.NotificationPreference, err error) {
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+
+	preference = &models.NotificationPreference{}
+	err = mdb.QueryRowContext(ctx, "select email, berhenti_langganan from notifikasi_penerima where asn_id = $1", asnId).Scan(
+		&preference.Email,
+		&preference.OptOut,
+	)
+	if err == sql.ErrNoRows {
+		return &models.NotificationPreference{Email: email}, nil
+	}
+	if err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot query notifikasi_penerima: %w", err))
+	}
+
+	return preference, nil
+}
+
+// UpdateNotificationPreferenceCtx saves the notification preference of an ASN, together with its current email.
+// It returns errnum.ErrNotificationEmailMissing if the ASN does not have an email.
+// This method already returns an error in form of error code.
+func (c *Client) UpdateNotificationPreferenceCtx(ctx context.Context, asnId string, preference *models.NotificationPreference) (err error) {
+	if preference.Email == "" {
+		return ErrNotificationEmailMissing
+	}
+
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+	_, err = mdb.ExecContext(
+		ctx,
+		"insert into notifikasi_penerima(asn_id, email, berhenti_langganan, updated_at_ts) values($1, $2, $3, current_timestamp) on conflict(asn_id) do update set email = excluded.email, berhenti_langganan = excluded.berhenti_langganan, updated_at_ts = excluded.updated_at_ts",
+		asnId,
+		preference.Email,
+		preference.OptOut,
+	)
+	if err != nil {
+		return ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("cannot save notification preference: %w", err))
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/httputil"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+)
+
+const (
+	TimeoutNotificationPreferenceGet    = TimeoutDefault
+	TimeoutNotificationPreferenceUpdate = TimeoutDefault
+	// TimeoutNotify is the timeout of finding the recipients of a status change and handing the notifications to
+	// the Notifier, done in the background after the status change response has been written.
+	TimeoutNotify = TimeoutDefault
+)
+
+// HandleNotificationPreferenceGet handles the request to get the notification preference of the user.
+func (c *Client) HandleNotificationPreferenceGet(writer http.ResponseWriter, request *http.Request) {
+	user := auth.AssertReqGetUserDetail(request)
+
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutNotificationPreferenceGet)
+	defer cancel()
+
+	preference, err := c.GetNotificationPreferenceCtx(ctx, user.AsnId, user.Email)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, preference)
+}
+
+// HandleNotificationPreferenceUpdate handles the request to opt in or out of notification emails.
+// The email is always taken from the identity provider, the one in the request body is ignored.
+func (c *Client) HandleNotificationPreferenceUpdate(writer http.ResponseWriter, request *http.Request) {
+	user := auth.AssertReqGetUserDetail(request)
+
+	preference := &models.NotificationPreference{}
+	err := c.decodeRequestJson(writer, request, preference)
+	if err != nil {
+		return
+	}
+	preference.Email = user.Email
+
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutNotificationPreferenceUpdate)
+	defer cancel()
+
+	err = c.UpdateNotificationPreferenceCtx(ctx, user.AsnId, preference)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, preference)
+}
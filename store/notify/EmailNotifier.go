@@ -0,0 +1,125 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/email"
+	gomail "gopkg.in/mail.v2"
+)
+
+//go:embed templates/*
+var templates embed.FS
+
+// moduleNames are the names of the admission modules displayed in the emails.
+var moduleNames = map[string]string{
+	"activity":        "Kegiatan",
+	"requirement":     "Kebutuhan",
+	"dismissal":       "Pemberhentian",
+	"promotion":       "Pengangkatan",
+	"promotion-cpns":  "Pengangkatan CPNS",
+	"assessment-team": "Tim Penilaian",
+}
+
+// eventNames are the names of the events displayed in the emails.
+var eventNames = map[string]string{
+	EventSubmitted:      "diajukan",
+	EventAccepted:       "diterima",
+	EventRejected:       "ditolak",
+	EventRevision:       "dikembalikan untuk revisi",
+	EventCertPublished:  "sertifikat diterbitkan",
+	EventDocumentReady:  "selesai dibuatkan dokumennya",
+	EventDocumentFailed: "gagal dibuatkan dokumennya",
+}
+
+// emailData is the data the email templates are executed with.
+type emailData struct {
+	Recipient *Recipient
+	Event     *Event
+	Module    string
+	EventName string
+	AppUrl    string
+}
+
+// EmailNotifier sends an email with an HTML and a plaintext body to every recipient.
+type EmailNotifier struct {
+	Sender email.Sender
+	// From is the address in the From header.
+	From string
+	// AppUrl is the URL of the frontend linked in the emails, can be empty.
+	AppUrl string
+
+	htmlTemplate *htmltemplate.Template
+	textTemplate *texttemplate.Template
+}
+
+// NewEmailNotifier creates a notifier that sends emails with sender, templated by the templates embedded in this
+// package.
+func NewEmailNotifier(sender email.Sender, from string) *EmailNotifier {
+	return &EmailNotifier{
+		Sender:       sender,
+		From:         from,
+		htmlTemplate: htmltemplate.Must(htmltemplate.ParseFS(templates, "templates/status.html")),
+		textTemplate: texttemplate.Must(texttemplate.ParseFS(templates, "templates/status.txt")),
+	}
+}
+
+// Notify sends an email to every recipient with an email address. It stops at the first failing recipient.
+func (n *EmailNotifier) Notify(event *Event, recipients []*Recipient) error {
+	for _, recipient := range recipients {
+		if recipient.Email == "" {
+			continue
+		}
+
+		message, err := n.createMessage(event, recipient)
+		if err != nil {
+			return err
+		}
+
+		err = n.Sender.Send(message)
+		if err != nil {
+			return fmt.Errorf("cannot send email to %s: %w", recipient.Email, err)
+		}
+	}
+
+	return nil
+}
+
+func (n *EmailNotifier) createMessage(event *Event, recipient *Recipient) (message *gomail.Message, err error) {
+	data := &emailData{
+		Recipient: recipient,
+		Event:     event,
+		Module:    moduleNames[event.Module],
+		EventName: eventNames[event.Kind],
+		AppUrl:    n.AppUrl,
+	}
+	if data.Module == "" {
+		data.Module = event.Module
+	}
+	if data.EventName == "" {
+		data.EventName = event.Kind
+	}
+
+	html := &bytes.Buffer{}
+	err = n.htmlTemplate.Execute(html, data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot execute HTML email template: %w", err)
+	}
+
+	text := &bytes.Buffer{}
+	err = n.textTemplate.Execute(text, data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot execute plaintext email template: %w", err)
+	}
+
+	message = gomail.NewMessage()
+	message.SetHeader("From", n.From)
+	message.SetAddressHeader("To", recipient.Email, recipient.Name)
+	message.SetHeader("Subject", fmt.Sprintf("Usulan %s %s", data.Module, data.EventName))
+	message.SetBody("text/plain", text.String())
+	message.AddAlternative("text/html", html.String())
+	return message, nil
+}
@@ -0,0 +1,46 @@
+// Package notify notifies the ASNs involved in an admission when the admission status changes.
+// All functions in this package does not support error code implemented by the standard ec and errnum package.
+package notify
+
+import (
+	"time"
+)
+
+// Kinds of events.
+const (
+	EventSubmitted     = "submitted"
+	EventAccepted      = "accepted"
+	EventRejected      = "rejected"
+	EventRevision      = "revision"
+	EventCertPublished = "cert-published"
+	// EventDocumentReady and EventDocumentFailed are sent to the requester of a document generation job when the job
+	// is done or has failed.
+	EventDocumentReady  = "document-ready"
+	EventDocumentFailed = "document-failed"
+)
+
+// Event is a status change of an admission, or the result of generating one of its documents.
+type Event struct {
+	// Kind is one of EventSubmitted and others.
+	Kind string
+	// Module is the admission module, e.g. dismissal, see store.StatusHistoryModuleActivity and others.
+	Module   string
+	EntityId string
+	Status   int
+	// Reason is the rejection or revision reason, can be empty.
+	Reason     string
+	ModifiedAt time.Time
+}
+
+// Recipient is an ASN to notify.
+type Recipient struct {
+	AsnId string
+	Name  string
+	Email string
+}
+
+// Notifier sends an event to its recipients.
+type Notifier interface {
+	// Notify sends event to every recipient. It may return before the notifications are delivered.
+	Notify(event *Event, recipients []*Recipient) error
+}
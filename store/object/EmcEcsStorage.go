@@ -17,6 +17,8 @@ import (
 	"github.com/google/uuid"
 )
 
+var _ BucketChecker = &EmcEcsStorage{}
+
 type EmcEcsStorage struct {
 	Client *ecs.S3
 	Logger logutil.Logger
@@ -106,6 +108,23 @@ type EmcEcsStorage struct {
 	SignUrlExpire time.Duration
 }
 
+// CheckBuckets checks that every configured bucket exists and can be accessed with a HEAD request.
+func (s *EmcEcsStorage) CheckBuckets(ctx context.Context) (err error) {
+	for _, bucket := range s.buckets() {
+		_, err = s.Client.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+		if err != nil {
+			return fmt.Errorf("cannot reach bucket %s: %w", bucket, err)
+		}
+	}
+	return nil
+}
+
+// buckets returns the configured buckets.
+func (s *EmcEcsStorage) buckets() []string {
+	return uniqueBuckets(s.TempBucket, s.ActivityBucket, s.RequirementBucket, s.DismissalBucket, s.PromotionBucket,
+		s.PromotionCpnsBucket, s.AssessmentTeamBucket)
+}
+
 func (s *EmcEcsStorage) getFileMetadata(ctx context.Context, bucket, filename string) (metadata *Metadata, err error) {
 	out, err := s.Client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(bucket),
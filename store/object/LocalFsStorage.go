@@ -0,0 +1,849 @@
+package object
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fazrithe/siasn-jf-backend-git/libs/logutil"
+	"github.com/google/uuid"
+)
+
+var _ Storage = &LocalFsStorage{}
+var _ BucketChecker = &LocalFsStorage{}
+
+// ErrInvalidObjectKey is returned by LocalFsStorage if a bucket or a filename tries to escape the root directory.
+var ErrInvalidObjectKey = errors.New("invalid bucket or object key")
+
+// LocalFsStorage implements the Storage interface on the local filesystem. It is meant for running the service locally
+// without an EMC ECS endpoint, it is not meant to be used in production.
+//
+// Every bucket is a directory under RootDir, so files will be stored in RootDir/Bucket/Dir/filename. Temporary and
+// permanent files follow the same semantics as EmcEcsStorage: documents are uploaded to the temporary bucket and
+// copied to the permanent bucket when saved.
+//
+// Presigned URLs are emulated by URLs under BaseUrl signed with HMAC-SHA256 using SecretKey. The LocalFsStorage itself
+// is an http.Handler that serves those URLs and must be mounted so that it receives requests to BaseUrl with BaseUrl
+// path stripped.
+type LocalFsStorage struct {
+	Logger logutil.Logger
+	// RootDir is the directory in which all buckets are stored.
+	RootDir string
+	// BaseUrl is the URL under which the storage handler is mounted, for example http://127.0.0.1:8080/api/object.
+	// Signed URLs are generated as BaseUrl/Bucket/Dir/filename.
+	BaseUrl *url.URL
+	// SecretKey is the key used to sign URLs.
+	SecretKey []byte
+	// MaxUploadSize is the maximum size of a file uploaded with a signed PUT URL in bytes, 0 means unlimited.
+	MaxUploadSize int64
+
+	// TempBucket represents the bucket name to store temporary files.
+	TempBucket string
+	// TempActivityDir represents a directory to store temporary activity files, relative to TempBucket.
+	TempActivityDir string
+	// ActivityBucket represents the bucket name to store activity files (support documents).
+	ActivityBucket string
+	// ActivityDir represents a directory to store activity support documents, relative to ActivityBucket.
+	ActivityDir string
+
+	// TempRequirementDir represents a directory to store temporary requirement files, relative to TempBucket.
+	TempRequirementDir string
+	// RequirementBucket represents the bucket name to store requirement files.
+	RequirementBucket string
+	// RequirementDir represents a directory to store requirement documents, relative to RequirementBucket.
+	RequirementDir string
+	// RequirementTemplateDir represents directory for storing template documents.
+	RequirementTemplateDir string
+	// RequirementTemplateCoverLetterFilename represents the filename of cover letter template including its extension.
+	RequirementTemplateCoverLetterFilename string
+
+	// TempDismissalDir represents a directory to store temporary dismissal files, relative to TempBucket.
+	TempDismissalDir string
+	// DismissalBucket represents the bucket name to store dismissal files.
+	DismissalBucket string
+	// DismissalDir represents a directory to store dismissal documents, relative to DismissalBucket.
+	DismissalDir string
+	// DismissalTemplateDir represents directory for storing dismissal template documents.
+	DismissalTemplateDir string
+	// DismissalTemplateAcceptanceLetterFilename represents the filename of dismissal acceptance letter template including its extension.
+	DismissalTemplateAcceptanceLetterFilename string
+
+	// TempPromotionDir represents a directory to store temporary promotion files, relative to TempBucket.
+	TempPromotionDir string
+	// PromotionBucket represents the bucket name to store promotion files.
+	PromotionBucket string
+	// PromotionDir represents a directory to store promotion documents, relative to PromotionBucket.
+	PromotionDir string
+	// PromotionTemplateDir represents directory for storing promotion template documents.
+	PromotionTemplateDir string
+	// PromotionTemplatePakLetterFilename represents the filename of promotion pak letter template including its extension.
+	PromotionTemplatePakLetterFilename string
+	// PromotionTemplateRecommendationLetterFilename represents the filename of promotion recommendation letter template including its extension.
+	PromotionTemplateRecommendationLetterFilename string
+
+	// PromotionCpnsBucket represents the bucket name to store promotion for CPNS files.
+	PromotionCpnsBucket string
+	// PromotionCpnsDir represents a directory to store promotion for CPNS documents, relative to PromotionCpnsBucket.
+	PromotionCpnsDir string
+	// TempPromotionCpnsDir represents a directory to store temporary promotion for CPNS files, relative to TempBucket.
+	TempPromotionCpnsDir string
+
+	// TempAssessmentTeamDir represents a directory to store temporary assessment team files, relative to TempBucket.
+	TempAssessmentTeamDir string
+	// AssessmentTeamBucket represents the bucket name to store assessment team files (support documents).
+	AssessmentTeamBucket string
+	// AssessmentTeamDir represents a directory to store assessment team documents, relative to AssessmentTeamBucket.
+	AssessmentTeamDir string
+
+	// SignUrlExpire is the duration in which signed URL will expire after being generated, for any purposes.
+	SignUrlExpire time.Duration
+}
+
+// NewLocalFsStorage creates a LocalFsStorage storing files in rootDir and serving signed URLs under baseUrl.
+// Bucket and directory names have to be set afterwards.
+func NewLocalFsStorage(rootDir string, baseUrl *url.URL, secretKey []byte) *LocalFsStorage {
+	return &LocalFsStorage{
+		Logger:        logutil.NewStdLogger(false, "localfs"),
+		RootDir:       rootDir,
+		BaseUrl:       baseUrl,
+		SecretKey:     secretKey,
+		SignUrlExpire: 1 * time.Hour,
+	}
+}
+
+// defaultBucketDir is the directory used for buckets without a name, which is allowed by the configuration.
+const defaultBucketDir = "default"
+
+// bucketDir returns the name of the directory of a bucket.
+func bucketDir(bucket string) string {
+	if bucket == "" {
+		return defaultBucketDir
+	}
+	return bucket
+}
+
+// CheckBuckets checks that RootDir, in which buckets are created, exists or can be created and is writable.
+func (s *LocalFsStorage) CheckBuckets(_ context.Context) (err error) {
+	err = os.MkdirAll(s.RootDir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(s.RootDir, ".health-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", s.RootDir, err)
+	}
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
+
+// objectPath returns the path of an object in the local filesystem. It makes sure that the result stays inside
+// RootDir.
+func (s *LocalFsStorage) objectPath(bucket, key string) (p string, err error) {
+	if strings.ContainsAny(bucket, `/\`) || bucket == "." || bucket == ".." {
+		return "", ErrInvalidObjectKey
+	}
+
+	cleanKey := path.Clean("/" + key)
+	if cleanKey == "/" || cleanKey != "/"+strings.TrimPrefix(key, "/") {
+		return "", ErrInvalidObjectKey
+	}
+
+	return filepath.Join(s.RootDir, bucketDir(bucket), filepath.FromSlash(cleanKey)), nil
+}
+
+// contentTypeOf guesses the content type of a file from its extension.
+func contentTypeOf(filename string) string {
+	ext := strings.TrimPrefix(path.Ext(filename), ".")
+	for mimeType, e := range MimeTypeToExtension {
+		if e == ext {
+			return mimeType
+		}
+	}
+
+	if contentType := mime.TypeByExtension(path.Ext(filename)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// checksumPath returns the path of the file that stores the checksum of the object at p. It is a hidden file next to
+// the object.
+func checksumPath(p string) string {
+	return filepath.Join(filepath.Dir(p), "."+filepath.Base(p)+".sha256")
+}
+
+// writeChecksum stores the checksum of the object at p, see checksumPath.
+func writeChecksum(p string, checksum string) error {
+	return os.WriteFile(checksumPath(p), []byte(checksum), 0o644)
+}
+
+// checksumOf returns the hex encoded SHA-256 checksum of the object at p, whose file info is info.
+// The checksum stored when the object was written is used, unless it is missing or older than the object, in which
+// case the checksum is calculated and stored again.
+func checksumOf(p string, info os.FileInfo) (checksum string, err error) {
+	if checksumInfo, err := os.Stat(checksumPath(p)); err == nil && !checksumInfo.ModTime().Before(info.ModTime()) {
+		stored, err := os.ReadFile(checksumPath(p))
+		if err == nil && len(stored) == sha256.Size*2 {
+			return string(stored), nil
+		}
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	checksum = hex.EncodeToString(h.Sum(nil))
+
+	// Failing to store the checksum only means that it will be calculated again next time.
+	_ = writeChecksum(p, checksum)
+	return checksum, nil
+}
+
+func (s *LocalFsStorage) getFileMetadata(_ context.Context, bucket, filename string) (metadata *Metadata, err error) {
+	p, err := s.objectPath(bucket, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, ErrFileNotFound
+	}
+
+	checksum, err := checksumOf(p, info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Metadata{
+		Bucket:        bucket,
+		Filename:      filename,
+		Checksum:      checksum,
+		ContentType:   contentTypeOf(filename),
+		ContentLength: int(info.Size()),
+		LastModified:  info.ModTime(),
+	}, nil
+}
+
+// getFile retrieves a file from the bucket.
+func (s *LocalFsStorage) getFile(_ context.Context, bucket, filename string) (out io.ReadCloser, err error) {
+	p, err := s.objectPath(bucket, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// writeFile writes in to p atomically, creating its parent directories if needed.
+// It returns the SHA-256 checksum of the written file, which is also stored so that getFileMetadata does not have to
+// read the whole file.
+func (s *LocalFsStorage) writeFile(p string, in io.Reader) (checksum string, err error) {
+	err = os.MkdirAll(filepath.Dir(p), 0o755)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), in)
+	if err != nil {
+		return "", err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return "", err
+	}
+
+	err = os.Rename(tmp.Name(), p)
+	if err != nil {
+		return "", err
+	}
+
+	checksum = hex.EncodeToString(h.Sum(nil))
+	err = writeChecksum(p, checksum)
+	if err != nil {
+		s.Logger.Warnf("cannot store checksum of %s, it will be calculated when needed: %v", p, err)
+	}
+	return checksum, nil
+}
+
+// putFile puts a file into the bucket. The content type is derived from the filename extension.
+func (s *LocalFsStorage) putFile(_ context.Context, bucket, filename string, _ string, in io.ReadSeeker) (err error) {
+	p, err := s.objectPath(bucket, filename)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.writeFile(p, in)
+	return err
+}
+
+// saveFile copies a file from temporary bucket to permanent one.
+func (s *LocalFsStorage) saveFile(tempBucket, tempDir, src, permanentBucket, permanentDir, dest string) (result *SaveResult, err error) {
+	srcPath, err := s.objectPath(tempBucket, path.Join(tempDir, src))
+	if err != nil {
+		return nil, err
+	}
+	destPath, err := s.objectPath(permanentBucket, path.Join(permanentDir, dest))
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(srcPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrTempFileNotFound
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	checksum, err := s.writeFile(destPath, f)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(destPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SaveResult{
+		Bucket:    permanentBucket,
+		Dir:       permanentDir,
+		Filename:  dest,
+		Checksum:  checksum,
+		CreatedAt: info.ModTime(),
+	}, nil
+}
+
+// deleteFiles deletes files from the bucket, logging failures instead of returning them.
+func (s *LocalFsStorage) deleteFiles(bucket, dir string, filenames ...string) {
+	for _, filename := range filenames {
+		p, err := s.objectPath(bucket, path.Join(dir, filename))
+		if err == nil {
+			err = os.Remove(p)
+			_ = os.Remove(checksumPath(p))
+		}
+		if err != nil {
+			s.Logger.Warnf("cannot delete temporary files, skipping: %v", err)
+		}
+	}
+}
+
+// saveFiles moves files from temporary bucket to permanent one.
+func (s *LocalFsStorage) saveFiles(_ context.Context, tempBucket, tempDir, permanentBucket, permanentDir string, filenames []string, deleteOriginal bool) (results []*SaveResult, err error) {
+	if len(filenames) >= 1000 {
+		return nil, ErrTooManyFiles
+	}
+
+	for _, filename := range filenames {
+		result, err := s.saveFile(tempBucket, tempDir, filename, permanentBucket, permanentDir, filename)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	if deleteOriginal {
+		s.deleteFiles(tempBucket, tempDir, filenames...)
+	}
+
+	return results, nil
+}
+
+// sign calculates the signature of a signed URL.
+func (s *LocalFsStorage) sign(method, bucket, key string, expires int64) string {
+	mac := hmac.New(sha256.New, s.SecretKey)
+	_, _ = fmt.Fprintf(mac, "%s\n%s\n%s\n%d", method, bucket, key, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// generateSignedUrl generates a URL that allows method to be called on the object until expireDuration has passed.
+func (s *LocalFsStorage) generateSignedUrl(method string, bucket string, key string, expireDuration time.Duration) (signedUrl *url.URL, err error) {
+	if s.BaseUrl == nil {
+		return nil, errors.New("base URL of local storage is not configured")
+	}
+	if _, err = s.objectPath(bucket, key); err != nil {
+		return nil, err
+	}
+
+	bucket = bucketDir(bucket)
+	expires := time.Now().Add(expireDuration).Unix()
+	signedUrl = &url.URL{}
+	*signedUrl = *s.BaseUrl
+	signedUrl.Path = path.Join(s.BaseUrl.Path, bucket, key)
+	query := url.Values{}
+	query.Set("method", method)
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", s.sign(method, bucket, key, expires))
+	signedUrl.RawQuery = query.Encode()
+	return signedUrl, nil
+}
+
+func (s *LocalFsStorage) generateGetSignedUrl(_ context.Context, bucket string, key string, expireDuration time.Duration) (signedUrl *url.URL, err error) {
+	return s.generateSignedUrl(http.MethodGet, bucket, key, expireDuration)
+}
+
+func (s *LocalFsStorage) generatePutSignedUrl(_ context.Context, bucket string, key string, expireDuration time.Duration) (signedUrl *url.URL, err error) {
+	return s.generateSignedUrl(http.MethodPut, bucket, key, expireDuration)
+}
+
+// ServeHTTP serves the signed URLs generated by this storage. The request path must be /bucket/key, i.e. the base URL
+// path must already be stripped. GET (and HEAD) requests download the object and PUT requests upload it.
+func (s *LocalFsStorage) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	method := request.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	if method != http.MethodGet && method != http.MethodPut {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(request.URL.Path, "/"), "/", 2)
+	if len(parts) != 2 {
+		http.Error(writer, "object not found", http.StatusNotFound)
+		return
+	}
+	bucket, key := parts[0], parts[1]
+
+	query := request.URL.Query()
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || query.Get("method") != method {
+		http.Error(writer, "invalid signature", http.StatusForbidden)
+		return
+	}
+	signature, err := hex.DecodeString(query.Get("signature"))
+	expected, _ := hex.DecodeString(s.sign(method, bucket, key, expires))
+	if err != nil || !hmac.Equal(signature, expected) {
+		http.Error(writer, "invalid signature", http.StatusForbidden)
+		return
+	}
+	if time.Now().Unix() > expires {
+		http.Error(writer, "signed URL has expired", http.StatusForbidden)
+		return
+	}
+
+	p, err := s.objectPath(bucket, key)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if method == http.MethodPut {
+		body := io.Reader(request.Body)
+		if s.MaxUploadSize > 0 {
+			body = http.MaxBytesReader(writer, request.Body, s.MaxUploadSize)
+		}
+
+		checksum, err := s.writeFile(p, body)
+		if err != nil {
+			s.Logger.Warnf("cannot write %s/%s: %v", bucket, key, err)
+			http.Error(writer, "cannot write object", http.StatusInternalServerError)
+			return
+		}
+
+		writer.Header().Set("ETag", strconv.Quote(checksum))
+		writer.WriteHeader(http.StatusOK)
+		return
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		http.Error(writer, "object not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.Error(writer, "object not found", http.StatusNotFound)
+		return
+	}
+
+	writer.Header().Set("Content-Type", contentTypeOf(key))
+	http.ServeContent(writer, request, path.Base(key), info.ModTime(), f)
+}
+
+func (s *LocalFsStorage) GetActivityFileMetadata(ctx context.Context, filename string) (metadata *Metadata, err error) {
+	meta, err := s.getFileMetadata(ctx, s.ActivityBucket, path.Join(s.ActivityDir, filename))
+	if err != nil {
+		return nil, err
+	}
+
+	meta.Dir = s.ActivityDir
+	return meta, nil
+}
+
+func (s *LocalFsStorage) GetActivityFile(ctx context.Context, filename string) (out io.ReadCloser, err error) {
+	return s.getFile(ctx, s.ActivityBucket, path.Join(s.ActivityDir, filename))
+}
+
+func (s *LocalFsStorage) PutActivityFile(ctx context.Context, filename string, contentType string, in io.ReadSeeker) (err error) {
+	return s.putFile(ctx, s.ActivityBucket, path.Join(s.ActivityDir, filename), contentType, in)
+}
+
+func (s *LocalFsStorage) SaveActivityFiles(ctx context.Context, filenames []string) (results []*SaveResult, err error) {
+	return s.saveFiles(ctx, s.TempBucket, s.TempActivityDir, s.ActivityBucket, s.ActivityDir, filenames, true)
+}
+
+func (s *LocalFsStorage) GenerateActivityFilename(mimeType string) (filename string, err error) {
+	ext, ok := MimeTypeToExtension[mimeType]
+	if !ok {
+		return "", ErrFileTypeUnsupported
+	}
+
+	return fmt.Sprintf("%s.%s", uuid.New().String(), ext), nil
+}
+
+func (s *LocalFsStorage) GenerateActivityDocPutSign(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generatePutSignedUrl(ctx, s.TempBucket, path.Join(s.TempActivityDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GenerateActivityDocPutSignDirect(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generatePutSignedUrl(ctx, s.ActivityBucket, path.Join(s.ActivityDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GenerateActivityDocGetSignTemp(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generateGetSignedUrl(ctx, s.TempBucket, path.Join(s.TempActivityDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GenerateActivityDocGetSign(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generateGetSignedUrl(ctx, s.ActivityBucket, path.Join(s.ActivityDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GetRequirementFileMetadata(ctx context.Context, filename string) (metadata *Metadata, err error) {
+	meta, err := s.getFileMetadata(ctx, s.RequirementBucket, path.Join(s.RequirementDir, filename))
+	if err != nil {
+		return nil, err
+	}
+
+	meta.Dir = s.RequirementDir
+	return meta, nil
+}
+
+func (s *LocalFsStorage) GetRequirementFile(ctx context.Context, filename string) (out io.ReadCloser, err error) {
+	return s.getFile(ctx, s.RequirementBucket, path.Join(s.RequirementDir, filename))
+}
+
+func (s *LocalFsStorage) PutRequirementFile(ctx context.Context, filename string, contentType string, in io.ReadSeeker) (err error) {
+	return s.putFile(ctx, s.RequirementBucket, path.Join(s.RequirementDir, filename), contentType, in)
+}
+
+func (s *LocalFsStorage) SaveRequirementFile(_ context.Context, src string, dest string) (result *SaveResult, err error) {
+	result, err = s.saveFile(s.TempBucket, s.TempRequirementDir, src, s.RequirementBucket, s.RequirementDir, dest)
+	if err != nil {
+		return nil, err
+	}
+
+	s.deleteFiles(s.TempBucket, s.TempRequirementDir, src)
+	return result, nil
+}
+
+func (s *LocalFsStorage) SaveRequirementFiles(ctx context.Context, filenames []string) (results []*SaveResult, err error) {
+	return s.saveFiles(ctx, s.TempBucket, s.TempRequirementDir, s.RequirementBucket, s.RequirementDir, filenames, true)
+}
+
+func (s *LocalFsStorage) GenerateRequirementFilename(mimeType string) (filename string, err error) {
+	return s.GenerateActivityFilename(mimeType)
+}
+
+func (s *LocalFsStorage) GenerateRequirementDocPutSign(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generatePutSignedUrl(ctx, s.TempBucket, path.Join(s.TempRequirementDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GenerateRequirementDocPutSignDirect(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generatePutSignedUrl(ctx, s.RequirementBucket, path.Join(s.RequirementDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GenerateRequirementDocGetSignTemp(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generateGetSignedUrl(ctx, s.TempBucket, path.Join(s.TempRequirementDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GenerateRequirementDocGetSign(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generateGetSignedUrl(ctx, s.RequirementBucket, path.Join(s.RequirementDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GenerateRequirementTemplateCoverLetterGetSign(ctx context.Context) (url *url.URL, err error) {
+	return s.generateGetSignedUrl(ctx, s.RequirementBucket, path.Join(s.RequirementTemplateDir, s.RequirementTemplateCoverLetterFilename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GetDismissalFileMetadata(ctx context.Context, filename string) (metadata *Metadata, err error) {
+	meta, err := s.getFileMetadata(ctx, s.DismissalBucket, path.Join(s.DismissalDir, filename))
+	if err != nil {
+		return nil, err
+	}
+
+	meta.Dir = s.DismissalDir
+	return meta, nil
+}
+
+func (s *LocalFsStorage) GetDismissalFile(ctx context.Context, filename string) (out io.ReadCloser, err error) {
+	return s.getFile(ctx, s.DismissalBucket, path.Join(s.DismissalDir, filename))
+}
+
+func (s *LocalFsStorage) PutDismissalFile(ctx context.Context, filename string, contentType string, in io.ReadSeeker) (err error) {
+	return s.putFile(ctx, s.DismissalBucket, path.Join(s.DismissalDir, filename), contentType, in)
+}
+
+func (s *LocalFsStorage) SaveDismissalFile(_ context.Context, src string, dest string) (result *SaveResult, err error) {
+	result, err = s.saveFile(s.TempBucket, s.TempDismissalDir, src, s.DismissalBucket, s.DismissalDir, dest)
+	if err != nil {
+		return nil, err
+	}
+
+	s.deleteFiles(s.TempBucket, s.TempDismissalDir, src)
+	return result, nil
+}
+
+func (s *LocalFsStorage) SaveDismissalFiles(ctx context.Context, filenames []string) (results []*SaveResult, err error) {
+	return s.saveFiles(ctx, s.TempBucket, s.TempDismissalDir, s.DismissalBucket, s.DismissalDir, filenames, true)
+}
+
+func (s *LocalFsStorage) GenerateDismissalDocName(mimeType string) (filename string, err error) {
+	return s.GenerateActivityFilename(mimeType)
+}
+
+func (s *LocalFsStorage) GenerateDismissalDocPutSign(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generatePutSignedUrl(ctx, s.TempBucket, path.Join(s.TempDismissalDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GenerateDismissalDocPutSignDirect(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generatePutSignedUrl(ctx, s.DismissalBucket, path.Join(s.DismissalDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GenerateDismissalDocGetSignTemp(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generateGetSignedUrl(ctx, s.TempBucket, path.Join(s.TempDismissalDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GenerateDismissalDocGetSign(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generateGetSignedUrl(ctx, s.DismissalBucket, path.Join(s.DismissalDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GenerateDismissalTemplateAcceptanceLetterGetSign(ctx context.Context) (url *url.URL, err error) {
+	return s.generateGetSignedUrl(ctx, s.DismissalBucket, path.Join(s.DismissalTemplateDir, s.DismissalTemplateAcceptanceLetterFilename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GetPromotionFileMetadata(ctx context.Context, filename string) (metadata *Metadata, err error) {
+	meta, err := s.getFileMetadata(ctx, s.PromotionBucket, path.Join(s.PromotionDir, filename))
+	if err != nil {
+		return nil, err
+	}
+
+	meta.Dir = s.PromotionDir
+	return meta, nil
+}
+
+func (s *LocalFsStorage) GetPromotionFile(ctx context.Context, filename string) (out io.ReadCloser, err error) {
+	return s.getFile(ctx, s.PromotionBucket, path.Join(s.PromotionDir, filename))
+}
+
+func (s *LocalFsStorage) PutPromotionFile(ctx context.Context, filename string, contentType string, in io.ReadSeeker) (err error) {
+	return s.putFile(ctx, s.PromotionBucket, path.Join(s.PromotionDir, filename), contentType, in)
+}
+
+func (s *LocalFsStorage) SavePromotionFile(_ context.Context, src string, dest string) (result *SaveResult, err error) {
+	result, err = s.saveFile(s.TempBucket, s.TempPromotionDir, src, s.PromotionBucket, s.PromotionDir, dest)
+	if err != nil {
+		return nil, err
+	}
+
+	s.deleteFiles(s.TempBucket, s.TempPromotionDir, src)
+	return result, nil
+}
+
+func (s *LocalFsStorage) SavePromotionFiles(ctx context.Context, filenames []string) (results []*SaveResult, err error) {
+	return s.saveFiles(ctx, s.TempBucket, s.TempPromotionDir, s.PromotionBucket, s.PromotionDir, filenames, true)
+}
+
+func (s *LocalFsStorage) GeneratePromotionDocName(mimeType string) (filename string, err error) {
+	return s.GenerateActivityFilename(mimeType)
+}
+
+func (s *LocalFsStorage) GeneratePromotionDocPutSign(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generatePutSignedUrl(ctx, s.TempBucket, path.Join(s.TempPromotionDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GeneratePromotionDocPutSignDirect(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generatePutSignedUrl(ctx, s.PromotionBucket, path.Join(s.PromotionDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GeneratePromotionDocGetSignTemp(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generateGetSignedUrl(ctx, s.TempBucket, path.Join(s.TempPromotionDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GeneratePromotionDocGetSign(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generateGetSignedUrl(ctx, s.PromotionBucket, path.Join(s.PromotionDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GeneratePromotionTemplatePakLetterGetSign(ctx context.Context) (url *url.URL, err error) {
+	return s.generateGetSignedUrl(ctx, s.PromotionBucket, path.Join(s.PromotionTemplateDir, s.PromotionTemplatePakLetterFilename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GeneratePromotionTemplateRecommendationLetterGetSign(ctx context.Context) (url *url.URL, err error) {
+	return s.generateGetSignedUrl(ctx, s.PromotionBucket, path.Join(s.PromotionTemplateDir, s.PromotionTemplateRecommendationLetterFilename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GetPromotionCpnsFileMetadata(ctx context.Context, filename string) (metadata *Metadata, err error) {
+	meta, err := s.getFileMetadata(ctx, s.PromotionCpnsBucket, path.Join(s.PromotionCpnsDir, filename))
+	if err != nil {
+		return nil, err
+	}
+
+	meta.Dir = s.PromotionCpnsDir
+	return meta, nil
+}
+
+func (s *LocalFsStorage) GetPromotionCpnsFileMetadataTemp(ctx context.Context, filename string) (metadata *Metadata, err error) {
+	meta, err := s.getFileMetadata(ctx, s.TempBucket, path.Join(s.TempPromotionCpnsDir, filename))
+	if err != nil {
+		return nil, err
+	}
+
+	meta.Dir = s.TempPromotionCpnsDir
+	return meta, nil
+}
+
+func (s *LocalFsStorage) GetPromotionCpnsFile(ctx context.Context, filename string) (out io.ReadCloser, err error) {
+	return s.getFile(ctx, s.PromotionCpnsBucket, path.Join(s.PromotionCpnsDir, filename))
+}
+
+func (s *LocalFsStorage) PutPromotionCpnsFile(ctx context.Context, filename string, contentType string, in io.ReadSeeker) (err error) {
+	return s.putFile(ctx, s.PromotionCpnsBucket, path.Join(s.PromotionCpnsDir, filename), contentType, in)
+}
+
+func (s *LocalFsStorage) SavePromotionCpnsFile(_ context.Context, src string, dest string, deleteOriginal bool) (result *SaveResult, err error) {
+	result, err = s.saveFile(s.TempBucket, s.TempPromotionCpnsDir, src, s.PromotionCpnsBucket, s.PromotionCpnsDir, dest)
+	if err != nil {
+		return nil, err
+	}
+
+	if deleteOriginal {
+		s.deleteFiles(s.TempBucket, s.TempPromotionCpnsDir, src)
+	}
+	return result, nil
+}
+
+func (s *LocalFsStorage) SavePromotionCpnsFiles(ctx context.Context, filenames []string, deleteOriginal bool) (results []*SaveResult, err error) {
+	return s.saveFiles(ctx, s.TempBucket, s.TempPromotionCpnsDir, s.PromotionCpnsBucket, s.PromotionCpnsDir, filenames, deleteOriginal)
+}
+
+func (s *LocalFsStorage) GeneratePromotionCpnsDocName(mimeType string) (filename string, err error) {
+	return s.GenerateActivityFilename(mimeType)
+}
+
+func (s *LocalFsStorage) GeneratePromotionCpnsDocPutSign(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generatePutSignedUrl(ctx, s.TempBucket, path.Join(s.TempPromotionCpnsDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GeneratePromotionCpnsDocGetSignTemp(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generateGetSignedUrl(ctx, s.TempBucket, path.Join(s.TempPromotionCpnsDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GeneratePromotionCpnsDocGetSign(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generateGetSignedUrl(ctx, s.PromotionCpnsBucket, path.Join(s.PromotionCpnsDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) DeletePromotionCpnsFilesTemp(_ context.Context, filenames []string) (err error) {
+	for _, filename := range filenames {
+		p, err := s.objectPath(s.TempBucket, path.Join(s.TempPromotionCpnsDir, filename))
+		if err != nil {
+			return err
+		}
+
+		err = os.Remove(p)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		_ = os.Remove(checksumPath(p))
+	}
+	return nil
+}
+
+func (s *LocalFsStorage) GetAssessmentTeamFileMetadata(ctx context.Context, filename string) (metadata *Metadata, err error) {
+	meta, err := s.getFileMetadata(ctx, s.AssessmentTeamBucket, path.Join(s.AssessmentTeamDir, filename))
+	if err != nil {
+		return nil, err
+	}
+
+	meta.Dir = s.AssessmentTeamDir
+	return meta, nil
+}
+
+func (s *LocalFsStorage) GetAssessmentTeamFile(ctx context.Context, filename string) (out io.ReadCloser, err error) {
+	return s.getFile(ctx, s.AssessmentTeamBucket, path.Join(s.AssessmentTeamDir, filename))
+}
+
+func (s *LocalFsStorage) PutAssessmentTeamFile(ctx context.Context, filename string, contentType string, in io.ReadSeeker) (err error) {
+	return s.putFile(ctx, s.AssessmentTeamBucket, path.Join(s.AssessmentTeamDir, filename), contentType, in)
+}
+
+func (s *LocalFsStorage) SaveAssessmentTeamFiles(ctx context.Context, filenames []string) (results []*SaveResult, err error) {
+	return s.saveFiles(ctx, s.TempBucket, s.TempAssessmentTeamDir, s.AssessmentTeamBucket, s.AssessmentTeamDir, filenames, true)
+}
+
+func (s *LocalFsStorage) GenerateAssessmentTeamFilename(mimeType string) (filename string, err error) {
+	return s.GenerateActivityFilename(mimeType)
+}
+
+func (s *LocalFsStorage) GenerateAssessmentTeamDocPutSign(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generatePutSignedUrl(ctx, s.TempBucket, path.Join(s.TempAssessmentTeamDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GenerateAssessmentTeamDocPutSignDirect(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generatePutSignedUrl(ctx, s.AssessmentTeamBucket, path.Join(s.AssessmentTeamDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GenerateAssessmentTeamDocGetSignTemp(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generateGetSignedUrl(ctx, s.TempBucket, path.Join(s.TempAssessmentTeamDir, filename), s.SignUrlExpire)
+}
+
+func (s *LocalFsStorage) GenerateAssessmentTeamDocGetSign(ctx context.Context, filename string) (url *url.URL, err error) {
+	return s.generateGetSignedUrl(ctx, s.AssessmentTeamBucket, path.Join(s.AssessmentTeamDir, filename), s.SignUrlExpire)
+}
@@ -31,6 +31,26 @@ type Storage interface {
 	AssessmentTeamStorage
 }
 
+// BucketChecker is implemented by storages that can check that their buckets are reachable, used by the health
+// checks.
+type BucketChecker interface {
+	// CheckBuckets returns an error if one of the buckets cannot be reached.
+	CheckBuckets(ctx context.Context) error
+}
+
+// uniqueBuckets returns the non-empty bucket names, without duplicates, in their order.
+func uniqueBuckets(buckets ...string) (unique []string) {
+	seen := make(map[string]struct{}, len(buckets))
+	for _, bucket := range buckets {
+		if _, ok := seen[bucket]; ok || bucket == "" {
+			continue
+		}
+		seen[bucket] = struct{}{}
+		unique = append(unique, bucket)
+	}
+	return unique
+}
+
 type ActivityStorage interface {
 	// GetActivityFileMetadata retrieves a file metadata (HEAD) from files in permanent bucket.
 	GetActivityFileMetadata(ctx context.Context, filename string) (metadata *Metadata, err error)
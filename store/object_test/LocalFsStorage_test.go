@@ -0,0 +1,127 @@
+package object_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fazrithe/siasn-jf-backend-git/store/object"
+	. "github.com/onsi/gomega"
+)
+
+func TestLocalFsStorage(t *testing.T) {
+	RegisterTestingT(t)
+
+	server := httptest.NewServer(nil)
+	defer server.Close()
+	baseUrl, _ := url.Parse(server.URL + "/api/object")
+
+	rootDir := t.TempDir()
+	storage := object.NewLocalFsStorage(rootDir, baseUrl, []byte("secret"))
+	storage.TempBucket = "temp"
+	storage.TempActivityDir = "activity"
+	storage.ActivityBucket = "permanent"
+	storage.ActivityDir = "activity"
+	server.Config.Handler = http.StripPrefix(baseUrl.Path, storage)
+
+	content := []byte("%PDF-1.4 support document")
+	sum := sha256.Sum256(content)
+
+	filename, err := storage.GenerateActivityFilename("application/pdf")
+	Expect(err).ToNot(HaveOccurred())
+
+	// Upload to the temporary bucket through a signed PUT URL.
+	putUrl, err := storage.GenerateActivityDocPutSign(context.Background(), filename)
+	Expect(err).ToNot(HaveOccurred())
+	req, _ := http.NewRequest(http.MethodPut, putUrl.String(), bytes.NewReader(content))
+	resp, err := http.DefaultClient.Do(req)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+	// A signed PUT URL cannot be used to download.
+	resp, err = http.Get(putUrl.String())
+	Expect(err).ToNot(HaveOccurred())
+	Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+
+	_, err = storage.GetActivityFileMetadata(context.Background(), filename)
+	Expect(err).To(Equal(object.ErrFileNotFound))
+
+	results, err := storage.SaveActivityFiles(context.Background(), []string{filename})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(results).To(HaveLen(1))
+	Expect(results[0].Bucket).To(Equal("permanent"))
+	Expect(results[0].Dir).To(Equal("activity"))
+	Expect(results[0].Checksum).To(Equal(hex.EncodeToString(sum[:])))
+
+	// The temporary file is deleted after being saved.
+	_, err = storage.SaveActivityFiles(context.Background(), []string{filename})
+	Expect(err).To(Equal(object.ErrTempFileNotFound))
+
+	meta, err := storage.GetActivityFileMetadata(context.Background(), filename)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(meta.Checksum).To(Equal(results[0].Checksum))
+	Expect(meta.ContentType).To(Equal("application/pdf"))
+	Expect(meta.ContentLength).To(Equal(len(content)))
+
+	// The checksum is stored when the file is written, and calculated again if the file changes afterwards.
+	p := filepath.Join(rootDir, "permanent", "activity", filename)
+	Expect(os.ReadFile(filepath.Join(rootDir, "permanent", "activity", "."+filename+".sha256"))).To(Equal([]byte(meta.Checksum)))
+	modified := []byte("%PDF-1.4 modified")
+	modifiedSum := sha256.Sum256(modified)
+	Expect(os.WriteFile(p, modified, 0o644)).To(Succeed())
+	later := time.Now().Add(time.Minute)
+	Expect(os.Chtimes(p, later, later)).To(Succeed())
+	meta, err = storage.GetActivityFileMetadata(context.Background(), filename)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(meta.Checksum).To(Equal(hex.EncodeToString(modifiedSum[:])))
+	Expect(os.WriteFile(p, content, 0o644)).To(Succeed())
+
+	getUrl, err := storage.GenerateActivityDocGetSign(context.Background(), filename)
+	Expect(err).ToNot(HaveOccurred())
+	resp, err = http.Get(getUrl.String())
+	Expect(err).ToNot(HaveOccurred())
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	Expect(resp.Header.Get("Content-Type")).To(Equal("application/pdf"))
+	Expect(body).To(Equal(content))
+
+	// Tampering with the URL invalidates the signature.
+	query := getUrl.Query()
+	query.Set("expires", "99999999999")
+	getUrl.RawQuery = query.Encode()
+	resp, err = http.Get(getUrl.String())
+	Expect(err).ToNot(HaveOccurred())
+	Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+
+	_, err = storage.GetActivityFile(context.Background(), "../../temp/activity/"+filename)
+	Expect(err).To(Equal(object.ErrInvalidObjectKey))
+}
+
+func TestLocalFsStorageCheckBuckets(t *testing.T) {
+	RegisterTestingT(t)
+
+	baseUrl, _ := url.Parse("http://127.0.0.1:8080/api/object")
+	rootDir := filepath.Join(t.TempDir(), "objects")
+	storage := object.NewLocalFsStorage(rootDir, baseUrl, []byte("secret"))
+
+	// The root directory is created on demand.
+	Expect(storage.CheckBuckets(context.Background())).To(Succeed())
+	entries, err := os.ReadDir(rootDir)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(entries).To(BeEmpty())
+
+	file := filepath.Join(t.TempDir(), "file")
+	Expect(os.WriteFile(file, nil, 0o644)).To(Succeed())
+	storage.RootDir = file
+	Expect(storage.CheckBuckets(context.Background())).ToNot(Succeed())
+}
@@ -1,19 +1,21 @@
 package store
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-	"mime"
 	"path"
 	"time"
 
 	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/docx"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/export"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/metricutil"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/search"
+	"github.com/fazrithe/siasn-jf-backend-git/store/esign"
 	"github.com/fazrithe/siasn-jf-backend-git/store/models"
 	"github.com/fazrithe/siasn-jf-backend-git/store/object"
 	"github.com/google/uuid"
@@ -172,6 +174,11 @@ func (c *Client) InsertPromotionAdmissionCtx(ctx context.Context, request *model
 		return "", ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("cannot insert entry to pengangkatan: %w", err))
 	}
 
+	_, err = c.insertStatusHistoryCtx(ctx, mtx, StatusHistoryModulePromotion, promotionId, 0, models.PromotionAdmissionStatusCreated, request.SubmitterAsnId, "")
+	if err != nil {
+		return "", err
+	}
+
 	if request.PakLetter != nil {
 		// Save PAK letter
 		_, err = c.PromotionStorage.SavePromotionFile(ctx,
@@ -234,9 +241,9 @@ func (c *Client) IsPromotionExistCtx(ctx context.Context, promotionId string) (i
 }
 
 // SetPromotionStatusAcceptedCtx sets a promotion status as models.PromotionAdmissionStatusAccepted.
-// If the status of the promotion is not models.PromotionAdmissionStatusCreated, this will return error code errnum.ErrCodePromotionAdmissionStatusProcessedFurther.
-// If the status is already models.PromotionAdmissionStatusAccepted, this will return error code errnum.ErrCodePromotionAdmissionStatusAlreadyAccepted.
-func (c *Client) SetPromotionStatusAcceptedCtx(ctx context.Context, promotion *models.PromotionAdmission) (modifiedAt time.Time, err error) {
+// If the promotion workflow does not allow it, this will return error code errnum.ErrCodeWorkflowTransitionInvalid.
+// If the promotion is outside of the scope, this will return error code errnum.ErrCodeEntryNotFound.
+func (c *Client) SetPromotionStatusAcceptedCtx(ctx context.Context, scope *AgencyScope, promotion *models.PromotionAdmission) (modifiedAt time.Time, err error) {
 	promotionId, err := uuid.Parse(promotion.PromotionId)
 	if err != nil {
 		return time.Time{}, ec.NewError(ErrCodeUuidInvalid, Errs[ErrCodeUuidInvalid], err)
@@ -252,7 +259,9 @@ func (c *Client) SetPromotionStatusAcceptedCtx(ctx context.Context, promotion *m
 	}()
 
 	currentStatus := 0
-	err = mtx.QueryRowContext(ctx, "select status from pengangkatan where uuid_pengangkatan = $1 for update", promotionId).Scan(&currentStatus)
+	asnId := ""
+	positionId := ""
+	err = mtx.QueryRowContext(ctx, "select status, asn_id, jabatan_fungsional_tujuan_id from pengangkatan where uuid_pengangkatan = $1 for update", promotionId).Scan(&currentStatus, &asnId, &positionId)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return time.Time{}, ErrEntryNotFound
@@ -261,12 +270,14 @@ func (c *Client) SetPromotionStatusAcceptedCtx(ctx context.Context, promotion *m
 		return time.Time{}, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
 
-	if currentStatus == models.PromotionAdmissionStatusAccepted {
-		return time.Time{}, ErrPromotionAdmissionStatusAlreadyAccepted
+	err = c.checkAsnAgencyScopeCtx(ctx, scope, asnId, positionId)
+	if err != nil {
+		return time.Time{}, err
 	}
 
-	if currentStatus != models.PromotionAdmissionStatusCreated {
-		return time.Time{}, ErrPromotionAdmissionStatusProcessedFurther
+	err = checkTransition(promotionWorkflow, currentStatus, WorkflowActionAccept, nil, promotion)
+	if err != nil {
+		return time.Time{}, err
 	}
 
 	modifiedAt = time.Now()
@@ -282,13 +293,18 @@ func (c *Client) SetPromotionStatusAcceptedCtx(ctx context.Context, promotion *m
 		return time.Time{}, ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], err)
 	}
 
+	_, err = c.insertStatusHistoryCtx(ctx, mtx, StatusHistoryModulePromotion, promotionId.String(), currentStatus, models.PromotionAdmissionStatusAccepted, promotion.SubmitterAsnId, "")
+	if err != nil {
+		return time.Time{}, err
+	}
+
 	return modifiedAt, nil
 }
 
 // SetPromotionStatusRejectCtx sets a promotion status as models.PromotionAdmissionStatusRejected.
-// If the status of the promotion is not models.PromotionAdmissionStatusCreated, this will return error code errnum.ErrCodePromotionAdmissionStatusProcessedFurther.
-// If the status is already models.PromotionAdmissionStatusRejected, this will return error code errnum.ErrCodePromotionAdmissionStatusAlreadyRejected.
-func (c *Client) SetPromotionStatusRejectCtx(ctx context.Context, promotion *models.PromotionReject) (modifiedAt time.Time, err error) {
+// If the promotion workflow does not allow it, this will return error code errnum.ErrCodeWorkflowTransitionInvalid.
+// If the promotion is outside of the scope, this will return error code errnum.ErrCodeEntryNotFound.
+func (c *Client) SetPromotionStatusRejectCtx(ctx context.Context, scope *AgencyScope, promotion *models.PromotionReject) (modifiedAt time.Time, err error) {
 	promotionId, err := uuid.Parse(promotion.PromotionId)
 	if err != nil {
 		return time.Time{}, ec.NewError(ErrCodeUuidInvalid, Errs[ErrCodeUuidInvalid], err)
@@ -304,7 +320,9 @@ func (c *Client) SetPromotionStatusRejectCtx(ctx context.Context, promotion *mod
 	}()
 
 	currentStatus := 0
-	err = mtx.QueryRowContext(ctx, "select status from pengangkatan where uuid_pengangkatan = $1 for update", promotionId).Scan(&currentStatus)
+	asnId := ""
+	positionId := ""
+	err = mtx.QueryRowContext(ctx, "select status, asn_id, jabatan_fungsional_tujuan_id from pengangkatan where uuid_pengangkatan = $1 for update", promotionId).Scan(&currentStatus, &asnId, &positionId)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return time.Time{}, ErrEntryNotFound
@@ -313,12 +331,14 @@ func (c *Client) SetPromotionStatusRejectCtx(ctx context.Context, promotion *mod
 		return time.Time{}, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
 
-	if currentStatus == models.PromotionAdmissionStatusRejected {
-		return time.Time{}, ErrPromotionAdmissionStatusAlreadyRejected
+	err = c.checkAsnAgencyScopeCtx(ctx, scope, asnId, positionId)
+	if err != nil {
+		return time.Time{}, err
 	}
 
-	if currentStatus != models.PromotionAdmissionStatusCreated {
-		return time.Time{}, ErrPromotionAdmissionStatusProcessedFurther
+	err = checkTransition(promotionWorkflow, currentStatus, WorkflowActionReject, nil, promotion)
+	if err != nil {
+		return time.Time{}, err
 	}
 
 	modifiedAt = time.Now()
@@ -335,25 +355,61 @@ func (c *Client) SetPromotionStatusRejectCtx(ctx context.Context, promotion *mod
 		return time.Time{}, ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], err)
 	}
 
+	_, err = c.insertStatusHistoryCtx(ctx, mtx, StatusHistoryModulePromotion, promotionId.String(), currentStatus, models.PromotionAdmissionStatusRejected, promotion.SubmitterAsnId, promotion.RejectReason)
+	if err != nil {
+		return time.Time{}, err
+	}
+
 	return modifiedAt, nil
 }
 
+var promotionAdmissionSearchTable = &admissionSearchTable{
+	name:           "pengangkatan",
+	idColumn:       "uuid_pengangkatan",
+	dateColumn:     "tgl_doc_surat_rekomendasi",
+	positionColumn: "jabatan_fungsional_tujuan_id",
+	asnColumn:      "asn_id",
+}
+
+// promotionAdmissionSearchQueryCtx builds the query of SearchPromotionAdmissionsPaginatedCtx and
+// ExportPromotionAdmissionsCtx from filter, see applyAdmissionSearchOptionsCtx for the errors returned.
+func (c *Client) promotionAdmissionSearchQueryCtx(ctx context.Context, filter *PromotionAdmissionSearchFilter) (q *admissionSearchQuery, err error) {
+	q = newAdmissionSearchQuery(promotionAdmissionSearchTable)
+	if filter.AdmissionStatus > 0 {
+		q.where("status = %s", filter.AdmissionStatus)
+	}
+	if filter.AdmissionType > 0 {
+		q.where("jenis_pengangkatan = %s", filter.AdmissionType)
+	}
+	if filter.AdmissionDate != "" {
+		q.where("tgl_doc_surat_rekomendasi::date = %s", string(filter.AdmissionDate))
+	}
+
+	err = c.applyAdmissionSearchOptionsCtx(ctx, q, &filter.AdmissionSearchOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
 // SearchPromotionAdmissionsPaginatedCtx searches for the list of promotion admissions.
 // It will return empty slice if no admissions are found.
 func (c *Client) SearchPromotionAdmissionsPaginatedCtx(ctx context.Context, filter *PromotionAdmissionSearchFilter) (result *search.PaginatedList, err error) {
 	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
 	profileMdb := metricutil.NewDB(c.ProfileDb, c.SqlMetrics)
 
-	c.Logger.Debugf("%v", (filter.PageNumber-1)*filter.CountPerPage)
-	admissionRows, err := mdb.QueryContext(
-		ctx,
-		"select uuid_pengangkatan, asn_id, status, tgl_doc_surat_rekomendasi, jenis_pengangkatan from pengangkatan where ($1 <= 0 or status = $1) and ($2 <= 0 or jenis_pengangkatan = $2) and ($3::date is null or tgl_doc_surat_rekomendasi::date = $3) order by tgl_doc_surat_rekomendasi desc limit $4 offset $5",
-		filter.AdmissionStatus,
-		filter.AdmissionType,
-		sql.NullString{Valid: string(filter.AdmissionDate) != "", String: string(filter.AdmissionDate)},
-		filter.CountPerPage+1,
-		(filter.PageNumber-1)*filter.CountPerPage,
-	)
+	q, err := c.promotionAdmissionSearchQueryCtx(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := q.paginatedQuery("uuid_pengangkatan, asn_id, status, tgl_doc_surat_rekomendasi, jenis_pengangkatan", &filter.AdmissionSearchOptions, filter.PageNumber, filter.CountPerPage)
+	if err != nil {
+		return nil, err
+	}
+
+	admissionRows, err := mdb.QueryContext(ctx, query, q.args...)
 	if err != nil {
 		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
@@ -363,7 +419,7 @@ func (c *Client) SearchPromotionAdmissionsPaginatedCtx(ctx context.Context, filt
 	asnIds := make([]string, 0)
 	for admissionRows.Next() {
 		admission := &models.PromotionItem{}
-		err = admissionRows.Scan(
+		err = q.scan(admissionRows,
 			&admission.PromotionId,
 			&admission.AsnId,
 			&admission.Status,
@@ -414,75 +470,211 @@ func (c *Client) SearchPromotionAdmissionsPaginatedCtx(ctx context.Context, filt
 
 	return &search.PaginatedList{
 		Data:     admissions,
-		Metadata: search.CreatePaginatedListMetadataNoTotalNext(filter.PageNumber, len(admissions), hasNext),
+		Metadata: q.metadata(filter.PageNumber, len(admissions), hasNext),
 	}, nil
 }
 
-// GetPromotionStatusStatisticCtx returns the number of promotion items for each status.
-func (c *Client) GetPromotionStatusStatisticCtx(ctx context.Context) (statistics []*models.StatisticStatus, err error) {
+// ExportPromotionAdmissionsCtx writes every promotion admission matching filter into table, with a header row.
+// Unlike SearchPromotionAdmissionsPaginatedCtx, the admissions are not paged, filter.PageNumber and
+// filter.CountPerPage are ignored. The ASN and functional position names are resolved in batches, so the admissions
+// are never kept in memory at once. Nothing is written into table if the search fails.
+func (c *Client) ExportPromotionAdmissionsCtx(ctx context.Context, filter *PromotionAdmissionSearchFilter, table export.Writer) (err error) {
 	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
-	rows, err := mdb.QueryContext(ctx, "select status, jumlah from pengangkatan_status_statistik")
+	profileMdb := metricutil.NewDB(c.ProfileDb, c.SqlMetrics)
+	referenceMdb := metricutil.NewDB(c.ReferenceDb, c.SqlMetrics)
+
+	q, err := c.promotionAdmissionSearchQueryCtx(ctx, filter)
 	if err != nil {
-		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+		return err
 	}
-	defer rows.Close()
 
-	statistics = make([]*models.StatisticStatus, 0)
-	statisticMap := make(map[int]*models.StatisticStatus)
-	for status := range models.PromotionAdmissionStatuses {
-		statusStatistic := &models.StatisticStatus{
-			Status: status,
+	admissionRows, err := mdb.QueryContext(
+		ctx,
+		q.query("coalesce(no_usulan, ''), asn_id, status, tgl_doc_surat_rekomendasi, jenis_pengangkatan, coalesce(jabatan_fungsional_tujuan_id, '')"),
+		q.args...,
+	)
+	if err != nil {
+		return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+	defer admissionRows.Close()
+
+	err = table.WriteRow([]string{"No. Usulan", "NIP", "Nama", "Jenis Pengangkatan", "Jabatan Fungsional Tujuan", "Status", "Tanggal Surat Rekomendasi"})
+	if err != nil {
+		return err
+	}
+
+	// The promotion item does not have every exported column.
+	type exportedPromotion struct {
+		models.PromotionItem
+		AdmissionNumber     string
+		PromotionPositionId string
+	}
+
+	admissions := make([]*exportedPromotion, 0, exportBatchSize)
+	writeAdmissions := func() (err error) {
+		if len(admissions) == 0 {
+			return nil
+		}
+
+		asnIds := make([]string, 0, len(admissions))
+		positionIds := make([]string, 0, len(admissions))
+		for _, admission := range admissions {
+			asnIds = append(asnIds, admission.AsnId)
+			positionIds = append(positionIds, admission.PromotionPositionId)
+		}
+
+		asns, err := c.getAsnNipNames(ctx, profileMdb, asnIds)
+		if err != nil {
+			return err
+		}
+		positions, err := c.getFunctionalPositionNames(ctx, referenceMdb, positionIds)
+		if err != nil {
+			return err
+		}
+
+		for _, admission := range admissions {
+			asn := asns[admission.AsnId]
+			if asn == nil {
+				asn = &asnNipName{}
+			}
+
+			err = table.WriteRow([]string{
+				admission.AdmissionNumber,
+				asn.Nip,
+				asn.AsnName,
+				exportName(models.PromotionTypeNames, admission.PromotionType),
+				positions[admission.PromotionPositionId],
+				exportName(models.PromotionAdmissionStatusNames, admission.Status),
+				string(admission.RecommendationLetterDate),
+			})
+			if err != nil {
+				return err
+			}
 		}
-		statistics = append(statistics, statusStatistic)
-		statisticMap[status] = statusStatistic
+
+		admissions = admissions[:0]
+		return nil
 	}
-	for rows.Next() {
-		var temp models.StatisticStatus
-		err = rows.Scan(&temp.Status, &temp.Count)
+
+	for admissionRows.Next() {
+		admission := &exportedPromotion{}
+		err = admissionRows.Scan(
+			&admission.AdmissionNumber,
+			&admission.AsnId,
+			&admission.Status,
+			&admission.RecommendationLetterDate,
+			&admission.PromotionType,
+			&admission.PromotionPositionId,
+		)
 		if err != nil {
-			return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+			return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 		}
-		statusStatistic, ok := statisticMap[temp.Status]
-		if ok {
-			statusStatistic.Count = temp.Count
+
+		admissions = append(admissions, admission)
+		if len(admissions) == exportBatchSize {
+			err = writeAdmissions()
+			if err != nil {
+				return err
+			}
 		}
 	}
-	if err = rows.Err(); err != nil {
-		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	if err = admissionRows.Err(); err != nil {
+		return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
 
-	return statistics, nil
+	return writeAdmissions()
 }
 
-// GeneratePromotionLetterCtx generates a promotion letter and store it in the storage.
-// Filename is generated by adding a pdf extension to promotionId. The base filename is returned,
-// it can be accessed in the promotion letter subdir in permanent bucket.
+// promotionStatisticSource is the source of the promotion status statistics. Promotions do not store their agency, the
+// work agency of their ASN is used instead.
+var promotionStatisticSource = &statisticSource{
+	table:          "pengangkatan",
+	statuses:       models.PromotionAdmissionStatuses,
+	dateColumn:     "tgl_usulan",
+	asnColumn:      "asn_id",
+	positionColumn: "jabatan_fungsional_tujuan_id",
+}
+
+// GetPromotionStatusStatisticCtx returns the number of promotion items for each status, limited to scope and filter.
+// filter.GroupBy is ignored.
+func (c *Client) GetPromotionStatusStatisticCtx(ctx context.Context, scope *AgencyScope, filter *StatisticFilter) (statistics []*models.StatisticStatus, err error) {
+	periods, err := c.getStatusStatisticCtx(ctx, promotionStatisticSource, scope, filter, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return periods[0].Statuses, nil
+}
+
+// GetPromotionStatusStatisticSeriesCtx returns the number of promotion items for each status in each period of
+// filter.GroupBy, limited to scope and filter.
+func (c *Client) GetPromotionStatusStatisticSeriesCtx(ctx context.Context, scope *AgencyScope, filter *StatisticFilter) (periods []*models.StatisticPeriod, err error) {
+	return c.getStatusStatisticCtx(ctx, promotionStatisticSource, scope, filter, true)
+}
+
+// GeneratePromotionLetterCtx queues a job that generates a promotion letter, signs it electronically as identity with
+// the client Signer and store it in the storage, see runPromotionLetterJobCtx. Only the verifier who accepted the
+// promotion, signerAsnId, can sign its letter, other users get errnum.ErrCodeRoleUnauthorized. If the promotion
+// workflow does not allow it, e.g. the promotion is not accepted, this will return error code
+// errnum.ErrCodeWorkflowTransitionInvalid.
 //
-// To help reduce performance load, it is only generated once, unless forceRegenerate is set to true.
-func (c *Client) GeneratePromotionLetterCtx(ctx context.Context, promotionId string, forceRegenerate bool) (filename string, err error) {
-	filename = fmt.Sprintf("%s.pdf", promotionId)
-	fullPath := path.Join(PromotionPromotionLetterSubdir, filename)
+// Promotions outside of the scope are treated as not found.
+func (c *Client) GeneratePromotionLetterCtx(ctx context.Context, scope *AgencyScope, promotionId string, signerAsnId string, identity *esign.Identity) (job *models.Job, err error) {
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
 
-	if !forceRegenerate {
-		fileFound := true
-		meta, err := c.PromotionStorage.GetPromotionFileMetadata(ctx, fullPath)
-		if err != nil && !errors.Is(err, object.ErrFileNotFound) {
-			return "", ec.NewError(ErrCodeStorageGetMetadataFail, Errs[ErrCodeStorageGetMetadataFail], err)
+	status := 0
+	statusBy := ""
+	functionalPositionId := ""
+	asnId := ""
+	err = mdb.QueryRowContext(
+		ctx,
+		"select status, status_by, asn_id, jabatan_fungsional_tujuan_id from pengangkatan where uuid_pengangkatan = $1",
+		promotionId,
+	).Scan(
+		&status,
+		&statusBy,
+		&asnId,
+		&functionalPositionId,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrEntryNotFound
 		}
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
 
-		if errors.Is(err, object.ErrFileNotFound) {
-			fileFound = false
-		} else {
-			if ct, _, err := mime.ParseMediaType(meta.ContentType); meta.ContentLength <= 0 || err != nil || ct != "application/pdf" {
-				fileFound = false
-			}
-		}
+	err = c.checkAsnAgencyScopeCtx(ctx, scope, asnId, functionalPositionId)
+	if err != nil {
+		return nil, err
+	}
 
-		if fileFound {
-			return filename, nil
-		}
+	err = checkTransition(promotionWorkflow, status, WorkflowActionSignLetter, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if statusBy != signerAsnId {
+		return nil, ec.NewError(ErrCodeRoleUnauthorized, Errs[ErrCodeRoleUnauthorized], fmt.Errorf("user %s cannot sign the promotion letter", signerAsnId))
 	}
 
+	return c.enqueueJobCtx(ctx, JobKindPromotionLetter, StatusHistoryModulePromotion, promotionId, nil, signerAsnId, identity)
+}
+
+// runPromotionLetterJobCtx generates the promotion letter queued by GeneratePromotionLetterCtx, signs it as the
+// identity of the job and store it in the storage. The letter is stored only if signing succeeds. The status of the
+// promotion and its signer are checked again since they may have changed while the job was queued.
+// Filename is generated by adding a pdf extension to promotionId. The base filename is returned,
+// it can be accessed in the promotion letter subdir in permanent bucket.
+func (c *Client) runPromotionLetterJobCtx(ctx context.Context, job *queuedJob) (filename string, err error) {
+	if job.Identity == nil {
+		return "", ErrJobIdentityExpired
+	}
+
+	promotionId := job.EntityId
+	signerAsnId := job.AsnId
+	filename = fmt.Sprintf("%s.pdf", promotionId)
+	fullPath := path.Join(PromotionPromotionLetterSubdir, filename)
+
 	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
 	referenceMtx, err := c.createMtxDb(ctx, c.ReferenceDb)
 	if err != nil {
@@ -500,15 +692,17 @@ func (c *Client) GeneratePromotionLetterCtx(ctx context.Context, promotionId str
 	}()
 
 	status := 0
+	statusBy := ""
 	functionalPositionId := ""
 	asnId := ""
 	data := &PromotionLetterTemplate{}
 	err = mdb.QueryRowContext(
 		ctx,
-		"select status, no_usulan, asn_id, to_char(tgl_usulan, 'YYYY-MM-DD'), jabatan_fungsional_tujuan_id from pengangkatan where uuid_pengangkatan = $1",
+		"select status, status_by, no_usulan, asn_id, to_char(tgl_usulan, 'YYYY-MM-DD'), jabatan_fungsional_tujuan_id from pengangkatan where uuid_pengangkatan = $1",
 		promotionId,
 	).Scan(
 		&status,
+		&statusBy,
 		&data.AdmissionNumber,
 		&asnId,
 		&data.AdmissionDate,
@@ -521,8 +715,13 @@ func (c *Client) GeneratePromotionLetterCtx(ctx context.Context, promotionId str
 		return "", ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
 
-	if status != models.PromotionAdmissionStatusAccepted {
-		return "", ErrPromotionAdmissionStatusNotAccepted
+	err = checkTransition(promotionWorkflow, status, WorkflowActionSignLetter, nil, nil)
+	if err != nil {
+		return "", err
+	}
+
+	if statusBy != signerAsnId {
+		return "", ec.NewError(ErrCodeRoleUnauthorized, Errs[ErrCodeRoleUnauthorized], fmt.Errorf("user %s cannot sign the promotion letter", signerAsnId))
 	}
 
 	positions, err := c.getFunctionalPositionNames(ctx, referenceMtx, []string{functionalPositionId})
@@ -542,13 +741,19 @@ func (c *Client) GeneratePromotionLetterCtx(ctx context.Context, promotionId str
 	data.PromotionPositionName = positions[functionalPositionId]
 	data.Name = detail.Name
 
-	err = c.generatePromotionLetterCtx(ctx, fullPath, data)
+	document := &bytes.Buffer{}
+	err = c.generatePromotionLetterCtx(ctx, fullPath, data, bufferPutFunc(document))
 	if err != nil {
-		if errors.Is(err, docx.ErrSiasnRendererBadTemplate) {
+		if errors.Is(err, docx.ErrBadTemplate) {
 			return "", ec.NewError(ErrCodeDocumentGenerateBadTemplate, Errs[ErrCodeDocumentGenerateBadTemplate], err)
 		}
 		return "", ec.NewError(ErrCodeDocumentGenerate, Errs[ErrCodeDocumentGenerate], err)
 	}
 
+	err = c.signAndPutPdfCtx(ctx, job.Identity, document, fullPath, c.PromotionStorage.PutPromotionFile)
+	if err != nil {
+		return "", err
+	}
+
 	return filename, nil
 }
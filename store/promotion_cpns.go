@@ -6,9 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"path"
+	"strconv"
 
 	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/export"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/metricutil"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/search"
 	"github.com/fazrithe/siasn-jf-backend-git/store/models"
@@ -37,7 +39,8 @@ func (c *Client) getPromotionCpnsDhCtx(ctx context.Context, dh metricutil.DbHand
 }
 
 // GetPromotionCpnsAdmissionDetailCtx retrieves detail about CPNS promotion admission detail.
-func (c *Client) GetPromotionCpnsAdmissionDetailCtx(ctx context.Context, promotionCpnsId string) (admission *models.PromotionCpnsAdmission, err error) {
+// If the admission is outside of the scope, errnum.ErrEntryNotFound is returned.
+func (c *Client) GetPromotionCpnsAdmissionDetailCtx(ctx context.Context, promotionCpnsId string, scope *AgencyScope) (admission *models.PromotionCpnsAdmission, err error) {
 	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
 	profileMdb := metricutil.NewDB(c.ProfileDb, c.SqlMetrics)
 	referenceMdb := metricutil.NewDB(c.ReferenceDb, c.SqlMetrics)
@@ -83,6 +86,11 @@ from pengangkatan_cpns where pengangkatan_cpns_id = $1
 		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
 
+	err = c.checkAsnAgencyScopeCtx(ctx, scope, admission.AsnId, admission.PromotionPositionId)
+	if err != nil {
+		return nil, err
+	}
+
 	asns, err := c.getAsnNipNames(ctx, profileMdb, []string{admission.AsnId})
 	if err != nil {
 		return nil, err
@@ -106,6 +114,33 @@ from pengangkatan_cpns where pengangkatan_cpns_id = $1
 	return admission, nil
 }
 
+var promotionCpnsAdmissionSearchTable = &admissionSearchTable{
+	name:           "pengangkatan_cpns",
+	idColumn:       "pengangkatan_cpns_id",
+	dateColumn:     "tgl_usulan",
+	positionColumn: "jabatan_fungsional_tujuan_id",
+	asnColumn:      "asn_id",
+}
+
+// promotionCpnsAdmissionSearchQueryCtx builds the query of SearchPromotionCpnsAdmissionsPaginatedCtx and
+// ExportPromotionCpnsAdmissionsCtx from filter, see applyAdmissionSearchOptionsCtx for the errors returned.
+func (c *Client) promotionCpnsAdmissionSearchQueryCtx(ctx context.Context, filter *PromotionCpnsAdmissionSearchFilter) (q *admissionSearchQuery, err error) {
+	q = newAdmissionSearchQuery(promotionCpnsAdmissionSearchTable)
+	if filter.AdmissionStatus > 0 {
+		q.where("status = %s", filter.AdmissionStatus)
+	}
+	if filter.AdmissionDate != "" {
+		q.where("tgl_usulan::date = %s", filter.AdmissionDate)
+	}
+
+	err = c.applyAdmissionSearchOptionsCtx(ctx, q, &filter.AdmissionSearchOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
 // SearchPromotionCpnsAdmissionsPaginatedCtx searches for the list of CPNS promotion admissions.
 // It will return empty slice if no admissions are found.
 func (c *Client) SearchPromotionCpnsAdmissionsPaginatedCtx(ctx context.Context, filter *PromotionCpnsAdmissionSearchFilter) (result *search.PaginatedList, err error) {
@@ -119,25 +154,17 @@ func (c *Client) SearchPromotionCpnsAdmissionsPaginatedCtx(ctx context.Context,
 		c.completeMtx(referenceMtx, err)
 	}()
 
-	admissionRows, err := mdb.QueryContext(
-		ctx,
-		`
-select
-    pengangkatan_cpns_id,
-	asn_id,
-	jabatan_fungsional_tujuan_id,
-	angka_kredit_pertama,
-	unor_id,
-	tgl_usulan,
-	no_usulan,
-	status
-from pengangkatan_cpns where ($1 <= 0 or status = $1) and ($2::date is null or tgl_usulan::date = $2) order by tgl_usulan desc limit $3 offset $4
-`,
-		filter.AdmissionStatus,
-		sql.NullString{Valid: filter.AdmissionDate != "", String: filter.AdmissionDate},
-		filter.CountPerPage+1,
-		(filter.PageNumber-1)*filter.CountPerPage,
-	)
+	q, err := c.promotionCpnsAdmissionSearchQueryCtx(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := q.paginatedQuery("pengangkatan_cpns_id, asn_id, jabatan_fungsional_tujuan_id, angka_kredit_pertama, unor_id, tgl_usulan, no_usulan, status", &filter.AdmissionSearchOptions, filter.PageNumber, filter.CountPerPage)
+	if err != nil {
+		return nil, err
+	}
+
+	admissionRows, err := mdb.QueryContext(ctx, query, q.args...)
 	if err != nil {
 		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
@@ -158,7 +185,7 @@ from pengangkatan_cpns where ($1 <= 0 or status = $1) and ($2::date is null or t
 			break
 		}
 		admission := &models.PromotionCpnsItem{}
-		err = admissionRows.Scan(
+		err = q.scan(admissionRows,
 			&admission.PromotionCpnsId,
 			&admission.AsnId,
 			&admission.PromotionPositionId,
@@ -206,35 +233,128 @@ from pengangkatan_cpns where ($1 <= 0 or status = $1) and ($2::date is null or t
 
 	return &search.PaginatedList{
 		Data:     admissions,
-		Metadata: search.CreatePaginatedListMetadataNoTotalNext(filter.PageNumber, len(admissions), hasNext),
+		Metadata: q.metadata(filter.PageNumber, len(admissions), hasNext),
 	}, nil
 }
 
-// checkPromotionCpnsAdmissionSubmitRequest checks whether the request to create a new CPNS promotion is valid.
-func (c *Client) checkPromotionCpnsAdmissionSubmitRequest(request *models.PromotionCpnsAdmission) (err error) {
-	if request.AsnId == "" {
-		return ec.NewError(ErrCodePromotionCpnsAdmissionFieldInvalid, Errs[ErrCodePromotionCpnsAdmissionFieldInvalid], errors.New("asn_id is required"))
+// ExportPromotionCpnsAdmissionsCtx writes every CPNS promotion admission matching filter into table, with a header
+// row. Unlike SearchPromotionCpnsAdmissionsPaginatedCtx, the admissions are not paged, filter.PageNumber and
+// filter.CountPerPage are ignored. The ASN, functional position and unor names are resolved in batches, so the
+// admissions are never kept in memory at once. Nothing is written into table if the search fails.
+func (c *Client) ExportPromotionCpnsAdmissionsCtx(ctx context.Context, filter *PromotionCpnsAdmissionSearchFilter, table export.Writer) (err error) {
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+	profileMdb := metricutil.NewDB(c.ProfileDb, c.SqlMetrics)
+	referenceMdb := metricutil.NewDB(c.ReferenceDb, c.SqlMetrics)
+
+	q, err := c.promotionCpnsAdmissionSearchQueryCtx(ctx, filter)
+	if err != nil {
+		return err
 	}
 
-	if request.AdmissionNumber == "" {
-		return ec.NewError(ErrCodePromotionCpnsAdmissionFieldInvalid, Errs[ErrCodePromotionCpnsAdmissionFieldInvalid], errors.New("nomor_usulan is required"))
+	admissionRows, err := mdb.QueryContext(
+		ctx,
+		q.query("asn_id, jabatan_fungsional_tujuan_id, angka_kredit_pertama, unor_id, tgl_usulan, no_usulan, status"),
+		q.args...,
+	)
+	if err != nil {
+		return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
+	defer admissionRows.Close()
 
-	if request.PromotionPositionId == "" {
-		return ec.NewError(ErrCodePromotionCpnsAdmissionFieldInvalid, Errs[ErrCodePromotionCpnsAdmissionFieldInvalid], errors.New("jabatan_fungsional_tujuan_id is required"))
+	err = table.WriteRow([]string{"No. Usulan", "Tanggal Usulan", "NIP", "Nama", "Jabatan Fungsional Tujuan", "Angka Kredit Pertama", "Unit Organisasi", "Status"})
+	if err != nil {
+		return err
 	}
 
-	if request.OrganizationUnitId == "" {
-		return ec.NewError(ErrCodePromotionCpnsAdmissionFieldInvalid, Errs[ErrCodePromotionCpnsAdmissionFieldInvalid], errors.New("unor_id is required"))
+	admissions := make([]*models.PromotionCpnsItem, 0, exportBatchSize)
+	writeAdmissions := func() (err error) {
+		if len(admissions) == 0 {
+			return nil
+		}
+
+		asnIds := make([]string, 0, len(admissions))
+		positionIds := make([]string, 0, len(admissions))
+		unorIds := make([]string, 0, len(admissions))
+		for _, admission := range admissions {
+			asnIds = append(asnIds, admission.AsnId)
+			positionIds = append(positionIds, admission.PromotionPositionId)
+			unorIds = append(unorIds, admission.OrganizationUnitId)
+		}
+
+		asns, err := c.getAsnNipNames(ctx, profileMdb, asnIds)
+		if err != nil {
+			return err
+		}
+		positions, err := c.getFunctionalPositionNames(ctx, referenceMdb, positionIds)
+		if err != nil {
+			return err
+		}
+		unors, err := c.getOrganizationUnitNames(ctx, referenceMdb, unorIds)
+		if err != nil {
+			return err
+		}
+
+		for _, admission := range admissions {
+			asn := asns[admission.AsnId]
+			if asn == nil {
+				asn = &asnNipName{}
+			}
+
+			err = table.WriteRow([]string{
+				admission.AdmissionNumber,
+				string(admission.AdmissionDate),
+				asn.Nip,
+				asn.AsnName,
+				positions[admission.PromotionPositionId],
+				strconv.Itoa(admission.FirstCreditNumber),
+				unors[admission.OrganizationUnitId],
+				exportName(models.PromotionCpnsAdmissionStatusNames, admission.Status),
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		admissions = admissions[:0]
+		return nil
 	}
 
-	_, err = request.AdmissionDate.Time()
-	if err != nil {
-		return ec.NewError(ErrCodePromotionCpnsAdmissionFieldInvalid, Errs[ErrCodePromotionCpnsAdmissionFieldInvalid], fmt.Errorf("tanggal_usulan cannot be parsed: %w", err))
+	for admissionRows.Next() {
+		admission := &models.PromotionCpnsItem{}
+		err = admissionRows.Scan(
+			&admission.AsnId,
+			&admission.PromotionPositionId,
+			&admission.FirstCreditNumber,
+			&admission.OrganizationUnitId,
+			&admission.AdmissionDate,
+			&admission.AdmissionNumber,
+			&admission.Status,
+		)
+		if err != nil {
+			return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+		}
+
+		admissions = append(admissions, admission)
+		if len(admissions) == exportBatchSize {
+			err = writeAdmissions()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err = admissionRows.Err(); err != nil {
+		return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
 
-	if request.PakLetter == nil {
-		return ec.NewError(ErrCodePromotionCpnsAdmissionFieldInvalid, Errs[ErrCodePromotionCpnsAdmissionFieldInvalid], errors.New("surat_pak is required"))
+	return writeAdmissions()
+}
+
+// checkPromotionCpnsAdmissionSubmitRequest checks whether the request to create a new CPNS promotion is valid.
+// The fields are checked against their validate tags first, every invalid field is listed in the error data.
+func (c *Client) checkPromotionCpnsAdmissionSubmitRequest(request *models.PromotionCpnsAdmission) (err error) {
+	err = validateRequest(request, ErrCodePromotionCpnsAdmissionFieldInvalid)
+	if err != nil {
+		return err
 	}
 
 	if request.PakLetter.Filename == "" {
@@ -250,10 +370,6 @@ func (c *Client) checkPromotionCpnsAdmissionSubmitRequest(request *models.Promot
 		return ec.NewError(ErrCodePromotionCpnsAdmissionFieldInvalid, Errs[ErrCodePromotionCpnsAdmissionFieldInvalid], fmt.Errorf("tgl_dokumen in surat_pak cannot be parsed: %w", err))
 	}
 
-	if request.PromotionLetter == nil {
-		return ec.NewError(ErrCodePromotionCpnsAdmissionFieldInvalid, Errs[ErrCodePromotionCpnsAdmissionFieldInvalid], errors.New("surat_pengangkatan is required"))
-	}
-
 	if request.PromotionLetter.DocumentNumber == "" {
 		return ec.NewError(ErrCodePromotionCpnsAdmissionFieldInvalid, Errs[ErrCodePromotionCpnsAdmissionFieldInvalid], errors.New("no_dokumen in surat_pengangkatan is required"))
 	}
@@ -321,6 +437,11 @@ func (c *Client) SubmitPromotionCpnsAdmissionCtx(ctx context.Context, request *m
 		return "", ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], err)
 	}
 
+	_, err = c.insertStatusHistoryCtx(ctx, mtx, StatusHistoryModulePromotionCpns, admissionId, 0, models.PromotionCpnsAdmissionStatusCreated, request.SubmitterAsnId, "")
+	if err != nil {
+		return "", err
+	}
+
 	tempFilenamePak := path.Join(PromotionCpnsPakLetterSubdir, request.PakLetter.Filename)
 	tempFilenamePromotionLetter := path.Join(PromotionCpnsPromotionLetterSubdir, request.PromotionLetter.Filename)
 	filenamePak := path.Join(PromotionCpnsPakLetterSubdir, fmt.Sprintf("%s.pdf", admissionId))
@@ -347,38 +468,29 @@ func (c *Client) SubmitPromotionCpnsAdmissionCtx(ctx context.Context, request *m
 	return admissionId, nil
 }
 
-// GetPromotionCpnsStatusStatisticCtx returns the number of cpns promotion items for each status.
-func (c *Client) GetPromotionCpnsStatusStatisticCtx(ctx context.Context) (statistics []*models.StatisticStatus, err error) {
-	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
-	rows, err := mdb.QueryContext(ctx, "select status, jumlah from pengangkatan_cpns_status_statistik")
+// promotionCpnsStatisticSource is the source of the cpns promotion status statistics. CPNS promotions do not store
+// their agency, the work agency of their ASN is used instead.
+var promotionCpnsStatisticSource = &statisticSource{
+	table:          "pengangkatan_cpns",
+	statuses:       models.PromotionCpnsAdmissionStatuses,
+	dateColumn:     "tgl_usulan",
+	asnColumn:      "asn_id",
+	positionColumn: "jabatan_fungsional_tujuan_id",
+}
+
+// GetPromotionCpnsStatusStatisticCtx returns the number of cpns promotion items for each status, limited to scope
+// and filter. filter.GroupBy is ignored.
+func (c *Client) GetPromotionCpnsStatusStatisticCtx(ctx context.Context, scope *AgencyScope, filter *StatisticFilter) (statistics []*models.StatisticStatus, err error) {
+	periods, err := c.getStatusStatisticCtx(ctx, promotionCpnsStatisticSource, scope, filter, false)
 	if err != nil {
-		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+		return nil, err
 	}
-	defer rows.Close()
 
-	statistics = make([]*models.StatisticStatus, 0)
-	statisticMap := make(map[int]*models.StatisticStatus)
-	for status := range models.PromotionCpnsAdmissionStatuses {
-		statusStatistic := &models.StatisticStatus{
-			Status: status,
-		}
-		statistics = append(statistics, statusStatistic)
-		statisticMap[status] = statusStatistic
-	}
-	for rows.Next() {
-		var temp models.StatisticStatus
-		err = rows.Scan(&temp.Status, &temp.Count)
-		if err != nil {
-			return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
-		}
-		statusStatistic, ok := statisticMap[temp.Status]
-		if ok {
-			statusStatistic.Count = temp.Count
-		}
-	}
-	if err = rows.Err(); err != nil {
-		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
-	}
+	return periods[0].Statuses, nil
+}
 
-	return statistics, nil
+// GetPromotionCpnsStatusStatisticSeriesCtx returns the number of cpns promotion items for each status in each period of
+// filter.GroupBy, limited to scope and filter.
+func (c *Client) GetPromotionCpnsStatusStatisticSeriesCtx(ctx context.Context, scope *AgencyScope, filter *StatisticFilter) (periods []*models.StatisticPeriod, err error) {
+	return c.getStatusStatisticCtx(ctx, promotionCpnsStatisticSource, scope, filter, true)
 }
@@ -24,6 +24,9 @@ const (
 	TimeoutPromotionCpnsAdmissionPromotionLetterDownload = TimeoutDefault
 	TimeoutPromotionCpnsAdmissionSubmit                  = TimeoutDefault
 	TimeoutGetPromotionCpnsStatusStatistic               = TimeoutDefault
+	TimeoutGetPromotionCpnsStatusStatisticSeries         = TimeoutDefault
+	TimeoutPromotionCpnsHistoryGet                       = TimeoutDefault
+	TimeoutPromotionCpnsActionsGet                       = TimeoutDefault
 )
 
 // HandlePromotionCpnsAdmissionGet handles retrieving promotion CPNS admission detail.
@@ -39,7 +42,13 @@ func (c *Client) HandlePromotionCpnsAdmissionGet(writer http.ResponseWriter, req
 		return
 	}
 
-	promotion, err := c.GetPromotionCpnsAdmissionDetailCtx(ctx, pa.PromotionCpnsId)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	promotion, err := c.GetPromotionCpnsAdmissionDetailCtx(ctx, pa.PromotionCpnsId, scope)
 	if err != nil {
 		c.httpError(writer, err)
 		return
@@ -72,6 +81,11 @@ func (c *Client) HandlePromotionCpnsAdmissionSearchPaginated(writer http.Respons
 		return
 	}
 
+	err = c.httpErrorVerifyAdmissionSearchOptions(writer, &query.AdmissionSearchOptions, models.PromotionCpnsAdmissionStatuses, ErrCodePromotionFilterInvalidStatus, ErrCodePromotionFilterInvalidDate)
+	if err != nil {
+		return
+	}
+
 	result, err := c.SearchPromotionCpnsAdmissionsPaginatedCtx(ctx, query)
 	if err != nil {
 		c.httpError(writer, err)
@@ -81,6 +95,39 @@ func (c *Client) HandlePromotionCpnsAdmissionSearchPaginated(writer http.Respons
 	_ = httputil.WriteObj200(writer, (*models.IdPaginatedList)(result))
 }
 
+// HandlePromotionCpnsAdmissionExport handles a request to export every CPNS promotion admission matching the search
+// filters as an xlsx or csv file.
+func (c *Client) HandlePromotionCpnsAdmissionExport(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutExport)
+	defer cancel()
+
+	type schemaAdmissionExport struct {
+		PromotionCpnsAdmissionSearchFilter
+		// Format is either xlsx (default) or csv.
+		Format string `schema:"format"`
+	}
+
+	query := &schemaAdmissionExport{}
+	err := c.decodeRequestSchema(writer, request, query)
+	if err != nil {
+		return
+	}
+
+	err = c.httpErrorVerifyAdmissionSearchOptions(writer, &query.AdmissionSearchOptions, models.PromotionCpnsAdmissionStatuses, ErrCodePromotionFilterInvalidStatus, ErrCodePromotionFilterInvalidDate)
+	if err != nil {
+		return
+	}
+
+	table, err := c.newHttpExport(writer, query.Format, "usulan-pengangkatan-cpns")
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	err = c.ExportPromotionCpnsAdmissionsCtx(ctx, &query.PromotionCpnsAdmissionSearchFilter, table)
+	c.finishHttpExport(writer, table, err)
+}
+
 // HandlePromotionCpnsAdmissionPakLetterUpload handles a request to upload a cpns promotion admission PAK letter.
 // We do not redirect the request to object storage signed URL. We instead return a JSON containing a document name
 // which will have to be saved by the frontend and a signed URL which the frontend has to request with PUT method
@@ -281,6 +328,7 @@ func (c *Client) HandlePromotionCpnsAdmissionPromotionLetterDownload(writer http
 func (c *Client) HandlePromotionCpnsAdmissionSubmit(writer http.ResponseWriter, request *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutPromotionCpnsAdmissionSubmit)
 	defer cancel()
+	ctx = c.withRequestMetadata(ctx, request)
 
 	user := auth.AssertReqGetUserDetail(request)
 
@@ -298,17 +346,31 @@ func (c *Client) HandlePromotionCpnsAdmissionSubmit(writer http.ResponseWriter,
 		return
 	}
 
+	c.notifyStatusChange(request, StatusHistoryModulePromotionCpns, promotionCpnsId, models.PromotionCpnsAdmissionStatusCreated, "")
+
 	_ = httputil.WriteObj200(writer, map[string]string{
 		"pengangkatan_cpns_id": promotionCpnsId,
 	})
 }
 
-// HandleGetPromotionCpnsStatusStatistic returns the number of cpns promotion items for each status.
-func (c *Client) HandleGetPromotionCpnsStatusStatistic(writer http.ResponseWriter, _ *http.Request) {
+// HandleGetPromotionCpnsStatusStatistic returns the number of cpns promotion items for each status, within the agency
+// scope of the user. The statistic can be filtered by agency, functional position and admission date range.
+func (c *Client) HandleGetPromotionCpnsStatusStatistic(writer http.ResponseWriter, request *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutGetPromotionCpnsStatusStatistic)
 	defer cancel()
 
-	statistic, err := c.GetPromotionCpnsStatusStatisticCtx(ctx)
+	filter, err := c.decodeStatisticFilter(writer, request)
+	if err != nil {
+		return
+	}
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	statistic, err := c.GetPromotionCpnsStatusStatisticCtx(ctx, scope, filter)
 	if err != nil {
 		c.httpError(writer, err)
 		return
@@ -316,3 +378,89 @@ func (c *Client) HandleGetPromotionCpnsStatusStatistic(writer http.ResponseWrite
 
 	_ = httputil.WriteObj200(writer, statistic)
 }
+
+// HandleGetPromotionCpnsStatusStatisticSeries returns the number of cpns promotion items for each status in each month,
+// quarter or year, within the agency scope of the user. It accepts the same filters as
+// HandleGetPromotionCpnsStatusStatistic.
+func (c *Client) HandleGetPromotionCpnsStatusStatisticSeries(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutGetPromotionCpnsStatusStatisticSeries)
+	defer cancel()
+
+	filter, err := c.decodeStatisticFilter(writer, request)
+	if err != nil {
+		return
+	}
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	periods, err := c.GetPromotionCpnsStatusStatisticSeriesCtx(ctx, scope, filter)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, periods)
+}
+
+// HandlePromotionCpnsHistoryGet handles the request to get the status history of a CPNS promotion admission, oldest first.
+func (c *Client) HandlePromotionCpnsHistoryGet(writer http.ResponseWriter, request *http.Request) {
+	type schemaPromotionCpnsId struct {
+		PromotionCpnsId string `schema:"pengangkatan_cpns_id"`
+	}
+	sh := &schemaPromotionCpnsId{}
+	err := c.decodeRequestSchema(writer, request, sh)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutPromotionCpnsHistoryGet)
+	defer cancel()
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	history, err := c.GetStatusHistoryCtx(ctx, StatusHistoryModulePromotionCpns, sh.PromotionCpnsId, scope)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, history)
+}
+
+// HandlePromotionCpnsActionsGet handles the request to get the current status of a CPNS promotion admission and the
+// actions the user can do next, so that the frontend can show only the allowed actions.
+func (c *Client) HandlePromotionCpnsActionsGet(writer http.ResponseWriter, request *http.Request) {
+	type schemaPromotionCpnsId struct {
+		PromotionCpnsId string `schema:"pengangkatan_cpns_id"`
+	}
+	sh := &schemaPromotionCpnsId{}
+	err := c.decodeRequestSchema(writer, request, sh)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutPromotionCpnsActionsGet)
+	defer cancel()
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	actions, err := c.GetAdmissionActionsCtx(ctx, StatusHistoryModulePromotionCpns, sh.PromotionCpnsId, scope, ReqGetUserRoles(request))
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, actions)
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/httputil"
+	"github.com/fazrithe/siasn-jf-backend-git/store/esign"
 	"github.com/fazrithe/siasn-jf-backend-git/store/models"
 	"github.com/fazrithe/siasn-jf-backend-git/store/object"
 )
@@ -27,6 +28,7 @@ const (
 	TimeoutPromotionAdmissionPromotionLetterUpload                = TimeoutDefault
 	TimeoutPromotionAdmissionPromotionLetterPreview               = TimeoutDefault
 	TimeoutPromotionAdmissionPromotionLetterDownload              = TimeoutDefault
+	TimeoutPromotionAdmissionPromotionLetterSign                  = TimeoutDefault
 	TimeoutPromotionAdmissionTestCertificateUpload                = TimeoutDefault
 	TimeoutPromotionAdmissionTestCertificatePreview               = TimeoutDefault
 	TimeoutPromotionAdmissionTestCertificateDownload              = TimeoutDefault
@@ -34,6 +36,9 @@ const (
 	TimeoutPromotionAdmissionReject                               = TimeoutDefault
 	TimeoutPromotionAdmissionSearch                               = TimeoutDefault
 	TimeoutGetPromotionStatusStatistic                            = TimeoutDefault
+	TimeoutGetPromotionStatusStatisticSeries                      = TimeoutDefault
+	TimeoutPromotionHistoryGet                                    = TimeoutDefault
+	TimeoutPromotionActionsGet                                    = TimeoutDefault
 )
 
 // HandlePromotionAdmissionSubmit handles a new admission request.
@@ -42,6 +47,7 @@ const (
 func (c *Client) HandlePromotionAdmissionSubmit(writer http.ResponseWriter, request *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutPromotionAdmissionSubmit)
 	defer cancel()
+	ctx = c.withRequestMetadata(ctx, request)
 
 	user := auth.AssertReqGetUserDetail(request)
 
@@ -60,6 +66,8 @@ func (c *Client) HandlePromotionAdmissionSubmit(writer http.ResponseWriter, requ
 		return
 	}
 
+	c.notifyStatusChange(request, StatusHistoryModulePromotion, promotionId, models.PromotionAdmissionStatusCreated, "")
+
 	_ = httputil.WriteObj200(writer, map[string]string{
 		"pengangkatan_id": promotionId,
 	})
@@ -366,15 +374,15 @@ func (c *Client) HandlePromotionAdmissionPromotionLetterPreview(writer http.Resp
 }
 
 // HandlePromotionAdmissionPromotionLetterDownload handles a request to download a PromotionAdmission letter document from permanent location.
-// Requires `filename` query parameter, the filename retrieved from uploading the file.
+// Requires `pengangkatan_id` query parameter. The letter only exists after it has been signed, see
+// HandlePromotionAdmissionPromotionLetterSign.
 // This handler redirects the request. It returns 302 to a signed URL to download the document.
 func (c *Client) HandlePromotionAdmissionPromotionLetterDownload(writer http.ResponseWriter, request *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutPromotionAdmissionPromotionLetterDownload)
 	defer cancel()
 
 	type schemaPromotionId struct {
-		PromotionId     string `schema:"pengangkatan_id"`
-		ForceRegenerate bool   `schema:"force"`
+		PromotionId string `schema:"pengangkatan_id"`
 	}
 
 	s := &schemaPromotionId{}
@@ -384,13 +392,19 @@ func (c *Client) HandlePromotionAdmissionPromotionLetterDownload(writer http.Res
 		return
 	}
 
-	filename, err := c.GeneratePromotionLetterCtx(ctx, s.PromotionId, s.ForceRegenerate)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_, err = c.getAdmissionStatusCtx(ctx, StatusHistoryModulePromotion, s.PromotionId, scope)
 	if err != nil {
 		c.httpError(writer, err)
 		return
 	}
 
-	url, err := c.PromotionStorage.GeneratePromotionDocGetSign(ctx, path.Join(PromotionPromotionLetterSubdir, filename))
+	url, err := c.PromotionStorage.GeneratePromotionDocGetSign(ctx, path.Join(PromotionPromotionLetterSubdir, fmt.Sprintf("%s.pdf", s.PromotionId)))
 	if err != nil {
 		c.httpError(writer, ec.NewError(ErrCodeStorageSignFail, Errs[ErrCodeStorageSignFail], err))
 		return
@@ -399,6 +413,41 @@ func (c *Client) HandlePromotionAdmissionPromotionLetterDownload(writer http.Res
 	http.Redirect(writer, request, url.String(), http.StatusFound)
 }
 
+// HandlePromotionAdmissionPromotionLetterSign handles a request to generate the promotion letter of an accepted
+// promotion and sign it electronically. Only the verifier who accepted the promotion can sign it, with their own
+// certificate passphrase. The letter is generated in the background, this returns 202 with the job, which can be
+// polled until the letter can be downloaded.
+func (c *Client) HandlePromotionAdmissionPromotionLetterSign(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutPromotionAdmissionPromotionLetterSign)
+	defer cancel()
+
+	type schemaPromotionSign struct {
+		PromotionId string `json:"pengangkatan_id"`
+		Passphrase  string `json:"passphrase"`
+	}
+
+	s := &schemaPromotionSign{}
+	err := c.decodeRequestJson(writer, request, s)
+	if err != nil {
+		return
+	}
+
+	user := auth.AssertReqGetUserDetail(request)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	job, err := c.GeneratePromotionLetterCtx(ctx, scope, s.PromotionId, user.AsnId, &esign.Identity{Nik: user.Nik, Passphrase: s.Passphrase})
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj(writer, job, http.StatusAccepted)
+}
+
 // HandlePromotionAdmissionTestCertificateUpload handles a request to upload a promotion's test certificate.
 // We do not redirect the request to object storage signed URL. We instead return a JSON containing a document name
 // which will have to be saved by the frontend and a signed URL which the frontend has to request with PUT method
@@ -507,6 +556,7 @@ func (c *Client) HandlePromotionAdmissionTestCertificateDownload(writer http.Res
 func (c *Client) HandlePromotionAdmissionAccept(writer http.ResponseWriter, request *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutPromotionAdmissionAccept)
 	defer cancel()
+	ctx = c.withRequestMetadata(ctx, request)
 
 	user := auth.AssertReqGetUserDetail(request)
 
@@ -518,12 +568,20 @@ func (c *Client) HandlePromotionAdmissionAccept(writer http.ResponseWriter, requ
 
 	p.SubmitterAsnId = user.AsnId
 
-	modifiedAt, err := c.SetPromotionStatusAcceptedCtx(ctx, p)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
 	if err != nil {
 		c.httpError(writer, err)
 		return
 	}
 
+	modifiedAt, err := c.SetPromotionStatusAcceptedCtx(ctx, scope, p)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	c.notifyStatusChange(request, StatusHistoryModulePromotion, p.PromotionId, models.PromotionAdmissionStatusAccepted, "")
+
 	_ = httputil.WriteObj200(writer, map[string]interface{}{
 		"pengangkatan_id": p.PromotionId,
 		"modified_at":     modifiedAt.Unix(),
@@ -534,6 +592,7 @@ func (c *Client) HandlePromotionAdmissionAccept(writer http.ResponseWriter, requ
 func (c *Client) HandlePromotionAdmissionReject(writer http.ResponseWriter, request *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutPromotionAdmissionReject)
 	defer cancel()
+	ctx = c.withRequestMetadata(ctx, request)
 
 	user := auth.AssertReqGetUserDetail(request)
 
@@ -545,12 +604,20 @@ func (c *Client) HandlePromotionAdmissionReject(writer http.ResponseWriter, requ
 
 	p.SubmitterAsnId = user.AsnId
 
-	modifiedAt, err := c.SetPromotionStatusRejectCtx(ctx, p)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
 	if err != nil {
 		c.httpError(writer, err)
 		return
 	}
 
+	modifiedAt, err := c.SetPromotionStatusRejectCtx(ctx, scope, p)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	c.notifyStatusChange(request, StatusHistoryModulePromotion, p.PromotionId, models.PromotionAdmissionStatusRejected, p.RejectReason)
+
 	_ = httputil.WriteObj200(writer, map[string]interface{}{
 		"pengangkatan_id": p.PromotionId,
 		"modified_at":     modifiedAt.Unix(),
@@ -564,11 +631,10 @@ func (c *Client) HandlePromotionAdmissionSearchPaginated(writer http.ResponseWri
 
 	type schemaAdmissionSearch struct {
 		// AdmissionDate is a date with a format of YYYY-MM-DD (e.g. 2006-12-31)
-		AdmissionDate   string `schema:"tgl_doc_surat_rekomendasi"`
-		AdmissionStatus int    `schema:"status"`
-		AdmissionType   int    `schema:"jenis_pengangkatan"`
-		PageNumber      int    `schema:"halaman"`
-		CountPerPage    int    `schema:"jumlah_per_halaman"`
+		AdmissionDate string `schema:"tgl_doc_surat_rekomendasi"`
+		AdmissionType int    `schema:"jenis_pengangkatan"`
+		PageNumber    int    `schema:"halaman"`
+		CountPerPage  int    `schema:"jumlah_per_halaman"`
 	}
 
 	query := &schemaAdmissionSearch{}
@@ -592,8 +658,8 @@ func (c *Client) HandlePromotionAdmissionSearchPaginated(writer http.ResponseWri
 		return
 	}
 
-	if _, ok := models.PromotionAdmissionStatuses[query.AdmissionStatus]; query.AdmissionStatus != 0 && !ok {
-		c.httpError(writer, ErrPromotionFilterInvalidStatus)
+	options, err := c.decodeAdmissionSearchOptions(writer, request, models.PromotionAdmissionStatuses, ErrCodePromotionFilterInvalidStatus, ErrCodePromotionFilterInvalidDate)
+	if err != nil {
 		return
 	}
 
@@ -612,11 +678,11 @@ func (c *Client) HandlePromotionAdmissionSearchPaginated(writer http.ResponseWri
 	}
 
 	searchFilter := &PromotionAdmissionSearchFilter{
-		AdmissionDate:   admissionDate,
-		AdmissionStatus: query.AdmissionStatus,
-		AdmissionType:   query.AdmissionType,
-		CountPerPage:    countPerPage,
-		PageNumber:      pageNumber,
+		AdmissionDate:          admissionDate,
+		AdmissionType:          query.AdmissionType,
+		AdmissionSearchOptions: *options,
+		CountPerPage:           countPerPage,
+		PageNumber:             pageNumber,
 	}
 
 	admissions, err := c.SearchPromotionAdmissionsPaginatedCtx(ctx, searchFilter)
@@ -628,12 +694,77 @@ func (c *Client) HandlePromotionAdmissionSearchPaginated(writer http.ResponseWri
 	_ = httputil.WriteObj200(writer, (*models.IdPaginatedList)(admissions))
 }
 
-// HandleGetPromotionStatusStatistic returns the number of promotion items for each status.
-func (c *Client) HandleGetPromotionStatusStatistic(writer http.ResponseWriter, _ *http.Request) {
+// HandlePromotionAdmissionExport handles a request to export every promotion admission matching the search filters
+// as an xlsx or csv file.
+func (c *Client) HandlePromotionAdmissionExport(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutExport)
+	defer cancel()
+
+	type schemaAdmissionExport struct {
+		// AdmissionDate is a date with a format of YYYY-MM-DD (e.g. 2006-12-31)
+		AdmissionDate string `schema:"tgl_doc_surat_rekomendasi"`
+		AdmissionType int    `schema:"jenis_pengangkatan"`
+		// Format is either xlsx (default) or csv.
+		Format string `schema:"format"`
+	}
+
+	query := &schemaAdmissionExport{}
+	err := c.decodeRequestSchema(writer, request, query)
+	if err != nil {
+		return
+	}
+
+	options, err := c.decodeAdmissionSearchOptions(writer, request, models.PromotionAdmissionStatuses, ErrCodePromotionFilterInvalidStatus, ErrCodePromotionFilterInvalidDate)
+	if err != nil {
+		return
+	}
+
+	if _, ok := models.PromotionTypes[query.AdmissionType]; query.AdmissionType != 0 && !ok {
+		c.httpError(writer, ErrPromotionFilterInvalidType)
+		return
+	}
+
+	var admissionDate models.Iso8601Date
+	if query.AdmissionDate != "" {
+		admissionDate, err = models.ParseIso8601Date(query.AdmissionDate)
+		if err != nil {
+			c.httpError(writer, ErrPromotionFilterInvalidDate)
+			return
+		}
+	}
+
+	table, err := c.newHttpExport(writer, query.Format, "usulan-pengangkatan")
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	err = c.ExportPromotionAdmissionsCtx(ctx, &PromotionAdmissionSearchFilter{
+		AdmissionDate:          admissionDate,
+		AdmissionType:          query.AdmissionType,
+		AdmissionSearchOptions: *options,
+	}, table)
+	c.finishHttpExport(writer, table, err)
+}
+
+// HandleGetPromotionStatusStatistic returns the number of promotion items for each status, within the agency scope of
+// the user. The statistic can be filtered by agency, functional position and admission date range.
+func (c *Client) HandleGetPromotionStatusStatistic(writer http.ResponseWriter, request *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutGetPromotionStatusStatistic)
 	defer cancel()
 
-	statistic, err := c.GetPromotionStatusStatisticCtx(ctx)
+	filter, err := c.decodeStatisticFilter(writer, request)
+	if err != nil {
+		return
+	}
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	statistic, err := c.GetPromotionStatusStatisticCtx(ctx, scope, filter)
 	if err != nil {
 		c.httpError(writer, err)
 		return
@@ -641,3 +772,88 @@ func (c *Client) HandleGetPromotionStatusStatistic(writer http.ResponseWriter, _
 
 	_ = httputil.WriteObj200(writer, statistic)
 }
+
+// HandleGetPromotionStatusStatisticSeries returns the number of promotion items for each status in each month, quarter
+// or year, within the agency scope of the user. It accepts the same filters as HandleGetPromotionStatusStatistic.
+func (c *Client) HandleGetPromotionStatusStatisticSeries(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutGetPromotionStatusStatisticSeries)
+	defer cancel()
+
+	filter, err := c.decodeStatisticFilter(writer, request)
+	if err != nil {
+		return
+	}
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	periods, err := c.GetPromotionStatusStatisticSeriesCtx(ctx, scope, filter)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, periods)
+}
+
+// HandlePromotionHistoryGet handles the request to get the status history of a promotion admission, oldest first.
+func (c *Client) HandlePromotionHistoryGet(writer http.ResponseWriter, request *http.Request) {
+	type schemaPromotionId struct {
+		PromotionId string `schema:"pengangkatan_id"`
+	}
+	sh := &schemaPromotionId{}
+	err := c.decodeRequestSchema(writer, request, sh)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutPromotionHistoryGet)
+	defer cancel()
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	history, err := c.GetStatusHistoryCtx(ctx, StatusHistoryModulePromotion, sh.PromotionId, scope)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, history)
+}
+
+// HandlePromotionActionsGet handles the request to get the current status of a promotion admission and the
+// actions the user can do next, so that the frontend can show only the allowed actions.
+func (c *Client) HandlePromotionActionsGet(writer http.ResponseWriter, request *http.Request) {
+	type schemaPromotionId struct {
+		PromotionId string `schema:"pengangkatan_id"`
+	}
+	sh := &schemaPromotionId{}
+	err := c.decodeRequestSchema(writer, request, sh)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutPromotionActionsGet)
+	defer cancel()
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	actions, err := c.GetAdmissionActionsCtx(ctx, StatusHistoryModulePromotion, sh.PromotionId, scope, ReqGetUserRoles(request))
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, actions)
+}
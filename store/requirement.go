@@ -13,10 +13,13 @@ import (
 	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/docx"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/export"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/metricutil"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/search"
+	"github.com/fazrithe/siasn-jf-backend-git/store/esign"
 	"github.com/fazrithe/siasn-jf-backend-git/store/models"
 	"github.com/fazrithe/siasn-jf-backend-git/store/object"
+	"github.com/fazrithe/siasn-jf-backend-git/store/workflow"
 	"github.com/google/uuid"
 	"github.com/lib/pq"
 )
@@ -282,16 +285,9 @@ func (c *Client) InsertRequirementAdmissionCtx(ctx context.Context, request *mod
 		}
 	}
 
-	_, err = mtx.ExecContext(
-		ctx,
-		"insert into kebutuhan_statushist(kebutuhan_kebutuhan_id, status, modified_at_ts, user_id) values($1, $2, $3, $4)",
-		requirementId,
-		models.RequirementAdmissionStatusCreated,
-		time.Now(),
-		request.SubmitterAsnId,
-	)
+	_, err = c.insertStatusHistoryCtx(ctx, mtx, StatusHistoryModuleRequirement, requirementId, 0, models.RequirementAdmissionStatusCreated, request.SubmitterAsnId, "")
 	if err != nil {
-		return "", ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("cannot insert entry to kebutuhan_statushist: %w", err))
+		return "", err
 	}
 
 	filenameToDocName := make(map[string]string)
@@ -339,8 +335,10 @@ func (c *Client) InsertRequirementAdmissionCtx(ctx context.Context, request *mod
 //
 // Its behaviour is similar to InsertRequirementAdmissionCtx. The difference is if no cover letter provided, it will
 // not insert a new cover letter and the estimation documents provided will be added to the list of estimation documents
-// the admission has.
-func (c *Client) EditRequirementAdmissionCtx(ctx context.Context, newRequirement *models.RequirementAdmission) (err error) {
+// the admission has. The admission must be in the agency scope, otherwise errnum.ErrEntryNotFound is returned.
+// Only admissions that are created or under revision can be edited, otherwise this will return error code
+// errnum.ErrCodeWorkflowTransitionInvalid.
+func (c *Client) EditRequirementAdmissionCtx(ctx context.Context, scope *AgencyScope, newRequirement *models.RequirementAdmission) (err error) {
 	mtx, err := c.createMtxDb(ctx, c.Db)
 	if err != nil {
 		return err
@@ -359,22 +357,30 @@ func (c *Client) EditRequirementAdmissionCtx(ctx context.Context, newRequirement
 		coverLetterDocName = newRequirement.TempCoverLetter.DocumentName
 	}
 
-	// Update requirement admission and get the current admission status
-	var currentAdmissionStatus int
-	err = mtx.QueryRowContext(ctx,
-		"update kebutuhan set jabatan_fungsional = $1, nama_doc_sp = case when $2 = '' then nama_doc_sp else $2 end, tahun_anggaran = $3, no_usulan = $4 where kebutuhan_id = $5 and instansi_id = $6 returning status",
+	currentAdmissionStatus := 0
+	err = mtx.QueryRowContext(ctx, "select status from kebutuhan where kebutuhan_id = $1 and ($2::text[] is null or instansi_id = any($2) or jabatan_fungsional = any($3)) for update", newRequirement.RequirementId, scope.sqlArg(), scope.sqlPositionArg()).Scan(&currentAdmissionStatus)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// This means no requirement admission is found with the provided requirement id in the agency scope
+			return ErrEntryNotFound
+		}
+		return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+
+	err = checkTransition(requirementWorkflow, currentAdmissionStatus, WorkflowActionEdit, nil, newRequirement)
+	if err != nil {
+		return err
+	}
+
+	_, err = mtx.ExecContext(ctx,
+		"update kebutuhan set jabatan_fungsional = $1, nama_doc_sp = case when $2 = '' then nama_doc_sp else $2 end, tahun_anggaran = $3, no_usulan = $4 where kebutuhan_id = $5",
 		newRequirement.PositionGrade,
 		coverLetterDocName,
 		newRequirement.FiscalYear,
 		newRequirement.AdmissionNumber,
 		newRequirement.RequirementId,
-		newRequirement.AgencyId,
-	).Scan(&currentAdmissionStatus)
+	)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			// This means no requirement admission is found with the provided requirement id and agency id
-			return ec.NewErrorBasic(ErrCodeEntryNotFound, Errs[ErrCodeEntryNotFound])
-		}
 		return ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("cannot update entry in kebutuhan: %w", err))
 	}
 
@@ -417,17 +423,10 @@ func (c *Client) EditRequirementAdmissionCtx(ctx context.Context, newRequirement
 		}
 	}
 
-	// Add new entry to kebutuhan_statushist (audit history)
-	_, err = mtx.ExecContext(
-		ctx,
-		"insert into kebutuhan_statushist(kebutuhan_kebutuhan_id, status, modified_at_ts, user_id) values($1, $2, $3, $4)",
-		newRequirement.RequirementId,
-		currentAdmissionStatus,
-		time.Now(),
-		newRequirement.SubmitterAsnId,
-	)
+	// Add new entry to status_hist (audit history), the status itself does not change on edit
+	_, err = c.insertStatusHistoryCtx(ctx, mtx, StatusHistoryModuleRequirement, newRequirement.RequirementId, currentAdmissionStatus, currentAdmissionStatus, newRequirement.SubmitterAsnId, "")
 	if err != nil {
-		return ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("cannot insert entry to kebutuhan_statushist: %w", err))
+		return err
 	}
 
 	// Save the temp cover letter if provided
@@ -530,20 +529,49 @@ func (c *Client) SearchRequirementAdmissionsCtx(ctx context.Context, searchFilte
 	return
 }
 
+var requirementAdmissionSearchTable = &admissionSearchTable{
+	name:           "kebutuhan",
+	idColumn:       "kebutuhan_id",
+	dateColumn:     "tgl_usulan",
+	positionColumn: "jabatan_fungsional",
+}
+
+// requirementAdmissionSearchQueryCtx builds the query of SearchRequirementAdmissionsPaginatedCtx and
+// ExportRequirementAdmissionsCtx from filter, see applyAdmissionSearchOptionsCtx for the errors returned.
+func (c *Client) requirementAdmissionSearchQueryCtx(ctx context.Context, filter *RequirementAdmissionSearchFilter) (q *admissionSearchQuery, err error) {
+	q = newAdmissionSearchQuery(requirementAdmissionSearchTable)
+	q.where("instansi_id = %s", filter.AgencyId)
+	if filter.AdmissionStatus != 0 {
+		q.where("status = %s", filter.AdmissionStatus)
+	}
+	if filter.AdmissionDate != "" {
+		q.where("tgl_usulan::date = %s", string(filter.AdmissionDate))
+	}
+
+	err = c.applyAdmissionSearchOptionsCtx(ctx, q, &filter.AdmissionSearchOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
 // SearchRequirementAdmissionsPaginatedCtx searches for the list of requirement admissions of a particular work agency ID (instansi kerja).
 // It will return empty slice if no requirements are found.
 func (c *Client) SearchRequirementAdmissionsPaginatedCtx(ctx context.Context, filter *RequirementAdmissionSearchFilter) (result *search.PaginatedList, err error) {
 	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
 
-	admissionRows, err := mdb.QueryContext(
-		ctx,
-		"select kebutuhan_id, tgl_usulan, status, jabatan_fungsional, no_usulan, tahun_anggaran from kebutuhan where instansi_id = $1 and ($2 = 0 or status = $2) and ($3::date is null or tgl_usulan::date = $3) order by tgl_usulan desc limit $4 offset $5",
-		filter.AgencyId,
-		filter.AdmissionStatus,
-		sql.NullString{Valid: string(filter.AdmissionDate) != "", String: string(filter.AdmissionDate)},
-		filter.CountPerPage+1,
-		(filter.PageNumber-1)*filter.CountPerPage,
-	)
+	q, err := c.requirementAdmissionSearchQueryCtx(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	query, err := q.paginatedQuery("kebutuhan_id, tgl_usulan, status, jabatan_fungsional, no_usulan, tahun_anggaran", &filter.AdmissionSearchOptions, filter.PageNumber, filter.CountPerPage)
+	if err != nil {
+		return nil, err
+	}
+
+	admissionRows, err := mdb.QueryContext(ctx, query, q.args...)
 	if err != nil {
 		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
@@ -552,7 +580,7 @@ func (c *Client) SearchRequirementAdmissionsPaginatedCtx(ctx context.Context, fi
 	admissions := make([]*models.RequirementAdmissionResult, 0)
 	for admissionRows.Next() {
 		admission := &models.RequirementAdmissionResult{}
-		err = admissionRows.Scan(
+		err = q.scan(admissionRows,
 			&admission.RequirementId,
 			&admission.AdmissionTimestamp,
 			&admission.Status,
@@ -577,12 +605,108 @@ func (c *Client) SearchRequirementAdmissionsPaginatedCtx(ctx context.Context, fi
 
 	return &search.PaginatedList{
 		Data:     admissions,
-		Metadata: search.CreatePaginatedListMetadataNoTotalNext(filter.PageNumber, len(admissions), hasNext),
+		Metadata: q.metadata(filter.PageNumber, len(admissions), hasNext),
 	}, nil
 }
 
+// ExportRequirementAdmissionsCtx writes every requirement admission matching filter into table, with a header row.
+// Unlike SearchRequirementAdmissionsPaginatedCtx, the admissions are not paged, filter.PageNumber and
+// filter.CountPerPage are ignored. The functional position names are resolved in batches, so the admissions are never
+// kept in memory at once. Nothing is written into table if the search fails.
+func (c *Client) ExportRequirementAdmissionsCtx(ctx context.Context, filter *RequirementAdmissionSearchFilter, table export.Writer) (err error) {
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+	referenceMdb := metricutil.NewDB(c.ReferenceDb, c.SqlMetrics)
+
+	q, err := c.requirementAdmissionSearchQueryCtx(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	admissionRows, err := mdb.QueryContext(
+		ctx,
+		q.query("tgl_usulan, status, jabatan_fungsional, no_usulan, tahun_anggaran"),
+		q.args...,
+	)
+	if err != nil {
+		return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+	defer admissionRows.Close()
+
+	agencies, err := c.getAgencyNames(ctx, referenceMdb, []string{filter.AgencyId})
+	if err != nil {
+		return err
+	}
+
+	err = table.WriteRow([]string{"No. Usulan", "Waktu Usulan", "Status", "Jabatan Fungsional", "Tahun Anggaran", "Instansi"})
+	if err != nil {
+		return err
+	}
+
+	admissions := make([]*models.RequirementAdmissionResult, 0, exportBatchSize)
+	writeAdmissions := func() (err error) {
+		if len(admissions) == 0 {
+			return nil
+		}
+
+		positionIds := make([]string, 0, len(admissions))
+		for _, admission := range admissions {
+			positionIds = append(positionIds, admission.PositionGrade)
+		}
+
+		positions, err := c.getFunctionalPositionNames(ctx, referenceMdb, positionIds)
+		if err != nil {
+			return err
+		}
+
+		for _, admission := range admissions {
+			err = table.WriteRow([]string{
+				admission.AdmissionNumber,
+				exportEpochTime(admission.AdmissionTimestamp),
+				exportName(models.RequirementAdmissionStatusNames, admission.Status),
+				positions[admission.PositionGrade],
+				admission.FiscalYear,
+				agencies[filter.AgencyId],
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		admissions = admissions[:0]
+		return nil
+	}
+
+	for admissionRows.Next() {
+		admission := &models.RequirementAdmissionResult{}
+		err = admissionRows.Scan(
+			&admission.AdmissionTimestamp,
+			&admission.Status,
+			&admission.PositionGrade,
+			&admission.AdmissionNumber,
+			&admission.FiscalYear,
+		)
+		if err != nil {
+			return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+		}
+
+		admissions = append(admissions, admission)
+		if len(admissions) == exportBatchSize {
+			err = writeAdmissions()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err = admissionRows.Err(); err != nil {
+		return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+
+	return writeAdmissions()
+}
+
 // GetRequirementAdmissionDetailCtx retrieve the detail of a requirement admission with matched id.
-func (c *Client) GetRequirementAdmissionDetailCtx(ctx context.Context, requirementId string, agencyId string) (admission *models.RequirementAdmissionDetail, err error) {
+// The requirement admission must be in the agency scope, otherwise it is treated as not found.
+func (c *Client) GetRequirementAdmissionDetailCtx(ctx context.Context, requirementId string, scope *AgencyScope) (admission *models.RequirementAdmissionDetail, err error) {
 	mtx, err := c.createMtxDb(ctx, c.Db)
 	if err != nil {
 		return nil, err
@@ -597,7 +721,7 @@ func (c *Client) GetRequirementAdmissionDetailCtx(ctx context.Context, requireme
 		CoverLetter:         &models.Document{},
 		EstimationDocuments: []*models.Document{},
 	}
-	err = mtx.QueryRowContext(ctx, "select kebutuhan_id, tgl_usulan, status, jabatan_fungsional, filename_sp, nama_doc_sp, coalesce(catatan_sp, ''), tahun_anggaran, no_usulan, coalesce(alasan_perbaikan, '') from kebutuhan where kebutuhan_id = $1 and instansi_id = $2 for share", requirementId, agencyId).Scan(
+	err = mtx.QueryRowContext(ctx, "select kebutuhan_id, tgl_usulan, status, jabatan_fungsional, filename_sp, nama_doc_sp, coalesce(catatan_sp, ''), tahun_anggaran, no_usulan, coalesce(alasan_perbaikan, '') from kebutuhan where kebutuhan_id = $1 and ($2::text[] is null or instansi_id = any($2) or jabatan_fungsional = any($3)) for share", requirementId, scope.sqlArg(), scope.sqlPositionArg()).Scan(
 		&admission.RequirementId,
 		&admission.AdmissionTimestamp,
 		&admission.Status,
@@ -715,9 +839,8 @@ func (c *Client) GetRequirementAdmissionDetailCtx(ctx context.Context, requireme
 }
 
 // SetRequirementStatusAcceptedCtx sets a requirement admission status as models.RequirementAdmissionStatusAccepted.
-// If the status of the requirement is not models.RequirementAdmissionStatusCreated or models.RequirementAdmissionStatusRevision, this will return error code errnum.ErrCodeRequirementVerificationStatusProcessedFurther.
-// If the status is already models.RequirementAdmissionStatusAccepted, this will return error code errnum.ErrCodeRequirementVerificationStatusAlreadyAccepted.
-func (c *Client) SetRequirementStatusAcceptedCtx(ctx context.Context, request *models.RequirementVerificationRequest) (modifiedAt time.Time, err error) {
+// If the requirement workflow does not allow it, this will return error code errnum.ErrCodeWorkflowTransitionInvalid.
+func (c *Client) SetRequirementStatusAcceptedCtx(ctx context.Context, scope *AgencyScope, request *models.RequirementVerificationRequest) (modifiedAt time.Time, err error) {
 	requirementId, err := uuid.Parse(request.RequirementId)
 	if err != nil {
 		return time.Time{}, ec.NewError(ErrCodeUuidInvalid, Errs[ErrCodeUuidInvalid], err)
@@ -733,7 +856,7 @@ func (c *Client) SetRequirementStatusAcceptedCtx(ctx context.Context, request *m
 	}()
 
 	currentStatus := 0
-	err = mtx.QueryRowContext(ctx, "select status from kebutuhan where kebutuhan_id = $1 and instansi_id = $2 for update", requirementId, request.AgencyId).Scan(&currentStatus)
+	err = mtx.QueryRowContext(ctx, "select status from kebutuhan where kebutuhan_id = $1 and ($2::text[] is null or instansi_id = any($2) or jabatan_fungsional = any($3)) for update", requirementId, scope.sqlArg(), scope.sqlPositionArg()).Scan(&currentStatus)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return time.Time{}, ErrEntryNotFound
@@ -742,21 +865,19 @@ func (c *Client) SetRequirementStatusAcceptedCtx(ctx context.Context, request *m
 		return time.Time{}, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
 
-	if currentStatus == models.RequirementAdmissionStatusAccepted {
-		return time.Time{}, ec.NewErrorBasic(ErrCodeRequirementVerificationStatusAlreadyAccepted, Errs[ErrCodeRequirementVerificationStatusAlreadyAccepted])
-	}
-
-	if currentStatus != models.RequirementAdmissionStatusCreated && currentStatus != models.RequirementAdmissionStatusRevision {
-		return time.Time{}, ec.NewErrorBasic(ErrCodeRequirementVerificationStatusProcessedFurther, Errs[ErrCodeRequirementVerificationStatusProcessedFurther])
+	err = checkTransition(requirementWorkflow, currentStatus, WorkflowActionVerify, nil, request)
+	if err != nil {
+		return time.Time{}, err
 	}
 
 	_, err = mtx.ExecContext(
 		ctx,
-		"update kebutuhan set status = $1, alasan_perbaikan = NULL, catatan_sp = $2 where kebutuhan_id = $3 and instansi_id = $4",
+		"update kebutuhan set status = $1, alasan_perbaikan = NULL, catatan_sp = $2 where kebutuhan_id = $3 and ($4::text[] is null or instansi_id = any($4) or jabatan_fungsional = any($5))",
 		models.RequirementAdmissionStatusAccepted,
 		sql.NullString{Valid: request.CoverLetterNote != "", String: request.CoverLetterNote},
 		requirementId.String(),
-		request.AgencyId,
+		scope.sqlArg(),
+		scope.sqlPositionArg(),
 	)
 	if err != nil {
 		return time.Time{}, ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], err)
@@ -791,26 +912,12 @@ func (c *Client) SetRequirementStatusAcceptedCtx(ctx context.Context, request *m
 		}
 	}
 
-	modifiedAt = time.Now()
-	_, err = mtx.ExecContext(
-		ctx,
-		"insert into kebutuhan_statushist(kebutuhan_kebutuhan_id, status, modified_at_ts, user_id) values($1, $2, $3, $4)",
-		requirementId.String(),
-		models.RequirementAdmissionStatusAccepted,
-		modifiedAt,
-		request.SubmitterAsnId,
-	)
-	if err != nil {
-		return time.Time{}, ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], err)
-	}
-	return modifiedAt, nil
+	return c.insertStatusHistoryCtx(ctx, mtx, StatusHistoryModuleRequirement, requirementId.String(), currentStatus, models.RequirementAdmissionStatusAccepted, request.SubmitterAsnId, "")
 }
 
-// SetRequirementStatusRevisionCtx sets a requirement admission status as models.RequirementAdmissionStatusDenied.
-// If the status of the requirement is not models.RequirementAdmissionStatusCreated, models.RequirementAdmissionStatusDenied
-// or models.RequirementAdmissionStatusRevision, this will return error code errnum.ErrCodeRequirementVerificationStatusProcessedFurther.
-// If the status is already models.RequirementAdmissionStatusAccepted, this will return error code errnum.ErrCodeRequirementVerificationStatusAlreadyAccepted.
-func (c *Client) SetRequirementStatusRevisionCtx(ctx context.Context, request *models.RequirementRevisionRequest) (modifiedAt time.Time, err error) {
+// SetRequirementStatusRevisionCtx sets a requirement admission status as models.RequirementAdmissionStatusRevision.
+// If the requirement workflow does not allow it, this will return error code errnum.ErrCodeWorkflowTransitionInvalid.
+func (c *Client) SetRequirementStatusRevisionCtx(ctx context.Context, scope *AgencyScope, request *models.RequirementRevisionRequest) (modifiedAt time.Time, err error) {
 	requirementId, err := uuid.Parse(request.RequirementId)
 	if err != nil {
 		return time.Time{}, ec.NewError(ErrCodeUuidInvalid, Errs[ErrCodeUuidInvalid], err)
@@ -826,7 +933,7 @@ func (c *Client) SetRequirementStatusRevisionCtx(ctx context.Context, request *m
 	}()
 
 	currentStatus := 0
-	err = mtx.QueryRowContext(ctx, "select status from kebutuhan where kebutuhan_id = $1 and instansi_id = $2 for update", requirementId, request.AgencyId).Scan(&currentStatus)
+	err = mtx.QueryRowContext(ctx, "select status from kebutuhan where kebutuhan_id = $1 and ($2::text[] is null or instansi_id = any($2) or jabatan_fungsional = any($3)) for update", requirementId, scope.sqlArg(), scope.sqlPositionArg()).Scan(&currentStatus)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return time.Time{}, ErrEntryNotFound
@@ -835,22 +942,20 @@ func (c *Client) SetRequirementStatusRevisionCtx(ctx context.Context, request *m
 		return time.Time{}, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
 
-	if currentStatus == models.RequirementAdmissionStatusAccepted {
-		return time.Time{}, ec.NewErrorBasic(ErrCodeRequirementVerificationStatusAlreadyAccepted, Errs[ErrCodeRequirementVerificationStatusAlreadyAccepted])
-	}
-
-	if currentStatus != models.RequirementAdmissionStatusCreated && currentStatus != models.RequirementAdmissionStatusRevision && currentStatus != models.RequirementAdmissionStatusDenied {
-		return time.Time{}, ec.NewErrorBasic(ErrCodeRequirementVerificationStatusProcessedFurther, Errs[ErrCodeRequirementVerificationStatusProcessedFurther])
+	err = checkTransition(requirementWorkflow, currentStatus, WorkflowActionRevise, nil, request)
+	if err != nil {
+		return time.Time{}, err
 	}
 
 	_, err = mtx.ExecContext(
 		ctx,
-		"update kebutuhan set status = $1, alasan_perbaikan = $2, catatan_sp = $3 where kebutuhan_id = $4 and instansi_id = $5",
+		"update kebutuhan set status = $1, alasan_perbaikan = $2, catatan_sp = $3 where kebutuhan_id = $4 and ($5::text[] is null or instansi_id = any($5) or jabatan_fungsional = any($6))",
 		models.RequirementAdmissionStatusRevision,
 		request.RevisionReason,
 		sql.NullString{Valid: request.CoverLetterNote != "", String: request.CoverLetterNote},
 		requirementId.String(),
-		request.AgencyId,
+		scope.sqlArg(),
+		scope.sqlPositionArg(),
 	)
 	if err != nil {
 		return time.Time{}, ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], err)
@@ -885,20 +990,7 @@ func (c *Client) SetRequirementStatusRevisionCtx(ctx context.Context, request *m
 		}
 	}
 
-	modifiedAt = time.Now()
-	_, err = mtx.ExecContext(
-		ctx,
-		"insert into kebutuhan_statushist(kebutuhan_kebutuhan_id, status, modified_at_ts, user_id) values($1, $2, $3, $4)",
-		requirementId.String(),
-		models.RequirementAdmissionStatusRevision,
-		modifiedAt,
-		request.SubmitterAsnId,
-	)
-	if err != nil {
-		return time.Time{}, ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], err)
-	}
-
-	return modifiedAt, nil
+	return c.insertStatusHistoryCtx(ctx, mtx, StatusHistoryModuleRequirement, requirementId.String(), currentStatus, models.RequirementAdmissionStatusRevision, request.SubmitterAsnId, request.RevisionReason)
 }
 
 // GetRequirementVerifiersCtx searches for the list of verifiers of a particular work agency ID (instansi kerja).
@@ -951,7 +1043,8 @@ func (c *Client) GetRequirementVerifiersCtx(ctx context.Context, workAgencyId st
 
 // BulkSubmitRequirementRecommendationLetterCtx submits a recommendation letter for multiple requirements at once.
 // Set isPresigned to true if recommendation letter has been signed before uploading.
-func (c *Client) BulkSubmitRequirementRecommendationLetterCtx(ctx context.Context, requirementIds []string, recommendationLetter *models.Document, submitterAsnId string) (filename string, err error) {
+// All requirement admissions must be in the agency scope.
+func (c *Client) BulkSubmitRequirementRecommendationLetterCtx(ctx context.Context, scope *AgencyScope, requirementIds []string, recommendationLetter *models.Document, submitterAsnId string) (filename string, err error) {
 	mtx, err := c.createMtxDb(ctx, c.Db)
 	if err != nil {
 		return "", err
@@ -982,6 +1075,9 @@ func (c *Client) BulkSubmitRequirementRecommendationLetterCtx(ctx context.Contex
 		if err != nil {
 			return "", ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 		}
+		if err = scope.Check(rd.AgencyId, rd.PositionGrade); err != nil {
+			return "", err
+		}
 		if agencyId == "" {
 			agencyId = rd.AgencyId
 		} else if agencyId != "" && agencyId != rd.AgencyId {
@@ -995,15 +1091,21 @@ func (c *Client) BulkSubmitRequirementRecommendationLetterCtx(ctx context.Contex
 		return "", ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
 
+	documents := make([]string, 0)
+	if recommendationLetter != nil {
+		documents = append(documents, "surat_rekomendasi")
+	}
+
 	invalidStatusRequirementIds := make([]string, 0)
 	notFoundRequirementIds := make([]string, 0)
 	for _, r := range requirementIds {
 		if req, ok := retrievedRequirementIds[r]; !ok {
 			notFoundRequirementIds = append(notFoundRequirementIds, r)
-		} else {
-			if req.Status != models.RequirementAdmissionStatusAccepted {
-				invalidStatusRequirementIds = append(invalidStatusRequirementIds, r)
+		} else if _, checkErr := requirementWorkflow.Check(req.Status, WorkflowActionRecommend, documents, nil); checkErr != nil {
+			if errors.Is(checkErr, workflow.ErrDocumentMissing) {
+				return "", workflowError(checkErr)
 			}
+			invalidStatusRequirementIds = append(invalidStatusRequirementIds, r)
 		}
 	}
 
@@ -1016,8 +1118,9 @@ func (c *Client) BulkSubmitRequirementRecommendationLetterCtx(ctx context.Contex
 	}
 
 	if len(invalidStatusRequirementIds) > 0 {
-		e := ec.NewErrorBasic(ErrCodeRequirementVerificationStatusNotAccepted, Errs[ErrCodeRequirementVerificationStatusNotAccepted])
+		e := ec.NewErrorBasic(ErrCodeWorkflowTransitionInvalid, Errs[ErrCodeWorkflowTransitionInvalid])
 		e.Data = map[string]interface{}{
+			"aksi":                 WorkflowActionRecommend,
 			"invalid_kebutuhan_id": invalidStatusRequirementIds,
 		}
 		return "", e
@@ -1095,7 +1198,7 @@ func (c *Client) BulkSubmitRequirementRecommendationLetterCtx(ctx context.Contex
 		return "", ec.NewError(ErrCodeRoleUnauthorized, Errs[ErrCodeRoleUnauthorized], fmt.Errorf("user %s cannot sign the document", recommendationLetter.SignerId))
 	}
 
-	_, err = mtx.ExecContext(ctx, "update kebutuhan set status = $1 where kebutuhan_id = ANY($2)", models.RequirementAdmissionStatusAcceptedWithRecommendation, pq.Array(requirementIds))
+	_, err = mtx.ExecContext(ctx, "update kebutuhan set status = $1 where kebutuhan_id = ANY($2) and ($3::text[] is null or instansi_id = any($3) or jabatan_fungsional = any($4))", models.RequirementAdmissionStatusAcceptedWithRecommendation, pq.Array(requirementIds), scope.sqlArg(), scope.sqlPositionArg())
 	if err != nil {
 		return "", ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("cannot update kebutuhan status: %w", err))
 	}
@@ -1105,11 +1208,6 @@ func (c *Client) BulkSubmitRequirementRecommendationLetterCtx(ctx context.Contex
 		return "", ec.NewError(ErrCodePrepareFail, Errs[ErrCodePrepareFail], fmt.Errorf("cannot prepare to insert to surat_rekomendasi_kebutuhan: %w", err))
 	}
 
-	statusStmt, err := mtx.PrepareContext(ctx, "insert into kebutuhan_statushist(status, modified_at_ts, kebutuhan_kebutuhan_id, user_id) values ($1, current_timestamp, $2, $3)")
-	if err != nil {
-		return "", ec.NewError(ErrCodePrepareFail, Errs[ErrCodePrepareFail], fmt.Errorf("cannot prepare to insert to kebutuhan_statushist: %w", err))
-	}
-
 	filename, _ = c.RequirementStorage.GenerateRequirementFilename("application/pdf")
 	filename = path.Join(RequirementRecommendationLetterSubdir, filename)
 	baseFilename := path.Base(filename)
@@ -1131,9 +1229,9 @@ func (c *Client) BulkSubmitRequirementRecommendationLetterCtx(ctx context.Contex
 			return "", ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("cannot insert entry to surat_rekomendasi_kebutuhan: %w", err))
 		}
 
-		_, err = statusStmt.ExecContext(ctx, models.RequirementAdmissionStatusAcceptedWithRecommendation, rid, submitterAsnId)
+		_, err = c.insertStatusHistoryCtx(ctx, mtx, StatusHistoryModuleRequirement, rid, retrievedRequirementIds[rid].Status, models.RequirementAdmissionStatusAcceptedWithRecommendation, submitterAsnId, "")
 		if err != nil {
-			return "", ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("cannot insert entry to kebutuhan_statushist: %w", err))
+			return "", err
 		}
 	}
 
@@ -1144,7 +1242,7 @@ func (c *Client) BulkSubmitRequirementRecommendationLetterCtx(ctx context.Contex
 	fistAgencyName := agencies[agencyId] // Assume that all requirements have the same agency ID, so only 1 ID is in the map
 	err = c.generateRequirementRecommendationLetterCtx(ctx, filename, c.createRequirementRecommendationLetterTemplate(recommendationLetter.DocumentNumber, string(recommendationLetter.DocumentDate), firstFunctionalPosition, fistAgencyName, retrievedRequirementIds))
 	if err != nil {
-		if errors.Is(err, docx.ErrSiasnRendererBadTemplate) {
+		if errors.Is(err, docx.ErrBadTemplate) {
 			return "", ec.NewError(ErrCodeDocumentGenerateBadTemplate, Errs[ErrCodeDocumentGenerateBadTemplate], err)
 		}
 		return "", ec.NewError(ErrCodeDocumentGenerate, Errs[ErrCodeDocumentGenerate], err)
@@ -1209,55 +1307,100 @@ func (c *Client) createRequirementRecommendationLetterTemplate(documentNumber, d
 	return data
 }
 
-// SignRequirementRecommendationLetterCtx signs a requirement recommendation letter, async.
-func (c *Client) SignRequirementRecommendationLetterCtx(ctx context.Context, filename string) (err error) {
-	// TODO implement real signing
-	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
-	d := 0
-	err = mdb.QueryRowContext(ctx, "update surat_rekomendasi_kebutuhan set is_signed = true, signedat = current_timestamp where filename = $1 returning 1", filename).Scan(&d)
+// SignRequirementRecommendationLetterCtx signs a requirement recommendation letter electronically as identity with the
+// client Signer. Only the signer of the letter, signerAsnId, can sign it, other users get
+// errnum.ErrCodeRoleUnauthorized. The signed letter is stored next to the unsigned one, prefixed with `signed-`.
+// Signing an already signed letter does nothing. Only letters of requirement admissions in the agency scope are signed,
+// the others are treated as not found.
+//
+// The letter entries are locked until the letter is signed, so that it is signed only once.
+func (c *Client) SignRequirementRecommendationLetterCtx(ctx context.Context, scope *AgencyScope, filename string, signerAsnId string, identity *esign.Identity) (err error) {
+	mtx, err := c.createMtxDb(ctx, c.Db)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return ErrEntryNotFound
-		}
-
-		return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+		return err
 	}
+	defer func() {
+		c.completeMtx(mtx, err)
+	}()
 
-	return nil
-}
-
-// GetRequirementStatusStatisticCtx returns the number of requirement items for each status.
-func (c *Client) GetRequirementStatusStatisticCtx(ctx context.Context) (statistics []*models.StatisticStatus, err error) {
-	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
-	rows, err := mdb.QueryContext(ctx, "select status, jumlah from kebutuhan_status_statistik")
+	rows, err := mtx.QueryContext(ctx, "select s.is_signed, coalesce(s.ttd_user_id, '') from surat_rekomendasi_kebutuhan s join kebutuhan k on s.kebutuhan_id = k.kebutuhan_id where s.filename = $1 and ($2::text[] is null or k.instansi_id = any($2) or k.jabatan_fungsional = any($3)) for update of s", filename, scope.sqlArg(), scope.sqlPositionArg())
 	if err != nil {
-		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+		return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
 	defer rows.Close()
 
-	statistics = make([]*models.StatisticStatus, 0)
-	statisticMap := make(map[int]*models.StatisticStatus)
-	for status := range models.RequirementAdmissionStatuses {
-		statusStatistic := &models.StatisticStatus{
-			Status: status,
-		}
-		statistics = append(statistics, statusStatistic)
-		statisticMap[status] = statusStatistic
-	}
+	found := false
+	isSigned := true
 	for rows.Next() {
-		var temp models.StatisticStatus
-		err = rows.Scan(&temp.Status, &temp.Count)
+		rowIsSigned := false
+		letterSignerAsnId := ""
+		err = rows.Scan(&rowIsSigned, &letterSignerAsnId)
 		if err != nil {
-			return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+			return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 		}
-		statusStatistic, ok := statisticMap[temp.Status]
-		if ok {
-			statusStatistic.Count = temp.Count
+
+		if letterSignerAsnId != signerAsnId {
+			return ec.NewError(ErrCodeRoleUnauthorized, Errs[ErrCodeRoleUnauthorized], fmt.Errorf("user %s cannot sign the document", signerAsnId))
 		}
+
+		found = true
+		isSigned = isSigned && rowIsSigned
 	}
 	if err = rows.Err(); err != nil {
-		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+		return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
 	}
+	_ = rows.Close()
+
+	if !found {
+		return ErrEntryNotFound
+	}
+
+	if isSigned {
+		return nil
+	}
+
+	err = c.signPdfCtx(
+		ctx,
+		identity,
+		path.Join(RequirementRecommendationLetterSubdir, filename),
+		path.Join(RequirementRecommendationLetterSubdir, fmt.Sprintf("signed-%s", filename)),
+		c.RequirementStorage.GetRequirementFile,
+		c.RequirementStorage.PutRequirementFile,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = mtx.ExecContext(ctx, "update surat_rekomendasi_kebutuhan s set is_signed = true, signedat = current_timestamp from kebutuhan k where s.kebutuhan_id = k.kebutuhan_id and s.filename = $1 and ($2::text[] is null or k.instansi_id = any($2) or k.jabatan_fungsional = any($3))", filename, scope.sqlArg(), scope.sqlPositionArg())
+	if err != nil {
+		return ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], err)
+	}
+
+	return nil
+}
+
+// requirementStatisticSource is the source of the requirement status statistics.
+var requirementStatisticSource = &statisticSource{
+	table:          "kebutuhan",
+	statuses:       models.RequirementAdmissionStatuses,
+	dateColumn:     "tgl_usulan",
+	agencyColumn:   "instansi_id",
+	positionColumn: "jabatan_fungsional",
+}
+
+// GetRequirementStatusStatisticCtx returns the number of requirement items for each status, limited to scope
+// and filter. filter.GroupBy is ignored.
+func (c *Client) GetRequirementStatusStatisticCtx(ctx context.Context, scope *AgencyScope, filter *StatisticFilter) (statistics []*models.StatisticStatus, err error) {
+	periods, err := c.getStatusStatisticCtx(ctx, requirementStatisticSource, scope, filter, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return periods[0].Statuses, nil
+}
 
-	return statistics, nil
+// GetRequirementStatusStatisticSeriesCtx returns the number of requirement items for each status in each period of
+// filter.GroupBy, limited to scope and filter.
+func (c *Client) GetRequirementStatusStatisticSeriesCtx(ctx context.Context, scope *AgencyScope, filter *StatisticFilter) (periods []*models.StatisticPeriod, err error) {
+	return c.getStatusStatisticCtx(ctx, requirementStatisticSource, scope, filter, true)
 }
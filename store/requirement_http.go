@@ -11,6 +11,7 @@ import (
 	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/httputil"
+	"github.com/fazrithe/siasn-jf-backend-git/store/esign"
 	"github.com/fazrithe/siasn-jf-backend-git/store/models"
 	"github.com/fazrithe/siasn-jf-backend-git/store/object"
 	"github.com/google/uuid"
@@ -35,8 +36,11 @@ const (
 	TimeoutRequirementAdmissionVerification                            = TimeoutDefault
 	TimeoutRequirementVerifierGet                                      = TimeoutDefault
 	TimeoutRequirementVerificationBulkSubmitRecommendationLetter       = TimeoutDefault
-	TimeoutRequirementVerificationSignRecommendationLetter             = TimeoutDefault
+	TimeoutRequirementVerificationSignRecommendationLetter             = TimeoutSign
 	TimeoutGetRequirementStatusStatistic                               = TimeoutDefault
+	TimeoutGetRequirementStatusStatisticSeries                         = TimeoutDefault
+	TimeoutRequirementHistoryGet                                       = TimeoutDefault
+	TimeoutRequirementActionsGet                                       = TimeoutDefault
 )
 
 // HandleRequirementAdmissionSubmit handles a new admission request.
@@ -53,6 +57,7 @@ func (c *Client) HandleRequirementAdmissionSubmit(writer http.ResponseWriter, re
 
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutRequirementAdmissionSubmit)
 	defer cancel()
+	ctx = c.withRequestMetadata(ctx, request)
 
 	rr.SubmitterAsnId = user.AsnId
 	rr.AgencyId = user.WorkAgencyId
@@ -64,6 +69,8 @@ func (c *Client) HandleRequirementAdmissionSubmit(writer http.ResponseWriter, re
 		return
 	}
 
+	c.notifyStatusChange(request, StatusHistoryModuleRequirement, requirementId, models.RequirementAdmissionStatusCreated, "")
+
 	_ = httputil.WriteObj200(writer, map[string]string{
 		"kebutuhan_id": requirementId,
 	})
@@ -77,6 +84,7 @@ func (c *Client) HandleRequirementAdmissionEdit(writer http.ResponseWriter, requ
 
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutRequirementAdmissionEdit)
 	defer cancel()
+	ctx = c.withRequestMetadata(ctx, request)
 
 	r := &models.RequirementAdmission{}
 	err := c.decodeRequestJson(writer, request, r)
@@ -87,7 +95,13 @@ func (c *Client) HandleRequirementAdmissionEdit(writer http.ResponseWriter, requ
 	r.SubmitterAsnId = user.AsnId
 	r.AgencyId = user.WorkAgencyId
 
-	err = c.EditRequirementAdmissionCtx(ctx, r)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	err = c.EditRequirementAdmissionCtx(ctx, scope, r)
 	if err != nil {
 		c.httpError(writer, err)
 		return
@@ -345,10 +359,9 @@ func (c *Client) HandleRequirementAdmissionSearchPaginated(writer http.ResponseW
 
 	type schemaAdmissionSearch struct {
 		// AdmissionDate is a date with a format of YYYY-MM-DD (e.g. 2006-12-31)
-		AdmissionDate   string `schema:"tgl_usulan"`
-		AdmissionStatus int    `schema:"status"`
-		PageNumber      int    `schema:"halaman"`
-		CountPerPage    int    `schema:"jumlah_per_halaman"`
+		AdmissionDate string `schema:"tgl_usulan"`
+		PageNumber    int    `schema:"halaman"`
+		CountPerPage  int    `schema:"jumlah_per_halaman"`
 	}
 
 	user := auth.AssertReqGetUserDetail(request)
@@ -374,8 +387,8 @@ func (c *Client) HandleRequirementAdmissionSearchPaginated(writer http.ResponseW
 		return
 	}
 
-	if _, ok := models.RequirementAdmissionStatuses[query.AdmissionStatus]; query.AdmissionStatus != 0 && !ok {
-		c.httpError(writer, ec.NewErrorBasic(ErrCodeRequirementFilterStatusInvalid, Errs[ErrCodeRequirementFilterStatusInvalid]))
+	options, err := c.decodeAdmissionSearchOptions(writer, request, models.RequirementAdmissionStatuses, ErrCodeRequirementFilterStatusInvalid, ErrCodeRequirementFilterInvalidDate)
+	if err != nil {
 		return
 	}
 
@@ -389,11 +402,11 @@ func (c *Client) HandleRequirementAdmissionSearchPaginated(writer http.ResponseW
 	}
 
 	searchFilter := &RequirementAdmissionSearchFilter{
-		AgencyId:        user.WorkAgencyId,
-		AdmissionDate:   admissionDate,
-		AdmissionStatus: query.AdmissionStatus,
-		CountPerPage:    countPerPage,
-		PageNumber:      pageNumber,
+		AgencyId:               user.WorkAgencyId,
+		AdmissionDate:          admissionDate,
+		AdmissionSearchOptions: *options,
+		CountPerPage:           countPerPage,
+		PageNumber:             pageNumber,
 	}
 
 	admissions, err := c.SearchRequirementAdmissionsPaginatedCtx(ctx, searchFilter)
@@ -405,14 +418,61 @@ func (c *Client) HandleRequirementAdmissionSearchPaginated(writer http.ResponseW
 	_ = httputil.WriteObj200(writer, (*models.IdPaginatedList)(admissions))
 }
 
+// HandleRequirementAdmissionExport handles a request to export every requirement admission of a work agency
+// matching the search filters as an xlsx or csv file. Agency ID will be retrieved from authentication token.
+func (c *Client) HandleRequirementAdmissionExport(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutExport)
+	defer cancel()
+
+	type schemaAdmissionExport struct {
+		// AdmissionDate is a date with a format of YYYY-MM-DD (e.g. 2006-12-31)
+		AdmissionDate string `schema:"tgl_usulan"`
+		// Format is either xlsx (default) or csv.
+		Format string `schema:"format"`
+	}
+
+	user := auth.AssertReqGetUserDetail(request)
+
+	query := &schemaAdmissionExport{}
+	err := c.decodeRequestSchema(writer, request, query)
+	if err != nil {
+		return
+	}
+
+	options, err := c.decodeAdmissionSearchOptions(writer, request, models.RequirementAdmissionStatuses, ErrCodeRequirementFilterStatusInvalid, ErrCodeRequirementFilterInvalidDate)
+	if err != nil {
+		return
+	}
+
+	var admissionDate models.Iso8601Date
+	if query.AdmissionDate != "" {
+		admissionDate, err = models.ParseIso8601Date(query.AdmissionDate)
+		if err != nil {
+			c.httpError(writer, ec.NewError(ErrCodeRequirementFilterInvalidDate, Errs[ErrCodeRequirementFilterInvalidDate], err))
+			return
+		}
+	}
+
+	table, err := c.newHttpExport(writer, query.Format, "usulan-kebutuhan")
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	err = c.ExportRequirementAdmissionsCtx(ctx, &RequirementAdmissionSearchFilter{
+		AgencyId:               user.WorkAgencyId,
+		AdmissionDate:          admissionDate,
+		AdmissionSearchOptions: *options,
+	}, table)
+	c.finishHttpExport(writer, table, err)
+}
+
 // HandleRequirementAdmissionDetailGet handles a request to get admission detail with matched id.
 func (c *Client) HandleRequirementAdmissionDetailGet(writer http.ResponseWriter, request *http.Request) {
 	type schemaAdmissionDetail struct {
 		RequirementId string `schema:"kebutuhan_id"`
 	}
 
-	user := auth.AssertReqGetUserDetail(request)
-
 	query := &schemaAdmissionDetail{}
 	err := c.decodeRequestSchema(writer, request, query)
 	if err != nil {
@@ -427,7 +487,13 @@ func (c *Client) HandleRequirementAdmissionDetailGet(writer http.ResponseWriter,
 		return
 	}
 
-	admission, err := c.GetRequirementAdmissionDetailCtx(ctx, query.RequirementId, user.WorkAgencyId)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	admission, err := c.GetRequirementAdmissionDetailCtx(ctx, query.RequirementId, scope)
 	if err != nil {
 		c.httpError(writer, err)
 		return
@@ -563,7 +629,6 @@ func (c *Client) HandleRequirementVerificationRecommendationLetterDownloadUnsign
 	http.Redirect(writer, request, url.String(), http.StatusFound)
 }
 
-// Deprecated: signed letter can be downloaded from Teken Digital.
 // HandleRequirementVerificationRecommendationLetterDownloadSigned handles a request to download signed recommendation letter in permanent location.
 // This will redirect your request to the storage signed URL.
 func (c *Client) HandleRequirementVerificationRecommendationLetterDownloadSigned(writer http.ResponseWriter, request *http.Request) {
@@ -606,16 +671,25 @@ func (c *Client) HandleRequirementVerificationSet(writer http.ResponseWriter, re
 
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutRequirementAdmissionVerification)
 	defer cancel()
+	ctx = c.withRequestMetadata(ctx, request)
 
 	rv.SubmitterAsnId = user.AsnId
 	rv.AgencyId = user.WorkAgencyId
 
-	modifiedAt, err := c.SetRequirementStatusAcceptedCtx(ctx, rv)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
 	if err != nil {
 		c.httpError(writer, err)
 		return
 	}
 
+	modifiedAt, err := c.SetRequirementStatusAcceptedCtx(ctx, scope, rv)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	c.notifyStatusChange(request, StatusHistoryModuleRequirement, rv.RequirementId, models.RequirementAdmissionStatusAccepted, "")
+
 	_ = httputil.WriteObj200(writer, map[string]interface{}{
 		"kebutuhan_id": rv.RequirementId,
 		"modified_at":  modifiedAt.Unix(),
@@ -634,17 +708,26 @@ func (c *Client) HandleRequirementDenySet(writer http.ResponseWriter, request *h
 
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutRequirementAdmissionVerification)
 	defer cancel()
+	ctx = c.withRequestMetadata(ctx, request)
 
 	rd.SubmitterAsnId = user.AsnId
 	rd.AgencyId = user.WorkAgencyId
 	rd.DenyTimestamp = models.EpochTime(time.Now())
 
-	modifiedAt, err := c.SetRequirementStatusRevisionCtx(ctx, rd)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
 	if err != nil {
 		c.httpError(writer, err)
 		return
 	}
 
+	modifiedAt, err := c.SetRequirementStatusRevisionCtx(ctx, scope, rd)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	c.notifyStatusChange(request, StatusHistoryModuleRequirement, rd.RequirementId, models.RequirementAdmissionStatusRevision, rd.RevisionReason)
+
 	_ = httputil.WriteObj200(writer, map[string]interface{}{
 		"kebutuhan_id": rd.RequirementId,
 		"modified_at":  modifiedAt.Unix(),
@@ -673,6 +756,7 @@ func (c *Client) HandleRequirementVerifiersGet(writer http.ResponseWriter, reque
 func (c *Client) HandleRequirementVerificationBulkSubmitRecommendationLetter(writer http.ResponseWriter, request *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutRequirementVerificationBulkSubmitRecommendationLetter)
 	defer cancel()
+	ctx = c.withRequestMetadata(ctx, request)
 
 	user := auth.AssertReqGetUserDetail(request)
 
@@ -691,25 +775,39 @@ func (c *Client) HandleRequirementVerificationBulkSubmitRecommendationLetter(wri
 		return
 	}
 
-	filename, err := c.BulkSubmitRequirementRecommendationLetterCtx(ctx, s.RequirementIds, s.RecommendationLetter, user.AsnId)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
 	if err != nil {
 		c.httpError(writer, err)
 		return
 	}
 
+	filename, err := c.BulkSubmitRequirementRecommendationLetterCtx(ctx, scope, s.RequirementIds, s.RecommendationLetter, user.AsnId)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	for _, requirementId := range s.RequirementIds {
+		c.notifyStatusChange(request, StatusHistoryModuleRequirement, requirementId, models.RequirementAdmissionStatusAcceptedWithRecommendation, "")
+	}
+
 	_ = httputil.WriteObj200(writer, map[string]interface{}{
 		"kebutuhan_id": s.RequirementIds,
 		"filename":     filename,
 	})
 }
 
-// HandleRequirementVerificationSignRecommendationLetter handles a request to async sign the recommendation letter.
+// HandleRequirementVerificationSignRecommendationLetter handles a request to sign the recommendation letter.
+// Only the signer of the letter can sign it, with their own certificate passphrase.
 func (c *Client) HandleRequirementVerificationSignRecommendationLetter(writer http.ResponseWriter, request *http.Request) {
+	user := auth.AssertReqGetUserDetail(request)
+
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutRequirementVerificationSignRecommendationLetter)
 	defer cancel()
 
 	type schemaFilename struct {
-		Filename string `json:"filename"`
+		Filename   string `json:"filename"`
+		Passphrase string `json:"passphrase,omitempty"`
 	}
 	s := &schemaFilename{}
 	err := c.decodeRequestJson(writer, request, s)
@@ -722,21 +820,41 @@ func (c *Client) HandleRequirementVerificationSignRecommendationLetter(writer ht
 		return
 	}
 
-	err = c.SignRequirementRecommendationLetterCtx(ctx, s.Filename)
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
 	if err != nil {
 		c.httpError(writer, err)
 		return
 	}
 
+	err = c.SignRequirementRecommendationLetterCtx(ctx, scope, s.Filename, user.AsnId, &esign.Identity{Nik: user.Nik, Passphrase: s.Passphrase})
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	// Never echo the passphrase back.
+	s.Passphrase = ""
 	_ = httputil.WriteObj200(writer, s)
 }
 
-// HandleGetRequirementStatusStatistic returns the number of requirement items for each status.
-func (c *Client) HandleGetRequirementStatusStatistic(writer http.ResponseWriter, _ *http.Request) {
+// HandleGetRequirementStatusStatistic returns the number of requirement items for each status, within the agency scope
+// of the user. The statistic can be filtered by agency, functional position and admission date range.
+func (c *Client) HandleGetRequirementStatusStatistic(writer http.ResponseWriter, request *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), TimeoutGetRequirementStatusStatistic)
 	defer cancel()
 
-	statistic, err := c.GetRequirementStatusStatisticCtx(ctx)
+	filter, err := c.decodeStatisticFilter(writer, request)
+	if err != nil {
+		return
+	}
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	statistic, err := c.GetRequirementStatusStatisticCtx(ctx, scope, filter)
 	if err != nil {
 		c.httpError(writer, err)
 		return
@@ -744,3 +862,89 @@ func (c *Client) HandleGetRequirementStatusStatistic(writer http.ResponseWriter,
 
 	_ = httputil.WriteObj200(writer, statistic)
 }
+
+// HandleGetRequirementStatusStatisticSeries returns the number of requirement items for each status in each month,
+// quarter or year, within the agency scope of the user. It accepts the same filters as
+// HandleGetRequirementStatusStatistic.
+func (c *Client) HandleGetRequirementStatusStatisticSeries(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutGetRequirementStatusStatisticSeries)
+	defer cancel()
+
+	filter, err := c.decodeStatisticFilter(writer, request)
+	if err != nil {
+		return
+	}
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	periods, err := c.GetRequirementStatusStatisticSeriesCtx(ctx, scope, filter)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, periods)
+}
+
+// HandleRequirementHistoryGet handles the request to get the status history of a requirement admission, oldest first.
+func (c *Client) HandleRequirementHistoryGet(writer http.ResponseWriter, request *http.Request) {
+	type schemaRequirementId struct {
+		RequirementId string `schema:"kebutuhan_id"`
+	}
+	sh := &schemaRequirementId{}
+	err := c.decodeRequestSchema(writer, request, sh)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutRequirementHistoryGet)
+	defer cancel()
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	history, err := c.GetStatusHistoryCtx(ctx, StatusHistoryModuleRequirement, sh.RequirementId, scope)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, history)
+}
+
+// HandleRequirementActionsGet handles the request to get the current status of a requirement admission and the
+// actions the user can do next, so that the frontend can show only the allowed actions.
+func (c *Client) HandleRequirementActionsGet(writer http.ResponseWriter, request *http.Request) {
+	type schemaRequirementId struct {
+		RequirementId string `schema:"kebutuhan_id"`
+	}
+	sh := &schemaRequirementId{}
+	err := c.decodeRequestSchema(writer, request, sh)
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutRequirementActionsGet)
+	defer cancel()
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	actions, err := c.GetAdmissionActionsCtx(ctx, StatusHistoryModuleRequirement, sh.RequirementId, scope, ReqGetUserRoles(request))
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, actions)
+}
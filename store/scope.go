@@ -0,0 +1,245 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/metricutil"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+	"github.com/lib/pq"
+)
+
+const (
+	// PembinaPositionCacheTtl is how long the functional positions supervised by a pembina agency are cached.
+	// kel_jabatan rarely changes, so the positions do not have to be queried on every request.
+	PembinaPositionCacheTtl = 10 * time.Minute
+)
+
+// AgencyScope describes the entries a user can see and mutate. Store functions that retrieve or mutate a single entry
+// take a scope, and behave as if the entry does not exist (errnum.ErrEntryNotFound) if it is outside the scope.
+//
+// Agency users are scoped to their own work agency. Pembina users are also scoped to the entries of the functional
+// positions (jabatan fungsional) they supervise, which are those whose kel_jabatan.pembina_id is the pembina agency,
+// whatever the agency of the entries. Entries that do not record a functional position, such as dismissals, are
+// only scoped by agency. BKN admins are unrestricted. Service accounts are scoped to the agencies they are configured
+// with, whatever their roles.
+type AgencyScope struct {
+	// AgencyIds lists the agencies in the scope. Ignored if Unrestricted is true.
+	AgencyIds []string
+	// PositionIds lists the functional positions in the scope. Ignored if Unrestricted is true.
+	PositionIds []string
+	// Unrestricted scope contains every agency.
+	Unrestricted bool
+}
+
+// NewAgencyScope creates a scope limited to the given agencies.
+func NewAgencyScope(agencyIds ...string) *AgencyScope {
+	scope := &AgencyScope{AgencyIds: []string{}, PositionIds: []string{}}
+	for _, agencyId := range agencyIds {
+		if agencyId != "" && !scope.Contains(agencyId) {
+			scope.AgencyIds = append(scope.AgencyIds, agencyId)
+		}
+	}
+	return scope
+}
+
+// NewUnrestrictedAgencyScope creates a scope that contains every agency.
+func NewUnrestrictedAgencyScope() *AgencyScope {
+	return &AgencyScope{Unrestricted: true}
+}
+
+// Contains checks whether agencyId is in the scope.
+func (s *AgencyScope) Contains(agencyId string) bool {
+	if s.Unrestricted {
+		return true
+	}
+
+	for _, id := range s.AgencyIds {
+		if id == agencyId {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ContainsPosition checks whether positionId is one of the functional positions in the scope.
+func (s *AgencyScope) ContainsPosition(positionId string) bool {
+	if s.Unrestricted {
+		return true
+	}
+
+	for _, id := range s.PositionIds {
+		if id == positionId {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check returns errnum.ErrEntryNotFound if an entry of agencyId and functional position positionId is not in the
+// scope. positionId can be empty for entries that do not record a functional position.
+func (s *AgencyScope) Check(agencyId, positionId string) error {
+	if !s.Contains(agencyId) && (positionId == "" || !s.ContainsPosition(positionId)) {
+		return ec.NewError(ErrCodeEntryNotFound, Errs[ErrCodeEntryNotFound], fmt.Errorf("agency %s and position %s are not in scope", agencyId, positionId))
+	}
+	return nil
+}
+
+// sqlArg returns the scope as a query argument. It is a text array of the agency IDs, or NULL if the scope is
+// unrestricted. Use it with a condition such as `($2::text[] is null or instansi_id = any($2))`.
+func (s *AgencyScope) sqlArg() interface{} {
+	if s.Unrestricted {
+		return pq.Array([]string(nil))
+	}
+	return pq.Array(s.AgencyIds)
+}
+
+// sqlPositionArg returns the functional positions of the scope as a query argument, to be used together with sqlArg
+// in a condition such as `($2::text[] is null or instansi_id = any($2) or jabatan_fungsional = any($3))`.
+func (s *AgencyScope) sqlPositionArg() interface{} {
+	if s.PositionIds == nil {
+		return pq.Array([]string{})
+	}
+	return pq.Array(s.PositionIds)
+}
+
+// GetAgencyScopeCtx creates the agency scope of a user, given the roles of the user (see GetUserRolesCtx).
+func (c *Client) GetAgencyScopeCtx(ctx context.Context, user *auth.Asn, roles map[string]struct{}) (scope *AgencyScope, err error) {
+	if user.ScopeAgencyIds != nil {
+		return NewAgencyScope(user.ScopeAgencyIds...), nil
+	}
+
+	if HasAnyRole(roles, models.RoleBknAdmin) {
+		return NewUnrestrictedAgencyScope(), nil
+	}
+
+	scope = NewAgencyScope(user.WorkAgencyId)
+	if !HasAnyRole(roles, models.RolePembina) {
+		return scope, nil
+	}
+
+	scope.PositionIds, err = c.getPembinaPositionIdsCtx(ctx, user.WorkAgencyId)
+	if err != nil {
+		return nil, err
+	}
+
+	return scope, nil
+}
+
+// PembinaPositionCache caches the functional positions supervised by pembina agencies. Entries expire after Ttl.
+// It is safe for concurrent use.
+type PembinaPositionCache struct {
+	Ttl     time.Duration
+	mutex   sync.Mutex
+	entries map[string]*pembinaPositionCacheEntry
+}
+
+type pembinaPositionCacheEntry struct {
+	positionIds []string
+	expiresAt   time.Time
+}
+
+// NewPembinaPositionCache creates a PembinaPositionCache whose entries expire after ttl.
+func NewPembinaPositionCache(ttl time.Duration) *PembinaPositionCache {
+	return &PembinaPositionCache{
+		Ttl:     ttl,
+		entries: make(map[string]*pembinaPositionCacheEntry),
+	}
+}
+
+// Get returns the cached positions of a pembina agency. ok is false if there are none.
+func (p *PembinaPositionCache) Get(pembinaAgencyId string) (positionIds []string, ok bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	entry, ok := p.entries[pembinaAgencyId]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(p.entries, pembinaAgencyId)
+		return nil, false
+	}
+	return entry.positionIds, true
+}
+
+// Set caches the positions of a pembina agency. The number of pembina agencies is small, so entries are only removed
+// when they are found expired.
+func (p *PembinaPositionCache) Set(pembinaAgencyId string, positionIds []string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.entries[pembinaAgencyId] = &pembinaPositionCacheEntry{positionIds: positionIds, expiresAt: time.Now().Add(p.Ttl)}
+}
+
+// getPembinaPositionIdsCtx retrieves the functional positions supervised by a pembina agency, that is the positions
+// whose kel_jabatan.pembina_id is pembinaAgencyId. The result is cached in c.PembinaPositionCache if it is not nil.
+func (c *Client) getPembinaPositionIdsCtx(ctx context.Context, pembinaAgencyId string) (positionIds []string, err error) {
+	if c.PembinaPositionCache != nil {
+		if positionIds, ok := c.PembinaPositionCache.Get(pembinaAgencyId); ok {
+			return positionIds, nil
+		}
+	}
+
+	referenceMdb := metricutil.NewDB(c.ReferenceDb, c.SqlMetrics)
+	rows, err := referenceMdb.QueryContext(ctx, "select jf.id from jabatan_fungsional jf join kel_jabatan kj on jf.kel_jabatan_id = kj.id where kj.pembina_id = $1", pembinaAgencyId)
+	if err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+	defer rows.Close()
+
+	positionIds = make([]string, 0)
+	for rows.Next() {
+		positionId := ""
+		err = rows.Scan(&positionId)
+		if err != nil {
+			return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+		}
+		positionIds = append(positionIds, positionId)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+
+	if c.PembinaPositionCache != nil {
+		c.PembinaPositionCache.Set(pembinaAgencyId, positionIds)
+	}
+
+	return positionIds, nil
+}
+
+// reqGetAgencyScopeCtx creates the agency scope of the user of the request, using the roles attached by
+// RoleAuthHandler.
+func (c *Client) reqGetAgencyScopeCtx(ctx context.Context, request *http.Request) (scope *AgencyScope, err error) {
+	return c.GetAgencyScopeCtx(ctx, auth.AssertReqGetUserDetail(request), ReqGetUserRoles(request))
+}
+
+// checkAsnAgencyScopeCtx checks that an entry of an ASN and functional position positionId is in the scope. This is
+// used for entries that do not store the agency themselves, such as promotions, the work agency of the ASN is used
+// instead. Entries outside of the scope return errnum.ErrEntryNotFound. Unrestricted scope, or a position in the
+// scope, does not query anything.
+func (c *Client) checkAsnAgencyScopeCtx(ctx context.Context, scope *AgencyScope, asnId, positionId string) (err error) {
+	if scope.Unrestricted || (positionId != "" && scope.ContainsPosition(positionId)) {
+		return nil
+	}
+
+	profileMdb := metricutil.NewDB(c.ProfileDb, c.SqlMetrics)
+
+	agencyId := ""
+	err = profileMdb.QueryRowContext(ctx, "select instansi_kerja_id from pns where id = $1 union all select instansi_kerja_id from pppk where id = $1 limit 1", asnId).Scan(&agencyId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ec.NewError(ErrCodeEntryNotFound, Errs[ErrCodeEntryNotFound], fmt.Errorf("agency of ASN %s cannot be found", asnId))
+		}
+		return ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+
+	return scope.Check(agencyId, "")
+}
@@ -0,0 +1,273 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/metricutil"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+	"github.com/lib/pq"
+)
+
+// The types of the hits of a full-text search, the modules of the admissions searched.
+const (
+	SearchTypeActivity    = StatusHistoryModuleActivity
+	SearchTypeRequirement = StatusHistoryModuleRequirement
+	SearchTypeDismissal   = StatusHistoryModuleDismissal
+	SearchTypePromotion   = StatusHistoryModulePromotion
+)
+
+const (
+	// DefaultSearchCount is the number of hits returned by a full-text search if the count is not set.
+	DefaultSearchCount = 20
+
+	// maxSearchTerms is the maximum number of words of a full-text search, the other words are ignored.
+	maxSearchTerms = 8
+	// minSearchTermLength is the minimum length of a word of a full-text search, shorter words are ignored since
+	// they are also searched as the start of a word and would match most admissions.
+	minSearchTermLength = 2
+)
+
+// fullTextSearchSource describes an admission table searched by SearchCtx.
+type fullTextSearchSource struct {
+	hitType string
+	table   *admissionSearchTable
+	// scope describes how the admissions are limited to an agency scope, as for status statistics.
+	scope *statisticSource
+	// columns are the columns of the hits, scanned into the ID, the admission number, the status, the admission date,
+	// the title, the agency and the ASN of a hit, in that order.
+	columns string
+	// asnCondition matches the admissions of the ASNs whose name matches the search, %s is replaced by their IDs.
+	// Empty if the admissions do not have ASNs.
+	asnCondition string
+}
+
+// fullTextSearchSources lists the admissions searched by SearchCtx, by hit type. Each table has a pencarian column
+// indexed for full-text search, see migration 0006_full_text_search.
+var fullTextSearchSources = map[string]*fullTextSearchSource{
+	SearchTypeActivity: {
+		hitType:      SearchTypeActivity,
+		table:        activityAdmissionSearchTable,
+		scope:        activityStatisticSource,
+		columns:      "kegiatan_id, no_usulan, status, tgl_usulan, nama, instansi_id, ''",
+		asnCondition: "kegiatan_id in (select kegiatan_kegiatan_id from perserta_kegiatan where pegawai_user_id = any(%s))",
+	},
+	SearchTypeRequirement: {
+		hitType: SearchTypeRequirement,
+		table:   requirementAdmissionSearchTable,
+		scope:   requirementStatisticSource,
+		columns: "kebutuhan_id, no_usulan, status, tgl_usulan, '', instansi_id, ''",
+	},
+	SearchTypeDismissal: {
+		hitType:      SearchTypeDismissal,
+		table:        dismissalAdmissionSearchTable,
+		scope:        dismissalStatisticSource,
+		columns:      "uuid_pemberhentian, no_usulan, status, tgl_pemberhentian, '', instansi_id, asn_id",
+		asnCondition: "asn_id = any(%s)",
+	},
+	SearchTypePromotion: {
+		hitType:      SearchTypePromotion,
+		table:        promotionAdmissionSearchTable,
+		scope:        promotionStatisticSource,
+		columns:      "uuid_pengangkatan, no_usulan, status, tgl_usulan, '', '', asn_id",
+		asnCondition: "asn_id = any(%s)",
+	},
+}
+
+// SearchTypes lists the valid types of the hits of a full-text search, in the order they are searched.
+var SearchTypes = []string{SearchTypeActivity, SearchTypeRequirement, SearchTypeDismissal, SearchTypePromotion}
+
+// FullTextSearch is a full-text search of the admissions.
+type FullTextSearch struct {
+	// Query is the text searched. Each word of at least minSearchTermLength letters or digits must match a word of
+	// the admission, as a whole word, as an inflection of it or as its start. Other characters separate the words.
+	Query string
+
+	// Types limits the hits to some types, one of SearchTypes. Empty searches every type.
+	Types []string
+
+	// Count is the maximum number of hits returned, DefaultSearchCount if it is 0.
+	Count int
+}
+
+// SearchCtx searches for the admissions matching search, within scope. Admissions match if their own text matches,
+// or if the name of their ASN or of one of their attendees matches. The most relevant hits are returned first.
+// It returns errnum.ErrSearchQueryInvalid if search.Query does not contain any word to search, and
+// errnum.ErrSearchTypeInvalid if a type is not supported.
+func (c *Client) SearchCtx(ctx context.Context, scope *AgencyScope, search *FullTextSearch) (hits []*models.SearchHit, err error) {
+	tsQuery := fullTextSearchQuery(search.Query)
+	if tsQuery == "" {
+		return nil, ErrSearchQueryInvalid
+	}
+
+	types := search.Types
+	if len(types) == 0 {
+		types = SearchTypes
+	}
+
+	sources := make([]*fullTextSearchSource, 0, len(types))
+	searchAsns := false
+	for _, hitType := range types {
+		source, ok := fullTextSearchSources[hitType]
+		if !ok {
+			return nil, ErrSearchTypeInvalid
+		}
+		if containsFullTextSearchSource(sources, source) {
+			continue
+		}
+		sources = append(sources, source)
+		searchAsns = searchAsns || source.asnCondition != ""
+	}
+
+	count := search.Count
+	if count == 0 {
+		count = DefaultSearchCount
+	}
+
+	asnIds := make([]string, 0)
+	if searchAsns {
+		asnIds, err = c.searchAsnIdsByNameCtx(ctx, tsQuery)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hits = make([]*models.SearchHit, 0)
+	for _, source := range sources {
+		sourceHits, err := c.searchFullTextSourceCtx(ctx, source, scope, tsQuery, asnIds, count)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, sourceHits...)
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Rank > hits[j].Rank
+	})
+	if len(hits) > count {
+		hits = hits[:count]
+	}
+
+	return hits, nil
+}
+
+// searchFullTextSourceCtx returns at most count admissions of source matching tsQuery, or belonging to one of asnIds,
+// within scope.
+func (c *Client) searchFullTextSourceCtx(ctx context.Context, source *fullTextSearchSource, scope *AgencyScope, tsQuery string, asnIds []string, count int) (hits []*models.SearchHit, err error) {
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+
+	// The query is always the first argument, it is used again to rank the hits.
+	q := newAdmissionSearchQuery(source.table)
+	if source.asnCondition != "" {
+		q.where("(pencarian @@ to_tsquery('siasn_jf', %s) or "+source.asnCondition+")", tsQuery, pq.Array(asnIds))
+	} else {
+		q.where("pencarian @@ to_tsquery('siasn_jf', %s)", tsQuery)
+	}
+	q.sortColumn = "rank"
+
+	if !scope.Unrestricted {
+		ownerColumn, ownerIds, err := c.getStatisticOwnersCtx(ctx, source.scope, scope.AgencyIds)
+		if err != nil {
+			return nil, err
+		}
+		if source.scope.positionColumn != "" && len(scope.PositionIds) > 0 {
+			q.where("("+ownerColumn+" = any(%s) or "+source.scope.positionColumn+" = any(%s))", pq.Array(ownerIds), scope.sqlPositionArg())
+		} else {
+			q.where(ownerColumn+" = any(%s)", pq.Array(ownerIds))
+		}
+	}
+
+	q.args = append(q.args, count)
+	query := fmt.Sprintf("%s limit $%d", q.query(source.columns+", ts_rank(pencarian, to_tsquery('siasn_jf', $1)) as rank"), len(q.args))
+
+	rows, err := mdb.QueryContext(ctx, query, q.args...)
+	if err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+	defer rows.Close()
+
+	hits = make([]*models.SearchHit, 0)
+	for rows.Next() {
+		hit := &models.SearchHit{Type: source.hitType}
+		err = rows.Scan(&hit.Id, &hit.AdmissionNumber, &hit.Status, &hit.AdmissionDate, &hit.Title, &hit.AgencyId, &hit.AsnId, &hit.Rank)
+		if err != nil {
+			return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+		}
+		hits = append(hits, hit)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+
+	return hits, nil
+}
+
+// containsFullTextSearchSource returns true if source is one of sources.
+func containsFullTextSearchSource(sources []*fullTextSearchSource, source *fullTextSearchSource) bool {
+	for _, s := range sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+// searchAsnIdsByNameCtx returns the IDs of at most maxAsnSearchMatches ASNs whose name matches tsQuery. Names are not
+// stemmed, the simple text search configuration is used.
+func (c *Client) searchAsnIdsByNameCtx(ctx context.Context, tsQuery string) (asnIds []string, err error) {
+	profileMdb := metricutil.NewDB(c.ProfileDb, c.SqlMetrics)
+
+	rows, err := profileMdb.QueryContext(ctx, "select id from orang where to_tsvector('simple', nama) @@ to_tsquery('simple', $1) limit $2", tsQuery, maxAsnSearchMatches)
+	if err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+	defer rows.Close()
+
+	asnIds = make([]string, 0)
+	for rows.Next() {
+		var asnId string
+		err = rows.Scan(&asnId)
+		if err != nil {
+			return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+		}
+		asnIds = append(asnIds, asnId)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+
+	return asnIds, nil
+}
+
+// fullTextSearchQuery converts the text of a search into a tsquery, where every word must match as a whole word or as
+// the start of a word, e.g. "Pranata Komp" becomes "pranata:* & komp:*". Only letters and digits are kept, so the
+// tsquery cannot contain operators. It returns an empty string if the text does not contain any word to search.
+func fullTextSearchQuery(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, 0, maxSearchTerms)
+	seen := make(map[string]struct{})
+	for _, word := range words {
+		if utf8.RuneCountInString(word) < minSearchTermLength {
+			continue
+		}
+		if _, ok := seen[word]; ok {
+			continue
+		}
+		seen[word] = struct{}{}
+		terms = append(terms, word+":*")
+		if len(terms) == maxSearchTerms {
+			break
+		}
+	}
+
+	return strings.Join(terms, " & ")
+}
@@ -0,0 +1,272 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/metricutil"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/search"
+	"github.com/lib/pq"
+)
+
+// The fields an admission search can be sorted by, see AdmissionSearchOptions.Sort.
+const (
+	AdmissionSortDate   = "tgl_usulan"
+	AdmissionSortStatus = "status"
+	AdmissionSortNumber = "no_usulan"
+)
+
+// The paginations of a paginated admission search, see AdmissionSearchOptions.Pagination.
+const (
+	PaginationOffset = "offset"
+	PaginationCursor = "cursor"
+)
+
+// maxAsnSearchMatches is the maximum number of ASNs matched by AdmissionSearchOptions.Asn. A name too short to tell the
+// ASNs apart would otherwise match most of them.
+const maxAsnSearchMatches = 1000
+
+// admissionSearchTable describes the admission table of a module searched with AdmissionSearchOptions. Every table has
+// a status and a no_usulan column. An empty position or ASN column means the admissions do not have one, the option is
+// then ignored.
+type admissionSearchTable struct {
+	name           string
+	idColumn       string
+	dateColumn     string
+	positionColumn string
+	asnColumn      string
+}
+
+// admissionSearchQuery builds the select query of an admission search from its conditions. Placeholders are numbered
+// in the order the conditions are added.
+type admissionSearchQuery struct {
+	table      *admissionSearchTable
+	conditions []string
+	args       []interface{}
+
+	// sort is the normalized AdmissionSearchOptions.Sort, sortColumn and descending are the sort order it stands for.
+	sort       string
+	sortColumn string
+	descending bool
+
+	// paginateCursor is set when the query is paginated with cursors, cursors are then the cursors of the rows scanned
+	// so far.
+	paginateCursor bool
+	cursors        []*search.Cursor
+}
+
+// newAdmissionSearchQuery creates a query with no conditions, sorted with the newest admissions first.
+func newAdmissionSearchQuery(table *admissionSearchTable) *admissionSearchQuery {
+	return &admissionSearchQuery{
+		table:      table,
+		sort:       "-" + AdmissionSortDate,
+		sortColumn: table.dateColumn,
+		descending: true,
+	}
+}
+
+// where adds a condition to the query. Every %s in condition is replaced by the placeholder of the next value.
+func (q *admissionSearchQuery) where(condition string, values ...interface{}) {
+	placeholders := make([]interface{}, len(values))
+	for i, value := range values {
+		q.args = append(q.args, value)
+		placeholders[i] = "$" + strconv.Itoa(len(q.args))
+	}
+	q.conditions = append(q.conditions, fmt.Sprintf(condition, placeholders...))
+}
+
+// query returns the query selecting columns of every admission matching the conditions.
+func (q *admissionSearchQuery) query(columns string) string {
+	queryBuilder := strings.Builder{}
+	queryBuilder.WriteString("select ")
+	queryBuilder.WriteString(columns)
+	queryBuilder.WriteString(" from ")
+	queryBuilder.WriteString(q.table.name)
+	if len(q.conditions) > 0 {
+		queryBuilder.WriteString(" where ")
+		queryBuilder.WriteString(strings.Join(q.conditions, " and "))
+	}
+	direction := "asc"
+	if q.descending {
+		direction = "desc"
+	}
+	queryBuilder.WriteString(fmt.Sprintf(" order by %s %s, %s %s", q.sortColumn, direction, q.table.idColumn, direction))
+	return queryBuilder.String()
+}
+
+// paginatedQuery is like query, but selects a page of countPerPage admissions and one more to tell whether there is a
+// next page. The page is either the page number pageNumber, or the page after options.Cursor when paginating with
+// cursors, see AdmissionSearchOptions.Pagination. The limit, the offset and the cursor are added to the arguments.
+// It returns errnum.ErrPaginationInvalid or errnum.ErrCursorInvalid if the pagination options are invalid.
+func (q *admissionSearchQuery) paginatedQuery(columns string, options *AdmissionSearchOptions, pageNumber, countPerPage int) (query string, err error) {
+	switch options.Pagination {
+	case "", PaginationOffset:
+		q.paginateCursor = options.Cursor != ""
+	case PaginationCursor:
+		q.paginateCursor = true
+	default:
+		return "", ErrPaginationInvalid
+	}
+
+	if !q.paginateCursor {
+		q.args = append(q.args, countPerPage+1, (pageNumber-1)*countPerPage)
+		return fmt.Sprintf("%s limit $%d offset $%d", q.query(columns), len(q.args)-1, len(q.args)), nil
+	}
+
+	if options.Cursor != "" {
+		cursor, err := search.DecodeCursor(options.Cursor)
+		if err != nil || cursor.Sort != q.sort {
+			return "", ErrCursorInvalid
+		}
+
+		// Rows are compared with their sort key first, then with their ID. Postgres sorts null keys first in descending
+		// order and last in ascending order.
+		column, id := q.sortColumn, q.table.idColumn
+		switch {
+		case q.descending && cursor.Key != nil:
+			q.where(fmt.Sprintf("(%s, %s) < (%%s, %%s)", column, id), *cursor.Key, cursor.Id)
+		case q.descending:
+			q.where(fmt.Sprintf("(%s is null and %s < %%s or %s is not null)", column, id, column), cursor.Id)
+		case cursor.Key != nil:
+			q.where(fmt.Sprintf("((%s, %s) > (%%s, %%s) or %s is null)", column, id, column), *cursor.Key, cursor.Id)
+		default:
+			q.where(fmt.Sprintf("%s is null and %s > %%s", column, id), cursor.Id)
+		}
+	}
+
+	// The sort key and the ID of each row are selected last to create the next cursor, see scan.
+	q.args = append(q.args, countPerPage+1)
+	return fmt.Sprintf("%s limit $%d", q.query(fmt.Sprintf("%s, %s::text, %s::text", columns, q.sortColumn, q.table.idColumn)), len(q.args)), nil
+}
+
+// scan scans a row of the query into dest. When paginating with cursors, it also scans the cursor of the row.
+func (q *admissionSearchQuery) scan(rows *sql.Rows, dest ...interface{}) (err error) {
+	if !q.paginateCursor {
+		return rows.Scan(dest...)
+	}
+
+	cursor := &search.Cursor{Sort: q.sort}
+	key := sql.NullString{}
+	err = rows.Scan(append(dest, &key, &cursor.Id)...)
+	if err != nil {
+		return err
+	}
+
+	if key.Valid {
+		cursor.Key = &key.String
+	}
+	q.cursors = append(q.cursors, cursor)
+	return nil
+}
+
+// metadata creates the metadata of a page of resultLength admissions, the next cursor is the cursor of its last row.
+func (q *admissionSearchQuery) metadata(pageNumber, resultLength int, hasNext bool) *search.PaginatedListMetadata {
+	if !q.paginateCursor {
+		return search.CreatePaginatedListMetadataNoTotalNext(pageNumber, resultLength, hasNext)
+	}
+
+	nextCursor := ""
+	if hasNext && resultLength > 0 {
+		nextCursor = search.EncodeCursor(q.cursors[resultLength-1])
+	}
+	return search.CreateCursorListMetadata(resultLength, nextCursor)
+}
+
+// applyAdmissionSearchOptionsCtx adds the conditions and the sort order of options to q.
+// It returns errnum.ErrFilterDateRangeInvalid if the date range is reversed, and errnum.ErrFilterSortInvalid if the sort
+// order is not supported. The ASNs matching options.Asn are searched in the profile database.
+func (c *Client) applyAdmissionSearchOptionsCtx(ctx context.Context, q *admissionSearchQuery, options *AdmissionSearchOptions) (err error) {
+	// Both dates are YYYY-MM-DD, they can be compared as strings.
+	if options.AdmissionDateFrom != "" && options.AdmissionDateTo != "" && options.AdmissionDateFrom > options.AdmissionDateTo {
+		return ErrFilterDateRangeInvalid
+	}
+
+	if options.Sort != "" {
+		field := strings.TrimPrefix(options.Sort, "-")
+		switch field {
+		case AdmissionSortDate:
+			q.sortColumn = q.table.dateColumn
+		case AdmissionSortStatus:
+			q.sortColumn = "status"
+		case AdmissionSortNumber:
+			q.sortColumn = "no_usulan"
+		default:
+			return ErrFilterSortInvalid
+		}
+		q.sort = options.Sort
+		q.descending = field != options.Sort
+	}
+
+	if options.AdmissionDateFrom != "" {
+		q.where(q.table.dateColumn+"::date >= %s::date", string(options.AdmissionDateFrom))
+	}
+
+	if options.AdmissionDateTo != "" {
+		q.where(q.table.dateColumn+"::date <= %s::date", string(options.AdmissionDateTo))
+	}
+
+	if len(options.AdmissionStatuses) > 0 {
+		q.where("status = any(%s)", pq.Array(options.AdmissionStatuses))
+	}
+
+	if options.AdmissionNumber != "" {
+		q.where("no_usulan ilike %s", containsPattern(options.AdmissionNumber))
+	}
+
+	if options.PositionId != "" && q.table.positionColumn != "" {
+		q.where(q.table.positionColumn+" = %s", options.PositionId)
+	}
+
+	if options.Asn != "" && q.table.asnColumn != "" {
+		asnIds, err := c.searchAsnIdsCtx(ctx, options.Asn)
+		if err != nil {
+			return err
+		}
+		q.where(q.table.asnColumn+" = any(%s)", pq.Array(asnIds))
+	}
+
+	return nil
+}
+
+// searchAsnIdsCtx returns the IDs of at most maxAsnSearchMatches ASNs (PNS and PPPK) whose NIP is asn, or whose name
+// contains asn, case-insensitive.
+func (c *Client) searchAsnIdsCtx(ctx context.Context, asn string) (asnIds []string, err error) {
+	profileMdb := metricutil.NewDB(c.ProfileDb, c.SqlMetrics)
+
+	rows, err := profileMdb.QueryContext(
+		ctx,
+		"select t.id from orang join (select id, nip_baru from pns union all select id, nip_baru from pppk) t on orang.id = t.id where t.nip_baru = $1 or orang.nama ilike $2 limit $3",
+		asn,
+		containsPattern(asn),
+		maxAsnSearchMatches,
+	)
+	if err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+	defer rows.Close()
+
+	asnIds = make([]string, 0)
+	for rows.Next() {
+		var asnId string
+		err = rows.Scan(&asnId)
+		if err != nil {
+			return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+		}
+		asnIds = append(asnIds, asnId)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+
+	return asnIds, nil
+}
+
+// containsPattern returns a like pattern matching the values containing s. The wildcards in s are escaped.
+func containsPattern(s string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s) + "%"
+}
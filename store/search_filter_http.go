@@ -0,0 +1,59 @@
+package store
+
+import (
+	"net/http"
+
+	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+)
+
+// decodeAdmissionSearchOptions decodes the AdmissionSearchOptions of a search request from its query parameters and
+// validates them. statuses are the statuses of the admissions of the module, statusErrCode and dateErrCode are the
+// error codes of the module returned for an invalid status or date. Like decodeRequestSchema, it writes the error
+// response itself if the options are invalid.
+func (c *Client) decodeAdmissionSearchOptions(writer http.ResponseWriter, request *http.Request, statuses map[int]struct{}, statusErrCode, dateErrCode int) (options *AdmissionSearchOptions, err error) {
+	options = &AdmissionSearchOptions{}
+	err = c.decodeRequestSchema(writer, request, options)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.httpErrorVerifyAdmissionSearchOptions(writer, options, statuses, statusErrCode, dateErrCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return options, nil
+}
+
+// httpErrorVerifyAdmissionSearchOptions verifies the statuses and the dates of options already decoded, and normalizes
+// the dates. It writes the error response if the options are invalid, see decodeAdmissionSearchOptions.
+func (c *Client) httpErrorVerifyAdmissionSearchOptions(writer http.ResponseWriter, options *AdmissionSearchOptions, statuses map[int]struct{}, statusErrCode, dateErrCode int) (err error) {
+	for _, status := range options.AdmissionStatuses {
+		if _, ok := statuses[status]; !ok {
+			err = ec.NewErrorBasic(statusErrCode, Errs[statusErrCode])
+			c.httpError(writer, err)
+			return err
+		}
+	}
+
+	for _, date := range []*models.Iso8601Date{&options.AdmissionDateFrom, &options.AdmissionDateTo} {
+		if *date == "" {
+			continue
+		}
+
+		*date, err = models.ParseIso8601Date(string(*date))
+		if err != nil {
+			c.httpError(writer, ec.NewError(dateErrCode, Errs[dateErrCode], err))
+			return err
+		}
+	}
+
+	if options.AdmissionDateFrom != "" && options.AdmissionDateTo != "" && options.AdmissionDateFrom > options.AdmissionDateTo {
+		c.httpError(writer, ErrFilterDateRangeInvalid)
+		return ErrFilterDateRangeInvalid
+	}
+
+	return nil
+}
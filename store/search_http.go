@@ -0,0 +1,51 @@
+package store
+
+import (
+	"context"
+	"net/http"
+
+	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/httputil"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+)
+
+const (
+	TimeoutSearch = TimeoutDefault
+)
+
+// HandleSearch handles a full-text search of the admissions of every module, within the agency scope of the user.
+// Admissions are found by their own text (e.g. the name of an activity or an admission number), or by the name of
+// their ASN or attendees. See SearchCtx.
+func (c *Client) HandleSearch(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), TimeoutSearch)
+	defer cancel()
+
+	s := &models.SearchRequest{}
+	err := c.decodeRequestSchema(writer, request, s)
+	if err != nil {
+		return
+	}
+
+	if s.Count < 0 || s.Count > 100 {
+		c.httpError(writer, ErrListCountPerPage)
+		return
+	}
+
+	scope, err := c.reqGetAgencyScopeCtx(ctx, request)
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	hits, err := c.SearchCtx(ctx, scope, &FullTextSearch{
+		Query: s.Query,
+		Types: s.Types,
+		Count: s.Count,
+	})
+	if err != nil {
+		c.httpError(writer, err)
+		return
+	}
+
+	_ = httputil.WriteObj200(writer, hits)
+}
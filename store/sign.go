@@ -0,0 +1,76 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/store/esign"
+	"github.com/fazrithe/siasn-jf-backend-git/store/object"
+)
+
+// TimeoutSign is the timeout of requests that sign a document. It is longer than TimeoutDefault because the signing
+// service is slow, and it is also the timeout of a single request to the signing service.
+const TimeoutSign = 30 * time.Second
+
+// signPdfCtx retrieves a PDF document with getFunc, signs it as identity with the client Signer and stores the signed
+// document with putFunc as dest. src and dest can be the same file, in which case the unsigned document is replaced.
+func (c *Client) signPdfCtx(
+	ctx context.Context,
+	identity *esign.Identity,
+	src string,
+	dest string,
+	getFunc func(ctx context.Context, filename string) (out io.ReadCloser, err error),
+	putFunc func(ctx context.Context, filename string, contentType string, in io.ReadSeeker) (err error),
+) (err error) {
+	document, err := getFunc(ctx, src)
+	if err != nil {
+		if errors.Is(err, object.ErrFileNotFound) {
+			return ec.NewError(ErrCodeStorageFileNotFound, Errs[ErrCodeStorageFileNotFound], err)
+		}
+		return ec.NewError(ErrCodeDocumentSign, Errs[ErrCodeDocumentSign], err)
+	}
+	defer document.Close()
+
+	return c.signAndPutPdfCtx(ctx, identity, document, dest, putFunc)
+}
+
+// signAndPutPdfCtx signs a PDF document read from document as identity with the client Signer and stores the signed
+// document with putFunc as dest. Nothing is stored if signing fails.
+func (c *Client) signAndPutPdfCtx(
+	ctx context.Context,
+	identity *esign.Identity,
+	document io.Reader,
+	dest string,
+	putFunc func(ctx context.Context, filename string, contentType string, in io.ReadSeeker) (err error),
+) (err error) {
+	if c.Signer == nil {
+		return ec.NewError(ErrCodeDocumentSign, Errs[ErrCodeDocumentSign], errors.New("no signer is configured"))
+	}
+
+	signed, err := c.Signer.SignPdfCtx(ctx, identity, document)
+	if err != nil {
+		return ec.NewError(ErrCodeDocumentSign, Errs[ErrCodeDocumentSign], err)
+	}
+
+	err = putFunc(ctx, dest, "application/pdf", bytes.NewReader(signed))
+	if err != nil {
+		return ec.NewError(ErrCodeStoragePutFail, Errs[ErrCodeStoragePutFail], err)
+	}
+
+	return nil
+}
+
+// bufferPutFunc returns a put function that keeps the document in buffer instead of storing it, so that a generated
+// document can be signed before anything is stored.
+func bufferPutFunc(buffer *bytes.Buffer) func(ctx context.Context, filename string, contentType string, in io.ReadSeeker) (err error) {
+	return func(_ context.Context, _ string, _ string, in io.ReadSeeker) (err error) {
+		buffer.Reset()
+		_, err = io.Copy(buffer, in)
+		return err
+	}
+}
@@ -0,0 +1,341 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/metricutil"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+	"github.com/lib/pq"
+)
+
+// Periods a status statistic time series can be grouped by.
+const (
+	StatisticGroupMonth   = "month"
+	StatisticGroupQuarter = "quarter"
+	StatisticGroupYear    = "year"
+)
+
+// StatisticGroups lists the valid values of StatisticFilter.GroupBy.
+var StatisticGroups = map[string]struct{}{
+	StatisticGroupMonth:   {},
+	StatisticGroupQuarter: {},
+	StatisticGroupYear:    {},
+}
+
+// MaxStatisticPeriods is the maximum number of periods of a time series between StatisticFilter.StartDate and
+// StatisticFilter.EndDate.
+const MaxStatisticPeriods = 240
+
+// StatisticFilter represents the filters that can be applied when counting entries for status statistics.
+// Every filter is optional.
+type StatisticFilter struct {
+	// AgencyId limits the statistic to the entries of a work agency (instansi kerja).
+	AgencyId string
+
+	// PositionId limits the statistic to the entries of a functional position (jabatan fungsional). Ignored for
+	// entries that do not record a functional position, such as dismissals.
+	PositionId string
+
+	// StartDate limits the statistic to the entries admitted on or after this date.
+	StartDate models.Iso8601Date
+
+	// EndDate limits the statistic to the entries admitted on or before this date.
+	EndDate models.Iso8601Date
+
+	// GroupBy is the period of a time series, one of StatisticGroups. Defaults to StatisticGroupMonth.
+	// Ignored if the statistic is not a time series.
+	GroupBy string
+}
+
+// statisticSource describes the table a status statistic is counted from.
+type statisticSource struct {
+	// table is the name of the table of the entries.
+	table string
+	// statuses are the valid statuses of the entries, each of them is included in the statistic.
+	statuses map[int]struct{}
+	// dateColumn is the admission date of the entries, used for the date range and the periods.
+	dateColumn string
+	// agencyColumn is the agency of the entries. If it is empty, the entries do not store their agency, and
+	// asnColumn is matched against the ASNs of the agencies instead.
+	agencyColumn string
+	// asnColumn is the ASN of the entries, only used if agencyColumn is empty.
+	asnColumn string
+	// positionColumn is the functional position of the entries, empty if the entries do not record one.
+	positionColumn string
+}
+
+// getStatusStatisticCtx counts the entries of source for each status, limited to scope and filter.
+// If series is false, it returns a single period containing every entry, with an empty name. Otherwise, it returns
+// every period of filter.GroupBy between the start and the end date of filter, or between the first and the last
+// entries if the dates are not set.
+func (c *Client) getStatusStatisticCtx(ctx context.Context, source *statisticSource, scope *AgencyScope, filter *StatisticFilter, series bool) (periods []*models.StatisticPeriod, err error) {
+	var startDate, endDate time.Time
+	if filter.StartDate != "" {
+		startDate, err = time.ParseInLocation("2006-01-02", string(filter.StartDate), time.UTC)
+		if err != nil {
+			return nil, ec.NewError(ErrCodeFilterInvalidDate, Errs[ErrCodeFilterInvalidDate], err)
+		}
+	}
+	if filter.EndDate != "" {
+		endDate, err = time.ParseInLocation("2006-01-02", string(filter.EndDate), time.UTC)
+		if err != nil {
+			return nil, ec.NewError(ErrCodeFilterInvalidDate, Errs[ErrCodeFilterInvalidDate], err)
+		}
+	}
+	if !startDate.IsZero() && !endDate.IsZero() && startDate.After(endDate) {
+		return nil, ErrStatisticDateRangeInvalid
+	}
+	groupBy := ""
+	if series {
+		groupBy = filter.GroupBy
+		if groupBy == "" {
+			groupBy = StatisticGroupMonth
+		}
+		if _, ok := StatisticGroups[groupBy]; !ok {
+			return nil, ErrStatisticGroupInvalid
+		}
+		if !startDate.IsZero() && !endDate.IsZero() {
+			_, err = listStatisticPeriods(startDate, endDate, groupBy)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var conditions []string
+	var queryArgs []interface{}
+	arg := func(value interface{}) string {
+		queryArgs = append(queryArgs, value)
+		return "$" + strconv.Itoa(len(queryArgs))
+	}
+
+	if !scope.Unrestricted {
+		ownerColumn, ownerIds, err := c.getStatisticOwnersCtx(ctx, source, scope.AgencyIds)
+		if err != nil {
+			return nil, err
+		}
+		condition := fmt.Sprintf("%s = any(%s)", ownerColumn, arg(pq.Array(ownerIds)))
+		if source.positionColumn != "" && len(scope.PositionIds) > 0 {
+			condition += fmt.Sprintf(" or %s = any(%s)", source.positionColumn, arg(scope.sqlPositionArg()))
+		}
+		conditions = append(conditions, "("+condition+")")
+	}
+
+	if filter.AgencyId != "" {
+		ownerColumn, ownerIds, err := c.getStatisticOwnersCtx(ctx, source, []string{filter.AgencyId})
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, fmt.Sprintf("%s = any(%s)", ownerColumn, arg(pq.Array(ownerIds))))
+	}
+
+	if filter.PositionId != "" && source.positionColumn != "" {
+		conditions = append(conditions, fmt.Sprintf("%s = %s", source.positionColumn, arg(filter.PositionId)))
+	}
+
+	if filter.StartDate != "" {
+		conditions = append(conditions, fmt.Sprintf("%s::date >= %s::date", source.dateColumn, arg(string(filter.StartDate))))
+	}
+
+	if filter.EndDate != "" {
+		conditions = append(conditions, fmt.Sprintf("%s::date <= %s::date", source.dateColumn, arg(string(filter.EndDate))))
+	}
+
+	periodColumn := "null::date"
+	if groupBy != "" {
+		periodColumn = fmt.Sprintf("date_trunc('%s', %s)::date", groupBy, source.dateColumn)
+	}
+
+	queryBuilder := strings.Builder{}
+	queryBuilder.WriteString("select ")
+	queryBuilder.WriteString(periodColumn)
+	queryBuilder.WriteString(", status, count(*) from ")
+	queryBuilder.WriteString(source.table)
+	if len(conditions) > 0 {
+		queryBuilder.WriteString(" where ")
+		queryBuilder.WriteString(strings.Join(conditions, " and "))
+	}
+	queryBuilder.WriteString(" group by 1, 2")
+
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+	rows, err := mdb.QueryContext(ctx, queryBuilder.String(), queryArgs...)
+	if err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+	defer rows.Close()
+
+	counts := make(map[time.Time]map[int]int)
+	var first, last time.Time
+	for rows.Next() {
+		var periodStart *time.Time
+		var status, count int
+		err = rows.Scan(&periodStart, &status, &count)
+		if err != nil {
+			return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+		}
+
+		period := time.Time{}
+		if periodStart != nil && groupBy != "" {
+			period = truncateStatisticPeriod(*periodStart, groupBy)
+			if first.IsZero() || period.Before(first) {
+				first = period
+			}
+			if last.IsZero() || period.After(last) {
+				last = period
+			}
+		}
+		if counts[period] == nil {
+			counts[period] = make(map[int]int)
+		}
+		counts[period][status] += count
+	}
+	if err = rows.Err(); err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+
+	if groupBy == "" {
+		return []*models.StatisticPeriod{newStatisticPeriod(source, "", "", counts[time.Time{}])}, nil
+	}
+
+	if !startDate.IsZero() {
+		first = truncateStatisticPeriod(startDate, groupBy)
+	}
+	if !endDate.IsZero() {
+		last = truncateStatisticPeriod(endDate, groupBy)
+	}
+
+	periods = make([]*models.StatisticPeriod, 0)
+	if first.IsZero() || last.IsZero() {
+		return periods, nil
+	}
+	periodStarts, err := listStatisticPeriods(first, last, groupBy)
+	if err != nil {
+		return nil, err
+	}
+	for _, period := range periodStarts {
+		periods = append(periods, newStatisticPeriod(source, statisticPeriodName(period, groupBy), models.Iso8601Date(period.Format("2006-01-02")), counts[period]))
+	}
+
+	return periods, nil
+}
+
+// getStatisticOwnersCtx returns the column and the values matching the entries of agencyIds. It is the agency
+// column of source and agencyIds themselves if the entries store their agency, or the ASN column of source and the
+// ASNs whose work agency is one of agencyIds otherwise.
+func (c *Client) getStatisticOwnersCtx(ctx context.Context, source *statisticSource, agencyIds []string) (column string, ownerIds []string, err error) {
+	if source.agencyColumn != "" {
+		return source.agencyColumn, agencyIds, nil
+	}
+
+	ownerIds, err = c.getAgencyAsnIdsCtx(ctx, agencyIds)
+	if err != nil {
+		return "", nil, err
+	}
+	return source.asnColumn, ownerIds, nil
+}
+
+// getAgencyAsnIdsCtx returns the IDs of the ASNs whose work agency is one of agencyIds.
+func (c *Client) getAgencyAsnIdsCtx(ctx context.Context, agencyIds []string) (asnIds []string, err error) {
+	asnIds = make([]string, 0)
+	if len(agencyIds) == 0 {
+		return asnIds, nil
+	}
+
+	profileMdb := metricutil.NewDB(c.ProfileDb, c.SqlMetrics)
+	rows, err := profileMdb.QueryContext(ctx, "select id from pns where instansi_kerja_id = any($1) union all select id from pppk where instansi_kerja_id = any($1)", pq.Array(agencyIds))
+	if err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		asnId := ""
+		err = rows.Scan(&asnId)
+		if err != nil {
+			return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+		}
+		asnIds = append(asnIds, asnId)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+
+	return asnIds, nil
+}
+
+// newStatisticPeriod creates a period containing every status of source, counts maps statuses to their number of
+// entries. Unknown statuses are left out.
+func newStatisticPeriod(source *statisticSource, name string, startDate models.Iso8601Date, counts map[int]int) *models.StatisticPeriod {
+	statuses := make([]int, 0, len(source.statuses))
+	for status := range source.statuses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+
+	period := &models.StatisticPeriod{
+		Period:    name,
+		StartDate: startDate,
+		Statuses:  make([]*models.StatisticStatus, 0, len(statuses)),
+	}
+	for _, status := range statuses {
+		period.Statuses = append(period.Statuses, &models.StatisticStatus{Status: status, Count: counts[status]})
+	}
+	return period
+}
+
+// truncateStatisticPeriod returns the first day of the period of t.
+func truncateStatisticPeriod(t time.Time, groupBy string) time.Time {
+	switch groupBy {
+	case StatisticGroupQuarter:
+		return time.Date(t.Year(), (t.Month()-1)/3*3+1, 1, 0, 0, 0, 0, time.UTC)
+	case StatisticGroupYear:
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// listStatisticPeriods returns the first day of every period from the period of first to the period of last. It
+// returns errnum.ErrStatisticDateRangeInvalid if there are more than MaxStatisticPeriods periods.
+func listStatisticPeriods(first, last time.Time, groupBy string) (periods []time.Time, err error) {
+	periods = make([]time.Time, 0)
+	last = truncateStatisticPeriod(last, groupBy)
+	for period := truncateStatisticPeriod(first, groupBy); !period.After(last); period = nextStatisticPeriod(period, groupBy) {
+		if len(periods) >= MaxStatisticPeriods {
+			return nil, ec.NewError(ErrCodeStatisticDateRangeInvalid, Errs[ErrCodeStatisticDateRangeInvalid], fmt.Errorf("time series cannot contain more than %d periods", MaxStatisticPeriods))
+		}
+		periods = append(periods, period)
+	}
+	return periods, nil
+}
+
+// nextStatisticPeriod returns the first day of the period after the one starting at t.
+func nextStatisticPeriod(t time.Time, groupBy string) time.Time {
+	switch groupBy {
+	case StatisticGroupQuarter:
+		return t.AddDate(0, 3, 0)
+	case StatisticGroupYear:
+		return t.AddDate(1, 0, 0)
+	default:
+		return t.AddDate(0, 1, 0)
+	}
+}
+
+// statisticPeriodName returns the name of the period starting at t, e.g. 2024-01, 2024-Q1 or 2024.
+func statisticPeriodName(t time.Time, groupBy string) string {
+	switch groupBy {
+	case StatisticGroupQuarter:
+		return fmt.Sprintf("%d-Q%d", t.Year(), (t.Month()-1)/3+1)
+	case StatisticGroupYear:
+		return t.Format("2006")
+	default:
+		return t.Format("2006-01")
+	}
+}
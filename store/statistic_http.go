@@ -0,0 +1,52 @@
+package store
+
+import (
+	"net/http"
+
+	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+)
+
+// decodeStatisticFilter decodes the filter of a status statistic request from its query parameters. Like
+// decodeRequestSchema, it writes the error response itself if the filter cannot be decoded.
+func (c *Client) decodeStatisticFilter(writer http.ResponseWriter, request *http.Request) (filter *StatisticFilter, err error) {
+	type schemaStatisticFilter struct {
+		AgencyId   string `schema:"instansi_id"`
+		PositionId string `schema:"jabatan_fungsional_id"`
+		// StartDate and EndDate are dates with a format of YYYY-MM-DD (e.g. 2006-12-31).
+		StartDate string `schema:"tgl_awal"`
+		EndDate   string `schema:"tgl_akhir"`
+		GroupBy   string `schema:"group_by"`
+	}
+
+	query := &schemaStatisticFilter{}
+	err = c.decodeRequestSchema(writer, request, query)
+	if err != nil {
+		return nil, err
+	}
+
+	filter = &StatisticFilter{
+		AgencyId:   query.AgencyId,
+		PositionId: query.PositionId,
+		GroupBy:    query.GroupBy,
+	}
+
+	if query.StartDate != "" {
+		filter.StartDate, err = models.ParseIso8601Date(query.StartDate)
+		if err != nil {
+			c.httpError(writer, ec.NewError(ErrCodeFilterInvalidDate, Errs[ErrCodeFilterInvalidDate], err))
+			return nil, err
+		}
+	}
+
+	if query.EndDate != "" {
+		filter.EndDate, err = models.ParseIso8601Date(query.EndDate)
+		if err != nil {
+			c.httpError(writer, ec.NewError(ErrCodeFilterInvalidDate, Errs[ErrCodeFilterInvalidDate], err))
+			return nil, err
+		}
+	}
+
+	return filter, nil
+}
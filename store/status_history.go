@@ -0,0 +1,238 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/metricutil"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+)
+
+// Modules of status_hist entries.
+const (
+	StatusHistoryModuleActivity       = "activity"
+	StatusHistoryModuleRequirement    = "requirement"
+	StatusHistoryModuleDismissal      = "dismissal"
+	StatusHistoryModulePromotion      = "promotion"
+	StatusHistoryModulePromotionCpns  = "promotion-cpns"
+	StatusHistoryModuleAssessmentTeam = "assessment-team"
+)
+
+type requestMetadataKey struct{}
+
+// requestMetadata is the metadata of the HTTP request that changes a status, recorded in status history.
+type requestMetadata struct {
+	IpAddress string
+	UserAgent string
+	// ImpersonatorId is the ASN ID of the user impersonating the user of the request, see auth.Impersonation.
+	ImpersonatorId string
+}
+
+// withRequestMetadata returns a copy of ctx carrying the client IP address, user agent and impersonator of request.
+// Handlers that change a status must call it so that insertStatusHistoryCtx can record them.
+func (c *Client) withRequestMetadata(ctx context.Context, request *http.Request) context.Context {
+	metadata := &requestMetadata{
+		IpAddress: c.ClientIpAddress(request),
+		UserAgent: request.UserAgent(),
+	}
+	if user := auth.ReqGetUserDetail(request); user != nil && user.Impersonator != nil {
+		metadata.ImpersonatorId = user.Impersonator.AsnId
+	}
+	return context.WithValue(ctx, requestMetadataKey{}, metadata)
+}
+
+// ClientIpAddress returns the IP address of the client of request, which is the address of the connection.
+// X-Forwarded-For is only honored if the connection comes from one of c.TrustedProxies: it is then followed from the
+// nearest hop back to the first address that is not a trusted proxy.
+func (c *Client) ClientIpAddress(request *http.Request) string {
+	ipAddress := request.RemoteAddr
+	if host, _, err := net.SplitHostPort(request.RemoteAddr); err == nil {
+		ipAddress = host
+	}
+
+	if !c.isTrustedProxy(ipAddress) {
+		return ipAddress
+	}
+
+	hops := make([]string, 0)
+	for _, header := range request.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		if net.ParseIP(hops[i]) == nil {
+			break
+		}
+
+		ipAddress = hops[i]
+		if !c.isTrustedProxy(ipAddress) {
+			break
+		}
+	}
+
+	return ipAddress
+}
+
+// isTrustedProxy checks whether ipAddress is in one of c.TrustedProxies.
+func (c *Client) isTrustedProxy(ipAddress string) bool {
+	ip := net.ParseIP(ipAddress)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range c.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseTrustedProxies parses the networks of trusted proxies, each either an IP address or a CIDR, e.g. 10.0.0.1 or
+// 10.0.0.0/8.
+func ParseTrustedProxies(values []string) (networks []*net.IPNet, err error) {
+	networks = make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %s", value)
+			}
+
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %s: %w", value, err)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+// insertStatusHistoryCtx appends a status change of an admission to status_hist. oldStatus is 0 if the admission
+// has just been created. IP address, user agent and impersonator are taken from ctx if it was created with
+// withRequestMetadata.
+// This method already returns an error in form of error code.
+func (c *Client) insertStatusHistoryCtx(ctx context.Context, dh metricutil.DbHandler, module, entityId string, oldStatus, status int, modifiedBy, reason string) (modifiedAt time.Time, err error) {
+	metadata, ok := ctx.Value(requestMetadataKey{}).(*requestMetadata)
+	if !ok {
+		metadata = &requestMetadata{}
+	}
+
+	modifiedAt = time.Now()
+	_, err = dh.ExecContext(
+		ctx,
+		"insert into status_hist(modul, entitas_id, status_lama, status, alasan, user_id, ip_address, user_agent, impersonator_id, modified_at_ts) values($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)",
+		module,
+		entityId,
+		sql.NullInt64{Valid: oldStatus != 0, Int64: int64(oldStatus)},
+		status,
+		sql.NullString{Valid: reason != "", String: reason},
+		modifiedBy,
+		sql.NullString{Valid: metadata.IpAddress != "", String: metadata.IpAddress},
+		sql.NullString{Valid: metadata.UserAgent != "", String: metadata.UserAgent},
+		sql.NullString{Valid: metadata.ImpersonatorId != "", String: metadata.ImpersonatorId},
+		modifiedAt,
+	)
+	if err != nil {
+		return time.Time{}, ec.NewError(ErrCodeExecFail, Errs[ErrCodeExecFail], fmt.Errorf("cannot insert entry to status_hist: %w", err))
+	}
+
+	return modifiedAt, nil
+}
+
+// GetStatusHistoryCtx returns the status changes of an admission of a module (see StatusHistoryModuleActivity and
+// others), oldest first. Admissions outside of the agency scope are treated as not found.
+func (c *Client) GetStatusHistoryCtx(ctx context.Context, module, entityId string, scope *AgencyScope) (history []*models.StatusHistory, err error) {
+	_, err = c.getAdmissionStatusCtx(ctx, module, entityId, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+	profileMdb := metricutil.NewDB(c.ProfileDb, c.SqlMetrics)
+
+	rows, err := mdb.QueryContext(
+		ctx,
+		"select coalesce(status_lama, 0), status, coalesce(alasan, ''), user_id, coalesce(ip_address, ''), coalesce(user_agent, ''), coalesce(impersonator_id, ''), modified_at_ts from status_hist where modul = $1 and entitas_id = $2 order by modified_at_ts, status_hist_id",
+		module,
+		entityId,
+	)
+	if err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot query status_hist: %w", err))
+	}
+	defer rows.Close()
+
+	history = make([]*models.StatusHistory, 0)
+	asnIds := make([]string, 0)
+	for rows.Next() {
+		entry := &models.StatusHistory{}
+		err = rows.Scan(
+			&entry.OldStatus,
+			&entry.Status,
+			&entry.Reason,
+			&entry.ModifiedBy,
+			&entry.IpAddress,
+			&entry.UserAgent,
+			&entry.ImpersonatedBy,
+			(*time.Time)(&entry.ModifiedAt),
+		)
+		if err != nil {
+			return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot scan status_hist: %w", err))
+		}
+		history = append(history, entry)
+		asnIds = append(asnIds, entry.ModifiedBy)
+		if entry.ImpersonatedBy != "" {
+			asnIds = append(asnIds, entry.ImpersonatedBy)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], fmt.Errorf("cannot query status_hist: %w", err))
+	}
+
+	if len(history) == 0 {
+		return history, nil
+	}
+
+	asns, err := c.getAsnNipNames(ctx, profileMdb, asnIds)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range history {
+		if asn, ok := asns[entry.ModifiedBy]; ok {
+			entry.ModifiedByNip = asn.Nip
+			entry.ModifiedByName = asn.AsnName
+		}
+		if asn, ok := asns[entry.ImpersonatedBy]; ok {
+			entry.ImpersonatedByNip = asn.Nip
+			entry.ImpersonatedByName = asn.AsnName
+		}
+	}
+
+	return history, nil
+}
@@ -0,0 +1,31 @@
+package store
+
+import (
+	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/validation"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+)
+
+// requestValidator evaluates the validate tags of the requests decoded by decodeRequestJson and decodeRequestSchema.
+// The enums of the enum=name rule are the type maps of the models.
+var requestValidator = newRequestValidator()
+
+func newRequestValidator() *validation.Validator {
+	v := validation.New()
+	v.RegisterEnum("activity_type", models.ActivityTypes)
+	v.RegisterEnum("activity_cert_type", models.ActivityCertTypes)
+	v.RegisterEnum("promotion_type", models.PromotionTypes)
+	return v
+}
+
+// validateRequest validates the tags of obj. If some fields are invalid, it returns an ec.Error with the given code
+// whose data lists every invalid field, see validation.FieldError.
+func validateRequest(obj interface{}, code int) (err error) {
+	fieldErrs := requestValidator.Validate(obj)
+	if len(fieldErrs) == 0 {
+		return nil
+	}
+
+	return &ec.Error{Message: Errs[code], Code: code, Data: fieldErrs}
+}
@@ -0,0 +1,340 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/metricutil"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+	"github.com/fazrithe/siasn-jf-backend-git/store/workflow"
+	"github.com/google/uuid"
+)
+
+// Workflow actions, see the workflow of each module.
+const (
+	WorkflowActionVerify      = "verify"
+	WorkflowActionRequestCert = "request-cert"
+	WorkflowActionPublishCert = "publish-cert"
+	WorkflowActionRevise      = "revise"
+	WorkflowActionRecommend   = "recommend"
+	WorkflowActionAccept      = "accept"
+	WorkflowActionReject      = "reject"
+	WorkflowActionEdit        = "edit"
+	WorkflowActionSignLetter  = "sign-letter"
+)
+
+var rolesWorkflowVerifier = []string{models.RoleVerifier, models.RoleBknAdmin}
+
+var activityWorkflow = &workflow.Workflow{
+	Name: StatusHistoryModuleActivity,
+	States: map[int]string{
+		models.ActivityAdmissionStatusCreated:       "created",
+		models.ActivityAdmissionStatusAccepted:      "accepted",
+		models.ActivityAdmissionStatusCertRequest:   "cert-request",
+		models.ActivityAdmissionStatusCertPublished: "cert-published",
+		models.ActivityAdmissionStatusRejected:      "rejected",
+	},
+	Transitions: []*workflow.Transition{
+		{
+			Action: WorkflowActionVerify,
+			From:   []int{models.ActivityAdmissionStatusCreated},
+			To:     models.ActivityAdmissionStatusAccepted,
+			Roles:  []string{models.RolePembina, models.RoleVerifier, models.RoleBknAdmin},
+			Guard: func(request interface{}) error {
+				if r, ok := request.(*models.ActivityVerificationRequest); ok && len(r.AttendeesAcceptance) <= 0 {
+					return ec.NewErrorBasic(ErrCodeActivityVerificationStatusNoAttendees, Errs[ErrCodeActivityVerificationStatusNoAttendees])
+				}
+				return nil
+			},
+		},
+		{
+			Action: WorkflowActionPublishCert,
+			From:   []int{models.ActivityAdmissionStatusAccepted},
+			To:     models.ActivityAdmissionStatusCertPublished,
+			Roles:  []string{models.RolePembina, models.RoleBknAdmin},
+		},
+		// CSR status is removed, certificates are published directly.
+		{
+			Action:     WorkflowActionRequestCert,
+			From:       []int{models.ActivityAdmissionStatusAccepted},
+			To:         models.ActivityAdmissionStatusCertRequest,
+			Roles:      []string{models.RoleAgencyAdmin, models.RoleBknAdmin},
+			Deprecated: true,
+			Guard: func(request interface{}) error {
+				if r, ok := request.(*models.ActivityCsrRequest); ok && len(r.AttendeesPassing) <= 0 {
+					return ec.NewErrorBasic(ErrCodeActivityVerificationStatusNoAttendees, Errs[ErrCodeActivityVerificationStatusNoAttendees])
+				}
+				return nil
+			},
+		},
+	},
+}
+
+var requirementWorkflow = &workflow.Workflow{
+	Name: StatusHistoryModuleRequirement,
+	States: map[int]string{
+		models.RequirementAdmissionStatusCreated:                    "created",
+		models.RequirementAdmissionStatusSigned:                     "signed",
+		models.RequirementAdmissionStatusRevision:                   "revision",
+		models.RequirementAdmissionStatusAccepted:                   "accepted",
+		models.RequirementAdmissionStatusDenied:                     "denied",
+		models.RequirementAdmissionStatusAcceptedWithRecommendation: "accepted-with-recommendation",
+	},
+	Transitions: []*workflow.Transition{
+		{
+			Action: WorkflowActionVerify,
+			From:   []int{models.RequirementAdmissionStatusCreated, models.RequirementAdmissionStatusRevision},
+			To:     models.RequirementAdmissionStatusAccepted,
+			Roles:  rolesWorkflowVerifier,
+		},
+		{
+			Action: WorkflowActionRevise,
+			From:   []int{models.RequirementAdmissionStatusCreated, models.RequirementAdmissionStatusRevision, models.RequirementAdmissionStatusDenied},
+			To:     models.RequirementAdmissionStatusRevision,
+			Roles:  rolesWorkflowVerifier,
+		},
+		{
+			Action:    WorkflowActionRecommend,
+			From:      []int{models.RequirementAdmissionStatusAccepted},
+			To:        models.RequirementAdmissionStatusAcceptedWithRecommendation,
+			Roles:     rolesWorkflowVerifier,
+			Documents: []string{"surat_rekomendasi"},
+		},
+		{
+			Action: WorkflowActionEdit,
+			From:   []int{models.RequirementAdmissionStatusCreated, models.RequirementAdmissionStatusRevision},
+			Keep:   true,
+			Roles:  []string{models.RoleAgencyAdmin, models.RoleBknAdmin},
+		},
+	},
+}
+
+var dismissalWorkflow = &workflow.Workflow{
+	Name: StatusHistoryModuleDismissal,
+	States: map[int]string{
+		models.DismissalAdmissionStatusCreated:  "created",
+		models.DismissalAdmissionStatusAccepted: "accepted",
+		models.DismissalAdmissionStatusRejected: "rejected",
+	},
+	Transitions: []*workflow.Transition{
+		{
+			Action:    WorkflowActionAccept,
+			From:      []int{models.DismissalAdmissionStatusCreated},
+			To:        models.DismissalAdmissionStatusAccepted,
+			Roles:     rolesWorkflowVerifier,
+			Documents: []string{"surat_pemberhentian"},
+		},
+		{
+			Action: WorkflowActionReject,
+			From:   []int{models.DismissalAdmissionStatusCreated},
+			To:     models.DismissalAdmissionStatusRejected,
+			Roles:  rolesWorkflowVerifier,
+		},
+		{
+			Action: WorkflowActionSignLetter,
+			From:   []int{models.DismissalAdmissionStatusAccepted},
+			Keep:   true,
+			Roles:  []string{models.RoleSupervisor},
+		},
+	},
+}
+
+var promotionWorkflow = &workflow.Workflow{
+	Name: StatusHistoryModulePromotion,
+	States: map[int]string{
+		models.PromotionAdmissionStatusCreated:  "created",
+		models.PromotionAdmissionStatusAccepted: "accepted",
+		models.PromotionAdmissionStatusRejected: "rejected",
+	},
+	Transitions: []*workflow.Transition{
+		{
+			Action: WorkflowActionAccept,
+			From:   []int{models.PromotionAdmissionStatusCreated},
+			To:     models.PromotionAdmissionStatusAccepted,
+			Roles:  rolesWorkflowVerifier,
+		},
+		{
+			Action: WorkflowActionReject,
+			From:   []int{models.PromotionAdmissionStatusCreated},
+			To:     models.PromotionAdmissionStatusRejected,
+			Roles:  rolesWorkflowVerifier,
+		},
+		{
+			Action: WorkflowActionSignLetter,
+			From:   []int{models.PromotionAdmissionStatusAccepted},
+			Keep:   true,
+			Roles:  rolesWorkflowVerifier,
+		},
+	},
+}
+
+// promotionCpnsWorkflow has no actions yet, CPNS promotions are only submitted.
+var promotionCpnsWorkflow = &workflow.Workflow{
+	Name: StatusHistoryModulePromotionCpns,
+	States: map[int]string{
+		models.PromotionCpnsAdmissionStatusCreated:  "created",
+		models.PromotionCpnsAdmissionStatusAccepted: "accepted",
+		models.PromotionCpnsAdmissionStatusRejected: "rejected",
+	},
+	Transitions: []*workflow.Transition{},
+}
+
+var assessmentTeamWorkflow = &workflow.Workflow{
+	Name: StatusHistoryModuleAssessmentTeam,
+	States: map[int]string{
+		models.AssessmentTeamStatusCreated:  "created",
+		models.AssessmentTeamStatusVerified: "verified",
+	},
+	Transitions: []*workflow.Transition{
+		{
+			Action:    WorkflowActionVerify,
+			From:      []int{models.AssessmentTeamStatusCreated},
+			To:        models.AssessmentTeamStatusVerified,
+			Roles:     rolesWorkflowVerifier,
+			Documents: []string{"temp_surat_rekomendasi"},
+		},
+	},
+}
+
+// admissionWorkflows maps each module (see StatusHistoryModuleActivity and others) to its workflow.
+var admissionWorkflows = map[string]*workflow.Workflow{
+	StatusHistoryModuleActivity:       activityWorkflow,
+	StatusHistoryModuleRequirement:    requirementWorkflow,
+	StatusHistoryModuleDismissal:      dismissalWorkflow,
+	StatusHistoryModulePromotion:      promotionWorkflow,
+	StatusHistoryModulePromotionCpns:  promotionCpnsWorkflow,
+	StatusHistoryModuleAssessmentTeam: assessmentTeamWorkflow,
+}
+
+// admissionStatusQueries selects the status, the agency (instansi_id) and the functional position of an admission of
+// each module, used to check the agency scope. Modules that do not store the agency select the ASN ID instead, see
+// admissionAsnScopedModules. Dismissals do not record a functional position.
+var admissionStatusQueries = map[string]string{
+	StatusHistoryModuleActivity:       "select status, instansi_id, jabatan_jenjang from kegiatan where kegiatan_id = $1",
+	StatusHistoryModuleRequirement:    "select status, instansi_id, jabatan_fungsional from kebutuhan where kebutuhan_id = $1",
+	StatusHistoryModuleDismissal:      "select status, instansi_id, '' from pemberhentian where uuid_pemberhentian = $1",
+	StatusHistoryModulePromotion:      "select status, asn_id, jabatan_fungsional_tujuan_id from pengangkatan where uuid_pengangkatan = $1",
+	StatusHistoryModulePromotionCpns:  "select status, asn_id, jabatan_fungsional_tujuan_id from pengangkatan_cpns where pengangkatan_cpns_id = $1",
+	StatusHistoryModuleAssessmentTeam: "select status, instansi_id, jabatan_fungsional_id from tim_penilaian where tim_penilaian_id = $1",
+}
+
+var admissionAsnScopedModules = map[string]struct{}{
+	StatusHistoryModulePromotion:     {},
+	StatusHistoryModulePromotionCpns: {},
+}
+
+// workflowError converts errors returned by workflow.Workflow to error codes errnum.ErrCodeWorkflowTransitionInvalid
+// or errnum.ErrCodeWorkflowDocumentMissing. Other errors, such as those returned by guards, are returned as is.
+func workflowError(err error) error {
+	var te *workflow.TransitionError
+	if !errors.As(err, &te) {
+		return err
+	}
+
+	if te.Err == workflow.ErrDocumentMissing {
+		e := ec.NewError(ErrCodeWorkflowDocumentMissing, Errs[ErrCodeWorkflowDocumentMissing], err)
+		e.Data = map[string]interface{}{
+			"dokumen_wajib": te.Missing,
+		}
+		return e
+	}
+
+	e := ec.NewError(ErrCodeWorkflowTransitionInvalid, Errs[ErrCodeWorkflowTransitionInvalid], err)
+	e.Data = map[string]interface{}{
+		"status":        te.Status,
+		"aksi":          te.Action,
+		"aksi_tersedia": te.Allowed,
+	}
+	return e
+}
+
+// checkTransition checks whether action of wf can be done on an admission with status, given the documents supplied
+// in the request. This method already returns an error in form of error code.
+func checkTransition(wf *workflow.Workflow, status int, action string, documents []string, request interface{}) (err error) {
+	_, err = wf.Check(status, action, documents, request)
+	return workflowError(err)
+}
+
+// hasWorkflowDocument checks whether an admission of wf with status has document, i.e. the document is supplied by
+// the transitions that lead to status.
+func hasWorkflowDocument(wf *workflow.Workflow, status int, document string) bool {
+	for _, d := range wf.Documents(status) {
+		if d == document {
+			return true
+		}
+	}
+	return false
+}
+
+// getAdmissionStatusCtx returns the status of an admission of a module. Admissions outside of the agency scope are
+// treated as not found.
+func (c *Client) getAdmissionStatusCtx(ctx context.Context, module, entityId string, scope *AgencyScope) (status int, err error) {
+	_, err = uuid.Parse(entityId)
+	if err != nil {
+		return 0, ec.NewError(ErrCodeUuidInvalid, Errs[ErrCodeUuidInvalid], err)
+	}
+
+	query, ok := admissionStatusQueries[module]
+	if !ok {
+		return 0, fmt.Errorf("unknown admission module %s", module)
+	}
+
+	mdb := metricutil.NewDB(c.Db, c.SqlMetrics)
+
+	owner := ""
+	positionId := ""
+	err = mdb.QueryRowContext(ctx, query, entityId).Scan(&status, &owner, &positionId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrEntryNotFound
+		}
+		return 0, ec.NewError(ErrCodeQueryFail, Errs[ErrCodeQueryFail], err)
+	}
+
+	if _, ok = admissionAsnScopedModules[module]; ok {
+		err = c.checkAsnAgencyScopeCtx(ctx, scope, owner, positionId)
+	} else {
+		err = scope.Check(owner, positionId)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return status, nil
+}
+
+// GetAdmissionActionsCtx returns the current status of an admission of a module and the actions that a user with
+// roles can do next. Admissions outside of the agency scope are treated as in getAdmissionStatusCtx.
+func (c *Client) GetAdmissionActionsCtx(ctx context.Context, module, entityId string, scope *AgencyScope, roles map[string]struct{}) (actions *models.AdmissionActions, err error) {
+	wf, ok := admissionWorkflows[module]
+	if !ok {
+		return nil, fmt.Errorf("unknown admission module %s", module)
+	}
+
+	status, err := c.getAdmissionStatusCtx(ctx, module, entityId, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	actions = &models.AdmissionActions{
+		Status:  status,
+		Actions: make([]*models.WorkflowAction, 0),
+	}
+	for _, t := range wf.Next(status, roles) {
+		documents := t.Documents
+		if documents == nil {
+			documents = []string{}
+		}
+		actions.Actions = append(actions.Actions, &models.WorkflowAction{
+			Action:            t.Action,
+			NextStatus:        t.Next(status),
+			RequiredDocuments: documents,
+		})
+	}
+
+	return actions, nil
+}
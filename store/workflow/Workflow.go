@@ -0,0 +1,209 @@
+// Package workflow declares admission workflows as state machines: the statuses an admission can have, and the actions
+// that move an admission from one status to another.
+// All functions in this package does not support error code implemented by the standard ec and errnum package.
+package workflow
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrActionUnknown is returned when the action is not declared in the workflow at all.
+	ErrActionUnknown = errors.New("action is unknown")
+	// ErrTransitionInvalid is returned when the action cannot be done from the current status.
+	ErrTransitionInvalid = errors.New("action is not allowed from the current status")
+	// ErrDocumentMissing is returned when some documents required by the action are not supplied.
+	ErrDocumentMissing = errors.New("documents required by the action are missing")
+)
+
+// Transition moves an admission from any of the From statuses to To status when Action is done.
+type Transition struct {
+	// Action is the name of the action, e.g. accept. It is unique in a workflow.
+	Action string
+	From   []int
+	To     int
+	// Keep transitions do not change the status of the admission, e.g. edits. To is ignored.
+	Keep bool
+	// Roles lists the roles that can do the action. It only tells the frontend which users can do the action,
+	// the endpoints are authorized by their routes. Empty means any user.
+	Roles []string
+	// Documents lists the documents that must be supplied to do the action, named by their JSON field names in the
+	// action request, e.g. surat_pemberhentian.
+	Documents []string
+	// Guard is an optional check of the action request, called after the status and documents are checked.
+	// It returns the reason the action cannot be done, preferably already in form of error code.
+	// Guards are not called when listing allowed actions since there is no request yet.
+	Guard func(request interface{}) error
+	// Deprecated transitions can still be done, but are not listed by Workflow.Next.
+	Deprecated bool
+}
+
+// from checks whether the transition can be done from status.
+func (t *Transition) from(status int) bool {
+	for _, s := range t.From {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the status of an admission with status after the transition is done.
+func (t *Transition) Next(status int) int {
+	if t.Keep {
+		return status
+	}
+	return t.To
+}
+
+// Workflow is the state machine of an admission module.
+type Workflow struct {
+	// Name is the module name, e.g. dismissal.
+	Name string
+	// States maps every status of the module to its name.
+	States map[int]string
+	// Transitions lists all the actions of the module, in the order they are displayed.
+	Transitions []*Transition
+}
+
+// TransitionError describes why an action cannot be done. Err is one of ErrActionUnknown, ErrTransitionInvalid or
+// ErrDocumentMissing.
+type TransitionError struct {
+	Workflow string
+	Action   string
+	Status   int
+	// Allowed lists the actions that can be done from Status, excluding deprecated ones.
+	Allowed []string
+	// Missing lists the missing documents if Err is ErrDocumentMissing.
+	Missing []string
+	Err     error
+}
+
+func (e *TransitionError) Error() string {
+	if e.Err == ErrDocumentMissing {
+		return fmt.Sprintf("%s action %s: %v: %v", e.Workflow, e.Action, e.Err, e.Missing)
+	}
+	return fmt.Sprintf("%s action %s from status %d: %v", e.Workflow, e.Action, e.Status, e.Err)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return e.Err
+}
+
+// Transition returns the transition of an action, or nil if the action is unknown.
+func (w *Workflow) Transition(action string) *Transition {
+	for _, t := range w.Transitions {
+		if t.Action == action {
+			return t
+		}
+	}
+	return nil
+}
+
+// Documents returns the documents supplied by the transitions that lead to status, i.e. the documents an admission
+// with status has.
+func (w *Workflow) Documents(status int) (documents []string) {
+	documents = make([]string, 0)
+	for _, t := range w.Transitions {
+		if !t.Keep && t.To == status {
+			documents = append(documents, t.Documents...)
+		}
+	}
+	return documents
+}
+
+// Next returns the transitions that can be done from status by a user with roles, excluding deprecated ones.
+// Transitions without roles can be done by any user.
+func (w *Workflow) Next(status int, roles map[string]struct{}) (transitions []*Transition) {
+	transitions = make([]*Transition, 0)
+	for _, t := range w.Transitions {
+		if t.Deprecated || !t.from(status) || !hasAnyRole(roles, t.Roles) {
+			continue
+		}
+		transitions = append(transitions, t)
+	}
+	return transitions
+}
+
+// Can checks whether action can be done from status, ignoring documents and guard.
+// It returns a *TransitionError if it cannot.
+func (w *Workflow) Can(status int, action string) (t *Transition, err error) {
+	t = w.Transition(action)
+	if t == nil {
+		return nil, w.transitionError(status, action, ErrActionUnknown)
+	}
+
+	if !t.from(status) {
+		return nil, w.transitionError(status, action, ErrTransitionInvalid)
+	}
+
+	return t, nil
+}
+
+// Check checks whether action can be done from status, given the documents supplied in the request and the request
+// itself for the guard. It returns the transition to do, a *TransitionError if the status or documents do not
+// allow it, or the error returned by the guard.
+func (w *Workflow) Check(status int, action string, documents []string, request interface{}) (t *Transition, err error) {
+	t, err = w.Can(status, action)
+	if err != nil {
+		return nil, err
+	}
+
+	supplied := make(map[string]struct{}, len(documents))
+	for _, d := range documents {
+		supplied[d] = struct{}{}
+	}
+
+	missing := make([]string, 0)
+	for _, d := range t.Documents {
+		if _, ok := supplied[d]; !ok {
+			missing = append(missing, d)
+		}
+	}
+	if len(missing) > 0 {
+		e := w.transitionError(status, action, ErrDocumentMissing)
+		e.Missing = missing
+		return nil, e
+	}
+
+	if t.Guard != nil {
+		err = t.Guard(request)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+func (w *Workflow) transitionError(status int, action string, err error) *TransitionError {
+	allowed := make([]string, 0)
+	for _, t := range w.Transitions {
+		if !t.Deprecated && t.from(status) {
+			allowed = append(allowed, t.Action)
+		}
+	}
+
+	return &TransitionError{
+		Workflow: w.Name,
+		Action:   action,
+		Status:   status,
+		Allowed:  allowed,
+		Err:      err,
+	}
+}
+
+func hasAnyRole(roles map[string]struct{}, required []string) bool {
+	if len(required) == 0 {
+		return true
+	}
+
+	for _, role := range required {
+		if _, ok := roles[role]; ok {
+			return true
+		}
+	}
+
+	return false
+}
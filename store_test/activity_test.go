@@ -2,9 +2,11 @@ package store_test
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
+	"fmt"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
@@ -86,7 +88,7 @@ func TestHandleActivityAdmissionSubmit(t *testing.T) {
 		sql.NullString{Valid: dummy.OrganizerAgency != "", String: dummy.OrganizerAgency},
 		dummy.AdmissionNumber,
 	).WillReturnResult(sqlmock.NewResult(1, 0))
-	mock.ExpectExec("insert").WithArgs(sqlmock.AnyArg(), models.ActivityAdmissionStatusCreated, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
+	ExpectStatusHistoryInsert(mock, store.StatusHistoryModuleActivity, sqlmock.AnyArg(), 0, models.ActivityAdmissionStatusCreated)
 	pegawaiStmt := mock.ExpectPrepare("insert")
 	pesertaKegiatanStmt := mock.ExpectPrepare("insert")
 	for _, asn := range asns {
@@ -139,8 +141,8 @@ func TestHandleActivityStatusCsrSet(t *testing.T) {
 	for _, asn := range dummy.AttendeesPassing {
 		mock.ExpectQuery("update").WithArgs(asn.IsPassing, sqlmock.AnyArg(), sqlmock.AnyArg(), sql.NullString{String: asn.ReasonRejected, Valid: !asn.IsPassing}, dummy.ActivityId, asn.AsnId).WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
 	}
-	mock.ExpectExec("update").WithArgs(models.ActivityAdmissionStatusCertRequest, dummy.ActivityId, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
-	mock.ExpectExec("insert").WithArgs(dummy.ActivityId, models.ActivityAdmissionStatusCertRequest, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
+	mock.ExpectExec("update").WithArgs(models.ActivityAdmissionStatusCertRequest, dummy.ActivityId, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
+	ExpectStatusHistoryInsert(mock, store.StatusHistoryModuleActivity, dummy.ActivityId, models.ActivityAdmissionStatusAccepted, models.ActivityAdmissionStatusCertRequest)
 	mock.ExpectCommit()
 
 	payload, _ := json.Marshal(dummy)
@@ -189,8 +191,8 @@ func TestHandleActivityCertGenSubmit(t *testing.T) {
 			stmt.ExpectExec().WithArgs(acg.ActivityId, doc.AttendeeAsnId, doc.DocumentNumber, string(doc.DocumentDate), doc.Type, doc.SignerAsnId, sql.NullFloat64{Valid: doc.Score <= 0, Float64: float64(doc.Score)}).WillReturnResult(sqlmock.NewResult(1, 0))
 		}
 	}
-	mock.ExpectExec("update").WithArgs(models.ActivityAdmissionStatusCertPublished, acg.ActivityId, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
-	mock.ExpectExec("insert").WithArgs(acg.ActivityId, models.ActivityAdmissionStatusCertPublished, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
+	mock.ExpectExec("update").WithArgs(models.ActivityAdmissionStatusCertPublished, acg.ActivityId, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
+	ExpectStatusHistoryInsert(mock, store.StatusHistoryModuleActivity, acg.ActivityId, models.ActivityAdmissionStatusAccepted, models.ActivityAdmissionStatusCertPublished)
 
 	mock.ExpectCommit()
 
@@ -296,7 +298,7 @@ func TestHandleActivityAdmissionDetail(t *testing.T) {
 		StartDate:          "2020-01-01",
 		EndDate:            "2020-01-01",
 		PositionGrade:      uuid.New().String(),
-		AgencyId:           "",
+		AgencyId:           uuid.New().String(),
 		Extra:              uuid.New().String(),
 		AttendeesDetail: []*models.ActivityAttendee{
 			{
@@ -373,7 +375,7 @@ func TestHandleActivityAdmissionDetail(t *testing.T) {
 	q := req.URL.Query()
 	q.Add("kegiatan_id", activityId)
 	req.URL.RawQuery = q.Encode()
-	client.HandleActivityAdmissionDetail(rec, req)
+	client.HandleActivityAdmissionDetail(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: dummy.AgencyId}))
 
 	MustStatusCodeEqual(rec.Result(), http.StatusOK)
 	MustMockExpectationsMet(mock)
@@ -395,8 +397,8 @@ func TestHandleActivityVerificationSet(t *testing.T) {
 	mock.ExpectBegin()
 	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(models.ActivityAdmissionStatusCreated))
 	mock.ExpectQuery("update").WithArgs(true, sqlmock.AnyArg(), sqlmock.AnyArg(), sql.NullString{String: "REASON", Valid: false}, activityId, "TESTID").WillReturnRows(sqlmock.NewRows([]string{"isaccepted"}).AddRow(true))
-	mock.ExpectExec("update").WithArgs(models.ActivityAdmissionStatusAccepted, activityId, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
-	mock.ExpectExec("insert").WithArgs(activityId, models.ActivityAdmissionStatusAccepted, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
+	mock.ExpectExec("update").WithArgs(models.ActivityAdmissionStatusAccepted, activityId, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
+	ExpectStatusHistoryInsert(mock, store.StatusHistoryModuleActivity, activityId, models.ActivityAdmissionStatusCreated, models.ActivityAdmissionStatusAccepted)
 	mock.ExpectCommit()
 
 	payload, _ := json.Marshal(&models.ActivityVerificationRequest{
@@ -428,8 +430,12 @@ func TestHandleActivityAdmissionSearchPembina(t *testing.T) {
 	RegisterTestingT(t)
 
 	db, mock := MustCreateMock()
-	client := CreateClientNoServer(db, nil, nil)
+	profileDb, _ := MustCreateMock()
+	referenceDb, referenceMock := MustCreateMock()
+	client := CreateClientNoServer(db, profileDb, referenceDb)
 
+	pembinaAgencyId := uuid.NewString()
+	positionId := uuid.NewString()
 	agencyId := uuid.NewString()
 	admissionDate := "2006-01-02"
 	admissionStatus := rand.Intn(4) + 1
@@ -452,7 +458,9 @@ func TestHandleActivityAdmissionSearchPembina(t *testing.T) {
 	rows := sqlmock.NewRows([]string{"kegiatan_id", "nama", "status", "jenis", "deskripsi", "tgl_usulan", "tgl_mulai", "tgl_selesai", "jabatan_jenjang", "instansi_id", "data_tambahan"})
 	rows.AddRow(dummy.ActivityId, dummy.Name, dummy.Status, dummy.Type, dummy.Description, time.Time(dummy.AdmissionTimestamp), dummy.StartDate, dummy.EndDate, dummy.PositionGrade, dummy.AgencyId, dummy.Extra)
 
-	mock.ExpectQuery("select").WillReturnRows(rows)
+	// The agency is not the pembina's own, so only the supervised positions are searched.
+	referenceMock.ExpectQuery("select").WithArgs(pembinaAgencyId).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(positionId))
+	mock.ExpectQuery("jabatan_jenjang = any").WithArgs(agencyId, admissionStatus, admissionDate, pq.Array([]string{positionId})).WillReturnRows(rows)
 
 	rec := httptest.NewRecorder()
 	req := httptest.NewRequest("GET", "/api/v1/activity/admission/search-pembina", nil)
@@ -462,10 +470,12 @@ func TestHandleActivityAdmissionSearchPembina(t *testing.T) {
 	q.Add("status", strconv.Itoa(admissionStatus))
 	q.Add("jenis", strconv.Itoa(admissionType))
 	req.URL.RawQuery = q.Encode()
-	client.HandleActivityAdmissionSearchPembina(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.New().String(), WorkAgencyId: uuid.New().String()}))
+	req = store.InjectUserRoles(req, models.RolePembina)
+	client.HandleActivityAdmissionSearchPembina(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.New().String(), WorkAgencyId: pembinaAgencyId}))
 
 	MustStatusCodeEqual(rec.Result(), http.StatusOK)
 	MustMockExpectationsMet(mock)
+	MustMockExpectationsMet(referenceMock)
 
 	var result []*models.ActivityAdmission
 	MustJsonDecode(rec.Result().Body, &result)
@@ -474,6 +484,34 @@ func TestHandleActivityAdmissionSearchPembina(t *testing.T) {
 	Expect(result[0].ActivityId).To(Equal(dummy.ActivityId))
 }
 
+func TestHandleActivityAdmissionSearchPembinaOutOfScope(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	referenceDb, referenceMock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, referenceDb)
+
+	pembinaAgencyId := uuid.NewString()
+	agencyId := uuid.NewString()
+
+	// A pembina that supervises no position cannot see anything of other agencies.
+	referenceMock.ExpectQuery("select").WithArgs(pembinaAgencyId).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("jabatan_jenjang = any").WithArgs(agencyId, pq.Array([]string{})).WillReturnRows(sqlmock.NewRows([]string{"kegiatan_id", "nama", "status", "jenis", "deskripsi", "tgl_usulan", "tgl_mulai", "tgl_selesai", "jabatan_jenjang", "instansi_id", "data_tambahan"}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/v1/activity/admission/search-pembina?instansi_id="+agencyId, nil)
+	req = store.InjectUserRoles(req, models.RolePembina)
+	client.HandleActivityAdmissionSearchPembina(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.New().String(), WorkAgencyId: pembinaAgencyId}))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+	MustMockExpectationsMet(referenceMock)
+
+	var result []*models.ActivityAdmission
+	MustJsonDecode(rec.Result().Body, &result)
+	Expect(result).To(BeEmpty())
+}
+
 func TestHandleActivityCertGenDocDownload(t *testing.T) {
 	RegisterTestingT(t)
 
@@ -506,6 +544,48 @@ func TestHandleActivityCertGenDocDownload(t *testing.T) {
 
 	functionalPositionId := uuid.NewString()
 	agencyId := uuid.NewString()
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: agencyId}
+	jobPayload := fmt.Sprintf(`{"peserta_user_id":"%s"}`, attendeeAsnId)
+	mock.ExpectQuery("select").WithArgs(activityId, pq.Array([]string{agencyId}), pq.Array([]string{})).WillReturnRows(sqlmock.NewRows([]string{"kegiatan_id"}).AddRow(activityId))
+	mock.ExpectQuery("select count").WithArgs(activityId, attendeeAsnId).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("select (.+) from pekerjaan").WithArgs(store.JobKindActivityCertificate, activityId, jobPayload, user.AsnId).WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("insert into pekerjaan").WithArgs(
+		sqlmock.AnyArg(),
+		store.JobKindActivityCertificate,
+		store.StatusHistoryModuleActivity,
+		activityId,
+		jobPayload,
+		client.Jobs.MaxAttempts,
+		nil,
+		user.AsnId,
+	).WillReturnRows(sqlmock.NewRows([]string{"created_at_ts"}).AddRow(time.Now()))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/v1/activity/certgen/download", nil)
+	q := req.URL.Query()
+	q.Add("kegiatan_id", activityId)
+	q.Add("peserta_user_id", attendeeAsnId)
+	q.Add("force", strconv.FormatBool(true))
+	req.URL.RawQuery = q.Encode()
+	client.HandleActivityCertGenDocDownload(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusAccepted)
+	MustMockExpectationsMet(mock)
+	job := &models.Job{}
+	MustJsonDecode(rec.Body, job)
+	Expect(job.Kind).To(Equal(store.JobKindActivityCertificate))
+
+	// The certificate is generated by the job.
+	mock.ExpectQuery("update pekerjaan set status = 'running'").WithArgs(client.Jobs.InstanceId, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"pekerjaan_id", "jenis", "modul", "entitas_id", "payload", "percobaan", "maks_percobaan", "user_id"}).AddRow(
+		job.JobId,
+		store.JobKindActivityCertificate,
+		store.StatusHistoryModuleActivity,
+		activityId,
+		[]byte(jobPayload),
+		1,
+		client.Jobs.MaxAttempts,
+		user.AsnId,
+	))
 	referenceMock.ExpectBegin()
 	profileMock.ExpectBegin()
 	mock.ExpectQuery("select").WithArgs(activityId, attendeeAsnId).WillReturnRows(sqlmock.NewRows([]string{
@@ -561,20 +641,36 @@ func TestHandleActivityCertGenDocDownload(t *testing.T) {
 	referenceMock.ExpectQuery("select").WithArgs(sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"nama", "nama_pangkat"}).AddRow(uuid.NewString(), uuid.NewString()))
 	referenceMock.ExpectCommit()
 	profileMock.ExpectCommit()
+	mock.ExpectExec("update pekerjaan set status = 'done'").WithArgs(job.JobId, fmt.Sprintf("%s-%s.pdf", activityId, attendeeAsnId)).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ran, err := client.RunNextJobCtx(context.Background())
+	Expect(err).ToNot(HaveOccurred())
+	Expect(ran).To(BeTrue())
+	MustMockExpectationsMet(mock)
+	MustMockExpectationsMet(referenceMock)
+	MustMockExpectationsMet(profileMock)
+}
+
+func TestHandleActivityCertGenDocDownloadGenerated(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+
+	activityId := uuid.NewString()
+	agencyId := uuid.NewString()
+	mock.ExpectQuery("select").WithArgs(activityId, pq.Array([]string{agencyId}), pq.Array([]string{})).WillReturnRows(sqlmock.NewRows([]string{"kegiatan_id"}).AddRow(activityId))
 
 	rec := httptest.NewRecorder()
 	req := httptest.NewRequest("GET", "/api/v1/activity/certgen/download", nil)
 	q := req.URL.Query()
 	q.Add("kegiatan_id", activityId)
-	q.Add("peserta_user_id", attendeeAsnId)
-	q.Add("force", strconv.FormatBool(true))
+	q.Add("peserta_user_id", uuid.NewString())
 	req.URL.RawQuery = q.Encode()
-	client.HandleActivityCertGenDocDownload(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.New().String(), WorkAgencyId: uuid.New().String()}))
+	client.HandleActivityCertGenDocDownload(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: agencyId}))
 
 	MustStatusCodeEqual(rec.Result(), http.StatusFound)
 	MustMockExpectationsMet(mock)
-	MustMockExpectationsMet(referenceMock)
-	MustMockExpectationsMet(profileMock)
 }
 
 func TestHandleGetActivityStatusStatistic(t *testing.T) {
@@ -583,7 +679,7 @@ func TestHandleGetActivityStatusStatistic(t *testing.T) {
 	db, mock := MustCreateMock()
 	client := CreateClientNoServer(db, nil, nil)
 
-	statisticRows := sqlmock.NewRows([]string{"status", "jumlah"}).AddRow(1, 0).AddRow(2, 1)
+	statisticRows := sqlmock.NewRows([]string{"periode", "status", "jumlah"}).AddRow(nil, 1, 0).AddRow(nil, 2, 1)
 
 	mock.ExpectQuery("select").WillReturnRows(statisticRows)
 
@@ -12,6 +12,7 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/store"
 	"github.com/fazrithe/siasn-jf-backend-git/store/models"
 	"github.com/google/uuid"
 	"github.com/lib/pq"
@@ -67,6 +68,7 @@ func TestHandleAssessmentTeamAdmissionSubmit(t *testing.T) {
 		models.AssessmentTeamStatusCreated,
 		asn.AsnId,
 	).WillReturnResult(sqlmock.NewResult(1, 0))
+	ExpectStatusHistoryInsert(mock, store.StatusHistoryModuleAssessmentTeam, sqlmock.AnyArg(), 0, models.AssessmentTeamStatusCreated)
 
 	assessorStmt := mock.ExpectPrepare("insert")
 	for _, assessor := range dummy.Assessors {
@@ -196,7 +198,7 @@ func TestHandleAssessmentTeamGet(t *testing.T) {
 	letterRows := sqlmock.NewRows([]string{"filename", "nama_doc", "no_surat", "tgl_surat", "createdat"})
 	letterRows.AddRow(dummy.RecommendationLetter.Filename, dummy.RecommendationLetter.DocumentName, dummy.RecommendationLetter.DocumentNumber, dummy.RecommendationLetter.DocumentDate, time.Time(dummy.RecommendationLetter.CreatedAt))
 
-	mock.ExpectQuery("select").WithArgs(dummy.AssessmentTeamId).WillReturnRows(rows)
+	mock.ExpectQuery("select").WithArgs(dummy.AssessmentTeamId, pq.Array([]string{dummy.AgencyId})).WillReturnRows(rows)
 	mock.ExpectQuery("select").WithArgs(dummy.AssessmentTeamId).WillReturnRows(assessorRows)
 	mock.ExpectQuery("select").WithArgs(dummy.AssessmentTeamId).WillReturnRows(documentRows)
 
@@ -209,7 +211,7 @@ func TestHandleAssessmentTeamGet(t *testing.T) {
 	q := req.URL.Query()
 	q.Add("tim_penilaian_id", dummy.AssessmentTeamId)
 	req.URL.RawQuery = q.Encode()
-	client.HandleAssessmentTeamGet(rec, req)
+	client.HandleAssessmentTeamGet(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: dummy.AgencyId}))
 
 	MustStatusCodeEqual(rec.Result(), http.StatusOK)
 	MustMockExpectationsMet(mock)
@@ -276,7 +278,7 @@ func TestHandleAssessmentTeamSearch(t *testing.T) {
 		agencyRows.AddRow(d.AgencyId, d.Agency)
 	}
 
-	mock.ExpectQuery("select").WithArgs(sqlmock.AnyArg(), admissionStatus, sqlmock.AnyArg(), admissionDate, countPerPage+1, (pageNumber-1)*countPerPage).WillReturnRows(rows)
+	mock.ExpectQuery("select").WithArgs(admissionDate, pq.Array([]int{admissionStatus}), countPerPage+1, (pageNumber-1)*countPerPage).WillReturnRows(rows)
 	referenceMock.ExpectQuery("select").WithArgs(pq.Array(agencyIds)).WillReturnRows(agencyRows)
 
 	rec := httptest.NewRecorder()
@@ -338,6 +340,8 @@ func TestHandleAssessmentTeamVerificationSubmit(t *testing.T) {
 	mock.ExpectBegin()
 	mock.ExpectQuery("select").WithArgs(
 		dummy.AssessmentTeamId,
+		pq.Array([]string{asn.WorkAgencyId}),
+		pq.Array([]string{}),
 	).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(models.AssessmentTeamStatusCreated))
 
 	now := time.Now()
@@ -346,6 +350,7 @@ func TestHandleAssessmentTeamVerificationSubmit(t *testing.T) {
 		asn.AsnId,
 		dummy.AssessmentTeamId,
 	).WillReturnRows(sqlmock.NewRows([]string{"status_ts"}).AddRow(now))
+	ExpectStatusHistoryInsert(mock, store.StatusHistoryModuleAssessmentTeam, dummy.AssessmentTeamId, models.AssessmentTeamStatusCreated, models.AssessmentTeamStatusVerified)
 
 	assessorStmt := mock.ExpectPrepare("update")
 	for _, assessor := range dummy.Assessors {
@@ -0,0 +1,184 @@
+package store_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/store"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	. "github.com/onsi/gomega"
+)
+
+func createRoleAuthRouter(client *store.Client, user *auth.Asn) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(
+		func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				next.ServeHTTP(writer, auth.InjectUserDetail(request, user))
+			})
+		},
+		client.RoleAuthHandler(store.RouteRoles{
+			"/api/v1/verify":  {models.RoleVerifier},
+			"/api/v1/sign":    {models.RoleSupervisor},
+			"/api/v1/profile": {},
+		}),
+	)
+
+	handler := func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	}
+	router.HandleFunc("/api/v1/verify", handler)
+	router.HandleFunc("/api/v1/sign", handler)
+	router.HandleFunc("/api/v1/profile", handler)
+	router.HandleFunc("/api/v1/unregistered", handler)
+	return router
+}
+
+func TestRoleAuthHandler(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString(), AccessToken: &auth.AccessToken{}}
+	router := createRoleAuthRouter(client, user)
+
+	// No role at all.
+	mock.ExpectQuery("select").WithArgs(user.AsnId).WillReturnRows(sqlmock.NewRows([]string{"role_peg"}))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/verify", nil))
+	MustStatusCodeEqual(rec.Result(), http.StatusForbidden)
+
+	// Role from pegawai table.
+	mock.ExpectQuery("select").WithArgs(user.AsnId).WillReturnRows(sqlmock.NewRows([]string{"role_peg"}).AddRow(models.StaffRoleVerifier))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/verify", nil))
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+
+	// Role from access token.
+	user.AccessToken.ResourceAccess = map[string]interface{}{
+		"siasn-jf": map[string]interface{}{"roles": []interface{}{models.RoleVerifier}},
+	}
+	mock.ExpectQuery("select").WithArgs(user.AsnId).WillReturnRows(sqlmock.NewRows([]string{"role_peg"}))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/verify", nil))
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+
+	// Any authenticated user.
+	user.AccessToken.ResourceAccess = nil
+	mock.ExpectQuery("select").WithArgs(user.AsnId).WillReturnRows(sqlmock.NewRows([]string{"role_peg"}))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/profile", nil))
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+
+	// Route without registered roles, no query is done.
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/unregistered", nil))
+	MustStatusCodeEqual(rec.Result(), http.StatusForbidden)
+
+	MustMockExpectationsMet(mock)
+}
+
+func TestRoleAuthHandlerSupervisor(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString(), AccessToken: &auth.AccessToken{}}
+	router := createRoleAuthRouter(client, user)
+
+	// Pejabat pembina kepegawaian signs letters, which verifiers cannot.
+	mock.ExpectQuery("select").WithArgs(user.AsnId).WillReturnRows(sqlmock.NewRows([]string{"role_peg"}).AddRow(models.StaffRoleSupervisor))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/sign", nil))
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+
+	mock.ExpectQuery("select").WithArgs(user.AsnId).WillReturnRows(sqlmock.NewRows([]string{"role_peg"}).AddRow(models.StaffRoleVerifier))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/sign", nil))
+	MustStatusCodeEqual(rec.Result(), http.StatusForbidden)
+
+	MustMockExpectationsMet(mock)
+
+	mock.ExpectQuery("select").WithArgs(user.AsnId).WillReturnRows(sqlmock.NewRows([]string{"role_peg"}).AddRow(models.StaffRoleSupervisor))
+	roles, err := client.GetUserRolesCtx(context.Background(), user)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(roles).To(Equal(map[string]struct{}{models.RoleSupervisor: {}, models.RoleAgencyAdmin: {}}))
+}
+
+func TestRoleAuthHandlerCache(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+	client.RoleCache = store.NewRoleCache(time.Minute)
+
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString(), AccessToken: &auth.AccessToken{Jti: uuid.NewString()}}
+	router := createRoleAuthRouter(client, user)
+
+	// Only the first request of the token queries pegawai.
+	mock.ExpectQuery("select").WithArgs(user.AsnId).WillReturnRows(sqlmock.NewRows([]string{"role_peg"}).AddRow(models.StaffRoleVerifier))
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/verify", nil))
+		MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	}
+	MustMockExpectationsMet(mock)
+
+	// A new token queries again.
+	user.AccessToken = &auth.AccessToken{Jti: uuid.NewString()}
+	mock.ExpectQuery("select").WithArgs(user.AsnId).WillReturnRows(sqlmock.NewRows([]string{"role_peg"}))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/v1/verify", nil))
+	MustStatusCodeEqual(rec.Result(), http.StatusForbidden)
+	MustMockExpectationsMet(mock)
+
+	// Expired tokens are not cached beyond their expiry.
+	user.AccessToken = &auth.AccessToken{Jti: uuid.NewString(), Exp: time.Now().Add(-time.Second).Unix()}
+	client.RoleCache.Set(user, map[string]struct{}{models.RoleVerifier: {}})
+	Expect(client.RoleCache.Get(user)).To(BeNil())
+}
+
+func TestIsStaff(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+	user := &auth.Asn{AsnId: uuid.NewString()}
+
+	mock.ExpectQuery("select exists").WithArgs(user.AsnId).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	staff, err := client.IsStaffCtx(context.Background(), user)
+	Expect(err).To(BeNil())
+	Expect(staff).To(BeTrue())
+
+	mock.ExpectQuery("select exists").WithArgs(user.AsnId).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	staff, err = client.IsStaffCtx(context.Background(), user)
+	Expect(err).To(BeNil())
+	Expect(staff).To(BeFalse())
+	MustMockExpectationsMet(mock)
+}
+
+func TestGetStaffRoles(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+	// Roles of the access token are not staff roles.
+	user := &auth.Asn{AsnId: uuid.NewString(), AccessToken: &auth.AccessToken{ResourceAccess: map[string]interface{}{
+		"siasn-jf": map[string]interface{}{"roles": []interface{}{models.RoleVerifier}},
+	}}}
+
+	mock.ExpectQuery("select").WithArgs(user.AsnId).WillReturnRows(sqlmock.NewRows([]string{"role_peg"}).AddRow(models.StaffRoleSupervisor))
+	roles, err := client.GetStaffRolesCtx(context.Background(), user)
+	Expect(err).To(BeNil())
+	Expect(roles).To(Equal([]string{models.RoleAgencyAdmin, models.RoleSupervisor}))
+	MustMockExpectationsMet(mock)
+}
@@ -2,6 +2,7 @@ package store_test
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -11,8 +12,11 @@ import (
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fazrithe/siasn-jf-backend-git/errnum"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
 	"github.com/fazrithe/siasn-jf-backend-git/store"
+	"github.com/fazrithe/siasn-jf-backend-git/store/esign"
 	"github.com/fazrithe/siasn-jf-backend-git/store/models"
 	"github.com/google/uuid"
 	"github.com/lib/pq"
@@ -60,6 +64,7 @@ func TestHandleDismissalAdmissionSubmit(t *testing.T) {
 		sql.NullString{Valid: true, String: dummy.ReasonDetail},
 		dummy.AdmissionNumber,
 	).WillReturnResult(sqlmock.NewResult(1, 0))
+	ExpectStatusHistoryInsert(mock, store.StatusHistoryModuleDismissal, sqlmock.AnyArg(), 0, models.DismissalAdmissionStatusCreated)
 	stmt := mock.ExpectPrepare("insert")
 	for _, d := range dummy.TempSupportDocuments {
 		stmt.ExpectExec().WithArgs(sqlmock.AnyArg(), d.Filename, d.DocumentName).WillReturnResult(sqlmock.NewResult(1, 0))
@@ -136,6 +141,7 @@ func TestHandleDismissalAdmissionGet(t *testing.T) {
 		"tgl_sk",
 		"detail_alasan",
 		"no_usulan",
+		"instansi_id",
 	}).
 		AddRow(
 			dummy.AsnId,
@@ -153,6 +159,7 @@ func TestHandleDismissalAdmissionGet(t *testing.T) {
 			dummy.DecreeDate,
 			dummy.ReasonDetail,
 			dummy.AdmissionNumber,
+			dummy.AgencyId,
 		))
 	mock.ExpectQuery("select").WithArgs(dismissalId).WillReturnRows(sqlmock.NewRows([]string{"filename", "nama_doc"}).AddRow(dummy.SupportDocuments[0].Filename, dummy.SupportDocuments[0].DocumentName))
 	profileMock.ExpectQuery("select").WithArgs(pq.Array([]string{dummy.AsnId})).WillReturnRows(sqlmock.NewRows([]string{"id", "nama", "nip"}).AddRow(dummy.AsnId, dummy.AsnName, dummy.AsnNip))
@@ -219,10 +226,7 @@ func TestHandleDismissalAcceptSet(t *testing.T) {
 	RegisterTestingT(t)
 
 	db, mock := MustCreateMock()
-	profileDb, profileMock := MustCreateMock()
-	referenceDb, referenceMock := MustCreateMock()
-	client := CreateClientNoServer(db, profileDb, referenceDb)
-	client.DocxRenderer = &mockDocxRenderer{}
+	client := CreateClientNoServer(db, nil, nil)
 
 	dummy := &models.DismissalAcceptanceRequest{
 		DismissalId:                uuid.New().String(),
@@ -235,10 +239,55 @@ func TestHandleDismissalAcceptSet(t *testing.T) {
 		},
 	}
 
+	mock.ExpectBegin()
+	mock.ExpectQuery("select status from pemberhentian").WithArgs(dummy.DismissalId, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(models.DismissalAdmissionStatusCreated))
+	mock.ExpectQuery("select").WithArgs(dummy.DismissalLetterSignerAsnId, models.StaffRoleSupervisor, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	mock.ExpectQuery("update").WithArgs(
+		models.DismissalAdmissionStatusAccepted,
+		sqlmock.AnyArg(),
+		dummy.DismissalLetter.DocumentName,
+		dummy.DismissalLetter.DocumentNumber,
+		dummy.DismissalLetterSignerAsnId,
+		string(dummy.DismissalLetter.DocumentDate),
+		dummy.DismissalId,
+	).WillReturnRows(sqlmock.NewRows([]string{"status_ts"}).AddRow(time.Now()))
+	ExpectStatusHistoryInsert(mock, store.StatusHistoryModuleDismissal, dummy.DismissalId, models.DismissalAdmissionStatusCreated, models.DismissalAdmissionStatusAccepted)
+	mock.ExpectCommit()
+
+	payload, _ := json.Marshal(dummy)
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/dismissal/accept/submit", bytes.NewBuffer(payload))
+	client.HandleDismissalAcceptSet(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.New().String(), WorkAgencyId: uuid.New().String()}))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+
+	MustMockExpectationsMet(mock)
+
+	result := &models.DismissalAdmission{}
+	MustJsonDecode(rec.Result().Body, result)
+
+	Expect(result.DismissalId).ToNot(BeEmpty())
+}
+
+func TestHandleDismissalAcceptanceLetterSign(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	profileDb, profileMock := MustCreateMock()
+	referenceDb, referenceMock := MustCreateMock()
+	client := CreateClientNoServer(db, profileDb, referenceDb)
+	client.DocxRenderer = &mockDocxRenderer{}
+	signer := &esign.FakeSigner{Passphrase: "secret"}
+	client.Signer = signer
+
+	dismissalId := uuid.NewString()
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString(), Nik: "3275080903800022"}
+
 	asnId := uuid.NewString()
 	data := &store.DismissalAcceptanceTemplate{
-		DocumentNumber:   dummy.DismissalLetter.DocumentNumber,
-		DocumentDate:     string(dummy.DismissalLetter.DocumentDate),
+		DocumentNumber:   uuid.NewString(),
+		DocumentDate:     time.Now().Format("2006-01-02"),
 		DecreeNumber:     uuid.NewString(),
 		DecreeDate:       time.Now().Format("2006-01-02"),
 		DismissalDate:    time.Now().Format("2006-01-02"),
@@ -250,21 +299,49 @@ func TestHandleDismissalAcceptSet(t *testing.T) {
 		OrganizationUnit: uuid.NewString(),
 	}
 
-	mock.ExpectBegin()
-	mock.ExpectQuery("select").WithArgs(dummy.DismissalLetterSignerAsnId, models.StaffRoleSupervisor, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
-	mock.ExpectQuery("update").WithArgs(
+	mock.ExpectQuery("select").WithArgs(dismissalId, pq.Array([]string{user.WorkAgencyId})).WillReturnRows(sqlmock.NewRows([]string{"status", "coalesce(ttd_user_id_surat_pemberhentian, '')"}).AddRow(
 		models.DismissalAdmissionStatusAccepted,
+		user.AsnId,
+	))
+	mock.ExpectQuery("insert into pekerjaan").WithArgs(
 		sqlmock.AnyArg(),
-		dummy.DismissalLetter.DocumentName,
-		dummy.DismissalLetter.DocumentNumber,
-		dummy.DismissalLetterSignerAsnId,
-		string(dummy.DismissalLetter.DocumentDate),
-		dummy.DismissalId,
-		models.DismissalAdmissionStatusCreated,
-	).WillReturnRows(sqlmock.NewRows([]string{"status_ts"}).AddRow(time.Now()))
-	mock.ExpectQuery("select").WithArgs(dummy.DismissalId).WillReturnRows(sqlmock.NewRows([]string{"asn_id", "status", "coalesce(alasan_pemberhentian, '')", "nosurat_surat_pemberhentian", "to_char(tgl_surat_pemberhentian, 'YYYY-MM-DD')", "to_char(tgl_pemberhentian, 'YYYY-MM-DD')", "coalesce(nomor_sk, '')", "to_char(tgl_sk, 'YYYY-MM-DD')"}).AddRow(
+		store.JobKindDismissalAcceptanceLetter,
+		store.StatusHistoryModuleDismissal,
+		dismissalId,
+		"{}",
+		client.Jobs.MaxAttempts,
+		client.Jobs.InstanceId,
+		user.AsnId,
+	).WillReturnRows(sqlmock.NewRows([]string{"created_at_ts"}).AddRow(time.Now()))
+
+	payload, _ := json.Marshal(map[string]string{"pemberhentian_id": dismissalId, "passphrase": "secret"})
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/dismissal/accept/sign", bytes.NewBuffer(payload))
+	client.HandleDismissalAcceptanceLetterSign(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusAccepted)
+	MustMockExpectationsMet(mock)
+	job := &models.Job{}
+	MustJsonDecode(rec.Body, job)
+	Expect(job.Status).To(Equal(models.JobStatusPending))
+	Expect(signer.Count()).To(Equal(0))
+
+	// The letter is generated and signed by the job.
+	mock.ExpectQuery("update pekerjaan set status = 'running'").WithArgs(client.Jobs.InstanceId, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"pekerjaan_id", "jenis", "modul", "entitas_id", "payload", "percobaan", "maks_percobaan", "user_id"}).AddRow(
+		job.JobId,
+		store.JobKindDismissalAcceptanceLetter,
+		store.StatusHistoryModuleDismissal,
+		dismissalId,
+		[]byte("{}"),
+		1,
+		client.Jobs.MaxAttempts,
+		user.AsnId,
+	))
+	mock.ExpectQuery("select").WithArgs(dismissalId).WillReturnRows(sqlmock.NewRows([]string{"asn_id", "status", "coalesce(ttd_user_id_surat_pemberhentian, '')", "coalesce(alasan_pemberhentian, '')", "nosurat_surat_pemberhentian", "to_char(tgl_surat_pemberhentian, 'YYYY-MM-DD')", "to_char(tgl_pemberhentian, 'YYYY-MM-DD')", "coalesce(nomor_sk, '')", "to_char(tgl_sk, 'YYYY-MM-DD')"}).AddRow(
 		asnId,
 		models.DismissalAdmissionStatusAccepted,
+		user.AsnId,
 		data.DismissalReason,
 		data.DocumentNumber,
 		data.DocumentDate,
@@ -292,22 +369,30 @@ func TestHandleDismissalAcceptSet(t *testing.T) {
 	}).AddRow(asnId, data.AsnNip, "", data.AsnName, "", "", "", "", "", "", "", "", "", 0, uuid.NewString(), uuid.NewString()))
 	referenceMock.ExpectQuery("select").WithArgs(sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"nama_unor", "coalesce(nama_jabatan, '')"}).AddRow(data.OrganizationUnit, data.Position))
 	referenceMock.ExpectQuery("select").WithArgs(sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"nama", "nama_pangkat"}).AddRow(uuid.NewString(), data.AsnGrade))
-	mock.ExpectCommit()
+	mock.ExpectExec("update pekerjaan set status = 'done'").WithArgs(job.JobId, dismissalId+".pdf").WillReturnResult(sqlmock.NewResult(0, 1))
 
-	payload, _ := json.Marshal(dummy)
+	ran, err := client.RunNextJobCtx(context.Background())
+	Expect(err).ToNot(HaveOccurred())
+	Expect(ran).To(BeTrue())
+	MustMockExpectationsMet(mock)
+	MustMockExpectationsMet(profileMock)
+	MustMockExpectationsMet(referenceMock)
+	Expect(signer.Count()).To(Equal(1))
+	Expect(signer.LastIdentity()).To(Equal(&esign.Identity{Nik: user.Nik, Passphrase: "secret"}))
 
-	rec := httptest.NewRecorder()
-	req, _ := http.NewRequest("POST", "/api/v1/dismissal/accept/submit", bytes.NewBuffer(payload))
-	client.HandleDismissalAcceptSet(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.New().String(), WorkAgencyId: uuid.New().String()}))
+	// Only the signer chosen on acceptance can sign the letter.
+	mock.ExpectQuery("select").WithArgs(dismissalId, pq.Array([]string{user.WorkAgencyId})).WillReturnRows(sqlmock.NewRows([]string{"status", "coalesce(ttd_user_id_surat_pemberhentian, '')"}).AddRow(
+		models.DismissalAdmissionStatusAccepted,
+		uuid.NewString(),
+	))
 
-	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/dismissal/accept/sign", bytes.NewBuffer(payload))
+	client.HandleDismissalAcceptanceLetterSign(rec, auth.InjectUserDetail(req, user))
 
+	MustStatusCodeEqual(rec.Result(), http.StatusForbidden)
 	MustMockExpectationsMet(mock)
-
-	result := &models.DismissalAdmission{}
-	MustJsonDecode(rec.Result().Body, result)
-
-	Expect(result.DismissalId).ToNot(BeEmpty())
+	Expect(signer.Count()).To(Equal(1))
 }
 
 func TestHandleDismissalDenySet(t *testing.T) {
@@ -327,13 +412,25 @@ func TestHandleDismissalDenySet(t *testing.T) {
 	}
 
 	mock.ExpectBegin()
+	mock.ExpectQuery("select status from pemberhentian").WithArgs(dummy.DismissalId, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(models.DismissalAdmissionStatusCreated))
 	mock.ExpectQuery("update").WithArgs(
 		models.DismissalAdmissionStatusRejected,
 		sqlmock.AnyArg(),
 		dummy.DismissalDenyReason,
 		dummy.DismissalId,
-		models.DismissalAdmissionStatusCreated,
 	).WillReturnRows(sqlmock.NewRows([]string{"status_ts"}).AddRow(time.Now()))
+	mock.ExpectExec("insert into status_hist").WithArgs(
+		store.StatusHistoryModuleDismissal,
+		dummy.DismissalId,
+		models.DismissalAdmissionStatusCreated,
+		models.DismissalAdmissionStatusRejected,
+		dummy.DismissalDenyReason,
+		sqlmock.AnyArg(),
+		"10.0.0.1",
+		"siasn-test",
+		nil,
+		sqlmock.AnyArg(),
+	).WillReturnResult(sqlmock.NewResult(1, 1))
 	docStmt := mock.ExpectPrepare("insert")
 	for _, d := range dummy.TempDismissalDenySupportDocuments {
 		docStmt.ExpectExec().WithArgs(dummy.DismissalId, d.Filename).WillReturnResult(sqlmock.NewResult(1, 0))
@@ -344,6 +441,8 @@ func TestHandleDismissalDenySet(t *testing.T) {
 
 	rec := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/api/v1/dismissal/deny/submit", bytes.NewBuffer(payload))
+	req.RemoteAddr = "10.0.0.1:52000"
+	req.Header.Set("User-Agent", "siasn-test")
 	client.HandleDismissalDenySet(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.New().String(), WorkAgencyId: uuid.New().String()}))
 
 	MustStatusCodeEqual(rec.Result(), http.StatusOK)
@@ -356,13 +455,238 @@ func TestHandleDismissalDenySet(t *testing.T) {
 	Expect(result.DismissalId).ToNot(BeEmpty())
 }
 
+func TestHandleDismissalDenySetIpAddress(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+	trustedProxies, err := store.ParseTrustedProxies([]string{"10.0.0.1", "10.1.0.0/16"})
+	Expect(err).ToNot(HaveOccurred())
+	client.TrustedProxies = trustedProxies
+
+	dummy := &models.DismissalDenyRequest{
+		DismissalId:         uuid.NewString(),
+		DismissalDenyReason: "REASON",
+	}
+	payload, _ := json.Marshal(dummy)
+
+	cases := []struct {
+		remoteAddr    string
+		forwardedFor  string
+		wantIpAddress string
+	}{
+		// X-Forwarded-For of untrusted clients is ignored.
+		{remoteAddr: "203.0.113.7:4321", forwardedFor: "198.51.100.1", wantIpAddress: "203.0.113.7"},
+		{remoteAddr: "10.0.0.1:4321", forwardedFor: "198.51.100.1, 203.0.113.9, 10.1.2.3", wantIpAddress: "203.0.113.9"},
+		{remoteAddr: "10.0.0.1:4321", forwardedFor: "", wantIpAddress: "10.0.0.1"},
+	}
+	for _, c := range cases {
+		mock.ExpectBegin()
+		mock.ExpectQuery("select status from pemberhentian").WithArgs(dummy.DismissalId, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(models.DismissalAdmissionStatusCreated))
+		mock.ExpectQuery("update").WillReturnRows(sqlmock.NewRows([]string{"status_ts"}).AddRow(time.Now()))
+		mock.ExpectExec("insert into status_hist").
+			WithArgs(store.StatusHistoryModuleDismissal, dummy.DismissalId, models.DismissalAdmissionStatusCreated, models.DismissalAdmissionStatusRejected, sqlmock.AnyArg(), sqlmock.AnyArg(), sql.NullString{Valid: true, String: c.wantIpAddress}, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		rec := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/dismissal/deny/submit", bytes.NewBuffer(payload))
+		req.RemoteAddr = c.remoteAddr
+		if c.forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", c.forwardedFor)
+		}
+		client.HandleDismissalDenySet(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}))
+
+		MustStatusCodeEqual(rec.Result(), http.StatusOK)
+		MustMockExpectationsMet(mock)
+	}
+
+	_, err = store.ParseTrustedProxies([]string{"proxy.local"})
+	Expect(err).To(HaveOccurred())
+}
+
+func TestHandleDismissalDenySetImpersonated(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+
+	dummy := &models.DismissalDenyRequest{
+		DismissalId:         uuid.NewString(),
+		DismissalDenyReason: "REASON",
+	}
+	impersonated := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+	impersonated.Impersonator = &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+
+	// The status is changed by the impersonated user, on behalf of the impersonator.
+	mock.ExpectBegin()
+	mock.ExpectQuery("select status from pemberhentian").WithArgs(dummy.DismissalId, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(models.DismissalAdmissionStatusCreated))
+	mock.ExpectQuery("update").WillReturnRows(sqlmock.NewRows([]string{"status_ts"}).AddRow(time.Now()))
+	mock.ExpectExec("insert into status_hist").
+		WithArgs(store.StatusHistoryModuleDismissal, dummy.DismissalId, models.DismissalAdmissionStatusCreated, models.DismissalAdmissionStatusRejected, sqlmock.AnyArg(), impersonated.AsnId, sqlmock.AnyArg(), sqlmock.AnyArg(), impersonated.Impersonator.AsnId, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	payload, _ := json.Marshal(dummy)
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/dismissal/deny/submit", bytes.NewBuffer(payload))
+	client.HandleDismissalDenySet(rec, auth.InjectUserDetail(req, impersonated))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+}
+
+func TestHandleDismissalHistoryGet(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	profileDb, profileMock := MustCreateMock()
+	client := CreateClientNoServer(db, profileDb, nil)
+
+	dismissalId := uuid.NewString()
+	agencyId := uuid.NewString()
+	submitterAsnId := uuid.NewString()
+	verifierAsnId := uuid.NewString()
+	adminAsnId := uuid.NewString()
+	createdAt := time.Now().Add(-time.Hour)
+	deniedAt := time.Now()
+
+	mock.ExpectQuery("select status, instansi_id, '' from pemberhentian").WithArgs(dismissalId).WillReturnRows(sqlmock.NewRows([]string{"status", "instansi_id", "jabatan_fungsional"}).AddRow(models.DismissalAdmissionStatusRejected, agencyId, ""))
+	mock.ExpectQuery("select").WithArgs(store.StatusHistoryModuleDismissal, dismissalId).WillReturnRows(sqlmock.NewRows([]string{"status_lama", "status", "alasan", "user_id", "ip_address", "user_agent", "impersonator_id", "modified_at_ts"}).
+		AddRow(0, models.DismissalAdmissionStatusCreated, "", submitterAsnId, "", "", "", createdAt).
+		AddRow(models.DismissalAdmissionStatusCreated, models.DismissalAdmissionStatusRejected, "REASON", verifierAsnId, "10.0.0.1", "siasn-test", adminAsnId, deniedAt))
+	profileMock.ExpectQuery("select").WithArgs(pq.Array([]string{submitterAsnId, verifierAsnId, adminAsnId})).WillReturnRows(sqlmock.NewRows([]string{"id", "nip", "nama"}).
+		AddRow(verifierAsnId, "199001012020011001", "VERIFIER").
+		AddRow(adminAsnId, "198501012010011001", "ADMIN"))
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/dismissal/admission/history?pemberhentian_id=%s", dismissalId), nil)
+	client.HandleDismissalHistoryGet(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: agencyId}))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+	MustMockExpectationsMet(profileMock)
+
+	var result []*models.StatusHistory
+	MustJsonDecode(rec.Result().Body, &result)
+
+	Expect(result).To(HaveLen(2))
+	Expect(result[0].OldStatus).To(Equal(0))
+	Expect(result[0].ModifiedBy).To(Equal(submitterAsnId))
+	Expect(result[1].OldStatus).To(Equal(models.DismissalAdmissionStatusCreated))
+	Expect(result[1].Status).To(Equal(models.DismissalAdmissionStatusRejected))
+	Expect(result[1].Reason).To(Equal("REASON"))
+	Expect(result[1].ModifiedByName).To(Equal("VERIFIER"))
+	Expect(result[1].IpAddress).To(Equal("10.0.0.1"))
+	Expect(result[0].ImpersonatedBy).To(BeEmpty())
+	Expect(result[1].ImpersonatedBy).To(Equal(adminAsnId))
+	Expect(result[1].ImpersonatedByName).To(Equal("ADMIN"))
+	Expect(time.Time(result[1].ModifiedAt).Unix()).To(Equal(deniedAt.Unix()))
+
+	// Dismissals of other agencies are not found.
+	mock.ExpectQuery("select status, instansi_id, '' from pemberhentian").WithArgs(dismissalId).WillReturnRows(sqlmock.NewRows([]string{"status", "instansi_id", "jabatan_fungsional"}).AddRow(models.DismissalAdmissionStatusRejected, uuid.NewString(), ""))
+
+	rec = httptest.NewRecorder()
+	client.HandleDismissalHistoryGet(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: agencyId}))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusNotFound)
+	MustMockExpectationsMet(mock)
+}
+
+func TestHandleDismissalActionsGet(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+
+	dismissalId := uuid.NewString()
+	agencyId := uuid.NewString()
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: agencyId}
+
+	mock.ExpectQuery("select status, instansi_id, '' from pemberhentian").WithArgs(dismissalId).WillReturnRows(sqlmock.NewRows([]string{"status", "instansi_id", "jabatan_fungsional"}).AddRow(models.DismissalAdmissionStatusCreated, agencyId, ""))
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/dismissal/admission/actions?pemberhentian_id=%s", dismissalId), nil)
+	client.HandleDismissalActionsGet(rec, store.InjectUserRoles(auth.InjectUserDetail(req, user), models.RoleVerifier))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+
+	result := &models.AdmissionActions{}
+	MustJsonDecode(rec.Result().Body, result)
+
+	Expect(result.Status).To(Equal(models.DismissalAdmissionStatusCreated))
+	Expect(result.Actions).To(HaveLen(2))
+	Expect(result.Actions[0].Action).To(Equal(store.WorkflowActionAccept))
+	Expect(result.Actions[0].NextStatus).To(Equal(models.DismissalAdmissionStatusAccepted))
+	Expect(result.Actions[0].RequiredDocuments).To(Equal([]string{"surat_pemberhentian"}))
+	Expect(result.Actions[1].Action).To(Equal(store.WorkflowActionReject))
+
+	// Agency admins cannot accept or reject dismissals.
+	mock.ExpectQuery("select status, instansi_id, '' from pemberhentian").WithArgs(dismissalId).WillReturnRows(sqlmock.NewRows([]string{"status", "instansi_id", "jabatan_fungsional"}).AddRow(models.DismissalAdmissionStatusCreated, agencyId, ""))
+
+	rec = httptest.NewRecorder()
+	client.HandleDismissalActionsGet(rec, store.InjectUserRoles(auth.InjectUserDetail(req, user), models.RoleAgencyAdmin))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+
+	result = &models.AdmissionActions{}
+	MustJsonDecode(rec.Result().Body, result)
+	Expect(result.Actions).To(BeEmpty())
+
+	// No actions are left once the dismissal is accepted.
+	mock.ExpectQuery("select status, instansi_id, '' from pemberhentian").WithArgs(dismissalId).WillReturnRows(sqlmock.NewRows([]string{"status", "instansi_id", "jabatan_fungsional"}).AddRow(models.DismissalAdmissionStatusAccepted, agencyId, ""))
+
+	rec = httptest.NewRecorder()
+	client.HandleDismissalActionsGet(rec, store.InjectUserRoles(auth.InjectUserDetail(req, user), models.RoleVerifier))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+
+	result = &models.AdmissionActions{}
+	MustJsonDecode(rec.Result().Body, result)
+	Expect(result.Status).To(Equal(models.DismissalAdmissionStatusAccepted))
+	Expect(result.Actions).To(BeEmpty())
+}
+
+func TestHandleDismissalDenySetInvalidTransition(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+
+	dummy := &models.DismissalDenyRequest{
+		DismissalId:         uuid.New().String(),
+		DismissalDenyReason: uuid.New().String(),
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("select status from pemberhentian").WithArgs(dummy.DismissalId, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(models.DismissalAdmissionStatusAccepted))
+	mock.ExpectRollback()
+
+	payload, _ := json.Marshal(dummy)
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/dismissal/deny/submit", bytes.NewBuffer(payload))
+	client.HandleDismissalDenySet(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.New().String(), WorkAgencyId: uuid.New().String()}))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusBadRequest)
+	MustMockExpectationsMet(mock)
+
+	result := &ec.Error{}
+	MustJsonDecode(rec.Result().Body, result)
+	Expect(result.Code).To(Equal(errnum.ErrCodeWorkflowTransitionInvalid))
+	Expect(result.Data).To(HaveKeyWithValue("aksi", store.WorkflowActionReject))
+}
+
 func TestHandleGetDismissalStatusStatistic(t *testing.T) {
 	RegisterTestingT(t)
 
 	db, mock := MustCreateMock()
 	client := CreateClientNoServer(db, nil, nil)
 
-	statisticRows := sqlmock.NewRows([]string{"status", "jumlah"}).AddRow(1, 0).AddRow(2, 1)
+	statisticRows := sqlmock.NewRows([]string{"periode", "status", "jumlah"}).AddRow(nil, 1, 0).AddRow(nil, 2, 1)
 
 	mock.ExpectQuery("select").WillReturnRows(statisticRows)
 
@@ -0,0 +1,59 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fazrithe/siasn-jf-backend-git/store/esign"
+	. "github.com/onsi/gomega"
+)
+
+func TestBsreSigner(t *testing.T) {
+	RegisterTestingT(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		username, password, _ := request.BasicAuth()
+		if username != "user" || password != "pass" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if request.FormValue("passphrase") != "secret" {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(http.StatusBadRequest)
+			_, _ = writer.Write([]byte(`{"error": "Passphrase anda salah", "status_code": 2031}`))
+			return
+		}
+
+		Expect(request.FormValue("nik")).To(Equal("3275080903800022"))
+		Expect(request.FormValue("tampilan")).To(Equal("visible"))
+		Expect(request.FormValue("tag_koordinat")).To(Equal("$"))
+		file, header, err := request.FormFile("file")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(header.Header.Get("Content-Type")).To(Equal("application/pdf"))
+		content, _ := io.ReadAll(file)
+
+		writer.Header().Set("Content-Type", "application/pdf")
+		_, _ = writer.Write(append(content, []byte("%signed")...))
+	}))
+	defer server.Close()
+
+	signer := esign.NewBsreSigner(server.URL, "user", "pass")
+	identity := &esign.Identity{Nik: "3275080903800022", Passphrase: "secret"}
+	signed, err := signer.SignPdfCtx(context.Background(), identity, strings.NewReader("%PDF-1.4"))
+	Expect(err).ToNot(HaveOccurred())
+	Expect(string(signed)).To(Equal("%PDF-1.4%signed"))
+
+	_, err = signer.SignPdfCtx(context.Background(), &esign.Identity{Nik: identity.Nik, Passphrase: "wrong"}, strings.NewReader("%PDF-1.4"))
+	Expect(errors.Is(err, esign.ErrSignRejected)).To(BeTrue())
+
+	signer.Password = "wrong"
+	_, err = signer.SignPdfCtx(context.Background(), identity, strings.NewReader("%PDF-1.4"))
+	Expect(err).To(HaveOccurred())
+	Expect(errors.Is(err, esign.ErrSignRejected)).To(BeFalse())
+}
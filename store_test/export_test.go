@@ -0,0 +1,126 @@
+package store_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	. "github.com/onsi/gomega"
+)
+
+func TestHandlePromotionCpnsAdmissionExport(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	profileDb, profileMock := MustCreateMock()
+	referenceDb, referenceMock := MustCreateMock()
+	client := CreateClientNoServer(db, profileDb, referenceDb)
+
+	asnId, positionId, unorId := uuid.NewString(), uuid.NewString(), uuid.NewString()
+	admissionDate := models.Iso8601Date(time.Now().Format("2006-01-02"))
+	mock.ExpectQuery("select (.+) from pengangkatan_cpns").WithArgs(admissionDate, pq.Array([]int{models.PromotionCpnsAdmissionStatusAccepted})).WillReturnRows(
+		sqlmock.NewRows([]string{"asn_id", "jabatan_fungsional_tujuan_id", "angka_kredit_pertama", "unor_id", "tgl_usulan", "no_usulan", "status"}).
+			AddRow(asnId, positionId, 25, unorId, admissionDate, "001/CPNS", models.PromotionCpnsAdmissionStatusAccepted),
+	)
+	profileMock.ExpectQuery("select").WithArgs(pq.Array([]string{asnId})).WillReturnRows(sqlmock.NewRows([]string{"id", "nip", "nama"}).AddRow(asnId, "199001012020011001", "Budi, S.Kom"))
+	referenceMock.ExpectQuery("select (.+) from jabatan_fungsional").WithArgs(pq.Array([]string{positionId})).WillReturnRows(sqlmock.NewRows([]string{"id", "nama"}).AddRow(positionId, "Pranata Komputer"))
+	referenceMock.ExpectQuery("select (.+) from unor").WithArgs(pq.Array([]string{unorId})).WillReturnRows(sqlmock.NewRows([]string{"id", "nama"}).AddRow(unorId, "Biro Umum"))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/v1/promotion-cpns/admission/search/export?format=csv&status=2&tgl_usulan="+string(admissionDate), nil)
+	client.HandlePromotionCpnsAdmissionExport(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.NewString()}))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+	MustMockExpectationsMet(profileMock)
+	MustMockExpectationsMet(referenceMock)
+	Expect(rec.Header().Get("Content-Type")).To(HavePrefix("text/csv"))
+	Expect(rec.Header().Get("Content-Disposition")).To(ContainSubstring(".csv"))
+
+	records, err := csv.NewReader(strings.NewReader(strings.TrimPrefix(rec.Body.String(), "\ufeff"))).ReadAll()
+	Expect(err).ToNot(HaveOccurred())
+	Expect(records).To(HaveLen(2))
+	Expect(records[0][0]).To(Equal("No. Usulan"))
+	Expect(records[1]).To(Equal([]string{"001/CPNS", string(admissionDate), "199001012020011001", "Budi, S.Kom", "Pranata Komputer", "25", "Biro Umum", "Diterima"}))
+}
+
+func TestHandleRequirementAdmissionExport(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	referenceDb, referenceMock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, referenceDb)
+
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+	positionId := uuid.NewString()
+	mock.ExpectQuery("select (.+) from kebutuhan").WithArgs(user.WorkAgencyId).WillReturnRows(
+		sqlmock.NewRows([]string{"tgl_usulan", "status", "jabatan_fungsional", "no_usulan", "tahun_anggaran"}).
+			AddRow(time.Now(), models.RequirementAdmissionStatusRevision, positionId, "002/KEB", "2024"),
+	)
+	referenceMock.ExpectQuery("select (.+) from instansi").WithArgs(pq.Array([]string{user.WorkAgencyId})).WillReturnRows(sqlmock.NewRows([]string{"id", "nama"}).AddRow(user.WorkAgencyId, "Badan Kepegawaian Negara"))
+	referenceMock.ExpectQuery("select (.+) from jabatan_fungsional").WithArgs(pq.Array([]string{positionId})).WillReturnRows(sqlmock.NewRows([]string{"id", "nama"}).AddRow(positionId, "Analis Kepegawaian"))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/v1/requirement/admission/search/export", nil)
+	client.HandleRequirementAdmissionExport(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+	MustMockExpectationsMet(referenceMock)
+	Expect(rec.Header().Get("Content-Type")).To(Equal("application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"))
+
+	reader, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	Expect(err).ToNot(HaveOccurred())
+	sheet := ""
+	for _, file := range reader.File {
+		if file.Name == "xl/worksheets/sheet1.xml" {
+			r, err := file.Open()
+			Expect(err).ToNot(HaveOccurred())
+			content, _ := ioutil.ReadAll(r)
+			sheet = string(content)
+		}
+	}
+	Expect(sheet).To(ContainSubstring("002/KEB"))
+	Expect(sheet).To(ContainSubstring("Perbaikan"))
+	Expect(sheet).To(ContainSubstring("Analis Kepegawaian"))
+	Expect(sheet).To(ContainSubstring("Badan Kepegawaian Negara"))
+}
+
+func TestHandleActivityAdmissionExportError(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+
+	// Unsupported formats are rejected before searching.
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/v1/activity/admission/search/export?format=pdf", nil)
+	client.HandleActivityAdmissionExport(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusBadRequest)
+	MustMockExpectationsMet(mock)
+
+	// A failed search is returned as a normal error response, not as an empty file.
+	mock.ExpectQuery("select (.+) from kegiatan").WillReturnError(errors.New("connection reset"))
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/api/v1/activity/admission/search/export", nil)
+	client.HandleActivityAdmissionExport(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusInternalServerError)
+	MustMockExpectationsMet(mock)
+	Expect(rec.Header().Get("Content-Disposition")).To(BeEmpty())
+}
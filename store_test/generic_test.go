@@ -9,7 +9,10 @@ import (
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	. "github.com/fazrithe/siasn-jf-backend-git/errnum"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/breaker"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
 	"github.com/fazrithe/siasn-jf-backend-git/store/models"
 	"github.com/google/uuid"
 	. "github.com/onsi/gomega"
@@ -42,6 +45,28 @@ func TestHandlePositionGradesGet(t *testing.T) {
 	Expect(result[0].PositionGradeId).To(Equal(dummy.PositionGradeId))
 }
 
+func TestHandlePositionGradesGetDependencyUnavailable(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(nil, nil, db)
+
+	mock.ExpectQuery("select").WillReturnError(&breaker.OpenError{Name: "reference_postgres", RetryAfter: 2500 * time.Millisecond})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/v1/generic/position/get", nil)
+	client.HandlePositionGradesGet(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.New().String(), WorkAgencyId: uuid.New().String()}))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusServiceUnavailable)
+	MustMockExpectationsMet(mock)
+	Expect(rec.Result().Header.Get("Retry-After")).To(Equal("3"))
+
+	result := &ec.Error{}
+	MustJsonDecode(rec.Result().Body, result)
+	Expect(result.Code).To(Equal(ErrCodeDependencyUnavailable))
+	Expect(result.Data).To(Equal(map[string]interface{}{"dependency": "reference_postgres"}))
+}
+
 func TestHandlePositionGradeBezettingGet(t *testing.T) {
 	RegisterTestingT(t)
 
@@ -0,0 +1,176 @@
+package store_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/store"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+	"github.com/google/uuid"
+	. "github.com/onsi/gomega"
+)
+
+var jobColumns = []string{"pekerjaan_id", "jenis", "modul", "entitas_id", "status", "percobaan", "coalesce(hasil, '')", "coalesce(pesan_error, '')", "created_at_ts", "modified_at_ts"}
+
+func TestHandleJobGet(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+	jobId := uuid.NewString()
+	promotionId := uuid.NewString()
+	mock.ExpectQuery("select (.+) from pekerjaan").WithArgs(jobId, user.AsnId).WillReturnRows(sqlmock.NewRows(jobColumns).AddRow(
+		jobId,
+		store.JobKindPromotionLetter,
+		store.StatusHistoryModulePromotion,
+		promotionId,
+		models.JobStatusDone,
+		1,
+		promotionId+".pdf",
+		"",
+		time.Now(),
+		time.Now(),
+	))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/v1/job/get?pekerjaan_id="+jobId, nil)
+	client.HandleJobGet(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+	job := &models.Job{}
+	MustJsonDecode(rec.Body, job)
+	Expect(job.Status).To(Equal(models.JobStatusDone))
+	Expect(job.Filename).To(Equal(promotionId + ".pdf"))
+
+	// Jobs of other users are not found.
+	mock.ExpectQuery("select (.+) from pekerjaan").WithArgs(jobId, user.AsnId).WillReturnRows(sqlmock.NewRows(jobColumns))
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/api/v1/job/get?pekerjaan_id="+jobId, nil)
+	client.HandleJobGet(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusNotFound)
+	MustMockExpectationsMet(mock)
+}
+
+func TestHandleJobList(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+	rows := sqlmock.NewRows(jobColumns)
+	for i := 0; i < 3; i++ {
+		rows.AddRow(uuid.NewString(), store.JobKindActivityCertificate, store.StatusHistoryModuleActivity, uuid.NewString(), models.JobStatusPending, 0, "", "", time.Now(), time.Now())
+	}
+	mock.ExpectQuery("select (.+) from pekerjaan").WithArgs(user.AsnId, models.JobStatusPending, 3, 2).WillReturnRows(rows)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/v1/job/list?status=pending&halaman=2&jumlah_per_halaman=2", nil)
+	client.HandleJobList(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+	result := &struct {
+		Data     []*models.Job `json:"data"`
+		Metadata struct {
+			HasNext bool `json:"has_next"`
+		} `json:"metadata"`
+	}{}
+	MustJsonDecode(rec.Body, result)
+	Expect(result.Data).To(HaveLen(2))
+	Expect(result.Metadata.HasNext).To(BeTrue())
+}
+
+func TestRunNextJobCtxNoJob(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+
+	mock.ExpectQuery("update pekerjaan set status = 'running'").WithArgs(client.Jobs.InstanceId, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"pekerjaan_id"}))
+
+	ran, err := client.RunNextJobCtx(context.Background())
+	Expect(err).ToNot(HaveOccurred())
+	Expect(ran).To(BeFalse())
+	MustMockExpectationsMet(mock)
+}
+
+func TestRunNextJobCtxRetry(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	referenceDb, referenceMock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, referenceDb)
+
+	jobId := uuid.NewString()
+	activityId := uuid.NewString()
+	claimRows := func(attempts int) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"pekerjaan_id", "jenis", "modul", "entitas_id", "payload", "percobaan", "maks_percobaan", "user_id"}).AddRow(
+			jobId,
+			store.JobKindActivityCertificate,
+			store.StatusHistoryModuleActivity,
+			activityId,
+			[]byte(`{"peserta_user_id":"`+uuid.NewString()+`"}`),
+			attempts,
+			2,
+			uuid.NewString(),
+		)
+	}
+
+	// A server error is retried after a backoff.
+	mock.ExpectQuery("update pekerjaan set status = 'running'").WithArgs(client.Jobs.InstanceId, sqlmock.AnyArg()).WillReturnRows(claimRows(1))
+	referenceMock.ExpectBegin().WillReturnError(sqlmock.ErrCancelled)
+	mock.ExpectExec("update pekerjaan set status = 'pending'").WithArgs(jobId, client.Jobs.Backoff.Seconds(), errnum.Errs[errnum.ErrCodeTxStart]).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ran, err := client.RunNextJobCtx(context.Background())
+	Expect(err).ToNot(HaveOccurred())
+	Expect(ran).To(BeTrue())
+	MustMockExpectationsMet(mock)
+
+	// It is failed once it has run out of attempts.
+	mock.ExpectQuery("update pekerjaan set status = 'running'").WithArgs(client.Jobs.InstanceId, sqlmock.AnyArg()).WillReturnRows(claimRows(2))
+	referenceMock.ExpectBegin().WillReturnError(sqlmock.ErrCancelled)
+	mock.ExpectExec("update pekerjaan set status = 'failed'").WithArgs(jobId, errnum.Errs[errnum.ErrCodeTxStart]).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ran, err = client.RunNextJobCtx(context.Background())
+	Expect(err).ToNot(HaveOccurred())
+	Expect(ran).To(BeTrue())
+	MustMockExpectationsMet(mock)
+}
+
+func TestRunNextJobCtxIdentityExpired(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+
+	// The signing identity of a job queued by another instance, or before a restart, is not available.
+	jobId := uuid.NewString()
+	mock.ExpectQuery("update pekerjaan set status = 'running'").WithArgs(client.Jobs.InstanceId, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"pekerjaan_id", "jenis", "modul", "entitas_id", "payload", "percobaan", "maks_percobaan", "user_id"}).AddRow(
+		jobId,
+		store.JobKindPromotionLetter,
+		store.StatusHistoryModulePromotion,
+		uuid.NewString(),
+		[]byte("{}"),
+		1,
+		3,
+		uuid.NewString(),
+	))
+	mock.ExpectExec("update pekerjaan set status = 'failed'").WithArgs(jobId, errnum.ErrJobIdentityExpired.Message).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ran, err := client.RunNextJobCtx(context.Background())
+	Expect(err).ToNot(HaveOccurred())
+	Expect(ran).To(BeTrue())
+	MustMockExpectationsMet(mock)
+}
@@ -3,6 +3,7 @@ package store_test
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"io"
 	"net/http"
@@ -10,21 +11,15 @@ import (
 	"os"
 
 	"github.com/DATA-DOG/go-sqlmock"
-	"github.com/fazrithe/siasn-jf-backend-git/libs/breaker"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/logutil"
 	"github.com/fazrithe/siasn-jf-backend-git/store"
+	"github.com/fazrithe/siasn-jf-backend-git/store/esign"
 	"github.com/fazrithe/siasn-jf-backend-git/store/object"
 	. "github.com/onsi/gomega"
 )
 
 func CreateClient(db, profileDb, referenceDb *sql.DB, h http.Handler) (*httptest.Server, *store.Client) {
 	s := httptest.NewServer(h)
-	rcb := &breaker.RateCircuitBreaker{
-		Limit:    1000,
-		Cooldown: 1,
-		Logger:   logutil.NewStdLogger(false, "test"),
-		Tripped:  make(chan struct{}),
-	}
 	c := &store.Client{
 		Db:                    db,
 		ProfileDb:             profileDb,
@@ -35,7 +30,8 @@ func CreateClient(db, profileDb, referenceDb *sql.DB, h http.Handler) (*httptest
 		DismissalStorage:      &object.MockStorage{},
 		PromotionStorage:      &object.MockStorage{},
 		AssessmentTeamStorage: &object.MockStorage{},
-		Breaker:               rcb,
+		Signer:                &esign.FakeSigner{},
+		Jobs:                  store.NewJobRunner(),
 		Logger:                logutil.NewStdLogger(false, "test"),
 	}
 
@@ -58,6 +54,17 @@ func MustMockExpectationsMet(mock sqlmock.Sqlmock) {
 	Expect(err).ShouldNot(HaveOccurred(), "some SQL expectations were not met: %v", err)
 }
 
+// ExpectStatusHistoryInsert expects an entry to be appended to status_hist. oldStatus 0 expects a null old status.
+func ExpectStatusHistoryInsert(mock sqlmock.Sqlmock, module string, entityId driver.Value, oldStatus, status int) {
+	var old driver.Value
+	if oldStatus != 0 {
+		old = oldStatus
+	}
+	mock.ExpectExec("insert into status_hist").
+		WithArgs(module, entityId, old, status, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
 func MustStatusCodeEqual(resp *http.Response, statusCode int) {
 	Expect(resp.StatusCode).To(Equal(statusCode), "status code not expected: %d, want %d", resp.StatusCode, statusCode)
 }
@@ -0,0 +1,222 @@
+package store_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/store"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+	"github.com/fazrithe/siasn-jf-backend-git/store/notify"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	. "github.com/onsi/gomega"
+	gomail "gopkg.in/mail.v2"
+)
+
+type mockSender struct {
+	messages []*gomail.Message
+}
+
+func (m *mockSender) Send(message *gomail.Message) error {
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+type notification struct {
+	event      *notify.Event
+	recipients []*notify.Recipient
+}
+
+type mockNotifier chan *notification
+
+func (m mockNotifier) Notify(event *notify.Event, recipients []*notify.Recipient) error {
+	m <- &notification{event: event, recipients: recipients}
+	return nil
+}
+
+func TestEmailNotifier(t *testing.T) {
+	RegisterTestingT(t)
+
+	sender := &mockSender{}
+	notifier := notify.NewEmailNotifier(sender, "noreply@bkn.go.id")
+	notifier.AppUrl = "https://jf.bkn.go.id"
+
+	err := notifier.Notify(&notify.Event{
+		Kind:       notify.EventRejected,
+		Module:     store.StatusHistoryModuleDismissal,
+		EntityId:   "ID",
+		Reason:     "REASON <b>",
+		ModifiedAt: time.Now(),
+	}, []*notify.Recipient{
+		{AsnId: "1", Name: "ASN", Email: "asn@bkn.go.id"},
+		{AsnId: "2", Name: "NO EMAIL"},
+	})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(sender.messages).To(HaveLen(1))
+
+	message := sender.messages[0]
+	Expect(message.GetHeader("To")).To(Equal([]string{`"ASN" <asn@bkn.go.id>`}))
+	Expect(message.GetHeader("Subject")).To(Equal([]string{"Usulan Pemberhentian ditolak"}))
+
+	body := &bytes.Buffer{}
+	_, err = message.WriteTo(body)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(body.String()).To(ContainSubstring("text/plain"))
+	Expect(body.String()).To(ContainSubstring("text/html"))
+	Expect(body.String()).To(ContainSubstring("REASON <b>"))
+	Expect(body.String()).To(ContainSubstring("REASON &lt;b&gt;"))
+	Expect(body.String()).To(ContainSubstring("https://jf.bkn.go.id"))
+}
+
+func TestHandleDismissalDenySetNotify(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	profileDb, profileMock := MustCreateMock()
+	client := CreateClientNoServer(db, profileDb, nil)
+	notifier := make(mockNotifier, 1)
+	client.Notifier = notifier
+
+	dummy := &models.DismissalDenyRequest{
+		DismissalId:         uuid.New().String(),
+		DismissalDenyReason: "REASON",
+	}
+	verifier := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString(), Email: "verifier@bkn.go.id"}
+	submitterAsnId := uuid.NewString()
+	dismissedAsnId := uuid.NewString()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("select status from pemberhentian").WithArgs(dummy.DismissalId, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(models.DismissalAdmissionStatusCreated))
+	mock.ExpectQuery("update").WillReturnRows(sqlmock.NewRows([]string{"status_ts"}).AddRow(time.Now()))
+	ExpectStatusHistoryInsert(mock, store.StatusHistoryModuleDismissal, dummy.DismissalId, models.DismissalAdmissionStatusCreated, models.DismissalAdmissionStatusRejected)
+	mock.ExpectCommit()
+
+	mock.ExpectExec("insert into notifikasi_penerima").WithArgs(verifier.AsnId, verifier.Email).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery("select user_id from status_hist").WithArgs(store.StatusHistoryModuleDismissal, dummy.DismissalId).WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(submitterAsnId))
+	mock.ExpectQuery("select asn_id from pemberhentian").WithArgs(dummy.DismissalId).WillReturnRows(sqlmock.NewRows([]string{"asn_id"}).AddRow(dismissedAsnId))
+	// The dismissed ASN has opted out, so it is not notified.
+	mock.ExpectQuery("select asn_id, email, berhenti_langganan from notifikasi_penerima").WithArgs(pq.Array([]string{submitterAsnId, dismissedAsnId})).WillReturnRows(sqlmock.NewRows([]string{"asn_id", "email", "berhenti_langganan"}).AddRow(submitterAsnId, "submitter@bkn.go.id", false).AddRow(dismissedAsnId, "dismissed@bkn.go.id", true))
+	profileMock.ExpectQuery("select id, nama, coalesce\\(email, ''\\) from orang").WithArgs(pq.Array([]string{submitterAsnId})).WillReturnRows(sqlmock.NewRows([]string{"id", "nama", "email"}).AddRow(submitterAsnId, "SUBMITTER", "submitter@profile.bkn.go.id"))
+
+	payload, _ := json.Marshal(dummy)
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/dismissal/deny/submit", bytes.NewBuffer(payload))
+	client.HandleDismissalDenySet(rec, auth.InjectUserDetail(req, verifier))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+
+	var n *notification
+	Eventually(notifier).Should(Receive(&n))
+	Expect(n.event.Kind).To(Equal(notify.EventRejected))
+	Expect(n.event.EntityId).To(Equal(dummy.DismissalId))
+	Expect(n.event.Reason).To(Equal(dummy.DismissalDenyReason))
+	Expect(n.recipients).To(Equal([]*notify.Recipient{{AsnId: submitterAsnId, Name: "SUBMITTER", Email: "submitter@bkn.go.id"}}))
+
+	MustMockExpectationsMet(mock)
+	MustMockExpectationsMet(profileMock)
+}
+
+func TestHandleDismissalDenySetNotifyNeverLoggedIn(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	profileDb, profileMock := MustCreateMock()
+	client := CreateClientNoServer(db, profileDb, nil)
+	notifier := make(mockNotifier, 1)
+	client.Notifier = notifier
+
+	dummy := &models.DismissalDenyRequest{
+		DismissalId:         uuid.New().String(),
+		DismissalDenyReason: "REASON",
+	}
+	verifier := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+	submitterAsnId := uuid.NewString()
+	dismissedAsnId := uuid.NewString()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("select status from pemberhentian").WithArgs(dummy.DismissalId, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(models.DismissalAdmissionStatusCreated))
+	mock.ExpectQuery("update").WillReturnRows(sqlmock.NewRows([]string{"status_ts"}).AddRow(time.Now()))
+	ExpectStatusHistoryInsert(mock, store.StatusHistoryModuleDismissal, dummy.DismissalId, models.DismissalAdmissionStatusCreated, models.DismissalAdmissionStatusRejected)
+	mock.ExpectCommit()
+
+	mock.ExpectQuery("select user_id from status_hist").WithArgs(store.StatusHistoryModuleDismissal, dummy.DismissalId).WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(submitterAsnId))
+	mock.ExpectQuery("select asn_id from pemberhentian").WithArgs(dummy.DismissalId).WillReturnRows(sqlmock.NewRows([]string{"asn_id"}).AddRow(dismissedAsnId))
+	// The dismissed ASN has never logged in, so the email is taken from the profile database.
+	mock.ExpectQuery("select asn_id, email, berhenti_langganan from notifikasi_penerima").WithArgs(pq.Array([]string{submitterAsnId, dismissedAsnId})).WillReturnRows(sqlmock.NewRows([]string{"asn_id", "email", "berhenti_langganan"}).AddRow(submitterAsnId, "submitter@bkn.go.id", false))
+	profileMock.ExpectQuery("select id, nama, coalesce\\(email, ''\\) from orang").WithArgs(pq.Array([]string{submitterAsnId, dismissedAsnId})).WillReturnRows(sqlmock.NewRows([]string{"id", "nama", "email"}).AddRow(submitterAsnId, "SUBMITTER", "").AddRow(dismissedAsnId, "DISMISSED", "dismissed@bkn.go.id"))
+
+	payload, _ := json.Marshal(dummy)
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/dismissal/deny/submit", bytes.NewBuffer(payload))
+	client.HandleDismissalDenySet(rec, auth.InjectUserDetail(req, verifier))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+
+	var n *notification
+	Eventually(notifier).Should(Receive(&n))
+	Expect(n.recipients).To(Equal([]*notify.Recipient{
+		{AsnId: submitterAsnId, Name: "SUBMITTER", Email: "submitter@bkn.go.id"},
+		{AsnId: dismissedAsnId, Name: "DISMISSED", Email: "dismissed@bkn.go.id"},
+	}))
+
+	MustMockExpectationsMet(mock)
+	MustMockExpectationsMet(profileMock)
+}
+
+func TestHandleNotificationPreferenceGet(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString(), Email: "asn@bkn.go.id"}
+	mock.ExpectQuery("select email, berhenti_langganan from notifikasi_penerima").WithArgs(user.AsnId).WillReturnRows(sqlmock.NewRows([]string{"email", "berhenti_langganan"}))
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/notification/preference", nil)
+	client.HandleNotificationPreferenceGet(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+
+	result := &models.NotificationPreference{}
+	MustJsonDecode(rec.Result().Body, result)
+	Expect(result).To(Equal(&models.NotificationPreference{Email: user.Email}))
+}
+
+func TestHandleNotificationPreferenceUpdate(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString(), Email: "asn@bkn.go.id"}
+	mock.ExpectExec("insert into notifikasi_penerima").WithArgs(user.AsnId, user.Email, true).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/api/v1/notification/preference", bytes.NewBufferString(`{"email": "other@example.com", "berhenti_langganan": true}`))
+	client.HandleNotificationPreferenceUpdate(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+
+	// Users without an email cannot save their preference.
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest("PUT", "/api/v1/notification/preference", bytes.NewBufferString(`{"berhenti_langganan": false}`))
+	client.HandleNotificationPreferenceUpdate(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusBadRequest)
+	result := &ec.Error{}
+	MustJsonDecode(rec.Result().Body, result)
+	Expect(result.Code).To(Equal(errnum.ErrCodeNotificationEmailMissing))
+}
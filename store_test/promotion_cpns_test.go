@@ -11,6 +11,7 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/store"
 	"github.com/fazrithe/siasn-jf-backend-git/store/models"
 	"github.com/google/uuid"
 	"github.com/lib/pq"
@@ -80,13 +81,15 @@ func TestHandlePromotionCpnsAdmissionGet(t *testing.T) {
 		&dummy.Status,
 		uuid.NewString(),
 	))
+	agencyId := uuid.NewString()
+	profileMock.ExpectQuery("select").WithArgs(dummy.AsnId).WillReturnRows(sqlmock.NewRows([]string{"instansi_kerja_id"}).AddRow(agencyId))
 	profileMock.ExpectQuery("select").WithArgs(pq.Array([]string{dummy.AsnId})).WillReturnRows(sqlmock.NewRows([]string{"id", "nip", "nama"}).AddRow(dummy.AsnId, dummy.AsnNip, dummy.AsnName))
 	referenceMock.ExpectQuery("select").WithArgs(pq.Array([]string{dummy.OrganizationUnitId})).WillReturnRows(sqlmock.NewRows([]string{"id", "nama"}).AddRow(dummy.OrganizationUnitId, dummy.OrganizationUnit))
 	referenceMock.ExpectQuery("select").WithArgs(pq.Array([]string{dummy.PromotionPositionId})).WillReturnRows(sqlmock.NewRows([]string{"id", "nama"}).AddRow(dummy.PromotionPositionId, dummy.PromotionPosition))
 
 	rec := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/promotion-cpns/admission/get?pengangkatan_cpns_id=%s", dummy.PromotionCpnsId), nil)
-	client.HandlePromotionCpnsAdmissionGet(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: dummy.SubmitterAsnId}))
+	client.HandlePromotionCpnsAdmissionGet(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: agencyId}))
 
 	MustStatusCodeEqual(rec.Result(), http.StatusOK)
 
@@ -180,7 +183,7 @@ func TestHandlePromotionCpnsAdmissionSearchPaginated(t *testing.T) {
 	}
 
 	referenceMock.ExpectBegin()
-	mock.ExpectQuery("select").WithArgs(admissionStatus, admissionDate, countPerPage+1, (pageNumber-1)*countPerPage).WillReturnRows(rows)
+	mock.ExpectQuery("select").WithArgs(admissionDate, pq.Array([]int{admissionStatus}), countPerPage+1, (pageNumber-1)*countPerPage).WillReturnRows(rows)
 	profileMock.ExpectQuery("select").WithArgs(pq.Array(asnIds)).WillReturnRows(asnRows)
 	referenceMock.ExpectQuery("select").WithArgs(pq.Array(unorIds)).WillReturnRows(unorRows)
 	referenceMock.ExpectQuery("select").WithArgs(pq.Array(positionIds)).WillReturnRows(positionRows)
@@ -212,13 +215,13 @@ func TestHandleGetPromotionCpnsStatusStatistic(t *testing.T) {
 	db, mock := MustCreateMock()
 	client := CreateClientNoServer(db, nil, nil)
 
-	statisticRows := sqlmock.NewRows([]string{"status", "jumlah"}).AddRow(1, 0).AddRow(2, 1)
+	statisticRows := sqlmock.NewRows([]string{"periode", "status", "jumlah"}).AddRow(nil, 1, 0).AddRow(nil, 2, 1)
 
 	mock.ExpectQuery("select").WillReturnRows(statisticRows)
 
 	rec := httptest.NewRecorder()
 	req := httptest.NewRequest("GET", "/api/v1/promotion-cpns/statistic/status/get", nil)
-	client.HandleGetPromotionCpnsStatusStatistic(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.New().String(), WorkAgencyId: uuid.New().String()}))
+	client.HandleGetPromotionCpnsStatusStatistic(rec, store.InjectUserRoles(auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.New().String(), WorkAgencyId: uuid.New().String()}), models.RoleBknAdmin))
 
 	MustStatusCodeEqual(rec.Result(), http.StatusOK)
 	MustMockExpectationsMet(mock)
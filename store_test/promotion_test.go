@@ -12,10 +12,14 @@ import (
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fazrithe/siasn-jf-backend-git/errnum"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/search"
+	"github.com/fazrithe/siasn-jf-backend-git/store"
 	"github.com/fazrithe/siasn-jf-backend-git/store/models"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	. "github.com/onsi/gomega"
 )
 
@@ -82,6 +86,7 @@ func TestHandlePromotionAdmissionSubmit(t *testing.T) {
 		sql.NullString{Valid: true, String: dummy.TestCertificate.DocumentNumber},
 		sql.NullString{Valid: true, String: string(dummy.TestCertificate.DocumentDate)},
 	).WillReturnResult(sqlmock.NewResult(1, 0))
+	ExpectStatusHistoryInsert(mock, store.StatusHistoryModulePromotion, sqlmock.AnyArg(), 0, models.PromotionAdmissionStatusCreated)
 	mock.ExpectCommit()
 
 	payload, _ := json.Marshal(dummy)
@@ -106,8 +111,10 @@ func TestHandlePromotionAdmissionAccept(t *testing.T) {
 	RegisterTestingT(t)
 
 	db, mock := MustCreateMock()
-	client := CreateClientNoServer(db, nil, nil)
+	profileDb, profileMock := MustCreateMock()
+	client := CreateClientNoServer(db, profileDb, nil)
 
+	asnId := uuid.NewString()
 	dummy := &models.PromotionAdmission{
 		PromotionId: uuid.New().String(),
 		AgencyId:    uuid.New().String(),
@@ -121,13 +128,15 @@ func TestHandlePromotionAdmissionAccept(t *testing.T) {
 	}
 
 	mock.ExpectBegin()
-	mock.ExpectQuery("select").WithArgs(dummy.PromotionId).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(models.PromotionAdmissionStatusCreated))
+	mock.ExpectQuery("select").WithArgs(dummy.PromotionId).WillReturnRows(sqlmock.NewRows([]string{"status", "asn_id", "jabatan_fungsional_tujuan_id"}).AddRow(models.PromotionAdmissionStatusCreated, asnId, uuid.NewString()))
+	profileMock.ExpectQuery("select").WithArgs(asnId).WillReturnRows(sqlmock.NewRows([]string{"instansi_kerja_id"}).AddRow(dummy.AgencyId))
 	mock.ExpectExec("update").WithArgs(
 		models.PromotionAdmissionStatusAccepted,
 		sqlmock.AnyArg(),
 		dummy.SubmitterAsnId,
 		dummy.PromotionId,
 	).WillReturnResult(sqlmock.NewResult(1, 0))
+	ExpectStatusHistoryInsert(mock, store.StatusHistoryModulePromotion, dummy.PromotionId, models.PromotionAdmissionStatusCreated, models.PromotionAdmissionStatusAccepted)
 	mock.ExpectCommit()
 
 	payload, _ := json.Marshal(dummy)
@@ -139,6 +148,7 @@ func TestHandlePromotionAdmissionAccept(t *testing.T) {
 	MustStatusCodeEqual(rec.Result(), http.StatusOK)
 
 	MustMockExpectationsMet(mock)
+	MustMockExpectationsMet(profileMock)
 
 	result := make(map[string]interface{}, 0)
 	MustJsonDecode(rec.Result().Body, &result)
@@ -147,12 +157,47 @@ func TestHandlePromotionAdmissionAccept(t *testing.T) {
 	Expect(result).To(HaveKey("modified_at"))
 }
 
+func TestHandlePromotionAdmissionAcceptOutOfScope(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	profileDb, profileMock := MustCreateMock()
+	client := CreateClientNoServer(db, profileDb, nil)
+
+	asnId := uuid.NewString()
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+	dummy := &models.PromotionAdmission{PromotionId: uuid.NewString()}
+
+	// The promoted ASN works in another agency, the promotion is treated as not found.
+	mock.ExpectBegin()
+	mock.ExpectQuery("select").WithArgs(dummy.PromotionId).WillReturnRows(sqlmock.NewRows([]string{"status", "asn_id", "jabatan_fungsional_tujuan_id"}).AddRow(models.PromotionAdmissionStatusCreated, asnId, uuid.NewString()))
+	profileMock.ExpectQuery("select").WithArgs(asnId).WillReturnRows(sqlmock.NewRows([]string{"instansi_kerja_id"}).AddRow(uuid.NewString()))
+	mock.ExpectRollback()
+
+	payload, _ := json.Marshal(dummy)
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/promotion/admission/accept", bytes.NewBuffer(payload))
+	client.HandlePromotionAdmissionAccept(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusNotFound)
+	MustMockExpectationsMet(mock)
+	MustMockExpectationsMet(profileMock)
+
+	result := &ec.Error{}
+	MustJsonDecode(rec.Result().Body, result)
+	Expect(result.Code).To(Equal(errnum.ErrCodeEntryNotFound))
+}
+
 func TestHandlePromotionAdmissionReject(t *testing.T) {
 	RegisterTestingT(t)
 
 	db, mock := MustCreateMock()
-	client := CreateClientNoServer(db, nil, nil)
+	profileDb, profileMock := MustCreateMock()
+	client := CreateClientNoServer(db, profileDb, nil)
 
+	asnId := uuid.NewString()
+	agencyId := uuid.NewString()
 	dummy := &models.PromotionReject{
 		PromotionId:    uuid.New().String(),
 		RejectReason:   uuid.New().String(),
@@ -160,7 +205,8 @@ func TestHandlePromotionAdmissionReject(t *testing.T) {
 	}
 
 	mock.ExpectBegin()
-	mock.ExpectQuery("select").WithArgs(dummy.PromotionId).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(models.PromotionAdmissionStatusCreated))
+	mock.ExpectQuery("select").WithArgs(dummy.PromotionId).WillReturnRows(sqlmock.NewRows([]string{"status", "asn_id", "jabatan_fungsional_tujuan_id"}).AddRow(models.PromotionAdmissionStatusCreated, asnId, uuid.NewString()))
+	profileMock.ExpectQuery("select").WithArgs(asnId).WillReturnRows(sqlmock.NewRows([]string{"instansi_kerja_id"}).AddRow(agencyId))
 	mock.ExpectExec("update").WithArgs(
 		models.PromotionAdmissionStatusRejected,
 		sqlmock.AnyArg(),
@@ -168,17 +214,19 @@ func TestHandlePromotionAdmissionReject(t *testing.T) {
 		dummy.RejectReason,
 		dummy.PromotionId,
 	).WillReturnResult(sqlmock.NewResult(1, 0))
+	ExpectStatusHistoryInsert(mock, store.StatusHistoryModulePromotion, dummy.PromotionId, models.PromotionAdmissionStatusCreated, models.PromotionAdmissionStatusRejected)
 	mock.ExpectCommit()
 
 	payload, _ := json.Marshal(dummy)
 
 	rec := httptest.NewRecorder()
 	req, _ := http.NewRequest("POST", "/api/v1/promotion/admission/reject", bytes.NewBuffer(payload))
-	client.HandlePromotionAdmissionReject(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: dummy.SubmitterAsnId, WorkAgencyId: dummy.SubmitterAsnId}))
+	client.HandlePromotionAdmissionReject(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: dummy.SubmitterAsnId, WorkAgencyId: agencyId}))
 
 	MustStatusCodeEqual(rec.Result(), http.StatusOK)
 
 	MustMockExpectationsMet(mock)
+	MustMockExpectationsMet(profileMock)
 
 	result := make(map[string]interface{}, 0)
 	MustJsonDecode(rec.Result().Body, &result)
@@ -224,7 +272,7 @@ func TestHandlePromotionAdmissionSearch(t *testing.T) {
 		dummy.Name,
 	)
 
-	mock.ExpectQuery("select").WithArgs(dummy.Status, dummy.PromotionType, dummy.RecommendationLetterDate, countPerPage+1, (pageNumber-1)*countPerPage).WillReturnRows(rows)
+	mock.ExpectQuery("select").WithArgs(dummy.PromotionType, dummy.RecommendationLetterDate, pq.Array([]int{dummy.Status}), countPerPage+1, (pageNumber-1)*countPerPage).WillReturnRows(rows)
 	profileMock.ExpectQuery("select").WillReturnRows(asnRows)
 
 	rec := httptest.NewRecorder()
@@ -257,13 +305,13 @@ func TestHandleGetPromotionStatusStatistic(t *testing.T) {
 	db, mock := MustCreateMock()
 	client := CreateClientNoServer(db, nil, nil)
 
-	statisticRows := sqlmock.NewRows([]string{"status", "jumlah"}).AddRow(1, 0).AddRow(2, 1)
+	statisticRows := sqlmock.NewRows([]string{"periode", "status", "jumlah"}).AddRow(nil, 1, 0).AddRow(nil, 2, 1)
 
 	mock.ExpectQuery("select").WillReturnRows(statisticRows)
 
 	rec := httptest.NewRecorder()
 	req := httptest.NewRequest("GET", "/api/v1/promotion/statistic/status/get", nil)
-	client.HandleGetPromotionStatusStatistic(rec, auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.New().String(), WorkAgencyId: uuid.New().String()}))
+	client.HandleGetPromotionStatusStatistic(rec, store.InjectUserRoles(auth.InjectUserDetail(req, &auth.Asn{AsnId: uuid.New().String(), WorkAgencyId: uuid.New().String()}), models.RoleBknAdmin))
 
 	MustStatusCodeEqual(rec.Result(), http.StatusOK)
 	MustMockExpectationsMet(mock)
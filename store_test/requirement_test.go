@@ -12,7 +12,11 @@ import (
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fazrithe/siasn-jf-backend-git/errnum"
 	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/store"
+	"github.com/fazrithe/siasn-jf-backend-git/store/esign"
 	"github.com/fazrithe/siasn-jf-backend-git/store/models"
 	"github.com/google/uuid"
 	"github.com/lib/pq"
@@ -83,7 +87,7 @@ func TestHandleRequirementAdmissionSubmit(t *testing.T) {
 	for _, rc := range dummy.RequirementCounts {
 		reqCountStmt.ExpectExec().WithArgs(sqlmock.AnyArg(), rc.OrganizationUnitId, rc.Count, 0).WillReturnResult(sqlmock.NewResult(0, 0))
 	}
-	mock.ExpectExec("insert").WithArgs(sqlmock.AnyArg(), models.RequirementAdmissionStatusCreated, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
+	ExpectStatusHistoryInsert(mock, store.StatusHistoryModuleRequirement, sqlmock.AnyArg(), 0, models.RequirementAdmissionStatusCreated)
 	stmt := mock.ExpectPrepare("insert")
 	for _, _ = range dummy.TempEstimationDocuments {
 		stmt.ExpectExec().WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
@@ -157,21 +161,21 @@ func TestHandleRequirementAdmissionEdit(t *testing.T) {
 	}
 	referenceMock.ExpectQuery("select").WithArgs(pq.Array(unorIds), sqlmock.AnyArg()).WillReturnRows(unorRows)
 	mock.ExpectBegin()
-	mock.ExpectQuery("update").WithArgs(
+	mock.ExpectQuery("select status from kebutuhan").WithArgs(dummy.RequirementId, pq.Array([]string{dummy.AgencyId}), pq.Array([]string{})).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(admissionStatus))
+	mock.ExpectExec("update").WithArgs(
 		dummy.PositionGrade,
 		dummy.TempCoverLetter.DocumentName,
 		dummy.FiscalYear,
 		dummy.AdmissionNumber,
 		dummy.RequirementId,
-		dummy.AgencyId,
-	).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(admissionStatus))
+	).WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectExec("delete").WithArgs(dummy.RequirementId).WillReturnResult(sqlmock.NewResult(1, 0))
 	profileMock.ExpectQuery("select").WithArgs(dummy.PositionGrade, pq.Array(unorIds)).WillReturnRows(sqlmock.NewRows([]string{"jabatan_fungsional_id", "unor_id", "count(*)"})) // Assume that no rows are returned, this could work too
 	reqCountStmt := mock.ExpectPrepare("insert")
 	for _, rc := range dummy.RequirementCounts {
 		reqCountStmt.ExpectExec().WithArgs(sqlmock.AnyArg(), rc.OrganizationUnitId, rc.Count, 0).WillReturnResult(sqlmock.NewResult(0, 0))
 	}
-	mock.ExpectExec("insert").WithArgs(sqlmock.AnyArg(), models.RequirementAdmissionStatusCreated, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
+	ExpectStatusHistoryInsert(mock, store.StatusHistoryModuleRequirement, dummy.RequirementId, admissionStatus, admissionStatus)
 	stmt := mock.ExpectPrepare("insert")
 	for range dummy.TempEstimationDocuments {
 		stmt.ExpectExec().WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
@@ -194,6 +198,76 @@ func TestHandleRequirementAdmissionEdit(t *testing.T) {
 	Expect(result.RequirementId).Should(Equal(dummy.RequirementId))
 }
 
+func TestHandleRequirementAdmissionEditOutOfScope(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	referenceDb, referenceMock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, referenceDb)
+
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+	dummy := &models.RequirementAdmission{
+		RequirementId:     uuid.NewString(),
+		PositionGrade:     uuid.NewString(),
+		FiscalYear:        uuid.NewString(),
+		AdmissionNumber:   uuid.NewString(),
+		RequirementCounts: []*models.RequirementCount{{OrganizationUnitId: uuid.NewString(), Count: 1}},
+	}
+
+	// The admission belongs to another agency, so the select does not match any row.
+	referenceMock.ExpectQuery("select").WithArgs(pq.Array([]string{dummy.RequirementCounts[0].OrganizationUnitId}), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(dummy.RequirementCounts[0].OrganizationUnitId))
+	mock.ExpectBegin()
+	mock.ExpectQuery("select status from kebutuhan").WithArgs(dummy.RequirementId, pq.Array([]string{user.WorkAgencyId}), pq.Array([]string{})).WillReturnRows(sqlmock.NewRows([]string{"status"}))
+	mock.ExpectRollback()
+
+	payload, _ := json.Marshal(dummy)
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/api/v1/requirement/admission/edit", bytes.NewBuffer(payload))
+	client.HandleRequirementAdmissionEdit(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusNotFound)
+	MustMockExpectationsMet(mock)
+	MustMockExpectationsMet(referenceMock)
+}
+
+func TestHandleRequirementAdmissionEditAccepted(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	referenceDb, referenceMock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, referenceDb)
+
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+	dummy := &models.RequirementAdmission{
+		RequirementId:     uuid.NewString(),
+		PositionGrade:     uuid.NewString(),
+		FiscalYear:        uuid.NewString(),
+		AdmissionNumber:   uuid.NewString(),
+		RequirementCounts: []*models.RequirementCount{{OrganizationUnitId: uuid.NewString(), Count: 1}},
+	}
+
+	// Accepted admissions cannot be edited anymore.
+	referenceMock.ExpectQuery("select").WithArgs(pq.Array([]string{dummy.RequirementCounts[0].OrganizationUnitId}), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(dummy.RequirementCounts[0].OrganizationUnitId))
+	mock.ExpectBegin()
+	mock.ExpectQuery("select status from kebutuhan").WithArgs(dummy.RequirementId, pq.Array([]string{user.WorkAgencyId}), pq.Array([]string{})).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(models.RequirementAdmissionStatusAccepted))
+	mock.ExpectRollback()
+
+	payload, _ := json.Marshal(dummy)
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/api/v1/requirement/admission/edit", bytes.NewBuffer(payload))
+	client.HandleRequirementAdmissionEdit(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusBadRequest)
+	MustMockExpectationsMet(mock)
+
+	result := &ec.Error{}
+	MustJsonDecode(rec.Result().Body, result)
+	Expect(result.Code).To(Equal(errnum.ErrCodeWorkflowTransitionInvalid))
+	Expect(result.Data).To(HaveKeyWithValue("aksi", store.WorkflowActionEdit))
+}
+
 func TestHandleRequirementAdmissionSearch(t *testing.T) {
 	RegisterTestingT(t)
 
@@ -345,7 +419,7 @@ func TestHandleRequirementVerificationSet(t *testing.T) {
 
 	mock.ExpectBegin()
 	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(models.RequirementAdmissionStatusCreated))
-	mock.ExpectExec("update").WithArgs(models.RequirementAdmissionStatusAccepted, dummy.CoverLetterNote, dummy.RequirementId, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
+	mock.ExpectExec("update").WithArgs(models.RequirementAdmissionStatusAccepted, dummy.CoverLetterNote, dummy.RequirementId, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
 	for _, doc := range dummy.EstimationDocumentNotes {
 		mock.ExpectQuery("update").WithArgs(doc.Note, doc.Filename, dummy.RequirementId).WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
 	}
@@ -353,7 +427,7 @@ func TestHandleRequirementVerificationSet(t *testing.T) {
 	for _, count := range dummy.RequirementCounts {
 		countStmt.ExpectExec().WithArgs(count.CountRecommendation, dummy.RequirementId, count.OrganizationUnitId).WillReturnResult(sqlmock.NewResult(1, 1))
 	}
-	mock.ExpectExec("insert").WithArgs(dummy.RequirementId, models.RequirementAdmissionStatusAccepted, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
+	ExpectStatusHistoryInsert(mock, store.StatusHistoryModuleRequirement, dummy.RequirementId, models.RequirementAdmissionStatusCreated, models.RequirementAdmissionStatusAccepted)
 	mock.ExpectCommit()
 
 	payload, _ := json.Marshal(dummy)
@@ -399,7 +473,7 @@ func TestHandleRequirementDenySet(t *testing.T) {
 
 	mock.ExpectBegin()
 	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(models.RequirementAdmissionStatusCreated))
-	mock.ExpectExec("update").WithArgs(models.RequirementAdmissionStatusRevision, dummy.RevisionReason, dummy.CoverLetterNote, dummy.RequirementId, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
+	mock.ExpectExec("update").WithArgs(models.RequirementAdmissionStatusRevision, dummy.RevisionReason, dummy.CoverLetterNote, dummy.RequirementId, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
 	for _, doc := range dummy.EstimationDocumentNotes {
 		mock.ExpectQuery("update").WithArgs(doc.Note, doc.Filename, dummy.RequirementId).WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
 	}
@@ -407,7 +481,7 @@ func TestHandleRequirementDenySet(t *testing.T) {
 	for _, count := range dummy.RequirementCounts {
 		countStmt.ExpectExec().WithArgs(count.CountRecommendation, dummy.RequirementId, count.OrganizationUnitId).WillReturnResult(sqlmock.NewResult(1, 1))
 	}
-	mock.ExpectExec("insert").WithArgs(dummy.RequirementId, models.RequirementAdmissionStatusRevision, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
+	ExpectStatusHistoryInsert(mock, store.StatusHistoryModuleRequirement, dummy.RequirementId, models.RequirementAdmissionStatusCreated, models.RequirementAdmissionStatusRevision)
 	mock.ExpectCommit()
 
 	payload, _ := json.Marshal(dummy)
@@ -501,7 +575,7 @@ func TestHandleBulkSubmitRecommendationLetter(t *testing.T) {
 	//referenceMock.ExpectQuery("select").WillReturnRows()
 	//referenceMock.ExpectQuery("select").WillReturnRows()
 	//mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"role_peg"}).AddRow(models.StaffRoleSupervisor)).WithArgs(dummy.TempRecommendationLetter.SignerId)
-	//mock.ExpectExec("update").WithArgs(models.RequirementAdmissionStatusAcceptedWithRecommendation, pq.Array(dummy.RequirementIds)).WillReturnResult(sqlmock.NewResult(1, 0))
+	//mock.ExpectExec("update").WithArgs(models.RequirementAdmissionStatusAcceptedWithRecommendation, pq.Array(dummy.RequirementIds), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 0))
 	//stmt := mock.ExpectPrepare("insert")
 	//statusStmt := mock.ExpectPrepare("insert")
 	//for _, rid := range dummy.RequirementIds {
@@ -541,7 +615,7 @@ func TestHandleGetRequirementStatusStatistic(t *testing.T) {
 	db, mock := MustCreateMock()
 	client := CreateClientNoServer(db, nil, nil)
 
-	statisticRows := sqlmock.NewRows([]string{"status", "jumlah"}).AddRow(1, 0).AddRow(2, 1)
+	statisticRows := sqlmock.NewRows([]string{"periode", "status", "jumlah"}).AddRow(nil, 1, 0).AddRow(nil, 2, 1)
 
 	mock.ExpectQuery("select").WillReturnRows(statisticRows)
 
@@ -552,3 +626,82 @@ func TestHandleGetRequirementStatusStatistic(t *testing.T) {
 	MustStatusCodeEqual(rec.Result(), http.StatusOK)
 	MustMockExpectationsMet(mock)
 }
+
+func TestHandleRequirementVerificationSignRecommendationLetter(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+	signer := &esign.FakeSigner{Passphrase: "secret"}
+	client.Signer = signer
+
+	filename := uuid.NewString() + ".pdf"
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString(), Nik: "3275080903800022"}
+	payload, _ := json.Marshal(map[string]string{"filename": filename, "passphrase": "secret"})
+	columns := []string{"is_signed", "coalesce(s.ttd_user_id, '')"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("select s.is_signed, .* for update of s").WithArgs(filename, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows(columns).AddRow(false, user.AsnId).AddRow(false, user.AsnId))
+	mock.ExpectExec("update surat_rekomendasi_kebutuhan s").WithArgs(filename, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/requirement/verify/sign/recommendation-letter", bytes.NewBuffer(payload))
+	client.HandleRequirementVerificationSignRecommendationLetter(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+	Expect(signer.Count()).To(Equal(1))
+	Expect(signer.LastIdentity()).To(Equal(&esign.Identity{Nik: user.Nik, Passphrase: "secret"}))
+	Expect(rec.Body.String()).ToNot(ContainSubstring("secret"))
+
+	// Already signed letters are not signed again.
+	mock.ExpectBegin()
+	mock.ExpectQuery("select s.is_signed").WithArgs(filename, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows(columns).AddRow(true, user.AsnId))
+	mock.ExpectCommit()
+
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/requirement/verify/sign/recommendation-letter", bytes.NewBuffer(payload))
+	client.HandleRequirementVerificationSignRecommendationLetter(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+	Expect(signer.Count()).To(Equal(1))
+
+	// Letters outside the agency scope do not exist.
+	mock.ExpectBegin()
+	mock.ExpectQuery("select s.is_signed").WithArgs(filename, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows(columns))
+	mock.ExpectRollback()
+
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/requirement/verify/sign/recommendation-letter", bytes.NewBuffer(payload))
+	client.HandleRequirementVerificationSignRecommendationLetter(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusNotFound)
+	MustMockExpectationsMet(mock)
+
+	// Only the signer of the letter can sign it.
+	mock.ExpectBegin()
+	mock.ExpectQuery("select s.is_signed").WithArgs(filename, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows(columns).AddRow(false, uuid.NewString()))
+	mock.ExpectRollback()
+
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/requirement/verify/sign/recommendation-letter", bytes.NewBuffer(payload))
+	client.HandleRequirementVerificationSignRecommendationLetter(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusForbidden)
+	MustMockExpectationsMet(mock)
+	Expect(signer.Count()).To(Equal(1))
+
+	// The letter stays unsigned if signing fails.
+	mock.ExpectBegin()
+	mock.ExpectQuery("select s.is_signed").WithArgs(filename, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows(columns).AddRow(false, user.AsnId))
+	mock.ExpectRollback()
+
+	rec = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/requirement/verify/sign/recommendation-letter", bytes.NewBuffer(bytes.Replace(payload, []byte("secret"), []byte("wrong"), 1)))
+	client.HandleRequirementVerificationSignRecommendationLetter(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusInternalServerError)
+	MustMockExpectationsMet(mock)
+}
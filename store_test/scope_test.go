@@ -0,0 +1,87 @@
+package store_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/store"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+	"github.com/google/uuid"
+	. "github.com/onsi/gomega"
+)
+
+func TestGetAgencyScope(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, _ := MustCreateMock()
+	profileDb, _ := MustCreateMock()
+	referenceDb, referenceMock := MustCreateMock()
+	client := CreateClientNoServer(db, profileDb, referenceDb)
+	client.PembinaPositionCache = store.NewPembinaPositionCache(time.Minute)
+
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+	otherAgencyId := uuid.NewString()
+
+	// Agency users are limited to their own agency.
+	scope, err := client.GetAgencyScopeCtx(context.Background(), user, map[string]struct{}{models.RoleAgencyAdmin: {}})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(scope.AgencyIds).To(Equal([]string{user.WorkAgencyId}))
+	Expect(scope.PositionIds).To(BeEmpty())
+	Expect(scope.Check(user.WorkAgencyId, "")).To(Succeed())
+	Expect(ec.Wrap(scope.Check(otherAgencyId, uuid.NewString())).Code).To(Equal(errnum.ErrCodeEntryNotFound))
+
+	// Pembina users also see the entries of the positions they supervise, in any agency.
+	positionId := uuid.NewString()
+	referenceMock.ExpectQuery("select jf.id from jabatan_fungsional").WithArgs(user.WorkAgencyId).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(positionId))
+	scope, err = client.GetAgencyScopeCtx(context.Background(), user, map[string]struct{}{models.RolePembina: {}})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(scope.AgencyIds).To(Equal([]string{user.WorkAgencyId}))
+	Expect(scope.PositionIds).To(Equal([]string{positionId}))
+	Expect(scope.Check(otherAgencyId, positionId)).To(Succeed())
+	Expect(ec.Wrap(scope.Check(otherAgencyId, uuid.NewString())).Code).To(Equal(errnum.ErrCodeEntryNotFound))
+	Expect(ec.Wrap(scope.Check(otherAgencyId, "")).Code).To(Equal(errnum.ErrCodeEntryNotFound))
+
+	// The positions are cached, reference is not queried again.
+	scope, err = client.GetAgencyScopeCtx(context.Background(), user, map[string]struct{}{models.RolePembina: {}})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(scope.PositionIds).To(Equal([]string{positionId}))
+	MustMockExpectationsMet(referenceMock)
+
+	// BKN admins are unrestricted.
+	scope, err = client.GetAgencyScopeCtx(context.Background(), user, map[string]struct{}{models.RoleBknAdmin: {}})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(scope.Unrestricted).To(BeTrue())
+	Expect(scope.Contains(otherAgencyId)).To(BeTrue())
+
+	// Service accounts are limited to their agencies, whatever their roles.
+	serviceAccount := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: user.WorkAgencyId, ScopeAgencyIds: []string{user.WorkAgencyId, otherAgencyId}}
+	scope, err = client.GetAgencyScopeCtx(context.Background(), serviceAccount, map[string]struct{}{models.RoleBknAdmin: {}, models.RolePembina: {}})
+	Expect(err).ToNot(HaveOccurred())
+	Expect(scope.Unrestricted).To(BeFalse())
+	Expect(scope.AgencyIds).To(Equal([]string{user.WorkAgencyId, otherAgencyId}))
+	Expect(scope.PositionIds).To(BeEmpty())
+
+	Expect(store.NewAgencyScope("", otherAgencyId, otherAgencyId).AgencyIds).To(Equal([]string{otherAgencyId}))
+}
+
+func TestPembinaPositionCache(t *testing.T) {
+	RegisterTestingT(t)
+
+	cache := store.NewPembinaPositionCache(time.Millisecond)
+	cache.Set("A", []string{"1"})
+	positionIds, ok := cache.Get("A")
+	Expect(ok).To(BeTrue())
+	Expect(positionIds).To(Equal([]string{"1"}))
+
+	_, ok = cache.Get("B")
+	Expect(ok).To(BeFalse())
+
+	time.Sleep(2 * time.Millisecond)
+	_, ok = cache.Get("A")
+	Expect(ok).To(BeFalse())
+}
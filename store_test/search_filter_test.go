@@ -0,0 +1,181 @@
+package store_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	. "github.com/onsi/gomega"
+)
+
+func TestHandleDismissalAdmissionsSearchOptions(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	profileDb, profileMock := MustCreateMock()
+	client := CreateClientNoServer(db, profileDb, nil)
+
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+	asnIds := []string{uuid.NewString(), uuid.NewString()}
+
+	profileMock.ExpectQuery("select t.id from orang").WithArgs("budi_", `%budi\_%`, 1000).WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(asnIds[0]).AddRow(asnIds[1]),
+	)
+	mock.ExpectQuery(`from pemberhentian where instansi_id = \$1 and tgl_pemberhentian::date >= \$2::date and tgl_pemberhentian::date <= \$3::date and status = any\(\$4\) and no_usulan ilike \$5 and asn_id = any\(\$6\) order by no_usulan asc, uuid_pemberhentian asc limit \$7 offset \$8`).
+		WithArgs(
+			user.WorkAgencyId,
+			"2024-01-01",
+			"2024-03-31",
+			pq.Array([]int{models.DismissalAdmissionStatusCreated, models.DismissalAdmissionStatusAccepted}),
+			"%2024/PB%",
+			pq.Array(asnIds),
+			11,
+			0,
+		).
+		WillReturnRows(sqlmock.NewRows([]string{"uuid_pemberhentian"}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/v1/dismissal/admission/search/paginated?tgl_dari=2024-01-01&tgl_sampai=2024-03-31&status=1&status=2&no_usulan=2024/PB&asn=budi_&urutan=no_usulan&jabatan_fungsional_id=ignored", nil)
+	client.HandleDismissalAdmissionsSearchPaginated(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+	MustMockExpectationsMet(profileMock)
+}
+
+func TestHandleRequirementAdmissionSearchOptionsSort(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+	positionId := uuid.NewString()
+
+	mock.ExpectQuery(`from kebutuhan where instansi_id = \$1 and jabatan_fungsional = \$2 order by status desc, kebutuhan_id desc limit \$3 offset \$4`).
+		WithArgs(user.WorkAgencyId, positionId, 6, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"kebutuhan_id"}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/v1/requirement/admission/search/paginated?urutan=-status&halaman=2&jumlah_per_halaman=5&asn=ignored&jabatan_fungsional_id="+positionId, nil)
+	client.HandleRequirementAdmissionSearchPaginated(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+}
+
+func TestHandleAdmissionSearchOptionsInvalid(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+
+	for query, code := range map[string]int{
+		"status=1&status=99":                        errnum.ErrCodeFilterStatusInvalid,
+		"tgl_dari=01-01-2024":                       errnum.ErrCodeFilterInvalidDate,
+		"tgl_dari=2024-02-01&tgl_sampai=2024-01-31": errnum.ErrCodeFilterDateRangeInvalid,
+		"urutan=nama":                               errnum.ErrCodeFilterSortInvalid,
+		"urutan=--status":                           errnum.ErrCodeFilterSortInvalid,
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/v1/activity/admission/search/paginated?"+query, nil)
+		client.HandleActivityAdmissionSearchPaginated(rec, auth.InjectUserDetail(req, user))
+
+		MustStatusCodeEqual(rec.Result(), http.StatusBadRequest)
+		result := &ec.Error{}
+		MustJsonDecode(rec.Result().Body, result)
+		Expect(result.Code).To(Equal(code), query)
+	}
+
+	MustMockExpectationsMet(mock)
+}
+
+func TestHandleRequirementAdmissionSearchCursor(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+	ids := []string{uuid.NewString(), uuid.NewString(), uuid.NewString()}
+	columns := []string{"kebutuhan_id", "tgl_usulan", "status", "jabatan_fungsional", "no_usulan", "tahun_anggaran", "sort_key", "id"}
+	now := time.Now()
+
+	// The first page has no cursor, an extra row tells that there is a next page.
+	mock.ExpectQuery(`select (.+), tgl_usulan::text, kebutuhan_id::text from kebutuhan where instansi_id = \$1 order by tgl_usulan desc, kebutuhan_id desc limit \$2$`).
+		WithArgs(user.WorkAgencyId, 3).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(ids[0], now, 1, "", "003", "2024", "2024-01-03 00:00:00+07", ids[0]).
+			AddRow(ids[1], now, 1, "", "002", "2024", "2024-01-02 00:00:00+07", ids[1]).
+			AddRow(ids[2], now, 1, "", "001", "2024", "2024-01-01 00:00:00+07", ids[2]),
+		)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/v1/requirement/admission/search/paginated?pagination=cursor&jumlah_per_halaman=2", nil)
+	client.HandleRequirementAdmissionSearchPaginated(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+
+	type cursorPage struct {
+		Data     []*models.RequirementAdmissionResult `json:"data"`
+		Metadata struct {
+			Total      int    `json:"total"`
+			HasNext    bool   `json:"halaman_berikutnya"`
+			NextCursor string `json:"next_cursor"`
+		} `json:"metadata"`
+	}
+
+	result := &cursorPage{}
+	MustJsonDecode(rec.Result().Body, result)
+	Expect(result.Data).To(HaveLen(2))
+	Expect(result.Metadata.Total).To(Equal(-1))
+	Expect(result.Metadata.HasNext).To(BeTrue())
+	Expect(result.Metadata.NextCursor).ToNot(BeEmpty())
+
+	// The next page starts after the last row of the first page.
+	mock.ExpectQuery(`from kebutuhan where instansi_id = \$1 and \(tgl_usulan, kebutuhan_id\) < \(\$2, \$3\) order by tgl_usulan desc, kebutuhan_id desc limit \$4$`).
+		WithArgs(user.WorkAgencyId, "2024-01-02 00:00:00+07", ids[1], 3).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(ids[2], now, 1, "", "001", "2024", "2024-01-01 00:00:00+07", ids[2]))
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/api/v1/requirement/admission/search/paginated?jumlah_per_halaman=2&cursor="+result.Metadata.NextCursor, nil)
+	client.HandleRequirementAdmissionSearchPaginated(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+
+	cursor := result.Metadata.NextCursor
+	result = &cursorPage{}
+	MustJsonDecode(rec.Result().Body, result)
+	Expect(result.Data).To(HaveLen(1))
+	Expect(result.Metadata.HasNext).To(BeFalse())
+	Expect(result.Metadata.NextCursor).To(BeEmpty())
+
+	// A cursor only works with the sort order it was created with.
+	for query, code := range map[string]int{
+		"cursor=" + cursor + "&urutan=status": errnum.ErrCodeCursorInvalid,
+		"cursor=not-a-cursor":                 errnum.ErrCodeCursorInvalid,
+		"pagination=keyset":                   errnum.ErrCodePaginationInvalid,
+	} {
+		rec = httptest.NewRecorder()
+		req = httptest.NewRequest("GET", "/api/v1/requirement/admission/search/paginated?"+query, nil)
+		client.HandleRequirementAdmissionSearchPaginated(rec, auth.InjectUserDetail(req, user))
+
+		MustStatusCodeEqual(rec.Result(), http.StatusBadRequest)
+		errResult := &ec.Error{}
+		MustJsonDecode(rec.Result().Body, errResult)
+		Expect(errResult.Code).To(Equal(code), query)
+	}
+
+	MustMockExpectationsMet(mock)
+}
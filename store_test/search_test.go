@@ -0,0 +1,112 @@
+package store_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/store"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	. "github.com/onsi/gomega"
+)
+
+func TestHandleSearch(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	profileDb, profileMock := MustCreateMock()
+	client := CreateClientNoServer(db, profileDb, nil)
+
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+	activityId, promotionId := uuid.NewString(), uuid.NewString()
+	attendeeIds := []string{uuid.NewString()}
+	agencyAsnIds := []string{attendeeIds[0], uuid.NewString()}
+	columns := []string{"id", "no_usulan", "status", "tgl_usulan", "judul", "instansi_id", "asn_id", "rank"}
+	tsQuery := "pranata:* & komp:* & 2024:*"
+
+	profileMock.ExpectQuery(`select id from orang where to_tsvector\('simple', nama\) @@ to_tsquery\('simple', \$1\) limit \$2`).
+		WithArgs(tsQuery, 1000).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(attendeeIds[0]))
+	mock.ExpectQuery(`from kegiatan where \(pencarian @@ to_tsquery\('siasn_jf', \$1\) or kegiatan_id in \(select kegiatan_kegiatan_id from perserta_kegiatan where pegawai_user_id = any\(\$2\)\)\) and instansi_id = any\(\$3\) order by rank desc, kegiatan_id desc limit \$4$`).
+		WithArgs(tsQuery, pq.Array(attendeeIds), pq.Array([]string{user.WorkAgencyId}), 5).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(activityId, "001/KEG/2024", 1, time.Now(), "Pranata Komputer", user.WorkAgencyId, "", 0.2))
+
+	// Promotions do not store their agency, they are limited to the ASNs of the agency.
+	profileMock.ExpectQuery("select id from pns where instansi_kerja_id").
+		WithArgs(pq.Array([]string{user.WorkAgencyId})).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(agencyAsnIds[0]).AddRow(agencyAsnIds[1]))
+	mock.ExpectQuery(`from pengangkatan where \(pencarian @@ to_tsquery\('siasn_jf', \$1\) or asn_id = any\(\$2\)\) and asn_id = any\(\$3\) order by rank desc, uuid_pengangkatan desc limit \$4$`).
+		WithArgs(tsQuery, pq.Array(attendeeIds), pq.Array(agencyAsnIds), 5).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(promotionId, "002/PA/2024", 2, time.Now(), "", "", attendeeIds[0], 0.6))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/v1/search?q=Pranata+Komp+2024/a&jenis=activity&jenis=promotion&jumlah=5", nil)
+	client.HandleSearch(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+	MustMockExpectationsMet(profileMock)
+
+	hits := make([]*models.SearchHit, 0)
+	MustJsonDecode(rec.Result().Body, &hits)
+	Expect(hits).To(HaveLen(2))
+	Expect(hits[0].Type).To(Equal(store.SearchTypePromotion))
+	Expect(hits[0].Id).To(Equal(promotionId))
+	Expect(hits[0].AsnId).To(Equal(attendeeIds[0]))
+	Expect(hits[1].Type).To(Equal(store.SearchTypeActivity))
+	Expect(hits[1].Title).To(Equal("Pranata Komputer"))
+	Expect(hits[1].AgencyId).To(Equal(user.WorkAgencyId))
+}
+
+func TestHandleSearchUnrestricted(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+
+	// Requirements do not have ASNs, the profile database is not searched.
+	mock.ExpectQuery(`from kebutuhan where pencarian @@ to_tsquery\('siasn_jf', \$1\) order by rank desc, kebutuhan_id desc limit \$2$`).
+		WithArgs("kebutuhan:*", store.DefaultSearchCount).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "no_usulan", "status", "tgl_usulan", "judul", "instansi_id", "asn_id", "rank"}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/v1/search?q=Kebutuhan&jenis=requirement&jenis=requirement", nil)
+	client.HandleSearch(rec, store.InjectUserRoles(auth.InjectUserDetail(req, user), models.RoleBknAdmin))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+}
+
+func TestHandleSearchInvalid(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+
+	for query, code := range map[string]int{
+		"q=":                   errnum.ErrCodeSearchQueryInvalid,
+		"q=a+%26+b":            errnum.ErrCodeSearchQueryInvalid,
+		"q=budi&jenis=unknown": errnum.ErrCodeSearchTypeInvalid,
+		"q=budi&jumlah=101":    errnum.ErrCodeListCountPerPage,
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/v1/search?"+query, nil)
+		client.HandleSearch(rec, auth.InjectUserDetail(req, user))
+
+		MustStatusCodeEqual(rec.Result(), http.StatusBadRequest)
+		result := &ec.Error{}
+		MustJsonDecode(rec.Result().Body, result)
+		Expect(result.Code).To(Equal(code), query)
+	}
+
+	MustMockExpectationsMet(mock)
+}
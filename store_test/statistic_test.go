@@ -0,0 +1,125 @@
+package store_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/fazrithe/siasn-jf-backend-git/store"
+	"github.com/fazrithe/siasn-jf-backend-git/store/models"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	. "github.com/onsi/gomega"
+)
+
+func TestHandleGetPromotionStatusStatisticAgencyScope(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	profileDb, profileMock := MustCreateMock()
+	client := CreateClientNoServer(db, profileDb, nil)
+
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+	asnIds := []string{uuid.NewString(), uuid.NewString()}
+
+	// Promotions do not store their agency, they are scoped by the ASNs of the agency of the user.
+	profileMock.ExpectQuery("select id from pns (.+) union all select id from pppk").WithArgs(pq.Array([]string{user.WorkAgencyId})).WillReturnRows(
+		sqlmock.NewRows([]string{"id"}).AddRow(asnIds[0]).AddRow(asnIds[1]),
+	)
+	mock.ExpectQuery(`select null::date, status, count\(\*\) from pengangkatan where \(asn_id = any\(\$1\)\) and tgl_usulan::date >= \$2::date and tgl_usulan::date <= \$3::date group by 1, 2`).
+		WithArgs(pq.Array(asnIds), "2024-01-01", "2024-12-31").
+		WillReturnRows(sqlmock.NewRows([]string{"periode", "status", "jumlah"}).AddRow(nil, models.PromotionAdmissionStatusAccepted, 3))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/v1/promotion/statistic/status/get?tgl_awal=2024-01-01&tgl_akhir=2024-12-31", nil)
+	client.HandleGetPromotionStatusStatistic(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+	MustMockExpectationsMet(profileMock)
+
+	var result []*models.StatisticStatus
+	MustJsonDecode(rec.Result().Body, &result)
+	Expect(result).To(HaveLen(len(models.PromotionAdmissionStatuses)))
+	for _, statistic := range result {
+		if statistic.Status == models.PromotionAdmissionStatusAccepted {
+			Expect(statistic.Count).To(Equal(3))
+		} else {
+			Expect(statistic.Count).To(Equal(0))
+		}
+	}
+}
+
+func TestHandleGetActivityStatusStatisticSeries(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+	agencyId, positionId := uuid.NewString(), uuid.NewString()
+
+	mock.ExpectQuery(`select date_trunc\('quarter', tgl_usulan\)::date, status, count\(\*\) from kegiatan where instansi_id = any\(\$1\) and jabatan_jenjang = \$2 and tgl_usulan::date >= \$3::date and tgl_usulan::date <= \$4::date group by 1, 2`).
+		WithArgs(pq.Array([]string{agencyId}), positionId, "2024-01-01", "2024-09-30").
+		WillReturnRows(sqlmock.NewRows([]string{"periode", "status", "jumlah"}).
+			AddRow(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), models.ActivityAdmissionStatusCreated, 2).
+			AddRow(time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), models.ActivityAdmissionStatusAccepted, 1),
+		)
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/v1/activity/statistic/status/series?group_by=quarter&tgl_awal=2024-01-01&tgl_akhir=2024-09-30&instansi_id="+agencyId+"&jabatan_fungsional_id="+positionId, nil)
+	client.HandleGetActivityStatusStatisticSeries(rec, store.InjectUserRoles(auth.InjectUserDetail(req, user), models.RoleBknAdmin))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusOK)
+	MustMockExpectationsMet(mock)
+
+	var result []*models.StatisticPeriod
+	MustJsonDecode(rec.Result().Body, &result)
+	Expect(result).To(HaveLen(3))
+	Expect(result[0].Period).To(Equal("2024-Q1"))
+	Expect(result[1].Period).To(Equal("2024-Q2"))
+	Expect(result[2].Period).To(Equal("2024-Q3"))
+	Expect(result[2].StartDate).To(Equal(models.Iso8601Date("2024-07-01")))
+
+	counts := func(period *models.StatisticPeriod) map[int]int {
+		c := make(map[int]int)
+		for _, statistic := range period.Statuses {
+			c[statistic.Status] = statistic.Count
+		}
+		return c
+	}
+	Expect(counts(result[0])).To(HaveKeyWithValue(models.ActivityAdmissionStatusCreated, 2))
+	Expect(counts(result[1])).To(HaveKeyWithValue(models.ActivityAdmissionStatusCreated, 0))
+	Expect(counts(result[2])).To(HaveKeyWithValue(models.ActivityAdmissionStatusAccepted, 1))
+}
+
+func TestHandleGetStatusStatisticSeriesInvalid(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+
+	for query, code := range map[string]int{
+		"group_by=week": errnum.ErrCodeStatisticGroupInvalid,
+		"tgl_awal=2024-02-01&tgl_akhir=2024-01-01": errnum.ErrCodeStatisticDateRangeInvalid,
+		"tgl_awal=2000-01-01&tgl_akhir=2024-01-01": errnum.ErrCodeStatisticDateRangeInvalid,
+		"tgl_akhir=31-12-2024":                     errnum.ErrCodeFilterInvalidDate,
+	} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/v1/requirement/statistic/status/series?"+query, nil)
+		client.HandleGetRequirementStatusStatisticSeries(rec, auth.InjectUserDetail(req, user))
+
+		MustStatusCodeEqual(rec.Result(), http.StatusBadRequest)
+		result := &ec.Error{}
+		MustJsonDecode(rec.Result().Body, result)
+		Expect(result.Code).To(Equal(code), query)
+	}
+
+	MustMockExpectationsMet(mock)
+}
@@ -0,0 +1,97 @@
+package store_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/fazrithe/siasn-jf-backend-git/errnum"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/auth"
+	"github.com/fazrithe/siasn-jf-backend-git/libs/ec"
+	"github.com/google/uuid"
+	. "github.com/onsi/gomega"
+)
+
+// validationErrorFields decodes a validation error response and returns the rule failed by each field.
+func validationErrorFields(response *http.Response) (code int, fields map[string]string) {
+	result := &ec.Error{}
+	MustJsonDecode(response.Body, result)
+
+	fields = make(map[string]string)
+	data, _ := result.Data.([]interface{})
+	for _, fieldErr := range data {
+		fieldErrMap := fieldErr.(map[string]interface{})
+		fields[fieldErrMap["field"].(string)] = fieldErrMap["rule"].(string)
+	}
+	return result.Code, fields
+}
+
+func TestDecodeRequestJsonValidation(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+
+	body := `{"jabatan_jenjang": "jf", "tahun_anggaran": "2024", "kebutuhan_id": "123", "jumlah_kebutuhan": [{"unit_organisasi_id": "unor", "jumlah": 1}, {"jumlah": -1}]}`
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/v1/requirement/admission/submit", strings.NewReader(body))
+	client.HandleRequirementAdmissionSubmit(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusBadRequest)
+	code, fields := validationErrorFields(rec.Result())
+	Expect(code).To(Equal(errnum.ErrCodeRequestValidation))
+	Expect(fields).To(Equal(map[string]string{
+		"kebutuhan_id":                           "uuid",
+		"no_usulan":                              "required",
+		"jumlah_kebutuhan[1].unit_organisasi_id": "required",
+		"jumlah_kebutuhan[1].jumlah":             "min=1",
+	}))
+
+	MustMockExpectationsMet(mock)
+}
+
+func TestDecodeRequestSchemaValidation(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/v1/activity/admission/search-asn?nip=19850330", nil)
+	client.HandleActivityAdmissionAsnGet(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusBadRequest)
+	code, fields := validationErrorFields(rec.Result())
+	Expect(code).To(Equal(errnum.ErrCodeRequestValidation))
+	Expect(fields).To(Equal(map[string]string{"nip": "nip"}))
+
+	MustMockExpectationsMet(mock)
+}
+
+func TestPromotionCpnsAdmissionSubmitValidation(t *testing.T) {
+	RegisterTestingT(t)
+
+	db, mock := MustCreateMock()
+	client := CreateClientNoServer(db, nil, nil)
+	user := &auth.Asn{AsnId: uuid.NewString(), WorkAgencyId: uuid.NewString()}
+
+	body := `{"nomor_usulan": "001/PC/2024", "tanggal_usulan": "2024-13-01", "unor_id": "unor", "surat_pak": {"nama_file": "pak.pdf"}}`
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/v1/promotion-cpns/admission/submit", strings.NewReader(body))
+	client.HandlePromotionCpnsAdmissionSubmit(rec, auth.InjectUserDetail(req, user))
+
+	MustStatusCodeEqual(rec.Result(), http.StatusBadRequest)
+	code, fields := validationErrorFields(rec.Result())
+	Expect(code).To(Equal(errnum.ErrCodeRequestValidation))
+	Expect(fields).To(Equal(map[string]string{
+		"tanggal_usulan":               "iso_date",
+		"asn_id":                       "required",
+		"jabatan_fungsional_tujuan_id": "required",
+		"surat_pengangkatan":           "required",
+	}))
+
+	MustMockExpectationsMet(mock)
+}
@@ -0,0 +1,75 @@
+package store_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fazrithe/siasn-jf-backend-git/store/workflow"
+	. "github.com/onsi/gomega"
+)
+
+func TestWorkflow(t *testing.T) {
+	RegisterTestingT(t)
+
+	errNoReason := errors.New("no reason")
+	wf := &workflow.Workflow{
+		Name:   "test",
+		States: map[int]string{1: "created", 2: "accepted", 3: "rejected", 4: "archived"},
+		Transitions: []*workflow.Transition{
+			{Action: "accept", From: []int{1}, To: 2, Roles: []string{"verifier"}, Documents: []string{"surat"}},
+			{Action: "reject", From: []int{1}, To: 3, Roles: []string{"verifier"}, Guard: func(request interface{}) error {
+				if request.(string) == "" {
+					return errNoReason
+				}
+				return nil
+			}},
+			{Action: "archive", From: []int{2, 3}, To: 4, Deprecated: true},
+			{Action: "edit", From: []int{1}, Keep: true, Roles: []string{"admin"}},
+		},
+	}
+
+	verifier := map[string]struct{}{"verifier": {}}
+	next := wf.Next(1, verifier)
+	Expect(next).To(HaveLen(2))
+	Expect(next[0].Action).To(Equal("accept"))
+	Expect(next[1].Action).To(Equal("reject"))
+	Expect(wf.Next(1, map[string]struct{}{})).To(BeEmpty())
+	Expect(wf.Next(2, verifier)).To(BeEmpty())
+
+	transition, err := wf.Check(1, "accept", []string{"surat"}, nil)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(transition.To).To(Equal(2))
+
+	var te *workflow.TransitionError
+	_, err = wf.Check(1, "accept", nil, nil)
+	Expect(errors.Is(err, workflow.ErrDocumentMissing)).To(BeTrue())
+	Expect(errors.As(err, &te)).To(BeTrue())
+	Expect(te.Missing).To(Equal([]string{"surat"}))
+
+	_, err = wf.Check(2, "accept", []string{"surat"}, nil)
+	Expect(errors.Is(err, workflow.ErrTransitionInvalid)).To(BeTrue())
+	Expect(errors.As(err, &te)).To(BeTrue())
+	Expect(te.Allowed).To(BeEmpty())
+
+	_, err = wf.Check(1, "unknown", nil, nil)
+	Expect(errors.Is(err, workflow.ErrActionUnknown)).To(BeTrue())
+	Expect(errors.As(err, &te)).To(BeTrue())
+	Expect(te.Allowed).To(Equal([]string{"accept", "reject", "edit"}))
+
+	_, err = wf.Check(1, "reject", nil, "")
+	Expect(err).To(Equal(errNoReason))
+
+	// Deprecated transitions can still be done.
+	_, err = wf.Can(3, "archive")
+	Expect(err).ToNot(HaveOccurred())
+
+	// Keep transitions do not change the status.
+	transition, err = wf.Check(1, "edit", nil, nil)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(transition.Next(1)).To(Equal(1))
+	_, err = wf.Check(2, "edit", nil, nil)
+	Expect(errors.Is(err, workflow.ErrTransitionInvalid)).To(BeTrue())
+
+	Expect(wf.Documents(2)).To(Equal([]string{"surat"}))
+	Expect(wf.Documents(1)).To(BeEmpty())
+}